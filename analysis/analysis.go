@@ -0,0 +1,157 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package analysis finds policies which conflict with or are shadowed by other policies, and simulates which
+// decisions a change of a policy set would flip. Its results are machine-readable, so it can be used to gate changes
+// to a policy set in CI.
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/ory/ladon"
+)
+
+// Kinds of findings.
+const (
+	// KindConflict is reported for an allow and a deny policy whose subjects, resources and actions overlap.
+	KindConflict = "conflict"
+
+	// KindShadowed is reported for an allow policy which never grants access, because an unconditional deny
+	// policy covers all of its subjects, resources and actions.
+	KindShadowed = "shadowed"
+)
+
+// Finding is a single problem found by Analyze.
+type Finding struct {
+	Kind    string `json:"kind"`
+	Policy  string `json:"policy"`
+	Other   string `json:"other"`
+	Message string `json:"message"`
+}
+
+// Report is the result of Analyze.
+type Report struct {
+	Policies int       `json:"policies"`
+	Findings []Finding `json:"findings"`
+}
+
+// OK returns true if nothing was found.
+func (r *Report) OK() bool {
+	return len(r.Findings) == 0
+}
+
+// Analyze returns the conflicts and shadowed policies in policies. Every pair of policies is reported at most
+// once; a shadowed policy is not reported as a conflict of the policy shadowing it. Overlaps of regular
+// expressions are approximated like ladon.FindConflicts does.
+func Analyze(policies ladon.Policies) (*Report, error) {
+	report := &Report{Policies: len(policies), Findings: []Finding{}}
+	for k, p := range policies {
+		conflicts, err := ladon.FindConflicts(p, policies[k+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range conflicts {
+			allow, deny := p, c
+			if ladon.Effect(p.GetEffect()) == ladon.EffectDeny {
+				allow, deny = c, p
+			}
+
+			if shadows(deny, allow) {
+				report.Findings = append(report.Findings, Finding{
+					Kind:    KindShadowed,
+					Policy:  allow.GetID(),
+					Other:   deny.GetID(),
+					Message: fmt.Sprintf("Policy %s never grants access because policy %s denies all of its requests", allow.GetID(), deny.GetID()),
+				})
+				continue
+			}
+
+			report.Findings = append(report.Findings, Finding{
+				Kind:    KindConflict,
+				Policy:  p.GetID(),
+				Other:   c.GetID(),
+				Message: fmt.Sprintf("Policies %s and %s overlap but have opposite effects", p.GetID(), c.GetID()),
+			})
+		}
+	}
+	return report, nil
+}
+
+// shadows returns true if deny applies to every request allow applies to.
+func shadows(deny, allow ladon.Policy) bool {
+	if len(deny.GetConditions()) > 0 || ladon.HasExclusions(deny) {
+		return false
+	}
+
+	return covers(deny, allow, ladon.RequestSubject, deny.GetSubjects(), allow.GetSubjects()) &&
+		covers(deny, allow, ladon.RequestResource, deny.GetResources(), allow.GetResources()) &&
+		covers(deny, allow, ladon.RequestAction, deny.GetActions(), allow.GetActions())
+}
+
+// covers returns true if every template of b is certainly matched by a template of a. Unlike overlaps, this
+// errs on the side of false: unrelated regular expressions never cover each other.
+func covers(p, q ladon.Policy, field ladon.RequestField, a, b []string) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	for _, y := range b {
+		covered := false
+		for _, x := range a {
+			if covered = coversTemplate(p, q, field, x, y); covered {
+				break
+			}
+		}
+
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func coversTemplate(p, q ladon.Policy, field ladon.RequestField, x, y string) bool {
+	pm, qm := ladon.PolicyMatchMode(p), ladon.PolicyMatchMode(q)
+	if x == y && pm == qm {
+		return true
+	}
+
+	switch pm {
+	case ladon.MatchModeRegex:
+		if x == string(p.GetStartDelimiter())+".*"+string(p.GetEndDelimiter()) {
+			return true
+		}
+	case ladon.MatchModeGlob:
+		if x == "*" {
+			return true
+		}
+	}
+
+	// Hierarchical resources cover their descendants, which are covered by any hierarchical resource covering them.
+	hierarchical := field == ladon.RequestResource && pm == ladon.MatchModeHierarchical && qm == ladon.MatchModeHierarchical
+	if !ladon.IsLiteralTemplate(q, y) && !hierarchical {
+		return false
+	}
+
+	matches, err := ladon.DefaultMatcher.MatchesField(p, field, []string{x}, y)
+	return err == nil && matches
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+func TestAnalyze(t *testing.T) {
+	report, err := Analyze(ladon.Policies{
+		&ladon.DefaultPolicy{ID: "read", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "no-max", Subjects: []string{"max"}, Resources: []string{"articles:<.*>"}, Actions: []string{"<.*>"}, Effect: ladon.DenyAccess},
+		&ladon.DefaultPolicy{ID: "max-edit", Subjects: []string{"max"}, Resources: []string{"articles:1", "articles:2"}, Actions: []string{"update"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "max-comments", Subjects: []string{"max"}, Resources: []string{"comments:1"}, Actions: []string{"update"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "no-ken", Subjects: []string{"ken"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: ladon.DenyAccess, Conditions: ladon.Conditions{"ip": &ladon.CIDRCondition{CIDR: "10.0.0.0/8"}}},
+		&ladon.DefaultPolicy{ID: "ken", Subjects: []string{"ken"}, Resources: []string{"comments:1"}, Actions: []string{"update"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "no-sam", Subjects: []string{"sam"}, Resources: []string{"articles"}, Actions: []string{"*"}, Effect: ladon.DenyAccess, MatchMode: ladon.MatchModeHierarchical},
+		&ladon.DefaultPolicy{ID: "sam", Subjects: []string{"sam"}, Resources: []string{"articles:1"}, Actions: []string{"*"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeHierarchical},
+	})
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 8, report.Policies)
+
+	var findings [][3]string
+	for _, f := range report.Findings {
+		findings = append(findings, [3]string{f.Kind, f.Policy, f.Other})
+	}
+	assert.Equal(t, [][3]string{
+		{KindConflict, "read", "no-max"},
+		{KindConflict, "read", "no-ken"},
+		{KindShadowed, "max-edit", "no-max"},
+		// no-ken only applies to some IP addresses, so ken may still grant access.
+		{KindConflict, "no-ken", "ken"},
+		{KindShadowed, "sam", "no-sam"},
+	}, findings)
+
+	ok, err := Analyze(ladon.Policies{
+		&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "2", Subjects: []string{"max"}, Resources: []string{"<.*>"}, Actions: []string{"delete"}, Effect: ladon.DenyAccess},
+	})
+	require.NoError(t, err)
+	assert.True(t, ok.OK())
+}
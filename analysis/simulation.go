@@ -0,0 +1,191 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package analysis
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+// ChangeSet is a proposed change of a policy set.
+type ChangeSet struct {
+	// Add are policies which do not exist yet.
+	Add []*ladon.DefaultPolicy `json:"add,omitempty"`
+
+	// Modify are new versions of existing policies.
+	Modify []*ladon.DefaultPolicy `json:"modify,omitempty"`
+
+	// Remove are the IDs of existing policies which are deleted.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// Apply returns a copy of policies with the change set applied. It fails if a policy to add exists already or a
+// policy to modify or remove does not exist.
+func (c *ChangeSet) Apply(policies ladon.Policies) (ladon.Policies, error) {
+	index := make(map[string]int, len(policies))
+	for k, p := range policies {
+		index[p.GetID()] = k
+	}
+
+	changed := append(ladon.Policies{}, policies...)
+	removed := map[string]bool{}
+	for _, id := range c.Remove {
+		if _, ok := index[id]; !ok {
+			return nil, errors.Errorf(`Policy "%s" can not be removed because it does not exist`, id)
+		}
+		removed[id] = true
+	}
+
+	for _, p := range c.Modify {
+		k, ok := index[p.GetID()]
+		if !ok || removed[p.GetID()] {
+			return nil, errors.Errorf(`Policy "%s" can not be modified because it does not exist`, p.GetID())
+		}
+		changed[k] = p
+	}
+
+	result := make(ladon.Policies, 0, len(changed)+len(c.Add))
+	for _, p := range changed {
+		if !removed[p.GetID()] {
+			result = append(result, p)
+		}
+	}
+
+	for _, p := range c.Add {
+		if _, ok := index[p.GetID()]; ok && !removed[p.GetID()] {
+			return nil, errors.Errorf(`Policy "%s" can not be added because it exists`, p.GetID())
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// Outcome is the decision on a request.
+type Outcome struct {
+	Allowed bool `json:"allowed"`
+
+	// Policies are the IDs of the policies which decided the request.
+	Policies []string `json:"policies"`
+
+	// Error is set if the request could not be decided, for example because of a broken condition.
+	Error string `json:"error,omitempty"`
+}
+
+// Flip is a request whose decision is changed by a change set.
+type Flip struct {
+	Request ladon.Request `json:"request"`
+	Before  Outcome       `json:"before"`
+	After   Outcome       `json:"after"`
+}
+
+// Simulation is the result of Simulate.
+type Simulation struct {
+	// Requests is the number of simulated requests.
+	Requests int `json:"requests"`
+
+	// Flips are the requests which are granted before and denied after the change set was applied, or vice versa,
+	// or which could be decided only before or after, in the order of the requests.
+	Flips []Flip `json:"flips"`
+}
+
+// OK returns true if no decision flipped.
+func (s *Simulation) OK() bool {
+	return len(s.Flips) == 0
+}
+
+// Simulate evaluates requests against policies before and after changes are applied and reports the decisions which
+// flip. Requests are decided like warden does with DoPoliciesAllow, including its strategy, default effect,
+// enrichers and normalizers, but neither its manager, audit logger nor metric is used. warden may be nil.
+//
+// Requests can be recorded, see RecordedRequests, or synthetic. Requests with a time are evaluated at that time, so
+// date conditions decide recorded requests like they did originally.
+func Simulate(warden *ladon.Ladon, policies ladon.Policies, changes *ChangeSet, requests []ladon.Request) (*Simulation, error) {
+	changed, err := changes.Apply(policies)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := new(ladon.AuditRecorder)
+	simulated := ladon.Ladon{}
+	if warden != nil {
+		simulated = *warden
+	}
+	simulated.Manager = nil
+	simulated.AuditLogger = recorder
+	simulated.Metric = new(ladon.MetricNoOp)
+
+	simulation := &Simulation{Requests: len(requests), Flips: []Flip{}}
+	for _, r := range requests {
+		before := decide(&simulated, recorder, &r, policies)
+		after := decide(&simulated, recorder, &r, changed)
+		if before.Allowed != after.Allowed || (before.Error == "") != (after.Error == "") {
+			simulation.Flips = append(simulation.Flips, Flip{Request: r, Before: before, After: after})
+		}
+	}
+	return simulation, nil
+}
+
+// decide returns the outcome of r, which rec records if it is the audit logger of warden.
+func decide(warden *ladon.Ladon, rec *ladon.AuditRecorder, r *ladon.Request, policies ladon.Policies) Outcome {
+	rec.Reset()
+	err := warden.DoPoliciesAllow(r, policies)
+	last := rec.Last()
+	if last == nil && err == nil {
+		// The warden granted the request without auditing it, so the deciding policies are unknown.
+		return Outcome{Allowed: true, Policies: []string{}}
+	} else if last == nil {
+		// Only decisions are audited, so the request could not be decided.
+		return Outcome{Policies: []string{}, Error: err.Error()}
+	}
+	return Outcome{Allowed: last.Allowed, Policies: last.Policies}
+}
+
+// recordedPageSize is the number of decisions RecordedRequests reads at once.
+const recordedPageSize = 1000
+
+// RecordedRequests returns the requests of the decisions m recorded at or after from and before to, oldest first,
+// as a corpus for Simulate. Zero bounds are ignored. Recorded requests were redacted, so conditions on redacted
+// context values may decide them differently.
+func RecordedRequests(m ladon.AuditManager, from, to time.Time) ([]ladon.Request, error) {
+	var requests []ladon.Request
+	for offset := int64(0); ; offset += recordedPageSize {
+		records, err := m.FindDecisions(from, to, recordedPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			requests = append(requests, record.Request)
+		}
+
+		if len(records) < recordedPageSize {
+			break
+		}
+	}
+
+	// Decisions are returned newest first.
+	for i, j := 0, len(requests)-1; i < j; i, j = i+1, j-1 {
+		requests[i], requests[j] = requests[j], requests[i]
+	}
+	return requests, nil
+}
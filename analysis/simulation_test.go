@@ -0,0 +1,130 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package analysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+func TestChangeSetApply(t *testing.T) {
+	policies := ladon.Policies{
+		&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "2", Effect: ladon.AllowAccess},
+	}
+
+	changed, err := (&ChangeSet{
+		Add:    []*ladon.DefaultPolicy{{ID: "3", Effect: ladon.AllowAccess}, {ID: "1", Effect: ladon.AllowAccess}},
+		Modify: []*ladon.DefaultPolicy{{ID: "2", Effect: ladon.DenyAccess}},
+		Remove: []string{"1"},
+	}).Apply(policies)
+	require.NoError(t, err)
+	require.Len(t, changed, 3)
+	assert.Equal(t, []string{"2", "3", "1"}, []string{changed[0].GetID(), changed[1].GetID(), changed[2].GetID()})
+	assert.Equal(t, ladon.DenyAccess, changed[0].GetEffect())
+	assert.Equal(t, ladon.AllowAccess, policies[1].GetEffect())
+
+	for k, c := range []*ChangeSet{
+		{Add: []*ladon.DefaultPolicy{{ID: "1", Effect: ladon.AllowAccess}}},
+		{Modify: []*ladon.DefaultPolicy{{ID: "3", Effect: ladon.AllowAccess}}},
+		{Modify: []*ladon.DefaultPolicy{{ID: "1", Effect: ladon.AllowAccess}}, Remove: []string{"1"}},
+		{Remove: []string{"3"}},
+	} {
+		_, err := c.Apply(policies)
+		assert.Error(t, err, "%d", k)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	policies := ladon.Policies{
+		&ladon.DefaultPolicy{ID: "read", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "edit", Subjects: []string{"peter"}, Resources: []string{"articles:<.*>"}, Actions: []string{"update"}, Effect: ladon.AllowAccess},
+	}
+	changes := &ChangeSet{
+		Add: []*ladon.DefaultPolicy{
+			{ID: "no-ken", Subjects: []string{"ken"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: ladon.DenyAccess},
+			{ID: "broken", Subjects: []string{"<[>"}, Resources: []string{"<.*>"}, Actions: []string{"delete"}, Effect: ladon.AllowAccess},
+		},
+		Modify: []*ladon.DefaultPolicy{
+			{ID: "edit", Subjects: []string{"peter", "max"}, Resources: []string{"articles:<.*>"}, Actions: []string{"update"}, Effect: ladon.AllowAccess},
+		},
+	}
+
+	trail := memory.NewMemoryAuditManager()
+	recorded := &ladon.Ladon{Manager: memory.NewMemoryManager(), AuditLogger: &ladon.AuditTrail{Manager: trail}}
+	for _, r := range []*ladon.Request{
+		{Subject: "peter", Action: "get", Resource: "articles:1", Time: time.Unix(1, 0)},
+		{Subject: "ken", Action: "get", Resource: "articles:1", Time: time.Unix(2, 0)},
+		{Subject: "max", Action: "update", Resource: "articles:1", Time: time.Unix(3, 0)},
+	} {
+		recorded.DoPoliciesAllow(r, policies)
+	}
+
+	requests, err := RecordedRequests(trail, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	assert.Equal(t, "peter", requests[0].Subject)
+
+	requests = append(requests,
+		ladon.Request{Subject: "max", Action: "get", Resource: "articles:1"},
+		ladon.Request{Subject: "max", Action: "delete", Resource: "articles:1"},
+	)
+	simulation, err := Simulate(nil, policies, changes, requests)
+	require.NoError(t, err)
+	assert.False(t, simulation.OK())
+	assert.Equal(t, 5, simulation.Requests)
+	require.Len(t, simulation.Flips, 3)
+
+	// ken loses read access and max gains edit access, while max keeps read access.
+	assert.Equal(t, "ken", simulation.Flips[0].Request.Subject)
+	assert.Equal(t, Outcome{Allowed: true, Policies: []string{"read"}}, simulation.Flips[0].Before)
+	assert.Equal(t, Outcome{Policies: []string{"read", "no-ken"}}, simulation.Flips[0].After)
+	assert.Equal(t, "max", simulation.Flips[1].Request.Subject)
+	assert.False(t, simulation.Flips[1].Before.Allowed)
+	assert.Equal(t, Outcome{Allowed: true, Policies: []string{"edit"}}, simulation.Flips[1].After)
+
+	// Deletes can not be decided anymore, because the new policy is broken.
+	assert.Equal(t, "delete", simulation.Flips[2].Request.Action)
+	assert.Empty(t, simulation.Flips[2].Before.Error)
+	assert.NotEmpty(t, simulation.Flips[2].After.Error)
+
+	// The warden's configuration is used.
+	simulation, err = Simulate(&ladon.Ladon{DefaultEffect: ladon.EffectAllow}, policies, &ChangeSet{Remove: []string{"edit"}}, requests)
+	require.NoError(t, err)
+	assert.True(t, simulation.OK())
+
+	_, err = Simulate(nil, policies, &ChangeSet{Remove: []string{"unknown"}}, requests)
+	assert.Error(t, err)
+}
+
+func TestRecorderUnaudited(t *testing.T) {
+	policies := ladon.Policies{&ladon.DefaultPolicy{ID: "read", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}}
+	warden := &ladon.Ladon{AuditLogger: ladon.DefaultAuditLogger, Metric: new(ladon.MetricNoOp)}
+
+	rec := new(ladon.AuditRecorder)
+	assert.Equal(t, Outcome{Allowed: true, Policies: []string{}}, decide(warden, rec, &ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"}, policies))
+	assert.NotEmpty(t, decide(warden, rec, &ladon.Request{Subject: "ken", Action: "get", Resource: "articles:1"}, policies).Error)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"sort"
+)
+
+// Grant is a subject template which is allowed to perform an action on a resource.
+type Grant struct {
+	// Subject is the subject template of the allow policy, which may contain a regular expression.
+	Subject string `json:"subject"`
+
+	// Policy is the ID of the allow policy.
+	Policy string `json:"policy"`
+
+	// Tenant is the tenant of the allow policy.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Conditional is true if the allow policy has conditions, so access depends on the request's context.
+	Conditional bool `json:"conditional"`
+
+	// DeniedBy lists the deny policies which may override the grant for some subjects or contexts.
+	DeniedBy []string `json:"denied_by,omitempty"`
+}
+
+// Audience returns the subjects of all tenants which are allowed to perform action on resource, sorted by
+// subject. Subjects which an unconditional deny policy always denies are omitted; deny policies which only deny
+// some of the subjects matched by a template, or only in some contexts, are listed in the grant's DeniedBy.
+func (l *Ladon) Audience(resource, action string) ([]Grant, error) {
+	if err := l.checkIndex(); err != nil {
+		return nil, err
+	}
+
+	policies, err := l.Manager.FindPoliciesForResource(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var allows, denies Policies
+	for _, p := range policies {
+		if err := l.Verifier.Verify(p); err != nil {
+			return nil, err
+		}
+
+		if !PolicyActive(p) {
+			continue
+		}
+
+		_, excludedResources, excludedActions := PolicyExclusions(p)
+		if am, err := l.matchesExcluding(p, RequestAction, p.GetActions(), excludedActions, action); err != nil {
+			return nil, err
+		} else if !am {
+			continue
+		}
+
+		if rm, err := l.matchesExcluding(p, RequestResource, p.GetResources(), excludedResources, resource); err != nil {
+			return nil, err
+		} else if !rm {
+			continue
+		}
+
+		switch Effect(p.GetEffect()) {
+		case EffectAllow:
+			allows = append(allows, p)
+		case EffectDeny:
+			denies = append(denies, p)
+		}
+	}
+
+	grants := []Grant{}
+	for _, p := range allows {
+		excluded, _, _ := PolicyExclusions(p)
+		for _, subject := range p.GetSubjects() {
+			if IsLiteralTemplate(p, subject) && len(excluded) > 0 {
+				if em, err := l.matches(p, RequestSubject, excluded, subject); err != nil {
+					return nil, err
+				} else if em {
+					continue
+				}
+			}
+
+			grant := Grant{Subject: subject, Policy: p.GetID(), Tenant: PolicyTenant(p), Conditional: len(p.GetConditions()) > 0}
+
+			denied := false
+			for _, d := range denies {
+				if PolicyTenant(d) != grant.Tenant {
+					continue
+				}
+
+				if IsLiteralTemplate(p, subject) && len(d.GetConditions()) == 0 {
+					excludedSubjects, _, _ := PolicyExclusions(d)
+					if dm, err := l.matchesExcluding(d, RequestSubject, d.GetSubjects(), excludedSubjects, subject); err != nil {
+						return nil, err
+					} else if dm {
+						denied = true
+						break
+					}
+				}
+
+				if overlap, err := patternsOverlap(p, d, []string{subject}, d.GetSubjects()); err != nil {
+					return nil, err
+				} else if overlap {
+					grant.DeniedBy = append(grant.DeniedBy, d.GetID())
+				}
+			}
+
+			if !denied {
+				grants = append(grants, grant)
+			}
+		}
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Subject != grants[j].Subject {
+			return grants[i].Subject < grants[j].Subject
+		}
+		return grants[i].Policy < grants[j].Policy
+	})
+	return grants, nil
+}
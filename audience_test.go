@@ -0,0 +1,58 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestAudience(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "admins", Subjects: []string{"<admin:.*>"}, Resources: []string{"databases:<.*>"}, Actions: []string{"delete"}, Effect: AllowAccess},
+		{ID: "dba", Subjects: []string{"peter", "max"}, Resources: []string{"databases:production"}, Actions: []string{"<delete|create>"}, Effect: AllowAccess},
+		{ID: "oncall", Subjects: []string{"ken"}, Resources: []string{"databases:production"}, Actions: []string{"delete"}, Effect: AllowAccess, Conditions: Conditions{"ip": &CIDRCondition{CIDR: "10.0.0.0/8"}}},
+		{ID: "readers", Subjects: []string{"<.*>"}, Resources: []string{"databases:production"}, Actions: []string{"get"}, Effect: AllowAccess},
+		{ID: "no-max", Subjects: []string{"max"}, Resources: []string{"databases:<.*>"}, Actions: []string{"<.*>"}, Effect: DenyAccess},
+		{ID: "no-interns", Subjects: []string{"admin:intern"}, Resources: []string{"<.*>"}, Actions: []string{"delete"}, Effect: DenyAccess},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	w := &Ladon{Manager: m}
+	grants, err := w.Audience("databases:production", "delete")
+	require.NoError(t, err)
+	assert.Equal(t, []Grant{
+		{Subject: "<admin:.*>", Policy: "admins", DeniedBy: []string{"no-interns"}},
+		{Subject: "ken", Policy: "oncall", Conditional: true},
+		{Subject: "peter", Policy: "dba"},
+	}, grants)
+
+	grants, err = w.Audience("databases:staging", "drop")
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+}
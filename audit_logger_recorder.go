@@ -0,0 +1,56 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import "sync"
+
+// AuditRecorder is an audit logger which keeps the last decision, so tools which evaluate requests with a copy of a
+// warden learn which policies decided them.
+type AuditRecorder struct {
+	last *AuditRecord
+	sync.Mutex
+}
+
+// Last returns the last decision, or nil if none was recorded since the last Reset.
+func (a *AuditRecorder) Last() *AuditRecord {
+	a.Lock()
+	defer a.Unlock()
+	return a.last
+}
+
+// Reset forgets the last decision.
+func (a *AuditRecorder) Reset() {
+	a.Lock()
+	defer a.Unlock()
+	a.last = nil
+}
+
+// LogDecision keeps the decision.
+func (a *AuditRecorder) LogDecision(record *AuditRecord) {
+	a.Lock()
+	defer a.Unlock()
+	a.last = record
+}
+
+// LogRejectedAccessRequest is not called, because Ladon calls LogDecision instead.
+func (a *AuditRecorder) LogRejectedAccessRequest(*Request, Policies, Policies) {}
+
+// LogGrantedAccessRequest is not called, because Ladon calls LogDecision instead.
+func (a *AuditRecorder) LogGrantedAccessRequest(*Request, Policies, Policies) {}
@@ -82,7 +82,11 @@ func TestAuditLogger(t *testing.T) {
 		Action:  "delete",
 	}
 	assert.NotNil(t, warden.IsAllowed(r))
-	assert.Equal(t, "policies yes-deletes allow access, but policy no-bob forcefully denied it\n", output.String())
+	// The memory manager returns candidates in random order, so yes-deletes may not be evaluated before no-bob.
+	assert.Contains(t, []string{
+		"policies yes-deletes allow access, but policy no-bob forcefully denied it\n",
+		"policy no-bob forcefully denied the access\n",
+	}, output.String())
 
 	output.Reset()
 
@@ -93,3 +97,22 @@ func TestAuditLogger(t *testing.T) {
 	assert.Nil(t, warden.IsAllowed(r))
 	assert.Equal(t, "policies yes-deletes allow access\n", output.String())
 }
+
+func TestAuditRecorder(t *testing.T) {
+	recorder := new(AuditRecorder)
+	warden := &Ladon{Manager: NewMemoryManager(), AuditLogger: recorder}
+	warden.Manager.Create(&DefaultPolicy{ID: "read", Subjects: []string{"<.*>"}, Actions: []string{"get"}, Resources: []string{"<.*>"}, Effect: AllowAccess})
+
+	assert.Nil(t, recorder.Last())
+	assert.Nil(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	if assert.NotNil(t, recorder.Last()) {
+		assert.True(t, recorder.Last().Allowed)
+		assert.Equal(t, []string{"read"}, recorder.Last().Policies)
+	}
+
+	assert.NotNil(t, warden.IsAllowed(&Request{Subject: "peter", Action: "delete", Resource: "articles:1"}))
+	assert.False(t, recorder.Last().Allowed)
+
+	recorder.Reset()
+	assert.Nil(t, recorder.Last())
+}
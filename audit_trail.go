@@ -0,0 +1,144 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditRecord is a single decision of the warden.
+type AuditRecord struct {
+	// Request is the request as seen by audit loggers, that is after enrichment and redaction.
+	Request Request `json:"request"`
+
+	Allowed bool `json:"allowed"`
+
+	// Policies are the IDs of the policies which decided the request.
+	Policies []string `json:"policies"`
+
+	// Sources maps the IDs of deciding policies which implement SourcedPolicy to their source, for example the
+	// commit of the Git repository they were loaded from.
+	Sources map[string]string `json:"sources,omitempty"`
+
+	// Latency is the time it took to decide the request, including the manager query if the decision was made by
+	// IsAllowed.
+	Latency time.Duration `json:"latency"`
+
+	// Timestamp is the time of the request, see RequestTime.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DecisionAuditLogger is implemented by audit loggers which record complete decisions. Ladon calls LogDecision
+// instead of LogRejectedAccessRequest and LogGrantedAccessRequest.
+type DecisionAuditLogger interface {
+	LogDecision(record *AuditRecord)
+}
+
+// AuditManager stores decisions durably, for example to satisfy compliance requirements.
+type AuditManager interface {
+	// RecordDecision persists a decision.
+	RecordDecision(record *AuditRecord) error
+
+	// FindDecisions returns the decisions made at or after from and before to, newest first. Zero bounds are
+	// ignored.
+	FindDecisions(from, to time.Time, limit, offset int64) ([]AuditRecord, error)
+
+	// FindDecisionsBySubject returns the decisions on requests of subject made at or after from and before to,
+	// newest first. Zero bounds are ignored.
+	FindDecisionsBySubject(subject string, from, to time.Time, limit, offset int64) ([]AuditRecord, error)
+
+	// PurgeDecisions removes all decisions made before t and returns how many were removed.
+	PurgeDecisions(before time.Time) (int64, error)
+}
+
+// AuditTrail is an AuditLogger persisting every decision to an AuditManager.
+type AuditTrail struct {
+	Manager AuditManager
+
+	// Retention is the time decisions are kept by RunRetention. Zero keeps them forever.
+	Retention time.Duration
+
+	// OnError is called if a decision can not be persisted. Decisions are never failed because of the trail.
+	OnError func(record *AuditRecord, err error)
+}
+
+// LogDecision persists the decision.
+func (a *AuditTrail) LogDecision(record *AuditRecord) {
+	if err := a.Manager.RecordDecision(record); err != nil && a.OnError != nil {
+		a.OnError(record, err)
+	}
+}
+
+// LogRejectedAccessRequest persists a denial. Ladon calls LogDecision instead.
+func (a *AuditTrail) LogRejectedAccessRequest(r *Request, pool Policies, deciders Policies) {
+	a.LogDecision(newAuditRecord(r, deciders, false))
+}
+
+// LogGrantedAccessRequest persists a grant. Ladon calls LogDecision instead.
+func (a *AuditTrail) LogGrantedAccessRequest(r *Request, pool Policies, deciders Policies) {
+	a.LogDecision(newAuditRecord(r, deciders, true))
+}
+
+func newAuditRecord(r *Request, deciders Policies, allowed bool) *AuditRecord {
+	ids := make([]string, len(deciders))
+	var sources map[string]string
+	for k, p := range deciders {
+		ids[k] = p.GetID()
+		if source := PolicySource(p); source != "" {
+			if sources == nil {
+				sources = map[string]string{}
+			}
+			sources[p.GetID()] = source
+		}
+	}
+
+	return &AuditRecord{
+		Request:   *r,
+		Allowed:   allowed,
+		Policies:  ids,
+		Sources:   sources,
+		Timestamp: RequestTime(r),
+	}
+}
+
+// RunRetention purges decisions older than Retention every interval until ctx is canceled.
+func (a *AuditTrail) RunRetention(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-ticker.C:
+			if a.Retention <= 0 {
+				continue
+			}
+
+			if _, err := a.Manager.PurgeDecisions(time.Now().Add(-a.Retention)); err != nil && a.OnError != nil {
+				a.OnError(nil, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type failingAuditManager struct {
+	*MemoryAuditManager
+}
+
+func (m failingAuditManager) RecordDecision(record *AuditRecord) error {
+	return errors.New("storage unavailable")
+}
+
+func TestAuditTrail(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:        "allow-peter",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"read"},
+		Effect:    AllowAccess,
+	}))
+
+	audit := NewMemoryAuditManager()
+	warden := &Ladon{
+		Manager:     m,
+		AuditLogger: &AuditTrail{Manager: audit},
+	}
+
+	monday := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	tuesday := monday.Add(24 * time.Hour)
+
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles:1", Action: "read", Time: monday}))
+	require.Error(t, warden.IsAllowed(&Request{Subject: "ken", Resource: "articles:1", Action: "read", Time: monday}))
+	require.Error(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles:1", Action: "delete", Time: tuesday}))
+
+	all, err := audit.FindDecisions(time.Time{}, time.Time{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, tuesday, all[0].Timestamp, "newest decisions come first")
+
+	peter, err := audit.FindDecisionsBySubject("peter", time.Time{}, time.Time{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, peter, 2)
+	assert.False(t, peter[0].Allowed)
+	assert.True(t, peter[1].Allowed)
+	assert.Equal(t, []string{"allow-peter"}, peter[1].Policies)
+	assert.Equal(t, "read", peter[1].Request.Action)
+
+	ranged, err := audit.FindDecisionsBySubject("peter", monday, tuesday, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, ranged, 1)
+	assert.True(t, ranged[0].Allowed)
+
+	paged, err := audit.FindDecisions(time.Time{}, time.Time{}, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, paged, 1)
+	assert.Equal(t, monday, paged[0].Timestamp)
+
+	purged, err := audit.PurgeDecisions(tuesday)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, purged)
+
+	all, err = audit.FindDecisions(time.Time{}, time.Time{}, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
+
+type sourcedPolicy struct {
+	*DefaultPolicy
+	commit string
+}
+
+func (p *sourcedPolicy) GetSource() string {
+	return p.commit
+}
+
+func TestAuditTrailSources(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&sourcedPolicy{DefaultPolicy: &DefaultPolicy{ID: "git", Subjects: []string{"peter"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: AllowAccess}, commit: "9fceb02"}))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "local", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"read"}, Effect: AllowAccess}))
+
+	audit := NewMemoryAuditManager()
+	warden := &Ladon{Manager: m, AuditLogger: &AuditTrail{Manager: audit}}
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles:1", Action: "read"}))
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "ken", Resource: "articles:1", Action: "read"}))
+
+	records, err := audit.FindDecisions(time.Time{}, time.Time{}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		if record.Request.Subject == "peter" {
+			assert.Equal(t, map[string]string{"git": "9fceb02"}, record.Sources)
+		} else {
+			assert.Nil(t, record.Sources)
+		}
+	}
+}
+
+func TestAuditTrailErrors(t *testing.T) {
+	var failed *AuditRecord
+	warden := &Ladon{
+		Manager: NewMemoryManager(),
+		AuditLogger: &AuditTrail{
+			Manager: failingAuditManager{NewMemoryAuditManager()},
+			OnError: func(record *AuditRecord, err error) { failed = record },
+		},
+	}
+
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles:1", Action: "read"}))
+	require.NotNil(t, failed)
+	assert.Equal(t, "peter", failed.Request.Subject)
+}
+
+func TestAuditTrailRetention(t *testing.T) {
+	audit := NewMemoryAuditManager()
+	require.NoError(t, audit.RecordDecision(&AuditRecord{Timestamp: time.Now().Add(-time.Hour)}))
+	require.NoError(t, audit.RecordDecision(&AuditRecord{Timestamp: time.Now()}))
+
+	trail := &AuditTrail{Manager: audit, Retention: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- trail.RunRetention(ctx, time.Millisecond) }()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if all, _ := audit.FindDecisions(time.Time{}, time.Time{}, 10, 0); len(all) == 1 {
+			break
+		}
+	}
+
+	all, err := audit.FindDecisions(time.Time{}, time.Time{}, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(<-done))
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// BulkManager is implemented by managers which write many policies at once, for example in a single transaction.
+type BulkManager interface {
+	// CreateAll persists all policies. If one of them can not be created, none is.
+	CreateAll(policies Policies) error
+
+	// DeleteAll removes the policies with the given IDs. IDs of missing policies are ignored. If one of the
+	// policies can not be removed, none is.
+	DeleteAll(ids []string) error
+}
+
+// CreateAll persists all policies in m. Managers which do not implement BulkManager create the policies one by
+// one, and the policies created before a failure are deleted again.
+func CreateAll(m Manager, policies Policies) error {
+	if bm, ok := m.(BulkManager); ok {
+		return bm.CreateAll(policies)
+	}
+
+	for k, p := range policies {
+		if err := m.Create(p); err != nil {
+			for _, created := range policies[:k] {
+				// The error of the create is more relevant than a failing rollback.
+				_ = m.Delete(created.GetID())
+			}
+			return errors.Wrapf(err, "Could not create policy %s", p.GetID())
+		}
+	}
+	return nil
+}
+
+// DeleteAll removes the policies with the given IDs from m. Managers which do not implement BulkManager remove the
+// policies one by one, so the policies removed before a failure stay removed.
+func DeleteAll(m Manager, ids []string) error {
+	if bm, ok := m.(BulkManager); ok {
+		return bm.DeleteAll(ids)
+	}
+
+	for _, id := range ids {
+		if err := m.Delete(id); err != nil {
+			return errors.Wrapf(err, "Could not delete policy %s", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestCreateAll(t *testing.T) {
+	// EventingManager does not implement BulkManager, so policies are created one by one.
+	m := NewEventingManager(NewMemoryManager(), new(recordingBus))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "3", Effect: AllowAccess}))
+
+	err := CreateAll(m, Policies{
+		&DefaultPolicy{ID: "1", Effect: AllowAccess},
+		&DefaultPolicy{ID: "2", Effect: AllowAccess},
+		&DefaultPolicy{ID: "3", Effect: AllowAccess},
+	})
+	assert.Equal(t, ErrPolicyExists, errors.Cause(err))
+
+	ps, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	assert.Len(t, ps, 1, "created policies are deleted if a later one fails")
+
+	require.NoError(t, CreateAll(m, Policies{&DefaultPolicy{ID: "1", Effect: AllowAccess}, &DefaultPolicy{ID: "2", Effect: AllowAccess}}))
+	require.NoError(t, DeleteAll(m, []string{"1", "3"}))
+
+	ps, err = m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, ps, 1)
+	assert.Equal(t, "2", ps[0].GetID())
+
+	mm := NewMemoryManager()
+	require.NoError(t, CreateAll(mm, Policies{&DefaultPolicy{ID: "1", Effect: AllowAccess}}))
+	assert.Len(t, mm.Policies, 1)
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ImportMode defines how Import treats policies which exist already.
+type ImportMode string
+
+const (
+	// ImportMerge creates new policies and updates existing ones.
+	ImportMerge ImportMode = "merge"
+
+	// ImportReplace creates new policies, updates existing ones and deletes all stored policies which are not
+	// part of the bundle.
+	ImportReplace ImportMode = "replace"
+
+	// ImportSkipExisting creates new policies and leaves existing ones untouched.
+	ImportSkipExisting ImportMode = "skip-existing"
+)
+
+// exportPageSize is the number of policies fetched per GetAll call by Export.
+const exportPageSize = 1000
+
+// Export returns all policies stored in m.
+func Export(m Manager) (Policies, error) {
+	var policies Policies
+	err := exportPages(m, func(ps Policies) error {
+		policies = append(policies, ps...)
+		return nil
+	})
+	return policies, err
+}
+
+// ExportJSONLines writes all policies stored in m to w, one JSON encoded policy per line. Policies are streamed
+// with ForEach, so the store is never held in memory as a whole.
+func ExportJSONLines(m Manager, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return ForEach(context.Background(), m, func(p Policy) error {
+		return errors.WithStack(enc.Encode(p))
+	})
+}
+
+func exportPages(m Manager, f func(Policies) error) error {
+	for offset := int64(0); ; offset += exportPageSize {
+		ps, err := m.GetAll(exportPageSize, offset)
+		if err != nil {
+			return err
+		}
+
+		if err := f(ps); err != nil {
+			return err
+		}
+
+		if len(ps) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// WriteJSONLines writes policies to w, one JSON encoded policy per line.
+func WriteJSONLines(w io.Writer, policies Policies) error {
+	enc := json.NewEncoder(w)
+	for _, p := range policies {
+		if err := enc.Encode(p); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// ReadJSONLines decodes policies written by WriteJSONLines or ExportJSONLines.
+func ReadJSONLines(r io.Reader) (Policies, error) {
+	var policies Policies
+	dec := json.NewDecoder(r)
+	for {
+		var p DefaultPolicy
+		if err := dec.Decode(&p); err == io.EOF {
+			return policies, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Could not decode policy %d", len(policies))
+		}
+		policies = append(policies, &p)
+	}
+}
+
+// Import writes policies to m. The bundle is validated using FsckPolicies before anything is written, so an
+// invalid bundle leaves the store untouched. New policies are created first using CreateAll, then existing ones
+// are updated. A failing write aborts the import, policies written before are kept.
+// Versioned policies which are updated get the version of the stored policy, so they overwrite it.
+func Import(m Manager, policies Policies, mode ImportMode) error {
+	switch mode {
+	case ImportMerge, ImportReplace, ImportSkipExisting:
+	default:
+		return errors.Errorf(`Unknown import mode "%s"`, mode)
+	}
+
+	if report := FsckPolicies(policies); !report.OK() {
+		issue := report.Issues[0]
+		return errors.Errorf("Policy %d of the bundle is invalid (%s): %s", issue.Index, issue.Check, issue.Message)
+	}
+
+	stored, err := Export(m)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]Policy, len(stored))
+	for _, p := range stored {
+		existing[p.GetID()] = p
+	}
+
+	var created, updated Policies
+	imported := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		imported[p.GetID()] = true
+		current, ok := existing[p.GetID()]
+		if !ok {
+			created = append(created, p)
+		} else if mode != ImportSkipExisting {
+			// The bundle wins over the stored policy, whatever version the bundle was exported at.
+			if vp, ok := p.(VersionedPolicy); ok {
+				if vc, ok := current.(VersionedPolicy); ok {
+					vp.SetVersion(vc.GetVersion())
+				}
+			}
+			updated = append(updated, p)
+		}
+	}
+
+	if err := CreateAll(m, created); err != nil {
+		return err
+	}
+
+	for _, p := range updated {
+		if err := m.Update(p); err != nil {
+			return err
+		}
+	}
+
+	if mode != ImportReplace {
+		return nil
+	}
+
+	for _, p := range stored {
+		if !imported[p.GetID()] {
+			if err := m.Delete(p.GetID()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
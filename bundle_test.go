@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func bundleManager(t *testing.T) *MemoryManager {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "1", Description: "stored", Subjects: []string{"peter"}, Effect: AllowAccess},
+		{ID: "2", Description: "stored", Subjects: []string{"max"}, Effect: DenyAccess},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+	return m
+}
+
+func descriptions(t *testing.T, m Manager) map[string]string {
+	ps, err := Export(m)
+	require.NoError(t, err)
+
+	out := map[string]string{}
+	for _, p := range ps {
+		out[p.GetID()] = p.GetDescription()
+	}
+	return out
+}
+
+func TestImport(t *testing.T) {
+	bundle := func() Policies {
+		return Policies{
+			&DefaultPolicy{ID: "2", Description: "imported", Subjects: []string{"max"}, Effect: AllowAccess, Version: 7},
+			&DefaultPolicy{ID: "3", Description: "imported", Subjects: []string{"zac"}, Effect: AllowAccess},
+		}
+	}
+
+	for mode, expected := range map[ImportMode]map[string]string{
+		ImportMerge:        {"1": "stored", "2": "imported", "3": "imported"},
+		ImportReplace:      {"2": "imported", "3": "imported"},
+		ImportSkipExisting: {"1": "stored", "2": "stored", "3": "imported"},
+	} {
+		t.Run("mode="+string(mode), func(t *testing.T) {
+			m := bundleManager(t)
+			require.NoError(t, Import(m, bundle(), mode))
+			assert.Equal(t, expected, descriptions(t, m))
+		})
+	}
+
+	m := bundleManager(t)
+	assert.Error(t, Import(m, bundle(), "upsert"))
+	assert.Error(t, Import(m, Policies{bundle()[1], &DefaultPolicy{ID: "4", Effect: "maybe"}}, ImportMerge))
+	assert.Equal(t, map[string]string{"1": "stored", "2": "stored"}, descriptions(t, m), "invalid bundles must not be written")
+}
+
+func TestJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, ExportJSONLines(bundleManager(t), &out))
+	assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 2)
+
+	ps, err := ReadJSONLines(&out)
+	require.NoError(t, err)
+	require.Len(t, ps, 2)
+
+	m := NewMemoryManager()
+	require.NoError(t, Import(m, ps, ImportMerge))
+	assert.Equal(t, map[string]string{"1": "stored", "2": "stored"}, descriptions(t, m))
+
+	_, err = ReadJSONLines(strings.NewReader(`{"id":"1"}` + "\n" + `{"id":`))
+	assert.Error(t, err)
+}
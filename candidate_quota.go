@@ -0,0 +1,52 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"sort"
+	"strings"
+)
+
+// subjectPatterns returns the distinct subject templates of policies which contain regular expressions, ordered
+// by the number of policies using them, most frequent first.
+func subjectPatterns(policies Policies) []string {
+	counts := map[string]int{}
+	for _, p := range policies {
+		for _, s := range p.GetSubjects() {
+			if strings.IndexByte(s, p.GetStartDelimiter()) >= 0 {
+				counts[s]++
+			}
+		}
+	}
+
+	patterns := make([]string, 0, len(counts))
+	for s := range counts {
+		patterns = append(patterns, s)
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if counts[patterns[i]] != counts[patterns[j]] {
+			return counts[patterns[i]] > counts[patterns[j]]
+		}
+		return patterns[i] < patterns[j]
+	})
+	return patterns
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type quotaMetric struct {
+	MetricNoOp
+	candidates int
+	patterns   []string
+}
+
+func (m *quotaMetric) CandidateQuotaExceeded(r Request, candidates int, patterns []string) {
+	m.candidates = candidates
+	m.patterns = patterns
+}
+
+func TestLadonCandidateQuota(t *testing.T) {
+	m := NewMemoryManager()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, m.Create(&DefaultPolicy{ID: fmt.Sprintf("wildcard-%d", i), Subjects: []string{"<.*>"}, Effect: AllowAccess}))
+	}
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "users", Subjects: []string{"users:<.*>", "peter"}, Effect: AllowAccess}))
+
+	metric := new(quotaMetric)
+	warden := &Ladon{Manager: m, Metric: metric, CandidateQuota: 4}
+	warden.IsAllowed(&Request{Subject: "peter"})
+	assert.Equal(t, 0, metric.candidates)
+
+	warden.CandidateQuota = 3
+	warden.IsAllowed(&Request{Subject: "peter"})
+	assert.Equal(t, 4, metric.candidates)
+	assert.Equal(t, []string{"<.*>", "users:<.*>"}, metric.patterns)
+
+	prometheus := NewPrometheusMetric()
+	prometheus.CandidateQuotaExceeded(Request{}, 4, metric.patterns)
+	var out bytes.Buffer
+	_, err := prometheus.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `ladon_candidate_quota_exceeded_total{pattern="<.*>"} 1`)
+}
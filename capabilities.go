@@ -0,0 +1,118 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"sort"
+)
+
+// CandidateActions returns the actions of allow policies in policies which can be enumerated, sorted and without
+// duplicates. Actions containing regular expressions or wildcards match an open set of actions and are skipped.
+func CandidateActions(policies Policies) []string {
+	seen := map[string]bool{}
+	var actions []string
+	for _, p := range policies {
+		if !p.AllowAccess() {
+			continue
+		}
+
+		for _, action := range p.GetActions() {
+			if !seen[action] && IsLiteralTemplate(p, action) {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+
+	sort.Strings(actions)
+	return actions
+}
+
+// Capabilities returns the actions the subject of r is allowed to perform on its resource, sorted. r is a template
+// whose subject, resource, tenant and context are used for every action returned by CandidateActions; its action is
+// ignored. The candidates are fetched from the manager once, so actions granted only under conditions the context
+// does not fulfill are not included. The normalizers rewrite r, but not the actions. Neither the audit logger nor the
+// metric is notified.
+func (l *Ladon) Capabilities(r *Request) ([]string, error) {
+	r, err := l.Normalizers.Normalize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	template := *r
+	if template.Context == nil {
+		template.Context = Context{}
+	}
+
+	if err := l.checkIndex(); err != nil {
+		return nil, err
+	}
+
+	policies, err := l.Manager.FindRequestCandidates(&template)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := []string{}
+	for _, action := range CandidateActions(policies) {
+		request := template
+		request.Action = action
+
+		allowed, err := l.allows(&request, policies)
+		if err != nil {
+			return nil, err
+		} else if allowed {
+			capabilities = append(capabilities, action)
+		}
+	}
+	return capabilities, nil
+}
+
+// allows evaluates r like DoPoliciesAllow, but without logging it.
+func (l *Ladon) allows(r *Request, policies Policies) (bool, error) {
+	if len(l.Enrichers) > 0 {
+		enriched, err := l.Enrichers.Enrich(context.Background(), r)
+		if err != nil {
+			return false, err
+		}
+		r = enriched
+	}
+
+	candidates := Policies{}
+	for _, p := range policies {
+		if err := l.Verifier.Verify(p); err != nil {
+			return false, err
+		}
+
+		if applies, err := l.applies(p, r); err != nil {
+			return false, err
+		} else if applies {
+			candidates = append(candidates, p)
+		}
+	}
+
+	d, err := l.strategy().Decide(r, candidates)
+	if err != nil {
+		return false, err
+	}
+	return d.Allowed || (len(d.Deciders) == 0 && l.DefaultEffect == EffectAllow), nil
+}
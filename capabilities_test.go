@@ -0,0 +1,64 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestCapabilities(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "1", Subjects: []string{"<peter|max>"}, Resources: []string{"articles:<[0-9]+>"}, Actions: []string{"get", "update", "<read|list>"}, Effect: AllowAccess},
+		{ID: "2", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"update"}, Effect: DenyAccess},
+		{ID: "3", Subjects: []string{"peter"}, Resources: []string{"articles:<.*>"}, Actions: []string{"delete"}, Effect: AllowAccess, Conditions: Conditions{"owner": &EqualsSubjectCondition{}}},
+		{ID: "4", Subjects: []string{"peter"}, Resources: []string{"comments:<.*>"}, Actions: []string{"create"}, Effect: AllowAccess},
+		{ID: "5", Subjects: []string{"ken"}, Resources: []string{"articles:<.*>"}, Actions: []string{"publish"}, Effect: AllowAccess, Tenant: "acme"},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, []string{"create", "delete", "get", "update"}, CandidateActions(Policies{m.Policies["1"], m.Policies["2"], m.Policies["3"], m.Policies["4"]}))
+
+	w := &Ladon{Manager: m}
+	for k, c := range []struct {
+		r        *Request
+		expected []string
+	}{
+		{r: &Request{Subject: "peter", Resource: "articles:1"}, expected: []string{"get", "update"}},
+		{r: &Request{Subject: "peter", Resource: "articles:1", Context: Context{"owner": "peter"}}, expected: []string{"delete", "get", "update"}},
+		{r: &Request{Subject: "max", Resource: "articles:1"}, expected: []string{"get"}},
+		{r: &Request{Subject: "max", Resource: "articles:2"}, expected: []string{"get", "update"}},
+		{r: &Request{Subject: "peter", Resource: "comments:1"}, expected: []string{"create"}},
+		{r: &Request{Subject: "ken", Resource: "articles:1"}, expected: []string{}},
+		{r: &Request{Subject: "ken", Resource: "articles:1", Tenant: "acme"}, expected: []string{"publish"}},
+	} {
+		capabilities, err := w.Capabilities(c.r)
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, capabilities, "case %d", k)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package casbin converts between Casbin models and policies and ladon policies.
+//
+// Import understands models whose matcher is a conjunction of one comparison per request field, using ==,
+// keyMatch, keyMatch2 or regexMatch, and optionally g() for the subject. This covers the ACL, RBAC and RESTful
+// examples of Casbin. Every "p" rule becomes one ladon policy. Ladon has no roles, so the subjects of a rule
+// granted to a role are the role itself and all users and roles which inherit it through "g" rules.
+//
+// Export writes a model with the deny-overrides effect, which matches ladon's evaluation semantics, and one
+// "p" rule per combination of subject, resource and action. Policies which can not be represented, for example
+// because they have conditions, are skipped and reported as issues.
+package casbin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Effects of the policy_effect section.
+const (
+	// EffectAllowOverrides grants access if any rule allows it.
+	EffectAllowOverrides = "some(where (p.eft == allow))"
+
+	// EffectDenyOverrides grants access if any rule allows it and none denies it.
+	EffectDenyOverrides = "some(where (p.eft == allow)) && !some(where (p.eft == deny))"
+)
+
+// Issue describes a rule or policy which could not be converted.
+type Issue struct {
+	// Line is the line of the rule in the policy file, starting at 1. It is set by Import.
+	Line int `json:"line,omitempty"`
+
+	// PolicyID is the ID of the ladon policy. It is set by Export.
+	PolicyID string `json:"policy_id,omitempty"`
+
+	// Message describes the issue.
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.PolicyID != "" {
+		return fmt.Sprintf("policy %s: %s", i.PolicyID, i.Message)
+	}
+	return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+}
+
+// Model is a parsed Casbin model. It maps sections to their assignments, for example
+// Model["matchers"]["m"].
+type Model map[string]map[string]string
+
+// ParseModel parses a Casbin model in the INI format.
+func ParseModel(model []byte) (Model, error) {
+	m := Model{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(model))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";"):
+			continue
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			if m[section] == nil {
+				m[section] = map[string]string{}
+			}
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if section == "" {
+			return nil, errors.Errorf("line %d: assignment outside of a section", line)
+		} else if len(parts) != 2 {
+			return nil, errors.Errorf("line %d: expected an assignment but got %s", line, text)
+		}
+		m[section][strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m, nil
+}
+
+// fields returns the comma separated fields of an assignment, for example "sub, obj, act".
+func (m Model) fields(section, key string) []string {
+	value, ok := m[section][key]
+	if !ok {
+		return nil
+	}
+
+	var out []string
+	for _, f := range strings.Split(value, ",") {
+		out = append(out, strings.TrimSpace(f))
+	}
+	return out
+}
+
+// splitRule splits a line of a policy file into its fields, trimming surrounding whitespace. Fields may be quoted
+// with double quotes, which is required for fields containing commas.
+func splitRule(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '"' && i+1 < len(line) && line[i+1] == '"':
+			field.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ',':
+			fields = append(fields, strings.TrimSpace(field.String()))
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	return append(fields, strings.TrimSpace(field.String())), nil
+}
+
+// joinRule is the inverse of splitRule.
+func joinRule(fields ...string) string {
+	out := make([]string, len(fields))
+	for i, f := range fields {
+		if strings.ContainsAny(f, `,"`) {
+			f = `"` + strings.Replace(f, `"`, `""`, -1) + `"`
+		}
+		out[i] = f
+	}
+	return strings.Join(out, ", ")
+}
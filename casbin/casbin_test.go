@@ -0,0 +1,176 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package casbin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+const rbacModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch2(r.obj, p.obj) && regexMatch(r.act, p.act)
+`
+
+const rbacPolicy = `
+p, admin, /articles/*, .*, allow
+p, editor, /articles/:id, ^(GET|PUT)$, allow
+p, ken, /articles/:id, ^PUT$, deny
+p2, alice, /articles/1, GET
+
+g, root, admin
+g, admin, editor
+g, alice, editor
+g, ken, editor
+`
+
+func warden(t *testing.T, policies ladon.Policies) *ladon.Ladon {
+	m := memory.NewMemoryManager()
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+	return &ladon.Ladon{Manager: m}
+}
+
+func TestImport(t *testing.T) {
+	policies, issues, err := Import([]byte(rbacModel), []byte(rbacPolicy), Options{IDPrefix: "casbin:"})
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, 5, issues[0].Line)
+
+	require.Len(t, policies, 3)
+	assert.Equal(t, &ladon.DefaultPolicy{
+		ID:         "casbin:1",
+		Subjects:   []string{"editor", "admin", "alice", "ken", "root"},
+		Resources:  []string{"/articles/<[^/]+>"},
+		Actions:    []string{"<(GET|PUT)>"},
+		Effect:     ladon.AllowAccess,
+		Conditions: ladon.Conditions{},
+	}, policies[1])
+	assert.Equal(t, []string{"admin", "root"}, policies[0].GetSubjects())
+
+	w := warden(t, policies)
+	for _, tc := range []struct {
+		request *ladon.Request
+		allowed bool
+	}{
+		{request: &ladon.Request{Subject: "alice", Resource: "/articles/1", Action: "PUT"}, allowed: true},
+		{request: &ladon.Request{Subject: "alice", Resource: "/articles/1", Action: "DELETE"}},
+		{request: &ladon.Request{Subject: "alice", Resource: "/articles/1/comments", Action: "GET"}},
+		{request: &ladon.Request{Subject: "ken", Resource: "/articles/1", Action: "GET"}, allowed: true},
+		{request: &ladon.Request{Subject: "ken", Resource: "/articles/1", Action: "PUT"}},
+		{request: &ladon.Request{Subject: "admin", Resource: "/articles/1/comments", Action: "DELETE"}, allowed: true},
+		{request: &ladon.Request{Subject: "root", Resource: "/articles/1/comments", Action: "DELETE"}, allowed: true},
+		{request: &ladon.Request{Subject: "peter", Resource: "/articles/1", Action: "GET"}},
+	} {
+		assert.Equal(t, tc.allowed, w.IsAllowed(tc.request) == nil, "%+v", tc.request)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	acl := `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+	policies, issues, err := Import([]byte(acl), []byte("p, alice, /data/*, read\np, bob, <data>, write\ng, alice, admin\n"), Options{})
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, []string{"/data/<.*>"}, policies[0].GetResources())
+	assert.Len(t, issues, 2)
+
+	for _, model := range []string{
+		"[request_definition]\nr = sub, dom, obj, act\n",
+		"[request_definition]\nr = sub, obj, act\n[policy_definition]\np = sub, obj, act\n[policy_effect]\ne = priority(p.eft) || deny\n",
+		"[request_definition]\nr = sub, obj, act\n[policy_definition]\np = sub, obj, act\n[policy_effect]\ne = some(where (p.eft == allow))\n[matchers]\nm = r.sub == p.sub || r.obj == p.obj\n",
+		"[request_definition]\nr = sub, obj, act\n[policy_definition]\np = sub, obj, act\n[policy_effect]\ne = some(where (p.eft == allow))\n[matchers]\nm = r.sub == p.sub && r.obj == p.obj\n",
+		"[request_definition]\nr = sub, obj, act\n[policy_definition]\np = sub, obj, act\n[policy_effect]\ne = some(where (p.eft == allow))\n[matchers]\nm = r.sub == p.sub && ipMatch(r.obj, p.obj) && r.act == p.act\n",
+		"r = sub, obj, act\n",
+	} {
+		_, _, err := Import([]byte(model), nil, Options{})
+		assert.Error(t, err, model)
+	}
+}
+
+func TestExport(t *testing.T) {
+	policies := ladon.Policies{
+		&ladon.DefaultPolicy{ID: "1", Subjects: []string{"alice", "bob"}, Resources: []string{"articles,1"}, Actions: []string{"read"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "2", Subjects: []string{"bob"}, Resources: []string{"articles,1"}, Actions: []string{"read"}, Effect: ladon.DenyAccess},
+		&ladon.DefaultPolicy{ID: "3", Subjects: []string{"alice"}, Resources: []string{"articles"}, Actions: []string{"read"}, Effect: ladon.AllowAccess,
+			Conditions: ladon.Conditions{"owner": &ladon.EqualsSubjectCondition{}}},
+	}
+
+	model, policy, issues, err := Export(policies)
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "3", issues[0].PolicyID)
+	assert.Contains(t, string(model), "m = r.sub == p.sub && r.obj == p.obj && r.act == p.act")
+	assert.Equal(t, "p, alice, \"articles,1\", read, allow\np, bob, \"articles,1\", read, allow\np, bob, \"articles,1\", read, deny\n", string(policy))
+
+	imported, issues, err := Import(model, policy, Options{})
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+	require.Len(t, imported, 3)
+	assert.Equal(t, []string{"articles,1"}, imported[0].GetResources())
+
+	policies = append(policies[:2], &ladon.DefaultPolicy{ID: "4", Subjects: []string{"<.*>"}, Resources: []string{"articles:<[0-9]+>"}, Actions: []string{"<read|list>"}, Effect: ladon.AllowAccess})
+	model, policy, issues, err = Export(policies)
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+	assert.Contains(t, string(model), "regexMatch(r.obj, p.obj)")
+	assert.Contains(t, string(policy), `p, ^alice$, "^articles,1$", ^read$, allow`)
+
+	imported, issues, err = Import(model, policy, Options{})
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+
+	w := warden(t, imported)
+	assert.NoError(t, w.IsAllowed(&ladon.Request{Subject: "alice", Resource: "articles,1", Action: "read"}))
+	assert.Error(t, w.IsAllowed(&ladon.Request{Subject: "bob", Resource: "articles,1", Action: "read"}))
+	assert.NoError(t, w.IsAllowed(&ladon.Request{Subject: "ken", Resource: "articles:12", Action: "list"}))
+	assert.Error(t, w.IsAllowed(&ladon.Request{Subject: "ken", Resource: "articles:x", Action: "list"}))
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package casbin
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/compiler"
+)
+
+const exportModel = `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[policy_effect]
+e = %s
+
+[matchers]
+m = %s
+`
+
+// Export converts ladon policies to a Casbin model and policy file. If no policy contains a regular expression,
+// the model compares values with ==, otherwise all values are written as anchored regular expressions and
+// compared with regexMatch.
+func Export(policies ladon.Policies) (model, policy []byte, issues []Issue, err error) {
+	var rules [][]string
+	literal := true
+	for _, p := range policies {
+		rows, err := exportPolicy(p)
+		if err != nil {
+			issues = append(issues, Issue{PolicyID: p.GetID(), Message: err.Error()})
+			continue
+		}
+
+		for _, row := range rows {
+			for _, value := range row[:3] {
+				literal = literal && !strings.HasPrefix(value, "^")
+			}
+		}
+		rules = append(rules, rows...)
+	}
+
+	matcher := "r.sub == p.sub && r.obj == p.obj && r.act == p.act"
+	if !literal {
+		matcher = "regexMatch(r.sub, p.sub) && regexMatch(r.obj, p.obj) && regexMatch(r.act, p.act)"
+	}
+
+	var out bytes.Buffer
+	for _, row := range rules {
+		for k, value := range row[:3] {
+			if !literal && !strings.HasPrefix(value, "^") {
+				row[k] = "^" + regexp.QuoteMeta(value) + "$"
+			}
+		}
+		fmt.Fprintf(&out, "p, %s\n", joinRule(row...))
+	}
+
+	return []byte(fmt.Sprintf(exportModel, EffectDenyOverrides, matcher)), out.Bytes(), issues, nil
+}
+
+// exportPolicy returns the rules of a policy. Literal values are returned verbatim, regular expressions are
+// returned anchored.
+func exportPolicy(p ladon.Policy) ([][]string, error) {
+	var eft string
+	switch p.GetEffect() {
+	case ladon.AllowAccess:
+		eft = "allow"
+	case ladon.DenyAccess:
+		eft = "deny"
+	default:
+		return nil, errors.Errorf("unknown effect %s", p.GetEffect())
+	}
+
+	if len(p.GetConditions()) > 0 {
+		return nil, errors.New("conditions can not be represented")
+	} else if ladon.PolicyTenant(p) != "" {
+		return nil, errors.New("tenants can not be represented")
+	} else if ladon.HasExclusions(p) {
+		return nil, errors.New("exclusions can not be represented")
+	}
+
+	var values [3][]string
+	for k, templates := range [][]string{p.GetSubjects(), p.GetResources(), p.GetActions()} {
+		for _, template := range templates {
+			value, err := exportTemplate(p, template)
+			if err != nil {
+				return nil, err
+			}
+			values[k] = append(values[k], value)
+		}
+	}
+
+	var rows [][]string
+	for _, sub := range values[0] {
+		for _, obj := range values[1] {
+			for _, act := range values[2] {
+				rows = append(rows, []string{sub, obj, act, eft})
+			}
+		}
+	}
+	return rows, nil
+}
+
+func exportTemplate(p ladon.Policy, template string) (string, error) {
+	switch ladon.PolicyMatchMode(p) {
+	case ladon.MatchModeRegex, ladon.MatchModeExact:
+	default:
+		return "", errors.Errorf("match mode %s can not be represented", ladon.PolicyMatchMode(p))
+	}
+
+	if ladon.IsLiteralTemplate(p, template) {
+		if strings.HasPrefix(template, "^") {
+			return "^" + regexp.QuoteMeta(template) + "$", nil
+		}
+		return template, nil
+	}
+
+	reg, err := compiler.CompileRegex(template, p.GetStartDelimiter(), p.GetEndDelimiter())
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return reg.String(), nil
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package casbin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+// Functions which compare a request field to a policy field in a matcher.
+const (
+	FunctionEqual      = "=="
+	FunctionKeyMatch   = "keyMatch"
+	FunctionKeyMatch2  = "keyMatch2"
+	FunctionRegexMatch = "regexMatch"
+	FunctionRole       = "g"
+)
+
+var (
+	equalTerm    = regexp.MustCompile(`^r\.(\w+)\s*==\s*p\.(\w+)$`)
+	functionTerm = regexp.MustCompile(`^(\w+)\(\s*r\.(\w+)\s*,\s*p\.(\w+)\s*\)$`)
+)
+
+// Options configures Import.
+type Options struct {
+	// IDPrefix is prepended to the id of every policy. Policies are identified by the index of their "p" rule,
+	// starting at 0.
+	IDPrefix string
+}
+
+// field describes how a request field is matched.
+type field struct {
+	function string
+	index    int
+}
+
+type rule struct {
+	line   int
+	fields []string
+}
+
+// Import converts a Casbin model and policy file to ladon policies.
+func Import(model, policy []byte, opts Options) (ladon.Policies, []Issue, error) {
+	m, err := ParseModel(model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := m.fields("request_definition", "r")
+	if len(request) != 3 {
+		return nil, nil, errors.Errorf("request definition %v must consist of a subject, an object and an action", request)
+	}
+
+	definition := m.fields("policy_definition", "p")
+	eft := -1
+	for k, f := range definition {
+		if f == "eft" {
+			eft = k
+		}
+	}
+
+	effect := strings.Join(strings.Fields(m["policy_effect"]["e"]), " ")
+	if effect != EffectAllowOverrides && effect != EffectDenyOverrides {
+		return nil, nil, errors.Errorf("policy effect %s can not be represented", m["policy_effect"]["e"])
+	}
+
+	fields, err := parseMatcher(m["matchers"]["m"], request, definition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roles := fields[0].function == FunctionRole
+	if roles && len(m.fields("role_definition", "g")) != 2 {
+		return nil, nil, errors.New("role definition g must consist of a user and a role")
+	}
+
+	var issues []Issue
+	var rules []rule
+	members := map[string][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(policy))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		values, err := splitRule(text)
+		if err != nil {
+			issues = append(issues, Issue{Line: line, Message: err.Error()})
+			continue
+		}
+
+		switch values[0] {
+		case "p":
+			if len(values)-1 != len(definition) {
+				issues = append(issues, Issue{Line: line, Message: fmt.Sprintf("expected %d fields but got %d", len(definition), len(values)-1)})
+				continue
+			}
+			rules = append(rules, rule{line: line, fields: values[1:]})
+		case "g":
+			if !roles {
+				issues = append(issues, Issue{Line: line, Message: "role assignments are not used by the matcher"})
+			} else if len(values) != 3 {
+				issues = append(issues, Issue{Line: line, Message: "role assignments with domains can not be represented"})
+			} else {
+				members[values[2]] = append(members[values[2]], values[1])
+			}
+		default:
+			issues = append(issues, Issue{Line: line, Message: fmt.Sprintf("policy type %s can not be represented", values[0])})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var policies ladon.Policies
+	for k, r := range rules {
+		p, err := convertRule(r, fields, eft, effect, members)
+		if err == nil {
+			p.ID = fmt.Sprintf("%s%d", opts.IDPrefix, k)
+			err = ladon.ValidatePolicy(p)
+		}
+
+		if err != nil {
+			issues = append(issues, Issue{Line: r.line, Message: err.Error()})
+			continue
+		}
+		policies = append(policies, p)
+	}
+
+	return policies, issues, nil
+}
+
+// parseMatcher returns how the subject, object and action of a request are matched.
+func parseMatcher(matcher string, request, definition []string) ([3]field, error) {
+	var fields [3]field
+	index := func(fields []string, name string) int {
+		for k, f := range fields {
+			if f == name {
+				return k
+			}
+		}
+		return -1
+	}
+
+	for _, term := range strings.Split(matcher, "&&") {
+		term = strings.TrimSpace(term)
+
+		var f field
+		var r, p string
+		if match := equalTerm.FindStringSubmatch(term); match != nil {
+			f.function, r, p = FunctionEqual, match[1], match[2]
+		} else if match := functionTerm.FindStringSubmatch(term); match != nil {
+			f.function, r, p = match[1], match[2], match[3]
+		} else {
+			return fields, errors.Errorf("matcher term %s can not be represented", term)
+		}
+
+		switch f.function {
+		case FunctionEqual, FunctionKeyMatch, FunctionKeyMatch2, FunctionRegexMatch, FunctionRole:
+		default:
+			return fields, errors.Errorf("matcher function %s can not be represented", f.function)
+		}
+
+		k := index(request, r)
+		if f.index = index(definition, p); k < 0 || f.index < 0 {
+			return fields, errors.Errorf("matcher term %s refers to undefined fields", term)
+		} else if fields[k].function != "" {
+			return fields, errors.Errorf("request field %s is matched more than once", r)
+		} else if f.function == FunctionRole && k != 0 {
+			return fields, errors.Errorf("roles are only supported for the subject")
+		}
+		fields[k] = f
+	}
+
+	for k, f := range fields {
+		if f.function == "" {
+			return fields, errors.Errorf("request field %s is not matched", request[k])
+		}
+	}
+	return fields, nil
+}
+
+func convertRule(r rule, fields [3]field, eft int, effect string, members map[string][]string) (*ladon.DefaultPolicy, error) {
+	p := &ladon.DefaultPolicy{Effect: ladon.AllowAccess, Conditions: ladon.Conditions{}}
+	if eft >= 0 {
+		switch r.fields[eft] {
+		case "allow":
+		case "deny":
+			if effect != EffectDenyOverrides {
+				return nil, errors.New("deny rules have no effect under the policy effect")
+			}
+			p.Effect = ladon.DenyAccess
+		default:
+			return nil, errors.Errorf("unknown effect %s", r.fields[eft])
+		}
+	}
+
+	subject, err := convertPattern(fields[0].function, r.fields[fields[0].index])
+	if err != nil {
+		return nil, err
+	}
+
+	p.Subjects = []string{subject}
+	if fields[0].function == FunctionRole {
+		for _, member := range inheritors(members, r.fields[fields[0].index]) {
+			s, err := convertPattern(FunctionEqual, member)
+			if err != nil {
+				return nil, err
+			}
+			p.Subjects = append(p.Subjects, s)
+		}
+	}
+
+	resource, err := convertPattern(fields[1].function, r.fields[fields[1].index])
+	if err != nil {
+		return nil, err
+	}
+
+	action, err := convertPattern(fields[2].function, r.fields[fields[2].index])
+	if err != nil {
+		return nil, err
+	}
+
+	p.Resources = []string{resource}
+	p.Actions = []string{action}
+	return p, nil
+}
+
+// inheritors returns all users and roles which directly or indirectly have role, sorted.
+func inheritors(members map[string][]string, role string) []string {
+	seen := map[string]bool{role: true}
+	queue := []string{role}
+	var out []string
+	for len(queue) > 0 {
+		for _, member := range members[queue[0]] {
+			if !seen[member] {
+				seen[member] = true
+				out = append(out, member)
+				queue = append(queue, member)
+			}
+		}
+		queue = queue[1:]
+	}
+
+	sort.Strings(out)
+	return out
+}
+
+// convertPattern converts a value compared by function to a ladon template.
+func convertPattern(function, value string) (string, error) {
+	if function != FunctionRegexMatch && strings.ContainsAny(value, "<>") {
+		return "", errors.Errorf("value %s contains regular expression delimiters", value)
+	}
+
+	switch function {
+	case FunctionEqual, FunctionRole:
+		return value, nil
+	case FunctionKeyMatch:
+		// Everything after the first wildcard is ignored by keyMatch.
+		if i := strings.IndexByte(value, '*'); i >= 0 {
+			return value[:i] + "<.*>", nil
+		}
+		return value, nil
+	case FunctionKeyMatch2:
+		var out strings.Builder
+		for i := 0; i < len(value); i++ {
+			switch {
+			case value[i] == ':':
+				for i+1 < len(value) && value[i+1] != '/' {
+					i++
+				}
+				out.WriteString("<[^/]+>")
+			case value[i] == '*' && i > 0 && value[i-1] == '/':
+				out.WriteString("<.*>")
+			default:
+				out.WriteByte(value[i])
+			}
+		}
+		return out.String(), nil
+	case FunctionRegexMatch:
+		// regexMatch is not anchored, unlike ladon's regular expressions.
+		if strings.HasPrefix(value, "^") && strings.HasSuffix(value, "$") && !strings.HasSuffix(value, `\$`) {
+			return "<" + value[1:len(value)-1] + ">", nil
+		}
+		return "<.*(?:" + value + ").*>", nil
+	}
+	return "", errors.Errorf("matcher function %s can not be represented", function)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"time"
+)
+
+// Clock is a source of the current time. Ladon uses it to stamp requests, so time-based conditions can be
+// evaluated deterministically in tests or as if a request was made at another time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts an ordinary function to Clock.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock returns the current local time.
+var SystemClock Clock = ClockFunc(time.Now)
+
+// FixedClock returns a Clock which always returns t.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time {
+		return t
+	})
+}
+
+// RequestTime returns the time r was made at. It is r.Time, which Ladon sets using its Clock, or the current
+// time if r.Time is not set, for example because the request is evaluated by a condition directly.
+func RequestTime(r *Request) time.Time {
+	if r == nil || r.Time.IsZero() {
+		return time.Now()
+	}
+	return r.Time
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestClock(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:         "office-hours",
+		Subjects:   []string{"peter"},
+		Resources:  []string{"articles:<.*>"},
+		Actions:    []string{"get"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{"time": &DateCondition{Before: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), RequestTime: true}},
+	}))
+
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1"}
+	warden := &Ladon{Manager: m, Clock: FixedClock(time.Date(2029, 6, 1, 0, 0, 0, 0, time.UTC))}
+	assert.NoError(t, warden.IsAllowed(r))
+	assert.True(t, r.Time.IsZero(), "the caller's request must not be modified")
+
+	warden.Clock = FixedClock(time.Date(2031, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, ErrRequestDenied, errors.Cause(warden.IsAllowed(r)))
+
+	// The time of the request wins over the clock.
+	r.Time = time.Date(2029, 6, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, warden.IsAllowed(r))
+}
+
+func TestRequestTime(t *testing.T) {
+	at := time.Date(2029, 6, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, at, RequestTime(&Request{Time: at}))
+	assert.WithinDuration(t, time.Now(), RequestTime(new(Request)), time.Minute)
+	assert.WithinDuration(t, time.Now(), RequestTime(nil), time.Minute)
+}
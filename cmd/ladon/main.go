@@ -0,0 +1,524 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Command ladon manages ladon policy stores.
+//
+// Usage:
+//
+//	ladon [-store path] <command> [arguments]
+//
+// The store is either an export bundle, a JSON array of policies which is created if it does not exist, or a
+// directory served read-only by a FileManager. It defaults to the LADON_STORE environment variable. The commands
+// are:
+//
+//	list [-label key=value]      print all policies, or those carrying the label
+//	get <id>                     print a policy
+//	create [policy.json]         create a policy or an array of policies
+//	delete <id>...               delete policies
+//	check -subject s -action a -resource r [-context json] [-tenant t]
+//	                             decide an access request
+//	import [-mode mode] [bundle.json]
+//	                             import a bundle, mode is merge, replace or skip-existing
+//	export [bundle.json]         export all policies
+//	fsck [bundle.json]           validate a bundle
+//	analyze [bundle.json]        report conflicting and shadowed policies of a bundle
+//	simulate -changes changes.json -requests requests.json [bundle.json]
+//	                             report the decisions on requests which a change set flips
+//	sign -key key.pem -key-id id [policy.json]
+//	                             sign a policy or an array of policies with a PKCS #8 encoded Ed25519 key
+//
+// Files default to standard input or output. Results are written as JSON to standard output. The commands exit
+// with status 1 if a request is denied or issues were found and 2 on errors.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/analysis"
+)
+
+const usage = "Usage: ladon [-store path] list|get|create|delete|check|import|export|fsck|analyze|simulate|sign [arguments]"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	store          string
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	flags := flag.NewFlagSet("ladon", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&c.store, "store", os.Getenv("LADON_STORE"), "bundle or directory holding the policies")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]func([]string) (int, error){
+		"list":     c.list,
+		"get":      c.get,
+		"create":   c.create,
+		"delete":   c.delete,
+		"check":    c.check,
+		"import":   c.importBundle,
+		"export":   c.exportBundle,
+		"fsck":     c.fsck,
+		"analyze":  c.analyze,
+		"simulate": c.simulate,
+		"sign":     c.sign,
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	code, err := command(args[1:])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return code
+}
+
+// input opens the file named by the only argument, or standard input if there is none or it is "-".
+func (c *cli) input(args []string) (io.ReadCloser, error) {
+	if len(args) > 1 {
+		return nil, errors.New(usage)
+	} else if len(args) == 0 || args[0] == "-" {
+		return ioutil.NopCloser(c.stdin), nil
+	}
+
+	f, err := os.Open(args[0])
+	return f, errors.WithStack(err)
+}
+
+func (c *cli) write(v interface{}) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(v))
+}
+
+func (c *cli) list(args []string) (int, error) {
+	var label string
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&label, "label", "", "only print policies carrying the label key=value")
+	if err := flags.Parse(args); err != nil {
+		return 2, err
+	} else if flags.NArg() > 0 {
+		return 2, errors.New("Usage: ladon list [-label key=value]")
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	if label == "" {
+		policies, err := ladon.Export(s)
+		if err != nil {
+			return 2, err
+		}
+		return 0, c.write(policies)
+	}
+
+	kv := strings.SplitN(label, "=", 2)
+	if len(kv) != 2 {
+		return 2, errors.Errorf(`Label "%s" is not of the form key=value`, label)
+	}
+
+	policies, err := ladon.FindPoliciesByLabel(s, kv[0], kv[1])
+	if err != nil {
+		return 2, err
+	}
+	return 0, c.write(policies)
+}
+
+func (c *cli) get(args []string) (int, error) {
+	if len(args) != 1 {
+		return 2, errors.New("Usage: ladon get <id>")
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	p, err := s.Get(args[0])
+	if err != nil {
+		return 2, err
+	}
+	return 0, c.write(p)
+}
+
+func (c *cli) create(args []string) (int, error) {
+	in, err := c.input(args)
+	if err != nil {
+		return 2, err
+	}
+	defer in.Close()
+
+	payload, err := ioutil.ReadAll(in)
+	if err != nil {
+		return 2, errors.WithStack(err)
+	}
+
+	policies, err := decodePolicies(payload)
+	if err != nil {
+		return 2, err
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	for _, p := range policies {
+		if err := s.Create(p); err != nil {
+			return 2, err
+		}
+	}
+
+	if err := s.save(); err != nil {
+		return 2, err
+	}
+	return 0, c.write(policies)
+}
+
+func (c *cli) delete(args []string) (int, error) {
+	if len(args) == 0 {
+		return 2, errors.New("Usage: ladon delete <id>...")
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	for _, id := range args {
+		if _, err := s.Get(id); err != nil {
+			return 2, err
+		} else if err := s.Delete(id); err != nil {
+			return 2, err
+		}
+	}
+	return 0, s.save()
+}
+
+func (c *cli) check(args []string) (int, error) {
+	var r ladon.Request
+	var context string
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&r.Subject, "subject", "", "subject of the request")
+	flags.StringVar(&r.Action, "action", "", "action of the request")
+	flags.StringVar(&r.Resource, "resource", "", "resource of the request")
+	flags.StringVar(&r.Tenant, "tenant", "", "tenant of the request")
+	flags.StringVar(&context, "context", "{}", "context of the request as a JSON object")
+	if err := flags.Parse(args); err != nil {
+		return 2, err
+	} else if flags.NArg() > 0 {
+		return 2, errors.New("Usage: ladon check -subject s -action a -resource r [-context json] [-tenant t]")
+	}
+
+	if err := json.Unmarshal([]byte(context), &r.Context); err != nil {
+		return 2, errors.Wrap(err, "Could not decode context")
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	decision := struct {
+		Allowed bool   `json:"allowed"`
+		Error   string `json:"error,omitempty"`
+	}{Allowed: true}
+
+	// Denials carry a status code, other errors mean that the request could not be decided.
+	if err := (&ladon.Ladon{Manager: s, AuditLogger: &ladon.AuditLoggerNoOp{}}).IsAllowed(&r); err != nil {
+		if _, ok := errors.Cause(err).(interface{ StatusCode() int }); !ok {
+			return 2, err
+		}
+		decision.Allowed, decision.Error = false, err.Error()
+	}
+
+	if err := c.write(decision); err != nil {
+		return 2, err
+	} else if !decision.Allowed {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (c *cli) importBundle(args []string) (int, error) {
+	var mode string
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&mode, "mode", string(ladon.ImportMerge), "merge, replace or skip-existing")
+	if err := flags.Parse(args); err != nil {
+		return 2, err
+	}
+
+	in, err := c.input(flags.Args())
+	if err != nil {
+		return 2, err
+	}
+	defer in.Close()
+
+	payload, err := ioutil.ReadAll(in)
+	if err != nil {
+		return 2, errors.WithStack(err)
+	}
+
+	policies, err := decodePolicies(payload)
+	if err != nil {
+		return 2, err
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	if err := ladon.Import(s, policies, ladon.ImportMode(mode)); err != nil {
+		return 2, err
+	}
+	return 0, s.save()
+}
+
+func (c *cli) exportBundle(args []string) (int, error) {
+	if len(args) > 1 {
+		return 2, errors.New("Usage: ladon export [bundle.json]")
+	}
+
+	s, err := openStore(c.store)
+	if err != nil {
+		return 2, err
+	}
+
+	policies, err := ladon.Export(s)
+	if err != nil {
+		return 2, err
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		return 0, c.write(policies)
+	}
+
+	out, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return 2, errors.WithStack(err)
+	}
+	return 0, errors.WithStack(ioutil.WriteFile(args[0], append(out, '\n'), 0644))
+}
+
+// bundle reads the payloads of the bundle named by args.
+func (c *cli) bundle(args []string) ([]json.RawMessage, error) {
+	in, err := c.input(args)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	var payloads []json.RawMessage
+	if err := json.NewDecoder(in).Decode(&payloads); err != nil {
+		return nil, errors.Wrap(err, "Could not decode bundle")
+	}
+	return payloads, nil
+}
+
+func (c *cli) fsck(args []string) (int, error) {
+	payloads, err := c.bundle(args)
+	if err != nil {
+		return 2, err
+	}
+
+	report := ladon.FsckPayloads(payloads)
+	return c.report(report, report.OK())
+}
+
+func (c *cli) analyze(args []string) (int, error) {
+	payloads, err := c.bundle(args)
+	if err != nil {
+		return 2, err
+	}
+
+	policies, err := decodePayloads(payloads)
+	if err != nil {
+		return 2, err
+	}
+
+	report, err := analysis.Analyze(policies)
+	if err != nil {
+		return 2, err
+	}
+	return c.report(report, report.OK())
+}
+
+func (c *cli) simulate(args []string) (int, error) {
+	var changesFile, requestsFile string
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&changesFile, "changes", "", "JSON file holding the change set")
+	flags.StringVar(&requestsFile, "requests", "", "JSON file holding an array of requests")
+	if err := flags.Parse(args); err != nil {
+		return 2, err
+	} else if changesFile == "" || requestsFile == "" {
+		return 2, errors.New("Usage: ladon simulate -changes changes.json -requests requests.json [bundle.json]")
+	}
+
+	var changes analysis.ChangeSet
+	if err := readJSON(changesFile, &changes); err != nil {
+		return 2, err
+	}
+
+	var requests []ladon.Request
+	if err := readJSON(requestsFile, &requests); err != nil {
+		return 2, err
+	}
+
+	payloads, err := c.bundle(flags.Args())
+	if err != nil {
+		return 2, err
+	}
+
+	policies, err := decodePayloads(payloads)
+	if err != nil {
+		return 2, err
+	}
+
+	simulation, err := analysis.Simulate(nil, policies, &changes, requests)
+	if err != nil {
+		return 2, err
+	}
+	return c.report(simulation, simulation.OK())
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v interface{}) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	} else if err := json.Unmarshal(raw, v); err != nil {
+		return errors.Wrapf(err, `Could not decode "%s"`, path)
+	}
+	return nil
+}
+
+func (c *cli) sign(args []string) (int, error) {
+	var key, keyID string
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&key, "key", "", "PEM file holding the PKCS #8 encoded Ed25519 private key")
+	flags.StringVar(&keyID, "key-id", "", "ID of the key, which verifiers look the public key up by")
+	if err := flags.Parse(args); err != nil {
+		return 2, err
+	} else if key == "" || keyID == "" {
+		return 2, errors.New("Usage: ladon sign -key key.pem -key-id id [policy.json]")
+	}
+
+	private, err := readPrivateKey(key)
+	if err != nil {
+		return 2, err
+	}
+
+	in, err := c.input(flags.Args())
+	if err != nil {
+		return 2, err
+	}
+	defer in.Close()
+
+	payload, err := ioutil.ReadAll(in)
+	if err != nil {
+		return 2, errors.WithStack(err)
+	}
+
+	policies, err := decodePolicies(payload)
+	if err != nil {
+		return 2, err
+	}
+
+	signer := &ladon.Signer{KeyID: keyID, Key: private}
+	for _, p := range policies {
+		if err := signer.Sign(p.(*ladon.DefaultPolicy)); err != nil {
+			return 2, err
+		}
+	}
+	return 0, c.write(policies)
+}
+
+// readPrivateKey reads a PEM encoded Ed25519 private key, as generated by "openssl genpkey -algorithm ed25519".
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.Errorf(`File "%s" holds no PEM block`, path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, `Could not parse key "%s"`, path)
+	}
+
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf(`Key "%s" is not an Ed25519 key`, path)
+	}
+	return private, nil
+}
+
+func (c *cli) report(report interface{}, ok bool) (int, error) {
+	if err := c.write(report); err != nil {
+		return 2, err
+	} else if !ok {
+		return 1, nil
+	}
+	return 0, nil
+}
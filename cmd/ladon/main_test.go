@@ -0,0 +1,222 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/analysis"
+)
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"fsck"}, strings.NewReader(`[{"id": "1", "effect": "allow"}, {"id": "2", "effect": "maybe"}]`), &stdout, &stderr)
+	assert.Equal(t, 1, code)
+
+	var report ladon.FsckReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, 2, report.Policies)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, "2", report.Issues[0].PolicyID)
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"fsck", "-"}, strings.NewReader(`[]`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"fsck"}, strings.NewReader(`{`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"fsck", "/does/not/exist"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run(nil, nil, &stdout, &stderr))
+}
+
+func TestRunAnalyze(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"analyze"}, strings.NewReader(`[
+		{"id": "1", "subjects": ["max"], "resources": ["articles:1"], "actions": ["get"], "effect": "allow"},
+		{"id": "2", "subjects": ["<.*>"], "resources": ["<.*>"], "actions": ["get"], "effect": "deny"}
+	]`), &stdout, &stderr)
+	assert.Equal(t, 1, code)
+
+	var report analysis.Report
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	require.Len(t, report.Findings, 1)
+	assert.Equal(t, analysis.KindShadowed, report.Findings[0].Kind)
+
+	assert.Equal(t, 0, run([]string{"analyze"}, strings.NewReader(`[]`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"analyze"}, strings.NewReader(`[{"id": 1}]`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"lint"}, nil, &stdout, &stderr))
+}
+
+func TestRunStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "policies.json")
+	exec := func(stdin string, args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"-store", bundle}, args...), strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String() + stderr.String()
+	}
+
+	code, out := exec(`[
+		{"id": "1", "subjects": ["peter"], "resources": ["articles:<[0-9]+>"], "actions": ["get"], "effect": "allow", "labels": {"team": "blog"}},
+		{"id": "2", "subjects": ["<.*>"], "resources": ["articles:1"], "actions": ["get"], "effect": "deny"}
+	]`, "create")
+	require.Equal(t, 0, code, out)
+
+	code, out = exec(`{"id": "3", "subjects": ["max"], "resources": ["<.*>"], "actions": ["get"], "effect": "allow"}`, "create", "-")
+	require.Equal(t, 0, code, out)
+
+	code, out = exec("", "get", "3")
+	require.Equal(t, 0, code, out)
+	assert.Contains(t, out, `"max"`)
+
+	code, out = exec("", "list", "-label", "team=blog")
+	require.Equal(t, 0, code, out)
+	var labeled []ladon.DefaultPolicy
+	require.NoError(t, json.Unmarshal([]byte(out), &labeled))
+	require.Len(t, labeled, 1)
+	assert.Equal(t, "1", labeled[0].ID)
+
+	code, _ = exec("", "list", "-label", "team")
+	assert.Equal(t, 2, code)
+
+	code, out = exec("", "check", "-subject", "peter", "-action", "get", "-resource", "articles:2")
+	assert.Equal(t, 0, code, out)
+	assert.Contains(t, out, `"allowed": true`)
+
+	code, out = exec("", "check", "-subject", "peter", "-action", "get", "-resource", "articles:1")
+	assert.Equal(t, 1, code, out)
+	assert.Contains(t, out, `"allowed": false`)
+
+	code, out = exec("", "delete", "2", "3")
+	require.Equal(t, 0, code, out)
+	code, out = exec("", "check", "-subject", "peter", "-action", "get", "-resource", "articles:1")
+	assert.Equal(t, 0, code, out)
+
+	code, out = exec("", "list")
+	require.Equal(t, 0, code, out)
+	var policies []ladon.DefaultPolicy
+	require.NoError(t, json.Unmarshal([]byte(out), &policies))
+	require.Len(t, policies, 1)
+
+	code, out = exec(`[{"id": "4", "subjects": ["ken"], "resources": ["<.*>"], "actions": ["get"], "effect": "allow"}]`, "import", "-mode", "replace")
+	require.Equal(t, 0, code, out)
+
+	exported := filepath.Join(dir, "export.json")
+	code, out = exec("", "export", exported)
+	require.Equal(t, 0, code, out)
+	payload, err := ioutil.ReadFile(exported)
+	require.NoError(t, err)
+	assert.Contains(t, string(payload), `"id": "4"`)
+	assert.NotContains(t, string(payload), `"id": "1"`)
+
+	code, _ = exec("", "get", "1")
+	assert.Equal(t, 2, code)
+	code, _ = exec("", "delete", "1")
+	assert.Equal(t, 2, code)
+	code, _ = exec(`{"id": "4", "effect": "allow"}`, "create")
+	assert.Equal(t, 2, code)
+	code, _ = exec("", "check", "-subject", "ken", "-context", "{")
+	assert.Equal(t, 2, code)
+	code, _ = exec("[]", "import", "-mode", "overwrite")
+	assert.Equal(t, 2, code)
+
+	// Directories are read-only.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "policies"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "policies", "1.json"), payload, 0644))
+	bundle = filepath.Join(dir, "policies")
+	code, out = exec("", "check", "-subject", "ken", "-action", "get", "-resource", "articles:1")
+	assert.Equal(t, 0, code, out)
+	code, _ = exec("", "delete", "4")
+	assert.Equal(t, 2, code)
+}
+
+func TestRunSign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	key := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"sign", "-key", key, "-key-id", "ci"}, strings.NewReader(`{"id": "1", "subjects": ["peter"], "effect": "allow"}`), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	var policies []ladon.DefaultPolicy
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &policies))
+	require.Len(t, policies, 1)
+	require.NotNil(t, policies[0].Signature)
+	assert.Equal(t, "ci", policies[0].Signature.KeyID)
+	assert.NoError(t, (&ladon.Verifier{Keys: map[string]ed25519.PublicKey{"ci": public}}).Verify(&policies[0]))
+
+	assert.Equal(t, 2, run([]string{"sign", "-key", key}, strings.NewReader(`[]`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"sign", "-key", filepath.Join(dir, "missing.pem"), "-key-id", "ci"}, strings.NewReader(`[]`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"sign", "-key", key, "-key-id", "ci"}, strings.NewReader(`{`), &stdout, &stderr))
+}
+
+func TestRunSimulate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	changes := filepath.Join(dir, "changes.json")
+	require.NoError(t, ioutil.WriteFile(changes, []byte(`{
+		"add": [{"id": "no-ken", "subjects": ["ken"], "resources": ["<.*>"], "actions": ["<.*>"], "effect": "deny"}]
+	}`), 0644))
+	requests := filepath.Join(dir, "requests.json")
+	require.NoError(t, ioutil.WriteFile(requests, []byte(`[
+		{"subject": "peter", "action": "get", "resource": "articles:1"},
+		{"subject": "ken", "action": "get", "resource": "articles:1"}
+	]`), 0644))
+	bundle := `[{"id": "read", "subjects": ["<.*>"], "resources": ["articles:<.*>"], "actions": ["get"], "effect": "allow"}]`
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"simulate", "-changes", changes, "-requests", requests}, strings.NewReader(bundle), &stdout, &stderr)
+	require.Equal(t, 1, code, stderr.String())
+
+	var simulation analysis.Simulation
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &simulation))
+	assert.Equal(t, 2, simulation.Requests)
+	require.Len(t, simulation.Flips, 1)
+	assert.Equal(t, "ken", simulation.Flips[0].Request.Subject)
+
+	assert.Equal(t, 0, run([]string{"simulate", "-changes", changes, "-requests", requests}, strings.NewReader(`[]`), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"simulate", "-changes", changes}, strings.NewReader(bundle), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"simulate", "-changes", requests, "-requests", requests}, strings.NewReader(bundle), &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"simulate", "-changes", filepath.Join(dir, "missing.json"), "-requests", requests}, strings.NewReader(bundle), &stdout, &stderr))
+}
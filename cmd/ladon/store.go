@@ -0,0 +1,143 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/file"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// store is a policy store the commands operate on.
+type store struct {
+	ladon.Manager
+
+	// path is the bundle the policies are written back to, empty for read-only stores.
+	path string
+}
+
+// openStore opens the policy store at path. Directories are served read-only by a FileManager, other paths are
+// export bundles which are loaded into memory and written back by save. Bundles which do not exist are empty.
+func openStore(path string) (*store, error) {
+	if path == "" {
+		return nil, errors.New("No policy store configured, use -store or LADON_STORE")
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		m, err := file.NewFileManager(path)
+		if err != nil {
+			return nil, err
+		}
+		return &store{Manager: m}, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	m := memory.NewMemoryManager()
+	payload, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &store{Manager: m, path: path}, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	policies, err := decodePolicies(payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not decode %s", path)
+	}
+
+	for _, p := range policies {
+		if err := m.Create(p); err != nil {
+			return nil, errors.Wrapf(err, "Could not load %s", path)
+		}
+	}
+	return &store{Manager: m, path: path}, nil
+}
+
+// save writes the policies back to the bundle. The bundle is replaced atomically, so it is never left half
+// written.
+func (s *store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	policies, err := ladon.Export(s.Manager)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	} else if _, err := tmp.Write(append(out, '\n')); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	} else if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), s.path))
+}
+
+// decodePolicies decodes a single JSON policy or an array of policies.
+func decodePolicies(payload []byte) (ladon.Policies, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var payloads []json.RawMessage
+	if err := json.Unmarshal(raw, &payloads); err != nil {
+		payloads = []json.RawMessage{raw}
+	}
+
+	return decodePayloads(payloads)
+}
+
+// decodePayloads decodes a policy from every payload.
+func decodePayloads(payloads []json.RawMessage) (ladon.Policies, error) {
+	policies := make(ladon.Policies, len(payloads))
+	for k, payload := range payloads {
+		var p ladon.DefaultPolicy
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, errors.Wrapf(err, "Could not decode policy %d", k)
+		}
+		policies[k] = &p
+	}
+	return policies, nil
+}
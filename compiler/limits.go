@@ -0,0 +1,218 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package compiler
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// Limits bounds the complexity of the regular expressions in a template, so that a careless or malicious policy
+// author can not introduce expressions which take exponential time to evaluate. Zero values disable a limit.
+type Limits struct {
+	// MaxLength is the maximum length of a template in bytes.
+	MaxLength int
+
+	// MaxGroups is the maximum number of groups in all expressions of a template.
+	MaxGroups int
+
+	// MaxRepeat is the maximum count of a counted repetition such as {1,1000}.
+	MaxRepeat int
+
+	// AllowNestedRepetition permits repeating expressions which repeat themselves without consuming a mandatory
+	// character in every iteration, such as (a+)+ or (\w+\s?)*. The backtracking engine may take exponential time to
+	// evaluate them. Expressions like (:[a-z]+)* are always permitted.
+	AllowNestedRepetition bool
+}
+
+// ValidateLimits returns an error if tpl or one of its regular expressions exceeds limits. Lookarounds and atomic
+// groups, which the RE2 syntax does not know, are checked like optional groups. Expressions using other features
+// the RE2 syntax does not know, such as backreferences, are rejected, because their complexity can not be checked.
+func ValidateLimits(tpl string, delimiterStart, delimiterEnd byte, limits Limits) error {
+	if limits.MaxLength > 0 && len(tpl) > limits.MaxLength {
+		return fmt.Errorf("Template is %d bytes long, only %d are allowed", len(tpl), limits.MaxLength)
+	}
+
+	idxs, err := delimiterIndices(tpl, delimiterStart, delimiterEnd)
+	if err != nil {
+		return err
+	}
+
+	var groups int
+	for i := 0; i < len(idxs); i += 2 {
+		pattern := tpl[idxs[i]+1 : idxs[i+1]-1]
+		re, err := syntax.Parse(pattern, syntax.Perl)
+		if e, ok := err.(*syntax.Error); ok && e.Code == syntax.ErrInvalidRepeatSize && limits.MaxRepeat > 0 {
+			// The RE2 syntax does not allow counts above 1000.
+			return fmt.Errorf("Repetition %s exceeds the limit of %d", e.Expr, limits.MaxRepeat)
+		} else if err != nil {
+			// Lookarounds are not captured, but the backtracking engine allocates a group for them.
+			groups += countGroups(pattern)
+			if re, err = syntax.Parse(rewriteLookarounds(pattern), syntax.Perl); err != nil {
+				return fmt.Errorf("Expression %s can not be checked for its complexity: %s", pattern, err)
+			}
+		} else {
+			groups += re.MaxCap()
+		}
+
+		if err := validateRepetitions(re, limits); err != nil {
+			return err
+		}
+	}
+
+	if limits.MaxGroups > 0 && groups > limits.MaxGroups {
+		return fmt.Errorf("Template has %d groups, only %d are allowed", groups, limits.MaxGroups)
+	}
+	return nil
+}
+
+// validateRepetitions returns an error if re or one of its subexpressions exceeds limits.
+func validateRepetitions(re *syntax.Regexp, limits Limits) error {
+	if re.Op == syntax.OpRepeat && limits.MaxRepeat > 0 && (re.Min > limits.MaxRepeat || re.Max > limits.MaxRepeat) {
+		return fmt.Errorf("Repetition %s exceeds the limit of %d", re, limits.MaxRepeat)
+	}
+
+	if repeats(re) && !limits.AllowNestedRepetition && containsRepetition(re.Sub[0]) && !consumes(re.Sub[0]) {
+		return fmt.Errorf("Nested repetition %s may take exponential time to evaluate", re)
+	}
+
+	for _, sub := range re.Sub {
+		if err := validateRepetitions(sub, limits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repeats returns true if re matches its subexpression more than once.
+func repeats(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max == -1 || re.Max > 1
+	}
+	return false
+}
+
+func containsRepetition(re *syntax.Regexp) bool {
+	if repeats(re) {
+		return true
+	}
+
+	for _, sub := range re.Sub {
+		if containsRepetition(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// consumes returns true if every match of re consumes at least one character which is not repeated.
+func consumes(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral, syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpCapture:
+		return consumes(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if consumes(sub) {
+				return true
+			}
+		}
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !consumes(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// rewriteLookarounds rewrites the lookarounds of pattern as optional non-capturing groups and its atomic groups as
+// non-capturing groups, so that RE2 can parse it and the repetitions inside them are checked. Like lookarounds,
+// optional groups never consume a mandatory character.
+func rewriteLookarounds(pattern string) string {
+	var out strings.Builder
+	var optional []bool
+	class := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\':
+			out.WriteByte(c)
+			if i+1 < len(pattern) {
+				i++
+				out.WriteByte(pattern[i])
+			}
+			continue
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '(':
+			if prefix := lookaroundPrefix(pattern[i+1:]); prefix != "" {
+				out.WriteString("(?:")
+				optional = append(optional, prefix != "?>")
+				i += len(prefix)
+				continue
+			}
+			optional = append(optional, false)
+		case c == ')' && len(optional) > 0:
+			out.WriteByte(c)
+			if optional[len(optional)-1] {
+				out.WriteByte('?')
+			}
+			optional = optional[:len(optional)-1]
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+// lookaroundPrefix returns the prefix of the lookaround or atomic group starting with rest, the pattern following
+// an opening parenthesis, or an empty string if rest starts another group.
+func lookaroundPrefix(rest string) string {
+	for _, prefix := range []string{"?=", "?!", "?<=", "?<!", "?>"} {
+		if strings.HasPrefix(rest, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// countGroups counts the unescaped opening parentheses of pattern.
+func countGroups(pattern string) int {
+	var groups int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '(':
+			groups++
+		}
+	}
+	return groups
+}
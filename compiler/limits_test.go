@@ -0,0 +1,65 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLimits(t *testing.T) {
+	limits := Limits{MaxLength: 64, MaxGroups: 2, MaxRepeat: 100}
+	for k, c := range []struct {
+		template string
+		limits   Limits
+		valid    bool
+	}{
+		{template: "articles:1", limits: limits, valid: true},
+		{template: "articles:<[a-z]+(:[a-z]+)*>", limits: limits, valid: true},
+		{template: "articles:<(a|b)+>", limits: limits, valid: true},
+		{template: "articles:<(a+)+>", limits: limits, valid: false},
+		{template: `articles:<(\w+\s?)*>`, limits: limits, valid: false},
+		{template: "articles:<(a*|b)*>", limits: limits, valid: false},
+		{template: "articles:<(a+)+>", limits: Limits{AllowNestedRepetition: true}, valid: true},
+		{template: "articles:<a{1,1000}>", limits: limits, valid: false},
+		{template: "articles:<a{1,100}>", limits: limits, valid: true},
+		{template: "articles:<a{1,100000}>", limits: limits, valid: false},
+		{template: "articles:<(a)(b)(c)>", limits: limits, valid: false},
+		{template: "articles:<(?!admin)(a)(b)(c)>", limits: limits, valid: false},
+		{template: "articles:<(?!admin).*>", limits: limits, valid: true},
+		{template: "articles:<(?=(a+)+)b>", limits: limits, valid: false},
+		{template: "articles:<((?!x)a*)*>", limits: limits, valid: false},
+		{template: "articles:<(?!x)[(]+>", limits: limits, valid: true},
+		{template: `articles:<(a)\1>`, limits: limits, valid: false},
+		{template: "articles:<" + strings.Repeat("a", 64) + ">", limits: limits, valid: false},
+		{template: "articles:<" + strings.Repeat("a", 64) + ">", limits: Limits{}, valid: true},
+		{template: "articles:<a", limits: limits, valid: false},
+	} {
+		err := ValidateLimits(c.template, '<', '>', c.limits)
+		assert.Equal(t, c.valid, err == nil, "case %d: %v", k, err)
+	}
+
+	// Lookbehinds and atomic groups contain the default delimiters.
+	assert.NoError(t, ValidateLimits("articles:{(?<=:)[a-z]+}", '{', '}', limits))
+	assert.Error(t, ValidateLimits("articles:{(?>a+)+}", '{', '}', limits))
+	assert.NoError(t, ValidateLimits("articles:{(?>a+)+}", '{', '}', Limits{AllowNestedRepetition: true}))
+}
@@ -102,6 +102,12 @@ func delimiterIndices(s string, delimiterStart, delimiterEnd byte) ([]int, error
 	return idxs, nil
 }
 
+// ValidateDelimiters returns an error if the delimiters in a template are unbalanced.
+func ValidateDelimiters(tpl string, delimiterStart, delimiterEnd byte) error {
+	_, err := delimiterIndices(tpl, delimiterStart, delimiterEnd)
+	return err
+}
+
 // CompileRegex parses a template and returns a Regexp.
 //
 // You can define your own delimiters. It is e.g. common to use curly braces {} but I recommend using characters
@@ -111,6 +117,12 @@ func delimiterIndices(s string, delimiterStart, delimiterEnd byte) ([]int, error
 //  // if err != nil ...
 //  reg.MatchString("foo:bar.baz:123")
 func CompileRegex(tpl string, delimiterStart, delimiterEnd byte) (*regexp2.Regexp, error) {
+	return CompileRegexOptions(tpl, delimiterStart, delimiterEnd, regexp2.RE2)
+}
+
+// CompileRegexOptions parses a template like CompileRegex and compiles it with the given options, for example
+// regexp2.RE2|regexp2.IgnoreCase to match case-insensitively.
+func CompileRegexOptions(tpl string, delimiterStart, delimiterEnd byte, options regexp2.RegexOptions) (*regexp2.Regexp, error) {
 	// Check if it is well-formed.
 	idxs, errBraces := delimiterIndices(tpl, delimiterStart, delimiterEnd)
 	if errBraces != nil {
@@ -129,7 +141,7 @@ func CompileRegex(tpl string, delimiterStart, delimiterEnd byte) (*regexp2.Regex
 		// Build the regexp pattern.
 		varIdx := i / 2
 		fmt.Fprintf(pattern, "%s(%s)", regexp.QuoteMeta(raw), patt)
-		reg, err := regexp2.Compile(fmt.Sprintf("^%s$", patt), regexp2.RE2)
+		reg, err := regexp2.Compile(fmt.Sprintf("^%s$", patt), options)
 		if err != nil {
 			return nil, err
 		}
@@ -143,7 +155,7 @@ func CompileRegex(tpl string, delimiterStart, delimiterEnd byte) (*regexp2.Regex
 	pattern.WriteByte('$')
 
 	// Compile full regexp.
-	reg, errCompile := regexp2.Compile(pattern.String(), regexp2.RE2)
+	reg, errCompile := regexp2.Compile(pattern.String(), options)
 	if errCompile != nil {
 		return nil, errCompile
 	}
@@ -47,15 +47,11 @@ func (cs Conditions) AddCondition(key string, c Condition) {
 func (cs Conditions) MarshalJSON() ([]byte, error) {
 	out := make(map[string]*jsonCondition, len(cs))
 	for k, c := range cs {
-		raw, err := json.Marshal(c)
+		jc, err := marshalCondition(c)
 		if err != nil {
-			return []byte{}, errors.WithStack(err)
-		}
-
-		out[k] = &jsonCondition{
-			Type:    c.GetName(),
-			Options: json.RawMessage(raw),
+			return []byte{}, err
 		}
+		out[k] = jc
 	}
 
 	return json.Marshal(out)
@@ -68,41 +64,53 @@ func (cs Conditions) UnmarshalJSON(data []byte) error {
 	}
 
 	var jcs map[string]jsonCondition
-	var dc Condition
-
 	if err := json.Unmarshal(data, &jcs); err != nil {
 		return errors.WithStack(err)
 	}
 
 	for k, jc := range jcs {
-		var found bool
-		for name, c := range ConditionFactories {
-			if name == jc.Type {
-				found = true
-				dc = c()
-
-				if len(jc.Options) == 0 {
-					cs[k] = dc
-					break
-				}
-
-				if err := json.Unmarshal(jc.Options, dc); err != nil {
-					return errors.WithStack(err)
-				}
-
-				cs[k] = dc
-				break
-			}
-		}
-
-		if !found {
-			return errors.Errorf("Could not find condition type %s", jc.Type)
+		c, err := unmarshalCondition(jc)
+		if err != nil {
+			return err
 		}
+		cs[k] = c
 	}
 
 	return nil
 }
 
+// marshalCondition wraps c in its type and options, the format used by Conditions.
+func marshalCondition(c Condition) (*jsonCondition, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &jsonCondition{
+		Type:    c.GetName(),
+		Options: json.RawMessage(raw),
+	}, nil
+}
+
+// unmarshalCondition creates the condition described by jc using ConditionFactories.
+func unmarshalCondition(jc jsonCondition) (Condition, error) {
+	factory, ok := ConditionFactories[jc.Type]
+	if !ok {
+		return nil, errors.Errorf("Could not find condition type %s", jc.Type)
+	}
+
+	c := factory()
+	if len(jc.Options) == 0 {
+		return c, nil
+	}
+
+	if err := json.Unmarshal(jc.Options, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return c, nil
+}
+
 type jsonCondition struct {
 	Type    string          `json:"type"`
 	Options json.RawMessage `json:"options"`
@@ -131,4 +139,40 @@ var ConditionFactories = map[string]func() Condition{
 	new(BooleanCondition).GetName(): func() Condition {
 		return new (BooleanCondition)
 	},
+	new(DateCondition).GetName(): func() Condition {
+		return new(DateCondition)
+	},
+	new(ActionScopedCondition).GetName(): func() Condition {
+		return new(ActionScopedCondition)
+	},
+	new(GreaterThanCondition).GetName(): func() Condition {
+		return new(GreaterThanCondition)
+	},
+	new(LessThanCondition).GetName(): func() Condition {
+		return new(LessThanCondition)
+	},
+	new(BetweenCondition).GetName(): func() Condition {
+		return new(BetweenCondition)
+	},
+	new(AnyOfCondition).GetName(): func() Condition {
+		return new(AnyOfCondition)
+	},
+	new(AllOfCondition).GetName(): func() Condition {
+		return new(AllOfCondition)
+	},
+	new(NotCondition).GetName(): func() Condition {
+		return new(NotCondition)
+	},
+	new(JWTClaimsCondition).GetName(): func() Condition {
+		return new(JWTClaimsCondition)
+	},
+	new(ScopeCondition).GetName(): func() Condition {
+		return new(ScopeCondition)
+	},
+	new(GeoCondition).GetName(): func() Condition {
+		return new(GeoCondition)
+	},
+	new(WebhookCondition).GetName(): func() Condition {
+		return new(WebhookCondition)
+	},
 }
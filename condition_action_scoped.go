@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ActionScopedCondition applies Condition only to requests whose action matches one of Actions, which may
+// contain regular expressions. Requests for other actions fulfill it. This allows a single policy to require,
+// for example, MFA for deleting but not for reading a resource.
+type ActionScopedCondition struct {
+	Actions   []string
+	Condition Condition
+}
+
+// GetName returns the condition's name.
+func (c *ActionScopedCondition) GetName() string {
+	return "ActionScopedCondition"
+}
+
+// Fulfills returns true if the request's action is out of scope or if the scoped condition is fulfilled.
+func (c *ActionScopedCondition) Fulfills(value interface{}, r *Request) bool {
+	if c.Condition == nil {
+		return false
+	}
+
+	// DefaultPolicy provides the default regular expression delimiters.
+	matches, err := DefaultMatcher.Matches(new(DefaultPolicy), c.Actions, r.Action)
+	if err != nil {
+		return false
+	} else if !matches {
+		return true
+	}
+
+	return c.Condition.Fulfills(value, r)
+}
+
+type jsonActionScopedCondition struct {
+	Actions   []string       `json:"actions"`
+	Condition *jsonCondition `json:"condition"`
+}
+
+// MarshalJSON encodes the scoped condition with its type, like Conditions do.
+func (c *ActionScopedCondition) MarshalJSON() ([]byte, error) {
+	out := jsonActionScopedCondition{Actions: c.Actions}
+	if c.Condition != nil {
+		jc, err := marshalCondition(c.Condition)
+		if err != nil {
+			return nil, err
+		}
+		out.Condition = jc
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the scoped condition using ConditionFactories.
+func (c *ActionScopedCondition) UnmarshalJSON(data []byte) error {
+	var in jsonActionScopedCondition
+	if err := json.Unmarshal(data, &in); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Actions = in.Actions
+	c.Condition = nil
+	if in.Condition == nil {
+		return nil
+	}
+
+	condition, err := unmarshalCondition(*in.Condition)
+	if err != nil {
+		return err
+	}
+
+	c.Condition = condition
+	return nil
+}
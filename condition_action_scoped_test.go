@@ -0,0 +1,73 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionScopedCondition(t *testing.T) {
+	c := &ActionScopedCondition{
+		Actions:   []string{"delete", "<update|patch>"},
+		Condition: &BooleanCondition{BooleanValue: true},
+	}
+
+	for _, tc := range []struct {
+		action string
+		value  interface{}
+		pass   bool
+	}{
+		{action: "get", value: nil, pass: true},
+		{action: "get", value: false, pass: true},
+		{action: "delete", value: true, pass: true},
+		{action: "delete", value: false, pass: false},
+		{action: "delete", value: nil, pass: false},
+		{action: "patch", value: false, pass: false},
+		{action: "patch", value: true, pass: true},
+	} {
+		assert.Equal(t, tc.pass, c.Fulfills(tc.value, &Request{Action: tc.action}), "%+v", tc)
+	}
+
+	assert.False(t, new(ActionScopedCondition).Fulfills(true, &Request{Action: "delete"}))
+}
+
+func TestActionScopedConditionMarshalling(t *testing.T) {
+	cs := Conditions{
+		"mfa": &ActionScopedCondition{
+			Actions:   []string{"delete"},
+			Condition: &BooleanCondition{BooleanValue: true},
+		},
+	}
+
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"mfa":{"type":"ActionScopedCondition","options":{"actions":["delete"],"condition":{"type":"BooleanCondition","options":{"value":true}}}}}`, string(out))
+
+	got := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, cs, got)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"mfa":{"type":"ActionScopedCondition","options":{"actions":["delete"],"condition":{"type":"UnknownCondition"}}}}`), &got))
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBooleanCondition(t *testing.T) {
+	for _, c := range []struct {
+		expected bool
+		value    interface{}
+		pass     bool
+	}{
+		{expected: true, value: true, pass: true},
+		{expected: true, value: false, pass: false},
+		{expected: false, value: false, pass: true},
+		{expected: false, value: true, pass: false},
+		{expected: true, value: "true", pass: false},
+		{expected: false, value: nil, pass: false},
+	} {
+		condition := &BooleanCondition{BooleanValue: c.expected}
+
+		assert.Equal(t, c.pass, condition.Fulfills(c.value, new(Request)), "%+v", c)
+	}
+}
+
+func TestBooleanConditionMarshalling(t *testing.T) {
+	cs := Conditions{"mfa": &BooleanCondition{BooleanValue: true}}
+
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"mfa":{"type":"BooleanCondition","options":{"value":true}}}`, string(out))
+
+	got := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, cs, got)
+}
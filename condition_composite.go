@@ -0,0 +1,182 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// AnyOfCondition is a condition which is fulfilled if at least one of its conditions is fulfilled.
+type AnyOfCondition struct {
+	Conditions []Condition
+}
+
+// Fulfills returns true if any of the conditions is fulfilled by the given value.
+func (c *AnyOfCondition) Fulfills(value interface{}, r *Request) bool {
+	for _, condition := range c.Conditions {
+		if condition.Fulfills(value, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *AnyOfCondition) GetName() string {
+	return "AnyOfCondition"
+}
+
+// MarshalJSON encodes the child conditions with their types.
+func (c *AnyOfCondition) MarshalJSON() ([]byte, error) {
+	return marshalConditionList(c.Conditions)
+}
+
+// UnmarshalJSON decodes the child conditions using ConditionFactories.
+func (c *AnyOfCondition) UnmarshalJSON(data []byte) (err error) {
+	c.Conditions, err = unmarshalConditionList(data)
+	return err
+}
+
+// AllOfCondition is a condition which is fulfilled if all of its conditions are fulfilled.
+type AllOfCondition struct {
+	Conditions []Condition
+}
+
+// Fulfills returns true if all conditions are fulfilled by the given value.
+func (c *AllOfCondition) Fulfills(value interface{}, r *Request) bool {
+	for _, condition := range c.Conditions {
+		if !condition.Fulfills(value, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *AllOfCondition) GetName() string {
+	return "AllOfCondition"
+}
+
+// MarshalJSON encodes the child conditions with their types.
+func (c *AllOfCondition) MarshalJSON() ([]byte, error) {
+	return marshalConditionList(c.Conditions)
+}
+
+// UnmarshalJSON decodes the child conditions using ConditionFactories.
+func (c *AllOfCondition) UnmarshalJSON(data []byte) (err error) {
+	c.Conditions, err = unmarshalConditionList(data)
+	return err
+}
+
+// NotCondition is a condition which is fulfilled if its condition is not.
+type NotCondition struct {
+	Condition Condition
+}
+
+// Fulfills returns true if the condition is not fulfilled by the given value.
+func (c *NotCondition) Fulfills(value interface{}, r *Request) bool {
+	return c.Condition != nil && !c.Condition.Fulfills(value, r)
+}
+
+// GetName returns the condition's name.
+func (c *NotCondition) GetName() string {
+	return "NotCondition"
+}
+
+type jsonNotCondition struct {
+	Condition *jsonCondition `json:"condition"`
+}
+
+// MarshalJSON encodes the negated condition with its type.
+func (c *NotCondition) MarshalJSON() ([]byte, error) {
+	var out jsonNotCondition
+	if c.Condition != nil {
+		jc, err := marshalCondition(c.Condition)
+		if err != nil {
+			return nil, err
+		}
+		out.Condition = jc
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the negated condition using ConditionFactories.
+func (c *NotCondition) UnmarshalJSON(data []byte) error {
+	var in jsonNotCondition
+	if err := json.Unmarshal(data, &in); err != nil {
+		return errors.WithStack(err)
+	}
+
+	c.Condition = nil
+	if in.Condition == nil {
+		return nil
+	}
+
+	condition, err := unmarshalCondition(*in.Condition)
+	if err != nil {
+		return err
+	}
+
+	c.Condition = condition
+	return nil
+}
+
+type jsonConditionList struct {
+	Conditions []*jsonCondition `json:"conditions"`
+}
+
+func marshalConditionList(conditions []Condition) ([]byte, error) {
+	out := jsonConditionList{Conditions: make([]*jsonCondition, len(conditions))}
+	for k, c := range conditions {
+		jc, err := marshalCondition(c)
+		if err != nil {
+			return nil, err
+		}
+		out.Conditions[k] = jc
+	}
+
+	return json.Marshal(out)
+}
+
+func unmarshalConditionList(data []byte) ([]Condition, error) {
+	var in jsonConditionList
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	conditions := make([]Condition, len(in.Conditions))
+	for k, jc := range in.Conditions {
+		if jc == nil {
+			return nil, errors.Errorf("Condition %d must not be null", k)
+		}
+
+		c, err := unmarshalCondition(*jc)
+		if err != nil {
+			return nil, err
+		}
+		conditions[k] = c
+	}
+
+	return conditions, nil
+}
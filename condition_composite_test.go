@@ -0,0 +1,84 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompositeConditions(t *testing.T) {
+	admin := &StringEqualCondition{Equals: "admin"}
+	editor := &StringEqualCondition{Equals: "editor"}
+	prefixed := &StringMatchCondition{Matches: "^ed"}
+
+	for k, c := range []struct {
+		condition Condition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &AnyOfCondition{Conditions: []Condition{admin, editor}}, value: "admin", pass: true},
+		{condition: &AnyOfCondition{Conditions: []Condition{admin, editor}}, value: "editor", pass: true},
+		{condition: &AnyOfCondition{Conditions: []Condition{admin, editor}}, value: "viewer", pass: false},
+		{condition: &AnyOfCondition{}, value: "admin", pass: false},
+		{condition: &AllOfCondition{Conditions: []Condition{editor, prefixed}}, value: "editor", pass: true},
+		{condition: &AllOfCondition{Conditions: []Condition{admin, prefixed}}, value: "admin", pass: false},
+		{condition: &AllOfCondition{}, value: "admin", pass: true},
+		{condition: &NotCondition{Condition: admin}, value: "editor", pass: true},
+		{condition: &NotCondition{Condition: admin}, value: "admin", pass: false},
+		{condition: &NotCondition{}, value: "admin", pass: false},
+		{condition: &NotCondition{Condition: &AnyOfCondition{Conditions: []Condition{admin, editor}}}, value: "viewer", pass: true},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "%d", k)
+	}
+}
+
+func TestCompositeConditionsMarshalling(t *testing.T) {
+	cs := Conditions{
+		"role": &AnyOfCondition{Conditions: []Condition{
+			&StringEqualCondition{Equals: "admin"},
+			&AllOfCondition{Conditions: []Condition{
+				&StringMatchCondition{Matches: "^ed"},
+				&NotCondition{Condition: &StringEqualCondition{Equals: "editor-trainee"}},
+			}},
+		}},
+	}
+
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+
+	got := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, cs, got)
+	assert.True(t, got["role"].Fulfills("editor", new(Request)))
+	assert.False(t, got["role"].Fulfills("editor-trainee", new(Request)))
+
+	for _, raw := range []string{
+		`{"role":{"type":"AnyOfCondition","options":{"conditions":[{"type":"UnknownCondition"}]}}}`,
+		`{"role":{"type":"AllOfCondition","options":{"conditions":[null]}}}`,
+		`{"role":{"type":"NotCondition","options":{"condition":{"type":"UnknownCondition"}}}}`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(raw), &Conditions{}), raw)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"time"
+)
+
+// DateCondition is a condition which is fulfilled if the given value is a point in time
+// after DateCondition.After and before DateCondition.Before. Zero bounds are ignored.
+// The value may either be a time.Time or a RFC 3339 formatted string. If RequestTime is set, the
+// time of the request is checked instead of the value, see RequestTime.
+type DateCondition struct {
+	After       time.Time `json:"after,omitempty"`
+	Before      time.Time `json:"before,omitempty"`
+	RequestTime bool      `json:"requestTime,omitempty"`
+}
+
+// Fulfills returns true if the given value is a point in time within the bounds
+// of DateCondition.
+func (c *DateCondition) Fulfills(value interface{}, r *Request) bool {
+	if c.RequestTime {
+		value = RequestTime(r)
+	}
+
+	t, ok := toTime(value)
+	if !ok {
+		return false
+	}
+
+	if !c.After.IsZero() && !t.After(c.After) {
+		return false
+	}
+
+	if !c.Before.IsZero() && !t.Before(c.Before) {
+		return false
+	}
+
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *DateCondition) GetName() string {
+	return "DateCondition"
+}
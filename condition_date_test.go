@@ -0,0 +1,65 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDateCondition(t *testing.T) {
+	after := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		condition *DateCondition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &DateCondition{After: after}, value: "2018-06-01T00:00:00Z", pass: true},
+		{condition: &DateCondition{After: after}, value: "2017-06-01T00:00:00Z", pass: false},
+		{condition: &DateCondition{After: after}, value: after, pass: false},
+		{condition: &DateCondition{Before: before}, value: "2018-06-01T00:00:00+02:00", pass: true},
+		{condition: &DateCondition{Before: before}, value: before.Add(time.Second), pass: false},
+		{condition: &DateCondition{After: after, Before: before}, value: after.Add(time.Hour), pass: true},
+		{condition: &DateCondition{After: after, Before: before}, value: before.Add(time.Hour), pass: false},
+		{condition: &DateCondition{}, value: "2018-06-01T00:00:00Z", pass: true},
+		{condition: &DateCondition{After: after}, value: "yesterday", pass: false},
+		{condition: &DateCondition{After: after}, value: 1530000000, pass: false},
+		{condition: &DateCondition{After: after, RequestTime: true}, value: "2017-06-01T00:00:00Z", pass: true},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "%+v %v", c.condition, c.value)
+	}
+}
+
+func TestDateConditionMarshalling(t *testing.T) {
+	cs := Conditions{"time": &DateCondition{After: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+
+	decoded := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	assert.Equal(t, cs, decoded)
+}
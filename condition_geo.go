@@ -0,0 +1,143 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// earthRadius is the mean radius of the earth in kilometers.
+const earthRadius = 6371.0
+
+// GeoLocation is the location a request originates from.
+type GeoLocation struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, for example "DE".
+	Country string `json:"country"`
+
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// GeoResolver resolves the location of an IP address, for example using a GeoIP database.
+type GeoResolver interface {
+	Resolve(ctx context.Context, ip net.IP) (*GeoLocation, error)
+}
+
+// GeoResolverFunc adapts a function to the GeoResolver interface.
+type GeoResolverFunc func(ctx context.Context, ip net.IP) (*GeoLocation, error)
+
+// Resolve calls f.
+func (f GeoResolverFunc) Resolve(ctx context.Context, ip net.IP) (*GeoLocation, error) {
+	return f(ctx, ip)
+}
+
+// NewGeoEnricher returns a ContextEnricher which resolves the IP address stored in the context under ipKey and
+// stores its location under locationKey, where a GeoCondition can check it. Requests without a valid IP address
+// are left untouched.
+func NewGeoEnricher(resolver GeoResolver, ipKey, locationKey string) ContextEnricher {
+	return ContextEnricherFunc(func(ctx context.Context, r *Request) (Context, error) {
+		address, _ := r.Context[ipKey].(string)
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, nil
+		}
+
+		location, err := resolver.Resolve(ctx, ip)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		} else if location == nil {
+			return nil, nil
+		}
+		return Context{locationKey: location}, nil
+	})
+}
+
+// GeoCondition is fulfilled if the value is a location in one of Countries and, if Radius is set, within Radius
+// kilometers of Latitude and Longitude. The value may be a GeoLocation, a map with the keys "country", "lat" and
+// "lon", or an ISO 3166-1 alpha-2 country code, which can not fulfill a radius.
+type GeoCondition struct {
+	Countries []string `json:"countries,omitempty"`
+	Latitude  float64  `json:"lat,omitempty"`
+	Longitude float64  `json:"lon,omitempty"`
+	Radius    float64  `json:"radius,omitempty"`
+}
+
+// Fulfills returns true if the location in value satisfies the condition.
+func (c *GeoCondition) Fulfills(value interface{}, _ *Request) bool {
+	var location GeoLocation
+	coordinates := true
+	switch v := value.(type) {
+	case GeoLocation:
+		location = v
+	case *GeoLocation:
+		if v == nil {
+			return false
+		}
+		location = *v
+	case map[string]interface{}:
+		location.Country, _ = v["country"].(string)
+		var okLat, okLon bool
+		location.Latitude, okLat = v["lat"].(float64)
+		location.Longitude, okLon = v["lon"].(float64)
+		coordinates = okLat && okLon
+	case string:
+		location.Country = v
+		coordinates = false
+	default:
+		return false
+	}
+
+	if len(c.Countries) > 0 {
+		found := false
+		for _, country := range c.Countries {
+			if strings.EqualFold(country, location.Country) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if c.Radius > 0 {
+		return coordinates && distance(c.Latitude, c.Longitude, location.Latitude, location.Longitude) <= c.Radius
+	}
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *GeoCondition) GetName() string {
+	return "GeoCondition"
+}
+
+// distance returns the great-circle distance between two points in kilometers.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
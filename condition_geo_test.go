@@ -0,0 +1,101 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoCondition(t *testing.T) {
+	berlin := GeoLocation{Country: "DE", Latitude: 52.52, Longitude: 13.405}
+	munich := &GeoLocation{Country: "DE", Latitude: 48.137, Longitude: 11.575}
+	eu := []string{"DE", "FR", "NL"}
+
+	for k, c := range []struct {
+		condition *GeoCondition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &GeoCondition{Countries: eu}, value: berlin, pass: true},
+		{condition: &GeoCondition{Countries: eu}, value: "de", pass: true},
+		{condition: &GeoCondition{Countries: eu}, value: "US", pass: false},
+		{condition: &GeoCondition{Countries: eu}, value: map[string]interface{}{"country": "FR"}, pass: true},
+		{condition: &GeoCondition{Latitude: 52.52, Longitude: 13.405, Radius: 100}, value: berlin, pass: true},
+		{condition: &GeoCondition{Latitude: 52.52, Longitude: 13.405, Radius: 100}, value: munich, pass: false},
+		{condition: &GeoCondition{Latitude: 52.52, Longitude: 13.405, Radius: 600}, value: munich, pass: true},
+		{condition: &GeoCondition{Latitude: 52.52, Longitude: 13.405, Radius: 100}, value: map[string]interface{}{"lat": 52.4, "lon": 13.1}, pass: true},
+		{condition: &GeoCondition{Latitude: 52.52, Longitude: 13.405, Radius: 100}, value: map[string]interface{}{"country": "DE"}, pass: false},
+		{condition: &GeoCondition{Latitude: 52.52, Longitude: 13.405, Radius: 100}, value: "DE", pass: false},
+		{condition: &GeoCondition{Countries: []string{"US"}, Latitude: 52.52, Longitude: 13.405, Radius: 100}, value: berlin, pass: false},
+		{condition: &GeoCondition{Countries: eu}, value: (*GeoLocation)(nil), pass: false},
+		{condition: &GeoCondition{Countries: eu}, value: 1, pass: false},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "case %d", k)
+	}
+
+	// Berlin to Munich is about 504 kilometers.
+	assert.InDelta(t, 504, distance(berlin.Latitude, berlin.Longitude, munich.Latitude, munich.Longitude), 2)
+}
+
+func TestGeoConditionMarshalling(t *testing.T) {
+	cs := Conditions{"location": &GeoCondition{Countries: []string{"DE"}, Latitude: 52.52, Longitude: 13.405, Radius: 100}}
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+
+	decoded := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	assert.Equal(t, cs, decoded)
+}
+
+func TestGeoEnricher(t *testing.T) {
+	resolver := GeoResolverFunc(func(ctx context.Context, ip net.IP) (*GeoLocation, error) {
+		switch ip.String() {
+		case "192.0.2.1":
+			return &GeoLocation{Country: "DE"}, nil
+		case "192.0.2.2":
+			return nil, errors.New("database unavailable")
+		}
+		return nil, nil
+	})
+	e := NewGeoEnricher(resolver, "ip", "location")
+
+	attributes, err := e.Enrich(context.Background(), &Request{Context: Context{"ip": "192.0.2.1"}})
+	require.NoError(t, err)
+	assert.Equal(t, Context{"location": &GeoLocation{Country: "DE"}}, attributes)
+
+	attributes, err = e.Enrich(context.Background(), &Request{Context: Context{"ip": "192.0.2.3"}})
+	require.NoError(t, err)
+	assert.Empty(t, attributes)
+
+	attributes, err = e.Enrich(context.Background(), &Request{Context: Context{}})
+	require.NoError(t, err)
+	assert.Empty(t, attributes)
+
+	_, err = e.Enrich(context.Background(), &Request{Context: Context{"ip": "192.0.2.2"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JWTVerifier verifies the signature of a JWT and returns its claims.
+type JWTVerifier func(token string) (map[string]interface{}, error)
+
+// JWTKeySets are the key sets JWTClaimsCondition.KeySet refers to, by name. Register a JWTKeySet, or a verifier
+// backed by any JWT library, before policies using it are evaluated:
+//
+//	ladon.JWTKeySets["gateway"] = ladon.JWTKeySet{"key-1": publicKey}.Verify
+var JWTKeySets = map[string]JWTVerifier{}
+
+// JWTClaimsCondition is fulfilled if the value is a JWT whose claims satisfy all constraints: the issuer, the
+// audience, the scopes and arbitrary claims. Tokens which are expired or not valid yet at RequestTime never fulfill
+// it. The value may be the token, optionally prefixed with "Bearer ", or the claims of a token verified before.
+//
+// If KeySet is set, the token's signature is verified with the key set registered in JWTKeySets under that name.
+// Otherwise, the signature is not checked, which is only safe if a gateway verified the token before.
+type JWTClaimsCondition struct {
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+
+	// Scopes must all be granted by the token, either in a space separated "scope" claim or in a "scp" array.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Claims must be equal to the token's claims. If a claim of the token is an array, it must contain the value.
+	Claims map[string]interface{} `json:"claims,omitempty"`
+
+	KeySet string `json:"keySet,omitempty"`
+}
+
+// Fulfills returns true if the value is a JWT whose claims satisfy the condition.
+func (c *JWTClaimsCondition) Fulfills(value interface{}, r *Request) bool {
+	var claims map[string]interface{}
+	switch v := value.(type) {
+	case string:
+		token := strings.TrimSpace(v)
+		if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+			token = strings.TrimSpace(token[7:])
+		}
+
+		var err error
+		if c.KeySet == "" {
+			claims, err = decodeJWTClaims(token)
+		} else if verify, ok := JWTKeySets[c.KeySet]; ok {
+			claims, err = verify(token)
+		} else {
+			return false
+		}
+
+		if err != nil {
+			return false
+		}
+	case map[string]interface{}:
+		if c.KeySet != "" {
+			return false
+		}
+		claims = v
+	default:
+		return false
+	}
+
+	return c.satisfiedBy(claims, RequestTime(r))
+}
+
+func (c *JWTClaimsCondition) satisfiedBy(claims map[string]interface{}, now time.Time) bool {
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0)) {
+		return false
+	} else if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return false
+	}
+
+	if c.Issuer != "" && claims["iss"] != c.Issuer {
+		return false
+	} else if c.Audience != "" && !claimContains(claims["aud"], c.Audience) {
+		return false
+	}
+
+	granted := map[string]bool{}
+	if scope, ok := claims["scope"].(string); ok {
+		for _, s := range strings.Fields(scope) {
+			granted[s] = true
+		}
+	}
+	if scp, ok := toStringSlice(claims["scp"]); ok {
+		for _, s := range scp {
+			granted[s] = true
+		}
+	}
+	for _, s := range c.Scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+
+	for name, expected := range c.Claims {
+		if !claimContains(claims[name], expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// claimContains returns true if claim equals expected or is an array containing it.
+func claimContains(claim, expected interface{}) bool {
+	if values, ok := claim.([]interface{}); ok {
+		for _, v := range values {
+			if reflect.DeepEqual(v, expected) {
+				return true
+			}
+		}
+		return false
+	}
+	return reflect.DeepEqual(claim, expected)
+}
+
+// GetName returns the condition's name.
+func (c *JWTClaimsCondition) GetName() string {
+	return "JWTClaimsCondition"
+}
+
+// JWTKeySet verifies JWT signatures with keys identified by their key ID, the "kid" header of a token. Tokens
+// without a key ID are verified with the only key of a set with one key. Keys are []byte secrets for HS256,
+// HS384 and HS512, *rsa.PublicKey for RS256, RS384 and RS512 and *ecdsa.PublicKey for ES256, ES384 and ES512.
+type JWTKeySet map[string]interface{}
+
+// Verify verifies the signature of token and returns its claims.
+func (ks JWTKeySet) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is not a JWT")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	key, ok := ks[header.KeyID]
+	if !ok && header.KeyID == "" && len(ks) == 1 {
+		for _, k := range ks {
+			key = k
+		}
+	} else if !ok {
+		return nil, errors.Errorf(`Unknown key "%s"`, header.KeyID)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := verifyJWTSignature(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	return decodeJWTClaims(token)
+}
+
+// jwtAlgorithm is a supported signature algorithm. curve is the name of the only curve ES algorithms may be used with.
+type jwtAlgorithm struct {
+	family string
+	hash   crypto.Hash
+	curve  string
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"HS256": {family: "HS", hash: crypto.SHA256},
+	"HS384": {family: "HS", hash: crypto.SHA384},
+	"HS512": {family: "HS", hash: crypto.SHA512},
+	"RS256": {family: "RS", hash: crypto.SHA256},
+	"RS384": {family: "RS", hash: crypto.SHA384},
+	"RS512": {family: "RS", hash: crypto.SHA512},
+	"ES256": {family: "ES", hash: crypto.SHA256, curve: "P-256"},
+	"ES384": {family: "ES", hash: crypto.SHA384, curve: "P-384"},
+	"ES512": {family: "ES", hash: crypto.SHA512, curve: "P-521"},
+}
+
+// verifyJWTSignature verifies signature with key. The algorithm must fit the type of the key, so a public key can
+// never be used as HMAC secret, and ES algorithms must use the curve they are defined for.
+func verifyJWTSignature(algorithm string, key interface{}, signed, signature []byte) error {
+	alg, ok := jwtAlgorithms[algorithm]
+	if !ok {
+		return errors.Errorf(`Algorithm "%s" is not supported`, algorithm)
+	}
+	hash := alg.hash
+
+	switch k := key.(type) {
+	case []byte:
+		if alg.family != "HS" {
+			break
+		}
+
+		mac := hmac.New(hash.New, k)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("Token signature is invalid")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg.family != "RS" {
+			break
+		}
+
+		h := hash.New()
+		h.Write(signed)
+		return errors.WithStack(rsa.VerifyPKCS1v15(k, hash, h.Sum(nil), signature))
+	case *ecdsa.PublicKey:
+		if alg.family != "ES" || k.Curve.Params().Name != alg.curve {
+			break
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("Token signature is invalid")
+		}
+
+		h := hash.New()
+		h.Write(signed)
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, h.Sum(nil), r, s) {
+			return errors.New("Token signature is invalid")
+		}
+		return nil
+	}
+	return errors.Errorf(`Algorithm "%s" can not be used with key of type %T`, algorithm, key)
+}
+
+// decodeJWTClaims returns the claims of token without verifying its signature.
+func decodeJWTClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Token is not a JWT")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(raw, v))
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signJWT(t *testing.T, header, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	encode := func(v interface{}) string {
+		raw, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWTClaimsCondition(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := &Request{Time: now}
+	claims := map[string]interface{}{
+		"iss":   "https://auth.example.com",
+		"aud":   []string{"api", "admin"},
+		"scope": "articles.read articles.write",
+		"org":   "acme",
+		"roles": []string{"editor"},
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	unsigned := signJWT(t, map[string]interface{}{"alg": "none"}, claims, func([]byte) []byte { return nil })
+
+	for k, c := range []struct {
+		condition *JWTClaimsCondition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &JWTClaimsCondition{Issuer: "https://auth.example.com"}, value: unsigned, pass: true},
+		{condition: &JWTClaimsCondition{Issuer: "https://other.example.com"}, value: unsigned, pass: false},
+		{condition: &JWTClaimsCondition{Audience: "admin"}, value: "Bearer " + unsigned, pass: true},
+		{condition: &JWTClaimsCondition{Audience: "billing"}, value: unsigned, pass: false},
+		{condition: &JWTClaimsCondition{Scopes: []string{"articles.write"}}, value: unsigned, pass: true},
+		{condition: &JWTClaimsCondition{Scopes: []string{"articles.write", "articles.delete"}}, value: unsigned, pass: false},
+		{condition: &JWTClaimsCondition{Claims: map[string]interface{}{"org": "acme", "roles": "editor"}}, value: unsigned, pass: true},
+		{condition: &JWTClaimsCondition{Claims: map[string]interface{}{"org": "other"}}, value: unsigned, pass: false},
+		{condition: &JWTClaimsCondition{Scopes: []string{"read"}}, value: map[string]interface{}{"scp": []interface{}{"read"}}, pass: true},
+		{condition: &JWTClaimsCondition{}, value: "not a token", pass: false},
+		{condition: &JWTClaimsCondition{}, value: 1, pass: false},
+		{condition: &JWTClaimsCondition{KeySet: "unknown"}, value: unsigned, pass: false},
+		{condition: &JWTClaimsCondition{}, value: map[string]interface{}{"exp": float64(now.Unix())}, pass: false},
+		{condition: &JWTClaimsCondition{}, value: map[string]interface{}{"nbf": float64(now.Add(time.Minute).Unix())}, pass: false},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, r), "case %d", k)
+	}
+}
+
+func TestJWTKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("secret")
+
+	hs256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	rs256 := func(signed []byte) []byte {
+		sum := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+		require.NoError(t, err)
+		return signature
+	}
+	es256 := func(signed []byte) []byte {
+		sum := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, sum[:])
+		require.NoError(t, err)
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	es384 := func(signed []byte) []byte {
+		sum := sha512.Sum384(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, sum[:])
+		require.NoError(t, err)
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	ks := JWTKeySet{"hmac": secret, "rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}
+	claims := map[string]interface{}{"sub": "peter"}
+	for k, c := range []struct {
+		header map[string]interface{}
+		sign   func([]byte) []byte
+		valid  bool
+	}{
+		{header: map[string]interface{}{"alg": "HS256", "kid": "hmac"}, sign: hs256, valid: true},
+		{header: map[string]interface{}{"alg": "RS256", "kid": "rsa"}, sign: rs256, valid: true},
+		{header: map[string]interface{}{"alg": "ES256", "kid": "ec"}, sign: es256, valid: true},
+		{header: map[string]interface{}{"alg": "HS256", "kid": "rsa"}, sign: hs256, valid: false},
+		{header: map[string]interface{}{"alg": "RS256", "kid": "ec"}, sign: rs256, valid: false},
+		{header: map[string]interface{}{"alg": "HSE256", "kid": "hmac"}, sign: hs256, valid: false},
+		{header: map[string]interface{}{"alg": "ES384", "kid": "ec"}, sign: es384, valid: false},
+		{header: map[string]interface{}{"alg": "none", "kid": "hmac"}, sign: func([]byte) []byte { return nil }, valid: false},
+		{header: map[string]interface{}{"alg": "HS256", "kid": "unknown"}, sign: hs256, valid: false},
+		{header: map[string]interface{}{"alg": "HS256"}, sign: hs256, valid: false},
+	} {
+		verified, err := ks.Verify(signJWT(t, c.header, claims, c.sign))
+		if c.valid {
+			require.NoError(t, err, "case %d", k)
+			assert.Equal(t, "peter", verified["sub"])
+		} else {
+			assert.Error(t, err, "case %d", k)
+		}
+	}
+
+	token := signJWT(t, map[string]interface{}{"alg": "HS256"}, claims, hs256)
+	_, err = JWTKeySet{"only": secret}.Verify(token)
+	assert.NoError(t, err)
+	_, err = JWTKeySet{"only": []byte("other")}.Verify(token)
+	assert.Error(t, err)
+
+	JWTKeySets["test"] = ks.Verify
+	defer delete(JWTKeySets, "test")
+	c := &JWTClaimsCondition{KeySet: "test", Claims: map[string]interface{}{"sub": "peter"}}
+	assert.True(t, c.Fulfills(signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, claims, rs256), new(Request)))
+	assert.False(t, c.Fulfills(signJWT(t, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, claims, hs256), new(Request)))
+	assert.False(t, c.Fulfills(claims, new(Request)))
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+)
+
+// GreaterThanCondition is a condition which is fulfilled if the given number is greater than Value.
+type GreaterThanCondition struct {
+	Value float64 `json:"value"`
+}
+
+// Fulfills returns true if the given value is a number greater than GreaterThanCondition.Value.
+func (c *GreaterThanCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat(value)
+
+	return ok && f > c.Value
+}
+
+// GetName returns the condition's name.
+func (c *GreaterThanCondition) GetName() string {
+	return "GreaterThanCondition"
+}
+
+// LessThanCondition is a condition which is fulfilled if the given number is less than Value.
+type LessThanCondition struct {
+	Value float64 `json:"value"`
+}
+
+// Fulfills returns true if the given value is a number less than LessThanCondition.Value.
+func (c *LessThanCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat(value)
+
+	return ok && f < c.Value
+}
+
+// GetName returns the condition's name.
+func (c *LessThanCondition) GetName() string {
+	return "LessThanCondition"
+}
+
+// BetweenCondition is a condition which is fulfilled if the given number lies between Min and Max, both
+// inclusive.
+type BetweenCondition struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Fulfills returns true if the given value is a number within BetweenCondition.Min and BetweenCondition.Max.
+func (c *BetweenCondition) Fulfills(value interface{}, _ *Request) bool {
+	f, ok := toFloat(value)
+
+	return ok && f >= c.Min && f <= c.Max
+}
+
+// GetName returns the condition's name.
+func (c *BetweenCondition) GetName() string {
+	return "BetweenCondition"
+}
+
+// toFloat converts integers, floats and json.Number to float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
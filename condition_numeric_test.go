@@ -0,0 +1,68 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumericConditions(t *testing.T) {
+	for k, c := range []struct {
+		condition Condition
+		value     interface{}
+		pass      bool
+	}{
+		{condition: &GreaterThanCondition{Value: 18}, value: 19, pass: true},
+		{condition: &GreaterThanCondition{Value: 18}, value: 18, pass: false},
+		{condition: &GreaterThanCondition{Value: 18}, value: 18.5, pass: true},
+		{condition: &GreaterThanCondition{Value: 18}, value: json.Number("21"), pass: true},
+		{condition: &GreaterThanCondition{Value: 18}, value: "21", pass: false},
+		{condition: &GreaterThanCondition{Value: 18}, value: nil, pass: false},
+		{condition: &LessThanCondition{Value: 100}, value: int64(99), pass: true},
+		{condition: &LessThanCondition{Value: 100}, value: uint8(100), pass: false},
+		{condition: &LessThanCondition{Value: 100}, value: json.Number("abc"), pass: false},
+		{condition: &BetweenCondition{Min: 9, Max: 17}, value: 9, pass: true},
+		{condition: &BetweenCondition{Min: 9, Max: 17}, value: float32(17), pass: true},
+		{condition: &BetweenCondition{Min: 9, Max: 17}, value: 17.01, pass: false},
+		{condition: &BetweenCondition{Min: 9, Max: 17}, value: -1, pass: false},
+	} {
+		assert.Equal(t, c.pass, c.condition.Fulfills(c.value, new(Request)), "%d", k)
+	}
+}
+
+func TestNumericConditionsMarshalling(t *testing.T) {
+	cs := Conditions{
+		"age":    &GreaterThanCondition{Value: 18},
+		"amount": &LessThanCondition{Value: 100.5},
+		"hour":   &BetweenCondition{Min: 9, Max: 17},
+	}
+
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+
+	got := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &got))
+	assert.Equal(t, cs, got)
+}
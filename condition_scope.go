@@ -0,0 +1,65 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"strings"
+)
+
+// ScopeCondition is fulfilled if the scopes in the value grant all of Scopes. Scopes are hierarchical, levels
+// being separated by dots: "hydra.keys" grants "hydra.keys" and "hydra.keys.get", but not "hydra.keystore". The
+// value may be a list of scopes or a space separated string, like the scope parameter of OAuth2.
+type ScopeCondition struct {
+	Scopes []string `json:"scopes"`
+}
+
+// Fulfills returns true if the scopes in value grant all scopes of the condition.
+func (c *ScopeCondition) Fulfills(value interface{}, _ *Request) bool {
+	granted, ok := toStringSlice(value)
+	if s, isString := value.(string); isString {
+		granted, ok = strings.Fields(s), true
+	}
+	if !ok {
+		return false
+	}
+
+	for _, required := range c.Scopes {
+		if !GrantsScope(granted, required) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetName returns the condition's name.
+func (c *ScopeCondition) GetName() string {
+	return "ScopeCondition"
+}
+
+// GrantsScope returns true if one of the granted scopes equals required or is a parent of it.
+func GrantsScope(granted []string, required string) bool {
+	for _, g := range granted {
+		if g == required || (g != "" && strings.HasPrefix(required, g) && required[len(g)] == '.') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeCondition(t *testing.T) {
+	for k, c := range []struct {
+		scopes []string
+		value  interface{}
+		pass   bool
+	}{
+		{scopes: []string{"hydra.keys.get"}, value: []string{"hydra.keys"}, pass: true},
+		{scopes: []string{"hydra.keys.get"}, value: "openid hydra", pass: true},
+		{scopes: []string{"hydra.keys"}, value: "hydra.keys", pass: true},
+		{scopes: []string{"hydra.keystore"}, value: "hydra.keys", pass: false},
+		{scopes: []string{"hydra.keys"}, value: "hydra.keys.get", pass: false},
+		{scopes: []string{"hydra.keys.get", "offline"}, value: []interface{}{"hydra.keys", "offline"}, pass: true},
+		{scopes: []string{"hydra.keys.get", "offline"}, value: []interface{}{"hydra.keys"}, pass: false},
+		{scopes: []string{"hydra"}, value: []interface{}{"hydra", 1}, pass: false},
+		{scopes: []string{"hydra"}, value: "", pass: false},
+		{scopes: []string{}, value: "", pass: true},
+		{scopes: []string{"hydra"}, value: 1, pass: false},
+	} {
+		assert.Equal(t, c.pass, (&ScopeCondition{Scopes: c.scopes}).Fulfills(c.value, new(Request)), "case %d", k)
+	}
+}
+
+func TestScopeConditionMarshalling(t *testing.T) {
+	cs := Conditions{"scope": &ScopeCondition{Scopes: []string{"hydra.keys.get"}}}
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+
+	decoded := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	assert.Equal(t, cs, decoded)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEqualsSubjectCondition(t *testing.T) {
+	for _, c := range []struct {
+		value interface{}
+		pass  bool
+	}{
+		{value: "peter", pass: true},
+		{value: "max", pass: false},
+		{value: "", pass: false},
+		{value: nil, pass: false},
+		{value: []string{"peter"}, pass: false},
+	} {
+		condition := &EqualsSubjectCondition{}
+
+		assert.Equal(t, c.pass, condition.Fulfills(c.value, &Request{Subject: "peter"}), "%v", c.value)
+	}
+}
+
+func TestEqualsSubjectConditionMarshalling(t *testing.T) {
+	p := &DefaultPolicy{
+		ID:         "1",
+		Effect:     EffectAllow,
+		Conditions: Conditions{"owner": &EqualsSubjectCondition{}},
+	}
+
+	out, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	var got DefaultPolicy
+	require.NoError(t, json.Unmarshal(out, &got))
+	require.IsType(t, &EqualsSubjectCondition{}, got.Conditions["owner"])
+	assert.True(t, got.Conditions["owner"].Fulfills("peter", &Request{Subject: "peter"}))
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WebhookHTTPClient is the client WebhookCondition uses to call endpoints.
+var WebhookHTTPClient = http.DefaultClient
+
+// webhookCacheSize limits the number of results a WebhookCondition caches.
+const webhookCacheSize = 10000
+
+// WebhookCondition delegates the decision to an HTTP endpoint, so business rules can be changed without
+// recompiling. It POSTs the request and the context value as JSON:
+//
+//	{"subject": "peter", "action": "get", "resource": "articles:1", "context": {...}, "tenant": "", "value": ...}
+//
+// and is fulfilled if the endpoint responds with a 2xx status and {"fulfilled": true}. If the endpoint can not be
+// reached, times out or responds with another status, the condition is fulfilled only if FailOpen is set.
+type WebhookCondition struct {
+	URL string `json:"url"`
+
+	// Timeout is the time the endpoint may take, for example "250ms". It defaults to one second.
+	Timeout string `json:"timeout,omitempty"`
+
+	// CacheTTL is the time responses are cached for identical requests, for example "1m". Failures are never
+	// cached. Zero disables the cache.
+	CacheTTL string `json:"cacheTTL,omitempty"`
+
+	FailOpen bool `json:"failOpen,omitempty"`
+
+	cache map[string]webhookResult
+	sync.Mutex
+}
+
+type webhookResult struct {
+	fulfilled bool
+	expires   time.Time
+}
+
+type webhookPayload struct {
+	*Request
+	Value interface{} `json:"value"`
+}
+
+// Fulfills returns the endpoint's decision for the request.
+func (c *WebhookCondition) Fulfills(value interface{}, r *Request) bool {
+	payload, err := json.Marshal(&webhookPayload{Request: r, Value: value})
+	if err != nil {
+		return c.FailOpen
+	}
+
+	ttl, err := parseDuration(c.CacheTTL, 0)
+	if err != nil {
+		return c.FailOpen
+	}
+
+	var key string
+	if ttl > 0 {
+		if key, err = webhookCacheKey(value, r); err != nil {
+			return c.FailOpen
+		}
+
+		c.Lock()
+		result, ok := c.cache[key]
+		c.Unlock()
+		if ok && time.Now().Before(result.expires) {
+			return result.fulfilled
+		}
+	}
+
+	fulfilled, err := c.call(payload)
+	if err != nil {
+		return c.FailOpen
+	}
+
+	if ttl > 0 {
+		c.store(key, webhookResult{fulfilled: fulfilled, expires: time.Now().Add(ttl)})
+	}
+	return fulfilled
+}
+
+// webhookCacheKey identifies requests by their subject, action, resource, tenant, context and the value. The time
+// is left out, because Ladon stamps every request with the current time.
+func webhookCacheKey(value interface{}, r *Request) (string, error) {
+	untimed := *r
+	untimed.Time = time.Time{}
+
+	key, err := json.Marshal(&webhookPayload{Request: &untimed, Value: value})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(key), nil
+}
+
+func (c *WebhookCondition) call(payload []byte) (bool, error) {
+	timeout, err := parseDuration(c.Timeout, time.Second)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := WebhookHTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return false, errors.Errorf("Webhook responded with status %d", res.StatusCode)
+	}
+
+	var decision struct {
+		Fulfilled bool `json:"fulfilled"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&decision); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return decision.Fulfilled, nil
+}
+
+// store caches a result. If the cache is full, expired results are evicted, or all if none expired.
+func (c *WebhookCondition) store(key string, result webhookResult) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.cache) >= webhookCacheSize {
+		now := time.Now()
+		for k, r := range c.cache {
+			if !now.Before(r.expires) {
+				delete(c.cache, k)
+			}
+		}
+	}
+
+	if c.cache == nil || len(c.cache) >= webhookCacheSize {
+		c.cache = map[string]webhookResult{}
+	}
+	c.cache[key] = result
+}
+
+// GetName returns the condition's name.
+func (c *WebhookCondition) GetName() string {
+	return "WebhookCondition"
+}
+
+func parseDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	return d, errors.WithStack(err)
+}
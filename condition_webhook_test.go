@@ -0,0 +1,90 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookCondition(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		var payload struct {
+			Subject string      `json:"subject"`
+			Value   interface{} `json:"value"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		switch payload.Subject {
+		case "slow":
+			time.Sleep(time.Millisecond * 100)
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"fulfilled": payload.Subject == "peter" && payload.Value == "premium"})
+	}))
+	defer ts.Close()
+
+	c := &WebhookCondition{URL: ts.URL, Timeout: "50ms"}
+	assert.True(t, c.Fulfills("premium", &Request{Subject: "peter"}))
+	assert.False(t, c.Fulfills("free", &Request{Subject: "peter"}))
+	assert.False(t, c.Fulfills("premium", &Request{Subject: "ken"}))
+	assert.False(t, c.Fulfills("premium", &Request{Subject: "broken"}))
+	assert.False(t, c.Fulfills("premium", &Request{Subject: "slow"}))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+
+	c.FailOpen = true
+	assert.True(t, c.Fulfills("premium", &Request{Subject: "broken"}))
+	assert.True(t, c.Fulfills("premium", &Request{Subject: "slow"}))
+	assert.False(t, c.Fulfills("premium", &Request{Subject: "ken"}))
+	assert.True(t, (&WebhookCondition{URL: ts.URL, Timeout: "soon", FailOpen: true}).Fulfills("premium", &Request{Subject: "ken"}))
+
+	atomic.StoreInt32(&calls, 0)
+	c = &WebhookCondition{URL: ts.URL, CacheTTL: "1m"}
+	for i := 0; i < 3; i++ {
+		// Ladon stamps every request with the current time, which must not defeat the cache.
+		assert.True(t, c.Fulfills("premium", &Request{Subject: "peter", Time: time.Now()}))
+		assert.False(t, c.Fulfills("premium", &Request{Subject: "broken"}))
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestWebhookConditionMarshalling(t *testing.T) {
+	cs := Conditions{"rule": &WebhookCondition{URL: "https://rules.example.com/check", Timeout: "250ms", CacheTTL: "1m", FailOpen: true}}
+	out, err := json.Marshal(cs)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"options":{"url":"https://rules.example.com/check","timeout":"250ms","cacheTTL":"1m","failOpen":true}`)
+
+	decoded := Conditions{}
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	assert.Equal(t, cs, decoded)
+}
@@ -25,3 +25,10 @@ const AllowAccess = "allow"
 
 // DenyAccess should be used as effect for policies that deny access.
 const DenyAccess = "deny"
+
+// DefaultStartDelimiter and DefaultEndDelimiter enclose the regular expressions in templates of policies which
+// do not set their own delimiters.
+const (
+	DefaultStartDelimiter byte = '<'
+	DefaultEndDelimiter   byte = '>'
+)
@@ -20,5 +20,127 @@
 
 package ladon
 
-// Context is used as request's context.
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Context is used as request's context. Its getters convert values to the requested type, accepting both the
+// native Go types and the types encoding/json decodes them to, so a context survives a JSON round trip.
 type Context map[string]interface{}
+
+// GetString returns the string stored at key.
+func (c Context) GetString(key string) (string, bool) {
+	s, ok := c[key].(string)
+	return s, ok
+}
+
+// GetBool returns the boolean stored at key.
+func (c Context) GetBool(key string) (bool, bool) {
+	b, ok := c[key].(bool)
+	return b, ok
+}
+
+// GetFloat returns the number stored at key.
+func (c Context) GetFloat(key string) (float64, bool) {
+	return toFloat(c[key])
+}
+
+// GetInt returns the integer stored at key. Floats are accepted if they have no fractional part.
+func (c Context) GetInt(key string) (int64, bool) {
+	return toInt(c[key])
+}
+
+// GetTime returns the point in time stored at key, either a time.Time or a RFC 3339 formatted string.
+func (c Context) GetTime(key string) (time.Time, bool) {
+	return toTime(c[key])
+}
+
+// GetStringSlice returns the list of strings stored at key.
+func (c Context) GetStringSlice(key string) ([]string, bool) {
+	return toStringSlice(c[key])
+}
+
+// Validate returns an error listing the condition keys of the policies which are missing in c, so callers can
+// reject incomplete requests instead of having them denied by conditions that can never be fulfilled.
+func (c Context) Validate(policies ...Policy) error {
+	missing := map[string]bool{}
+	for _, p := range policies {
+		for key := range p.GetConditions() {
+			if _, ok := c[key]; !ok {
+				missing[key] = true
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(missing))
+	for key := range missing {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return errors.Errorf("Context is missing the keys %s", strings.Join(keys, ", "))
+}
+
+// toInt converts integers, integral floats and json.Number to int64.
+func toInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	}
+
+	f, ok := toFloat(value)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// toTime converts time.Time and RFC 3339 formatted strings to time.Time.
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// toStringSlice converts []string and []interface{} containing only strings to []string.
+func toStringSlice(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []interface{}:
+		out := make([]string, len(v))
+		for k, s := range v {
+			var ok bool
+			if out[k], ok = s.(string); !ok {
+				return nil, false
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ContextEnricher derives context attributes which callers do not supply themselves, for example a geo location
+// from the client's IP or the subject's department from a directory.
+type ContextEnricher interface {
+	// Enrich returns the attributes to add to the request's context.
+	Enrich(ctx context.Context, r *Request) (Context, error)
+}
+
+// ContextEnricherFunc adapts a function to the ContextEnricher interface.
+type ContextEnricherFunc func(ctx context.Context, r *Request) (Context, error)
+
+// Enrich calls f.
+func (f ContextEnricherFunc) Enrich(ctx context.Context, r *Request) (Context, error) {
+	return f(ctx, r)
+}
+
+// EnricherRegistration configures a registered ContextEnricher.
+type EnricherRegistration struct {
+	Enricher ContextEnricher
+
+	// Order defines when the enricher runs. Enrichers with a lower order run first, enrichers with the same
+	// order run sorted by name. Later enrichers see the attributes added by earlier ones.
+	Order int
+
+	// Timeout limits how long the enricher may take. Zero means no limit.
+	Timeout time.Duration
+
+	// IgnoreErrors makes failures and timeouts of the enricher skip its attributes instead of failing the
+	// access request.
+	IgnoreErrors bool
+}
+
+// ContextEnrichers is a registry of context enrichers by name.
+type ContextEnrichers map[string]EnricherRegistration
+
+// Register adds an enricher to the registry.
+func (es ContextEnrichers) Register(name string, e ContextEnricher, order int, timeout time.Duration) {
+	es[name] = EnricherRegistration{Enricher: e, Order: order, Timeout: timeout}
+}
+
+// Enrich runs all enrichers and returns a copy of r with their attributes added to the context. Enriched
+// attributes overwrite values supplied by the caller, so callers can not spoof derived attributes.
+func (es ContextEnrichers) Enrich(ctx context.Context, r *Request) (*Request, error) {
+	if len(es) == 0 {
+		return r, nil
+	}
+
+	names := make([]string, 0, len(es))
+	for name := range es {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if es[names[i]].Order != es[names[j]].Order {
+			return es[names[i]].Order < es[names[j]].Order
+		}
+		return names[i] < names[j]
+	})
+
+	enriched := *r
+	enriched.Context = make(Context, len(r.Context))
+	for k, v := range r.Context {
+		enriched.Context[k] = v
+	}
+
+	for _, name := range names {
+		e := es[name]
+		attributes, err := e.run(ctx, &enriched)
+		if err != nil {
+			if e.IgnoreErrors {
+				continue
+			}
+			return nil, errors.Wrapf(err, "context enricher %s failed", name)
+		}
+
+		for k, v := range attributes {
+			enriched.Context[k] = v
+		}
+	}
+
+	return &enriched, nil
+}
+
+type enrichResult struct {
+	attributes Context
+	err        error
+}
+
+func (e EnricherRegistration) run(ctx context.Context, r *Request) (Context, error) {
+	if e.Timeout <= 0 {
+		return e.Enricher.Enrich(ctx, r)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	// The enricher works on its own copy of the request, because it may still be running after a timeout.
+	snapshot := *r
+	snapshot.Context = make(Context, len(r.Context))
+	for k, v := range r.Context {
+		snapshot.Context[k] = v
+	}
+
+	result := make(chan enrichResult, 1)
+	go func() {
+		attributes, err := e.Enricher.Enrich(ctx, &snapshot)
+		result <- enrichResult{attributes: attributes, err: err}
+	}()
+
+	select {
+	case res := <-result:
+		return res.attributes, res.err
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
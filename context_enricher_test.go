@@ -0,0 +1,97 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestContextEnrichers(t *testing.T) {
+	var order []string
+	es := ContextEnrichers{}
+	es.Register("department", ContextEnricherFunc(func(_ context.Context, r *Request) (Context, error) {
+		order = append(order, "department")
+		return Context{"department": "sales", "region": r.Context["country"]}, nil
+	}), 10, 0)
+	es.Register("geo", ContextEnricherFunc(func(_ context.Context, r *Request) (Context, error) {
+		order = append(order, "geo")
+		return Context{"country": "DE"}, nil
+	}), 0, time.Second)
+
+	r := &Request{Subject: "peter", Context: Context{"department": "it"}}
+	enriched, err := es.Enrich(context.Background(), r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"geo", "department"}, order)
+	assert.Equal(t, Context{"department": "sales", "country": "DE", "region": "DE"}, enriched.Context)
+	assert.Equal(t, Context{"department": "it"}, r.Context)
+
+	es["slow"] = EnricherRegistration{
+		Enricher: ContextEnricherFunc(func(ctx context.Context, r *Request) (Context, error) {
+			time.Sleep(time.Second)
+			return Context{"slow": true}, nil
+		}),
+		Order:   20,
+		Timeout: time.Millisecond * 10,
+	}
+	_, err = es.Enrich(context.Background(), r)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	slow := es["slow"]
+	slow.IgnoreErrors = true
+	es["slow"] = slow
+	enriched, err = es.Enrich(context.Background(), r)
+	require.NoError(t, err)
+	assert.NotContains(t, enriched.Context, "slow")
+}
+
+func TestLadonEnrichers(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:         "1",
+		Subjects:   []string{"<.*>"},
+		Resources:  []string{"<.*>"},
+		Actions:    []string{"get"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{"department": &StringEqualCondition{Equals: "sales"}},
+	}))
+
+	departments := map[string]string{"peter": "sales", "max": "it"}
+	warden := &Ladon{Manager: m, Enrichers: ContextEnrichers{}}
+	warden.Enrichers.Register("directory", ContextEnricherFunc(func(_ context.Context, r *Request) (Context, error) {
+		if r.Subject == "ken" {
+			return nil, errors.New("directory unavailable")
+		}
+		return Context{"department": departments[r.Subject]}, nil
+	}), 0, 0)
+
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "max", Action: "get", Resource: "articles:1", Context: Context{"department": "sales"}}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:1"}))
+}
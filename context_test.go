@@ -0,0 +1,100 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextGetters(t *testing.T) {
+	at := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	original := Context{
+		"name":   "peter",
+		"admin":  true,
+		"age":    42,
+		"ratio":  0.5,
+		"at":     at,
+		"groups": []string{"admins", "editors"},
+	}
+
+	// The getters return the same values before and after a JSON round trip.
+	raw, err := json.Marshal(original)
+	require.NoError(t, err)
+	var decoded Context
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+
+	for _, c := range []Context{original, decoded} {
+		s, ok := c.GetString("name")
+		assert.True(t, ok)
+		assert.Equal(t, "peter", s)
+
+		b, ok := c.GetBool("admin")
+		assert.True(t, ok)
+		assert.True(t, b)
+
+		i, ok := c.GetInt("age")
+		assert.True(t, ok)
+		assert.Equal(t, int64(42), i)
+
+		f, ok := c.GetFloat("ratio")
+		assert.True(t, ok)
+		assert.Equal(t, 0.5, f)
+
+		tm, ok := c.GetTime("at")
+		assert.True(t, ok)
+		assert.True(t, at.Equal(tm))
+
+		groups, ok := c.GetStringSlice("groups")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"admins", "editors"}, groups)
+
+		_, ok = c.GetInt("ratio")
+		assert.False(t, ok)
+		_, ok = c.GetString("age")
+		assert.False(t, ok)
+		_, ok = c.GetTime("missing")
+		assert.False(t, ok)
+	}
+
+	_, ok := Context{"groups": []interface{}{"admins", 1}}.GetStringSlice("groups")
+	assert.False(t, ok)
+	i, ok := Context{"n": json.Number("7")}.GetInt("n")
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), i)
+}
+
+func TestContextValidate(t *testing.T) {
+	policies := Policies{
+		&DefaultPolicy{ID: "1", Conditions: Conditions{"ip": &CIDRCondition{CIDR: "10.0.0.0/8"}}},
+		&DefaultPolicy{ID: "2", Conditions: Conditions{"owner": &EqualsSubjectCondition{}, "ip": &CIDRCondition{CIDR: "0.0.0.0/0"}}},
+		&DefaultPolicy{ID: "3"},
+	}
+
+	assert.NoError(t, Context{"ip": "10.0.0.1", "owner": "peter"}.Validate(policies...))
+	assert.EqualError(t, Context{}.Validate(policies...), "Context is missing the keys ip, owner")
+	assert.EqualError(t, Context{"ip": "10.0.0.1"}.Validate(policies...), "Context is missing the keys owner")
+	assert.NoError(t, Context{}.Validate())
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DecisionEvent is a decision ready to be exported.
+type DecisionEvent struct {
+	Record *AuditRecord
+
+	// Payload is the record encoded by the exporter's DecisionFormatter.
+	Payload []byte
+}
+
+// DecisionFormatter encodes decisions for a SIEM.
+type DecisionFormatter interface {
+	Format(record *AuditRecord) ([]byte, error)
+}
+
+// DecisionSink delivers batches of decisions, for example to syslog or Kafka.
+type DecisionSink interface {
+	Export(ctx context.Context, events []DecisionEvent) error
+}
+
+// JSONFormatter encodes decisions as single line JSON objects.
+type JSONFormatter struct{}
+
+// Format encodes the record as JSON.
+func (JSONFormatter) Format(record *AuditRecord) ([]byte, error) {
+	out, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+// CEFFormatter encodes decisions in the ArcSight Common Event Format, which is understood by most SIEMs.
+type CEFFormatter struct {
+	// Vendor, Product and Version identify the device in the CEF header. They default to ORY, Ladon and 1.0.
+	Vendor, Product, Version string
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// Format encodes the record as a CEF line. Granted requests have the signature "allow" and severity 3, denied ones
+// have the signature "deny" and severity 6.
+func (f CEFFormatter) Format(record *AuditRecord) ([]byte, error) {
+	signature, name, severity := "allow", "Access granted", 3
+	if !record.Allowed {
+		signature, name, severity = "deny", "Access denied", 6
+	}
+
+	extension := []string{
+		"rt=" + fmt.Sprint(record.Timestamp.UnixNano()/int64(time.Millisecond)),
+		"suser=" + cefExtensionEscaper.Replace(record.Request.Subject),
+		"act=" + cefExtensionEscaper.Replace(record.Request.Action),
+		"request=" + cefExtensionEscaper.Replace(record.Request.Resource),
+		"outcome=" + signature,
+		"cs1Label=policies",
+		"cs1=" + cefExtensionEscaper.Replace(strings.Join(record.Policies, ",")),
+	}
+	if record.Request.Tenant != "" {
+		extension = append(extension, "cs2Label=tenant", "cs2="+cefExtensionEscaper.Replace(record.Request.Tenant))
+	}
+
+	return []byte(fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(orDefault(f.Vendor, "ORY")),
+		cefHeaderEscaper.Replace(orDefault(f.Product, "Ladon")),
+		cefHeaderEscaper.Replace(orDefault(f.Version, "1.0")),
+		signature, name, severity, strings.Join(extension, " "),
+	)), nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// DecisionExporter is an AuditLogger streaming decisions to a DecisionSink. Decisions are queued and exported in
+// batches by a background worker, so exporting never delays a decision unless Block is set and the queue is full.
+// Call Close to flush the queue on shutdown.
+type DecisionExporter struct {
+	Sink      DecisionSink
+	Formatter DecisionFormatter
+
+	// BatchSize is the maximum number of decisions per export. Defaults to 100.
+	BatchSize int
+
+	// FlushInterval is the maximum time a decision stays queued. Defaults to one second.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of decisions which may be queued. Defaults to 10000.
+	QueueSize int
+
+	// Block makes the warden wait for queue space when the sink falls behind. By default, decisions which do not
+	// fit into the queue are dropped and reported to OnDrop.
+	Block bool
+
+	// OnDrop is called for every decision which is dropped because the queue is full.
+	OnDrop func(record *AuditRecord)
+
+	// OnError is called if a decision can not be formatted or a batch can not be exported. Batches are not retried.
+	OnError func(err error, records []*AuditRecord)
+
+	start  sync.Once
+	mutex  sync.RWMutex
+	closed bool
+	queue  chan *AuditRecord
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// closing releases LogDecision calls blocked on a full queue once Close was called, so Close can take the lock.
+	stop    sync.Once
+	closing chan struct{}
+}
+
+// NewDecisionExporter returns a DecisionExporter with the default batching and backpressure settings.
+func NewDecisionExporter(sink DecisionSink, formatter DecisionFormatter) *DecisionExporter {
+	return &DecisionExporter{Sink: sink, Formatter: formatter}
+}
+
+// LogDecision queues the decision for export.
+func (e *DecisionExporter) LogDecision(record *AuditRecord) {
+	e.start.Do(e.run)
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if e.closed {
+		e.drop(record)
+		return
+	}
+
+	if e.Block {
+		select {
+		case e.queue <- record:
+		case <-e.closing:
+			e.drop(record)
+		}
+		return
+	}
+
+	select {
+	case e.queue <- record:
+	default:
+		e.drop(record)
+	}
+}
+
+// LogRejectedAccessRequest queues a denial. Ladon calls LogDecision instead.
+func (e *DecisionExporter) LogRejectedAccessRequest(r *Request, pool Policies, deciders Policies) {
+	e.LogDecision(newAuditRecord(r, deciders, false))
+}
+
+// LogGrantedAccessRequest queues a grant. Ladon calls LogDecision instead.
+func (e *DecisionExporter) LogGrantedAccessRequest(r *Request, pool Policies, deciders Policies) {
+	e.LogDecision(newAuditRecord(r, deciders, true))
+}
+
+// Close stops accepting decisions and exports the queued ones. If ctx is done before the queue is flushed, the
+// running export is canceled and the remaining decisions are dropped. Decisions waiting for queue space because
+// Block is set are dropped as well.
+func (e *DecisionExporter) Close(ctx context.Context) error {
+	e.start.Do(e.run)
+	e.stop.Do(func() { close(e.closing) })
+
+	e.mutex.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mutex.Unlock()
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		e.cancel()
+		<-e.done
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func (e *DecisionExporter) drop(record *AuditRecord) {
+	if e.OnDrop != nil {
+		e.OnDrop(record)
+	}
+}
+
+func (e *DecisionExporter) run() {
+	size, interval, queue := e.BatchSize, e.FlushInterval, e.QueueSize
+	if size <= 0 {
+		size = 100
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if queue <= 0 {
+		queue = 10000
+	}
+
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(context.Background())
+	e.queue = make(chan *AuditRecord, queue)
+	e.done = make(chan struct{})
+	e.closing = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		batch := make([]*AuditRecord, 0, size)
+		for {
+			select {
+			case record, ok := <-e.queue:
+				if !ok {
+					e.export(ctx, batch)
+					return
+				}
+
+				if batch = append(batch, record); len(batch) >= size {
+					e.export(ctx, batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				e.export(ctx, batch)
+				batch = batch[:0]
+			}
+		}
+	}()
+}
+
+func (e *DecisionExporter) export(ctx context.Context, batch []*AuditRecord) {
+	if len(batch) == 0 {
+		return
+	} else if ctx.Err() != nil {
+		for _, record := range batch {
+			e.drop(record)
+		}
+		return
+	}
+
+	events := make([]DecisionEvent, 0, len(batch))
+	for _, record := range batch {
+		payload, err := e.Formatter.Format(record)
+		if err != nil {
+			e.fail(err, []*AuditRecord{record})
+			continue
+		}
+		events = append(events, DecisionEvent{Record: record, Payload: payload})
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	if err := e.Sink.Export(ctx, events); err != nil {
+		records := make([]*AuditRecord, len(events))
+		for k, event := range events {
+			records[k] = event.Record
+		}
+		e.fail(err, records)
+	}
+}
+
+func (e *DecisionExporter) fail(err error, records []*AuditRecord) {
+	if e.OnError != nil {
+		e.OnError(err, records)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type recordingSink struct {
+	batches [][]DecisionEvent
+	block   chan struct{}
+	err     error
+	sync.Mutex
+}
+
+func (s *recordingSink) Export(ctx context.Context, events []DecisionEvent) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.batches = append(s.batches, events)
+	return s.err
+}
+
+func (s *recordingSink) payloads() (out []string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, batch := range s.batches {
+		for _, event := range batch {
+			out = append(out, string(event.Payload))
+		}
+	}
+	return out
+}
+
+type recordingProducer struct {
+	topic    string
+	messages []KafkaMessage
+}
+
+func (p *recordingProducer) Produce(ctx context.Context, topic string, messages []KafkaMessage) error {
+	p.topic = topic
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+var exportedRecord = &AuditRecord{
+	Request: Request{
+		Subject:  "peter|admin",
+		Resource: "articles:1",
+		Action:   "read=all",
+		Tenant:   "acme",
+	},
+	Allowed:   false,
+	Policies:  []string{"deny-peter", "deny-all"},
+	Timestamp: time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC),
+}
+
+func TestCEFFormatter(t *testing.T) {
+	out, err := CEFFormatter{Product: "Ladon|Warden"}.Format(exportedRecord)
+	require.NoError(t, err)
+	assert.Equal(t, `CEF:0|ORY|Ladon\|Warden|1.0|deny|Access denied|6|rt=1514800800000 suser=peter|admin act=read\=all `+
+		`request=articles:1 outcome=deny cs1Label=policies cs1=deny-peter,deny-all cs2Label=tenant cs2=acme`, string(out))
+}
+
+func TestJSONFormatter(t *testing.T) {
+	out, err := JSONFormatter{}.Format(exportedRecord)
+	require.NoError(t, err)
+
+	var decoded AuditRecord
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	assert.Equal(t, exportedRecord.Policies, decoded.Policies)
+	assert.Equal(t, exportedRecord.Request.Subject, decoded.Request.Subject)
+}
+
+func TestDecisionExporter(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:        "allow-peter",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"read"},
+		Effect:    AllowAccess,
+	}))
+
+	sink := new(recordingSink)
+	exporter := NewDecisionExporter(sink, CEFFormatter{})
+	exporter.BatchSize = 2
+	exporter.FlushInterval = time.Hour
+
+	warden := &Ladon{Manager: m, AuditLogger: exporter}
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles:1", Action: "read"}))
+	require.Error(t, warden.IsAllowed(&Request{Subject: "ken", Resource: "articles:1", Action: "read"}))
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles:2", Action: "read"}))
+
+	require.NoError(t, exporter.Close(context.Background()))
+	require.Len(t, sink.batches, 2, "the last decision is flushed on close")
+	assert.Len(t, sink.batches[0], 2)
+
+	payloads := sink.payloads()
+	require.Len(t, payloads, 3)
+	assert.Contains(t, payloads[0], "|allow|")
+	assert.Contains(t, payloads[1], "|deny|")
+	assert.Contains(t, payloads[2], "request=articles:2")
+
+	var dropped int
+	exporter.OnDrop = func(*AuditRecord) { dropped++ }
+	exporter.LogDecision(exportedRecord)
+	assert.Equal(t, 1, dropped, "decisions are dropped after close")
+}
+
+func TestDecisionExporterBackpressure(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+
+	var dropped []*AuditRecord
+	exporter := &DecisionExporter{
+		Sink:      sink,
+		Formatter: JSONFormatter{},
+		BatchSize: 1,
+		QueueSize: 1,
+		OnDrop:    func(record *AuditRecord) { dropped = append(dropped, record) },
+	}
+
+	first, second, third := &AuditRecord{}, &AuditRecord{}, &AuditRecord{}
+	exporter.LogDecision(first)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		// Wait for the worker to pick up the first decision, which then blocks in the sink.
+		exporter.LogDecision(second)
+		if len(dropped) == 0 {
+			break
+		}
+		dropped = nil
+	}
+
+	exporter.LogDecision(third)
+	require.Len(t, dropped, 1)
+	assert.True(t, dropped[0] == third)
+
+	close(sink.block)
+	require.NoError(t, exporter.Close(context.Background()))
+	assert.Len(t, sink.payloads(), 2)
+}
+
+func TestDecisionExporterCloseBlocked(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	exporter := &DecisionExporter{Sink: sink, Formatter: JSONFormatter{}, BatchSize: 1, QueueSize: 1, Block: true}
+
+	// The first decision blocks in the sink, the second fills the queue and the third waits for queue space.
+	logged := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			exporter.LogDecision(&AuditRecord{})
+		}
+		close(logged)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	closed := make(chan error)
+	go func() { closed <- exporter.Close(ctx) }()
+	select {
+	case err := <-closed:
+		assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	case <-time.After(time.Second):
+		t.Fatal("Close ignored the deadline")
+	}
+	<-logged
+}
+
+func TestDecisionExporterErrors(t *testing.T) {
+	var failed []*AuditRecord
+	exporter := &DecisionExporter{
+		Sink:      &recordingSink{err: errors.New("sink unavailable")},
+		Formatter: JSONFormatter{},
+		OnError:   func(err error, records []*AuditRecord) { failed = append(failed, records...) },
+	}
+
+	exporter.LogDecision(exportedRecord)
+	require.NoError(t, exporter.Close(context.Background()))
+	require.Len(t, failed, 1)
+	assert.True(t, failed[0] == exportedRecord)
+}
+
+func TestSyslogSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var messages []string
+		r := bufio.NewReader(conn)
+		for len(messages) < 2 {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				break
+			}
+
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			if _, err := r.Read(msg); err != nil {
+				break
+			}
+			messages = append(messages, string(msg))
+		}
+		received <- messages
+	}()
+
+	sink := NewSyslogSink("tcp", l.Addr().String())
+	sink.Hostname = "warden-1"
+	defer sink.Close()
+
+	allowed := *exportedRecord
+	allowed.Allowed = true
+	require.NoError(t, sink.Export(context.Background(), []DecisionEvent{
+		{Record: exportedRecord, Payload: []byte("denied")},
+		{Record: &allowed, Payload: []byte("granted")},
+	}))
+
+	messages := <-received
+	require.Len(t, messages, 2)
+	assert.True(t, strings.HasPrefix(messages[0], "<84>1 2018-01-01T10:00:00Z warden-1 ladon "), messages[0])
+	assert.True(t, strings.HasSuffix(messages[0], " - - denied"), messages[0])
+	assert.True(t, strings.HasPrefix(messages[1], "<86>1 "), messages[1])
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := new(recordingProducer)
+	require.NoError(t, NewKafkaSink(producer, "decisions").Export(context.Background(), []DecisionEvent{
+		{Record: exportedRecord, Payload: []byte("denied")},
+	}))
+
+	assert.Equal(t, "decisions", producer.topic)
+	assert.Equal(t, []KafkaMessage{{Key: []byte("peter|admin"), Value: []byte("denied")}}, producer.messages)
+}
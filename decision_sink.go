@@ -0,0 +1,205 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SyslogSink sends decisions to a syslog server using RFC 5424 messages. Over stream connections (tcp, tcp4, tcp6,
+// unix) messages are framed by octet counting as described in RFC 6587, otherwise every message is sent in its own
+// datagram. Granted requests are logged with severity informational, denied ones with severity warning, both with
+// facility authpriv.
+type SyslogSink struct {
+	Network string
+	Address string
+
+	// Tag is the APP-NAME of the messages. Defaults to ladon.
+	Tag string
+
+	// Hostname is the HOSTNAME of the messages. Defaults to the host name reported by the kernel.
+	Hostname string
+
+	// Dialer is used to connect to the server. Defaults to a net.Dialer with a timeout of five seconds.
+	Dialer interface {
+		DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	}
+
+	conn net.Conn
+	sync.Mutex
+}
+
+// NewSyslogSink returns a SyslogSink sending to address.
+func NewSyslogSink(network, address string) *SyslogSink {
+	return &SyslogSink{Network: network, Address: address}
+}
+
+const (
+	syslogFacilityAuthPriv = 10
+	syslogSeverityWarning  = 4
+	syslogSeverityInfo     = 6
+)
+
+// Export sends the events. The connection is established lazily and re-established after a failed write.
+func (s *SyslogSink) Export(ctx context.Context, events []DecisionEvent) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		dialer := s.Dialer
+		if dialer == nil {
+			dialer = &net.Dialer{Timeout: 5 * time.Second}
+		}
+
+		conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		s.conn = conn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	} else {
+		s.conn.SetWriteDeadline(time.Time{})
+	}
+
+	stream := strings.HasPrefix(s.Network, "tcp") || s.Network == "unix"
+	hostname := s.hostname()
+
+	var buf bytes.Buffer
+	for _, event := range events {
+		msg := s.message(hostname, event)
+		if !stream {
+			if _, err := s.conn.Write(msg); err != nil {
+				return s.reset(err)
+			}
+			continue
+		}
+
+		fmt.Fprintf(&buf, "%d ", len(msg))
+		buf.Write(msg)
+	}
+
+	if buf.Len() > 0 {
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			return s.reset(err)
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSink) message(hostname string, event DecisionEvent) []byte {
+	severity := syslogSeverityInfo
+	if !event.Record.Allowed {
+		severity = syslogSeverityWarning
+	}
+
+	timestamp := event.Record.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	header := fmt.Sprintf("<%d>1 %s %s %s %d - - ",
+		syslogFacilityAuthPriv*8+severity,
+		timestamp.UTC().Format(time.RFC3339Nano),
+		hostname,
+		orDefault(s.Tag, "ladon"),
+		os.Getpid(),
+	)
+	return append([]byte(header), event.Payload...)
+}
+
+func (s *SyslogSink) hostname() string {
+	if s.Hostname != "" {
+		return s.Hostname
+	} else if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "-"
+}
+
+func (s *SyslogSink) reset(err error) error {
+	s.conn.Close()
+	s.conn = nil
+	return errors.WithStack(err)
+}
+
+// Close closes the connection to the server.
+func (s *SyslogSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return errors.WithStack(err)
+}
+
+// KafkaMessage is a message produced to Kafka.
+type KafkaMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// KafkaProducer is the subset of a Kafka client needed by KafkaSink, usually a thin adapter around sarama,
+// franz-go or confluent-kafka-go.
+type KafkaProducer interface {
+	// Produce writes messages to topic and returns once they were acknowledged.
+	Produce(ctx context.Context, topic string, messages []KafkaMessage) error
+}
+
+// KafkaSink produces decisions to a Kafka topic. Messages are keyed by subject, so all decisions on a subject's
+// requests end up in the same partition and keep their order.
+type KafkaSink struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+// NewKafkaSink returns a KafkaSink producing to topic.
+func NewKafkaSink(producer KafkaProducer, topic string) *KafkaSink {
+	return &KafkaSink{Producer: producer, Topic: topic}
+}
+
+// Export produces the events as one batch.
+func (s *KafkaSink) Export(ctx context.Context, events []DecisionEvent) error {
+	messages := make([]KafkaMessage, len(events))
+	for k, event := range events {
+		messages[k] = KafkaMessage{Key: []byte(event.Record.Request.Subject), Value: event.Payload}
+	}
+
+	if err := s.Producer.Produce(ctx, s.Topic, messages); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
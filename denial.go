@@ -0,0 +1,118 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// DenialReason tells why Ladon denied a request.
+type DenialReason string
+
+const (
+	// DenialReasonPolicy means that a policy explicitly denied the request.
+	DenialReasonPolicy DenialReason = "policy"
+
+	// DenialReasonNoMatch means that no policy allowed the request.
+	DenialReasonNoMatch DenialReason = "no_match"
+
+	// DenialReasonCondition means that a policy would have allowed the request, but one of its conditions was not
+	// fulfilled.
+	DenialReasonCondition DenialReason = "condition"
+)
+
+// DenialError is returned by Ladon if it denies a request. It tells why the request was denied, so API layers can
+// return actionable responses, and is found with AsDenialError:
+//
+//	if denial := ladon.AsDenialError(err); denial != nil && denial.Reason == ladon.DenialReasonCondition {
+//		// ask the client to supply denial.ConditionKey
+//	}
+//
+// errors.Cause returns ErrRequestForcefullyDenied or ErrRequestDenied, as before.
+type DenialError struct {
+	// Reason tells why the request was denied.
+	Reason DenialReason `json:"reason"`
+
+	// PolicyID is the ID of the policy which denied the request, or of the policy whose condition failed.
+	PolicyID string `json:"policy,omitempty"`
+
+	// ConditionKey is the key of the condition which failed. If several conditions of the policy failed, it is
+	// one of them.
+	ConditionKey string `json:"condition,omitempty"`
+
+	err error
+}
+
+// AsDenialError returns the DenialError among the causes of err, or nil if err is not a denial. Unlike errors.As, it
+// follows the causes of errors wrapped with github.com/pkg/errors.
+func AsDenialError(err error) *DenialError {
+	for err != nil {
+		if denial, ok := err.(*DenialError); ok {
+			return denial
+		}
+
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+		err = c.Cause()
+	}
+	return nil
+}
+
+func newDenialError(reason DenialReason, p Policy, key string, err error) *DenialError {
+	d := &DenialError{Reason: reason, ConditionKey: key, err: err}
+	if p != nil {
+		d.PolicyID = p.GetID()
+	}
+	return d
+}
+
+// Error returns the message of the underlying error.
+func (e *DenialError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *DenialError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the underlying error, for errors.Is and errors.As.
+func (e *DenialError) Unwrap() error {
+	return e.err
+}
+
+// Is returns true if target is the cause of the error, so errors.Is finds ErrRequestDenied and
+// ErrRequestForcefullyDenied.
+func (e *DenialError) Is(target error) bool {
+	return errors.Cause(e.err) == target
+}
+
+// Format formats the underlying error, so "%+v" prints its stack trace.
+func (e *DenialError) Format(s fmt.State, verb rune) {
+	if f, ok := e.err.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+	fmt.Fprint(s, e.err.Error())
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestDenialError(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "allow-owner", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"update"}, Effect: AllowAccess,
+			Conditions: Conditions{"owner": &EqualsSubjectCondition{}}},
+		{ID: "allow-read", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: AllowAccess},
+		{ID: "deny-ken", Subjects: []string{"ken"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: DenyAccess,
+			Conditions: Conditions{"weekend": &BooleanCondition{BooleanValue: true}}},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+	warden := &Ladon{Manager: m}
+
+	for k, tc := range []struct {
+		r     *Request
+		cause error
+		want  DenialError
+	}{
+		{
+			r:     &Request{Subject: "ken", Action: "get", Resource: "articles:1", Context: Context{"weekend": true}},
+			cause: ErrRequestForcefullyDenied,
+			want:  DenialError{Reason: DenialReasonPolicy, PolicyID: "deny-ken"},
+		},
+		{
+			r:     &Request{Subject: "peter", Action: "delete", Resource: "articles:1"},
+			cause: ErrRequestDenied,
+			want:  DenialError{Reason: DenialReasonNoMatch},
+		},
+		{
+			r:     &Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: Context{"owner": "ken"}},
+			cause: ErrRequestDenied,
+			want:  DenialError{Reason: DenialReasonCondition, PolicyID: "allow-owner", ConditionKey: "owner"},
+		},
+		{
+			// Deny policies whose conditions fail do not explain a denial.
+			r:     &Request{Subject: "ken", Action: "delete", Resource: "articles:1", Context: Context{"weekend": false}},
+			cause: ErrRequestDenied,
+			want:  DenialError{Reason: DenialReasonNoMatch},
+		},
+	} {
+		err := warden.IsAllowed(tc.r)
+		require.Error(t, err, "%d", k)
+		assert.Equal(t, tc.cause, pkgerrors.Cause(err), "%d", k)
+		assert.True(t, errors.Is(err, tc.cause), "%d", k)
+
+		var denial *DenialError
+		require.True(t, errors.As(err, &denial), "%d", k)
+		assert.Equal(t, tc.want.Reason, denial.Reason, "%d", k)
+		assert.Equal(t, tc.want.PolicyID, denial.PolicyID, "%d", k)
+		assert.Equal(t, tc.want.ConditionKey, denial.ConditionKey, "%d", k)
+		assert.Equal(t, tc.cause.Error(), denial.Error(), "%d", k)
+		assert.Equal(t, denial, AsDenialError(pkgerrors.Wrap(err, "wrapped")), "%d", k)
+		assert.Contains(t, fmt.Sprintf("%+v", err), "doPoliciesAllow", "%d", k)
+	}
+
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: Context{"owner": "peter"}}))
+
+	err := warden.IsAllowed(&Request{Subject: "peter", Action: "update", Resource: "articles:1"})
+	var denial *DenialError
+	require.True(t, errors.As(err, &denial))
+	assert.Nil(t, AsDenialError(pkgerrors.WithStack(ErrRequestDenied)))
+	assert.Nil(t, AsDenialError(nil))
+
+	body, err := json.Marshal(denial)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"reason": "condition", "policy": "allow-owner", "condition": "owner"}`, string(body))
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "github.com/pkg/errors"
+
+// Effect is the effect of a policy, deciding what happens to access requests the policy matches.
+type Effect string
+
+const (
+	// EffectAllow grants access unless another matching policy denies it.
+	EffectAllow Effect = AllowAccess
+
+	// EffectDeny denies access, overriding all allow policies.
+	EffectDeny Effect = DenyAccess
+)
+
+// EffectHandler handles a policy with a custom effect which matches an access request. Returning an error denies
+// the request with that error, overriding all allow policies. Returning nil leaves the decision to the other
+// matching policies.
+type EffectHandler func(r *Request, p Policy) error
+
+// EffectHandlers is where you can add custom effects, for example an "audit" effect which records matching requests
+// without influencing the decision, or a "challenge" effect asking the caller for additional proof. The built-in
+// effects "allow" and "deny" can not be overridden.
+var EffectHandlers = map[Effect]EffectHandler{}
+
+// IsKnownEffect returns true if effect is either "allow", "deny" or has been added to EffectHandlers.
+func IsKnownEffect(effect string) bool {
+	switch Effect(effect) {
+	case EffectAllow, EffectDeny:
+		return true
+	}
+
+	_, ok := EffectHandlers[Effect(effect)]
+	return ok
+}
+
+// ValidateEffect returns an error if the effect of the policy is not known. Managers call this before writing a policy.
+func ValidateEffect(p Policy) error {
+	if !IsKnownEffect(p.GetEffect()) {
+		return errors.Errorf(`Policy "%s" has unknown effect "%s"`, p.GetID(), p.GetEffect())
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestCustomEffects(t *testing.T) {
+	var audited []string
+	errChallenge := errors.New("Please provide a second factor")
+
+	EffectHandlers["audit"] = func(r *Request, p Policy) error {
+		audited = append(audited, r.Subject)
+		return nil
+	}
+	EffectHandlers["challenge"] = func(r *Request, p Policy) error {
+		if mfa, _ := r.Context["mfa"].(bool); !mfa {
+			return errChallenge
+		}
+		return nil
+	}
+	defer delete(EffectHandlers, "audit")
+	defer delete(EffectHandlers, "challenge")
+
+	assert.True(t, IsKnownEffect("allow"))
+	assert.True(t, IsKnownEffect("deny"))
+	assert.True(t, IsKnownEffect("audit"))
+	assert.False(t, IsKnownEffect("alow"))
+
+	warden := &Ladon{Manager: NewMemoryManager()}
+	for _, p := range []*DefaultPolicy{
+		{ID: "allow", Subjects: []string{"<.*>"}, Actions: []string{"<.*>"}, Resources: []string{"<.*>"}, Effect: EffectAllow},
+		{ID: "audit", Subjects: []string{"<.*>"}, Actions: []string{"<.*>"}, Resources: []string{"<.*>"}, Effect: "audit"},
+		{ID: "challenge", Subjects: []string{"<.*>"}, Actions: []string{"delete"}, Resources: []string{"<.*>"}, Effect: "challenge"},
+	} {
+		require.NoError(t, warden.Manager.Create(p))
+	}
+
+	err := warden.Manager.Create(&DefaultPolicy{ID: "typo", Effect: "alow"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "alow")
+
+	for k, c := range []struct {
+		r         *Request
+		expectErr error
+	}{
+		{r: &Request{Subject: "peter", Action: "get"}},
+		{r: &Request{Subject: "ken", Action: "delete"}, expectErr: errChallenge},
+		{r: &Request{Subject: "max", Action: "delete", Context: Context{"mfa": true}}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.expectErr, warden.IsAllowed(c.r))
+		})
+	}
+
+	// Denials end the evaluation early, so whether "ken" was audited depends on the order of policies.
+	assert.Contains(t, audited, "peter")
+	assert.Contains(t, audited, "max")
+}
+
+func TestEffectDecoding(t *testing.T) {
+	var p DefaultPolicy
+	require.NoError(t, json.Unmarshal([]byte(`{"id": "1", "effect": "deny"}`), &p))
+	assert.Equal(t, EffectDeny, p.Effect)
+
+	// Stored policies are decoded as they are, so that one bad row does not fail every lookup of a manager.
+	require.NoError(t, json.Unmarshal([]byte(`{"id": "1", "effect": "alow"}`), &p))
+	assert.Equal(t, Effect("alow"), p.Effect)
+	assert.Error(t, ValidateEffect(&p))
+
+	require.NoError(t, yaml.Unmarshal([]byte("id: \"1\"\neffect: alow\n"), &p))
+	assert.Equal(t, Effect("alow"), p.Effect)
+
+	m := NewMemoryManager()
+	assert.Error(t, m.Create(&p), "unknown effects are rejected when policies are written")
+
+	m.Policies["1"] = &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Resources: []string{"articles"}, Actions: []string{"get"}, Effect: AllowAccess}
+	m.Policies["2"] = &DefaultPolicy{ID: "2", Subjects: []string{"ken"}, Resources: []string{"articles"}, Actions: []string{"get"}, Effect: "alow"}
+	m.Policies["3"] = &DefaultPolicy{ID: "3", Subjects: []string{"max"}, Resources: []string{"articles"}, Actions: []string{"get"}}
+	warden := &Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles", Action: "get"}))
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "ken", Resource: "articles", Action: "get"})), "unknown effects deny")
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "max", Resource: "articles", Action: "get"})), "empty effects deny")
+
+	EffectHandlers["audit"] = func(r *Request, p Policy) error { return nil }
+	defer delete(EffectHandlers, "audit")
+	require.NoError(t, json.Unmarshal([]byte(`{"id": "1", "effect": "audit"}`), &p))
+	assert.Equal(t, Effect("audit"), p.Effect)
+
+	out, err := json.Marshal(&p)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"effect":"audit"`)
+}
@@ -22,6 +22,7 @@ package ladon
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -29,6 +30,7 @@ import (
 var (
 	// ErrRequestDenied is returned when an access request can not be satisfied by any policy.
 	ErrRequestDenied = &errorWithContext{
+		id:     "request_denied",
 		error:  errors.New("Request was denied by default"),
 		code:   http.StatusForbidden,
 		status: http.StatusText(http.StatusForbidden),
@@ -37,18 +39,122 @@ var (
 
 	// ErrRequestForcefullyDenied is returned when an access request is explicitly denied by a policy.
 	ErrRequestForcefullyDenied = &errorWithContext{
+		id:     "request_forcefully_denied",
 		error:  errors.New("Request was forcefully denied"),
 		code:   http.StatusForbidden,
 		status: http.StatusText(http.StatusForbidden),
 		reason: "The request was denied because a policy denied request.",
 	}
 
+	// ErrMultipleApplicable is returned by the OnlyOneApplicableStrategy when more than one policy applies to a
+	// request.
+	ErrMultipleApplicable = &errorWithContext{
+		id:     "multiple_applicable",
+		error:  errors.New("Request matches more than one policy"),
+		code:   http.StatusForbidden,
+		status: http.StatusText(http.StatusForbidden),
+		reason: "The request was denied because more than one policy applies to it.",
+	}
+
 	// ErrNotFound is returned when a resource can not be found.
 	ErrNotFound = &errorWithContext{
+		id:     "not_found",
 		error:  errors.New("Resource could not be found"),
 		code:   http.StatusNotFound,
 		status: http.StatusText(http.StatusNotFound),
 	}
+
+	// ErrPolicyExists is returned when a policy is created with the ID of an existing policy.
+	ErrPolicyExists = &errorWithContext{
+		id:     "policy_exists",
+		error:  errors.New("Policy exists"),
+		code:   http.StatusConflict,
+		status: http.StatusText(http.StatusConflict),
+		reason: "A policy with the same ID exists already.",
+	}
+
+	// ErrReadOnly is returned when a write operation is attempted on a read-only manager.
+	ErrReadOnly = &errorWithContext{
+		id:     "read_only",
+		error:  errors.New("Manager is read-only"),
+		code:   http.StatusMethodNotAllowed,
+		status: http.StatusText(http.StatusMethodNotAllowed),
+		reason: "The policy store does not support modifications.",
+	}
+
+	// ErrPolicyConflict is returned when a policy overlaps with an existing policy of the opposite effect.
+	ErrPolicyConflict = &errorWithContext{
+		id:     "policy_conflict",
+		error:  errors.New("Policy conflicts with existing policies"),
+		code:   http.StatusConflict,
+		status: http.StatusText(http.StatusConflict),
+		reason: "The policy covers subjects, resources and actions of existing policies with the opposite effect.",
+	}
+
+	// ErrManagerClosed is returned when a manager is used after it was closed.
+	ErrManagerClosed = &errorWithContext{
+		id:     "manager_closed",
+		error:  errors.New("Manager is closed"),
+		code:   http.StatusServiceUnavailable,
+		status: http.StatusText(http.StatusServiceUnavailable),
+		reason: "The policy store is shutting down.",
+	}
+
+	// ErrInvalidPolicy is returned when a policy is written which would fail when requests are evaluated.
+	ErrInvalidPolicy = &errorWithContext{
+		id:     "invalid_policy",
+		error:  errors.New("Policy is invalid"),
+		code:   http.StatusBadRequest,
+		status: http.StatusText(http.StatusBadRequest),
+		reason: "The policy is malformed, see the details for all problems.",
+	}
+
+	// ErrVersionConflict is returned when a policy is updated based on an outdated version.
+	ErrVersionConflict = &errorWithContext{
+		id:     "version_conflict",
+		error:  errors.New("Policy version conflict"),
+		code:   http.StatusConflict,
+		status: http.StatusText(http.StatusConflict),
+		reason: "The policy was modified by someone else, fetch the latest version and try again.",
+	}
+
+	// ErrWatchUnsupported is returned by WatchPolicies for managers which can not report changes.
+	ErrWatchUnsupported = &errorWithContext{
+		id:     "watch_unsupported",
+		error:  errors.New("Manager does not support watching policies"),
+		code:   http.StatusNotImplemented,
+		status: http.StatusText(http.StatusNotImplemented),
+		reason: "The policy store can not report changes, poll it instead.",
+	}
+
+	// ErrManagerUnavailable is returned by BreakerManager if the wrapped manager did not answer in time or failed
+	// too often recently.
+	ErrManagerUnavailable = &errorWithContext{
+		id:     "manager_unavailable",
+		error:  errors.New("Manager is unavailable"),
+		code:   http.StatusServiceUnavailable,
+		status: http.StatusText(http.StatusServiceUnavailable),
+		reason: "The policy store is slow or failing, try again later.",
+	}
+
+	// ErrPolicySignature is returned when a policy is not signed or its signature can not be verified.
+	ErrPolicySignature = &errorWithContext{
+		id:     "policy_signature",
+		error:  errors.New("Policy signature is invalid"),
+		code:   http.StatusForbidden,
+		status: http.StatusText(http.StatusForbidden),
+		reason: "A policy is not signed by a trusted key or was modified after it was signed.",
+	}
+
+	// ErrCaseInsensitiveIndex is returned by Ladon if its matcher ignores case, but its manager looks candidates
+	// up verbatim, see LiteralIndexer.
+	ErrCaseInsensitiveIndex = &errorWithContext{
+		id:     "case_insensitive_index",
+		error:  errors.New("Manager can not find candidates regardless of case"),
+		code:   http.StatusInternalServerError,
+		status: http.StatusText(http.StatusInternalServerError),
+		reason: "The warden ignores case, but the policy store looks subjects and resources up verbatim.",
+	}
 )
 
 func NewErrResourceNotFound(err error) error {
@@ -57,6 +163,7 @@ func NewErrResourceNotFound(err error) error {
 	}
 
 	return errors.WithStack(&errorWithContext{
+		id:     ErrNotFound.id,
 		error:  err,
 		code:   http.StatusNotFound,
 		status: http.StatusText(http.StatusNotFound),
@@ -64,13 +171,77 @@ func NewErrResourceNotFound(err error) error {
 	})
 }
 
+// NewErrPolicyConflict returns ErrPolicyConflict with the IDs of the conflicting policies as details.
+func NewErrPolicyConflict(conflicts Policies) error {
+	details := make([]map[string]interface{}, len(conflicts))
+	for k, p := range conflicts {
+		details[k] = map[string]interface{}{"policy": p.GetID(), "effect": p.GetEffect()}
+	}
+
+	return errors.WithStack(&errorWithContext{
+		id:      ErrPolicyConflict.id,
+		error:   ErrPolicyConflict.error,
+		code:    ErrPolicyConflict.code,
+		status:  ErrPolicyConflict.status,
+		reason:  ErrPolicyConflict.reason,
+		details: details,
+	})
+}
+
+// NewErrInvalidPolicy returns ErrInvalidPolicy listing the problems of the policy as details.
+func NewErrInvalidPolicy(p Policy, issues []FsckIssue) error {
+	messages := make([]string, len(issues))
+	details := make([]map[string]interface{}, len(issues))
+	for k, issue := range issues {
+		messages[k] = issue.Message
+		details[k] = map[string]interface{}{"policy": p.GetID(), "check": issue.Check, "message": issue.Message}
+		if issue.Path != "" {
+			details[k]["path"] = issue.Path
+		}
+	}
+
+	return errors.WithStack(&errorWithContext{
+		id:      ErrInvalidPolicy.id,
+		error:   errors.Errorf(`Policy "%s" is invalid: %s`, p.GetID(), strings.Join(messages, "; ")),
+		code:    ErrInvalidPolicy.code,
+		status:  ErrInvalidPolicy.status,
+		reason:  ErrInvalidPolicy.reason,
+		details: details,
+	})
+}
+
+// NewErrPolicySignature returns ErrPolicySignature with the ID of the policy and the ID of the key which signed it
+// as details.
+func NewErrPolicySignature(p Policy, keyID, message string) error {
+	details := map[string]interface{}{"policy": p.GetID()}
+	if keyID != "" {
+		details["key"] = keyID
+	}
+
+	return errors.WithStack(&errorWithContext{
+		id:      ErrPolicySignature.id,
+		error:   errors.Errorf(`Policy "%s" %s`, p.GetID(), message),
+		code:    ErrPolicySignature.code,
+		status:  ErrPolicySignature.status,
+		reason:  ErrPolicySignature.reason,
+		details: []map[string]interface{}{details},
+	})
+}
+
 type errorWithContext struct {
-	code   int
-	reason string
-	status string
+	id      string
+	code    int
+	reason  string
+	status  string
+	details []map[string]interface{}
 	error
 }
 
+// ID returns the machine-readable identifier of this error, for example "request_denied".
+func (e *errorWithContext) ID() string {
+	return e.id
+}
+
 // StatusCode returns the status code of this error.
 func (e *errorWithContext) StatusCode() int {
 	return e.code
@@ -86,12 +257,15 @@ func (e *errorWithContext) Reason() string {
 	return e.reason
 }
 
-// ID returns the error id, if applicable.
+// Status returns the status text of the error's status code.
 func (e *errorWithContext) Status() string {
 	return e.status
 }
 
 // Details returns details on the error, if applicable.
 func (e *errorWithContext) Details() []map[string]interface{} {
+	if e.details != nil {
+		return e.details
+	}
 	return []map[string]interface{}{}
 }
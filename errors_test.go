@@ -24,9 +24,29 @@ import (
 	"errors"
 	"testing"
 
+	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewErrResourceNotFound(t *testing.T) {
 	assert.EqualError(t, NewErrResourceNotFound(errors.New("not found")), "not found")
 }
+
+func TestErrorIDs(t *testing.T) {
+	for _, tc := range []struct {
+		err  *errorWithContext
+		id   string
+		code int
+	}{
+		{err: ErrRequestDenied, id: "request_denied", code: 403},
+		{err: ErrRequestForcefullyDenied, id: "request_forcefully_denied", code: 403},
+		{err: ErrNotFound, id: "not_found", code: 404},
+		{err: ErrPolicyExists, id: "policy_exists", code: 409},
+	} {
+		assert.Equal(t, tc.id, tc.err.ID())
+		assert.Equal(t, tc.code, tc.err.StatusCode())
+	}
+
+	err := NewErrPolicyConflict(Policies{&DefaultPolicy{ID: "1"}})
+	assert.Equal(t, "policy_conflict", pkgerrors.Cause(err).(*errorWithContext).ID())
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Checks reported by Fsck.
+const (
+	FsckCheckID        = "id"
+	FsckCheckDuplicate = "duplicate"
+	FsckCheckRegex     = "regex"
+	FsckCheckDelimiter = "delimiter"
+	FsckCheckEffect    = "effect"
+	FsckCheckMatchMode = "match_mode"
+	FsckCheckCondition = "condition"
+	FsckCheckJSON      = "json"
+	FsckCheckSchema    = "schema"
+)
+
+// FsckIssue is a single problem found by Fsck.
+type FsckIssue struct {
+	// PolicyID is the ID of the affected policy. Payloads which can not be decoded are identified by Index.
+	PolicyID string `json:"policy_id,omitempty"`
+	Index    int    `json:"index"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+
+	// Path is the JSON Pointer of the offending value, if the issue was found by checking a document against
+	// PolicySchema.
+	Path string `json:"path,omitempty"`
+}
+
+// FsckReport is the machine-readable result of Fsck.
+type FsckReport struct {
+	Policies int         `json:"policies"`
+	Issues   []FsckIssue `json:"issues"`
+}
+
+// OK returns true if no issues were found.
+func (r *FsckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *FsckReport) add(index int, p Policy, check, format string, args ...interface{}) {
+	issue := FsckIssue{Index: index, Check: check, Message: fmt.Sprintf(format, args...)}
+	if p != nil {
+		issue.PolicyID = p.GetID()
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Fsck validates all policies stored in m.
+func Fsck(m Manager) (*FsckReport, error) {
+	policies, err := Export(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return FsckPolicies(policies), nil
+}
+
+// FsckPayloads validates JSON encoded policies, for example the elements of an export bundle.
+func FsckPayloads(payloads []json.RawMessage) *FsckReport {
+	report := &FsckReport{Issues: []FsckIssue{}}
+	policies := make(Policies, 0, len(payloads))
+	indices := make([]int, 0, len(payloads))
+	for k, payload := range payloads {
+		var p DefaultPolicy
+		if err := json.Unmarshal(payload, &p); err != nil {
+			report.add(k, nil, FsckCheckJSON, "Payload can not be decoded: %s", err)
+			continue
+		}
+		policies = append(policies, &p)
+		indices = append(indices, k)
+	}
+
+	checked := FsckPolicies(policies)
+	for _, issue := range checked.Issues {
+		issue.Index = indices[issue.Index]
+		report.Issues = append(report.Issues, issue)
+	}
+	report.Policies = len(payloads)
+	return report
+}
+
+// FsckPolicies validates policies: IDs must be unique, each policy must pass ValidatePolicy and survive a JSON
+// round trip.
+func FsckPolicies(policies Policies) *FsckReport {
+	report := &FsckReport{Policies: len(policies), Issues: []FsckIssue{}}
+	seen := map[string]bool{}
+
+	for k, p := range policies {
+		if p.GetID() != "" && seen[p.GetID()] {
+			report.add(k, p, FsckCheckDuplicate, "Policy ID %s is used more than once", p.GetID())
+		}
+		seen[p.GetID()] = true
+
+		valid := true
+		for _, issue := range validatePolicy(p) {
+			issue.Index = k
+			report.Issues = append(report.Issues, issue)
+			valid = valid && issue.Check != FsckCheckCondition
+		}
+
+		// Unregistered conditions can not be decoded, which would be reported twice.
+		if !valid {
+			continue
+		}
+
+		if raw, err := json.Marshal(p); err != nil {
+			report.add(k, p, FsckCheckJSON, "Policy can not be encoded: %s", err)
+		} else if err := json.Unmarshal(raw, new(DefaultPolicy)); err != nil {
+			report.add(k, p, FsckCheckJSON, "Policy can not be decoded: %s", err)
+		}
+	}
+
+	return report
+}
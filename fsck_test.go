@@ -0,0 +1,88 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type unregisteredCondition struct{}
+
+func (c *unregisteredCondition) GetName() string                     { return "UnregisteredCondition" }
+func (c *unregisteredCondition) Fulfills(interface{}, *Request) bool { return true }
+
+func TestFsck(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "ok", Subjects: []string{"<.*>"}, Resources: []string{"articles:<[0-9]+>"}, Actions: []string{"get"}, Effect: AllowAccess}))
+
+	// These policies could not be created through the manager.
+	m.Policies["regex"] = &DefaultPolicy{ID: "regex", Subjects: []string{"<[>"}, Effect: AllowAccess}
+	m.Policies["delimiter"] = &DefaultPolicy{ID: "delimiter", Subjects: []string{"<.*"}, Effect: AllowAccess}
+	m.Policies["condition"] = &DefaultPolicy{ID: "condition", Effect: DenyAccess, Conditions: Conditions{"foo": &unregisteredCondition{}}}
+	m.Policies["effect"] = &DefaultPolicy{ID: "effect", Effect: "maybe"}
+
+	report, err := Fsck(m)
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 5, report.Policies)
+
+	checks := map[string]string{}
+	for _, issue := range report.Issues {
+		checks[issue.PolicyID] = issue.Check
+	}
+	assert.Equal(t, map[string]string{
+		"regex":     FsckCheckRegex,
+		"delimiter": FsckCheckDelimiter,
+		"condition": FsckCheckCondition,
+		"effect":    FsckCheckEffect,
+	}, checks)
+
+	ok, err := Fsck(NewMemoryManager())
+	require.NoError(t, err)
+	assert.True(t, ok.OK())
+}
+
+func TestFsckPayloads(t *testing.T) {
+	var payloads []json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"id": "1", "effect": "allow"},
+		{"id": "2", "effect": "allow", "conditions": {"foo": {"type": "UnknownCondition"}}},
+		{"id": "1", "effect": "deny"},
+		{"effect": "allow"},
+		{"effect": "alow", "id": "5"}
+	]`), &payloads))
+
+	report := FsckPayloads(payloads)
+	assert.Equal(t, 5, report.Policies)
+	assert.Equal(t, []FsckIssue{
+		{Index: 1, Check: FsckCheckJSON, Message: report.Issues[0].Message},
+		{PolicyID: "1", Index: 2, Check: FsckCheckDuplicate, Message: "Policy ID 1 is used more than once"},
+		{Index: 3, Check: FsckCheckID, Message: "Policy has no ID"},
+		{PolicyID: "5", Index: 4, Check: FsckCheckEffect, Message: `Policy "5" has unknown effect "alow"`},
+	}, report.Issues)
+}
@@ -1,14 +1,22 @@
 module github.com/ory/ladon
 
+go 1.24
+
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dlclark/regexp2 v1.2.0
 	github.com/golang/mock v1.1.1
 	github.com/hashicorp/golang-lru v0.5.0
 	github.com/ory/pagination v0.0.1
 	github.com/pborman/uuid v1.2.0
 	github.com/pkg/errors v0.8.0
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.2.2
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/google/uuid v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/net v0.0.0-20181023162649-9b4f9f5ad519 // indirect
 )
@@ -0,0 +1,42 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+)
+
+// HealthChecker is implemented by managers which depend on a database, a remote service or files, so services can
+// wire the store into their readiness probes instead of discovering dead connections when deciding requests.
+type HealthChecker interface {
+	// Ping returns nil if the manager is able to serve requests. It returns ErrManagerClosed once the manager
+	// was closed.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks the health of m. Managers which do not implement HealthChecker, such as the memory manager, are
+// always healthy.
+func Ping(ctx context.Context, m Manager) error {
+	if hc, ok := m.(HealthChecker); ok {
+		return hc.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+// unhealthyManager fails health checks.
+type unhealthyManager struct {
+	*MemoryManager
+}
+
+func (m *unhealthyManager) Ping(ctx context.Context) error {
+	return errUnavailable
+}
+
+func TestPing(t *testing.T) {
+	healthy, unhealthy := NewMemoryManager(), &unhealthyManager{MemoryManager: NewMemoryManager()}
+
+	assert.NoError(t, Ping(context.Background(), healthy), "managers without health checks are healthy")
+	assert.Equal(t, errUnavailable, errors.Cause(Ping(context.Background(), unhealthy)))
+
+	assert.Equal(t, errUnavailable, errors.Cause(Ping(context.Background(), &TracedManager{Manager: unhealthy, Tracer: new(recordingTracer)})))
+	assert.Equal(t, errUnavailable, errors.Cause(Ping(context.Background(), NewEventingManager(unhealthy, new(recordingBus)))))
+	assert.NoError(t, Ping(context.Background(), NewReplicatingManager(healthy, healthy)))
+	assert.Equal(t, errUnavailable, errors.Cause(Ping(context.Background(), NewReplicatingManager(healthy, unhealthy))), "unhealthy replicas are reported")
+}
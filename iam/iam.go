@@ -0,0 +1,305 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package iam converts AWS IAM policy documents to ladon policies.
+//
+// Every statement becomes one ladon policy. Wildcards (* and ?) in actions, resources and principals are
+// translated to regular expressions and the condition operators IpAddress, StringEquals, StringLike, Bool,
+// DateGreaterThan and DateLessThan are translated to ladon conditions, keyed by the IAM condition key (for
+// example "aws:SourceIp"). Statements which can not be represented are skipped and reported as issues,
+// because dropping a part of a statement would silently change what it grants or denies.
+//
+// Please note that AWS compares actions case-insensitively while ladon does not.
+package iam
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+// Document is an IAM policy document.
+type Document struct {
+	Version   string      `json:"Version"`
+	ID        string      `json:"Id,omitempty"`
+	Statement []Statement `json:"Statement"`
+}
+
+// Statement is a single statement of an IAM policy document.
+type Statement struct {
+	Sid          string                       `json:"Sid,omitempty"`
+	Effect       string                       `json:"Effect"`
+	Principal    Principal                    `json:"Principal,omitempty"`
+	NotPrincipal Principal                    `json:"NotPrincipal,omitempty"`
+	Action       Values                       `json:"Action,omitempty"`
+	NotAction    Values                       `json:"NotAction,omitempty"`
+	Resource     Values                       `json:"Resource,omitempty"`
+	NotResource  Values                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]Values `json:"Condition,omitempty"`
+}
+
+// Values is a list of strings which may be encoded as a single JSON string as well.
+type Values []string
+
+// UnmarshalJSON decodes either a string or a list of strings.
+func (v *Values) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = Values{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.WithStack(err)
+	}
+	*v = multiple
+	return nil
+}
+
+// Principal maps principal types (for example "AWS" or "Service") to principals. The wildcard principal "*"
+// is decoded as {"*": ["*"]}.
+type Principal map[string]Values
+
+// UnmarshalJSON decodes either the wildcard principal or a map of principals.
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		*p = Principal{wildcard: Values{wildcard}}
+		return nil
+	}
+
+	var principals map[string]Values
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return errors.WithStack(err)
+	}
+	*p = principals
+	return nil
+}
+
+// Options configures Import.
+type Options struct {
+	// Subjects are used as subjects of statements without a principal, which is the case for identity-based
+	// policies. Defaults to all subjects.
+	Subjects []string
+
+	// IDPrefix is prepended to the id of every policy. Policies are identified by the statement's Sid or,
+	// if empty, by its index.
+	IDPrefix string
+}
+
+// Issue describes a statement which could not be converted.
+type Issue struct {
+	// Statement is the Sid or, if empty, the index of the statement.
+	Statement string `json:"statement"`
+
+	// Message describes the issue.
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("statement %s: %s", i.Statement, i.Message)
+}
+
+// Import converts an IAM policy document to ladon policies.
+func Import(document []byte, opts Options) (ladon.Policies, []Issue, error) {
+	var doc Document
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var policies ladon.Policies
+	var issues []Issue
+	for i, s := range doc.Statement {
+		id := s.Sid
+		if id == "" {
+			id = fmt.Sprintf("%d", i)
+		}
+
+		p, err := convertStatement(s, opts)
+		if err != nil {
+			issues = append(issues, Issue{Statement: id, Message: err.Error()})
+			continue
+		}
+
+		p.ID = opts.IDPrefix + id
+		policies = append(policies, p)
+	}
+
+	return policies, issues, nil
+}
+
+func convertStatement(s Statement, opts Options) (*ladon.DefaultPolicy, error) {
+	p := &ladon.DefaultPolicy{Conditions: ladon.Conditions{}}
+
+	switch s.Effect {
+	case "Allow":
+		p.Effect = ladon.AllowAccess
+	case "Deny":
+		p.Effect = ladon.DenyAccess
+	default:
+		return nil, errors.Errorf("unknown effect %s", s.Effect)
+	}
+
+	if len(s.NotPrincipal) > 0 || len(s.NotAction) > 0 || len(s.NotResource) > 0 {
+		return nil, errors.New("NotPrincipal, NotAction and NotResource can not be represented")
+	}
+
+	var err error
+	if p.Actions, err = patterns(s.Action); err != nil {
+		return nil, err
+	} else if len(p.Actions) == 0 {
+		return nil, errors.New("statement has no action")
+	}
+
+	if p.Resources, err = patterns(s.Resource); err != nil {
+		return nil, err
+	} else if len(p.Resources) == 0 {
+		return nil, errors.New("statement has no resource")
+	}
+
+	if len(s.Principal) == 0 {
+		p.Subjects = opts.Subjects
+		if len(p.Subjects) == 0 {
+			p.Subjects = []string{"<.*>"}
+		}
+	} else {
+		types := make([]string, 0, len(s.Principal))
+		for t := range s.Principal {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+
+		for _, t := range types {
+			subjects, err := patterns(s.Principal[t])
+			if err != nil {
+				return nil, err
+			}
+			p.Subjects = append(p.Subjects, subjects...)
+		}
+	}
+
+	operators := make([]string, 0, len(s.Condition))
+	for operator := range s.Condition {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	for _, operator := range operators {
+		for key, values := range s.Condition[operator] {
+			if err := convertCondition(p.Conditions, operator, key, values); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// patterns converts IAM wildcards to ladon regular expressions.
+func patterns(values Values) ([]string, error) {
+	out := make([]string, len(values))
+	for i, v := range values {
+		if strings.ContainsAny(v, "<>") {
+			return nil, errors.Errorf("value %s contains regular expression delimiters", v)
+		}
+
+		out[i] = strings.NewReplacer("*", "<.*>", "?", "<.>").Replace(v)
+	}
+	return out, nil
+}
+
+func convertCondition(conditions ladon.Conditions, operator, key string, values Values) error {
+	if len(values) != 1 {
+		return errors.Errorf("condition %s on %s with %d values can not be represented", operator, key, len(values))
+	}
+
+	value := values[0]
+	existing, exists := conditions[key]
+	var condition ladon.Condition
+	switch operator {
+	case "IpAddress":
+		condition = &ladon.CIDRCondition{CIDR: value}
+	case "StringEquals":
+		condition = &ladon.StringEqualCondition{Equals: value}
+	case "StringLike":
+		condition = &ladon.StringMatchCondition{Matches: "^" + globToRegexp(value) + "$"}
+	case "Bool":
+		switch strings.ToLower(value) {
+		case "true":
+			condition = &ladon.BooleanCondition{BooleanValue: true}
+		case "false":
+			condition = &ladon.BooleanCondition{BooleanValue: false}
+		default:
+			return errors.Errorf("condition %s on %s expects a boolean but got %s", operator, key, value)
+		}
+	case "DateGreaterThan", "DateLessThan":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return errors.Errorf("condition %s on %s expects a RFC 3339 date but got %s", operator, key, value)
+		}
+
+		// Both bounds on the same key are merged into one condition.
+		date, ok := existing.(*ladon.DateCondition)
+		if !ok {
+			date = new(ladon.DateCondition)
+		} else {
+			exists = false
+		}
+
+		if operator == "DateGreaterThan" {
+			date.After = t
+		} else {
+			date.Before = t
+		}
+		condition = date
+	default:
+		return errors.Errorf("condition operator %s can not be represented", operator)
+	}
+
+	if exists {
+		return errors.Errorf("more than one condition on %s can not be represented", key)
+	}
+
+	conditions.AddCondition(key, condition)
+	return nil
+}
+
+func globToRegexp(glob string) string {
+	var out strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			out.WriteString(".*")
+		case '?':
+			out.WriteString(".")
+		default:
+			out.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package iam
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+const document = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "ReadBucket",
+      "Effect": "Allow",
+      "Action": ["s3:Get*", "s3:List*"],
+      "Resource": "arn:aws:s3:::reports/*",
+      "Condition": {
+        "IpAddress": {"aws:SourceIp": "203.0.113.0/24"},
+        "DateGreaterThan": {"aws:CurrentTime": "2018-01-01T00:00:00Z"},
+        "DateLessThan": {"aws:CurrentTime": "2019-01-01T00:00:00Z"}
+      }
+    },
+    {
+      "Sid": "NoDeletes",
+      "Effect": "Deny",
+      "Principal": "*",
+      "Action": "s3:DeleteObject",
+      "Resource": "*",
+      "Condition": {
+        "Bool": {"aws:MultiFactorAuthPresent": "false"}
+      }
+    },
+    {
+      "Effect": "Allow",
+      "Principal": {"AWS": ["arn:aws:iam::123456789012:user/peter"]},
+      "Action": "s3:PutObject",
+      "Resource": "arn:aws:s3:::uploads/???.png",
+      "Condition": {
+        "StringEquals": {"aws:username": "peter"},
+        "StringLike": {"s3:prefix": "home/peter/*"}
+      }
+    },
+    {
+      "Sid": "Unsupported",
+      "Effect": "Allow",
+      "NotAction": "iam:*",
+      "Resource": "*"
+    },
+    {
+      "Sid": "MultipleValues",
+      "Effect": "Allow",
+      "Action": "s3:GetObject",
+      "Resource": "*",
+      "Condition": {"IpAddress": {"aws:SourceIp": ["203.0.113.0/24", "198.51.100.0/24"]}}
+    }
+  ]
+}`
+
+func TestImport(t *testing.T) {
+	policies, issues, err := Import([]byte(document), Options{Subjects: []string{"peter"}, IDPrefix: "iam:"})
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	require.Len(t, issues, 2)
+	assert.Equal(t, "Unsupported", issues[0].Statement)
+	assert.Equal(t, "MultipleValues", issues[1].Statement)
+
+	assert.Equal(t, &ladon.DefaultPolicy{
+		ID:        "iam:ReadBucket",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"s3:Get<.*>", "s3:List<.*>"},
+		Resources: []string{"arn:aws:s3:::reports/<.*>"},
+		Effect:    ladon.AllowAccess,
+		Conditions: ladon.Conditions{
+			"aws:SourceIp": &ladon.CIDRCondition{CIDR: "203.0.113.0/24"},
+			"aws:CurrentTime": &ladon.DateCondition{
+				After:  time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}, policies[0])
+	assert.Equal(t, []string{"<.*>"}, policies[1].GetSubjects())
+	assert.Equal(t, "iam:2", policies[2].GetID())
+	assert.Equal(t, []string{"arn:aws:iam::123456789012:user/peter"}, policies[2].GetSubjects())
+
+	warden := &ladon.Ladon{Manager: memory.NewMemoryManager()}
+	for _, p := range policies {
+		require.NoError(t, warden.Manager.Create(p))
+	}
+
+	for k, c := range []struct {
+		r       *ladon.Request
+		allowed bool
+	}{
+		{
+			r: &ladon.Request{Subject: "peter", Action: "s3:GetObject", Resource: "arn:aws:s3:::reports/2018.csv",
+				Context: ladon.Context{"aws:SourceIp": "203.0.113.7", "aws:CurrentTime": "2018-05-01T00:00:00Z"}},
+			allowed: true,
+		},
+		{
+			r: &ladon.Request{Subject: "peter", Action: "s3:GetObject", Resource: "arn:aws:s3:::reports/2018.csv",
+				Context: ladon.Context{"aws:SourceIp": "203.0.113.7", "aws:CurrentTime": "2019-05-01T00:00:00Z"}},
+		},
+		{
+			r: &ladon.Request{Subject: "peter", Action: "s3:GetObject", Resource: "arn:aws:s3:::other/2018.csv",
+				Context: ladon.Context{"aws:SourceIp": "203.0.113.7", "aws:CurrentTime": "2018-05-01T00:00:00Z"}},
+		},
+		{
+			r: &ladon.Request{Subject: "arn:aws:iam::123456789012:user/peter", Action: "s3:PutObject", Resource: "arn:aws:s3:::uploads/abc.png",
+				Context: ladon.Context{"aws:username": "peter", "s3:prefix": "home/peter/images"}},
+			allowed: true,
+		},
+		{
+			r: &ladon.Request{Subject: "arn:aws:iam::123456789012:user/peter", Action: "s3:PutObject", Resource: "arn:aws:s3:::uploads/abcd.png",
+				Context: ladon.Context{"aws:username": "peter", "s3:prefix": "home/peter/images"}},
+		},
+		{
+			r: &ladon.Request{Subject: "arn:aws:iam::123456789012:user/peter", Action: "s3:PutObject", Resource: "arn:aws:s3:::uploads/abc.png",
+				Context: ladon.Context{"aws:username": "peter", "s3:prefix": "home/ken/images"}},
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.allowed, warden.IsAllowed(c.r) == nil)
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	_, _, err := Import([]byte(`{"Statement": "nope"}`), Options{})
+	assert.Error(t, err)
+
+	_, issues, err := Import([]byte(`{"Statement": [
+		{"Effect": "Maybe", "Action": "*", "Resource": "*"},
+		{"Effect": "Allow", "Resource": "*"},
+		{"Effect": "Allow", "Action": "*", "Resource": "*", "Condition": {"NumericLessThan": {"s3:max-keys": "10"}}},
+		{"Effect": "Allow", "Action": "*", "Resource": "<script>"}
+	]}`), Options{})
+	require.NoError(t, err)
+	assert.Len(t, issues, 4)
+}
@@ -21,6 +21,9 @@
 package ladon
 
 import (
+	"context"
+	"time"
+
 	"github.com/pkg/errors"
 )
 
@@ -30,6 +33,39 @@ type Ladon struct {
 	Matcher     matcher
 	AuditLogger AuditLogger
 	Metric      Metric
+
+	// DefaultEffect is the effect applied to requests which are not matched by any policy. It defaults to
+	// EffectDeny. If set to EffectAllow, requests are granted unless a policy explicitly denies them.
+	DefaultEffect Effect
+
+	// CandidateQuota is a soft limit for the number of candidates the manager may return per request. Requests
+	// exceeding it are evaluated as usual, but reported to the Metric if it implements CandidateQuotaMetric.
+	// Zero disables the limit.
+	CandidateQuota int
+
+	// Normalizers rewrite the subject, action and resource of every request before candidates are looked up and
+	// matched. Audit loggers and metrics see the normalized request.
+	Normalizers RequestNormalizers
+
+	// Enrichers add derived attributes to the context of every request before it is evaluated.
+	Enrichers ContextEnrichers
+
+	// Strategy combines the applicable policies into a decision. It defaults to DefaultStrategy.
+	Strategy Strategy
+
+	// Redactor hides sensitive context values from audit loggers, metrics and effect handler errors.
+	Redactor *Redactor
+
+	// Clock sets the time of requests which do not carry one. It defaults to SystemClock.
+	Clock Clock
+
+	// Verifier verifies the signatures of all policies a request or Audience is evaluated against. They fail with
+	// ErrPolicySignature if one of them is not signed by a trusted key or was modified after it was signed.
+	Verifier *Verifier
+
+	// tracer and traceContext are set by TracedWarden.
+	tracer       Tracer
+	traceContext context.Context
 }
 
 func (l *Ladon) matcher() matcher {
@@ -39,6 +75,20 @@ func (l *Ladon) matcher() matcher {
 	return l.Matcher
 }
 
+func (l *Ladon) strategy() Strategy {
+	if l.Strategy == nil {
+		l.Strategy = DefaultStrategy
+	}
+	return l.Strategy
+}
+
+func (l *Ladon) clock() Clock {
+	if l.Clock == nil {
+		l.Clock = SystemClock
+	}
+	return l.Clock
+}
+
 func (l *Ladon) auditLogger() AuditLogger {
 	if l.AuditLogger == nil {
 		l.AuditLogger = DefaultAuditLogger
@@ -55,95 +105,276 @@ func (l *Ladon) metric() Metric {
 
 // IsAllowed returns nil if subject s has permission p on resource r with context c or an error otherwise.
 func (l *Ladon) IsAllowed(r *Request) (err error) {
+	if r, err = l.normalize(r); err != nil {
+		return err
+	}
+
+	if err := l.checkIndex(); err != nil {
+		return err
+	}
+
+	start := time.Now()
 	policies, err := l.Manager.FindRequestCandidates(r)
+	if m, ok := l.metric().(LatencyMetric); ok {
+		m.ManagerQueryDuration("FindRequestCandidates", time.Since(start))
+		if err == nil {
+			m.RequestCandidates(*l.Redactor.Request(r), len(policies))
+		}
+	}
+
 	if err != nil {
-		go l.metric().RequestProcessingError(*r, nil, err)
+		go l.metric().RequestProcessingError(*l.Redactor.Request(r), nil, err)
 		return err
 	}
 
+	if l.CandidateQuota > 0 && len(policies) > l.CandidateQuota {
+		if m, ok := l.metric().(CandidateQuotaMetric); ok {
+			m.CandidateQuotaExceeded(*l.Redactor.Request(r), len(policies), subjectPatterns(policies))
+		}
+	}
+
 	// Although the manager is responsible of matching the policies, it might decide to just scan for
 	// subjects, it might return all policies, or it might have a different pattern matching than Golang.
 	// Thus, we need to make sure that we actually matched the right policies.
-	return l.DoPoliciesAllow(r, policies)
+	return l.doPoliciesAllow(r, policies, start)
 }
 
 // DoPoliciesAllow returns nil if subject s has permission p on resource r with context c for a given policy list or an error otherwise.
 // The IsAllowed interface should be preferred since it uses the manager directly. This is a lower level interface for when you don't want to use the ladon manager.
 func (l *Ladon) DoPoliciesAllow(r *Request, policies []Policy) (err error) {
-	var allowed = false
-	var deciders = Policies{}
+	if r, err = l.normalize(r); err != nil {
+		return err
+	}
+	return l.doPoliciesAllow(r, policies, time.Now())
+}
 
-	// Iterate through all policies
-	for _, p := range policies {
+// normalize runs the normalizers. Requests which can not be normalized are reported to the metric.
+func (l *Ladon) normalize(r *Request) (*Request, error) {
+	normalized, err := l.Normalizers.Normalize(r)
+	if err != nil {
+		go l.metric().RequestProcessingError(*l.Redactor.Request(r), nil, err)
+		return nil, err
+	}
+	return normalized, nil
+}
 
-		// Does the action match with one of the policies?
-		// This is the first check because usually actions are a superset of get|update|delete|set
-		// and thus match faster.
-		if pm, err := l.matcher().Matches(p, p.GetActions(), r.Action); err != nil {
-			go l.metric().RequestProcessingError(*r, p, err)
-			return errors.WithStack(err)
-		} else if !pm {
-			// no, continue to next policy
-			continue
+// doPoliciesAllow implements DoPoliciesAllow. start is the time the evaluation of the request began, which is
+// reported to audit loggers implementing DecisionAuditLogger.
+func (l *Ladon) doPoliciesAllow(r *Request, policies []Policy, start time.Time) (err error) {
+	if l.tracer != nil {
+		ctx, span := l.tracer.Start(l.traceContext, "ladon.DoPoliciesAllow")
+		span.SetAttribute("ladon.policies", len(policies))
+		defer func() { endSpan(span, err) }()
+
+		traced := *l
+		traced.traceContext = ctx
+		l = &traced
+	}
+
+	if r.Time.IsZero() {
+		stamped := *r
+		stamped.Time = l.clock().Now()
+		r = &stamped
+	}
+
+	if len(l.Enrichers) > 0 {
+		ctx := l.traceContext
+		if ctx == nil {
+			ctx = context.Background()
 		}
 
-		// Does the subject match with one of the policies?
-		// There are usually less subjects than resources which is why this is checked
-		// before checking for resources.
-		if sm, err := l.matcher().Matches(p, p.GetSubjects(), r.Subject); err != nil {
-			go l.metric().RequestProcessingError(*r, p, err)
+		enriched, err := l.Enrichers.Enrich(ctx, r)
+		if err != nil {
+			go l.metric().RequestProcessingError(*l.Redactor.Request(r), nil, err)
+			return err
+		}
+		r = enriched
+	}
+
+	// logged is the request as seen by audit loggers and metrics.
+	logged := l.Redactor.Request(r)
+
+	candidates := Policies{}
+
+	// failed is the first allow policy which matched the request, but whose conditions were not fulfilled. It is
+	// reported if no policy applies.
+	var failed *DenialError
+	for _, p := range policies {
+		if err := l.Verifier.Verify(p); err != nil {
+			go l.metric().RequestProcessingError(*logged, p, err)
 			return err
-		} else if !sm {
-			// no, continue to next policy
-			continue
 		}
 
-		// Does the resource match with one of the policies?
-		if rm, err := l.matcher().Matches(p, p.GetResources(), r.Resource); err != nil {
-			go l.metric().RequestProcessingError(*r, p, err)
-			return errors.WithStack(err)
-		} else if !rm {
-			// no, continue to next policy
+		if matches, err := l.matchesRequest(p, r); err != nil {
+			go l.metric().RequestProcessingError(*logged, p, err)
+			return err
+		} else if !matches {
 			continue
 		}
 
-		// Are the policies conditions met?
-		// This is checked first because it usually has a small complexity.
-		if !l.passesConditions(p, r) {
-			// no, continue to next policy
+		if key, ok := l.failedCondition(p, r); ok {
+			if failed == nil && p.AllowAccess() {
+				failed = newDenialError(DenialReasonCondition, p, key, errors.WithStack(ErrRequestDenied))
+			}
 			continue
 		}
+		candidates = append(candidates, p)
+	}
+
+	d, err := l.strategy().Decide(r, candidates)
+	if err != nil {
+		go l.metric().RequestProcessingError(*logged, nil, err)
+		return err
+	}
+
+	if !d.Allowed && len(d.Deciders) > 0 {
+		err := d.Err
+		if err == nil {
+			err = errors.WithStack(ErrRequestForcefullyDenied)
+		}
 
-		// Is the policy's effect `deny`? If yes, this overrides all allow policies -> access denied.
-		if !p.AllowAccess() {
-			deciders = append(deciders, p)
-			l.auditLogger().LogRejectedAccessRequest(r, policies, deciders)
-			go l.metric().RequestDeniedBy(*r, p)
-			return errors.WithStack(ErrRequestForcefullyDenied)
+		if errors.Cause(err) == ErrRequestForcefullyDenied {
+			err = newDenialError(DenialReasonPolicy, d.Deciders[len(d.Deciders)-1], "", err)
+		} else {
+			err = l.Redactor.Error(r, err)
 		}
 
-		allowed = true
-		deciders = append(deciders, p)
+		l.audit(logged, policies, d.Deciders, false, start)
+		go l.metric().RequestDeniedBy(*logged, d.Deciders[len(d.Deciders)-1])
+		return err
+	}
+
+	if !d.Allowed && l.DefaultEffect == EffectAllow {
+		go l.metric().RequestNoMatch(*logged)
+
+		l.audit(logged, policies, d.Deciders, true, start)
+		return nil
 	}
 
-	if !allowed {
-		go l.metric().RequestNoMatch(*r)
+	if !d.Allowed {
+		go l.metric().RequestNoMatch(*logged)
 
-		l.auditLogger().LogRejectedAccessRequest(r, policies, deciders)
-		return errors.WithStack(ErrRequestDenied)
+		l.audit(logged, policies, d.Deciders, false, start)
+		if d.Err != nil {
+			return l.Redactor.Error(r, d.Err)
+		} else if failed != nil {
+			return failed
+		}
+		return newDenialError(DenialReasonNoMatch, nil, "", errors.WithStack(ErrRequestDenied))
 	}
 
-	l.metric().RequestAllowedBy(*r, deciders)
+	l.metric().RequestAllowedBy(*logged, d.Deciders)
+
+	l.audit(logged, policies, d.Deciders, true, start)
+	return nil
+}
 
-	l.auditLogger().LogGrantedAccessRequest(r, policies, deciders)
+// checkIndex returns ErrCaseInsensitiveIndex if the manager can not find the candidates the matcher would match.
+func (l *Ladon) checkIndex() error {
+	if foldsCase(l.matcher()) && IndexesLiterals(l.Manager) {
+		return errors.WithStack(ErrCaseInsensitiveIndex)
+	}
 	return nil
 }
 
-func (l *Ladon) passesConditions(p Policy, r *Request) bool {
+// audit reports a decision to the audit logger.
+func (l *Ladon) audit(r *Request, pool, deciders Policies, allowed bool, start time.Time) {
+	if dl, ok := l.auditLogger().(DecisionAuditLogger); ok {
+		record := newAuditRecord(r, deciders, allowed)
+		record.Latency = time.Since(start)
+		dl.LogDecision(record)
+		return
+	}
+
+	if allowed {
+		l.auditLogger().LogGrantedAccessRequest(r, pool, deciders)
+	} else {
+		l.auditLogger().LogRejectedAccessRequest(r, pool, deciders)
+	}
+}
+
+// applies returns true if the policy matches the request and its conditions are fulfilled.
+func (l *Ladon) applies(p Policy, r *Request) (bool, error) {
+	if matches, err := l.matchesRequest(p, r); err != nil || !matches {
+		return false, err
+	}
+
+	_, failed := l.failedCondition(p, r)
+	return !failed, nil
+}
+
+// matchesRequest returns true if the policy matches the tenant, action, subject and resource of the request,
+// regardless of its conditions.
+func (l *Ladon) matchesRequest(p Policy, r *Request) (bool, error) {
+	// Policies never apply across tenants, and disabled policies never apply at all.
+	if PolicyTenant(p) != r.Tenant || !PolicyActive(p) {
+		return false, nil
+	}
+
+	excludedSubjects, excludedResources, excludedActions := PolicyExclusions(p)
+
+	// Does the action match with one of the policies?
+	// This is the first check because usually actions are a superset of get|update|delete|set
+	// and thus match faster.
+	if pm, err := l.matchesExcluding(p, RequestAction, p.GetActions(), excludedActions, r.Action); err != nil {
+		return false, errors.WithStack(err)
+	} else if !pm {
+		return false, nil
+	}
+
+	// Does the subject match with one of the policies?
+	// There are usually less subjects than resources which is why this is checked
+	// before checking for resources.
+	if sm, err := l.matchesExcluding(p, RequestSubject, p.GetSubjects(), excludedSubjects, r.Subject); err != nil {
+		return false, err
+	} else if !sm {
+		return false, nil
+	}
+
+	// Does the resource match with one of the policies?
+	if rm, err := l.matchesExcluding(p, RequestResource, SubstituteSubject(p, p.GetResources(), r.Subject), SubstituteSubject(p, excludedResources, r.Subject), r.Resource); err != nil {
+		return false, errors.WithStack(err)
+	} else if !rm {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (l *Ladon) matches(p Policy, field RequestField, haystack []string, needle string) (bool, error) {
+	if m, ok := l.metric().(LatencyMetric); ok {
+		start := time.Now()
+		defer func() { m.MatchDuration(time.Since(start)) }()
+	}
+
+	if fm, ok := l.matcher().(FieldMatcher); ok {
+		return fm.MatchesField(p, field, haystack, needle)
+	}
+	return l.matcher().Matches(p, haystack, needle)
+}
+
+// failedCondition returns the key of a condition of the policy which the request does not fulfill, and false if
+// it fulfills all of them.
+func (l *Ladon) failedCondition(p Policy, r *Request) (string, bool) {
 	for key, condition := range p.GetConditions() {
-		if pass := condition.Fulfills(r.Context[key], r); !pass {
-			return false
+		if pass := l.fulfills(p, key, condition, r); !pass {
+			return key, true
 		}
 	}
-	return true
+	return "", false
+}
+
+func (l *Ladon) fulfills(p Policy, key string, condition Condition, r *Request) bool {
+	if l.tracer == nil {
+		return condition.Fulfills(r.Context[key], r)
+	}
+
+	_, span := l.tracer.Start(l.traceContext, "ladon.Condition."+condition.GetName())
+	defer span.End()
+
+	pass := condition.Fulfills(r.Context[key], r)
+	span.SetAttribute("ladon.policy", p.GetID())
+	span.SetAttribute("ladon.condition.key", key)
+	span.SetAttribute("ladon.condition.passed", pass)
+	return pass
 }
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -243,3 +244,43 @@ func TestLadonEmpty(t *testing.T) {
 	warden := &Ladon{Manager: NewMemoryManager()}
 	assert.NotNil(t, warden.IsAllowed(&Request{}))
 }
+
+func TestLadonDefaultEffect(t *testing.T) {
+	warden := &Ladon{Manager: NewMemoryManager(), DefaultEffect: AllowAccess}
+	require.NoError(t, warden.Manager.Create(&DefaultPolicy{
+		ID:        "deny-delete",
+		Subjects:  []string{"<.*>"},
+		Actions:   []string{"delete"},
+		Resources: []string{"<.*>"},
+		Effect:    DenyAccess,
+	}))
+	require.NoError(t, warden.Manager.Create(&DefaultPolicy{
+		ID:        "allow-peter",
+		Subjects:  []string{"peter"},
+		Actions:   []string{"<.*>"},
+		Resources: []string{"<.*>"},
+		Effect:    AllowAccess,
+	}))
+
+	for k, c := range []struct {
+		r         *Request
+		expectErr error
+	}{
+		{r: &Request{Subject: "ken", Action: "get", Resource: "article"}},
+		{r: &Request{Subject: "peter", Action: "get", Resource: "article"}},
+		{r: &Request{Subject: "ken", Action: "delete", Resource: "article"}, expectErr: ErrRequestForcefullyDenied},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "article"}, expectErr: ErrRequestForcefullyDenied},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			err := warden.IsAllowed(c.r)
+			if c.expectErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, c.expectErr, errors.Cause(err))
+			}
+		})
+	}
+
+	warden.DefaultEffect = DenyAccess
+	assert.Equal(t, ErrRequestDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "ken", Action: "get"})))
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ory/ladon"
+)
+
+// Expectation is the expected outcome of an access request: Subject can, or cannot, perform Action on Resource
+// given Context. Expectations are written in Go
+//
+//	ladontest.Can("peter", "update", "articles:1").Given(ladon.Context{"owner": "peter"})
+//
+// or in YAML tables, see ParseExpectations.
+type Expectation struct {
+	Subject  string
+	Action   string
+	Resource string
+	Context  ladon.Context
+	Allowed  bool
+}
+
+// Can expects that subject is allowed to perform action on resource.
+func Can(subject, action, resource string) Expectation {
+	return Expectation{Subject: subject, Action: action, Resource: resource, Allowed: true}
+}
+
+// Cannot expects that subject is denied to perform action on resource.
+func Cannot(subject, action, resource string) Expectation {
+	return Expectation{Subject: subject, Action: action, Resource: resource}
+}
+
+// Given returns a copy of the expectation with the request context c.
+func (e Expectation) Given(c ladon.Context) Expectation {
+	e.Context = c
+	return e
+}
+
+// Request returns the access request of the expectation.
+func (e Expectation) Request() *ladon.Request {
+	return &ladon.Request{Subject: e.Subject, Action: e.Action, Resource: e.Resource, Context: e.Context}
+}
+
+// String returns the expectation as a sentence, for example "peter can update articles:1 given owner=peter".
+func (e Expectation) String() string {
+	verb := "cannot"
+	if e.Allowed {
+		verb = "can"
+	}
+
+	s := fmt.Sprintf("%s %s %s %s", e.Subject, verb, e.Action, e.Resource)
+	if len(e.Context) == 0 {
+		return s
+	}
+
+	keys := make([]string, 0, len(e.Context))
+	for k := range e.Context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	given := make([]string, len(keys))
+	for k, key := range keys {
+		given[k] = fmt.Sprintf("%s=%v", key, e.Context[key])
+	}
+	return s + " given " + strings.Join(given, ", ")
+}
+
+// UnmarshalYAML decodes an expectation written as
+//
+//	subject: peter
+//	can: update # or cannot: update
+//	on: articles:1
+//	given:
+//	  owner: peter
+func (e *Expectation) UnmarshalYAML(value *yaml.Node) error {
+	var row struct {
+		Subject string        `yaml:"subject"`
+		Can     string        `yaml:"can"`
+		Cannot  string        `yaml:"cannot"`
+		On      string        `yaml:"on"`
+		Given   ladon.Context `yaml:"given"`
+	}
+	if err := value.Decode(&row); err != nil {
+		return err
+	}
+
+	if (row.Can == "") == (row.Cannot == "") {
+		return errors.Errorf("Expectation on line %d must have either can or cannot", value.Line)
+	}
+
+	*e = Cannot(row.Subject, row.Cannot, row.On)
+	if row.Can != "" {
+		*e = Can(row.Subject, row.Can, row.On)
+	}
+	e.Context = row.Given
+	return nil
+}
+
+// ParseExpectations parses a table of expectations written in YAML, one expectation per row:
+//
+//	# articles
+//	- subject: peter
+//	  can: update
+//	  on: articles:1
+//	  given: {owner: peter}
+//	- subject: ken
+//	  cannot: delete
+//	  on: articles:1
+//
+// Tables can span several YAML documents. As JSON is valid YAML, tables can be written in JSON too.
+func ParseExpectations(table string) ([]Expectation, error) {
+	var out []Expectation
+	dec := yaml.NewDecoder(bytes.NewBufferString(table))
+	for {
+		var rows []Expectation
+		if err := dec.Decode(&rows); err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Could not decode expectations")
+		}
+		out = append(out, rows...)
+	}
+}
+
+// ReadExpectations reads the table of expectations stored in the file at path, see ParseExpectations.
+func ReadExpectations(path string) ([]Expectation, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	expectations, err := ParseExpectations(string(raw))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not load %s", path)
+	}
+	return expectations, nil
+}
+
+// LoadExpectations returns the expectations read by ReadExpectations. tb fails if they can not be read.
+func LoadExpectations(tb testing.TB, path string) []Expectation {
+	tb.Helper()
+
+	expectations, err := ReadExpectations(path)
+	if err != nil {
+		tb.Fatalf("Could not load expectations: %+v", err)
+	}
+	return expectations
+}
+
+// MustParseExpectations returns the expectations parsed by ParseExpectations. tb fails if they can not be parsed.
+func MustParseExpectations(tb testing.TB, table string) []Expectation {
+	tb.Helper()
+
+	expectations, err := ParseExpectations(table)
+	if err != nil {
+		tb.Fatalf("Could not parse expectations: %+v", err)
+	}
+	return expectations
+}
+
+// Failure is an expectation which was not met.
+type Failure struct {
+	Expectation Expectation
+
+	// Err is the error the warden returned for the request, or nil if it allowed the request.
+	Err error
+
+	// Policies are the IDs of the policies which decided the request. They are only known if the warden is a
+	// *ladon.Ladon.
+	Policies []string
+}
+
+// String returns the failure as a diff of the expected and the actual outcome:
+//
+//	ken cannot delete articles:1
+//		- denied
+//		+ allowed by policy delete-articles
+func (f Failure) String() string {
+	expected := "denied"
+	if f.Expectation.Allowed {
+		expected = "allowed"
+	}
+	return fmt.Sprintf("%s\n\t- %s\n\t+ %s", f.Expectation, expected, f.outcome())
+}
+
+func (f Failure) outcome() string {
+	if f.Err == nil {
+		if len(f.Policies) == 0 {
+			return "allowed"
+		}
+		return "allowed by " + policies(f.Policies)
+	}
+
+	if !denied(f.Err) {
+		return "failed: " + f.Err.Error()
+	}
+
+	denial := ladon.AsDenialError(f.Err)
+	if denial == nil {
+		return "denied: " + f.Err.Error()
+	}
+
+	switch denial.Reason {
+	case ladon.DenialReasonPolicy:
+		return fmt.Sprintf("denied by policy %s", denial.PolicyID)
+	case ladon.DenialReasonCondition:
+		return fmt.Sprintf("denied, condition %s of policy %s did not match", denial.ConditionKey, denial.PolicyID)
+	}
+	return "denied, no policy matched"
+}
+
+func policies(ids []string) string {
+	if len(ids) == 1 {
+		return "policy " + ids[0]
+	}
+	return "policies " + strings.Join(ids, ", ")
+}
+
+// denied returns true if err is a denial rather than a failure to decide.
+func denied(err error) bool {
+	cause := errors.Cause(err)
+	return cause == ladon.ErrRequestDenied || cause == ladon.ErrRequestForcefullyDenied
+}
+
+// Check asks warden to decide the request of every expectation and returns the expectations which were not met, in
+// order. An expectation is met if the request was allowed as expected, or denied as expected with
+// ladon.ErrRequestDenied or ladon.ErrRequestForcefullyDenied; other errors never meet expectations.
+//
+// If warden is a *ladon.Ladon, the requests are decided by a copy of it which records the deciding policies, so
+// its audit logger is not called.
+func Check(warden ladon.Warden, expectations ...Expectation) []Failure {
+	rec := new(ladon.AuditRecorder)
+	if l, ok := warden.(*ladon.Ladon); ok {
+		recorded := *l
+		recorded.AuditLogger = rec
+		warden = &recorded
+	}
+
+	var failures []Failure
+	for _, e := range expectations {
+		rec.Reset()
+		err := warden.IsAllowed(e.Request())
+		if (err == nil && e.Allowed) || (err != nil && !e.Allowed && denied(err)) {
+			continue
+		}
+
+		f := Failure{Expectation: e, Err: err}
+		if last := rec.Last(); last != nil {
+			f.Policies = last.Policies
+		}
+		failures = append(failures, f)
+	}
+	return failures
+}
+
+// Expect checks the expectations with warden, see Check, and reports all which were not met as one error of tb. It
+// returns true if all expectations were met.
+func Expect(tb testing.TB, warden ladon.Warden, expectations ...Expectation) bool {
+	tb.Helper()
+
+	failures := Check(warden, expectations...)
+	if len(failures) == 0 {
+		return true
+	}
+
+	diffs := make([]string, len(failures))
+	for k, f := range failures {
+		diffs[k] = f.String()
+	}
+	tb.Errorf("%d of %d expectations were not met:\n\n%s", len(failures), len(expectations), strings.Join(diffs, "\n\n"))
+	return false
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+// reporter records the errors reported to it.
+type reporter struct {
+	testing.TB
+	errors []string
+}
+
+func (r *reporter) Helper() {}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+const table = `
+# articles
+- subject: peter
+  can: get
+  on: articles:1
+- subject: peter
+  can: update
+  on: articles:1
+  given: {owner: peter}
+- subject: peter
+  cannot: update
+  on: articles:1
+  given: {owner: ken}
+---
+- subject: ken
+  cannot: delete
+  on: articles:1
+`
+
+func TestExpectations(t *testing.T) {
+	expectations := MustParseExpectations(t, table)
+	require.Len(t, expectations, 4)
+	assert.Equal(t, Can("peter", "update", "articles:1").Given(ladon.Context{"owner": "peter"}), expectations[1])
+	assert.Equal(t, Cannot("ken", "delete", "articles:1"), expectations[3])
+	assert.Equal(t, "peter cannot update articles:1 given owner=ken", expectations[2].String())
+
+	warden := &ladon.Ladon{Manager: NewManager(t, MustParsePolicies(t, fixtures)...)}
+	Expect(t, warden, expectations...)
+	Expect(t, warden,
+		Can("peter", "get", "articles:2"),
+		Cannot("peter", "get", "comments:1"),
+	)
+
+	r := new(reporter)
+	assert.False(t, Expect(r, warden,
+		Can("peter", "get", "articles:1"),
+		Cannot("ken", "get", "articles:1"),
+		Can("peter", "delete", "articles:1"),
+		Can("peter", "update", "articles:1").Given(ladon.Context{"owner": "ken"}),
+	))
+	require.Len(t, r.errors, 1)
+	assert.Equal(t, `3 of 4 expectations were not met:
+
+ken cannot get articles:1
+	- denied
+	+ allowed by policy read
+
+peter can delete articles:1
+	- allowed
+	+ denied, no policy matched
+
+peter can update articles:1 given owner=ken
+	- allowed
+	+ denied, condition owner of policy owner did not match`, r.errors[0])
+
+	require.NoError(t, warden.Manager.Create(&ladon.DefaultPolicy{ID: "no-ken", Subjects: []string{"ken"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: ladon.DenyAccess}))
+	failures := Check(warden, Can("ken", "get", "articles:1"))
+	require.Len(t, failures, 1)
+	assert.Equal(t, "denied by policy no-ken", failures[0].outcome())
+
+	unavailable := errors.New("connection refused")
+	failures = Check(NewWarden().Fail(Any, Any, Any, unavailable), Cannot("ken", "get", "articles:1"))
+	require.Len(t, failures, 1)
+	assert.Equal(t, "failed: connection refused", failures[0].outcome())
+
+	failures = Check(NewWarden(), Can("ken", "get", "articles:1"))
+	require.Len(t, failures, 1)
+	assert.Equal(t, "denied: Request was denied by default", failures[0].outcome())
+}
+
+func TestReadExpectations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladontest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "expectations.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"subject": "peter", "can": "get", "on": "articles:1", "given": {"ip": "127.0.0.1"}}]`), 0644))
+	assert.Equal(t, []Expectation{Can("peter", "get", "articles:1").Given(ladon.Context{"ip": "127.0.0.1"})}, LoadExpectations(t, path))
+
+	_, err = ReadExpectations(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+	_, err = ParseExpectations("- subject: peter\n  on: articles:1")
+	assert.Error(t, err)
+	_, err = ParseExpectations("- subject: peter\n  can: get\n  cannot: get")
+	assert.Error(t, err)
+	_, err = ParseExpectations("subject: peter")
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/file"
+)
+
+// ReadPolicies reads the policies of a fixture file, or of all fixture files below a directory ordered by ID. The
+// format is chosen by the file extension like the file manager does, so fixtures can be YAML, with several
+// documents per file, or JSON. Every policy is validated.
+func ReadPolicies(path string) (ladon.Policies, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if info.IsDir() {
+		m, err := file.NewFileManager(path)
+		if err != nil {
+			return nil, err
+		}
+		return m.GetAll(math.MaxInt32, 0)
+	}
+
+	if !file.IsPolicyFile(path) {
+		return nil, errors.Errorf("%s is neither a YAML nor a JSON file", path)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return decode(path, raw)
+}
+
+// ParsePolicies parses fixtures written in YAML.
+func ParsePolicies(fixtures string) (ladon.Policies, error) {
+	return decode("fixtures.yaml", []byte(fixtures))
+}
+
+func decode(name string, raw []byte) (ladon.Policies, error) {
+	policies, err := file.Decode(name, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range policies {
+		if err := ladon.ValidatePolicy(p); err != nil {
+			return nil, errors.Wrapf(err, "Could not load %s", name)
+		}
+	}
+	return policies, nil
+}
+
+// LoadPolicies returns the policies read by ReadPolicies. tb fails if they can not be read.
+func LoadPolicies(tb testing.TB, path string) ladon.Policies {
+	tb.Helper()
+
+	policies, err := ReadPolicies(path)
+	if err != nil {
+		tb.Fatalf("Could not load fixtures: %+v", err)
+	}
+	return policies
+}
+
+// MustParsePolicies returns the policies parsed by ParsePolicies. tb fails if they can not be parsed.
+func MustParsePolicies(tb testing.TB, fixtures string) ladon.Policies {
+	tb.Helper()
+
+	policies, err := ParsePolicies(fixtures)
+	if err != nil {
+		tb.Fatalf("Could not parse fixtures: %+v", err)
+	}
+	return policies
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+const fixtures = `
+id: read
+subjects: ["<.*>"]
+resources: ["articles:<.*>"]
+actions: [get]
+effect: allow
+---
+id: owner
+subjects: ["<.*>"]
+resources: ["articles:<.*>"]
+actions: [update]
+effect: allow
+conditions:
+  owner:
+    type: EqualsSubjectCondition
+`
+
+func TestFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladontest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "articles.yaml"), []byte(fixtures), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "admin.json"), []byte(`{"id": "admin", "subjects": ["admin"], "resources": ["<.*>"], "actions": ["<.*>"], "effect": "allow"}`), 0644))
+
+	policies := LoadPolicies(t, filepath.Join(dir, "articles.yaml"))
+	require.Len(t, policies, 2)
+	assert.Equal(t, "read", policies[0].GetID())
+	assert.Contains(t, policies[1].GetConditions(), "owner")
+
+	policies = LoadPolicies(t, dir)
+	require.Len(t, policies, 3)
+	assert.Equal(t, "admin", policies[0].GetID())
+
+	parsed := MustParsePolicies(t, fixtures)
+	require.Len(t, parsed, 2)
+
+	warden := &ladon.Ladon{Manager: NewManager(t, parsed...)}
+	require.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: ladon.Context{"owner": "peter"}}))
+	assert.Error(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: ladon.Context{"owner": "ken"}}))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+	_, err = ReadPolicies(filepath.Join(dir, "notes.txt"))
+	assert.Error(t, err)
+	_, err = ReadPolicies(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+	_, err = ParsePolicies("id: broken\neffect: maybe")
+	assert.Error(t, err)
+	_, err = ParsePolicies("id: [")
+	assert.Error(t, err)
+	_, err = ParsePolicies("id: invalid\neffect: allow\nsubjects: ['<[>']")
+	assert.Error(t, err)
+}
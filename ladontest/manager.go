@@ -0,0 +1,204 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+// Package ladontest provides test doubles for services using ladon: a deterministic in-memory Manager which is
+// seeded with fixtures and can be told to fail, a Warden stub with programmable decisions, and loaders for policy
+// fixtures written in YAML or JSON.
+//
+//	m := ladontest.NewManager(t, ladontest.LoadPolicies(t, "testdata/policies.yaml")...)
+//	m.Fail("FindRequestCandidates", errors.New("connection refused"))
+//
+//	w := ladontest.NewWarden().Allow("peter", "get", "").Deny("", "delete", "")
+//
+// It also runs tables of expected outcomes against a warden, for regression tests of policies:
+//
+//	ladontest.Expect(t, &ladon.Ladon{Manager: m},
+//		ladontest.Can("peter", "get", "articles:1"),
+//		ladontest.Cannot("ken", "delete", "articles:1"),
+//	)
+package ladontest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// Call is a call of a Manager method.
+type Call struct {
+	// Method is the name of the method, for example "Create".
+	Method string
+
+	// Arg is the argument of the call: the policy, the ID, the request, the subject or the resource. It is nil for
+	// GetAll.
+	Arg interface{}
+}
+
+// Manager is an in-memory ladon.Manager for tests. Policies are returned ordered by ID, so results do not depend on
+// the order fixtures were seeded in. It records the calls of the ladon.Manager methods and fails them on demand;
+// other methods of the embedded MemoryManager, such as CreateAll, are neither recorded nor failed.
+type Manager struct {
+	*memory.MemoryManager
+
+	calls    []Call
+	failures map[string]error
+	sync.Mutex
+}
+
+// NewManager returns a Manager seeded with fixtures. tb fails if a fixture is invalid or its ID is used twice.
+func NewManager(tb testing.TB, fixtures ...ladon.Policy) *Manager {
+	tb.Helper()
+
+	m := &Manager{MemoryManager: memory.NewMemoryManager(), failures: map[string]error{}}
+	if err := m.Seed(fixtures...); err != nil {
+		tb.Fatalf("Could not seed manager: %+v", err)
+	}
+	return m
+}
+
+// Seed stores fixtures without recording calls or failing. Policies without a version are stored with version 1.
+func (m *Manager) Seed(fixtures ...ladon.Policy) error {
+	for _, p := range fixtures {
+		if err := m.MemoryManager.Create(p); err != nil {
+			return errors.Wrapf(err, "Could not seed policy %s", p.GetID())
+		}
+	}
+	return nil
+}
+
+// Reset removes all policies, recorded calls and failures, and seeds fixtures. It must not be called concurrently
+// with other methods.
+func (m *Manager) Reset(fixtures ...ladon.Policy) error {
+	m.Lock()
+	m.MemoryManager = memory.NewMemoryManager()
+	m.calls = nil
+	m.failures = map[string]error{}
+	m.Unlock()
+	return m.Seed(fixtures...)
+}
+
+// Fail makes all following calls of method fail with err, until Fail is called with a nil error.
+func (m *Manager) Fail(method string, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err == nil {
+		delete(m.failures, method)
+		return
+	}
+	m.failures[method] = err
+}
+
+// Calls returns the recorded calls, oldest first.
+func (m *Manager) Calls() []Call {
+	m.Lock()
+	defer m.Unlock()
+	return append([]Call{}, m.calls...)
+}
+
+// CallsOf returns the recorded calls of method, oldest first.
+func (m *Manager) CallsOf(method string) []Call {
+	var calls []Call
+	for _, c := range m.Calls() {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// call records a call and returns the error the method is told to fail with.
+func (m *Manager) call(method string, arg interface{}) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.calls = append(m.calls, Call{Method: method, Arg: arg})
+	if err, ok := m.failures[method]; ok {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Create persists the policy.
+func (m *Manager) Create(policy ladon.Policy) error {
+	if err := m.call("Create", policy); err != nil {
+		return err
+	}
+	return m.MemoryManager.Create(policy)
+}
+
+// Update updates an existing policy.
+func (m *Manager) Update(policy ladon.Policy) error {
+	if err := m.call("Update", policy); err != nil {
+		return err
+	}
+	return m.MemoryManager.Update(policy)
+}
+
+// Get retrieves a policy.
+func (m *Manager) Get(id string) (ladon.Policy, error) {
+	if err := m.call("Get", id); err != nil {
+		return nil, err
+	}
+	return m.MemoryManager.Get(id)
+}
+
+// Delete removes a policy.
+func (m *Manager) Delete(id string) error {
+	if err := m.call("Delete", id); err != nil {
+		return err
+	}
+	return m.MemoryManager.Delete(id)
+}
+
+// GetAll retrieves all policies.
+func (m *Manager) GetAll(limit, offset int64) (ladon.Policies, error) {
+	if err := m.call("GetAll", nil); err != nil {
+		return nil, err
+	}
+	return m.MemoryManager.GetAll(limit, offset)
+}
+
+// FindRequestCandidates returns the policies of the request's tenant.
+func (m *Manager) FindRequestCandidates(r *ladon.Request) (ladon.Policies, error) {
+	if err := m.call("FindRequestCandidates", r); err != nil {
+		return nil, err
+	}
+	return m.MemoryManager.FindRequestCandidates(r)
+}
+
+// FindPoliciesForSubject returns all policies.
+func (m *Manager) FindPoliciesForSubject(subject string) (ladon.Policies, error) {
+	if err := m.call("FindPoliciesForSubject", subject); err != nil {
+		return nil, err
+	}
+	return m.MemoryManager.FindPoliciesForSubject(subject)
+}
+
+// FindPoliciesForResource returns all policies.
+func (m *Manager) FindPoliciesForResource(resource string) (ladon.Policies, error) {
+	if err := m.call("FindPoliciesForResource", resource); err != nil {
+		return nil, err
+	}
+	return m.MemoryManager.FindPoliciesForResource(resource)
+}
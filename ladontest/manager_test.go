@@ -0,0 +1,71 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+func TestManager(t *testing.T) {
+	m := NewManager(t,
+		&ladon.DefaultPolicy{ID: "2", Subjects: []string{"ken"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+		&ladon.DefaultPolicy{ID: "1", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+	)
+	assert.Empty(t, m.Calls())
+
+	policies, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, "1", policies[0].GetID())
+
+	warden := &ladon.Ladon{Manager: m}
+	require.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&ladon.Request{Subject: "ken", Action: "get", Resource: "articles:1"}))
+
+	calls := m.CallsOf("FindRequestCandidates")
+	require.Len(t, calls, 2)
+	assert.Equal(t, "ken", calls[1].Arg.(*ladon.Request).Subject)
+
+	unavailable := errors.New("connection refused")
+	m.Fail("FindRequestCandidates", unavailable)
+	err = warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"})
+	assert.Equal(t, unavailable, errors.Cause(err))
+	m.Fail("FindRequestCandidates", nil)
+	require.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+
+	m.Fail("Delete", unavailable)
+	assert.Error(t, m.Delete("1"))
+	_, err = m.Get("1")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Reset(&ladon.DefaultPolicy{ID: "3", Effect: ladon.AllowAccess}))
+	assert.Empty(t, m.Calls())
+	require.NoError(t, m.Delete("3"))
+	_, err = m.Get("1")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	assert.Error(t, m.Seed(&ladon.DefaultPolicy{ID: "4", Effect: "maybe"}))
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+// Any matches every subject, action or resource in the rules of a Warden.
+const Any = ""
+
+type rule struct {
+	match func(r *ladon.Request) bool
+	err   error
+}
+
+// Warden is a ladon.Warden stub with programmable decisions. Rules are checked in the order they were added and the
+// first rule matching a request decides it; requests no rule matches are decided by Default. It records all
+// requests.
+type Warden struct {
+	// Default is returned for requests which no rule matches. If nil, they are denied with ladon.ErrRequestDenied.
+	Default error
+
+	rules    []rule
+	requests []ladon.Request
+	sync.Mutex
+}
+
+// NewWarden returns a Warden denying all requests.
+func NewWarden() *Warden {
+	return &Warden{}
+}
+
+// AllowAll returns a Warden allowing all requests.
+func AllowAll() *Warden {
+	return NewWarden().Allow(Any, Any, Any)
+}
+
+func matches(subject, action, resource string) func(r *ladon.Request) bool {
+	return func(r *ladon.Request) bool {
+		return (subject == Any || subject == r.Subject) &&
+			(action == Any || action == r.Action) &&
+			(resource == Any || resource == r.Resource)
+	}
+}
+
+// Allow allows requests of subject to perform action on resource. Any matches every value.
+func (w *Warden) Allow(subject, action, resource string) *Warden {
+	return w.On(matches(subject, action, resource), nil)
+}
+
+// Deny denies requests of subject to perform action on resource with ladon.ErrRequestForcefullyDenied. Any matches
+// every value.
+func (w *Warden) Deny(subject, action, resource string) *Warden {
+	return w.On(matches(subject, action, resource), ladon.ErrRequestForcefullyDenied)
+}
+
+// Fail fails requests of subject to perform action on resource with err, for example to simulate an unavailable
+// manager. Any matches every value.
+func (w *Warden) Fail(subject, action, resource string, err error) *Warden {
+	return w.On(matches(subject, action, resource), err)
+}
+
+// On decides the requests for which match returns true: they are allowed if err is nil, and fail with err
+// otherwise.
+func (w *Warden) On(match func(r *ladon.Request) bool, err error) *Warden {
+	w.Lock()
+	defer w.Unlock()
+	w.rules = append(w.rules, rule{match: match, err: err})
+	return w
+}
+
+// IsAllowed returns nil if the first rule matching r allows it, and its error otherwise.
+func (w *Warden) IsAllowed(r *ladon.Request) error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.requests = append(w.requests, *r)
+	for _, rule := range w.rules {
+		if rule.match(r) {
+			if rule.err != nil {
+				return errors.WithStack(rule.err)
+			}
+			return nil
+		}
+	}
+
+	if w.Default != nil {
+		return errors.WithStack(w.Default)
+	}
+	return errors.WithStack(ladon.ErrRequestDenied)
+}
+
+// Requests returns the recorded requests, oldest first.
+func (w *Warden) Requests() []ladon.Request {
+	w.Lock()
+	defer w.Unlock()
+	return append([]ladon.Request{}, w.requests...)
+}
+
+// Reset removes all rules and recorded requests.
+func (w *Warden) Reset() {
+	w.Lock()
+	defer w.Unlock()
+	w.rules, w.requests = nil, nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladontest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+func TestWarden(t *testing.T) {
+	unavailable := errors.New("connection refused")
+	w := NewWarden().
+		Deny("ken", Any, Any).
+		Allow(Any, "get", Any).
+		Fail(Any, Any, "reports", unavailable).
+		On(func(r *ladon.Request) bool { return r.Context["owner"] == r.Subject }, nil)
+
+	var _ ladon.Warden = w
+	for k, tc := range []struct {
+		r   ladon.Request
+		err error
+	}{
+		{r: ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1"}},
+		{r: ladon.Request{Subject: "ken", Action: "get", Resource: "articles:1"}, err: ladon.ErrRequestForcefullyDenied},
+		{r: ladon.Request{Subject: "peter", Action: "delete", Resource: "reports"}, err: unavailable},
+		{r: ladon.Request{Subject: "peter", Action: "delete", Resource: "articles:1", Context: ladon.Context{"owner": "peter"}}},
+		{r: ladon.Request{Subject: "peter", Action: "delete", Resource: "articles:1"}, err: ladon.ErrRequestDenied},
+	} {
+		assert.Equal(t, tc.err, errors.Cause(w.IsAllowed(&tc.r)), "%d", k)
+	}
+
+	requests := w.Requests()
+	require.Len(t, requests, 5)
+	assert.Equal(t, "ken", requests[1].Subject)
+
+	w.Default = unavailable
+	assert.Equal(t, unavailable, errors.Cause(w.IsAllowed(&ladon.Request{Subject: "peter", Action: "delete"})))
+
+	w.Reset()
+	assert.Empty(t, w.Requests())
+	assert.Equal(t, unavailable, errors.Cause(w.IsAllowed(&ladon.Request{Subject: "peter", Action: "get"})))
+	assert.NoError(t, AllowAll().IsAllowed(&ladon.Request{Subject: "ken", Action: "delete"}))
+}
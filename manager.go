@@ -20,6 +20,10 @@
 
 package ladon
 
+import (
+	"context"
+)
+
 // Manager is responsible for managing and persisting policies.
 type Manager interface {
 
@@ -53,3 +57,36 @@ type Manager interface {
 	// If an error occurs, it returns nil and the error.
 	FindPoliciesForResource(resource string) (Policies, error)
 }
+
+// Closer is implemented by managers which run background work such as watches, so services can shut them down
+// cleanly.
+type Closer interface {
+	// Close stops background work and waits until in-flight calls finished or ctx is done. The manager must not
+	// be used afterwards.
+	Close(ctx context.Context) error
+}
+
+// Close closes m. Managers which do not implement Closer need no closing.
+func Close(ctx context.Context, m Manager) error {
+	if c, ok := m.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+// LiteralIndexer is implemented by managers which find candidates by looking up the literal subjects or resources
+// of requests in an index. Such lookups are case-sensitive, so Ladon refuses to use these managers with a matcher
+// which ignores case: a deny policy for "Peter" would never be a candidate for a request of "peter".
+type LiteralIndexer interface {
+	// IndexesLiterals returns true if the manager looks candidates up verbatim.
+	IndexesLiterals() bool
+}
+
+// IndexesLiterals returns true if m looks candidates up verbatim. Managers which do not implement LiteralIndexer
+// return all policies which could match a request.
+func IndexesLiterals(m Manager) bool {
+	if i, ok := m.(LiteralIndexer); ok {
+		return i.IndexesLiterals()
+	}
+	return false
+}
@@ -0,0 +1,501 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package badger provides an embedded Manager on top of BadgerDB, for agents which sync and evaluate tens of
+// thousands of policies locally and write often.
+//
+// Policies are stored as JSON below "<prefix>p/". Index keys below "<prefix>s/" and "<prefix>r/" point from
+// literal subjects and resources to the policies containing them, and from a reserved pattern key to all policies
+// with patterns (regular expressions, globs and hierarchies). Candidate lookups are prefix iterations over the
+// index, which only fetch keys.
+package badger
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// DB is the contract BadgerManager requires from BadgerDB. *badger.DB satisfies it once its transactions are wrapped,
+// where Iterate opens an iterator with the Prefix option and PrefetchValues disabled for keysOnly.
+type DB interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(Txn) error) error
+
+	// Update runs fn in a read-write transaction, which is discarded if fn returns an error.
+	Update(fn func(Txn) error) error
+
+	// RunValueLogGC rewrites a value log file if at least discardRatio of it can be discarded. It returns an
+	// error, for example badger.ErrNoRewrite, if nothing was rewritten.
+	RunValueLogGC(discardRatio float64) error
+}
+
+// Txn is a Badger transaction.
+type Txn interface {
+	// Get returns the value stored at key, or nil if the key does not exist.
+	Get(key []byte) ([]byte, error)
+
+	// Set stores value at key.
+	Set(key, value []byte) error
+
+	// Delete removes key.
+	Delete(key []byte) error
+
+	// Iterate calls fn for all keys with the given prefix in order, until fn returns false. If keysOnly is true,
+	// values are not fetched and fn receives nil values. Keys and values are only valid during the call.
+	Iterate(prefix []byte, keysOnly bool, fn func(key, value []byte) bool) error
+}
+
+// BadgerManager is a Manager storing policies in BadgerDB. Use NewBadgerManager to construct it.
+//
+// Badger detects conflicting transactions when they commit, so writes racing with other writes of the same
+// policy may fail with badger.ErrConflict and can be retried.
+type BadgerManager struct {
+	DB     DB
+	Prefix string
+
+	// GCInterval is the interval at which RunGC collects garbage in the value log. It defaults to five minutes.
+	GCInterval time.Duration
+
+	// GCDiscardRatio is passed to RunValueLogGC. It defaults to 0.5.
+	GCDiscardRatio float64
+}
+
+// NewBadgerManager initializes a new BadgerManager storing policies below prefix, for example "ladon/".
+func NewBadgerManager(db DB, prefix string) *BadgerManager {
+	return &BadgerManager{
+		DB:             db,
+		Prefix:         prefix,
+		GCInterval:     time.Minute * 5,
+		GCDiscardRatio: 0.5,
+	}
+}
+
+// patternKey is the index value of policies with at least one pattern. It can not collide with a literal
+// template, because valid UTF-8 never contains the byte 0xff.
+var patternKey = []byte{0xff}
+
+func (m *BadgerManager) key(kind string, parts ...[]byte) []byte {
+	key := append([]byte(m.Prefix), kind...)
+	for i, part := range parts {
+		if i > 0 {
+			key = append(key, 0)
+		}
+		key = append(key, part...)
+	}
+	return key
+}
+
+func (m *BadgerManager) policyKey(id string) []byte {
+	return m.key("p/", []byte(id))
+}
+
+// indexKeys returns the index keys of p: one per literal subject and resource and one per kind for all patterns.
+func (m *BadgerManager) indexKeys(p Policy) [][]byte {
+	var keys [][]byte
+	for kind, templates := range map[string][]string{"s/": p.GetSubjects(), "r/": p.GetResources()} {
+		pattern := false
+		for _, t := range templates {
+			if !IsLiteralTemplate(p, t) {
+				pattern = true
+				continue
+			}
+			keys = append(keys, m.key(kind, []byte(t), []byte(p.GetID())))
+		}
+
+		if pattern {
+			keys = append(keys, m.key(kind, patternKey, []byte(p.GetID())))
+		}
+	}
+	return keys
+}
+
+func (m *BadgerManager) get(txn Txn, id string) (Policy, error) {
+	payload, err := txn.Get(m.policyKey(id))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if payload == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return decode(payload)
+}
+
+func (m *BadgerManager) put(txn Txn, policy Policy) error {
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return errors.WithStack(err)
+	} else if err := txn.Set(m.policyKey(policy.GetID()), payload); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, key := range m.indexKeys(policy) {
+		if err := txn.Set(key, []byte{}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (m *BadgerManager) remove(txn Txn, policy Policy) error {
+	for _, key := range append(m.indexKeys(policy), m.policyKey(policy.GetID())) {
+		if err := txn.Delete(key); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Create persists the policy.
+func (m *BadgerManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	return m.DB.Update(func(txn Txn) error {
+		return m.create(txn, policy)
+	})
+}
+
+// CreateAll persists all policies in a single transaction. If one of them can not be created, none is. Badger
+// limits the size of transactions, so very large sets fail with badger.ErrTxnTooBig and must be split.
+func (m *BadgerManager) CreateAll(policies Policies) error {
+	for _, policy := range policies {
+		if err := AssignID(policy); err != nil {
+			return err
+		} else if err := ValidatePolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	return m.DB.Update(func(txn Txn) error {
+		for _, policy := range policies {
+			if err := m.create(txn, policy); err != nil {
+				return errors.Wrapf(err, "Could not create policy %s", policy.GetID())
+			}
+		}
+		return nil
+	})
+}
+
+func (m *BadgerManager) create(txn Txn, policy Policy) error {
+	if _, err := m.get(txn, policy.GetID()); err == nil {
+		return errors.WithStack(ErrPolicyExists)
+	} else if errors.Cause(err) != ErrNotFound {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+	return m.put(txn, policy)
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one.
+func (m *BadgerManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	return m.DB.Update(func(txn Txn) error {
+		return m.update(txn, policy)
+	})
+}
+
+func (m *BadgerManager) update(txn Txn, policy Policy) error {
+	stored, err := m.get(txn, policy.GetID())
+	if err != nil && errors.Cause(err) != ErrNotFound {
+		return err
+	} else if err == nil {
+		if err := m.remove(txn, stored); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok {
+		var current int
+		if s, ok := stored.(VersionedPolicy); ok {
+			current = s.GetVersion()
+		}
+
+		if v.GetVersion() != 0 && v.GetVersion() != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	return m.put(txn, policy)
+}
+
+// RunTransaction calls fn with a writer whose writes are applied in a single transaction once fn returns nil.
+// Badger limits the size of transactions, so transactions writing very many policies fail with
+// badger.ErrTxnTooBig.
+func (m *BadgerManager) RunTransaction(fn func(w PolicyWriter) error) error {
+	return m.DB.Update(func(txn Txn) error {
+		return fn(&writer{m: m, txn: txn})
+	})
+}
+
+// writer writes to a transaction.
+type writer struct {
+	m   *BadgerManager
+	txn Txn
+}
+
+func (w *writer) Get(id string) (Policy, error) {
+	return w.m.get(w.txn, id)
+}
+
+func (w *writer) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	} else if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+	return w.m.create(w.txn, policy)
+}
+
+func (w *writer) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+	return w.m.update(w.txn, policy)
+}
+
+func (w *writer) Delete(id string) error {
+	return w.m.delete(w.txn, id)
+}
+
+// Get retrieves a policy.
+func (m *BadgerManager) Get(id string) (p Policy, err error) {
+	err = m.DB.View(func(txn Txn) error {
+		p, err = m.get(txn, id)
+		return err
+	})
+	return p, err
+}
+
+// Delete removes a policy.
+func (m *BadgerManager) Delete(id string) error {
+	return m.DB.Update(func(txn Txn) error {
+		return m.delete(txn, id)
+	})
+}
+
+// DeleteAll removes the policies with the given IDs in a single transaction. IDs of missing policies are ignored.
+func (m *BadgerManager) DeleteAll(ids []string) error {
+	return m.DB.Update(func(txn Txn) error {
+		for _, id := range ids {
+			if err := m.delete(txn, id); err != nil {
+				return errors.Wrapf(err, "Could not delete policy %s", id)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *BadgerManager) delete(txn Txn, id string) error {
+	stored, err := m.get(txn, id)
+	if errors.Cause(err) == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return m.remove(txn, stored)
+}
+
+// Count returns the number of stored policies. Only keys are iterated, so values are not fetched.
+func (m *BadgerManager) Count() (count int64, err error) {
+	err = m.DB.View(func(txn Txn) error {
+		return errors.WithStack(txn.Iterate(m.key("p/"), true, func(_, _ []byte) bool {
+			count++
+			return true
+		}))
+	})
+	return count, err
+}
+
+// Exists returns true if a policy with the given ID is stored. The policy is not decoded.
+func (m *BadgerManager) Exists(id string) (exists bool, err error) {
+	err = m.DB.View(func(txn Txn) error {
+		payload, err := txn.Get(m.policyKey(id))
+		exists = payload != nil
+		return errors.WithStack(err)
+	})
+	return exists, err
+}
+
+// GetAll returns all policies, ordered by ID.
+func (m *BadgerManager) GetAll(limit, offset int64) (Policies, error) {
+	var ps Policies
+	err := m.DB.View(func(txn Txn) error {
+		var err error
+		iterErr := txn.Iterate(m.key("p/"), false, func(_, value []byte) bool {
+			var p Policy
+			if p, err = decode(value); err != nil {
+				return false
+			}
+			ps = append(ps, p)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(iterErr)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := pagination.Index(int(limit), int(offset), len(ps))
+	return ps[start:end], nil
+}
+
+// ForEach calls fn for every policy, ordered by ID, decoding one policy at a time. fn is called within a read
+// transaction and must not write to the manager.
+func (m *BadgerManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	return m.DB.View(func(txn Txn) error {
+		var err error
+		iterErr := txn.Iterate(m.key("p/"), false, func(_, value []byte) bool {
+			if err = errors.WithStack(ctx.Err()); err != nil {
+				return false
+			}
+
+			var p Policy
+			if p, err = decode(value); err != nil {
+				return false
+			}
+			err = fn(p)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(iterErr)
+	})
+}
+
+// find returns the policies containing value verbatim and all policies with patterns, according to the index
+// of kind.
+func (m *BadgerManager) find(kind, value string) (Policies, error) {
+	var ps Policies
+	err := m.DB.View(func(txn Txn) error {
+		var ids []string
+		seen := map[string]bool{}
+		for _, prefix := range [][]byte{m.key(kind, []byte(value), nil), m.key(kind, patternKey, nil)} {
+			err := txn.Iterate(prefix, true, func(key, _ []byte) bool {
+				if id := string(key[len(prefix):]); !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+				return true
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		for _, id := range ids {
+			p, err := m.get(txn, id)
+			if err != nil {
+				return err
+			}
+			ps = append(ps, p)
+		}
+		return nil
+	})
+	return ps, err
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *BadgerManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject.
+func (m *BadgerManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ps, err := m.FindPoliciesForSubject(r.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTenant(ps, r.Tenant), nil
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject pattern.
+func (m *BadgerManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.find("s/", subject)
+}
+
+// FindPoliciesForResource returns the policies containing the resource verbatim and all policies with at least
+// one resource pattern.
+func (m *BadgerManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.find("r/", resource)
+}
+
+// RunGC collects garbage in the value log every GCInterval until ctx is canceled. Each run rewrites value log
+// files until RunValueLogGC reports that nothing was rewritten, as recommended by Badger.
+func (m *BadgerManager) RunGC(ctx context.Context) error {
+	ticker := time.NewTicker(m.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				if err := m.DB.RunValueLogGC(m.GCDiscardRatio); err != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Ping opens a read-only transaction, which fails if the DB was closed.
+func (m *BadgerManager) Ping(ctx context.Context) error {
+	return m.DB.View(func(txn Txn) error {
+		return nil
+	})
+}
+
+// Close does nothing. The DB is not closed, because it is owned by the caller.
+func (m *BadgerManager) Close(ctx context.Context) error {
+	return nil
+}
+
+func decode(payload []byte) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package badger
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+// fakeDB is an in-memory DB. Update works on a copy, which is discarded if the transaction fails.
+type fakeDB struct {
+	sync.Mutex
+	data       map[string][]byte
+	reads      int
+	rewritable int
+	gcRuns     int
+}
+
+type fakeTxn struct {
+	db   *fakeDB
+	data map[string][]byte
+}
+
+func (db *fakeDB) View(fn func(Txn) error) error {
+	db.Lock()
+	defer db.Unlock()
+	return fn(&fakeTxn{db: db, data: db.data})
+}
+
+func (db *fakeDB) Update(fn func(Txn) error) error {
+	db.Lock()
+	defer db.Unlock()
+
+	data := make(map[string][]byte, len(db.data))
+	for k, v := range db.data {
+		data[k] = v
+	}
+
+	if err := fn(&fakeTxn{db: db, data: data}); err != nil {
+		return err
+	}
+	db.data = data
+	return nil
+}
+
+func (db *fakeDB) RunValueLogGC(discardRatio float64) error {
+	db.Lock()
+	defer db.Unlock()
+	db.gcRuns++
+	if db.rewritable == 0 {
+		return errors.New("Value log GC attempt didn't result in any cleanup")
+	}
+	db.rewritable--
+	return nil
+}
+
+func (txn *fakeTxn) Get(key []byte) ([]byte, error) {
+	txn.db.reads++
+	return txn.data[string(key)], nil
+}
+
+func (txn *fakeTxn) Set(key, value []byte) error {
+	txn.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (txn *fakeTxn) Delete(key []byte) error {
+	delete(txn.data, string(key))
+	return nil
+}
+
+func (txn *fakeTxn) Iterate(prefix []byte, keysOnly bool, fn func(key, value []byte) bool) error {
+	var keys []string
+	for k := range txn.data {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var value []byte
+		if !keysOnly {
+			txn.db.reads++
+			value = txn.data[k]
+		}
+		if !fn([]byte(k), value) {
+			break
+		}
+	}
+	return nil
+}
+
+func ids(t *testing.T, ps ladon.Policies, err error) []string {
+	require.NoError(t, err)
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.GetID())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestBadgerManager(t *testing.T) {
+	db := &fakeDB{data: map[string][]byte{}}
+	m := NewBadgerManager(db, "ladon/")
+	for _, p := range []*ladon.DefaultPolicy{
+		{ID: "1", Subjects: []string{"peter", "max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+		{ID: "2", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+		{ID: "3", Subjects: []string{"ken"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Tenant: "acme"},
+		{ID: "4", Subjects: []string{"team:*"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeGlob},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	_, err := m.Get("5")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter", "max"}, got.GetSubjects())
+
+	ps, err := m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"1", "2", "4"}, ids(t, ps, err))
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})
+	assert.Equal(t, []string{"3"}, ids(t, ps, err))
+	ps, err = m.FindPoliciesForResource("users:1")
+	assert.Equal(t, []string{"2", "3", "4"}, ids(t, ps, err))
+
+	// Candidate lookups only read the indexed policies.
+	db.reads = 0
+	_, err = m.FindPoliciesForSubject("max")
+	require.NoError(t, err)
+	assert.Equal(t, 3, db.reads)
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}))
+	ps, err = m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"2", "4"}, ids(t, ps, err))
+
+	stale := &ladon.DefaultPolicy{ID: "1", Version: 1, Subjects: []string{"peter"}, Effect: ladon.AllowAccess}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(stale)))
+
+	require.NoError(t, m.Delete("2"))
+	require.NoError(t, m.Delete("2"))
+	ps, err = m.FindPoliciesForSubject("max")
+	assert.Equal(t, []string{"1", "4"}, ids(t, ps, err))
+
+	all, err := m.GetAll(10, 1)
+	assert.Equal(t, []string{"3", "4"}, ids(t, all, err))
+
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	var streamed []string
+	require.NoError(t, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		streamed = append(streamed, p.GetID())
+		return nil
+	}))
+	assert.Equal(t, []string{"1", "3", "4"}, streamed)
+	exists, err := m.Exists("2")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = m.Exists("3")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Nothing but the policies of other prefixes is left after deleting everything.
+	db.data["other/p/1"] = []byte("{}")
+	for _, id := range []string{"1", "3", "4"} {
+		require.NoError(t, m.Delete(id))
+	}
+	for k := range db.data {
+		assert.True(t, bytes.HasPrefix([]byte(k), []byte("other/")), k)
+	}
+}
+
+func TestBadgerManagerRunGC(t *testing.T) {
+	db := &fakeDB{data: map[string][]byte{}, rewritable: 3}
+	m := NewBadgerManager(db, "ladon/")
+	m.GCInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- m.RunGC(ctx) }()
+
+	for i := 0; i < 1000; i++ {
+		db.Lock()
+		runs := db.gcRuns
+		db.Unlock()
+		if runs >= 5 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(<-stopped))
+
+	db.Lock()
+	defer db.Unlock()
+	assert.Equal(t, 0, db.rewritable)
+	assert.True(t, db.gcRuns >= 5)
+}
@@ -0,0 +1,470 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package bolt provides an embedded, file-backed Manager on top of bbolt, for single-binary deployments which need
+// persistence without an external datastore.
+//
+// Policies are stored as JSON in one bucket. Two more buckets index the policies by their literal subjects and
+// resources, so candidate lookups only read the policies which contain the subject or resource verbatim, and all
+// policies with patterns (regular expressions, globs and hierarchies).
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// DB is the contract BoltManager requires from bbolt. *bbolt.DB only needs its transactions and buckets wrapped to
+// return these interfaces; *bbolt.Cursor satisfies Cursor as is.
+type DB interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(Tx) error) error
+
+	// Update runs fn in a read-write transaction, which is rolled back if fn returns an error.
+	Update(fn func(Tx) error) error
+}
+
+// Tx is a bbolt transaction.
+type Tx interface {
+	// Bucket returns the bucket with the given name, or nil if it does not exist.
+	Bucket(name []byte) Bucket
+
+	// CreateBucketIfNotExists returns the bucket with the given name, creating it if necessary.
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+}
+
+// Bucket is a bbolt bucket. Values returned by it are only valid during the transaction.
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Cursor() Cursor
+}
+
+// Cursor iterates the keys of a bucket in order. It returns a nil key once the end is reached.
+type Cursor interface {
+	First() (key, value []byte)
+	Seek(seek []byte) (key, value []byte)
+	Next() (key, value []byte)
+}
+
+var (
+	bucketPolicies  = []byte("ladon_policies")
+	bucketSubjects  = []byte("ladon_subjects")
+	bucketResources = []byte("ladon_resources")
+)
+
+// BoltManager is a Manager storing policies in bbolt.
+type BoltManager struct {
+	DB DB
+}
+
+// NewBoltManager initializes a new BoltManager, creating its buckets if necessary.
+func NewBoltManager(db DB) (*BoltManager, error) {
+	err := db.Update(func(tx Tx) error {
+		for _, name := range [][]byte{bucketPolicies, bucketSubjects, bucketResources} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltManager{DB: db}, nil
+}
+
+// patternKey is the prefix of the index keys of policies with at least one pattern. It can not collide with a
+// literal template, because valid UTF-8 never contains the byte 0xff.
+var patternKey = []byte{0xff}
+
+// indexKeys returns the index keys of templates: one per literal template and one for all patterns.
+func indexKeys(p Policy, templates []string) [][]byte {
+	var keys [][]byte
+	pattern := false
+	for _, t := range templates {
+		if !IsLiteralTemplate(p, t) {
+			pattern = true
+			continue
+		}
+		keys = append(keys, indexKey([]byte(t), p.GetID()))
+	}
+
+	if pattern {
+		keys = append(keys, indexKey(patternKey, p.GetID()))
+	}
+	return keys
+}
+
+func indexKey(value []byte, id string) []byte {
+	key := make([]byte, 0, len(value)+1+len(id))
+	key = append(key, value...)
+	key = append(key, 0)
+	return append(key, id...)
+}
+
+// index adds (or, if remove is true, removes) the index keys of p.
+func index(tx Tx, p Policy, remove bool) error {
+	for name, templates := range map[string][]string{string(bucketSubjects): p.GetSubjects(), string(bucketResources): p.GetResources()} {
+		b := tx.Bucket([]byte(name))
+		for _, key := range indexKeys(p, templates) {
+			var err error
+			if remove {
+				err = b.Delete(key)
+			} else {
+				err = b.Put(key, []byte{})
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+func get(tx Tx, id string) (Policy, error) {
+	payload := tx.Bucket(bucketPolicies).Get([]byte(id))
+	if payload == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return decode(payload)
+}
+
+func put(tx Tx, policy Policy) error {
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return errors.WithStack(err)
+	} else if err := tx.Bucket(bucketPolicies).Put([]byte(policy.GetID()), payload); err != nil {
+		return errors.WithStack(err)
+	}
+	return index(tx, policy, false)
+}
+
+// Create persists the policy.
+func (m *BoltManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	return m.DB.Update(func(tx Tx) error {
+		return create(tx, policy)
+	})
+}
+
+// CreateAll persists all policies in a single transaction. If one of them can not be created, none is.
+func (m *BoltManager) CreateAll(policies Policies) error {
+	for _, policy := range policies {
+		if err := AssignID(policy); err != nil {
+			return err
+		} else if err := ValidatePolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	return m.DB.Update(func(tx Tx) error {
+		for _, policy := range policies {
+			if err := create(tx, policy); err != nil {
+				return errors.Wrapf(err, "Could not create policy %s", policy.GetID())
+			}
+		}
+		return nil
+	})
+}
+
+func create(tx Tx, policy Policy) error {
+	if tx.Bucket(bucketPolicies).Get([]byte(policy.GetID())) != nil {
+		return errors.WithStack(ErrPolicyExists)
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+	return put(tx, policy)
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one.
+func (m *BoltManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	return m.DB.Update(func(tx Tx) error {
+		return update(tx, policy)
+	})
+}
+
+func update(tx Tx, policy Policy) error {
+	stored, err := get(tx, policy.GetID())
+	if err != nil && errors.Cause(err) != ErrNotFound {
+		return err
+	} else if err == nil {
+		if err := index(tx, stored, true); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok {
+		var current int
+		if s, ok := stored.(VersionedPolicy); ok {
+			current = s.GetVersion()
+		}
+
+		if v.GetVersion() != 0 && v.GetVersion() != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	return put(tx, policy)
+}
+
+// RunTransaction calls fn with a writer whose writes are applied in a single transaction once fn returns nil.
+func (m *BoltManager) RunTransaction(fn func(w PolicyWriter) error) error {
+	return m.DB.Update(func(tx Tx) error {
+		return fn(&writer{tx: tx})
+	})
+}
+
+// writer writes to a transaction.
+type writer struct {
+	tx Tx
+}
+
+func (w *writer) Get(id string) (Policy, error) {
+	return get(w.tx, id)
+}
+
+func (w *writer) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	} else if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+	return create(w.tx, policy)
+}
+
+func (w *writer) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+	return update(w.tx, policy)
+}
+
+func (w *writer) Delete(id string) error {
+	return remove(w.tx, id)
+}
+
+// Get retrieves a policy.
+func (m *BoltManager) Get(id string) (p Policy, err error) {
+	err = m.DB.View(func(tx Tx) error {
+		p, err = get(tx, id)
+		return err
+	})
+	return p, err
+}
+
+// Delete removes a policy.
+func (m *BoltManager) Delete(id string) error {
+	return m.DB.Update(func(tx Tx) error {
+		return remove(tx, id)
+	})
+}
+
+// DeleteAll removes the policies with the given IDs in a single transaction. IDs of missing policies are ignored.
+func (m *BoltManager) DeleteAll(ids []string) error {
+	return m.DB.Update(func(tx Tx) error {
+		for _, id := range ids {
+			if err := remove(tx, id); err != nil {
+				return errors.Wrapf(err, "Could not delete policy %s", id)
+			}
+		}
+		return nil
+	})
+}
+
+func remove(tx Tx, id string) error {
+	stored, err := get(tx, id)
+	if errors.Cause(err) == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := index(tx, stored, true); err != nil {
+		return err
+	}
+	return errors.WithStack(tx.Bucket(bucketPolicies).Delete([]byte(id)))
+}
+
+// Count returns the number of stored policies. The keys are counted without decoding the policies.
+func (m *BoltManager) Count() (count int64, err error) {
+	err = m.DB.View(func(tx Tx) error {
+		c := tx.Bucket(bucketPolicies).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Exists returns true if a policy with the given ID is stored. The policy is not decoded.
+func (m *BoltManager) Exists(id string) (exists bool, err error) {
+	err = m.DB.View(func(tx Tx) error {
+		exists = tx.Bucket(bucketPolicies).Get([]byte(id)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// GetAll returns all policies, ordered by ID.
+func (m *BoltManager) GetAll(limit, offset int64) (Policies, error) {
+	var ps Policies
+	err := m.DB.View(func(tx Tx) error {
+		c := tx.Bucket(bucketPolicies).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			p, err := decode(v)
+			if err != nil {
+				return err
+			}
+			ps = append(ps, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := pagination.Index(int(limit), int(offset), len(ps))
+	return ps[start:end], nil
+}
+
+// ForEach calls fn for every policy, ordered by ID, decoding one policy at a time. fn is called within a read
+// transaction and must not write to the manager.
+func (m *BoltManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	return m.DB.View(func(tx Tx) error {
+		c := tx.Bucket(bucketPolicies).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+
+			p, err := decode(v)
+			if err != nil {
+				return err
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// find returns the policies containing value verbatim and all policies with patterns, according to the index
+// in bucket.
+func (m *BoltManager) find(bucket []byte, value string) (Policies, error) {
+	var ps Policies
+	err := m.DB.View(func(tx Tx) error {
+		seen := map[string]bool{}
+		c := tx.Bucket(bucket).Cursor()
+		for _, prefix := range [][]byte{indexKey([]byte(value), ""), indexKey(patternKey, "")} {
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				id := string(k[len(prefix):])
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				p, err := get(tx, id)
+				if err != nil {
+					return err
+				}
+				ps = append(ps, p)
+			}
+		}
+		return nil
+	})
+	return ps, err
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *BoltManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject.
+func (m *BoltManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ps, err := m.FindPoliciesForSubject(r.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTenant(ps, r.Tenant), nil
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject pattern.
+func (m *BoltManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.find(bucketSubjects, subject)
+}
+
+// FindPoliciesForResource returns the policies containing the resource verbatim and all policies with at least
+// one resource pattern.
+func (m *BoltManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.find(bucketResources, resource)
+}
+
+// Ping opens a read-only transaction and checks that the buckets exist, which fails if the DB was closed.
+func (m *BoltManager) Ping(ctx context.Context) error {
+	return m.DB.View(func(tx Tx) error {
+		for _, name := range [][]byte{bucketPolicies, bucketSubjects, bucketResources} {
+			if tx.Bucket(name) == nil {
+				return errors.Errorf("Bucket %s does not exist", name)
+			}
+		}
+		return nil
+	})
+}
+
+// Close does nothing. The DB is not closed, because it is owned by the caller.
+func (m *BoltManager) Close(ctx context.Context) error {
+	return nil
+}
+
+func decode(payload []byte) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
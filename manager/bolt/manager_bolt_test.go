@@ -0,0 +1,320 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package bolt
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+// fakeDB is an in-memory DB. Update works on a copy, which is discarded if the transaction fails.
+type fakeDB struct {
+	sync.RWMutex
+	buckets map[string]map[string][]byte
+	reads   int
+}
+
+type fakeTx struct {
+	db      *fakeDB
+	buckets map[string]map[string][]byte
+}
+
+type fakeBucket struct {
+	tx   *fakeTx
+	data map[string][]byte
+}
+
+type fakeCursor struct {
+	keys []string
+	data map[string][]byte
+	pos  int
+}
+
+func (db *fakeDB) View(fn func(Tx) error) error {
+	db.RLock()
+	defer db.RUnlock()
+	return fn(&fakeTx{db: db, buckets: db.buckets})
+}
+
+func (db *fakeDB) Update(fn func(Tx) error) error {
+	db.Lock()
+	defer db.Unlock()
+
+	buckets := map[string]map[string][]byte{}
+	for name, data := range db.buckets {
+		buckets[name] = map[string][]byte{}
+		for k, v := range data {
+			buckets[name][k] = v
+		}
+	}
+
+	if err := fn(&fakeTx{db: db, buckets: buckets}); err != nil {
+		return err
+	}
+	db.buckets = buckets
+	return nil
+}
+
+func (tx *fakeTx) Bucket(name []byte) Bucket {
+	data, ok := tx.buckets[string(name)]
+	if !ok {
+		return nil
+	}
+	return &fakeBucket{tx: tx, data: data}
+}
+
+func (tx *fakeTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if _, ok := tx.buckets[string(name)]; !ok {
+		tx.buckets[string(name)] = map[string][]byte{}
+	}
+	return tx.Bucket(name), nil
+}
+
+func (b *fakeBucket) Get(key []byte) []byte {
+	b.tx.db.reads++
+	return b.data[string(key)]
+}
+
+func (b *fakeBucket) Put(key, value []byte) error {
+	b.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *fakeBucket) Delete(key []byte) error {
+	delete(b.data, string(key))
+	return nil
+}
+
+func (b *fakeBucket) Cursor() Cursor {
+	keys := make([]string, 0, len(b.data))
+	for k := range b.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &fakeCursor{keys: keys, data: b.data}
+}
+
+func (c *fakeCursor) at() ([]byte, []byte) {
+	if c.pos >= len(c.keys) {
+		return nil, nil
+	}
+	return []byte(c.keys[c.pos]), c.data[c.keys[c.pos]]
+}
+
+func (c *fakeCursor) First() ([]byte, []byte) {
+	c.pos = 0
+	return c.at()
+}
+
+func (c *fakeCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.pos = sort.SearchStrings(c.keys, string(seek))
+	return c.at()
+}
+
+func (c *fakeCursor) Next() ([]byte, []byte) {
+	c.pos++
+	return c.at()
+}
+
+func newManager(t *testing.T) (*BoltManager, *fakeDB) {
+	db := &fakeDB{buckets: map[string]map[string][]byte{}}
+	m, err := NewBoltManager(db)
+	require.NoError(t, err)
+	return m, db
+}
+
+func TestBoltManager(t *testing.T) {
+	m, _ := newManager(t)
+	p := &ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess,
+		Conditions: ladon.Conditions{"owner": &ladon.EqualsSubjectCondition{}}}
+
+	_, err := m.Get("1")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	require.NoError(t, m.Create(p))
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(p)))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, p, got)
+
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+	exists, err := m.Exists("1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = m.Exists("2")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	stop := errors.New("stop")
+	var streamed ladon.Policies
+	assert.Equal(t, stop, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		streamed = append(streamed, p)
+		return stop
+	}))
+	assert.Equal(t, ladon.Policies{p}, streamed)
+
+	// Reopening the database keeps the policies.
+	m, err = NewBoltManager(m.DB)
+	require.NoError(t, err)
+	_, err = m.Get("1")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Delete("1"))
+	_, err = m.Get("1")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+}
+
+func TestBoltManagerIndex(t *testing.T) {
+	m, db := newManager(t)
+	for _, p := range []*ladon.DefaultPolicy{
+		{ID: "1", Subjects: []string{"peter", "max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+		{ID: "2", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+		{ID: "3", Subjects: []string{"ken"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Tenant: "acme"},
+		{ID: "4", Subjects: []string{"team:*"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeGlob},
+		{ID: "5", Subjects: []string{""}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeExact},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	ids := func(ps ladon.Policies, err error) []string {
+		require.NoError(t, err)
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.GetID())
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	assert.Equal(t, []string{"1", "2", "4"}, ids(m.FindPoliciesForSubject("peter")))
+	assert.Equal(t, []string{"2", "3", "4"}, ids(m.FindPoliciesForSubject("ken")))
+	assert.Equal(t, []string{"2", "4", "5"}, ids(m.FindPoliciesForSubject("")))
+	assert.Equal(t, []string{"3"}, ids(m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})))
+	assert.Equal(t, []string{"2", "3", "4", "5"}, ids(m.FindPoliciesForResource("users:1")))
+	assert.Equal(t, []string{"1", "2"}, ids(m.FindPoliciesForResource("articles:1")))
+
+	// Candidate lookups only read the indexed policies.
+	db.reads = 0
+	_, err := m.FindPoliciesForSubject("max")
+	require.NoError(t, err)
+	assert.Equal(t, 3, db.reads)
+
+	// Updates and deletes maintain the index.
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}))
+	assert.Equal(t, []string{"2", "4"}, ids(m.FindPoliciesForSubject("peter")))
+	assert.Equal(t, []string{"1", "2", "4"}, ids(m.FindPoliciesForSubject("max")))
+
+	require.NoError(t, m.Delete("2"))
+	require.NoError(t, m.Delete("2"))
+	assert.Equal(t, []string{"1", "4"}, ids(m.FindPoliciesForSubject("max")))
+
+	all, err := m.GetAll(2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, ids(all, nil))
+}
+
+func TestBoltManagerVersions(t *testing.T) {
+	m, _ := newManager(t)
+	p := &ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}
+	require.NoError(t, m.Create(p))
+	assert.Equal(t, 1, p.Version)
+
+	stale := *p
+	require.NoError(t, m.Update(p))
+	assert.Equal(t, 2, p.Version)
+
+	stale.Subjects = []string{"max"}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(&stale)))
+
+	// The failed update was rolled back.
+	ps, err := m.FindPoliciesForSubject("max")
+	require.NoError(t, err)
+	assert.Empty(t, ps)
+}
+
+func TestBoltManagerBulk(t *testing.T) {
+	m, _ := newManager(t)
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "3", Subjects: []string{"ken"}, Effect: ladon.AllowAccess}))
+
+	err := m.CreateAll(ladon.Policies{
+		&ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "3", Subjects: []string{"ken"}, Effect: ladon.AllowAccess},
+	})
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(err))
+	_, err = m.Get("1")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err), "failed bulk writes are rolled back")
+
+	require.NoError(t, m.CreateAll(ladon.Policies{
+		&ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess},
+		&ladon.DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Effect: ladon.DenyAccess},
+	}))
+	ps, err := m.FindPoliciesForSubject("peter")
+	require.NoError(t, err)
+	assert.Len(t, ps, 2)
+
+	require.NoError(t, m.DeleteAll([]string{"1", "2", "4"}))
+	ps, err = m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, ps, 1)
+	assert.Equal(t, "3", ps[0].GetID())
+
+	ps, err = m.FindPoliciesForSubject("peter")
+	require.NoError(t, err)
+	assert.Empty(t, ps, "deletes remove the index keys")
+}
+
+func TestBoltManagerTransaction(t *testing.T) {
+	m, _ := newManager(t)
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}))
+
+	err := m.RunTransaction(func(w ladon.PolicyWriter) error {
+		if err := w.Delete("1"); err != nil {
+			return err
+		}
+		return w.Update(&ladon.DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Effect: "maybe"})
+	})
+	assert.Error(t, err)
+	_, err = m.Get("1")
+	require.NoError(t, err, "failed transactions are rolled back")
+
+	require.NoError(t, m.RunTransaction(func(w ladon.PolicyWriter) error {
+		if err := w.Delete("1"); err != nil {
+			return err
+		}
+		return w.Create(&ladon.DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Effect: ladon.AllowAccess})
+	}))
+
+	ps, err := m.FindPoliciesForSubject("peter")
+	require.NoError(t, err)
+	require.Len(t, ps, 1)
+	assert.Equal(t, "2", ps[0].GetID())
+}
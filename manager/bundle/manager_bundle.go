@@ -0,0 +1,425 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package bundle provides a read-only Manager serving a policy bundle which is published to object storage such as
+// Amazon S3 or Google Cloud Storage. Services poll the bundle and evaluate requests against the policies in memory,
+// so the object store is never on the path of a decision.
+//
+// A bundle is a single object: a JSON or YAML document with a policy or a list of policies, or a tar archive of
+// such files, each optionally compressed with gzip. Bundles are signed with Ed25519 over their revision and the
+// bytes of the object, and the signature and revision are stored next to it, for example as object metadata.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/file"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// Object is a bundle fetched from object storage.
+type Object struct {
+	// Name is the key of the object. Its extension chooses the format of bundles which are not tar archives, for
+	// example "policies.yaml". It defaults to JSON.
+	Name string
+
+	Body []byte
+
+	// ETag identifies the content of the object, for example the ETag of an S3 object or the generation of a GCS
+	// object.
+	ETag string
+
+	// Revision numbers the published bundles. It must increase with every bundle, so that an older bundle can not
+	// be published again. It is read from the object metadata, like Signature.
+	Revision uint64
+
+	// Signature is the Ed25519 signature of Revision and Body, for example read from the object metadata.
+	Signature []byte
+}
+
+// MaxBundleSize limits the size of a decompressed bundle, so a small compressed object can not exhaust the memory.
+var MaxBundleSize int64 = 64 << 20
+
+// Store fetches the bundle. It is implemented on top of a GetObject request with If-None-Match for S3, or a reader
+// of an object handle with a GenerationNotMatch condition for GCS.
+type Store interface {
+	// Fetch returns the bundle, or nil if its ETag still equals etag. An empty etag always fetches the bundle.
+	Fetch(ctx context.Context, etag string) (*Object, error)
+}
+
+// Sign returns the signature of the bundle revision with body made with key, which is stored with the bundle for
+// BundleManager to verify.
+func Sign(revision uint64, body []byte, key ed25519.PrivateKey) ([]byte, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.Errorf("Ed25519 private key must be %d bytes long, got %d", ed25519.PrivateKeySize, len(key))
+	}
+	return ed25519.Sign(key, signed(revision, body)), nil
+}
+
+// signed returns the message which is signed: the revision in big endian, followed by body.
+func signed(revision uint64, body []byte) []byte {
+	message := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint64(message, revision)
+	return append(message, body...)
+}
+
+func checkPublicKey(key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return errors.Errorf("Ed25519 public key must be %d bytes long, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return nil
+}
+
+// Decode decodes the policies of a bundle. name chooses the format of bundles which are neither tar archives nor
+// compressed.
+func Decode(name string, body []byte) (Policies, error) {
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		body, err = ioutil.ReadAll(io.LimitReader(r, MaxBundleSize+1))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		} else if int64(len(body)) > MaxBundleSize {
+			return nil, errors.Errorf("Decompressed bundle exceeds %d bytes", MaxBundleSize)
+		}
+	}
+
+	// The magic of tar archives follows the header of the first file.
+	if len(body) > 262 && string(body[257:262]) == "ustar" {
+		return decodeTar(body)
+	}
+
+	if !file.IsPolicyFile(name) {
+		name = "bundle.json"
+	}
+	return file.Decode(name, body)
+}
+
+func decodeTar(body []byte) (Policies, error) {
+	var out Policies
+	r := tar.NewReader(bytes.NewReader(body))
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// Archives created on macOS contain metadata files next to each file.
+		if header.Typeflag != tar.TypeReg || !file.IsPolicyFile(header.Name) || path.Base(header.Name)[0] == '.' {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		ps, err := file.Decode(header.Name, content)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ps...)
+	}
+}
+
+// BundleManager is a read-only Manager serving the policies of a bundle. Use NewBundleManager to construct it and
+// Watch to refresh the bundle periodically.
+type BundleManager struct {
+	Store Store
+
+	// PublicKey verifies the signatures of bundles. Bundles without a valid signature are rejected. It is required
+	// unless Insecure is set.
+	PublicKey ed25519.PublicKey
+
+	// Insecure serves bundles without checking their signatures if PublicKey is nil. Anyone who can write to the
+	// bucket can then change the policies, so it is only meant for tests and local development.
+	Insecure bool
+
+	// Interval is the time between two refreshes by Watch. It defaults to 30 seconds.
+	Interval time.Duration
+
+	// Timeout limits a single refresh. It defaults to 30 seconds.
+	Timeout time.Duration
+
+	// OnRefresh is called by Watch after every refresh. If the bundle can not be loaded, err is set and the
+	// previous policies are kept.
+	OnRefresh func(etag string, err error)
+
+	policies *memory.MemoryManager
+	etag     string
+	revision uint64
+	sync.RWMutex
+
+	// syncing serializes refreshes, because a slower fetch must not replace a bundle which was loaded meanwhile.
+	syncing sync.Mutex
+
+	closed  bool
+	closing chan struct{}
+	running sync.WaitGroup
+}
+
+// NewBundleManager returns a BundleManager serving the bundle of store, whose signatures are verified with key. It
+// fails if the key is malformed or the bundle can not be loaded.
+func NewBundleManager(store Store, key ed25519.PublicKey) (*BundleManager, error) {
+	if err := checkPublicKey(key); err != nil {
+		return nil, err
+	}
+	return newBundleManager(&BundleManager{Store: store, PublicKey: key})
+}
+
+// NewInsecureBundleManager returns a BundleManager serving the bundle of store without checking its signature. See
+// Insecure.
+func NewInsecureBundleManager(store Store) (*BundleManager, error) {
+	return newBundleManager(&BundleManager{Store: store, Insecure: true})
+}
+
+func newBundleManager(m *BundleManager) (*BundleManager, error) {
+	m.Interval = time.Second * 30
+	m.Timeout = time.Second * 30
+	m.policies = memory.NewMemoryManager()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ETag returns the ETag of the served bundle.
+func (m *BundleManager) ETag() string {
+	m.RLock()
+	defer m.RUnlock()
+	return m.etag
+}
+
+// Revision returns the revision of the served bundle.
+func (m *BundleManager) Revision() uint64 {
+	m.RLock()
+	defer m.RUnlock()
+	return m.revision
+}
+
+// Refresh fetches the bundle unless its ETag did not change, and replaces the served policies with it. If the
+// bundle can not be fetched, verified or decoded, is older than the served bundle, or a policy is invalid, the served
+// policies are left untouched.
+func (m *BundleManager) Refresh(ctx context.Context) error {
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+
+	if m.PublicKey != nil || !m.Insecure {
+		if err := checkPublicKey(m.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	obj, err := m.Store.Fetch(ctx, m.ETag())
+	if err != nil {
+		return errors.WithStack(err)
+	} else if obj == nil {
+		return nil
+	}
+
+	if m.PublicKey != nil && !ed25519.Verify(m.PublicKey, signed(obj.Revision, obj.Body), obj.Signature) {
+		return errors.Errorf("Signature of bundle %s with ETag %s is invalid", obj.Name, obj.ETag)
+	}
+
+	m.RLock()
+	revision := m.revision
+	m.RUnlock()
+	if obj.Revision < revision {
+		return errors.Errorf("Bundle %s with ETag %s has revision %d, which is older than the served revision %d", obj.Name, obj.ETag, obj.Revision, revision)
+	}
+
+	ps, err := Decode(obj.Name, obj.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Could not decode bundle %s", obj.Name)
+	}
+
+	policies := memory.NewMemoryManager()
+	if err := policies.CreateAll(ps); err != nil {
+		return errors.Wrapf(err, "Could not load bundle %s", obj.Name)
+	}
+
+	m.Lock()
+	m.policies = policies
+	m.etag = obj.ETag
+	m.revision = obj.Revision
+	m.Unlock()
+	return nil
+}
+
+// Watch refreshes the bundle every Interval until ctx is canceled or the manager is closed.
+func (m *BundleManager) Watch(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return errors.WithStack(ErrManagerClosed)
+	}
+	m.lifecycle()
+	m.running.Add(1)
+	closing := m.closing
+	m.Unlock()
+	defer m.running.Done()
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-closing:
+			return nil
+		case <-ticker.C:
+		}
+
+		refreshCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+		err := m.Refresh(refreshCtx)
+		cancel()
+		if m.OnRefresh != nil {
+			m.OnRefresh(m.ETag(), err)
+		}
+	}
+}
+
+// lifecycle initializes the channel used by Close. The lock must be held.
+func (m *BundleManager) lifecycle() {
+	if m.closing == nil {
+		m.closing = make(chan struct{})
+	}
+}
+
+func (m *BundleManager) current() *memory.MemoryManager {
+	m.RLock()
+	defer m.RUnlock()
+	return m.policies
+}
+
+// Ping returns ErrManagerClosed once Close was called. Bundles are served from memory, so the Store is not
+// contacted.
+func (m *BundleManager) Ping(ctx context.Context) error {
+	m.RLock()
+	defer m.RUnlock()
+	if m.closed {
+		return errors.WithStack(ErrManagerClosed)
+	}
+	return nil
+}
+
+// Close stops all watches and waits for them to return, or until ctx is done.
+func (m *BundleManager) Close(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	m.lifecycle()
+	close(m.closing)
+	m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Create is not supported and returns ErrReadOnly.
+func (m *BundleManager) Create(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Update is not supported and returns ErrReadOnly.
+func (m *BundleManager) Update(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Delete is not supported and returns ErrReadOnly.
+func (m *BundleManager) Delete(id string) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Get retrieves a policy.
+func (m *BundleManager) Get(id string) (Policy, error) {
+	return m.current().Get(id)
+}
+
+// Count returns the number of served policies.
+func (m *BundleManager) Count() (int64, error) {
+	return m.current().Count()
+}
+
+// Exists returns true if a policy with the given ID is served.
+func (m *BundleManager) Exists(id string) (bool, error) {
+	return m.current().Exists(id)
+}
+
+// GetAll retrieves all policies.
+func (m *BundleManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.current().GetAll(limit, offset)
+}
+
+// FindRequestCandidates returns the policies of the request's tenant.
+func (m *BundleManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.current().FindRequestCandidates(r)
+}
+
+// FindPoliciesForSubject returns all policies.
+func (m *BundleManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.current().FindPoliciesForSubject(subject)
+}
+
+// FindPoliciesForResource returns all policies.
+func (m *BundleManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.current().FindPoliciesForResource(resource)
+}
+
+// FindPoliciesByLabel returns the policies whose label key is set to value.
+func (m *BundleManager) FindPoliciesByLabel(key, value string) (Policies, error) {
+	return m.current().FindPoliciesByLabel(key, value)
+}
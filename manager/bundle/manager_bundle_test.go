@@ -0,0 +1,227 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+// fakeStore serves obj, honoring the ETag like a conditional GET.
+type fakeStore struct {
+	sync.Mutex
+	obj     *Object
+	fetches int
+}
+
+func (s *fakeStore) Fetch(ctx context.Context, etag string) (*Object, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.fetches++
+	if s.obj == nil {
+		return nil, errors.New("NoSuchKey")
+	} else if etag != "" && etag == s.obj.ETag {
+		return nil, nil
+	}
+	obj := *s.obj
+	return &obj, nil
+}
+
+func (s *fakeStore) publish(obj *Object) {
+	s.Lock()
+	defer s.Unlock()
+	s.obj = obj
+}
+
+func archive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func sign(t *testing.T, revision uint64, body []byte, key ed25519.PrivateKey) []byte {
+	signature, err := Sign(revision, body, key)
+	require.NoError(t, err)
+	return signature
+}
+
+func TestBundleManager(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	body := []byte(`[{"id": "1", "subjects": ["peter"], "resources": ["articles:1"], "actions": ["get"], "effect": "allow"}]`)
+	store := &fakeStore{obj: &Object{Name: "policies.json", Body: body, ETag: "v1", Revision: 1, Signature: sign(t, 1, body, private)}}
+
+	m, err := NewBundleManager(store, public)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", m.ETag())
+
+	warden := &ladon.Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Resource: "articles:1", Action: "get"}))
+	assert.Equal(t, ladon.ErrReadOnly, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "2", Effect: ladon.AllowAccess})))
+
+	// The bundle did not change, so it is not decoded again.
+	require.NoError(t, m.Refresh(context.Background()))
+	assert.Equal(t, 2, store.fetches)
+
+	tampered := []byte(`[{"id": "1", "subjects": ["<.*>"], "resources": ["<.*>"], "actions": ["<.*>"], "effect": "allow"}]`)
+	store.publish(&Object{Name: "policies.json", Body: tampered, ETag: "v2", Revision: 2, Signature: sign(t, 2, body, private)})
+	assert.Error(t, m.Refresh(context.Background()))
+	assert.Equal(t, "v1", m.ETag())
+	assert.Error(t, warden.IsAllowed(&ladon.Request{Subject: "ken", Resource: "articles:1", Action: "get"}))
+
+	duplicate := []byte(`[{"id": "1", "effect": "allow"}, {"id": "1", "effect": "deny"}]`)
+	store.publish(&Object{Name: "policies.json", Body: duplicate, ETag: "v3", Revision: 3, Signature: sign(t, 3, duplicate, private)})
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Refresh(context.Background())))
+
+	bundle := archive(t, map[string]string{
+		"policies/articles.json": `{"id": "articles", "subjects": ["<.*>"], "resources": ["articles:<.*>"], "actions": ["get"], "effect": "allow"}`,
+		"policies/users.yaml":    "id: users\nsubjects: [ken]\nresources: [users:1]\nactions: [get]\neffect: allow\n",
+		"policies/._users.yaml":  "not a policy",
+		"policies/README.md":     "# Policies",
+		"policies/nested/x.yml":  "- id: x\n  effect: deny\n",
+	})
+	store.publish(&Object{Name: "bundle.tar.gz", Body: bundle, ETag: "v4", Revision: 4, Signature: sign(t, 4, bundle, private)})
+	require.NoError(t, m.Refresh(context.Background()))
+	assert.Equal(t, "v4", m.ETag())
+	assert.Equal(t, uint64(4), m.Revision())
+
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "ken", Resource: "articles:1", Action: "get"}))
+}
+
+func TestBundleManagerReplay(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	old := []byte(`{"id": "1", "subjects": ["<.*>"], "resources": ["<.*>"], "actions": ["<.*>"], "effect": "allow"}`)
+	current := []byte(`{"id": "1", "subjects": ["peter"], "resources": ["articles:1"], "actions": ["get"], "effect": "allow"}`)
+	store := &fakeStore{obj: &Object{Body: current, ETag: "v2", Revision: 2, Signature: sign(t, 2, current, private)}}
+	m, err := NewBundleManager(store, public)
+	require.NoError(t, err)
+
+	store.publish(&Object{Body: old, ETag: "v1", Revision: 1, Signature: sign(t, 1, old, private)})
+	assert.Error(t, m.Refresh(context.Background()), "an older bundle is not served again")
+	store.publish(&Object{Body: old, ETag: "v3", Revision: 3, Signature: sign(t, 1, old, private)})
+	assert.Error(t, m.Refresh(context.Background()), "the revision is signed")
+	assert.Equal(t, "v2", m.ETag())
+
+	store.publish(&Object{Body: current, ETag: "v2.1", Revision: 2, Signature: sign(t, 2, current, private)})
+	assert.NoError(t, m.Refresh(context.Background()))
+}
+
+func TestBundleManagerKeys(t *testing.T) {
+	body := []byte(`{"id": "1", "effect": "allow"}`)
+	store := &fakeStore{obj: &Object{Body: body, ETag: "v1"}}
+
+	_, err := NewBundleManager(store, nil)
+	assert.Error(t, err, "a key is required")
+	_, err = NewBundleManager(store, ed25519.PublicKey("short"))
+	assert.Error(t, err)
+	assert.Error(t, (&BundleManager{Store: store}).Refresh(context.Background()))
+	assert.Error(t, (&BundleManager{Store: store, PublicKey: ed25519.PublicKey("short"), Insecure: true}).Refresh(context.Background()))
+
+	_, err = Sign(1, body, ed25519.PrivateKey("short"))
+	assert.Error(t, err)
+}
+
+func TestBundleManagerLimit(t *testing.T) {
+	defer func(max int64) { MaxBundleSize = max }(MaxBundleSize)
+	bundle := archive(t, map[string]string{"policies.json": `{"id": "1", "effect": "allow"}`})
+
+	_, err := Decode("bundle.tar.gz", bundle)
+	require.NoError(t, err)
+
+	MaxBundleSize = 512
+	_, err = Decode("bundle.tar.gz", bundle)
+	assert.Error(t, err)
+}
+
+func TestBundleManagerUnsigned(t *testing.T) {
+	store := &fakeStore{obj: &Object{Name: "policies.yaml", Body: []byte("id: \"1\"\neffect: allow\n"), ETag: "v1"}}
+	m, err := NewInsecureBundleManager(store)
+	require.NoError(t, err)
+	_, err = m.Get("1")
+	require.NoError(t, err)
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = NewBundleManager(store, public)
+	assert.Error(t, err, "bundles without signature are rejected")
+
+	_, err = NewInsecureBundleManager(&fakeStore{})
+	assert.Error(t, err)
+}
+
+func TestBundleManagerWatch(t *testing.T) {
+	store := &fakeStore{obj: &Object{Body: []byte(`{"id": "1", "effect": "allow"}`), ETag: "v1"}}
+	m, err := NewInsecureBundleManager(store)
+	require.NoError(t, err)
+
+	refreshed := make(chan string, 10)
+	m.Interval = time.Millisecond * 10
+	m.OnRefresh = func(etag string, err error) {
+		assert.NoError(t, err)
+		refreshed <- etag
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- m.Watch(context.Background())
+	}()
+
+	store.publish(&Object{Body: []byte(`{"id": "2", "effect": "allow"}`), ETag: "v2"})
+	for etag := range refreshed {
+		if etag == "v2" {
+			break
+		}
+	}
+
+	_, err = m.Get("2")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.NoError(t, <-done)
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Ping(context.Background())))
+}
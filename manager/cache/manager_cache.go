@@ -0,0 +1,417 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package cache provides a Manager which keeps all policies of another Manager in local memory and keeps the copies
+// of all nodes fresh by exchanging invalidation events over a publish/subscribe channel, for example Redis pub/sub.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// PubSub is the publish/subscribe API used by CachedManager. It is satisfied by a small adapter around a
+// Redis client's Publish and Subscribe methods.
+type PubSub interface {
+	// Publish sends message to all subscribers of channel.
+	Publish(ctx context.Context, channel string, message []byte) error
+
+	// Subscribe returns the messages published to channel until ctx is canceled. The channel is closed when
+	// the subscription ends.
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+type event struct {
+	Op string `json:"op"`
+	ID string `json:"id"`
+}
+
+// loadPageSize is the number of policies fetched per GetAll call when the cache is loaded.
+const loadPageSize = 1000
+
+// CachedManager wraps a Manager and serves reads from local memory once Listen has been called. Writes go to
+// the wrapped Manager and publish an invalidation event, upon which every node refreshes the changed policy.
+type CachedManager struct {
+	Manager Manager
+	PubSub  PubSub
+	Channel string
+	Timeout time.Duration
+
+	// OnError is called if Listen can not apply an invalidation event, for example because the wrapped Manager
+	// is unavailable. Listen keeps running and the affected policy is refreshed by its next event.
+	OnError func(err error)
+
+	cache  map[string]Policy
+	synced bool
+	sync.RWMutex
+
+	// closing stops all listeners once Close was called, aborting cancels in-flight writes once Close
+	// stopped waiting for them. running counts listeners and writes.
+	closed   bool
+	closing  chan struct{}
+	aborting chan struct{}
+	running  sync.WaitGroup
+}
+
+// NewCachedManager returns a CachedManager wrapping m which exchanges invalidation events on channel.
+func NewCachedManager(m Manager, ps PubSub, channel string) *CachedManager {
+	return &CachedManager{
+		Manager: m,
+		PubSub:  ps,
+		Channel: channel,
+		Timeout: time.Second * 5,
+		cache:   map[string]Policy{},
+	}
+}
+
+// context returns the context of a single write, which is canceled after Timeout or when Close gives up waiting.
+func (m *CachedManager) context() (context.Context, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	ctx, done, err := m.begin(ctx, false)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return ctx, func() { done(); cancel() }, nil
+}
+
+// begin registers a write or listener Close waits for. The returned context is canceled when parent is, when
+// Close is called (for listeners) or when Close gives up waiting (for writes).
+func (m *CachedManager) begin(parent context.Context, listen bool) (context.Context, func(), error) {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil, nil, errors.WithStack(ErrManagerClosed)
+	}
+
+	m.lifecycle()
+	m.running.Add(1)
+	stop := m.aborting
+	if listen {
+		stop = m.closing
+	}
+	m.Unlock()
+
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		m.running.Done()
+	}, nil
+}
+
+// lifecycle initializes the channels used by Close. The lock must be held.
+func (m *CachedManager) lifecycle() {
+	if m.closing == nil {
+		m.closing = make(chan struct{})
+		m.aborting = make(chan struct{})
+	}
+}
+
+// Ping checks the health of the wrapped Manager. It returns ErrManagerClosed once Close was called.
+func (m *CachedManager) Ping(ctx context.Context) error {
+	m.RLock()
+	closed := m.closed
+	m.RUnlock()
+
+	if closed {
+		return errors.WithStack(ErrManagerClosed)
+	}
+	return Ping(ctx, m.Manager)
+}
+
+// Close stops all listeners, waits for in-flight writes to finish and closes the wrapped Manager. If ctx is done
+// first, publishing the writes is canceled and ctx.Err() is returned. Afterwards, writes fail with
+// ErrManagerClosed. The PubSub is not closed.
+func (m *CachedManager) Close(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	m.lifecycle()
+	close(m.closing)
+	m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		close(m.aborting)
+		return errors.WithStack(ctx.Err())
+	}
+
+	return Close(ctx, m.Manager)
+}
+
+// IndexesLiterals returns true if the wrapped manager looks candidates up verbatim, because candidates are looked
+// up in it until the cache is filled.
+func (m *CachedManager) IndexesLiterals() bool {
+	return IndexesLiterals(m.Manager)
+}
+
+// Listen subscribes to the invalidation channel, loads all policies into the local cache and applies invalidation
+// events until ctx is canceled, the subscription ends or the manager is closed. Until then, and after it returned,
+// reads hit the wrapped Manager.
+func (m *CachedManager) Listen(ctx context.Context) error {
+	ctx, done, err := m.begin(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// Subscribe before loading, so no change between loading and subscribing is lost.
+	messages, err := m.PubSub.Subscribe(ctx, m.Channel)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cache := map[string]Policy{}
+	for offset := int64(0); ; offset += loadPageSize {
+		ps, err := m.Manager.GetAll(loadPageSize, offset)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range ps {
+			cache[p.GetID()] = p
+		}
+
+		if len(ps) < loadPageSize {
+			break
+		}
+	}
+
+	m.Lock()
+	m.cache = cache
+	m.synced = true
+	m.Unlock()
+
+	defer m.invalidate()
+	for message := range messages {
+		if err := m.apply(message); err != nil && m.OnError != nil {
+			m.OnError(err)
+		}
+	}
+
+	return errors.WithStack(ctx.Err())
+}
+
+func (m *CachedManager) apply(message []byte) error {
+	var e event
+	if err := json.Unmarshal(message, &e); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch e.Op {
+	case opPut:
+		// The policy may have been deleted before the event arrived, in which case its delete event follows.
+		p, err := m.Manager.Get(e.ID)
+		if errors.Cause(err) == ErrNotFound {
+			m.Lock()
+			delete(m.cache, e.ID)
+			m.Unlock()
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "Could not refresh policy %s", e.ID)
+		}
+
+		m.Lock()
+		m.cache[e.ID] = p
+		m.Unlock()
+	case opDelete:
+		m.Lock()
+		delete(m.cache, e.ID)
+		m.Unlock()
+	default:
+		return errors.Errorf("Unknown invalidation event %s", e.Op)
+	}
+	return nil
+}
+
+func (m *CachedManager) invalidate() {
+	m.Lock()
+	defer m.Unlock()
+	m.synced = false
+	m.cache = map[string]Policy{}
+}
+
+func (m *CachedManager) publish(ctx context.Context, op, id string, policy Policy) error {
+	m.Lock()
+	if m.synced {
+		if policy != nil {
+			m.cache[id] = policy
+		} else {
+			delete(m.cache, id)
+		}
+	}
+	m.Unlock()
+
+	message, err := json.Marshal(&event{Op: op, ID: id})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(m.PubSub.Publish(ctx, m.Channel, message))
+}
+
+// Create persists the policy and notifies all nodes.
+func (m *CachedManager) Create(policy Policy) error {
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := m.Manager.Create(policy); err != nil {
+		return err
+	}
+	return m.publish(ctx, opPut, policy.GetID(), policy)
+}
+
+// Update updates an existing policy and notifies all nodes.
+func (m *CachedManager) Update(policy Policy) error {
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := m.Manager.Update(policy); err != nil {
+		return err
+	}
+	return m.publish(ctx, opPut, policy.GetID(), policy)
+}
+
+// Delete removes a policy and notifies all nodes.
+func (m *CachedManager) Delete(id string) error {
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := m.Manager.Delete(id); err != nil {
+		return err
+	}
+	return m.publish(ctx, opDelete, id, nil)
+}
+
+// Get retrieves a policy.
+func (m *CachedManager) Get(id string) (Policy, error) {
+	m.RLock()
+	p, ok := m.cache[id]
+	synced := m.synced
+	m.RUnlock()
+
+	if ok {
+		return p, nil
+	} else if synced {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return m.Manager.Get(id)
+}
+
+// GetAll retrieves all policies.
+func (m *CachedManager) GetAll(limit, offset int64) (Policies, error) {
+	ps, ok := m.cached()
+	if !ok {
+		return m.Manager.GetAll(limit, offset)
+	}
+
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].GetID() < ps[j].GetID()
+	})
+
+	start, end := pagination.Index(int(limit), int(offset), len(ps))
+	return ps[start:end], nil
+}
+
+// cached returns all cached policies, or false if the cache is not in sync.
+func (m *CachedManager) cached() (Policies, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	if !m.synced {
+		return nil, false
+	}
+
+	ps := make(Policies, 0, len(m.cache))
+	for _, p := range m.cache {
+		ps = append(ps, p)
+	}
+	return ps, true
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *CachedManager) FindRequestCandidates(r *Request) (Policies, error) {
+	if ps, ok := m.cached(); ok {
+		return FilterTenant(ps, r.Tenant), nil
+	}
+	return m.Manager.FindRequestCandidates(r)
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *CachedManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	if ps, ok := m.cached(); ok {
+		return ps, nil
+	}
+	return m.Manager.FindPoliciesForSubject(subject)
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *CachedManager) FindPoliciesForResource(resource string) (Policies, error) {
+	if ps, ok := m.cached(); ok {
+		return ps, nil
+	}
+	return m.Manager.FindPoliciesForResource(resource)
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+type fakePubSub struct {
+	sync.Mutex
+	subscribers map[string][]chan []byte
+}
+
+func newFakePubSub() *fakePubSub {
+	return &fakePubSub{subscribers: map[string][]chan []byte{}}
+}
+
+func (ps *fakePubSub) Publish(_ context.Context, channel string, message []byte) error {
+	ps.Lock()
+	defer ps.Unlock()
+	for _, s := range ps.subscribers[channel] {
+		s <- message
+	}
+	return nil
+}
+
+func (ps *fakePubSub) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	ps.Lock()
+	defer ps.Unlock()
+	ch := make(chan []byte, 16)
+	ps.subscribers[channel] = append(ps.subscribers[channel], ch)
+	go func() {
+		<-ctx.Done()
+		ps.Lock()
+		defer ps.Unlock()
+		close(ch)
+		ps.subscribers[channel] = nil
+	}()
+	return ch, nil
+}
+
+// countingManager counts the reads which reach the wrapped manager.
+type countingManager struct {
+	*memory.MemoryManager
+	sync.Mutex
+	reads  int
+	closed bool
+}
+
+func (m *countingManager) read() {
+	m.Lock()
+	defer m.Unlock()
+	m.reads++
+}
+
+func (m *countingManager) Get(id string) (ladon.Policy, error) {
+	m.read()
+	return m.MemoryManager.Get(id)
+}
+
+func (m *countingManager) FindRequestCandidates(r *ladon.Request) (ladon.Policies, error) {
+	m.read()
+	return m.MemoryManager.FindRequestCandidates(r)
+}
+
+func (m *countingManager) Close(ctx context.Context) error {
+	m.Lock()
+	defer m.Unlock()
+	m.closed = true
+	return nil
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	for i := 0; i < 1000; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition was not met in time")
+}
+
+func TestCachedManager(t *testing.T) {
+	backend := &countingManager{MemoryManager: memory.NewMemoryManager()}
+	require.NoError(t, backend.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess}))
+
+	ps := newFakePubSub()
+	a := NewCachedManager(backend, ps, "ladon")
+	b := NewCachedManager(backend, ps, "ladon")
+
+	// Without a listener, reads hit the backend.
+	_, err := a.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.reads)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	go func() { done <- a.Listen(ctx) }()
+	go func() { done <- b.Listen(ctx) }()
+
+	synced := func(m *CachedManager) func() bool {
+		return func() bool {
+			m.RLock()
+			defer m.RUnlock()
+			return m.synced
+		}
+	}
+	eventually(t, synced(a))
+	eventually(t, synced(b))
+
+	reads := backend.reads
+	candidates, err := b.FindRequestCandidates(new(ladon.Request))
+	require.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, reads, backend.reads)
+
+	// A write on one node becomes visible on the other.
+	require.NoError(t, a.Create(&ladon.DefaultPolicy{ID: "2", Effect: ladon.DenyAccess}))
+	eventually(t, func() bool {
+		_, err := b.Get("2")
+		return err == nil
+	})
+
+	require.NoError(t, a.Update(&ladon.DefaultPolicy{ID: "2", Effect: ladon.AllowAccess}))
+	eventually(t, func() bool {
+		p, err := b.Get("2")
+		return err == nil && p.AllowAccess()
+	})
+
+	require.NoError(t, a.Delete("2"))
+	eventually(t, func() bool {
+		_, err := b.Get("2")
+		return errors.Cause(err) == ladon.ErrNotFound
+	})
+
+	all, err := b.GetAll(10, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(<-done))
+	assert.Equal(t, context.Canceled, errors.Cause(<-done))
+	assert.False(t, synced(a)())
+}
+
+func TestCachedManagerEventErrors(t *testing.T) {
+	backend := memory.NewMemoryManager()
+	ps := newFakePubSub()
+	m := NewCachedManager(backend, ps, "ladon")
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess}))
+
+	errs := make(chan error, 1)
+	m.OnError = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Listen(ctx) }()
+	eventually(t, func() bool {
+		m.RLock()
+		defer m.RUnlock()
+		return m.synced
+	})
+
+	// The policy was deleted before another node's put event arrived.
+	require.NoError(t, backend.Delete("1"))
+	require.NoError(t, ps.Publish(ctx, "ladon", []byte(`{"op": "put", "id": "1"}`)))
+	eventually(t, func() bool {
+		_, err := m.Get("1")
+		return errors.Cause(err) == ladon.ErrNotFound
+	})
+
+	require.NoError(t, ps.Publish(ctx, "ladon", []byte(`{"op": "rename"}`)))
+	assert.Error(t, <-errs)
+
+	// The listener keeps running.
+	require.NoError(t, backend.Create(&ladon.DefaultPolicy{ID: "2", Effect: ladon.AllowAccess}))
+	require.NoError(t, ps.Publish(ctx, "ladon", []byte(`{"op": "put", "id": "2"}`)))
+	eventually(t, func() bool {
+		_, err := m.Get("2")
+		return err == nil
+	})
+
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(<-done))
+}
+
+func TestCachedManagerClose(t *testing.T) {
+	backend := &countingManager{MemoryManager: memory.NewMemoryManager()}
+	m := NewCachedManager(backend, newFakePubSub(), "ladon")
+
+	done := make(chan error)
+	go func() { done <- m.Listen(context.Background()) }()
+	eventually(t, func() bool {
+		m.RLock()
+		defer m.RUnlock()
+		return m.synced
+	})
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.Error(t, <-done)
+	assert.True(t, backend.closed)
+	assert.NoError(t, m.Close(context.Background()))
+
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Listen(context.Background())))
+
+	_, err := backend.Get("1")
+	assert.Error(t, err, "writes must not reach the backend once closed")
+}
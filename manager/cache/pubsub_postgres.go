@@ -0,0 +1,116 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxNotifyPayload is the maximum size of a NOTIFY payload in the default Postgres configuration.
+const maxNotifyPayload = 7999
+
+// PostgresDB is the contract PostgresPubSub requires from Postgres. Exec is usually backed by a connection pool,
+// Connect opens a connection outside of it, because notifications are delivered to the session which ran LISTEN.
+type PostgresDB interface {
+	// Exec runs a statement with the given arguments.
+	Exec(ctx context.Context, sql string, args ...interface{}) error
+
+	// Connect opens a dedicated connection.
+	Connect(ctx context.Context) (PostgresConn, error)
+}
+
+// PostgresConn is a dedicated Postgres connection, for example a *pgx.Conn.
+type PostgresConn interface {
+	// Exec runs a statement without arguments.
+	Exec(ctx context.Context, sql string) error
+
+	// WaitForNotification blocks until a notification is received on any channel the connection listens on.
+	WaitForNotification(ctx context.Context) (channel, payload string, err error)
+
+	// Close closes the connection.
+	Close(ctx context.Context) error
+}
+
+// PostgresPubSub is a PubSub using Postgres LISTEN/NOTIFY, so deployments storing their policies in Postgres
+// invalidate the caches of all nodes without running a broker. Notifications are delivered within milliseconds of
+// the commit of the publishing transaction.
+type PostgresPubSub struct {
+	DB PostgresDB
+}
+
+// NewPostgresPubSub returns a PostgresPubSub using db.
+func NewPostgresPubSub(db PostgresDB) *PostgresPubSub {
+	return &PostgresPubSub{DB: db}
+}
+
+// Publish sends message to channel with pg_notify. Postgres limits the size of a message to 7999 bytes.
+func (ps *PostgresPubSub) Publish(ctx context.Context, channel string, message []byte) error {
+	if len(message) > maxNotifyPayload {
+		return errors.Errorf("Message of %d bytes exceeds the NOTIFY payload limit of %d bytes", len(message), maxNotifyPayload)
+	}
+
+	return errors.WithStack(ps.DB.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(message)))
+}
+
+// Subscribe opens a dedicated connection listening on channel. The returned channel is closed and the connection
+// is closed once ctx is canceled or the connection fails, which ends CachedManager.Listen.
+func (ps *PostgresPubSub) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	conn, err := ps.DB.Connect(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := conn.Exec(ctx, "LISTEN "+quoteIdentifier(channel)); err != nil {
+		_ = conn.Close(context.Background())
+		return nil, errors.WithStack(err)
+	}
+
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		defer conn.Close(context.Background())
+
+		for {
+			name, payload, err := conn.WaitForNotification(ctx)
+			if err != nil {
+				return
+			} else if name != channel {
+				continue
+			}
+
+			select {
+			case messages <- []byte(payload):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// quoteIdentifier quotes name, so that pg_notify and LISTEN refer to the same case-sensitive channel.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+type notification struct {
+	channel, payload string
+}
+
+// fakePostgres delivers notifications to all connections which ran LISTEN on the quoted channel.
+type fakePostgres struct {
+	sync.Mutex
+	conns []*fakePostgresConn
+}
+
+func (db *fakePostgres) Exec(_ context.Context, sql string, args ...interface{}) error {
+	if sql != "SELECT pg_notify($1, $2)" {
+		return errors.Errorf("unexpected statement %s", sql)
+	}
+
+	db.Lock()
+	defer db.Unlock()
+	for _, c := range db.conns {
+		if c.listening[quoteIdentifier(args[0].(string))] {
+			c.notifications <- notification{channel: args[0].(string), payload: args[1].(string)}
+		}
+	}
+	return nil
+}
+
+func (db *fakePostgres) Connect(_ context.Context) (PostgresConn, error) {
+	db.Lock()
+	defer db.Unlock()
+	c := &fakePostgresConn{db: db, listening: map[string]bool{}, notifications: make(chan notification, 16), broken: make(chan struct{})}
+	db.conns = append(db.conns, c)
+	return c, nil
+}
+
+func (db *fakePostgres) open() int {
+	db.Lock()
+	defer db.Unlock()
+	return len(db.conns)
+}
+
+type fakePostgresConn struct {
+	db            *fakePostgres
+	listening     map[string]bool
+	notifications chan notification
+	broken        chan struct{}
+}
+
+func (c *fakePostgresConn) Exec(_ context.Context, sql string) error {
+	c.db.Lock()
+	defer c.db.Unlock()
+	c.listening[strings.TrimPrefix(sql, "LISTEN ")] = true
+	return nil
+}
+
+func (c *fakePostgresConn) WaitForNotification(ctx context.Context) (string, string, error) {
+	select {
+	case n := <-c.notifications:
+		return n.channel, n.payload, nil
+	case <-c.broken:
+		return "", "", errors.New("connection reset")
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+func (c *fakePostgresConn) Close(_ context.Context) error {
+	c.db.Lock()
+	defer c.db.Unlock()
+	for i, other := range c.db.conns {
+		if other == c {
+			c.db.conns = append(c.db.conns[:i], c.db.conns[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func TestPostgresPubSub(t *testing.T) {
+	backend := memory.NewMemoryManager()
+	require.NoError(t, backend.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess}))
+
+	db := &fakePostgres{}
+	a := NewCachedManager(backend, NewPostgresPubSub(db), "Ladon")
+	b := NewCachedManager(backend, NewPostgresPubSub(db), "Ladon")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 2)
+	go func() { stopped <- a.Listen(ctx) }()
+	go func() { stopped <- b.Listen(ctx) }()
+	eventually(t, func() bool { return db.open() == 2 })
+
+	require.NoError(t, a.Update(&ladon.DefaultPolicy{ID: "1", Description: "updated", Effect: ladon.AllowAccess}))
+	eventually(t, func() bool {
+		p, err := b.Get("1")
+		return err == nil && p.GetDescription() == "updated"
+	})
+
+	cancel()
+	<-stopped
+	<-stopped
+	assert.Equal(t, 0, db.open(), "connections are closed when listening stops")
+}
+
+func TestPostgresPubSubConnectionLoss(t *testing.T) {
+	db := &fakePostgres{}
+	messages, err := NewPostgresPubSub(db).Subscribe(context.Background(), "ladon")
+	require.NoError(t, err)
+
+	close(db.conns[0].broken)
+	_, ok := <-messages
+	assert.False(t, ok, "the subscription ends when the connection fails")
+	eventually(t, func() bool { return db.open() == 0 })
+}
+
+func TestPostgresPubSubPayloadLimit(t *testing.T) {
+	ps := NewPostgresPubSub(&fakePostgres{})
+	assert.Error(t, ps.Publish(context.Background(), "ladon", make([]byte, 8000)))
+	assert.NoError(t, ps.Publish(context.Background(), "ladon", []byte(`{"op":"delete","id":"1"}`)))
+	assert.Equal(t, `"la""don"`, quoteIdentifier(`la"don`))
+}
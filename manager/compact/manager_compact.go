@@ -0,0 +1,374 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package compact provides a read-only Manager holding very large policy sets in little memory.
+//
+// All strings are interned, the subjects, resources and actions of all policies are stored in one flattened
+// array of string references, and every regular expression template is compiled exactly once when the set is
+// loaded. Policies are materialized lazily when they are returned by the manager.
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/compiler"
+	"github.com/ory/pagination"
+)
+
+type span struct {
+	offset, length uint32
+}
+
+type record struct {
+	id, description, effect      uint32
+	tenant                       uint32
+	priority                     int
+	subjects, resources, actions span
+	excluded                     [3]span
+	meta                         []byte
+	conditions                   Conditions
+	start, end                   byte
+	mode                         MatchMode
+	template                     *TemplateRef
+	disabled                     bool
+	labels                       map[string]string
+	signature                    *Signature
+}
+
+// CompactManager is a read-only Manager optimized for memory usage. Use NewCompactManager or LoadCompactManager
+// to construct it.
+type CompactManager struct {
+	strings  []string
+	refs     []uint32
+	records  []record
+	ids      map[string]uint32
+	compiled map[string]*regexp2.Regexp
+
+	// exactSubjects maps subjects without regular expressions to the policies containing them, patternSubjects
+	// lists all policies having at least one subject with a regular expression.
+	exactSubjects   map[string][]uint32
+	patternSubjects []uint32
+}
+
+type builder struct {
+	m      *CompactManager
+	intern map[string]uint32
+}
+
+// NewCompactManager builds a CompactManager holding the given policies.
+func NewCompactManager(policies Policies) (*CompactManager, error) {
+	b := newBuilder()
+	for _, p := range policies {
+		if err := b.add(p); err != nil {
+			return nil, err
+		}
+	}
+	return b.m, nil
+}
+
+// LoadCompactManager builds a CompactManager from an export bundle, which is either a JSON array of policies or
+// a stream of JSON policies (for example one per line). Policies are decoded one at a time, so the bundle is
+// never held in memory as a whole.
+func LoadCompactManager(r io.Reader) (*CompactManager, error) {
+	b := newBuilder()
+	dec := json.NewDecoder(r)
+
+	array := false
+	if t, err := dec.Token(); err == io.EOF {
+		return b.m, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	} else if d, ok := t.(json.Delim); !ok || (d != '[' && d != '{') {
+		return nil, errors.Errorf("Expected a JSON array or object but got %v", t)
+	} else if d == '[' {
+		array = true
+	} else {
+		// The opening brace of the first object was consumed already, so it needs to be put back.
+		dec = json.NewDecoder(io.MultiReader(strings.NewReader("{"), dec.Buffered(), r))
+	}
+
+	for dec.More() {
+		var p DefaultPolicy
+		if err := dec.Decode(&p); err != nil {
+			return nil, errors.WithStack(err)
+		} else if err := b.add(&p); err != nil {
+			return nil, err
+		}
+	}
+
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return b.m, nil
+}
+
+func newBuilder() *builder {
+	return &builder{
+		m: &CompactManager{
+			ids:           map[string]uint32{},
+			compiled:      map[string]*regexp2.Regexp{},
+			exactSubjects: map[string][]uint32{},
+		},
+		intern: map[string]uint32{},
+	}
+}
+
+func (b *builder) str(s string) uint32 {
+	if i, ok := b.intern[s]; ok {
+		return i
+	}
+
+	i := uint32(len(b.m.strings))
+	b.m.strings = append(b.m.strings, s)
+	b.intern[s] = i
+	return i
+}
+
+func (b *builder) list(p Policy, values []string) (span, error) {
+	s := span{offset: uint32(len(b.m.refs)), length: uint32(len(values))}
+	for _, v := range values {
+		i := b.str(v)
+		b.m.refs = append(b.m.refs, i)
+
+		if PolicyMatchMode(p) != MatchModeRegex {
+			continue
+		} else if _, ok := b.m.compiled[compiledKey(p, v)]; ok || strings.IndexByte(v, p.GetStartDelimiter()) < 0 {
+			continue
+		}
+
+		reg, err := compiler.CompileRegex(v, p.GetStartDelimiter(), p.GetEndDelimiter())
+		if err != nil {
+			return s, errors.WithStack(err)
+		}
+		b.m.compiled[compiledKey(p, b.m.strings[i])] = reg
+	}
+	return s, nil
+}
+
+func (b *builder) add(p Policy) error {
+	if _, ok := b.m.ids[p.GetID()]; ok {
+		return errors.Wrapf(ErrPolicyExists, "Policy %s is defined more than once", p.GetID())
+	} else if err := ValidatePolicy(p); err != nil {
+		return err
+	}
+
+	r := record{
+		id:          b.str(p.GetID()),
+		description: b.str(p.GetDescription()),
+		effect:      b.str(p.GetEffect()),
+		tenant:      b.str(PolicyTenant(p)),
+		priority:    PolicyPriority(p),
+		meta:        p.GetMeta(),
+		start:       p.GetStartDelimiter(),
+		end:         p.GetEndDelimiter(),
+		mode:        PolicyMatchMode(p),
+		template:    PolicyTemplateRef(p),
+		disabled:    !PolicyActive(p),
+		labels:      PolicyLabels(p),
+		signature:   PolicySignature(p),
+	}
+
+	if len(p.GetConditions()) > 0 {
+		r.conditions = p.GetConditions()
+	}
+
+	var err error
+	if r.subjects, err = b.list(p, p.GetSubjects()); err != nil {
+		return err
+	} else if r.resources, err = b.list(p, p.GetResources()); err != nil {
+		return err
+	} else if r.actions, err = b.list(p, p.GetActions()); err != nil {
+		return err
+	}
+
+	excludedSubjects, excludedResources, excludedActions := PolicyExclusions(p)
+	for i, excluded := range [][]string{excludedSubjects, excludedResources, excludedActions} {
+		if r.excluded[i], err = b.list(p, excluded); err != nil {
+			return err
+		}
+	}
+
+	index := uint32(len(b.m.records))
+	b.m.records = append(b.m.records, r)
+	b.m.ids[p.GetID()] = index
+
+	// Globs and hierarchies may match any subject, so they are treated like regular expressions.
+	pattern := r.mode == MatchModeGlob || r.mode == MatchModeHierarchical
+	for _, ref := range b.m.refs[r.subjects.offset : r.subjects.offset+r.subjects.length] {
+		if s := b.m.strings[ref]; pattern || (r.mode == MatchModeRegex && b.m.compiled[compiledKey(p, s)] != nil) {
+			pattern = true
+		} else {
+			b.m.exactSubjects[s] = append(b.m.exactSubjects[s], index)
+		}
+	}
+
+	if pattern {
+		b.m.patternSubjects = append(b.m.patternSubjects, index)
+	}
+	return nil
+}
+
+func (m *CompactManager) values(s span) []string {
+	out := make([]string, s.length)
+	for i, ref := range m.refs[s.offset : s.offset+s.length] {
+		out[i] = m.strings[ref]
+	}
+	return out
+}
+
+// excludedValues returns the values of s, or nil if it is empty, so policies without exclusions encode like before.
+func (m *CompactManager) excludedValues(s span) []string {
+	if s.length == 0 {
+		return nil
+	}
+	return m.values(s)
+}
+
+func (m *CompactManager) policy(index uint32) Policy {
+	return &compactPolicy{m: m, r: &m.records[index]}
+}
+
+// Create is not supported and returns ErrReadOnly.
+func (m *CompactManager) Create(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Update is not supported and returns ErrReadOnly.
+func (m *CompactManager) Update(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Delete is not supported and returns ErrReadOnly.
+func (m *CompactManager) Delete(id string) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Get retrieves a policy.
+func (m *CompactManager) Get(id string) (Policy, error) {
+	index, ok := m.ids[id]
+	if !ok {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return m.policy(index), nil
+}
+
+// Count returns the number of policies.
+func (m *CompactManager) Count() (int64, error) {
+	return int64(len(m.records)), nil
+}
+
+// Exists returns true if a policy with the given ID exists.
+func (m *CompactManager) Exists(id string) (bool, error) {
+	_, ok := m.ids[id]
+	return ok, nil
+}
+
+// sorted returns the indices of all records ordered by ID.
+func (m *CompactManager) sorted() []uint32 {
+	indices := make([]uint32, len(m.records))
+	for i := range indices {
+		indices[i] = uint32(i)
+	}
+
+	sort.Slice(indices, func(i, j int) bool {
+		return m.strings[m.records[indices[i]].id] < m.strings[m.records[indices[j]].id]
+	})
+	return indices
+}
+
+// GetAll retrieves all policies.
+func (m *CompactManager) GetAll(limit, offset int64) (Policies, error) {
+	indices := m.sorted()
+	start, end := pagination.Index(int(limit), int(offset), len(indices))
+	ps := make(Policies, 0, end-start)
+	for _, index := range indices[start:end] {
+		ps = append(ps, m.policy(index))
+	}
+	return ps, nil
+}
+
+// ForEach calls fn for every policy, ordered by ID, materializing one policy at a time.
+func (m *CompactManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	for _, index := range m.sorted() {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := fn(m.policy(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *CompactManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject.
+func (m *CompactManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ps, err := m.FindPoliciesForSubject(r.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTenant(ps, r.Tenant), nil
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject containing a regular expression, or using glob or hierarchical matching.
+func (m *CompactManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	exact := m.exactSubjects[subject]
+
+	ps := make(Policies, 0, len(exact)+len(m.patternSubjects))
+	seen := make(map[uint32]bool, len(exact))
+	for _, index := range exact {
+		seen[index] = true
+		ps = append(ps, m.policy(index))
+	}
+
+	for _, index := range m.patternSubjects {
+		if !seen[index] {
+			ps = append(ps, m.policy(index))
+		}
+	}
+	return ps, nil
+}
+
+// FindPoliciesForResource returns all policies.
+func (m *CompactManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.GetAll(int64(len(m.records)), 0)
+}
+
+// Close does nothing, because the CompactManager holds no connections and runs no background work.
+func (m *CompactManager) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package compact
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+const bundle = `[
+	{"id": "1", "subjects": ["peter", "<zac|ken>"], "effect": "allow", "resources": ["articles:<[0-9]+>"], "actions": ["get"], "conditions": {"owner": {"type": "EqualsSubjectCondition"}}},
+	{"id": "2", "subjects": ["peter"], "effect": "deny", "resources": ["articles:42"], "actions": ["get"]},
+	{"id": "3", "subjects": ["max"], "effect": "allow", "resources": ["articles:<[0-9]+>"], "actions": ["<get|delete>"]}
+]`
+
+func TestLoadCompactManager(t *testing.T) {
+	for k, raw := range []string{
+		bundle,
+		strings.Join([]string{
+			`{"id": "1", "subjects": ["peter", "<zac|ken>"], "effect": "allow", "resources": ["articles:<[0-9]+>"], "actions": ["get"], "conditions": {"owner": {"type": "EqualsSubjectCondition"}}}`,
+			`{"id": "2", "subjects": ["peter"], "effect": "deny", "resources": ["articles:42"], "actions": ["get"]}`,
+			`{"id": "3", "subjects": ["max"], "effect": "allow", "resources": ["articles:<[0-9]+>"], "actions": ["<get|delete>"]}`,
+		}, "\n"),
+	} {
+		m, err := LoadCompactManager(strings.NewReader(raw))
+		require.NoError(t, err, "%d", k)
+
+		all, err := m.GetAll(10, 0)
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+
+		p, err := m.Get("1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"peter", "<zac|ken>"}, p.GetSubjects())
+		assert.Equal(t, []string{"articles:<[0-9]+>"}, p.GetResources())
+		assert.True(t, p.AllowAccess())
+		assert.IsType(t, &EqualsSubjectCondition{}, p.GetConditions()["owner"])
+
+		// Equal strings are stored only once.
+		assert.Len(t, m.strings, 13)
+	}
+
+	m, err := LoadCompactManager(strings.NewReader(""))
+	require.NoError(t, err)
+	all, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	_, err = LoadCompactManager(strings.NewReader(`[{"id": "1", "effect": "allow"}, {"id": "1", "effect": "allow"}]`))
+	assert.Error(t, err)
+
+	_, err = LoadCompactManager(strings.NewReader(`"foo"`))
+	assert.Error(t, err)
+}
+
+func TestCompactManager(t *testing.T) {
+	m, err := LoadCompactManager(strings.NewReader(bundle))
+	require.NoError(t, err)
+
+	p, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, ErrReadOnly, errors.Cause(m.Create(p)))
+	assert.Equal(t, ErrReadOnly, errors.Cause(m.Update(p)))
+	assert.Equal(t, ErrReadOnly, errors.Cause(m.Delete("1")))
+
+	_, err = m.Get("4")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+	var streamed []string
+	require.NoError(t, m.ForEach(context.Background(), func(p Policy) error {
+		streamed = append(streamed, p.GetID())
+		return nil
+	}))
+	assert.Equal(t, []string{"1", "2", "3"}, streamed)
+
+	for subject, expected := range map[string][]string{
+		"peter": {"2", "1"},
+		"max":   {"3", "1"},
+		"zac":   {"1"},
+	} {
+		candidates, err := m.FindRequestCandidates(&Request{Subject: subject})
+		require.NoError(t, err)
+
+		var ids []string
+		for _, c := range candidates {
+			ids = append(ids, c.GetID())
+		}
+		assert.ElementsMatch(t, expected, ids, subject)
+	}
+
+	warden := &Ladon{Manager: m, Matcher: m.Matcher()}
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "zac", Action: "get", Resource: "articles:42", Context: Context{"owner": "zac"}}, allowed: true},
+		{r: &Request{Subject: "zac", Action: "get", Resource: "articles:42", Context: Context{"owner": "peter"}}, allowed: false},
+		{r: &Request{Subject: "peter", Action: "get", Resource: "articles:42", Context: Context{"owner": "peter"}}, allowed: false},
+		{r: &Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: Context{"owner": "peter"}}, allowed: true},
+		{r: &Request{Subject: "max", Action: "delete", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "max", Action: "update", Resource: "articles:1"}, allowed: false},
+	} {
+		err := warden.IsAllowed(c.r)
+		assert.Equal(t, c.allowed, err == nil, "%d: %v", k, err)
+	}
+}
+
+func TestCompactManagerMatchModes(t *testing.T) {
+	m, err := NewCompactManager(Policies{
+		&DefaultPolicy{ID: "exact", Subjects: []string{"<peter>"}, Actions: []string{"get"}, Resources: []string{"<"}, Effect: AllowAccess, MatchMode: MatchModeExact},
+		&DefaultPolicy{ID: "glob", Subjects: []string{"user:*"}, Actions: []string{"get"}, Resources: []string{"articles:*"}, Effect: AllowAccess, MatchMode: MatchModeGlob},
+	})
+	require.NoError(t, err)
+
+	for subject, expected := range map[string][]string{
+		"<peter>":  {"exact", "glob"},
+		"user:max": {"glob"},
+	} {
+		candidates, err := m.FindRequestCandidates(&Request{Subject: subject})
+		require.NoError(t, err)
+
+		var ids []string
+		for _, c := range candidates {
+			ids = append(ids, c.GetID())
+		}
+		assert.ElementsMatch(t, expected, ids, subject)
+	}
+
+	warden := &Ladon{Manager: m, Matcher: m.Matcher()}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "<peter>", Action: "get", Resource: "<"}))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "user:max", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "<"}))
+
+	p, err := m.Get("glob")
+	require.NoError(t, err)
+	out, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"match_mode":"glob"`)
+}
+
+func TestCompactManagerAttributes(t *testing.T) {
+	m, err := NewCompactManager(Policies{
+		&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, Effect: AllowAccess, Disabled: true,
+			Labels: map[string]string{"team": "blog"}},
+	})
+	require.NoError(t, err)
+
+	p, err := m.Get("1")
+	require.NoError(t, err)
+	assert.False(t, PolicyActive(p))
+	assert.Equal(t, map[string]string{"team": "blog"}, PolicyLabels(p))
+
+	raw, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"disabled":true`)
+	assert.Contains(t, string(raw), `"labels":{"team":"blog"}`)
+
+	warden := &Ladon{Manager: m, Matcher: m.Matcher()}
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+}
+
+func TestCompactManagerExclusions(t *testing.T) {
+	m, err := NewCompactManager(Policies{
+		&DefaultPolicy{ID: "1", Subjects: []string{"<.*>"}, ExcludedSubjects: []string{"guests:<.*>"}, Actions: []string{"get"},
+			Resources: []string{"articles:<.*>"}, ExcludedResources: []string{"articles:drafts"}, Effect: AllowAccess},
+	})
+	require.NoError(t, err)
+
+	p, err := m.Get("1")
+	require.NoError(t, err)
+	subjects, resources, actions := PolicyExclusions(p)
+	assert.Equal(t, []string{"guests:<.*>"}, subjects)
+	assert.Equal(t, []string{"articles:drafts"}, resources)
+	assert.Nil(t, actions)
+
+	warden := &Ladon{Manager: m, Matcher: m.Matcher()}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "guests:max", Action: "get", Resource: "articles:1"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:drafts"}))
+}
+
+func TestCompactManagerDelimiters(t *testing.T) {
+	m, err := NewCompactManager(Policies{
+		&DefaultPolicy{ID: "curly", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"{a}<b>"}, Effect: AllowAccess,
+			StartDelimiter: "{", EndDelimiter: "}"},
+		&DefaultPolicy{ID: "angle", Subjects: []string{"peter"}, Actions: []string{"put"}, Resources: []string{"{a}<b>"}, Effect: AllowAccess},
+	})
+	require.NoError(t, err)
+
+	warden := &Ladon{Manager: m, Matcher: m.Matcher()}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "a<b>"}))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "put", Resource: "{a}b"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "{a}b"}))
+
+	p, err := m.Get("curly")
+	require.NoError(t, err)
+	raw, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"start_delimiter":"{","end_delimiter":"}"`)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package compact
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// Matcher returns a matcher which uses the regular expressions compiled when the manager was loaded. Unlike
+// the DefaultMatcher it never compiles or evicts expressions while requests are processed.
+func (m *CompactManager) Matcher() *Matcher {
+	return &Matcher{m: m}
+}
+
+// Matcher matches policies of a CompactManager using pre-compiled regular expressions. Templates which were
+// not loaded into the manager are delegated to the DefaultMatcher.
+type Matcher struct {
+	m *CompactManager
+}
+
+// Matches a needle with an array of regular expressions and returns true if a match was found.
+func (c *Matcher) Matches(p Policy, haystack []string, needle string) (bool, error) {
+	if PolicyMatchMode(p) != MatchModeRegex {
+		return DefaultMatcher.Matches(p, haystack, needle)
+	}
+
+	for _, h := range haystack {
+		if strings.IndexByte(h, p.GetStartDelimiter()) < 0 {
+			if h == needle {
+				return true, nil
+			}
+			continue
+		}
+
+		reg, ok := c.m.compiled[compiledKey(p, h)]
+		if !ok {
+			if matched, err := DefaultMatcher.Matches(p, []string{h}, needle); err != nil || matched {
+				return matched, err
+			}
+			continue
+		}
+
+		if matched, err := reg.MatchString(needle); err != nil {
+			return false, errors.WithStack(err)
+		} else if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compiledKey returns the key of template in the compiled expressions. Templates of policies with other than the
+// default delimiters are prefixed with their delimiters, because the same template compiles to different
+// expressions.
+func compiledKey(p Policy, template string) string {
+	start, end := p.GetStartDelimiter(), p.GetEndDelimiter()
+	if start == DefaultStartDelimiter && end == DefaultEndDelimiter {
+		return template
+	}
+	return string([]byte{start, end, 0}) + template
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package compact
+
+import (
+	"encoding/json"
+
+	. "github.com/ory/ladon"
+)
+
+// compactPolicy is a read-only view on a policy stored in a CompactManager.
+type compactPolicy struct {
+	m *CompactManager
+	r *record
+}
+
+// GetID returns the policies id.
+func (p *compactPolicy) GetID() string {
+	return p.m.strings[p.r.id]
+}
+
+// GetDescription returns the policies description.
+func (p *compactPolicy) GetDescription() string {
+	return p.m.strings[p.r.description]
+}
+
+// GetSubjects returns the policies subjects.
+func (p *compactPolicy) GetSubjects() []string {
+	return p.m.values(p.r.subjects)
+}
+
+// AllowAccess returns true if the policy effect is allow, otherwise false.
+func (p *compactPolicy) AllowAccess() bool {
+	return p.GetEffect() == AllowAccess
+}
+
+// GetEffect returns the policies effect which might be 'allow' or 'deny'.
+func (p *compactPolicy) GetEffect() string {
+	return p.m.strings[p.r.effect]
+}
+
+// GetResources returns the policies resources.
+func (p *compactPolicy) GetResources() []string {
+	return p.m.values(p.r.resources)
+}
+
+// GetActions returns the policies actions.
+func (p *compactPolicy) GetActions() []string {
+	return p.m.values(p.r.actions)
+}
+
+// GetConditions returns the policies conditions.
+func (p *compactPolicy) GetConditions() Conditions {
+	return p.r.conditions
+}
+
+// GetMeta returns the policies arbitrary metadata set by the user.
+func (p *compactPolicy) GetMeta() []byte {
+	return p.r.meta
+}
+
+// GetStartDelimiter returns the delimiter which identifies the beginning of a regular expression.
+func (p *compactPolicy) GetStartDelimiter() byte {
+	return p.r.start
+}
+
+// GetEndDelimiter returns the delimiter which identifies the end of a regular expression.
+func (p *compactPolicy) GetEndDelimiter() byte {
+	return p.r.end
+}
+
+// GetTenant returns the tenant the policy belongs to.
+func (p *compactPolicy) GetTenant() string {
+	return p.m.strings[p.r.tenant]
+}
+
+// GetPriority returns the policies priority.
+func (p *compactPolicy) GetPriority() int {
+	return p.r.priority
+}
+
+// GetTemplate returns the template the policy was instantiated from, or nil.
+func (p *compactPolicy) GetTemplate() *TemplateRef {
+	return p.r.template
+}
+
+// GetMatchMode returns the policies match mode.
+func (p *compactPolicy) GetMatchMode() MatchMode {
+	return p.r.mode
+}
+
+// IsActive returns false if the policy is disabled.
+func (p *compactPolicy) IsActive() bool {
+	return !p.r.disabled
+}
+
+// GetLabels returns the policies labels.
+func (p *compactPolicy) GetLabels() map[string]string {
+	return p.r.labels
+}
+
+// GetSignature returns the policies signature, or nil if it is not signed.
+func (p *compactPolicy) GetSignature() *Signature {
+	return p.r.signature
+}
+
+// GetExcludedSubjects returns the subjects the policy does not apply to.
+func (p *compactPolicy) GetExcludedSubjects() []string {
+	return p.m.excludedValues(p.r.excluded[0])
+}
+
+// GetExcludedResources returns the resources the policy does not apply to.
+func (p *compactPolicy) GetExcludedResources() []string {
+	return p.m.excludedValues(p.r.excluded[1])
+}
+
+// GetExcludedActions returns the actions the policy does not apply to.
+func (p *compactPolicy) GetExcludedActions() []string {
+	return p.m.excludedValues(p.r.excluded[2])
+}
+
+// MarshalJSON encodes the policy like a DefaultPolicy.
+func (p *compactPolicy) MarshalJSON() ([]byte, error) {
+	mode := p.r.mode
+	if mode == MatchModeRegex {
+		mode = ""
+	}
+
+	var start, end string
+	if p.r.start != DefaultStartDelimiter || p.r.end != DefaultEndDelimiter {
+		start, end = string(p.r.start), string(p.r.end)
+	}
+
+	return json.Marshal(&DefaultPolicy{
+		ID:          p.GetID(),
+		Description: p.GetDescription(),
+		Subjects:    p.GetSubjects(),
+		Effect:      Effect(p.GetEffect()),
+		Resources:   p.GetResources(),
+		Actions:     p.GetActions(),
+		Conditions:  p.GetConditions(),
+		Meta:        p.GetMeta(),
+		MatchMode:   mode,
+		Tenant:      p.GetTenant(),
+		Priority:    p.GetPriority(),
+		Template:    p.GetTemplate(),
+		Disabled:    p.r.disabled,
+		Labels:      p.r.labels,
+		Signature:   p.r.signature,
+
+		ExcludedSubjects:  p.GetExcludedSubjects(),
+		ExcludedResources: p.GetExcludedResources(),
+		ExcludedActions:   p.GetExcludedActions(),
+
+		StartDelimiter: start,
+		EndDelimiter:   end,
+	})
+}
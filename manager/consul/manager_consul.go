@@ -0,0 +1,680 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// KVPair is a single key/value pair stored in Consul KV.
+type KVPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+// Client is the contract ConsulManager requires from Consul KV. It is implemented on top of the KV of an
+// *api.Client: List with a wait index is a blocking query, and CAS maps to KV.CAS.
+type Client interface {
+	// Get returns the pair stored at key, or nil if the key does not exist.
+	Get(ctx context.Context, key string) (*KVPair, error)
+
+	// List returns all pairs with the given prefix and the index of the KV store. If waitIndex is not zero, it is
+	// a blocking query which returns once the index exceeds waitIndex or waitTime elapsed.
+	List(ctx context.Context, prefix string, waitIndex uint64, waitTime time.Duration) ([]KVPair, uint64, error)
+
+	// CAS stores the pair if its ModifyIndex equals the index of the stored pair. A ModifyIndex of zero stores
+	// the pair only if the key does not exist yet. It returns false if the index did not match.
+	CAS(ctx context.Context, pair *KVPair) (bool, error)
+
+	// Delete removes key.
+	Delete(ctx context.Context, key string) error
+}
+
+// EventType is the type of a change observed by Watch.
+type EventType int
+
+const (
+	// EventPut is emitted when a policy was created or updated.
+	EventPut EventType = iota
+
+	// EventDelete is emitted when a policy was removed.
+	EventDelete
+)
+
+// Event is a single change observed by Watch. Policy is nil for EventDelete.
+type Event struct {
+	Type   EventType
+	ID     string
+	Policy Policy
+}
+
+// ConsulManager is a Manager storing policies in Consul KV. Reads are served from a local cache which is kept
+// consistent with Consul by blocking queries once Watch has been called.
+type ConsulManager struct {
+	Client  Client
+	Prefix  string
+	Timeout time.Duration
+
+	// WaitTime is the maximum duration of a blocking query. It defaults to five minutes.
+	WaitTime time.Duration
+
+	// OnChange is called by Watch for every policy which was created, updated or removed, including all policies
+	// loaded by the first query.
+	OnChange func(e Event)
+
+	cache   map[string]Policy
+	indices map[string]uint64
+	synced  bool
+	sync.RWMutex
+
+	// closing stops all watches once Close was called, aborting cancels in-flight queries once Close stopped
+	// waiting for them. running counts watches and queries.
+	closed   bool
+	closing  chan struct{}
+	aborting chan struct{}
+	running  sync.WaitGroup
+}
+
+// NewConsulManager initializes a new ConsulManager storing policies below prefix, for example "ladon/policies".
+func NewConsulManager(client Client, prefix string) *ConsulManager {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &ConsulManager{
+		Client:   client,
+		Prefix:   prefix,
+		Timeout:  time.Second * 5,
+		WaitTime: time.Minute * 5,
+		cache:    map[string]Policy{},
+		indices:  map[string]uint64{},
+	}
+}
+
+// context returns the context of a single query, which is canceled after Timeout or when Close gives up waiting.
+func (m *ConsulManager) context() (context.Context, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	ctx, done, err := m.begin(ctx, false)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return ctx, func() { done(); cancel() }, nil
+}
+
+// begin registers a query or watch Close waits for. The returned context is canceled when parent is, when Close
+// is called (for watches) or when Close gives up waiting (for queries).
+func (m *ConsulManager) begin(parent context.Context, watch bool) (context.Context, func(), error) {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil, nil, errors.WithStack(ErrManagerClosed)
+	}
+
+	m.lifecycle()
+	m.running.Add(1)
+	stop := m.aborting
+	if watch {
+		stop = m.closing
+	}
+	m.Unlock()
+
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		m.running.Done()
+	}, nil
+}
+
+// lifecycle initializes the channels used by Close. The lock must be held.
+func (m *ConsulManager) lifecycle() {
+	if m.closing == nil {
+		m.closing = make(chan struct{})
+		m.aborting = make(chan struct{})
+	}
+}
+
+// Ping reads the prefix from Consul, which fails if Consul is unreachable. It is limited by Timeout.
+func (m *ConsulManager) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	ctx, done, err := m.begin(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if _, err := m.Client.Get(ctx, m.Prefix); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close stops all watches and waits for in-flight queries to finish. If ctx is done first, the queries are
+// canceled and ctx.Err() is returned. Afterwards, all calls hitting Consul fail with ErrManagerClosed. The Client
+// is not closed.
+func (m *ConsulManager) Close(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	m.lifecycle()
+	close(m.closing)
+	m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		close(m.aborting)
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func (m *ConsulManager) key(id string) string {
+	return m.Prefix + id
+}
+
+// Watch loads all policies into the local cache and keeps it up to date with blocking queries until ctx is
+// canceled, a query fails or the manager is closed. While the watch is running, reads never hit Consul.
+func (m *ConsulManager) Watch(ctx context.Context) error {
+	ctx, done, err := m.begin(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer done()
+	defer m.invalidate()
+
+	return m.poll(ctx, 0, m.apply)
+}
+
+// WatchPolicies reports every change of the policies below the prefix made after it returned, including changes
+// by other processes. Deleted policies are not retrieved, so the events of deletions carry no policy. The channel
+// is closed when ctx is canceled, a query fails or the manager is closed.
+func (m *ConsulManager) WatchPolicies(ctx context.Context) (<-chan *PolicyEvent, error) {
+	ctx, done, err := m.begin(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, index, err := m.Client.List(ctx, m.Prefix, 0, m.WaitTime)
+	if err != nil {
+		done()
+		return nil, errors.WithStack(err)
+	}
+
+	indices := make(map[string]uint64, len(pairs))
+	for _, pair := range pairs {
+		indices[strings.TrimPrefix(pair.Key, m.Prefix)] = pair.ModifyIndex
+	}
+
+	events := make(chan *PolicyEvent)
+	go func() {
+		defer done()
+		defer close(events)
+
+		_ = m.poll(ctx, index, func(pairs []KVPair) error {
+			changes, next, err := m.diff(pairs, indices)
+			if err != nil {
+				return err
+			}
+
+			indices = next
+			for _, event := range changes {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return errors.WithStack(ctx.Err())
+				}
+			}
+			return nil
+		})
+	}()
+
+	return events, nil
+}
+
+// diff returns the events turning the policies of indices into pairs, ordered by ID, and the indices of pairs.
+func (m *ConsulManager) diff(pairs []KVPair, indices map[string]uint64) ([]*PolicyEvent, map[string]uint64, error) {
+	var events []*PolicyEvent
+	now := time.Now().UTC()
+	next := make(map[string]uint64, len(pairs))
+	for _, pair := range pairs {
+		id := strings.TrimPrefix(pair.Key, m.Prefix)
+		next[id] = pair.ModifyIndex
+
+		index, ok := indices[id]
+		if ok && index == pair.ModifyIndex {
+			continue
+		}
+
+		p, err := decode(pair.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		event := &PolicyEvent{Type: PolicyCreated, ID: id, Policy: p, Time: now}
+		if ok {
+			event.Type = PolicyUpdated
+		}
+		events = append(events, event)
+	}
+
+	for id := range indices {
+		if _, ok := next[id]; !ok {
+			events = append(events, &PolicyEvent{Type: PolicyDeleted, ID: id, Time: now})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, next, nil
+}
+
+// poll runs blocking queries starting at index and calls fn with the result of every query which observed a
+// change, until ctx is canceled, a query fails or fn returns an error.
+func (m *ConsulManager) poll(ctx context.Context, index uint64, fn func(pairs []KVPair) error) error {
+	for {
+		pairs, next, err := m.Client.List(ctx, m.Prefix, index, m.WaitTime)
+		if ctx.Err() != nil {
+			return errors.WithStack(ctx.Err())
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The query timed out without changes.
+		if index > 0 && next == index {
+			continue
+		}
+
+		if err := fn(pairs); err != nil {
+			return err
+		}
+
+		// Consul recommends to start over if the index goes backwards and to never block on index zero.
+		if next < index {
+			index = 0
+		} else {
+			index = next
+		}
+		if index == 0 {
+			index = 1
+		}
+	}
+}
+
+// apply replaces the cache with pairs and reports the differences to OnChange.
+func (m *ConsulManager) apply(pairs []KVPair) error {
+	cache := make(map[string]Policy, len(pairs))
+	indices := make(map[string]uint64, len(pairs))
+	var events []Event
+
+	m.RLock()
+	for _, pair := range pairs {
+		id := strings.TrimPrefix(pair.Key, m.Prefix)
+		if p, ok := m.cache[id]; ok && m.synced && m.indices[id] == pair.ModifyIndex {
+			cache[id], indices[id] = p, pair.ModifyIndex
+			continue
+		}
+
+		p, err := decode(pair.Value)
+		if err != nil {
+			m.RUnlock()
+			return err
+		}
+
+		cache[id], indices[id] = p, pair.ModifyIndex
+		events = append(events, Event{Type: EventPut, ID: id, Policy: p})
+	}
+
+	// Local writes update the cache but not the indices, so the indices tell what the last query observed.
+	for id := range m.indices {
+		if _, ok := cache[id]; !ok {
+			events = append(events, Event{Type: EventDelete, ID: id})
+		}
+	}
+	m.RUnlock()
+
+	m.Lock()
+	m.cache, m.indices, m.synced = cache, indices, true
+	m.Unlock()
+
+	if m.OnChange != nil {
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].ID < events[j].ID
+		})
+		for _, e := range events {
+			m.OnChange(e)
+		}
+	}
+	return nil
+}
+
+// store makes a successful write visible to subsequent reads without waiting for the next blocking query.
+func (m *ConsulManager) store(policy Policy) {
+	m.Lock()
+	defer m.Unlock()
+	if m.synced {
+		m.cache[policy.GetID()] = policy
+	}
+}
+
+func (m *ConsulManager) invalidate() {
+	m.Lock()
+	defer m.Unlock()
+	m.synced = false
+	m.cache = map[string]Policy{}
+	m.indices = map[string]uint64{}
+}
+
+// Create persists the policy.
+func (m *ConsulManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if created, err := m.Client.CAS(ctx, &KVPair{Key: m.key(policy.GetID()), Value: payload}); err != nil {
+		return errors.WithStack(err)
+	} else if !created {
+		return errors.WithStack(ErrPolicyExists)
+	}
+
+	m.store(policy)
+	return nil
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one. The policy is
+// written with a check-and-set on the index it was read at, so concurrent updates fail with ErrVersionConflict
+// instead of overwriting each other.
+func (m *ConsulManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// The cache may lag behind, so the stored version is always read from Consul.
+	pair, err := m.Client.Get(ctx, m.key(policy.GetID()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var current int
+	var index uint64
+	if pair != nil {
+		stored, err := decode(pair.Value)
+		if err != nil {
+			return err
+		}
+		current, index = stored.(VersionedPolicy).GetVersion(), pair.ModifyIndex
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok {
+		if v.GetVersion() != 0 && v.GetVersion() != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if swapped, err := m.Client.CAS(ctx, &KVPair{Key: m.key(policy.GetID()), Value: payload, ModifyIndex: index}); err != nil {
+		return errors.WithStack(err)
+	} else if !swapped {
+		return errors.WithStack(ErrVersionConflict)
+	}
+
+	m.store(policy)
+	return nil
+}
+
+// Get retrieves a policy.
+func (m *ConsulManager) Get(id string) (Policy, error) {
+	m.RLock()
+	p, ok := m.cache[id]
+	synced := m.synced
+	m.RUnlock()
+
+	if ok {
+		return p, nil
+	} else if synced {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	pair, err := m.Client.Get(ctx, m.key(id))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if pair == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	return decode(pair.Value)
+}
+
+// Delete removes a policy.
+func (m *ConsulManager) Delete(id string) error {
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := m.Client.Delete(ctx, m.key(id)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.Lock()
+	delete(m.cache, id)
+	m.Unlock()
+	return nil
+}
+
+// GetAll returns all policies.
+func (m *ConsulManager) GetAll(limit, offset int64) (Policies, error) {
+	ps, err := m.findAllPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].GetID() < ps[j].GetID()
+	})
+
+	start, end := pagination.Index(int(limit), int(offset), len(ps))
+	return ps[start:end], nil
+}
+
+// ForEach calls fn for every policy, ordered by ID. Once the cache is synced, it iterates over a snapshot of the
+// cache. Otherwise all policies are read from Consul with a single query and decoded one at a time.
+func (m *ConsulManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	m.RLock()
+	if m.synced {
+		ps := make(Policies, 0, len(m.cache))
+		for _, p := range m.cache {
+			ps = append(ps, p)
+		}
+		m.RUnlock()
+
+		sort.Slice(ps, func(i, j int) bool {
+			return ps[i].GetID() < ps[j].GetID()
+		})
+		for _, p := range ps {
+			if err := ctx.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m.RUnlock()
+
+	query, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	pairs, _, err := m.Client.List(query, m.Prefix, 0, 0)
+	done()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+	for _, pair := range pairs {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		p, err := decode(pair.Value)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *ConsulManager) findAllPolicies() (Policies, error) {
+	m.RLock()
+	if m.synced {
+		ps := make(Policies, 0, len(m.cache))
+		for _, p := range m.cache {
+			ps = append(ps, p)
+		}
+		m.RUnlock()
+		return ps, nil
+	}
+	m.RUnlock()
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	pairs, _, err := m.Client.List(ctx, m.Prefix, 0, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ps := make(Policies, len(pairs))
+	for i, pair := range pairs {
+		if ps[i], err = decode(pair.Value); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// FindRequestCandidates returns the policies of the request's tenant.
+func (m *ConsulManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ps, err := m.findAllPolicies()
+	if err != nil {
+		return nil, err
+	}
+	return FilterTenant(ps, r.Tenant), nil
+}
+
+// FindPoliciesForSubject returns all policies.
+func (m *ConsulManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.findAllPolicies()
+}
+
+// FindPoliciesForResource returns all policies.
+func (m *ConsulManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.findAllPolicies()
+}
+
+func decode(payload []byte) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
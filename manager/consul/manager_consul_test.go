@@ -0,0 +1,337 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package consul
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+type fakeClient struct {
+	sync.Mutex
+	data    map[string]KVPair
+	index   uint64
+	changed chan struct{}
+	reads   int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{data: map[string]KVPair{}, index: 1, changed: make(chan struct{})}
+}
+
+func (c *fakeClient) Get(_ context.Context, key string) (*KVPair, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.reads++
+	pair, ok := c.data[key]
+	if !ok {
+		return nil, nil
+	}
+	return &pair, nil
+}
+
+func (c *fakeClient) List(ctx context.Context, prefix string, waitIndex uint64, waitTime time.Duration) ([]KVPair, uint64, error) {
+	c.Lock()
+	if waitIndex > 0 && c.index <= waitIndex {
+		changed := c.changed
+		c.Unlock()
+
+		select {
+		case <-changed:
+		case <-time.After(waitTime):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+		c.Lock()
+	}
+	defer c.Unlock()
+
+	c.reads++
+	var pairs []KVPair
+	for k, pair := range c.data {
+		if strings.HasPrefix(k, prefix) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, c.index, nil
+}
+
+func (c *fakeClient) CAS(_ context.Context, pair *KVPair) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.data[pair.Key].ModifyIndex != pair.ModifyIndex {
+		return false, nil
+	}
+	c.put(pair.Key, pair.Value)
+	return true, nil
+}
+
+func (c *fakeClient) Put(_ context.Context, key string, value []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	c.put(key, value)
+	return nil
+}
+
+func (c *fakeClient) Delete(_ context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.data, key)
+	c.notify()
+	return nil
+}
+
+func (c *fakeClient) put(key string, value []byte) {
+	c.index++
+	c.data[key] = KVPair{Key: key, Value: value, ModifyIndex: c.index}
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeClient) notify() {
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	for i := 0; i < 1000; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition was not met in time")
+}
+
+func policy(id, subject string) *ladon.DefaultPolicy {
+	return &ladon.DefaultPolicy{
+		ID:        id,
+		Subjects:  []string{subject},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"get"},
+		Effect:    ladon.AllowAccess,
+	}
+}
+
+func TestConsulManager(t *testing.T) {
+	m := NewConsulManager(newFakeClient(), "/ladon/policies")
+	assert.Equal(t, "ladon/policies/", m.Prefix)
+
+	require.NoError(t, m.Create(policy("1", "peter")))
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(policy("1", "peter"))))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter"}, got.GetSubjects())
+
+	require.NoError(t, m.Update(policy("1", "max")))
+	ps, err := m.FindRequestCandidates(&ladon.Request{Subject: "max"})
+	require.NoError(t, err)
+	require.Len(t, ps, 1)
+	assert.Equal(t, []string{"max"}, ps[0].GetSubjects())
+
+	require.NoError(t, m.Delete("1"))
+	_, err = m.Get("1")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+}
+
+func TestConsulManagerForEach(t *testing.T) {
+	c := newFakeClient()
+	m := NewConsulManager(c, "ladon/policies")
+	for _, id := range []string{"3", "1", "2"} {
+		require.NoError(t, m.Create(policy(id, "peter")))
+	}
+
+	var ids []string
+	reads := c.reads
+	require.NoError(t, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		ids = append(ids, p.GetID())
+		return nil
+	}))
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+	assert.Equal(t, reads+1, c.reads, "all policies are read with a single query")
+
+	stop := errors.New("stop")
+	assert.Equal(t, stop, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		return stop
+	}))
+}
+
+// racingClient writes key whenever it is read, like another process updating the policy right after Update read it.
+type racingClient struct {
+	*fakeClient
+	key string
+}
+
+func (c *racingClient) Get(ctx context.Context, key string) (*KVPair, error) {
+	pair, err := c.fakeClient.Get(ctx, key)
+	if key == c.key && pair != nil {
+		_ = c.Put(ctx, key, pair.Value)
+	}
+	return pair, err
+}
+
+func TestConsulManagerVersions(t *testing.T) {
+	c := newFakeClient()
+	m := NewConsulManager(c, "ladon/policies")
+	p := policy("1", "peter")
+	require.NoError(t, m.Create(p))
+	assert.Equal(t, 1, p.Version)
+
+	stale := *p
+	require.NoError(t, m.Update(p))
+	assert.Equal(t, 2, p.Version)
+
+	stale.Subjects = []string{"max"}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(&stale)))
+
+	// Writes in between reading and writing the policy are detected as well.
+	m.Client = &racingClient{fakeClient: c, key: "ladon/policies/1"}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(p)))
+
+	got, err := NewConsulManager(c, "ladon/policies").Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter"}, got.GetSubjects())
+}
+
+func TestConsulManagerWatch(t *testing.T) {
+	c := newFakeClient()
+	m := NewConsulManager(c, "ladon/policies")
+	require.NoError(t, m.Create(policy("1", "peter")))
+	require.NoError(t, m.Create(policy("2", "max")))
+
+	var lock sync.Mutex
+	var events []Event
+	m.OnChange = func(e Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, e)
+	}
+	received := func(n int) func() bool {
+		return func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(events) == n
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- m.Watch(ctx) }()
+
+	eventually(t, received(2))
+	assert.Equal(t, "1", events[0].ID)
+	assert.Equal(t, EventPut, events[1].Type)
+
+	// Reads are served from the cache.
+	c.Lock()
+	reads := c.reads
+	c.Unlock()
+	_, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	_, err = m.Get("1")
+	require.NoError(t, err)
+	_, err = m.Get("3")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+	c.Lock()
+	assert.Equal(t, reads, c.reads)
+	c.Unlock()
+
+	// Changes made by others are picked up by the blocking query.
+	require.NoError(t, c.Put(context.Background(), "ladon/policies/3", []byte(`{"id": "3", "subjects": ["ken"], "effect": "allow"}`)))
+	eventually(t, received(3))
+	got, err := m.Get("3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ken"}, got.GetSubjects())
+
+	require.NoError(t, m.Delete("1"))
+	eventually(t, received(4))
+	assert.Equal(t, Event{Type: EventDelete, ID: "1"}, events[3])
+
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(<-stopped))
+
+	// Without a watch, reads hit Consul again.
+	_, err = m.Get("2")
+	require.NoError(t, err)
+	c.Lock()
+	assert.True(t, c.reads > reads)
+	c.Unlock()
+}
+
+func TestConsulManagerWatchPolicies(t *testing.T) {
+	c := newFakeClient()
+	m := NewConsulManager(c, "ladon/policies")
+	require.NoError(t, m.Create(policy("1", "peter")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := m.WatchPolicies(ctx)
+	require.NoError(t, err)
+
+	// Policies existing before the watch started are not reported.
+	require.NoError(t, m.Create(policy("2", "max")))
+	e := <-events
+	assert.Equal(t, ladon.PolicyCreated, e.Type)
+	assert.Equal(t, "2", e.ID)
+	assert.Equal(t, []string{"max"}, e.Policy.GetSubjects())
+
+	require.NoError(t, m.Update(policy("1", "ken")))
+	e = <-events
+	assert.Equal(t, ladon.PolicyUpdated, e.Type)
+	assert.Equal(t, []string{"ken"}, e.Policy.GetSubjects())
+
+	require.NoError(t, m.Delete("2"))
+	e = <-events
+	assert.Equal(t, ladon.PolicyDeleted, e.Type)
+	assert.Equal(t, "2", e.ID)
+	assert.Nil(t, e.Policy)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestConsulManagerClose(t *testing.T) {
+	m := NewConsulManager(newFakeClient(), "ladon/policies")
+
+	stopped := make(chan error)
+	go func() { stopped <- m.Watch(context.Background()) }()
+	eventually(t, func() bool {
+		m.RLock()
+		defer m.RUnlock()
+		return m.synced
+	})
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.Equal(t, context.Canceled, errors.Cause(<-stopped))
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Create(policy("1", "peter"))))
+	assert.NoError(t, m.Close(context.Background()))
+}
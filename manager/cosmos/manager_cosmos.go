@@ -0,0 +1,531 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package cosmos provides a Manager storing policies in an Azure Cosmos DB container using the SQL API, so services
+// running on Azure can keep policies in a managed, globally distributed database.
+//
+// Each policy is stored as one item whose ID is the policy ID. Besides the policy, the item holds the literal
+// subjects and resources, flags for policies with patterns and the tenant, so candidate lookups are SQL queries
+// evaluated by Cosmos DB instead of full scans.
+//
+// Items are spread across logical partitions by the Partitioner, whose key is stored in the "pk" property. Create
+// the container with the partition key path "/pk":
+//
+//   - TenantPartitioner puts all policies of a tenant in one logical partition, so request candidates are read with
+//     a single-partition query. Use it if there are many tenants of similar size, because a logical partition holds
+//     at most 20 GB and is served by a single physical partition.
+//   - SubjectHashPartitioner spreads policies with a single literal subject, such as per-user grants, across a fixed
+//     number of buckets by the hash of the subject. All other policies share one partition. Request candidates are
+//     read from the bucket of the subject and the shared partition. Use it if there are few tenants or one tenant
+//     holds most of the policies.
+//
+// IDs are only unique within a logical partition in Cosmos DB, so Get, Update and Delete find policies with a
+// cross-partition query, and Create checks that the ID is not used in another partition.
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// Status codes of Cosmos DB responses handled by CosmosManager.
+const (
+	StatusNotFound           = 404
+	StatusConflict           = 409
+	StatusPreconditionFailed = 412
+	StatusTooManyRequests    = 429
+)
+
+// Queries run by CosmosManager. Values are passed as parameters.
+const (
+	queryID         = "SELECT * FROM c WHERE c.id = @id"
+	queryAll        = "SELECT * FROM c ORDER BY c.id OFFSET @offset LIMIT @limit"
+	queryCandidates = "SELECT * FROM c WHERE c.tenant = @tenant AND (ARRAY_CONTAINS(c.subjects, @value) OR c.subject_pattern = true)"
+	querySubject    = "SELECT * FROM c WHERE ARRAY_CONTAINS(c.subjects, @value) OR c.subject_pattern = true"
+	queryResource   = "SELECT * FROM c WHERE ARRAY_CONTAINS(c.resources, @value) OR c.resource_pattern = true"
+	queryPing       = "SELECT TOP 1 c.id FROM c"
+)
+
+// Item is the stored form of a policy. ETag is set by Cosmos DB and returned by queries.
+type Item struct {
+	ID              string          `json:"id"`
+	PartitionKey    string          `json:"pk"`
+	Policy          json.RawMessage `json:"policy"`
+	Version         int             `json:"version"`
+	Tenant          string          `json:"tenant"`
+	Subjects        []string        `json:"subjects"`
+	Resources       []string        `json:"resources"`
+	SubjectPattern  bool            `json:"subject_pattern"`
+	ResourcePattern bool            `json:"resource_pattern"`
+	ETag            string          `json:"_etag,omitempty"`
+}
+
+// Param is a parameter of a query, for example Param{Name: "@id", Value: "1"}.
+type Param struct {
+	Name  string
+	Value interface{}
+}
+
+// Error is an error response of Cosmos DB. Adapters convert the errors of their client, for example an
+// *azcore.ResponseError, to *Error, so CosmosManager can detect conflicts and retry throttled requests. RetryAfter
+// is the value of the x-ms-retry-after-ms header of throttled requests.
+type Error struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Cosmos DB responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Client is the contract CosmosManager requires from a Cosmos DB container. It maps to the methods of an
+// *azcosmos.ContainerClient with the partition key passed as azcosmos.NewPartitionKeyString. Failed requests return
+// an *Error. The SDK retries throttled requests itself unless its retry options are set to zero; CosmosManager
+// retries them on top, honoring the delay requested by Cosmos DB.
+type Client interface {
+	// Query runs a SQL query within the given partition, or across all partitions if partitionKey is empty, and
+	// returns all pages of the result.
+	Query(ctx context.Context, partitionKey, query string, params ...Param) ([]Item, error)
+
+	// CreateItem stores a new item. It fails with StatusConflict if the partition contains an item with its ID.
+	CreateItem(ctx context.Context, partitionKey string, item *Item) error
+
+	// ReplaceItem replaces an existing item. It fails with StatusPreconditionFailed unless the ETag of the stored
+	// item equals etag.
+	ReplaceItem(ctx context.Context, partitionKey string, item *Item, etag string) error
+
+	// DeleteItem removes an item. It fails with StatusNotFound if the item does not exist.
+	DeleteItem(ctx context.Context, partitionKey, id string) error
+}
+
+// Partitioner chooses the logical partitions of policies.
+type Partitioner interface {
+	// PolicyPartition returns the partition key of p.
+	PolicyPartition(p Policy) string
+
+	// RequestPartitions returns the partition keys of all policies which could be request candidates for r.
+	RequestPartitions(r *Request) []string
+}
+
+// TenantPartitioner partitions policies by their tenant.
+type TenantPartitioner struct{}
+
+// PolicyPartition returns "tenant:" followed by the tenant of p.
+func (TenantPartitioner) PolicyPartition(p Policy) string {
+	return "tenant:" + PolicyTenant(p)
+}
+
+// RequestPartitions returns the partition of the request's tenant.
+func (TenantPartitioner) RequestPartitions(r *Request) []string {
+	return []string{"tenant:" + r.Tenant}
+}
+
+// SubjectHashPartitioner partitions policies with a single literal subject by the hash of the subject into Buckets
+// partitions. All other policies are stored in one shared partition. Changing Buckets requires moving all items.
+type SubjectHashPartitioner struct {
+	Buckets int
+}
+
+func (s SubjectHashPartitioner) bucket(subject string) string {
+	buckets := s.Buckets
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(subject))
+	return "subject:" + strconv.Itoa(int(h.Sum32()%uint32(buckets)))
+}
+
+// PolicyPartition returns the bucket of the subject of p, or "subject:*" if p has several subjects or a pattern.
+func (s SubjectHashPartitioner) PolicyPartition(p Policy) string {
+	if subjects := p.GetSubjects(); len(subjects) == 1 && IsLiteralTemplate(p, subjects[0]) {
+		return s.bucket(subjects[0])
+	}
+	return "subject:*"
+}
+
+// RequestPartitions returns the bucket of the request's subject and the shared partition.
+func (s SubjectHashPartitioner) RequestPartitions(r *Request) []string {
+	return []string{s.bucket(r.Subject), "subject:*"}
+}
+
+// CosmosManager is a Manager storing policies in a Cosmos DB container. Use NewCosmosManager to construct it.
+type CosmosManager struct {
+	Client      Client
+	Partitioner Partitioner
+
+	// Timeout limits every operation, including the retries of throttled requests.
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a throttled request is retried. Cosmos DB throttles requests which exceed
+	// the provisioned throughput, so they are retried after the delay it asks for, or after an exponential backoff
+	// starting at RetryBackoff if it does not.
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// NewCosmosManager initializes a new CosmosManager which partitions policies by tenant.
+func NewCosmosManager(client Client) *CosmosManager {
+	return &CosmosManager{
+		Client:       client,
+		Partitioner:  TenantPartitioner{},
+		Timeout:      time.Second * 5,
+		MaxRetries:   9,
+		RetryBackoff: time.Millisecond * 100,
+	}
+}
+
+func (m *CosmosManager) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), m.Timeout)
+}
+
+// retry runs op until it does not fail with StatusTooManyRequests, MaxRetries is exceeded or ctx is done.
+func (m *CosmosManager) retry(ctx context.Context, op func() error) error {
+	backoff := m.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if !isStatus(err, StatusTooManyRequests) || attempt >= m.MaxRetries {
+			return err
+		}
+
+		wait := errors.Cause(err).(*Error).RetryAfter
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.WithStack(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func isStatus(err error, status int) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.StatusCode == status
+}
+
+func (m *CosmosManager) query(ctx context.Context, partitionKey, query string, params ...Param) (items []Item, err error) {
+	err = m.retry(ctx, func() (err error) {
+		items, err = m.Client.Query(ctx, partitionKey, query, params...)
+		return errors.WithStack(err)
+	})
+	return items, err
+}
+
+// stored returns the item of the policy with the given ID, or nil if it does not exist.
+func (m *CosmosManager) stored(ctx context.Context, id string) (*Item, error) {
+	items, err := m.query(ctx, "", queryID, Param{Name: "@id", Value: id})
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// item returns the stored form of p.
+func (m *CosmosManager) item(p Policy) (*Item, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	item := &Item{
+		ID:           p.GetID(),
+		PartitionKey: m.Partitioner.PolicyPartition(p),
+		Policy:       payload,
+		Tenant:       PolicyTenant(p),
+		Subjects:     []string{},
+		Resources:    []string{},
+	}
+	if v, ok := p.(VersionedPolicy); ok {
+		item.Version = v.GetVersion()
+	}
+
+	for _, s := range p.GetSubjects() {
+		if IsLiteralTemplate(p, s) {
+			item.Subjects = append(item.Subjects, s)
+		} else {
+			item.SubjectPattern = true
+		}
+	}
+
+	for _, r := range p.GetResources() {
+		if IsLiteralTemplate(p, r) {
+			item.Resources = append(item.Resources, r)
+		} else {
+			item.ResourcePattern = true
+		}
+	}
+	return item, nil
+}
+
+func (m *CosmosManager) create(ctx context.Context, item *Item) error {
+	err := m.retry(ctx, func() error {
+		return errors.WithStack(m.Client.CreateItem(ctx, item.PartitionKey, item))
+	})
+	if isStatus(err, StatusConflict) {
+		return errors.WithStack(ErrPolicyExists)
+	}
+	return err
+}
+
+func (m *CosmosManager) delete(ctx context.Context, item *Item) error {
+	err := m.retry(ctx, func() error {
+		return errors.WithStack(m.Client.DeleteItem(ctx, item.PartitionKey, item.ID))
+	})
+	if isStatus(err, StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Create persists the policy.
+func (m *CosmosManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+
+	item, err := m.item(policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	if stored, err := m.stored(ctx, item.ID); err != nil {
+		return err
+	} else if stored != nil {
+		return errors.WithStack(ErrPolicyExists)
+	}
+	return m.create(ctx, item)
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one. Concurrent updates
+// are detected by the ETag of the stored item. If the update moves the policy to another partition, the item is
+// created in the new partition before it is removed from the old one, which is not atomic.
+func (m *CosmosManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	stored, err := m.stored(ctx, policy.GetID())
+	if err != nil {
+		return err
+	}
+
+	v, versioned := policy.(VersionedPolicy)
+	var requested int
+	if versioned {
+		requested = v.GetVersion()
+
+		var current int
+		if stored != nil {
+			current = stored.Version
+		}
+
+		if requested != 0 && requested != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	if err := m.update(ctx, policy, stored); err != nil {
+		if versioned {
+			v.SetVersion(requested)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *CosmosManager) update(ctx context.Context, policy Policy, stored *Item) error {
+	item, err := m.item(policy)
+	if err != nil {
+		return err
+	}
+
+	if stored == nil {
+		return m.create(ctx, item)
+	} else if stored.PartitionKey != item.PartitionKey {
+		if err := m.create(ctx, item); err != nil {
+			return err
+		}
+		return m.delete(ctx, stored)
+	}
+
+	err = m.retry(ctx, func() error {
+		return errors.WithStack(m.Client.ReplaceItem(ctx, item.PartitionKey, item, stored.ETag))
+	})
+	if isStatus(err, StatusPreconditionFailed) || isStatus(err, StatusNotFound) {
+		return errors.WithStack(ErrVersionConflict)
+	}
+	return err
+}
+
+// Get retrieves a policy.
+func (m *CosmosManager) Get(id string) (Policy, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	item, err := m.stored(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if item == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return decode(item)
+}
+
+// Delete removes a policy.
+func (m *CosmosManager) Delete(id string) error {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	item, err := m.stored(ctx, id)
+	if err != nil || item == nil {
+		return err
+	}
+	return m.delete(ctx, item)
+}
+
+// GetAll returns all policies, ordered by ID.
+func (m *CosmosManager) GetAll(limit, offset int64) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	items, err := m.query(ctx, "", queryAll, Param{Name: "@offset", Value: offset}, Param{Name: "@limit", Value: limit})
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll(items)
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *CosmosManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject. Only the partitions returned by the Partitioner are queried.
+func (m *CosmosManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	var items []Item
+	for _, partition := range m.Partitioner.RequestPartitions(r) {
+		found, err := m.query(ctx, partition, queryCandidates, Param{Name: "@tenant", Value: r.Tenant}, Param{Name: "@value", Value: r.Subject})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, found...)
+	}
+	return decodeAll(items)
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject pattern.
+func (m *CosmosManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.find(querySubject, subject)
+}
+
+// FindPoliciesForResource returns the policies containing the resource verbatim and all policies with at least
+// one resource pattern.
+func (m *CosmosManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.find(queryResource, resource)
+}
+
+func (m *CosmosManager) find(query, value string) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	items, err := m.query(ctx, "", query, Param{Name: "@value", Value: value})
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll(items)
+}
+
+// Ping reads a single item of the container, which fails if Cosmos DB is unreachable. It is limited by Timeout.
+func (m *CosmosManager) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.query(ctx, "", queryPing)
+	return err
+}
+
+// Close does nothing. The Client is not closed, because it is owned by the caller.
+func (m *CosmosManager) Close(ctx context.Context) error {
+	return nil
+}
+
+// decodeAll decodes items, skipping items whose ID was seen before.
+func decodeAll(items []Item) (Policies, error) {
+	ps := make(Policies, 0, len(items))
+	seen := map[string]bool{}
+	for k := range items {
+		if seen[items[k].ID] {
+			continue
+		}
+		seen[items[k].ID] = true
+
+		p, err := decode(&items[k])
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func decode(item *Item) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal(item.Policy, &p); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode policy %s", item.ID)
+	}
+	return &p, nil
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package cosmos
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+type fakeQuery struct {
+	partitionKey string
+	query        string
+}
+
+// fakeClient is an in-memory Client which evaluates the queries of CosmosManager. The next throttled requests
+// fail with StatusTooManyRequests.
+type fakeClient struct {
+	sync.Mutex
+	items     map[string]map[string]Item
+	etag      int
+	queries   []fakeQuery
+	throttled int
+	requests  int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{items: map[string]map[string]Item{}}
+}
+
+func (c *fakeClient) throttle() error {
+	c.requests++
+	if c.throttled > 0 {
+		c.throttled--
+		return &Error{StatusCode: StatusTooManyRequests, RetryAfter: time.Millisecond, Message: "Request rate is large"}
+	}
+	return nil
+}
+
+func (c *fakeClient) Query(ctx context.Context, partitionKey, query string, params ...Param) ([]Item, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.throttle(); err != nil {
+		return nil, err
+	}
+	c.queries = append(c.queries, fakeQuery{partitionKey: partitionKey, query: query})
+
+	values := map[string]interface{}{}
+	for _, p := range params {
+		values[p.Name] = p.Value
+	}
+
+	var items []Item
+	for pk, partition := range c.items {
+		if partitionKey != "" && pk != partitionKey {
+			continue
+		}
+		for _, item := range partition {
+			var ok bool
+			switch query {
+			case queryID:
+				ok = item.ID == values["@id"]
+			case queryAll, queryPing:
+				ok = true
+			case queryCandidates:
+				ok = item.Tenant == values["@tenant"] && (contains(item.Subjects, values["@value"].(string)) || item.SubjectPattern)
+			case querySubject:
+				ok = contains(item.Subjects, values["@value"].(string)) || item.SubjectPattern
+			case queryResource:
+				ok = contains(item.Resources, values["@value"].(string)) || item.ResourcePattern
+			}
+			if ok {
+				items = append(items, item)
+			}
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+	if query == queryAll {
+		offset, limit := int(values["@offset"].(int64)), int(values["@limit"].(int64))
+		if offset > len(items) {
+			offset = len(items)
+		}
+		items = items[offset:]
+		if limit < len(items) {
+			items = items[:limit]
+		}
+	}
+	return items, nil
+}
+
+func (c *fakeClient) store(partitionKey string, item *Item) {
+	if c.items[partitionKey] == nil {
+		c.items[partitionKey] = map[string]Item{}
+	}
+	c.etag++
+	stored := *item
+	stored.ETag = strconv.Itoa(c.etag)
+	c.items[partitionKey][item.ID] = stored
+}
+
+func (c *fakeClient) CreateItem(ctx context.Context, partitionKey string, item *Item) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.throttle(); err != nil {
+		return err
+	} else if _, ok := c.items[partitionKey][item.ID]; ok {
+		return &Error{StatusCode: StatusConflict, Message: "Entity with the specified id already exists"}
+	}
+	c.store(partitionKey, item)
+	return nil
+}
+
+func (c *fakeClient) ReplaceItem(ctx context.Context, partitionKey string, item *Item, etag string) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.throttle(); err != nil {
+		return err
+	} else if stored, ok := c.items[partitionKey][item.ID]; !ok {
+		return &Error{StatusCode: StatusNotFound, Message: "Entity with the specified id does not exist"}
+	} else if stored.ETag != etag {
+		return &Error{StatusCode: StatusPreconditionFailed, Message: "Operation cannot be performed because one of the specified precondition is not met"}
+	}
+	c.store(partitionKey, item)
+	return nil
+}
+
+func (c *fakeClient) DeleteItem(ctx context.Context, partitionKey, id string) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.throttle(); err != nil {
+		return err
+	} else if _, ok := c.items[partitionKey][id]; !ok {
+		return &Error{StatusCode: StatusNotFound, Message: "Entity with the specified id does not exist"}
+	}
+	delete(c.items[partitionKey], id)
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func ids(t *testing.T, ps ladon.Policies, err error) []string {
+	require.NoError(t, err)
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.GetID())
+	}
+	sort.Strings(out)
+	return out
+}
+
+var policies = []*ladon.DefaultPolicy{
+	{ID: "1", Subjects: []string{"peter", "max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+	{ID: "2", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+	{ID: "3", Subjects: []string{"ken"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Tenant: "acme"},
+	{ID: "4", Subjects: []string{"team:*"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeGlob},
+}
+
+func TestCosmosManager(t *testing.T) {
+	c := newFakeClient()
+	m := NewCosmosManager(c)
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "3", Effect: ladon.AllowAccess})), "IDs are unique across partitions")
+	_, err := m.Get("5")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter", "max"}, got.GetSubjects())
+
+	item := c.items["tenant:"]["2"]
+	assert.Equal(t, []string{}, item.Subjects)
+	assert.True(t, item.SubjectPattern)
+	assert.True(t, item.ResourcePattern)
+	assert.Equal(t, 1, item.Version)
+	assert.Contains(t, c.items["tenant:acme"], "3")
+
+	ps, err := m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"1", "2", "4"}, ids(t, ps, err))
+	ps, err = m.FindPoliciesForResource("users:1")
+	assert.Equal(t, []string{"2", "3", "4"}, ids(t, ps, err))
+
+	// Request candidates are filtered by Cosmos DB within the partition of the tenant.
+	c.queries = nil
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})
+	assert.Equal(t, []string{"3"}, ids(t, ps, err))
+	assert.Equal(t, []fakeQuery{{partitionKey: "tenant:acme", query: queryCandidates}}, c.queries)
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}))
+	ps, err = m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"2", "4"}, ids(t, ps, err))
+	assert.Equal(t, 2, c.items["tenant:"]["1"].Version)
+
+	stale := &ladon.DefaultPolicy{ID: "1", Version: 1, Subjects: []string{"peter"}, Effect: ladon.AllowAccess}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(stale)))
+	assert.Equal(t, 1, stale.Version)
+
+	// Changing the tenant moves the policy to another partition.
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Tenant: "acme"}))
+	assert.NotContains(t, c.items["tenant:"], "1")
+	assert.Equal(t, 3, c.items["tenant:acme"]["1"].Version)
+
+	require.NoError(t, m.Delete("2"))
+	require.NoError(t, m.Delete("2"))
+	ps, err = m.FindPoliciesForSubject("max")
+	assert.Equal(t, []string{"1", "4"}, ids(t, ps, err))
+
+	all, err := m.GetAll(10, 1)
+	assert.Equal(t, []string{"3", "4"}, ids(t, all, err))
+	require.NoError(t, m.Ping(context.Background()))
+}
+
+func TestCosmosManagerConcurrentUpdate(t *testing.T) {
+	c := newFakeClient()
+	m := NewCosmosManager(c)
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Effect: ladon.AllowAccess}))
+
+	stored, err := m.stored(context.Background(), "1")
+	require.NoError(t, err)
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}))
+
+	// The ETag changed since the item was read.
+	err = m.update(context.Background(), &ladon.DefaultPolicy{ID: "1", Subjects: []string{"ken"}, Effect: ladon.AllowAccess}, stored)
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(err))
+	assert.Contains(t, c.items["tenant:"]["1"].Subjects, "peter")
+}
+
+func TestSubjectHashPartitioner(t *testing.T) {
+	c := newFakeClient()
+	m := NewCosmosManager(c)
+	m.Partitioner = SubjectHashPartitioner{Buckets: 16}
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+
+	bucket := SubjectHashPartitioner{Buckets: 16}.bucket("ken")
+	assert.Contains(t, c.items[bucket], "3")
+	for _, id := range []string{"1", "2", "4"} {
+		assert.Contains(t, c.items["subject:*"], id)
+	}
+
+	c.queries = nil
+	ps, err := m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})
+	assert.Equal(t, []string{"3"}, ids(t, ps, err))
+	assert.Equal(t, []fakeQuery{{partitionKey: bucket, query: queryCandidates}, {partitionKey: "subject:*", query: queryCandidates}}, c.queries)
+
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "peter"})
+	assert.Equal(t, []string{"1", "2", "4"}, ids(t, ps, err))
+}
+
+func TestCosmosManagerThrottling(t *testing.T) {
+	c := newFakeClient()
+	m := NewCosmosManager(c)
+
+	c.throttled = 3
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Effect: ladon.AllowAccess}))
+	assert.Equal(t, 5, c.requests, "the lookup is retried three times before the item is created")
+
+	m.MaxRetries = 2
+	c.throttled = 3
+	_, err := m.Get("1")
+	assert.True(t, isStatus(err, StatusTooManyRequests))
+
+	// Without a delay from Cosmos DB, retries back off exponentially until the context is done.
+	m.MaxRetries = 100
+	m.RetryBackoff = time.Millisecond * 20
+	m.Timeout = time.Millisecond * 50
+	c.throttled = 100
+	_, err = m.Get("1")
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
@@ -0,0 +1,694 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package elasticsearch provides a Manager storing policies in an Elasticsearch or OpenSearch index, for deployments
+// which search policies by their description, metadata or labels, for example in admin consoles and audits.
+//
+// Each policy is stored as one document whose ID is the policy ID. Besides the encoded policy, the document holds
+// the literal subjects and resources as keywords, flags for policies with patterns, the tenant, the labels and the
+// description and metadata as full text. Request candidates are found with terms queries. EnsureIndex creates the
+// index with Mapping, or adds new fields of Mapping to an existing index.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// Mapping is the index mapping of policy documents. The encoded policy is stored, but not indexed.
+var Mapping = []byte(`{
+  "mappings": {
+    "dynamic": "strict",
+    "properties": {
+      "id": {"type": "keyword"},
+      "policy": {"type": "object", "enabled": false},
+      "version": {"type": "integer"},
+      "tenant": {"type": "keyword"},
+      "effect": {"type": "keyword"},
+      "description": {"type": "text"},
+      "meta": {"type": "text"},
+      "labels": {"type": "keyword"},
+      "subjects": {"type": "keyword"},
+      "resources": {"type": "keyword"},
+      "actions": {"type": "keyword"},
+      "subject_pattern": {"type": "boolean"},
+      "resource_pattern": {"type": "boolean"}
+    }
+  }
+}`)
+
+// Client performs requests against Elasticsearch or OpenSearch. The URL of requests only carries the path and
+// query, the client adds the address of a node. It is implemented by *elasticsearch.Client of go-elasticsearch and
+// *opensearch.Client of opensearch-go.
+type Client interface {
+	Perform(r *http.Request) (*http.Response, error)
+}
+
+// Error is an error response of Elasticsearch.
+type Error struct {
+	StatusCode int
+	Type       string
+	Reason     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Elasticsearch responded with status %d: %s: %s", e.StatusCode, e.Type, e.Reason)
+}
+
+// document is the stored form of a policy. Labels are stored as "key=value".
+type document struct {
+	ID              string          `json:"id"`
+	Policy          json.RawMessage `json:"policy"`
+	Version         int             `json:"version"`
+	Tenant          string          `json:"tenant"`
+	Effect          string          `json:"effect"`
+	Description     string          `json:"description"`
+	Meta            string          `json:"meta"`
+	Labels          []string        `json:"labels"`
+	Subjects        []string        `json:"subjects"`
+	Resources       []string        `json:"resources"`
+	Actions         []string        `json:"actions"`
+	SubjectPattern  bool            `json:"subject_pattern"`
+	ResourcePattern bool            `json:"resource_pattern"`
+}
+
+// hit is a document returned by the get, mget and search APIs.
+type hit struct {
+	ID          string   `json:"_id"`
+	Found       bool     `json:"found"`
+	SeqNo       int64    `json:"_seq_no"`
+	PrimaryTerm int64    `json:"_primary_term"`
+	Source      document `json:"_source"`
+}
+
+// bulkItem is the result of a single action of a bulk request.
+type bulkItem struct {
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// ElasticsearchManager is a Manager storing policies in an Elasticsearch or OpenSearch index. Use
+// NewElasticsearchManager to construct it.
+type ElasticsearchManager struct {
+	Client  Client
+	Index   string
+	Timeout time.Duration
+
+	// Refresh is passed as the refresh parameter of writes. It defaults to "wait_for", so policies are found by
+	// searches once a write returns. Set it to "false" for faster writes if searches may lag behind.
+	Refresh string
+
+	// MaxResults is the maximum number of policies a search may return. Searches matching more policies fail
+	// instead of returning an incomplete list. It defaults to 10000, the default of index.max_result_window.
+	MaxResults int
+}
+
+// NewElasticsearchManager initializes a new ElasticsearchManager storing policies in the given index, for example
+// "ladon-policies".
+func NewElasticsearchManager(client Client, index string) *ElasticsearchManager {
+	return &ElasticsearchManager{
+		Client:     client,
+		Index:      index,
+		Timeout:    time.Second * 5,
+		Refresh:    "wait_for",
+		MaxResults: 10000,
+	}
+}
+
+func (m *ElasticsearchManager) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), m.Timeout)
+}
+
+// do performs a request and decodes the response into out. body is encoded as JSON unless it is a []byte, which
+// is sent as newline delimited JSON. Responses with a status of 300 and above are returned as *Error, except for
+// the statuses in accept, whose responses are decoded as well.
+func (m *ElasticsearchManager) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}, accept ...int) (int, error) {
+	var payload io.Reader
+	contentType := "application/json"
+	if raw, ok := body.([]byte); ok {
+		payload = bytes.NewReader(raw)
+		contentType = "application/x-ndjson"
+	} else if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		payload = bytes.NewReader(raw)
+	}
+
+	u := &url.URL{Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), payload)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := m.Client.Perform(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, errors.WithStack(err)
+	}
+
+	accepted := res.StatusCode < 300
+	for _, status := range accept {
+		accepted = accepted || res.StatusCode == status
+	}
+
+	if !accepted {
+		var e struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(raw, &e)
+		return res.StatusCode, errors.WithStack(&Error{StatusCode: res.StatusCode, Type: e.Error.Type, Reason: e.Error.Reason})
+	}
+
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return res.StatusCode, errors.WithStack(err)
+		}
+	}
+	return res.StatusCode, nil
+}
+
+func (m *ElasticsearchManager) writeParams() url.Values {
+	return url.Values{"refresh": {m.Refresh}}
+}
+
+// EnsureIndex creates the index with Mapping. If the index exists, the fields of Mapping are added to its mapping,
+// which fails if the type of an existing field differs.
+func (m *ElasticsearchManager) EnsureIndex(ctx context.Context) error {
+	var mapping map[string]json.RawMessage
+	if err := json.Unmarshal(Mapping, &mapping); err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err := m.do(ctx, http.MethodPut, "/"+m.Index, nil, mapping, nil)
+	if e, ok := errors.Cause(err).(*Error); !ok || e.Type != "resource_already_exists_exception" {
+		return err
+	}
+
+	_, err = m.do(ctx, http.MethodPut, "/"+m.Index+"/_mapping", nil, mapping["mappings"], nil)
+	return err
+}
+
+// newDocument returns the stored form of p.
+func newDocument(p Policy) (*document, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	doc := &document{
+		ID:          p.GetID(),
+		Policy:      payload,
+		Tenant:      PolicyTenant(p),
+		Effect:      p.GetEffect(),
+		Description: p.GetDescription(),
+		Meta:        string(p.GetMeta()),
+		Labels:      []string{},
+		Subjects:    []string{},
+		Resources:   []string{},
+		Actions:     p.GetActions(),
+	}
+	if v, ok := p.(VersionedPolicy); ok {
+		doc.Version = v.GetVersion()
+	}
+
+	for key, value := range PolicyLabels(p) {
+		doc.Labels = append(doc.Labels, key+"="+value)
+	}
+	sort.Strings(doc.Labels)
+
+	for _, s := range p.GetSubjects() {
+		if IsLiteralTemplate(p, s) {
+			doc.Subjects = append(doc.Subjects, s)
+		} else {
+			doc.SubjectPattern = true
+		}
+	}
+
+	for _, r := range p.GetResources() {
+		if IsLiteralTemplate(p, r) {
+			doc.Resources = append(doc.Resources, r)
+		} else {
+			doc.ResourcePattern = true
+		}
+	}
+	return doc, nil
+}
+
+// prepare assigns an ID and the first version to a policy which is about to be created and returns its document.
+func prepare(policy Policy) (*document, error) {
+	if err := AssignID(policy); err != nil {
+		return nil, err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+	return newDocument(policy)
+}
+
+func (m *ElasticsearchManager) docPath(id string) string {
+	return "/" + m.Index + "/_doc/" + url.PathEscape(id)
+}
+
+// Create persists the policy.
+func (m *ElasticsearchManager) Create(policy Policy) error {
+	doc, err := prepare(policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	params := m.writeParams()
+	params.Set("op_type", "create")
+	if status, err := m.do(ctx, http.MethodPut, m.docPath(doc.ID), params, doc, nil); status == http.StatusConflict {
+		return errors.WithStack(ErrPolicyExists)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// get returns the stored document with the given ID, or nil if it does not exist.
+func (m *ElasticsearchManager) get(ctx context.Context, id string) (*hit, error) {
+	var res struct {
+		hit
+		Error *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	status, err := m.do(ctx, http.MethodGet, m.docPath(id), nil, nil, &res, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	} else if res.Error != nil {
+		// A missing index is reported with an error instead of "found": false.
+		return nil, errors.WithStack(&Error{StatusCode: status, Type: res.Error.Type, Reason: res.Error.Reason})
+	} else if !res.Found {
+		return nil, nil
+	}
+	return &res.hit, nil
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one. Concurrent updates
+// are detected by the sequence number of the stored document.
+func (m *ElasticsearchManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	stored, err := m.get(ctx, policy.GetID())
+	if err != nil {
+		return err
+	}
+
+	v, versioned := policy.(VersionedPolicy)
+	var requested int
+	if versioned {
+		requested = v.GetVersion()
+
+		var current int
+		if stored != nil {
+			current = stored.Source.Version
+		}
+
+		if requested != 0 && requested != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	if err := m.update(ctx, policy, stored); err != nil {
+		if versioned {
+			v.SetVersion(requested)
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *ElasticsearchManager) update(ctx context.Context, policy Policy, stored *hit) error {
+	doc, err := newDocument(policy)
+	if err != nil {
+		return err
+	}
+
+	params := m.writeParams()
+	if stored == nil {
+		params.Set("op_type", "create")
+	} else {
+		params.Set("if_seq_no", strconv.FormatInt(stored.SeqNo, 10))
+		params.Set("if_primary_term", strconv.FormatInt(stored.PrimaryTerm, 10))
+	}
+
+	if status, err := m.do(ctx, http.MethodPut, m.docPath(doc.ID), params, doc, nil); status == http.StatusConflict {
+		return errors.WithStack(ErrVersionConflict)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Get retrieves a policy.
+func (m *ElasticsearchManager) Get(id string) (Policy, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	h, err := m.get(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if h == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return decode(&h.Source)
+}
+
+// Delete removes a policy.
+func (m *ElasticsearchManager) Delete(id string) error {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	_, err := m.do(ctx, http.MethodDelete, m.docPath(id), m.writeParams(), nil, nil, http.StatusNotFound)
+	return err
+}
+
+// CreateAll persists all policies with a single bulk request. Elasticsearch applies the actions of a bulk request
+// independently, so if one of them fails, the policies which were created are deleted again.
+func (m *ElasticsearchManager) CreateAll(policies Policies) error {
+	docs := make([]*document, len(policies))
+	for k, p := range policies {
+		doc, err := prepare(p)
+		if err != nil {
+			return errors.Wrapf(err, "Could not create policy %s", p.GetID())
+		}
+		docs[k] = doc
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	items, err := m.bulk(ctx, "create", docs)
+	if err != nil {
+		return err
+	}
+
+	var created []string
+	var failed error
+	for k, item := range items {
+		if item.Error == nil {
+			created = append(created, item.ID)
+		} else if failed == nil {
+			failed = errors.Wrapf(itemError(item, ErrPolicyExists), "Could not create policy %s", docs[k].ID)
+		}
+	}
+
+	if failed != nil {
+		deleted := make([]*document, len(created))
+		for k, id := range created {
+			deleted[k] = &document{ID: id}
+		}
+		// The error of the create is more relevant than a failing rollback.
+		_, _ = m.bulk(ctx, "delete", deleted)
+	}
+	return failed
+}
+
+// DeleteAll removes the policies with the given IDs with a single bulk request. IDs of missing policies are
+// ignored. If one of the deletions fails, the policies which were deleted are stored again.
+func (m *ElasticsearchManager) DeleteAll(ids []string) error {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	var found struct {
+		Docs []hit `json:"docs"`
+	}
+	if _, err := m.do(ctx, http.MethodPost, "/"+m.Index+"/_mget", nil, map[string]interface{}{"ids": ids}, &found); err != nil {
+		return err
+	}
+
+	var docs []*document
+	for k := range found.Docs {
+		if found.Docs[k].Found {
+			docs = append(docs, &found.Docs[k].Source)
+		}
+	}
+
+	items, err := m.bulk(ctx, "delete", docs)
+	if err != nil {
+		return err
+	}
+
+	var deleted []*document
+	var failed error
+	for k, item := range items {
+		if item.Error == nil {
+			deleted = append(deleted, docs[k])
+		} else if failed == nil {
+			failed = errors.Wrapf(itemError(item, nil), "Could not delete policy %s", docs[k].ID)
+		}
+	}
+
+	if failed != nil {
+		// The error of the delete is more relevant than a failing rollback.
+		_, _ = m.bulk(ctx, "index", deleted)
+	}
+	return failed
+}
+
+// bulk runs action, one of "create", "index" and "delete", for all docs in a single bulk request.
+func (m *ElasticsearchManager) bulk(ctx context.Context, action string, docs []*document) ([]bulkItem, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		if err := enc.Encode(map[string]interface{}{action: map[string]string{"_index": m.Index, "_id": doc.ID}}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if action != "delete" {
+			if err := enc.Encode(doc); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+
+	var res struct {
+		Items []map[string]bulkItem `json:"items"`
+	}
+	if _, err := m.do(ctx, http.MethodPost, "/_bulk", m.writeParams(), body.Bytes(), &res); err != nil {
+		return nil, err
+	}
+
+	items := make([]bulkItem, len(res.Items))
+	for k, item := range res.Items {
+		items[k] = item[action]
+		if action == "delete" && items[k].Status == http.StatusNotFound {
+			items[k].Error = nil
+		}
+	}
+	return items, nil
+}
+
+// itemError returns the error of a failed bulk action, which is conflict if the action conflicted and conflict is
+// not nil.
+func itemError(item bulkItem, conflict error) error {
+	if item.Status == http.StatusConflict && conflict != nil {
+		return errors.WithStack(conflict)
+	}
+	return errors.WithStack(&Error{StatusCode: item.Status, Type: item.Error.Type, Reason: item.Error.Reason})
+}
+
+// search runs a query and decodes the policies it returns. Queries matching more than MaxResults policies fail.
+func (m *ElasticsearchManager) search(query map[string]interface{}, sortBy []interface{}, limit, offset int) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	if limit < 0 || limit > m.MaxResults {
+		limit = m.MaxResults
+	}
+
+	body := map[string]interface{}{"query": query, "from": offset, "size": limit, "track_total_hits": true}
+	if sortBy != nil {
+		body["sort"] = sortBy
+	}
+
+	var res struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []hit `json:"hits"`
+		} `json:"hits"`
+	}
+	if _, err := m.do(ctx, http.MethodPost, "/"+m.Index+"/_search", nil, body, &res); err != nil {
+		return nil, err
+	}
+
+	if offset+len(res.Hits.Hits) < res.Hits.Total.Value && offset+limit >= m.MaxResults {
+		return nil, errors.Errorf("More than %d policies match, raise MaxResults and index.max_result_window of index %s", m.MaxResults, m.Index)
+	}
+
+	ps := make(Policies, 0, len(res.Hits.Hits))
+	for k := range res.Hits.Hits {
+		p, err := decode(&res.Hits.Hits[k].Source)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func term(field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: value}}
+}
+
+func filter(clauses ...interface{}) map[string]interface{} {
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": clauses}}
+}
+
+// literalOrPattern matches documents containing value in field or flagged with pattern.
+func literalOrPattern(field, pattern, value string) map[string]interface{} {
+	return map[string]interface{}{"bool": map[string]interface{}{
+		"should":               []interface{}{term(field, value), term(pattern, true)},
+		"minimum_should_match": 1,
+	}}
+}
+
+// GetAll returns all policies, ordered by ID. Pages beyond MaxResults can not be read.
+func (m *ElasticsearchManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.search(map[string]interface{}{"match_all": map[string]interface{}{}}, []interface{}{map[string]string{"id": "asc"}}, int(limit), int(offset))
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *ElasticsearchManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject.
+func (m *ElasticsearchManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.search(filter(term("tenant", r.Tenant), literalOrPattern("subjects", "subject_pattern", r.Subject)), nil, m.MaxResults, 0)
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject pattern.
+func (m *ElasticsearchManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.search(filter(literalOrPattern("subjects", "subject_pattern", subject)), nil, m.MaxResults, 0)
+}
+
+// FindPoliciesForResource returns the policies containing the resource verbatim and all policies with at least
+// one resource pattern.
+func (m *ElasticsearchManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.search(filter(literalOrPattern("resources", "resource_pattern", resource)), nil, m.MaxResults, 0)
+}
+
+// FindPoliciesByLabel returns the policies whose label key is set to value.
+func (m *ElasticsearchManager) FindPoliciesByLabel(key, value string) (Policies, error) {
+	return m.search(filter(term("labels", key+"="+value)), nil, m.MaxResults, 0)
+}
+
+// Search returns the policies whose description or metadata match text and which carry all given labels, ordered
+// by relevance. text uses the simple query string syntax, for example `billing -legacy` or `"data export"`. An
+// empty text matches all policies.
+func (m *ElasticsearchManager) Search(text string, labels map[string]string, limit, offset int64) (Policies, error) {
+	query := map[string]interface{}{"match_all": map[string]interface{}{}}
+	if text != "" {
+		query = map[string]interface{}{"simple_query_string": map[string]interface{}{
+			"query":            text,
+			"fields":           []string{"description", "meta"},
+			"default_operator": "and",
+		}}
+	}
+
+	clauses := []interface{}{}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		clauses = append(clauses, term("labels", key+"="+labels[key]))
+	}
+
+	return m.search(map[string]interface{}{"bool": map[string]interface{}{"must": query, "filter": clauses}}, nil, int(limit), int(offset))
+}
+
+// Ping checks that the index exists, which fails if Elasticsearch is unreachable. It is limited by Timeout.
+func (m *ElasticsearchManager) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.do(ctx, http.MethodHead, "/"+m.Index, nil, nil, nil)
+	return err
+}
+
+// Close does nothing. The Client is not closed, because it is owned by the caller.
+func (m *ElasticsearchManager) Close(ctx context.Context) error {
+	return nil
+}
+
+func decode(doc *document) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal(doc.Policy, &p); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode policy %s", doc.ID)
+	}
+	return &p, nil
+}
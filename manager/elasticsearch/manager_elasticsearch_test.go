@@ -0,0 +1,443 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+type fakeDoc struct {
+	source json.RawMessage
+	seqNo  int64
+}
+
+// fakeClient is an in-memory index which implements the APIs used by ElasticsearchManager. Bulk actions for the
+// IDs in fail are rejected.
+type fakeClient struct {
+	sync.Mutex
+	index    string
+	exists   bool
+	mappings []json.RawMessage
+	docs     map[string]fakeDoc
+	seqNo    int64
+	searches []map[string]interface{}
+	fail     map[string]bool
+}
+
+func newFakeClient(index string) *fakeClient {
+	return &fakeClient{index: index, exists: true, docs: map[string]fakeDoc{}, fail: map[string]bool{}}
+}
+
+func respond(status int, body interface{}) *http.Response {
+	raw, _ := json.Marshal(body)
+	return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(raw))}
+}
+
+func failure(status int, kind, reason string) *http.Response {
+	return respond(status, map[string]interface{}{"error": map[string]string{"type": kind, "reason": reason}, "status": status})
+}
+
+func (c *fakeClient) Perform(r *http.Request) (*http.Response, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if path[0] == "_bulk" {
+		return c.bulk(body), nil
+	} else if path[0] != c.index {
+		return failure(404, "index_not_found_exception", "no such index ["+path[0]+"]"), nil
+	}
+
+	switch {
+	case len(path) == 1 && r.Method == http.MethodPut:
+		if c.exists {
+			return failure(400, "resource_already_exists_exception", "index ["+c.index+"] already exists"), nil
+		}
+		c.exists = true
+		c.mappings = append(c.mappings, body)
+		return respond(200, map[string]bool{"acknowledged": true}), nil
+	case len(path) == 1 && r.Method == http.MethodHead:
+		if !c.exists {
+			return respond(404, nil), nil
+		}
+		return respond(200, nil), nil
+	case !c.exists:
+		return failure(404, "index_not_found_exception", "no such index ["+c.index+"]"), nil
+	case path[1] == "_mapping":
+		c.mappings = append(c.mappings, body)
+		return respond(200, map[string]bool{"acknowledged": true}), nil
+	case path[1] == "_doc":
+		return c.doc(r, path[2], body), nil
+	case path[1] == "_mget":
+		var req struct {
+			IDs []string `json:"ids"`
+		}
+		_ = json.Unmarshal(body, &req)
+		docs := []interface{}{}
+		for _, id := range req.IDs {
+			docs = append(docs, c.hit(id))
+		}
+		return respond(200, map[string]interface{}{"docs": docs}), nil
+	case path[1] == "_search":
+		return c.search(body), nil
+	}
+	return failure(400, "illegal_argument_exception", "unexpected request "+r.Method+" "+r.URL.Path), nil
+}
+
+func (c *fakeClient) hit(id string) map[string]interface{} {
+	doc, ok := c.docs[id]
+	if !ok {
+		return map[string]interface{}{"_id": id, "found": false}
+	}
+	return map[string]interface{}{"_id": id, "found": true, "_seq_no": doc.seqNo, "_primary_term": 1, "_source": doc.source}
+}
+
+func (c *fakeClient) store(id string, source []byte) {
+	c.seqNo++
+	c.docs[id] = fakeDoc{source: source, seqNo: c.seqNo}
+}
+
+func (c *fakeClient) doc(r *http.Request, id string, body []byte) *http.Response {
+	_, exists := c.docs[id]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			return respond(404, c.hit(id))
+		}
+		return respond(200, c.hit(id))
+	case http.MethodDelete:
+		if !exists {
+			return respond(404, map[string]string{"_id": id, "result": "not_found"})
+		}
+		delete(c.docs, id)
+		return respond(200, map[string]string{"_id": id, "result": "deleted"})
+	}
+
+	query := r.URL.Query()
+	if exists && query.Get("op_type") == "create" {
+		return failure(409, "version_conflict_engine_exception", "document already exists")
+	} else if seqNo := query.Get("if_seq_no"); seqNo != "" && (!exists || seqNo != strconv.FormatInt(c.docs[id].seqNo, 10)) {
+		return failure(409, "version_conflict_engine_exception", "required seqNo ["+seqNo+"]")
+	}
+	c.store(id, body)
+	return respond(201, map[string]string{"_id": id, "result": "created"})
+}
+
+func (c *fakeClient) bulk(body []byte) *http.Response {
+	var items []interface{}
+	lines := bufio.NewScanner(bytes.NewReader(body))
+	for lines.Scan() {
+		var action map[string]struct {
+			ID string `json:"_id"`
+		}
+		_ = json.Unmarshal(lines.Bytes(), &action)
+		for kind, meta := range action {
+			var source []byte
+			if kind != "delete" {
+				lines.Scan()
+				source = append([]byte{}, lines.Bytes()...)
+			}
+
+			_, exists := c.docs[meta.ID]
+			item := map[string]interface{}{"_id": meta.ID, "status": 200}
+			switch {
+			case c.fail[meta.ID]:
+				item["status"] = 429
+				item["error"] = map[string]string{"type": "es_rejected_execution_exception", "reason": "rejected execution"}
+			case kind == "create" && exists:
+				item["status"] = 409
+				item["error"] = map[string]string{"type": "version_conflict_engine_exception", "reason": "document already exists"}
+			case kind == "delete" && !exists:
+				item["status"] = 404
+			case kind == "delete":
+				delete(c.docs, meta.ID)
+			default:
+				item["status"] = 201
+				c.store(meta.ID, source)
+			}
+			items = append(items, map[string]interface{}{kind: item})
+		}
+	}
+	return respond(200, map[string]interface{}{"items": items})
+}
+
+func (c *fakeClient) search(body []byte) *http.Response {
+	var req map[string]interface{}
+	_ = json.Unmarshal(body, &req)
+	c.searches = append(c.searches, req)
+
+	var ids []string
+	for id := range c.docs {
+		var doc map[string]interface{}
+		_ = json.Unmarshal(c.docs[id].source, &doc)
+		if matches(req["query"].(map[string]interface{}), doc) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	from, size := int(req["from"].(float64)), int(req["size"].(float64))
+	total := len(ids)
+	if from > len(ids) {
+		from = len(ids)
+	}
+	ids = ids[from:]
+	if size < len(ids) {
+		ids = ids[:size]
+	}
+
+	hits := []interface{}{}
+	for _, id := range ids {
+		hits = append(hits, c.hit(id))
+	}
+	return respond(200, map[string]interface{}{"hits": map[string]interface{}{"total": map[string]int{"value": total}, "hits": hits}})
+}
+
+// matches evaluates the match_all, term, bool and simple_query_string queries. Simple query strings match if all
+// words are contained in one of the fields.
+func matches(query map[string]interface{}, doc map[string]interface{}) bool {
+	for kind, q := range query {
+		q := q.(map[string]interface{})
+		switch kind {
+		case "match_all":
+		case "term":
+			for field, value := range q {
+				if !contains(doc[field], value) {
+					return false
+				}
+			}
+		case "simple_query_string":
+			for _, word := range strings.Fields(strings.ToLower(q["query"].(string))) {
+				found := false
+				for _, field := range q["fields"].([]interface{}) {
+					found = found || strings.Contains(strings.ToLower(fmt.Sprint(doc[field.(string)])), word)
+				}
+				if !found {
+					return false
+				}
+			}
+		case "bool":
+			for _, clause := range clauses(q["must"]) {
+				if !matches(clause, doc) {
+					return false
+				}
+			}
+			for _, clause := range clauses(q["filter"]) {
+				if !matches(clause, doc) {
+					return false
+				}
+			}
+			if should := clauses(q["should"]); len(should) > 0 {
+				found := false
+				for _, clause := range should {
+					found = found || matches(clause, doc)
+				}
+				if !found {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func clauses(v interface{}) []map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		var out []map[string]interface{}
+		for _, c := range v {
+			out = append(out, c.(map[string]interface{}))
+		}
+		return out
+	}
+	return nil
+}
+
+func contains(field interface{}, value interface{}) bool {
+	if values, ok := field.([]interface{}); ok {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	return field == value
+}
+
+func ids(t *testing.T, ps ladon.Policies, err error) []string {
+	require.NoError(t, err)
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.GetID())
+	}
+	sort.Strings(out)
+	return out
+}
+
+var policies = []*ladon.DefaultPolicy{
+	{ID: "1", Description: "Editors may read articles", Subjects: []string{"peter", "max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Labels: map[string]string{"team": "content"}},
+	{ID: "2", Description: "Nobody reads drafts", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess, Meta: []byte(`{"ticket":"SEC-42"}`)},
+	{ID: "3", Description: "Billing exports for acme", Subjects: []string{"ken"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Tenant: "acme", Labels: map[string]string{"team": "billing"}},
+	{ID: "4", Subjects: []string{"team:*"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeGlob, Labels: map[string]string{"team": "content", "env": "prod"}},
+}
+
+func TestElasticsearchManager(t *testing.T) {
+	c := newFakeClient("ladon-policies")
+	m := NewElasticsearchManager(c, "ladon-policies")
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	_, err := m.Get("5")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter", "max"}, got.GetSubjects())
+
+	var doc document
+	require.NoError(t, json.Unmarshal(c.docs["4"].source, &doc))
+	assert.Equal(t, []string{}, doc.Subjects)
+	assert.True(t, doc.SubjectPattern)
+	assert.Equal(t, []string{"env=prod", "team=content"}, doc.Labels)
+	assert.Equal(t, 1, doc.Version)
+
+	ps, err := m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"1", "2", "4"}, ids(t, ps, err))
+	ps, err = m.FindPoliciesForResource("users:1")
+	assert.Equal(t, []string{"2", "3", "4"}, ids(t, ps, err))
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})
+	assert.Equal(t, []string{"3"}, ids(t, ps, err))
+
+	ps, err = ladon.FindPoliciesByLabel(m, "team", "content")
+	assert.Equal(t, []string{"1", "4"}, ids(t, ps, err))
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}))
+	ps, err = m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"2", "4"}, ids(t, ps, err))
+
+	stale := &ladon.DefaultPolicy{ID: "1", Version: 1, Subjects: []string{"peter"}, Effect: ladon.AllowAccess}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(stale)))
+	assert.Equal(t, 1, stale.Version)
+
+	// The document changed since it was read.
+	stored, err := m.get(context.Background(), "1")
+	require.NoError(t, err)
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}))
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.update(context.Background(), &ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess}, stored)))
+
+	require.NoError(t, m.Delete("2"))
+	require.NoError(t, m.Delete("2"))
+	ps, err = m.FindPoliciesForSubject("max")
+	assert.Equal(t, []string{"4"}, ids(t, ps, err))
+
+	all, err := m.GetAll(10, 1)
+	assert.Equal(t, []string{"3", "4"}, ids(t, all, err))
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "asc"}}, c.searches[len(c.searches)-1]["sort"])
+	require.NoError(t, m.Ping(context.Background()))
+
+	m.MaxResults = 1
+	_, err = m.FindPoliciesForResource("users:1")
+	assert.Error(t, err, "incomplete results are not returned")
+}
+
+func TestElasticsearchManagerSearch(t *testing.T) {
+	m := NewElasticsearchManager(newFakeClient("ladon-policies"), "ladon-policies")
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+
+	ps, err := m.Search("articles", nil, 10, 0)
+	assert.Equal(t, []string{"1"}, ids(t, ps, err))
+	ps, err = m.Search("sec-42", nil, 10, 0)
+	assert.Equal(t, []string{"2"}, ids(t, ps, err), "metadata is searched as well")
+	ps, err = m.Search("", map[string]string{"team": "content", "env": "prod"}, 10, 0)
+	assert.Equal(t, []string{"4"}, ids(t, ps, err))
+	ps, err = m.Search("billing", map[string]string{"team": "content"}, 10, 0)
+	assert.Equal(t, []string(nil), ids(t, ps, err))
+}
+
+func TestElasticsearchManagerBulk(t *testing.T) {
+	c := newFakeClient("ladon-policies")
+	m := NewElasticsearchManager(c, "ladon-policies")
+	require.NoError(t, ladon.CreateAll(m, ladon.Policies{policies[0], policies[1]}))
+	assert.Len(t, c.docs, 2)
+
+	// The conflicting policy fails the bulk request, the others are deleted again.
+	err := ladon.CreateAll(m, ladon.Policies{policies[2], policies[0], policies[3]})
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(err))
+	assert.Len(t, c.docs, 2)
+
+	require.NoError(t, ladon.CreateAll(m, ladon.Policies{policies[2], policies[3]}))
+	c.fail["3"] = true
+	assert.Error(t, ladon.DeleteAll(m, []string{"1", "3", "5"}))
+	assert.Len(t, c.docs, 4, "deleted policies are restored")
+
+	delete(c.fail, "3")
+	require.NoError(t, ladon.DeleteAll(m, []string{"1", "3", "5"}))
+	all, err := m.GetAll(10, 0)
+	assert.Equal(t, []string{"2", "4"}, ids(t, all, err))
+}
+
+func TestEnsureIndex(t *testing.T) {
+	c := newFakeClient("ladon-policies")
+	c.exists = false
+	m := NewElasticsearchManager(c, "ladon-policies")
+
+	_, err := m.Get("1")
+	assert.Equal(t, "index_not_found_exception", errors.Cause(err).(*Error).Type)
+	assert.Error(t, m.Ping(context.Background()))
+
+	require.NoError(t, m.EnsureIndex(context.Background()))
+	require.NoError(t, m.EnsureIndex(context.Background()))
+	require.Len(t, c.mappings, 2)
+	assert.JSONEq(t, string(Mapping), string(c.mappings[0]))
+	assert.Contains(t, string(c.mappings[1]), `"dynamic":"strict"`, "the mapping of an existing index is updated")
+	require.NoError(t, m.Ping(context.Background()))
+}
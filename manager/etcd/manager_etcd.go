@@ -0,0 +1,660 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// EventType is the type of a change observed by a watch.
+type EventType int
+
+const (
+	// EventPut is emitted when a key was created or updated.
+	EventPut EventType = iota
+
+	// EventDelete is emitted when a key was removed.
+	EventDelete
+)
+
+// KeyValue is a single key/value pair stored in etcd. ModRevision is the store revision of its last change.
+type KeyValue struct {
+	Key         string
+	Value       []byte
+	ModRevision int64
+}
+
+// Event is a single change observed by a watch. ModRevision is the store revision of the change.
+type Event struct {
+	Type        EventType
+	Key         string
+	Value       []byte
+	ModRevision int64
+}
+
+// WatchResponse is a batch of events delivered by a watch. If Err is set, the watch was
+// interrupted and the channel will be closed.
+type WatchResponse struct {
+	Events []Event
+	Err    error
+}
+
+// Client is the contract EtcdManager requires from etcd. It is implemented on top of the KV and Watcher of a
+// *clientv3.Client: List is a prefix range, and CAS is a transaction comparing the ModRevision of key.
+type Client interface {
+	// Get returns the value stored at key, or nil if the key does not exist.
+	Get(ctx context.Context, key string) (*KeyValue, error)
+
+	// List returns all key/value pairs with the given prefix and the store revision they were read at.
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+
+	// CAS stores value at key if the ModRevision of the stored key equals modRevision, in a single etcd
+	// transaction. A modRevision of zero stores value only if the key does not exist yet. It returns the store
+	// revision of the write, or false if the revision did not match.
+	CAS(ctx context.Context, key string, value []byte, modRevision int64) (int64, bool, error)
+
+	// Delete removes key. It returns the store revision of the deletion.
+	Delete(ctx context.Context, key string) (int64, error)
+
+	// Watch streams changes of keys with the given prefix that happened after revision. The channel is closed
+	// when ctx is canceled.
+	Watch(ctx context.Context, prefix string, revision int64) <-chan WatchResponse
+}
+
+// EtcdManager is a Manager storing policies in etcd. Reads are served from a local cache which is
+// kept consistent with etcd by watch events once Watch has been called.
+type EtcdManager struct {
+	Client  Client
+	Prefix  string
+	Timeout time.Duration
+
+	// revisions holds the store revision of the last change applied to the cache per ID, including deletions,
+	// so that writes and watch events arriving out of order never replace newer policies.
+	cache     map[string]Policy
+	revisions map[string]int64
+	synced    bool
+	sync.RWMutex
+
+	// closing stops all watches once Close was called, aborting cancels in-flight queries once Close stopped
+	// waiting for them. running counts watches and queries.
+	closed   bool
+	closing  chan struct{}
+	aborting chan struct{}
+	running  sync.WaitGroup
+}
+
+// NewEtcdManager initializes a new EtcdManager storing policies below prefix.
+func NewEtcdManager(client Client, prefix string) *EtcdManager {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &EtcdManager{
+		Client:    client,
+		Prefix:    prefix,
+		Timeout:   time.Second * 5,
+		cache:     map[string]Policy{},
+		revisions: map[string]int64{},
+	}
+}
+
+// context returns the context of a single query, which is canceled after Timeout or when Close gives up waiting.
+func (m *EtcdManager) context() (context.Context, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	ctx, done, err := m.begin(ctx, false)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return ctx, func() { done(); cancel() }, nil
+}
+
+// begin registers a query or watch Close waits for. The returned context is canceled when parent is, when Close
+// is called (for watches) or when Close gives up waiting (for queries).
+func (m *EtcdManager) begin(parent context.Context, watch bool) (context.Context, func(), error) {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil, nil, errors.WithStack(ErrManagerClosed)
+	}
+
+	m.lifecycle()
+	m.running.Add(1)
+	stop := m.aborting
+	if watch {
+		stop = m.closing
+	}
+	m.Unlock()
+
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		m.running.Done()
+	}, nil
+}
+
+// lifecycle initializes the channels used by Close. The lock must be held.
+func (m *EtcdManager) lifecycle() {
+	if m.closing == nil {
+		m.closing = make(chan struct{})
+		m.aborting = make(chan struct{})
+	}
+}
+
+// Ping reads the prefix from etcd, which fails if etcd is unreachable. It is limited by Timeout.
+func (m *EtcdManager) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	ctx, done, err := m.begin(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if _, err := m.Client.Get(ctx, m.Prefix); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close stops all watches and waits for in-flight queries to finish. If ctx is done first, the queries are
+// canceled and ctx.Err() is returned. Afterwards, all calls hitting etcd fail with ErrManagerClosed. The Client
+// is not closed.
+func (m *EtcdManager) Close(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	m.lifecycle()
+	close(m.closing)
+	m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		close(m.aborting)
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+func (m *EtcdManager) key(id string) string {
+	return m.Prefix + id
+}
+
+// Watch loads all policies into the local cache and keeps it up to date by watching the prefix until
+// ctx is canceled, the watch fails or the manager is closed. While the watch is running, reads never hit etcd.
+func (m *EtcdManager) Watch(ctx context.Context) error {
+	ctx, done, err := m.begin(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	kvs, rev, err := m.Client.List(ctx, m.Prefix)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cache := make(map[string]Policy, len(kvs))
+	revisions := make(map[string]int64, len(kvs))
+	for _, kv := range kvs {
+		p, err := decode(kv.Value)
+		if err != nil {
+			return err
+		}
+		id := strings.TrimPrefix(kv.Key, m.Prefix)
+		cache[id], revisions[id] = p, kv.ModRevision
+	}
+
+	m.Lock()
+	m.cache, m.revisions = cache, revisions
+	m.synced = true
+	m.Unlock()
+
+	defer m.invalidate()
+	for res := range m.Client.Watch(ctx, m.Prefix, rev) {
+		if res.Err != nil {
+			return errors.WithStack(res.Err)
+		}
+
+		if err := m.apply(res.Events); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(ctx.Err())
+}
+
+// WatchPolicies reports every change of the policies below the prefix made after it returned, including changes
+// by other processes. Deleted policies are not retrieved, so the events of deletions carry no policy. The channel
+// is closed when ctx is canceled, the watch fails or the manager is closed.
+func (m *EtcdManager) WatchPolicies(ctx context.Context) (<-chan *PolicyEvent, error) {
+	ctx, done, err := m.begin(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs, rev, err := m.Client.List(ctx, m.Prefix)
+	if err != nil {
+		done()
+		return nil, errors.WithStack(err)
+	}
+
+	known := make(map[string]bool, len(kvs))
+	for _, kv := range kvs {
+		known[strings.TrimPrefix(kv.Key, m.Prefix)] = true
+	}
+
+	// The watch is started before returning, so changes made right after the call are never missed.
+	changes := m.Client.Watch(ctx, m.Prefix, rev)
+	events := make(chan *PolicyEvent)
+	go func() {
+		defer done()
+		defer close(events)
+
+		for res := range changes {
+			if res.Err != nil {
+				return
+			}
+
+			for _, e := range res.Events {
+				event := &PolicyEvent{ID: strings.TrimPrefix(e.Key, m.Prefix), Time: time.Now().UTC()}
+				switch e.Type {
+				case EventPut:
+					p, err := decode(e.Value)
+					if err != nil {
+						return
+					}
+
+					event.Type, event.Policy = PolicyCreated, p
+					if known[event.ID] {
+						event.Type = PolicyUpdated
+					}
+					known[event.ID] = true
+				case EventDelete:
+					event.Type = PolicyDeleted
+					delete(known, event.ID)
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func (m *EtcdManager) apply(events []Event) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, e := range events {
+		id := strings.TrimPrefix(e.Key, m.Prefix)
+		switch e.Type {
+		case EventPut:
+			p, err := decode(e.Value)
+			if err != nil {
+				m.synced = false
+				return err
+			}
+			m.change(id, p, e.ModRevision)
+		case EventDelete:
+			m.change(id, nil, e.ModRevision)
+		}
+	}
+	return nil
+}
+
+// store makes a successful write visible to subsequent reads without waiting for the watch event. policy is nil
+// for deletions.
+func (m *EtcdManager) store(id string, policy Policy, revision int64) {
+	m.Lock()
+	defer m.Unlock()
+	if m.synced {
+		m.change(id, policy, revision)
+	}
+}
+
+// change applies a change of revision to the cache, unless a newer change was applied already. The lock must be
+// held.
+func (m *EtcdManager) change(id string, policy Policy, revision int64) {
+	if revision <= m.revisions[id] {
+		return
+	}
+
+	m.revisions[id] = revision
+	if policy == nil {
+		delete(m.cache, id)
+	} else {
+		m.cache[id] = policy
+	}
+}
+
+func (m *EtcdManager) invalidate() {
+	m.Lock()
+	defer m.Unlock()
+	m.synced = false
+	m.cache = map[string]Policy{}
+	m.revisions = map[string]int64{}
+}
+
+// Create persists the policy.
+func (m *EtcdManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	revision, created, err := m.Client.CAS(ctx, m.key(policy.GetID()), payload, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	} else if !created {
+		return errors.WithStack(ErrPolicyExists)
+	}
+
+	m.store(policy.GetID(), policy, revision)
+	return nil
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one. The policy is
+// written on the mod revision it was read at, so concurrent updates fail with ErrVersionConflict instead of
+// overwriting each other.
+func (m *EtcdManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// The cache may lag behind, so the stored version is always read from etcd.
+	kv, err := m.Client.Get(ctx, m.key(policy.GetID()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var current int
+	var modRevision int64
+	if kv != nil {
+		stored, err := decode(kv.Value)
+		if err != nil {
+			return err
+		}
+		current, modRevision = stored.(VersionedPolicy).GetVersion(), kv.ModRevision
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok {
+		if v.GetVersion() != 0 && v.GetVersion() != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	revision, swapped, err := m.Client.CAS(ctx, m.key(policy.GetID()), payload, modRevision)
+	if err != nil {
+		return errors.WithStack(err)
+	} else if !swapped {
+		return errors.WithStack(ErrVersionConflict)
+	}
+
+	m.store(policy.GetID(), policy, revision)
+	return nil
+}
+
+// Get retrieves a policy.
+func (m *EtcdManager) Get(id string) (Policy, error) {
+	m.RLock()
+	p, ok := m.cache[id]
+	synced := m.synced
+	m.RUnlock()
+
+	if ok {
+		return p, nil
+	} else if synced {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	kv, err := m.Client.Get(ctx, m.key(id))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if kv == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	return decode(kv.Value)
+}
+
+// Delete removes a policy.
+func (m *EtcdManager) Delete(id string) error {
+	ctx, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	revision, err := m.Client.Delete(ctx, m.key(id))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.store(id, nil, revision)
+	return nil
+}
+
+// GetAll returns all policies.
+func (m *EtcdManager) GetAll(limit, offset int64) (Policies, error) {
+	ps, err := m.findAllPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].GetID() < ps[j].GetID()
+	})
+
+	start, end := pagination.Index(int(limit), int(offset), len(ps))
+	return ps[start:end], nil
+}
+
+// ForEach calls fn for every policy, ordered by ID. Once the cache is synced, it iterates over a snapshot of the
+// cache. Otherwise all policies are read from etcd with a single query and decoded one at a time.
+func (m *EtcdManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	m.RLock()
+	if m.synced {
+		ps := make(Policies, 0, len(m.cache))
+		for _, p := range m.cache {
+			ps = append(ps, p)
+		}
+		m.RUnlock()
+
+		sort.Slice(ps, func(i, j int) bool {
+			return ps[i].GetID() < ps[j].GetID()
+		})
+		for _, p := range ps {
+			if err := ctx.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	m.RUnlock()
+
+	query, done, err := m.context()
+	if err != nil {
+		return err
+	}
+	kvs, _, err := m.Client.List(query, m.Prefix)
+	done()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+	for _, kv := range kvs {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		p, err := decode(kv.Value)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *EtcdManager) findAllPolicies() (Policies, error) {
+	m.RLock()
+	if m.synced {
+		ps := make(Policies, 0, len(m.cache))
+		for _, p := range m.cache {
+			ps = append(ps, p)
+		}
+		m.RUnlock()
+		return ps, nil
+	}
+	m.RUnlock()
+
+	ctx, done, err := m.context()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	kvs, _, err := m.Client.List(ctx, m.Prefix)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ps := make(Policies, len(kvs))
+	for i, kv := range kvs {
+		if ps[i], err = decode(kv.Value); err != nil {
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *EtcdManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ps, err := m.findAllPolicies()
+	if err != nil {
+		return nil, err
+	}
+	return FilterTenant(ps, r.Tenant), nil
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *EtcdManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.findAllPolicies()
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *EtcdManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.findAllPolicies()
+}
+
+func decode(payload []byte) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,433 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+type fakeClient struct {
+	sync.Mutex
+	data     map[string]KeyValue
+	rev      int64
+	watchers []chan WatchResponse
+	reads    int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{data: map[string]KeyValue{}}
+}
+
+func (c *fakeClient) Get(_ context.Context, key string) (*KeyValue, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.reads++
+	kv, ok := c.data[key]
+	if !ok {
+		return nil, nil
+	}
+	return &kv, nil
+}
+
+func (c *fakeClient) List(_ context.Context, prefix string) ([]KeyValue, int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.reads++
+	var kvs []KeyValue
+	for k, kv := range c.data {
+		if strings.HasPrefix(k, prefix) {
+			kvs = append(kvs, kv)
+		}
+	}
+	return kvs, c.rev, nil
+}
+
+func (c *fakeClient) CAS(_ context.Context, key string, value []byte, modRevision int64) (int64, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.data[key].ModRevision != modRevision {
+		return 0, false, nil
+	}
+	return c.put(key, value), true, nil
+}
+
+func (c *fakeClient) Delete(_ context.Context, key string) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.data, key)
+	c.notify(Event{Type: EventDelete, Key: key})
+	return c.rev, nil
+}
+
+func (c *fakeClient) put(key string, value []byte) int64 {
+	c.notify(Event{Type: EventPut, Key: key, Value: value})
+	c.data[key] = KeyValue{Key: key, Value: value, ModRevision: c.rev}
+	return c.rev
+}
+
+func (c *fakeClient) Watch(ctx context.Context, _ string, _ int64) <-chan WatchResponse {
+	c.Lock()
+	defer c.Unlock()
+	ch := make(chan WatchResponse, 16)
+	c.watchers = append(c.watchers, ch)
+	go func() {
+		<-ctx.Done()
+		c.Lock()
+		defer c.Unlock()
+		close(ch)
+		c.watchers = nil
+	}()
+	return ch
+}
+
+func (c *fakeClient) notify(e Event) {
+	c.rev++
+	e.ModRevision = c.rev
+	for _, w := range c.watchers {
+		w <- WatchResponse{Events: []Event{e}}
+	}
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	for i := 0; i < 1000; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition was not met in time")
+}
+
+func TestEtcdManager(t *testing.T) {
+	m := NewEtcdManager(newFakeClient(), "/ladon/policies")
+	assert.Equal(t, "/ladon/policies/", m.Prefix)
+
+	p := &ladon.DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"get"},
+		Effect:    ladon.AllowAccess,
+		Conditions: ladon.Conditions{
+			"owner": &ladon.EqualsSubjectCondition{},
+		},
+	}
+
+	require.NoError(t, m.Create(p))
+	require.Error(t, m.Create(p))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, p, got)
+
+	p.Description = "updated"
+	require.NoError(t, m.Update(p))
+	got, err = m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", got.GetDescription())
+
+	ps, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	assert.Len(t, ps, 1)
+
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "peter"})
+	require.NoError(t, err)
+	assert.Len(t, ps, 1)
+
+	require.NoError(t, m.Delete("1"))
+	_, err = m.Get("1")
+	assert.Error(t, err)
+}
+
+// racingClient writes key whenever it is read, like another process updating the policy right after Update read it.
+type racingClient struct {
+	*fakeClient
+	key string
+}
+
+func (c *racingClient) Get(ctx context.Context, key string) (*KeyValue, error) {
+	kv, err := c.fakeClient.Get(ctx, key)
+	if key == c.key && kv != nil {
+		c.Lock()
+		c.put(key, kv.Value)
+		c.Unlock()
+	}
+	return kv, err
+}
+
+func TestEtcdManagerVersions(t *testing.T) {
+	c := newFakeClient()
+	m := NewEtcdManager(c, "/ladon/")
+	p := &ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}
+	require.NoError(t, m.Create(p))
+	assert.Equal(t, 1, p.Version)
+
+	stale := *p
+	require.NoError(t, m.Update(p))
+	assert.Equal(t, 2, p.Version)
+
+	stale.Subjects = []string{"max"}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(&stale)))
+
+	// Writes in between reading and writing the policy are detected as well.
+	m.Client = &racingClient{fakeClient: c, key: "/ladon/1"}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(p)))
+
+	got, err := NewEtcdManager(c, "/ladon/").Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter"}, got.GetSubjects())
+}
+
+func TestEtcdManagerForEach(t *testing.T) {
+	c := newFakeClient()
+	m := NewEtcdManager(c, "/ladon/")
+	for _, id := range []string{"3", "1", "2"} {
+		require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: id, Effect: ladon.AllowAccess}))
+	}
+
+	var ids []string
+	reads := c.reads
+	require.NoError(t, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		ids = append(ids, p.GetID())
+		return nil
+	}))
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+	assert.Equal(t, reads+1, c.reads, "all policies are read with a single query")
+
+	stop := errors.New("stop")
+	assert.Equal(t, stop, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		return stop
+	}))
+}
+
+func TestEtcdManagerGeneratesIDs(t *testing.T) {
+	defer func(g ladon.IDGenerator) { ladon.PolicyIDGenerator = g }(ladon.PolicyIDGenerator)
+	ladon.PolicyIDGenerator = ladon.NewULID
+
+	client := newFakeClient()
+	m := NewEtcdManager(client, "/ladon/policies")
+
+	p := &ladon.DefaultPolicy{Effect: ladon.AllowAccess}
+	require.NoError(t, m.Create(p))
+	require.NotEmpty(t, p.ID)
+
+	_, ok := client.data["/ladon/policies/"+p.ID]
+	assert.True(t, ok)
+}
+
+func TestEtcdManagerWatch(t *testing.T) {
+	c := newFakeClient()
+	m := NewEtcdManager(c, "/ladon/")
+	other := NewEtcdManager(c, "/ladon/")
+
+	require.NoError(t, other.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.Watch(ctx) }()
+
+	eventually(t, func() bool {
+		m.RLock()
+		defer m.RUnlock()
+		return m.synced
+	})
+
+	c.Lock()
+	reads := c.reads
+	c.Unlock()
+
+	_, err := m.Get("1")
+	require.NoError(t, err)
+
+	require.NoError(t, other.Create(&ladon.DefaultPolicy{ID: "2", Effect: ladon.DenyAccess}))
+	eventually(t, func() bool {
+		ps, err := m.GetAll(10, 0)
+		return err == nil && len(ps) == 2
+	})
+
+	require.NoError(t, other.Delete("1"))
+	eventually(t, func() bool {
+		_, err := m.Get("1")
+		return err != nil
+	})
+
+	c.Lock()
+	assert.Equal(t, reads, c.reads, "reads must be served from the cache while watching")
+	c.Unlock()
+
+	cancel()
+	assert.Error(t, <-done)
+
+	m.RLock()
+	assert.False(t, m.synced)
+	m.RUnlock()
+}
+
+func TestEtcdManagerOutOfOrderChanges(t *testing.T) {
+	c := newFakeClient()
+	m := NewEtcdManager(c, "/ladon/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx)
+	eventually(t, func() bool {
+		m.RLock()
+		defer m.RUnlock()
+		return m.synced
+	})
+
+	// Another process updated the policy at revision 10, the local write of revision 9 returns afterwards.
+	require.NoError(t, m.apply([]Event{{Type: EventPut, Key: "/ladon/1", Value: []byte(`{"id": "1", "description": "newer"}`), ModRevision: 10}}))
+	m.store("1", &ladon.DefaultPolicy{ID: "1", Description: "older"}, 9)
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, "newer", got.GetDescription())
+
+	// A late deletion does not remove the recreated policy, and a late write does not resurrect a deleted one.
+	m.store("1", nil, 8)
+	_, err = m.Get("1")
+	require.NoError(t, err)
+
+	require.NoError(t, m.apply([]Event{{Type: EventDelete, Key: "/ladon/1", ModRevision: 12}}))
+	m.store("1", &ladon.DefaultPolicy{ID: "1"}, 11)
+	_, err = m.Get("1")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+}
+
+func TestEtcdManagerWatchPolicies(t *testing.T) {
+	c := newFakeClient()
+	m := NewEtcdManager(c, "/ladon/")
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess}))
+
+	events, err := m.WatchPolicies(context.Background())
+	require.NoError(t, err)
+
+	// Policies existing before the watch started are not reported.
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{ID: "2", Effect: ladon.DenyAccess}))
+	e := <-events
+	assert.Equal(t, ladon.PolicyCreated, e.Type)
+	assert.Equal(t, "2", e.ID)
+	assert.Equal(t, ladon.DenyAccess, e.Policy.GetEffect())
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: ladon.AllowAccess}))
+	e = <-events
+	assert.Equal(t, ladon.PolicyUpdated, e.Type)
+	assert.Equal(t, []string{"peter"}, e.Policy.GetSubjects())
+
+	require.NoError(t, m.Delete("2"))
+	e = <-events
+	assert.Equal(t, ladon.PolicyDeleted, e.Type)
+	assert.Equal(t, "2", e.ID)
+	assert.Nil(t, e.Policy)
+
+	// Closing the manager ends the watch.
+	require.NoError(t, m.Close(context.Background()))
+	for range events {
+	}
+}
+
+// blockingClient blocks Get until release is closed or the context is canceled.
+type blockingClient struct {
+	*fakeClient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) Get(ctx context.Context, key string) (*KeyValue, error) {
+	close(c.started)
+	select {
+	case <-c.release:
+		return c.fakeClient.Get(ctx, key)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestEtcdManagerClose(t *testing.T) {
+	m := NewEtcdManager(newFakeClient(), "/ladon/")
+
+	done := make(chan error)
+	go func() { done <- m.Watch(context.Background()) }()
+	eventually(t, func() bool {
+		m.RLock()
+		defer m.RUnlock()
+		return m.synced
+	})
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.Error(t, <-done)
+	assert.NoError(t, m.Close(context.Background()))
+
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Watch(context.Background())))
+}
+
+func TestEtcdManagerCloseDrainsQueries(t *testing.T) {
+	for _, drain := range []bool{true, false} {
+		c := &blockingClient{fakeClient: newFakeClient(), started: make(chan struct{}), release: make(chan struct{})}
+		m := NewEtcdManager(c, "/ladon/")
+
+		got := make(chan error)
+		go func() {
+			_, err := m.Get("1")
+			got <- err
+		}()
+		<-c.started
+
+		if drain {
+			// The query finishes before the deadline, so Close succeeds.
+			time.AfterFunc(time.Millisecond*10, func() { close(c.release) })
+			require.NoError(t, m.Close(context.Background()))
+			assert.Equal(t, ladon.ErrNotFound, errors.Cause(<-got))
+			continue
+		}
+
+		// The query outlives the deadline and is canceled.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		assert.Equal(t, context.DeadlineExceeded, errors.Cause(m.Close(ctx)))
+		assert.Equal(t, context.Canceled, errors.Cause(<-got))
+		cancel()
+	}
+}
+
+func TestEtcdManagerPing(t *testing.T) {
+	m := NewEtcdManager(newFakeClient(), "/ladon/")
+	require.NoError(t, m.Ping(context.Background()))
+
+	c := &blockingClient{fakeClient: newFakeClient(), started: make(chan struct{}), release: make(chan struct{})}
+	m = NewEtcdManager(c, "/ladon/")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(m.Ping(ctx)), "unreachable stores are unhealthy")
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Ping(context.Background())))
+}
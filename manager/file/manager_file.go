@@ -0,0 +1,443 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package file provides a read-only Manager loading policies from a directory of files, so policies can be kept
+// in a version control repository instead of a database.
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// Formats maps file extensions to functions converting the content of such a file to JSON. Files with extensions
+// which are neither listed here nor in YAMLExtensions are ignored.
+var Formats = map[string]func([]byte) ([]byte, error){
+	".json": func(in []byte) ([]byte, error) {
+		return in, nil
+	},
+}
+
+// YAMLExtensions lists the extensions of files decoded as YAML, unless a converter is registered in Formats. A YAML
+// file contains one or more documents separated by "---", each either a single policy or a list of policies.
+var YAMLExtensions = []string{".yaml", ".yml"}
+
+// Notifier reports changes below a directory. It is satisfied by a small adapter around fsnotify; without one,
+// FileManager polls the directory.
+type Notifier interface {
+	// Notify sends on the returned channel whenever files below dir changed, until ctx is canceled. The channel
+	// is closed when the notifications end.
+	Notify(ctx context.Context, dir string) (<-chan struct{}, error)
+}
+
+// FileManager is a read-only Manager serving the policies stored in the files below Dir. Each JSON file contains
+// either a single policy or an array of policies, YAML files may contain several documents. Use Watch to reload the policies when the files change.
+type FileManager struct {
+	Dir string
+
+	// Notifier reports changes to Watch. It defaults to a PollingNotifier checking the directory every second.
+	Notifier Notifier
+
+	// OnReload is called by Watch after every reload. If the files can not be loaded, err is set and the
+	// previous policies are kept.
+	OnReload func(err error)
+
+	policies map[string]Policy
+	sync.RWMutex
+
+	closed  bool
+	closing chan struct{}
+	running sync.WaitGroup
+}
+
+// NewFileManager returns a FileManager serving the policies below dir. It fails if the files can not be loaded.
+func NewFileManager(dir string) (*FileManager, error) {
+	m := &FileManager{Dir: dir}
+	if err := m.Load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Load reads all policies below Dir and replaces the served policies with them. If a file can not be read or
+// decoded, or a policy ID is used more than once, the served policies are left untouched.
+func (m *FileManager) Load() error {
+	policies := map[string]Policy{}
+	files := map[string]string{}
+	err := filepath.Walk(m.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if !IsPolicyFile(path) {
+			return nil
+		}
+
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		ps, err := Decode(path, raw)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range ps {
+			if err := ValidatePolicy(p); err != nil {
+				return errors.Wrapf(err, "Could not load %s", path)
+			} else if other, ok := files[p.GetID()]; ok {
+				return errors.Errorf("Policy %s is defined in %s and %s", p.GetID(), other, path)
+			}
+
+			files[p.GetID()] = path
+			policies[p.GetID()] = p
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	m.policies = policies
+	m.Unlock()
+	return nil
+}
+
+// IsPolicyFile returns true if the extension of name is listed in Formats or YAMLExtensions.
+func IsPolicyFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	_, ok := Formats[ext]
+	return ok || isYAML(ext)
+}
+
+// Decode decodes the policies of a file with the given name and content, choosing the format by the extension of
+// name. Files of other formats contain no policies.
+func Decode(name string, content []byte) (Policies, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if convert, ok := Formats[ext]; ok {
+		return decodeJSON(name, content, convert)
+	} else if isYAML(ext) {
+		return decodeYAML(name, content)
+	}
+	return nil, nil
+}
+
+func decodeJSON(path string, raw []byte, convert func([]byte) ([]byte, error)) (Policies, error) {
+	payload, err := convert(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not convert %s", path)
+	}
+
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 {
+		return nil, nil
+	}
+
+	if payload[0] != '[' {
+		var p DefaultPolicy
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, errors.Wrapf(err, "Could not decode %s", path)
+		}
+		return Policies{&p}, nil
+	}
+
+	var ps []*DefaultPolicy
+	if err := json.Unmarshal(payload, &ps); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode %s", path)
+	}
+
+	out := make(Policies, len(ps))
+	for k, p := range ps {
+		out[k] = p
+	}
+	return out, nil
+}
+
+func isYAML(ext string) bool {
+	for _, e := range YAMLExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeYAML(path string, raw []byte) (Policies, error) {
+	var out Policies
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Could not decode %s", path)
+		} else if len(doc.Content) == 0 {
+			continue
+		}
+
+		if doc.Content[0].Kind != yaml.SequenceNode {
+			var p DefaultPolicy
+			if err := doc.Decode(&p); err != nil {
+				return nil, errors.Wrapf(err, "Could not decode %s", path)
+			}
+			out = append(out, &p)
+			continue
+		}
+
+		var ps []*DefaultPolicy
+		if err := doc.Decode(&ps); err != nil {
+			return nil, errors.Wrapf(err, "Could not decode %s", path)
+		}
+		for _, p := range ps {
+			out = append(out, p)
+		}
+	}
+}
+
+// Watch reloads the policies whenever the Notifier reports a change, until ctx is canceled, the notifications
+// end or the manager is closed.
+func (m *FileManager) Watch(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return errors.WithStack(ErrManagerClosed)
+	}
+	m.lifecycle()
+	m.running.Add(1)
+	closing := m.closing
+	m.Unlock()
+	defer m.running.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	notifier := m.Notifier
+	if notifier == nil {
+		notifier = &PollingNotifier{Interval: time.Second}
+	}
+
+	changes, err := notifier.Notify(ctx, m.Dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case _, ok := <-changes:
+			if !ok {
+				return errors.WithStack(ctx.Err())
+			}
+		}
+
+		// Editors and checkouts touch many files at once, so pending notifications are merged into one reload.
+		for pending := true; pending; {
+			select {
+			case _, pending = <-changes:
+			default:
+				pending = false
+			}
+		}
+
+		err := m.Load()
+		if m.OnReload != nil {
+			m.OnReload(err)
+		}
+	}
+}
+
+// lifecycle initializes the channel used by Close. The lock must be held.
+func (m *FileManager) lifecycle() {
+	if m.closing == nil {
+		m.closing = make(chan struct{})
+	}
+}
+
+// Ping checks that Dir is still accessible. It returns ErrManagerClosed once Close was called.
+func (m *FileManager) Ping(ctx context.Context) error {
+	m.RLock()
+	closed := m.closed
+	m.RUnlock()
+
+	if closed {
+		return errors.WithStack(ErrManagerClosed)
+	}
+
+	if _, err := os.Stat(m.Dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close stops all watches and waits for them to return, or until ctx is done.
+func (m *FileManager) Close(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	m.lifecycle()
+	close(m.closing)
+	m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Create is not supported and returns ErrReadOnly.
+func (m *FileManager) Create(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Update is not supported and returns ErrReadOnly.
+func (m *FileManager) Update(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Delete is not supported and returns ErrReadOnly.
+func (m *FileManager) Delete(id string) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Get retrieves a policy.
+func (m *FileManager) Get(id string) (Policy, error) {
+	m.RLock()
+	defer m.RUnlock()
+	p, ok := m.policies[id]
+	if !ok {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return p, nil
+}
+
+// Count returns the number of served policies.
+func (m *FileManager) Count() (int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return int64(len(m.policies)), nil
+}
+
+// Exists returns true if a policy with the given ID is served.
+func (m *FileManager) Exists(id string) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	_, ok := m.policies[id]
+	return ok, nil
+}
+
+// GetAll retrieves all policies.
+func (m *FileManager) GetAll(limit, offset int64) (Policies, error) {
+	ps := m.sortedPolicies()
+	start, end := pagination.Index(int(limit), int(offset), len(ps))
+	return ps[start:end], nil
+}
+
+// ForEach calls fn for every served policy, ordered by ID. Policies loaded after ForEach started are not visited.
+func (m *FileManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	for _, p := range m.sortedPolicies() {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *FileManager) sortedPolicies() Policies {
+	ps := m.findAllPolicies()
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].GetID() < ps[j].GetID()
+	})
+	return ps
+}
+
+func (m *FileManager) findAllPolicies() Policies {
+	m.RLock()
+	defer m.RUnlock()
+	ps := make(Policies, 0, len(m.policies))
+	for _, p := range m.policies {
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// FindRequestCandidates returns candidates that could match the request object. It either returns
+// a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
+// the error.
+func (m *FileManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return FilterTenant(m.findAllPolicies(), r.Tenant), nil
+}
+
+// FindPoliciesForSubject returns policies that could match the subject. It either returns
+// a set of policies that applies to the subject, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *FileManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.findAllPolicies(), nil
+}
+
+// FindPoliciesForResource returns policies that could match the resource. It either returns
+// a set of policies that apply to the resource, or a superset of it.
+// If an error occurs, it returns nil and the error.
+func (m *FileManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.findAllPolicies(), nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+type channelNotifier chan struct{}
+
+func (n channelNotifier) Notify(ctx context.Context, _ string) (<-chan struct{}, error) {
+	return n, nil
+}
+
+func write(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func ids(t *testing.T, m ladon.Manager) []string {
+	ps, err := m.GetAll(100, 0)
+	require.NoError(t, err)
+
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.GetID())
+	}
+	return out
+}
+
+func TestFileManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write(t, dir, "1.json", `{"id": "1", "subjects": ["peter"], "effect": "allow", "resources": ["articles:<[0-9]+>"], "actions": ["get"], "conditions": {"owner": {"type": "EqualsSubjectCondition"}}}`)
+	write(t, dir, "team/all.json", `[{"id": "2", "effect": "deny"}, {"id": "3", "effect": "allow"}]`)
+	write(t, dir, "README.md", `not a policy`)
+
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, ids(t, m))
+
+	var streamed []string
+	require.NoError(t, m.ForEach(context.Background(), func(p ladon.Policy) error {
+		streamed = append(streamed, p.GetID())
+		return nil
+	}))
+	assert.Equal(t, []string{"1", "2", "3"}, streamed)
+
+	p, err := m.Get("1")
+	require.NoError(t, err)
+	assert.IsType(t, new(ladon.EqualsSubjectCondition), p.GetConditions()["owner"])
+	assert.Equal(t, ladon.ErrReadOnly, errors.Cause(m.Create(p)))
+	assert.Equal(t, ladon.ErrReadOnly, errors.Cause(m.Update(p)))
+	assert.Equal(t, ladon.ErrReadOnly, errors.Cause(m.Delete("1")))
+
+	_, err = m.Get("4")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	warden := &ladon.Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: ladon.Context{"owner": "peter"}}))
+
+	write(t, dir, "team/other.json", `{"id": "1", "effect": "allow"}`)
+	assert.Error(t, m.Load())
+	assert.Equal(t, []string{"1", "2", "3"}, ids(t, m), "a failed load must keep the policies")
+
+	require.NoError(t, m.Ping(context.Background()))
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Error(t, m.Ping(context.Background()), "a missing directory is unhealthy")
+	require.NoError(t, m.Close(context.Background()))
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Ping(context.Background())))
+}
+
+func TestFileManagerYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write(t, dir, "articles.yaml", `
+# Peter may read all articles he owns.
+id: "1"
+effect: allow
+subjects: [peter]
+actions: [get]
+resources: ["articles:<[0-9]+>"]
+conditions:
+  owner:
+    type: EqualsSubjectCondition
+---
+- id: "2"
+  effect: deny
+  subjects: [peter]
+  actions: [get]
+  resources: ["articles:<[0-9]+>"]
+  conditions:
+    ip:
+      type: CIDRCondition
+      options:
+        cidr: 10.0.0.0/8
+`)
+	write(t, dir, "team/empty.yml", ``)
+
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids(t, m))
+
+	p, err := m.Get("2")
+	require.NoError(t, err)
+	assert.Equal(t, &ladon.CIDRCondition{CIDR: "10.0.0.0/8"}, p.GetConditions()["ip"])
+
+	warden := &ladon.Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: ladon.Context{"owner": "peter", "ip": "192.168.0.1"}}))
+	assert.Error(t, warden.IsAllowed(&ladon.Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: ladon.Context{"owner": "peter", "ip": "10.0.0.1"}}))
+
+	write(t, dir, "broken.yaml", `id: [`)
+	assert.Error(t, m.Load())
+}
+
+func TestFileManagerWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write(t, dir, "1.json", `{"id": "1", "effect": "allow"}`)
+	m, err := NewFileManager(dir)
+	require.NoError(t, err)
+
+	notifier := make(channelNotifier)
+	reloads := make(chan error)
+	m.Notifier = notifier
+	m.OnReload = func(err error) { reloads <- err }
+
+	done := make(chan error)
+	go func() { done <- m.Watch(context.Background()) }()
+
+	write(t, dir, "2.json", `{"id": "2", "effect": "deny"}`)
+	notifier <- struct{}{}
+	require.NoError(t, <-reloads)
+	assert.Equal(t, []string{"1", "2"}, ids(t, m))
+
+	write(t, dir, "2.json", `{"id": "2", "effect": "maybe"}`)
+	notifier <- struct{}{}
+	require.Error(t, <-reloads)
+	assert.Equal(t, []string{"1", "2"}, ids(t, m))
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.Error(t, <-done)
+	assert.Equal(t, ladon.ErrManagerClosed, errors.Cause(m.Watch(context.Background())))
+}
+
+func TestPollingNotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ladon-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := (&PollingNotifier{Interval: time.Millisecond * 5}).Notify(ctx, dir)
+	require.NoError(t, err)
+
+	write(t, dir, "1.json", `{"id": "1", "effect": "allow"}`)
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("change was not reported")
+	}
+
+	cancel()
+	for range changes {
+	}
+}
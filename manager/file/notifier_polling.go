@@ -0,0 +1,102 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PollingNotifier is a Notifier which compares the names, sizes and modification times of all files below the
+// directory every Interval.
+type PollingNotifier struct {
+	Interval time.Duration
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Notify sends on the returned channel whenever files below dir changed, until ctx is canceled.
+func (n *PollingNotifier) Notify(ctx context.Context, dir string) (<-chan struct{}, error) {
+	previous, err := snapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(n.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// The directory might be replaced while we are looking at it, so errors are retried on the next tick.
+			current, err := snapshot(dir)
+			if err != nil || equal(previous, current) {
+				continue
+			}
+
+			previous = current
+			select {
+			case changes <- struct{}{}:
+			default:
+				// A notification is pending already.
+			}
+		}
+	}()
+	return changes, nil
+}
+
+func snapshot(dir string) (map[string]fileState, error) {
+	files := map[string]fileState{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if !info.IsDir() {
+			files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return files, err
+}
+
+func equal(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for path, state := range a {
+		if other, ok := b[path]; !ok || other.size != state.size || !other.modTime.Equal(state.modTime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,354 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package firestore provides a Manager storing policies in Google Cloud Firestore, so services running on GCP can
+// keep policies in a managed database instead of SQL. Firestore in Datastore mode is supported by an adapter
+// around the Datastore client, because the manager relies on nothing but documents, equality and array-contains
+// filters and transactions.
+//
+// Each policy is stored as one document whose ID is the policy ID. Besides the encoded policy, the document holds
+// the literal subjects and resources, flags for policies with patterns and the tenant, so candidate lookups are
+// queries instead of full scans. Request candidates are looked up with a composite index on tenant and subjects:
+//
+//	gcloud firestore indexes composite create --collection-group=ladon_policies \
+//		--field-config=field-path=tenant,order=ascending \
+//		--field-config=field-path=subjects,array-config=contains
+//	gcloud firestore indexes composite create --collection-group=ladon_policies \
+//		--field-config=field-path=tenant,order=ascending \
+//		--field-config=field-path=subject_pattern,order=ascending
+package firestore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// Operators used by filters.
+const (
+	OpEqual         = "=="
+	OpArrayContains = "array-contains"
+)
+
+// Document is the stored form of a policy. The field tags match the names used by the firestore package, so
+// adapters can pass documents to DocumentRef.Set and DataTo as they are.
+type Document struct {
+	ID              string   `firestore:"id"`
+	Policy          string   `firestore:"policy"`
+	Version         int      `firestore:"version"`
+	Tenant          string   `firestore:"tenant"`
+	Subjects        []string `firestore:"subjects"`
+	Resources       []string `firestore:"resources"`
+	SubjectPattern  bool     `firestore:"subject_pattern"`
+	ResourcePattern bool     `firestore:"resource_pattern"`
+}
+
+// Filter is a single condition of a query, for example Filter{Path: "subjects", Op: OpArrayContains, Value: "peter"}.
+type Filter struct {
+	Path  string
+	Op    string
+	Value interface{}
+}
+
+// Client is the contract FirestoreManager requires from Firestore. A *firestore.Client already retries conflicting
+// transactions in RunTransaction; Query combines the filters with Where and List orders by firestore.DocumentID.
+type Client interface {
+	// RunTransaction runs fn in a transaction, retrying it if it conflicts with another transaction. The
+	// transaction is rolled back if fn returns an error.
+	RunTransaction(ctx context.Context, fn func(ctx context.Context, tx Transaction) error) error
+
+	// Query returns all documents of collection matching all filters.
+	Query(ctx context.Context, collection string, filters ...Filter) ([]Document, error)
+
+	// List returns limit documents of collection ordered by document ID, skipping the first offset ones.
+	List(ctx context.Context, collection string, limit, offset int) ([]Document, error)
+}
+
+// Transaction is a Firestore transaction. As required by Firestore, all reads happen before all writes.
+type Transaction interface {
+	// Get returns the document with the given ID, or nil if it does not exist.
+	Get(collection, id string) (*Document, error)
+
+	// Set stores the document, overwriting an existing one.
+	Set(collection string, doc *Document) error
+
+	// Delete removes the document with the given ID. Deleting a missing document is not an error.
+	Delete(collection, id string) error
+}
+
+// FirestoreManager is a Manager storing policies in Firestore. Use NewFirestoreManager to construct it.
+type FirestoreManager struct {
+	Client     Client
+	Collection string
+	Timeout    time.Duration
+}
+
+// NewFirestoreManager initializes a new FirestoreManager storing policies in the given collection, for example
+// "ladon_policies".
+func NewFirestoreManager(client Client, collection string) *FirestoreManager {
+	return &FirestoreManager{
+		Client:     client,
+		Collection: collection,
+		Timeout:    time.Second * 5,
+	}
+}
+
+func (m *FirestoreManager) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), m.Timeout)
+}
+
+// document returns the stored form of p.
+func document(p Policy) (*Document, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	doc := &Document{ID: p.GetID(), Policy: string(payload), Tenant: PolicyTenant(p), Subjects: []string{}, Resources: []string{}}
+	if v, ok := p.(VersionedPolicy); ok {
+		doc.Version = v.GetVersion()
+	}
+
+	for _, s := range p.GetSubjects() {
+		if IsLiteralTemplate(p, s) {
+			doc.Subjects = append(doc.Subjects, s)
+		} else {
+			doc.SubjectPattern = true
+		}
+	}
+
+	for _, r := range p.GetResources() {
+		if IsLiteralTemplate(p, r) {
+			doc.Resources = append(doc.Resources, r)
+		} else {
+			doc.ResourcePattern = true
+		}
+	}
+	return doc, nil
+}
+
+// Create persists the policy.
+func (m *FirestoreManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+
+	doc, err := document(policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	return m.Client.RunTransaction(ctx, func(ctx context.Context, tx Transaction) error {
+		if stored, err := tx.Get(m.Collection, doc.ID); err != nil {
+			return errors.WithStack(err)
+		} else if stored != nil {
+			return errors.WithStack(ErrPolicyExists)
+		}
+		return errors.WithStack(tx.Set(m.Collection, doc))
+	})
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one.
+func (m *FirestoreManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	v, versioned := policy.(VersionedPolicy)
+	var requested int
+	if versioned {
+		requested = v.GetVersion()
+	}
+
+	err := m.Client.RunTransaction(ctx, func(ctx context.Context, tx Transaction) error {
+		stored, err := tx.Get(m.Collection, policy.GetID())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if versioned {
+			var current int
+			if stored != nil {
+				current = stored.Version
+			}
+
+			if requested != 0 && requested != current {
+				return errors.WithStack(ErrVersionConflict)
+			}
+			v.SetVersion(current + 1)
+		}
+
+		doc, err := document(policy)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(tx.Set(m.Collection, doc))
+	})
+
+	// Transactions may be retried, so the version is only left changed if the update went through.
+	if err != nil && versioned {
+		v.SetVersion(requested)
+	}
+	return err
+}
+
+// Get retrieves a policy.
+func (m *FirestoreManager) Get(id string) (Policy, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	var doc *Document
+	err := m.Client.RunTransaction(ctx, func(ctx context.Context, tx Transaction) (err error) {
+		doc, err = tx.Get(m.Collection, id)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, err
+	} else if doc == nil {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return decode(doc)
+}
+
+// Delete removes a policy.
+func (m *FirestoreManager) Delete(id string) error {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	return m.Client.RunTransaction(ctx, func(ctx context.Context, tx Transaction) error {
+		return errors.WithStack(tx.Delete(m.Collection, id))
+	})
+}
+
+// GetAll returns all policies, ordered by ID.
+func (m *FirestoreManager) GetAll(limit, offset int64) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	docs, err := m.Client.List(ctx, m.Collection, int(limit), int(offset))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return decodeAll(docs)
+}
+
+// find returns the union of the documents matching the literal and the pattern query, both narrowed by scope.
+func (m *FirestoreManager) find(field, pattern, value string, scope ...Filter) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	literal, err := m.Client.Query(ctx, m.Collection, append(scope, Filter{Path: field, Op: OpArrayContains, Value: value})...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	patterns, err := m.Client.Query(ctx, m.Collection, append(scope, Filter{Path: pattern, Op: OpEqual, Value: true})...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return decodeAll(append(literal, patterns...))
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *FirestoreManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject.
+func (m *FirestoreManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.find("subjects", "subject_pattern", r.Subject, Filter{Path: "tenant", Op: OpEqual, Value: r.Tenant})
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject pattern.
+func (m *FirestoreManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.find("subjects", "subject_pattern", subject)
+}
+
+// FindPoliciesForResource returns the policies containing the resource verbatim and all policies with at least
+// one resource pattern.
+func (m *FirestoreManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.find("resources", "resource_pattern", resource)
+}
+
+// Ping lists a single document of the collection, which fails if Firestore is unreachable. It is limited by
+// Timeout.
+func (m *FirestoreManager) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if _, err := m.Client.List(ctx, m.Collection, 1, 0); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Close does nothing. The Client is not closed, because it is owned by the caller.
+func (m *FirestoreManager) Close(ctx context.Context) error {
+	return nil
+}
+
+// decodeAll decodes docs, skipping documents whose ID was seen before.
+func decodeAll(docs []Document) (Policies, error) {
+	ps := make(Policies, 0, len(docs))
+	seen := map[string]bool{}
+	for k := range docs {
+		if seen[docs[k].ID] {
+			continue
+		}
+		seen[docs[k].ID] = true
+
+		p, err := decode(&docs[k])
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func decode(doc *Document) (Policy, error) {
+	var p DefaultPolicy
+	if err := json.Unmarshal([]byte(doc.Policy), &p); err != nil {
+		return nil, errors.Wrapf(err, "Could not decode policy %s", doc.ID)
+	}
+	return &p, nil
+}
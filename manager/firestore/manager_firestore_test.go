@@ -0,0 +1,226 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package firestore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+// fakeClient is an in-memory Client. Transactions work on a copy, which is discarded if fn fails.
+type fakeClient struct {
+	sync.Mutex
+	docs    map[string]map[string]Document
+	queries [][]Filter
+}
+
+type fakeTransaction struct {
+	docs map[string]map[string]Document
+}
+
+func (c *fakeClient) RunTransaction(ctx context.Context, fn func(context.Context, Transaction) error) error {
+	c.Lock()
+	defer c.Unlock()
+
+	docs := map[string]map[string]Document{}
+	for name, collection := range c.docs {
+		docs[name] = map[string]Document{}
+		for id, doc := range collection {
+			docs[name][id] = doc
+		}
+	}
+
+	if err := fn(ctx, &fakeTransaction{docs: docs}); err != nil {
+		return err
+	}
+	c.docs = docs
+	return nil
+}
+
+func (c *fakeClient) Query(ctx context.Context, collection string, filters ...Filter) ([]Document, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.queries = append(c.queries, filters)
+
+	var out []Document
+	for _, doc := range c.sorted(collection) {
+		if matches(doc, filters) {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+func (c *fakeClient) List(ctx context.Context, collection string, limit, offset int) ([]Document, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	docs := c.sorted(collection)
+	if offset > len(docs) {
+		offset = len(docs)
+	}
+	docs = docs[offset:]
+	if limit < len(docs) {
+		docs = docs[:limit]
+	}
+	return docs, nil
+}
+
+func (c *fakeClient) sorted(collection string) []Document {
+	var docs []Document
+	for _, doc := range c.docs[collection] {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].ID < docs[j].ID
+	})
+	return docs
+}
+
+func matches(doc Document, filters []Filter) bool {
+	for _, f := range filters {
+		var ok bool
+		switch f.Path + " " + f.Op {
+		case "tenant ==":
+			ok = doc.Tenant == f.Value
+		case "subject_pattern ==":
+			ok = doc.SubjectPattern == f.Value
+		case "resource_pattern ==":
+			ok = doc.ResourcePattern == f.Value
+		case "subjects array-contains":
+			ok = contains(doc.Subjects, f.Value.(string))
+		case "resources array-contains":
+			ok = contains(doc.Resources, f.Value.(string))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (tx *fakeTransaction) Get(collection, id string) (*Document, error) {
+	doc, ok := tx.docs[collection][id]
+	if !ok {
+		return nil, nil
+	}
+	return &doc, nil
+}
+
+func (tx *fakeTransaction) Set(collection string, doc *Document) error {
+	if tx.docs[collection] == nil {
+		tx.docs[collection] = map[string]Document{}
+	}
+	tx.docs[collection][doc.ID] = *doc
+	return nil
+}
+
+func (tx *fakeTransaction) Delete(collection, id string) error {
+	delete(tx.docs[collection], id)
+	return nil
+}
+
+func ids(t *testing.T, ps ladon.Policies, err error) []string {
+	require.NoError(t, err)
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.GetID())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestFirestoreManager(t *testing.T) {
+	c := &fakeClient{docs: map[string]map[string]Document{}}
+	m := NewFirestoreManager(c, "ladon_policies")
+	for _, p := range []*ladon.DefaultPolicy{
+		{ID: "1", Subjects: []string{"peter", "max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+		{ID: "2", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+		{ID: "3", Subjects: []string{"ken"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, Tenant: "acme"},
+		{ID: "4", Subjects: []string{"team:*"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeGlob},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	_, err := m.Get("5")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter", "max"}, got.GetSubjects())
+
+	doc := c.docs["ladon_policies"]["2"]
+	assert.Equal(t, []string{}, doc.Subjects)
+	assert.Equal(t, []string{}, doc.Resources)
+	assert.True(t, doc.SubjectPattern)
+	assert.True(t, doc.ResourcePattern)
+	assert.Equal(t, 1, doc.Version)
+
+	ps, err := m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"1", "2", "4"}, ids(t, ps, err))
+	ps, err = m.FindPoliciesForResource("users:1")
+	assert.Equal(t, []string{"2", "3", "4"}, ids(t, ps, err))
+
+	// The tenant is part of the queries, so other tenants' policies are never read.
+	c.queries = nil
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})
+	assert.Equal(t, []string{"3"}, ids(t, ps, err))
+	require.Len(t, c.queries, 2)
+	for _, q := range c.queries {
+		assert.Contains(t, q, Filter{Path: "tenant", Op: OpEqual, Value: "acme"})
+	}
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}))
+	ps, err = m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"2", "4"}, ids(t, ps, err))
+	assert.Equal(t, 2, c.docs["ladon_policies"]["1"].Version)
+
+	stale := &ladon.DefaultPolicy{ID: "1", Version: 1, Subjects: []string{"peter"}, Effect: ladon.AllowAccess}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(stale)))
+	assert.Equal(t, 1, stale.Version)
+	assert.Equal(t, []string{"max"}, c.docs["ladon_policies"]["1"].Subjects)
+
+	require.NoError(t, m.Delete("2"))
+	require.NoError(t, m.Delete("2"))
+	ps, err = m.FindPoliciesForSubject("max")
+	assert.Equal(t, []string{"1", "4"}, ids(t, ps, err))
+
+	all, err := m.GetAll(10, 1)
+	assert.Equal(t, []string{"3", "4"}, ids(t, all, err))
+}
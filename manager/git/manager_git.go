@@ -0,0 +1,449 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package git provides a read-only Manager serving the policy files of a Git repository, so policies go through
+// the same review as code. The repository is cloned into a local directory and refreshed on a schedule or when a
+// webhook reports a push. Policies carry the commit they were loaded from, which audit records list as their source,
+// so every decision can be traced to a reviewed change.
+//
+// Files are decoded like those of the file manager: JSON files contain a policy or a list of policies, YAML files
+// one or more documents. Other files are ignored.
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/ladon/manager/file"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// Syncer updates a local checkout of the repository.
+type Syncer interface {
+	// Sync clones the repository into dir unless it was cloned before, otherwise it checks out the latest commit
+	// of the tracked branch. It returns the SHA of the checked out commit.
+	Sync(ctx context.Context, dir string) (string, error)
+}
+
+// ExecSyncer is a Syncer running the git command line tool. Credentials are configured as for any other git
+// command, for example with a credential helper or an SSH key.
+type ExecSyncer struct {
+	// URL is the address of the repository.
+	URL string
+
+	// Ref is the branch or tag to check out. It defaults to the default branch of the repository.
+	Ref string
+
+	// Binary is the path of the git executable. It defaults to "git".
+	Binary string
+}
+
+func (s *ExecSyncer) git(ctx context.Context, args ...string) (string, error) {
+	binary := s.Binary
+	if binary == "" {
+		binary = "git"
+	}
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "git %s failed: %s", strings.Join(args, " "), bytes.TrimSpace(out))
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// Sync clones the repository with a depth of one, or fetches the latest commit of Ref and resets the checkout to
+// it, removing files which are not tracked.
+func (s *ExecSyncer) Sync(ctx context.Context, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		args := []string{"clone", "--depth", "1"}
+		if s.Ref != "" {
+			args = append(args, "--branch", s.Ref)
+		}
+		if _, err := s.git(ctx, append(args, "--", s.URL, dir)...); err != nil {
+			return "", err
+		}
+	} else {
+		ref := s.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+
+		for _, args := range [][]string{
+			{"-C", dir, "fetch", "--depth", "1", "--", s.URL, ref},
+			{"-C", dir, "reset", "--hard", "FETCH_HEAD"},
+			{"-C", dir, "clean", "-ffdx"},
+		} {
+			if _, err := s.git(ctx, args...); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return s.git(ctx, "-C", dir, "rev-parse", "HEAD")
+}
+
+// CommitPolicy is a policy loaded from the repository. It implements SourcedPolicy.
+type CommitPolicy struct {
+	*DefaultPolicy
+
+	// Commit is the SHA of the commit the policy was loaded from.
+	Commit string
+}
+
+// GetSource returns the commit the policy was loaded from.
+func (p *CommitPolicy) GetSource() string {
+	return p.Commit
+}
+
+// GitManager is a read-only Manager serving the policies of a Git repository. Use NewGitManager to construct it
+// and Watch to refresh it.
+type GitManager struct {
+	Syncer Syncer
+
+	// Dir is the local checkout of the repository.
+	Dir string
+
+	// Path is the directory within the repository holding the policies. It defaults to the root of the
+	// repository.
+	Path string
+
+	// Interval is the time between two refreshes by Watch. It defaults to one minute.
+	Interval time.Duration
+
+	// Timeout limits a single refresh. It defaults to one minute.
+	Timeout time.Duration
+
+	// Secret authenticates webhooks, see Webhook.
+	Secret string
+
+	// OnRefresh is called by Watch after every refresh with the served commit. If the repository can not be
+	// synced or its policies can not be loaded, err is set and the previous policies are kept.
+	OnRefresh func(commit string, err error)
+
+	policies *memory.MemoryManager
+	commit   string
+	sync.RWMutex
+
+	// syncing serializes refreshes, because git commands on the same checkout conflict.
+	syncing sync.Mutex
+	trigger chan struct{}
+
+	closed  bool
+	closing chan struct{}
+	running sync.WaitGroup
+}
+
+// NewGitManager returns a GitManager serving the policies of the repository synced into dir. It fails if the
+// repository can not be synced or its policies can not be loaded.
+func NewGitManager(syncer Syncer, dir string) (*GitManager, error) {
+	m := &GitManager{
+		Syncer:   syncer,
+		Dir:      dir,
+		Interval: time.Minute,
+		Timeout:  time.Minute,
+		policies: memory.NewMemoryManager(),
+		trigger:  make(chan struct{}, 1),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Commit returns the SHA of the commit whose policies are served.
+func (m *GitManager) Commit() string {
+	m.RLock()
+	defer m.RUnlock()
+	return m.commit
+}
+
+// Refresh syncs the repository and replaces the served policies with those of the checked out commit, unless it
+// is served already. If the policies can not be loaded, for example because a file is invalid or a policy ID is
+// used more than once, the served policies are left untouched.
+func (m *GitManager) Refresh(ctx context.Context) error {
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+
+	commit, err := m.Syncer.Sync(ctx, m.Dir)
+	if err != nil {
+		return err
+	} else if commit == m.Commit() {
+		return nil
+	}
+
+	policies, err := m.load(commit)
+	if err != nil {
+		return errors.Wrapf(err, "Could not load policies of commit %s", commit)
+	}
+
+	m.Lock()
+	m.policies = policies
+	m.commit = commit
+	m.Unlock()
+	return nil
+}
+
+func (m *GitManager) load(commit string) (*memory.MemoryManager, error) {
+	var ps Policies
+	root := filepath.Join(m.Dir, m.Path)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		} else if info.IsDir() || !file.IsPolicyFile(path) {
+			return nil
+		}
+
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rel, _ := filepath.Rel(m.Dir, path)
+		decoded, err := file.Decode(rel, raw)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range decoded {
+			ps = append(ps, &CommitPolicy{DefaultPolicy: p.(*DefaultPolicy), Commit: commit})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	policies := memory.NewMemoryManager()
+	if err := policies.CreateAll(ps); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// Watch refreshes the policies every Interval and whenever Webhook is called, until ctx is canceled or the
+// manager is closed.
+func (m *GitManager) Watch(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return errors.WithStack(ErrManagerClosed)
+	}
+	m.lifecycle()
+	m.running.Add(1)
+	closing := m.closing
+	m.Unlock()
+	defer m.running.Done()
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-closing:
+			return nil
+		case <-ticker.C:
+		case <-m.trigger:
+		}
+
+		refreshCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+		err := m.Refresh(refreshCtx)
+		cancel()
+		if m.OnRefresh != nil {
+			m.OnRefresh(m.Commit(), err)
+		}
+	}
+}
+
+// Webhook returns a handler for push webhooks, which makes Watch refresh the policies right away. If Secret is
+// set, requests must be signed with it like GitHub webhooks, or carry it like GitLab webhooks.
+func (m *GitManager) Webhook() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 25<<20))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if m.Secret != "" && !m.authenticated(r, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// A refresh is pending already if the channel is full.
+		select {
+		case m.trigger <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func (m *GitManager) authenticated(r *http.Request, body []byte) bool {
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(m.Secret)) == 1
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(m.Secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+// lifecycle initializes the channel used by Close. The lock must be held.
+func (m *GitManager) lifecycle() {
+	if m.closing == nil {
+		m.closing = make(chan struct{})
+	}
+}
+
+func (m *GitManager) current() *memory.MemoryManager {
+	m.RLock()
+	defer m.RUnlock()
+	return m.policies
+}
+
+// Ping returns ErrManagerClosed once Close was called. Policies are served from memory, so the repository is not
+// contacted.
+func (m *GitManager) Ping(ctx context.Context) error {
+	m.RLock()
+	defer m.RUnlock()
+	if m.closed {
+		return errors.WithStack(ErrManagerClosed)
+	}
+	return nil
+}
+
+// Close stops all watches and waits for them to return, or until ctx is done.
+func (m *GitManager) Close(ctx context.Context) error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	m.lifecycle()
+	close(m.closing)
+	m.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Create is not supported and returns ErrReadOnly.
+func (m *GitManager) Create(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Update is not supported and returns ErrReadOnly.
+func (m *GitManager) Update(policy Policy) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Delete is not supported and returns ErrReadOnly.
+func (m *GitManager) Delete(id string) error {
+	return errors.WithStack(ErrReadOnly)
+}
+
+// Get retrieves a policy.
+func (m *GitManager) Get(id string) (Policy, error) {
+	return m.current().Get(id)
+}
+
+// Count returns the number of served policies.
+func (m *GitManager) Count() (int64, error) {
+	return m.current().Count()
+}
+
+// Exists returns true if a policy with the given ID is served.
+func (m *GitManager) Exists(id string) (bool, error) {
+	return m.current().Exists(id)
+}
+
+// GetAll retrieves all policies.
+func (m *GitManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.current().GetAll(limit, offset)
+}
+
+// FindRequestCandidates returns the policies of the request's tenant.
+func (m *GitManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.current().FindRequestCandidates(r)
+}
+
+// FindPoliciesForSubject returns all policies.
+func (m *GitManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.current().FindPoliciesForSubject(subject)
+}
+
+// FindPoliciesForResource returns all policies.
+func (m *GitManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.current().FindPoliciesForResource(resource)
+}
+
+// FindPoliciesByLabel returns the policies whose label key is set to value.
+func (m *GitManager) FindPoliciesByLabel(key, value string) (Policies, error) {
+	return m.current().FindPoliciesByLabel(key, value)
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package git
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+// fakeSyncer writes the files of the next commit to the checkout.
+type fakeSyncer struct {
+	sync.Mutex
+	commit string
+	files  map[string]string
+	syncs  int
+}
+
+func (s *fakeSyncer) push(commit string, files map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	s.commit, s.files = commit, files
+}
+
+func (s *fakeSyncer) Sync(ctx context.Context, dir string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.syncs++
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	for name, content := range s.files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		} else if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return "", err
+		}
+	}
+	return s.commit, nil
+}
+
+func TestGitManager(t *testing.T) {
+	syncer := &fakeSyncer{commit: "a1", files: map[string]string{
+		"policies/articles.json": `{"id": "articles", "subjects": ["<.*>"], "resources": ["articles:<.*>"], "actions": ["get"], "effect": "allow"}`,
+		"policies/users.yaml":    "id: users\nsubjects: [ken]\nresources: [users:1]\nactions: [get]\neffect: allow\n",
+		".git/config.json":       "not a policy",
+		"README.md":              "# Policies",
+	}}
+
+	m, err := NewGitManager(syncer, filepath.Join(t.TempDir(), "checkout"))
+	require.NoError(t, err)
+	assert.Equal(t, "a1", m.Commit())
+
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, ladon.ErrReadOnly, errors.Cause(m.Delete("users")))
+
+	audit := memory.NewMemoryAuditManager()
+	warden := &ladon.Ladon{Manager: m, AuditLogger: &ladon.AuditTrail{Manager: audit}}
+	require.NoError(t, warden.IsAllowed(&ladon.Request{Subject: "ken", Resource: "users:1", Action: "get"}))
+
+	records, err := audit.FindDecisions(time.Time{}, time.Time{}, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"users": "a1"}, records[0].Sources)
+
+	// Invalid commits are not served.
+	syncer.push("b2", map[string]string{"a.json": `{"id": "1", "effect": "allow"}`, "b.json": `{"id": "1", "effect": "deny"}`})
+	assert.Error(t, m.Refresh(context.Background()))
+	assert.Equal(t, "a1", m.Commit())
+
+	syncer.push("c3", map[string]string{"policies/users.json": `{"id": "users", "subjects": ["peter"], "resources": ["users:1"], "actions": ["get"], "effect": "allow"}`})
+	require.NoError(t, m.Refresh(context.Background()))
+	assert.Equal(t, "c3", m.Commit())
+	assert.Error(t, warden.IsAllowed(&ladon.Request{Subject: "ken", Resource: "users:1", Action: "get"}))
+
+	p, err := m.Get("users")
+	require.NoError(t, err)
+	assert.Equal(t, "c3", ladon.PolicySource(p))
+
+	m.Path = "policies"
+	syncer.push("d4", map[string]string{"policies/a.json": `{"id": "a", "effect": "allow"}`, "other/b.json": `{"id": "b", "effect": "allow"}`})
+	require.NoError(t, m.Refresh(context.Background()))
+	all, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "a", all[0].GetID())
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitManagerWebhook(t *testing.T) {
+	syncer := &fakeSyncer{commit: "a1", files: map[string]string{"a.json": `{"id": "a", "effect": "allow"}`}}
+	m, err := NewGitManager(syncer, filepath.Join(t.TempDir(), "checkout"))
+	require.NoError(t, err)
+
+	m.Interval = time.Hour
+	m.Secret = "s3cr3t"
+	refreshed := make(chan string, 10)
+	m.OnRefresh = func(commit string, err error) {
+		assert.NoError(t, err)
+		refreshed <- commit
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- m.Watch(context.Background())
+	}()
+
+	server := httptest.NewServer(m.Webhook())
+	defer server.Close()
+
+	push := func(header, value string) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{"ref": "refs/heads/main"}`))
+		require.NoError(t, err)
+		req.Header.Set(header, value)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, push("X-Hub-Signature-256", sign("wrong", `{"ref": "refs/heads/main"}`)))
+	assert.Equal(t, http.StatusUnauthorized, push("X-Gitlab-Token", "wrong"))
+
+	syncer.push("b2", map[string]string{"b.json": `{"id": "b", "effect": "allow"}`})
+	assert.Equal(t, http.StatusAccepted, push("X-Hub-Signature-256", sign("s3cr3t", `{"ref": "refs/heads/main"}`)))
+	assert.Equal(t, "b2", <-refreshed)
+
+	syncer.push("c3", map[string]string{"c.json": `{"id": "c", "effect": "allow"}`})
+	assert.Equal(t, http.StatusAccepted, push("X-Gitlab-Token", "s3cr3t"))
+	assert.Equal(t, "c3", <-refreshed)
+
+	require.NoError(t, m.Close(context.Background()))
+	assert.NoError(t, <-done)
+}
+
+func TestExecSyncer(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	origin := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", origin, "-c", "user.name=ladon", "-c", "user.email=ladon@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "%s", out)
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(name, content string) string {
+		require.NoError(t, os.WriteFile(filepath.Join(origin, name), []byte(content), 0644))
+		run("add", "-A")
+		run("commit", "-q", "-m", "Update "+name)
+		return run("rev-parse", "HEAD")
+	}
+
+	run("init", "-q", "-b", "main")
+	first := commit("a.json", `{"id": "a", "effect": "allow"}`)
+
+	m, err := NewGitManager(&ExecSyncer{URL: "file://" + origin, Ref: "main"}, filepath.Join(t.TempDir(), "checkout"))
+	require.NoError(t, err)
+	assert.Equal(t, first, m.Commit())
+
+	second := commit("b.json", `{"id": "b", "effect": "deny"}`)
+	require.NoError(t, m.Refresh(context.Background()))
+	assert.Equal(t, second, m.Commit())
+
+	p, err := m.Get("b")
+	require.NoError(t, err)
+	assert.Equal(t, second, ladon.PolicySource(p))
+
+	_, err = (&ExecSyncer{URL: "file:///does/not/exist"}).Sync(context.Background(), t.TempDir()+"/missing")
+	assert.Error(t, err)
+
+	// A URL is never parsed as an option of git fetch.
+	injected := filepath.Join(t.TempDir(), "injected")
+	_, err = (&ExecSyncer{URL: "--upload-pack=touch " + injected}).Sync(context.Background(), m.Dir)
+	assert.Error(t, err)
+	_, err = os.Stat(injected)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/ory/ladon"
+	"github.com/ory/pagination"
+)
+
+// MemoryAuditManager is an in-memory (non-persistent) implementation of AuditManager.
+type MemoryAuditManager struct {
+	records []AuditRecord
+	sync.RWMutex
+}
+
+// NewMemoryAuditManager constructs a MemoryAuditManager holding no decisions.
+func NewMemoryAuditManager() *MemoryAuditManager {
+	return &MemoryAuditManager{}
+}
+
+// RecordDecision stores a copy of the decision.
+func (m *MemoryAuditManager) RecordDecision(record *AuditRecord) error {
+	m.Lock()
+	defer m.Unlock()
+
+	r := *record
+	r.Policies = append([]string{}, record.Policies...)
+	m.records = append(m.records, r)
+	return nil
+}
+
+// FindDecisions returns the decisions made at or after from and before to, newest first.
+func (m *MemoryAuditManager) FindDecisions(from, to time.Time, limit, offset int64) ([]AuditRecord, error) {
+	return m.find(func(r *AuditRecord) bool { return true }, from, to, limit, offset), nil
+}
+
+// FindDecisionsBySubject returns the decisions on requests of subject made at or after from and before to,
+// newest first.
+func (m *MemoryAuditManager) FindDecisionsBySubject(subject string, from, to time.Time, limit, offset int64) ([]AuditRecord, error) {
+	return m.find(func(r *AuditRecord) bool { return r.Request.Subject == subject }, from, to, limit, offset), nil
+}
+
+// PurgeDecisions removes all decisions made before t.
+func (m *MemoryAuditManager) PurgeDecisions(before time.Time) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	kept := m.records[:0]
+	for _, r := range m.records {
+		if !r.Timestamp.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+
+	purged := int64(len(m.records) - len(kept))
+	m.records = kept
+	return purged, nil
+}
+
+func (m *MemoryAuditManager) find(match func(*AuditRecord) bool, from, to time.Time, limit, offset int64) []AuditRecord {
+	m.RLock()
+	var found []AuditRecord
+	for k := range m.records {
+		r := &m.records[k]
+		if (!from.IsZero() && r.Timestamp.Before(from)) || (!to.IsZero() && !r.Timestamp.Before(to)) || !match(r) {
+			continue
+		}
+		found = append(found, *r)
+	}
+	m.RUnlock()
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Timestamp.After(found[j].Timestamp)
+	})
+
+	start, end := pagination.Index(int(limit), int(offset), len(found))
+	return found[start:end]
+}
@@ -21,78 +21,306 @@
 package memory
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 
 	. "github.com/ory/ladon"
 	"github.com/ory/pagination"
-	"sort"
 )
 
 // MemoryManager is an in-memory (non-persistent) implementation of Manager.
+//
+// Reads are served from an immutable snapshot of the policies, sorted by ID, so that concurrent wardens do not
+// contend on a lock. Writes discard the snapshot and the first read afterwards builds a new one, so Policies must
+// only be changed directly before the manager is first read.
 type MemoryManager struct {
 	Policies map[string]Policy
+
+	// ConflictMode enables conflict detection in Create and Update. In ConflictModeWarn, OnConflict is called
+	// with the conflicting policies after the write succeeded.
+	ConflictMode ConflictMode
+	OnConflict   func(policy Policy, conflicts Policies)
+
+	history   map[string][]PolicyRevision
+	packs     map[string][]PolicyPack
+	templates map[string]*PolicyTemplate
+	snapshot  atomic.Pointer[snapshot]
+	building  sync.Mutex
 	sync.RWMutex
 }
 
 // NewMemoryManager constructs and initializes new MemoryManager with no policies.
 func NewMemoryManager() *MemoryManager {
 	return &MemoryManager{
-		Policies: map[string]Policy{},
+		Policies:  map[string]Policy{},
+		history:   map[string][]PolicyRevision{},
+		packs:     map[string][]PolicyPack{},
+		templates: map[string]*PolicyTemplate{},
+	}
+}
+
+// unlock discards the snapshot, because the policies may have changed, and releases the write lock.
+func (m *MemoryManager) unlock() {
+	m.snapshot.Store(nil)
+	m.Unlock()
+}
+
+// snapshot is an immutable copy of the policies of a MemoryManager.
+type snapshot struct {
+	byID   map[string]Policy
+	sorted Policies
+}
+
+// load returns the current snapshot, building it if a write discarded it. It must not be modified. Readers
+// arriving while the snapshot is built wait for it instead of building their own.
+func (m *MemoryManager) load() *snapshot {
+	if s := m.snapshot.Load(); s != nil {
+		return s
+	}
+
+	m.building.Lock()
+	defer m.building.Unlock()
+	if s := m.snapshot.Load(); s != nil {
+		return s
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+
+	s := &snapshot{byID: make(map[string]Policy, len(m.Policies)), sorted: make(Policies, 0, len(m.Policies))}
+	for id, p := range m.Policies {
+		s.byID[id] = p
+		s.sorted = append(s.sorted, p)
 	}
+	sort.Slice(s.sorted, func(i, j int) bool { return s.sorted[i].GetID() < s.sorted[j].GetID() })
+
+	// Writers wait for the read lock to be released, so the snapshot can not be stored after it was discarded.
+	m.snapshot.Store(s)
+	return s
+}
+
+// policies returns the policies of the snapshot, sorted by ID. The slice must not be modified.
+func (m *MemoryManager) policies() Policies {
+	return m.load().sorted
 }
 
-// Update updates an existing policy.
-func (m *MemoryManager) Update(policy Policy) error {
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one.
+func (m *MemoryManager) Update(policy Policy) (err error) {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	var conflicts Policies
+	defer func() { m.warn(policy, conflicts, err) }()
+
 	m.Lock()
-	defer m.Unlock()
+	defer m.unlock()
+
+	if conflicts, err = m.checkConflicts(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok {
+		var current int
+		if stored, ok := m.Policies[policy.GetID()].(VersionedPolicy); ok {
+			current = stored.GetVersion()
+		}
+
+		if v.GetVersion() != 0 && v.GetVersion() != current {
+			return errors.WithStack(ErrVersionConflict)
+		}
+		v.SetVersion(current + 1)
+	}
+
+	if err := m.record(policy.GetID(), policy); err != nil {
+		return err
+	}
+
 	m.Policies[policy.GetID()] = policy
 	return nil
 }
 
-// GetAll returns all policies.
-func (m *MemoryManager) GetAll(limit, offset int64) (Policies, error) {
-	keys := make([]string, len(m.Policies))
-	i := 0
+// GetHistory returns all revisions of a policy, oldest first.
+func (m *MemoryManager) GetHistory(id string) ([]PolicyRevision, error) {
 	m.RLock()
-	for key := range m.Policies {
-		keys[i] = key
-		i++
+	defer m.RUnlock()
+
+	revisions, ok := m.history[id]
+	if !ok {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	return append([]PolicyRevision{}, revisions...), nil
+}
+
+// record appends a snapshot of policy to the history of id. A nil policy records a deletion.
+func (m *MemoryManager) record(id string, policy Policy) error {
+	revision, err := m.revision(id, policy)
+	if err != nil {
+		return err
+	}
+
+	m.appendRevision(id, revision)
+	return nil
+}
+
+// revision creates a snapshot of policy without adding it to the history.
+func (m *MemoryManager) revision(id string, policy Policy) (PolicyRevision, error) {
+	revision := PolicyRevision{ChangedAt: time.Now().UTC()}
+	if policy != nil {
+		// Policies are stored by reference, so a copy is needed to keep old revisions intact.
+		raw, err := json.Marshal(policy)
+		if err != nil {
+			return revision, errors.WithStack(err)
+		}
+
+		snapshot := new(DefaultPolicy)
+		if err := json.Unmarshal(raw, snapshot); err != nil {
+			return revision, errors.WithStack(err)
+		}
+
+		revision.Policy = snapshot
+		revision.Version = snapshot.Version
+	} else if revisions := m.history[id]; len(revisions) > 0 {
+		revision.Version = revisions[len(revisions)-1].Version
 	}
 
-	start, end := pagination.Index(int(limit), int(offset), len(m.Policies))
-	sort.Strings(keys)
-	ps := make(Policies, len(keys[start:end]))
-	i = 0
-	for _, key := range keys[start:end] {
-		ps[i] = m.Policies[key]
-		i++
+	return revision, nil
+}
+
+func (m *MemoryManager) appendRevision(id string, revision PolicyRevision) {
+	if m.history == nil {
+		m.history = map[string][]PolicyRevision{}
 	}
-	m.RUnlock()
-	return ps, nil
+	m.history[id] = append(m.history[id], revision)
+}
+
+// Count returns the number of stored policies.
+func (m *MemoryManager) Count() (int64, error) {
+	return int64(len(m.policies())), nil
+}
+
+// Exists returns true if a policy with the given ID is stored.
+func (m *MemoryManager) Exists(id string) (bool, error) {
+	_, ok := m.load().byID[id]
+	return ok, nil
+}
+
+// GetAll returns all policies.
+func (m *MemoryManager) GetAll(limit, offset int64) (Policies, error) {
+	all := m.policies()
+	start, end := pagination.Index(int(limit), int(offset), len(all))
+	return append(Policies{}, all[start:end]...), nil
 }
 
 // Create a new pollicy to MemoryManager.
-func (m *MemoryManager) Create(policy Policy) error {
+func (m *MemoryManager) Create(policy Policy) (err error) {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	var conflicts Policies
+	defer func() { m.warn(policy, conflicts, err) }()
+
 	m.Lock()
-	defer m.Unlock()
+	defer m.unlock()
 
 	if _, found := m.Policies[policy.GetID()]; found {
-		return errors.New("Policy exists")
+		return errors.WithStack(ErrPolicyExists)
+	}
+
+	if conflicts, err = m.checkConflicts(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+
+	if err := m.record(policy.GetID(), policy); err != nil {
+		return err
 	}
 
 	m.Policies[policy.GetID()] = policy
 	return nil
 }
 
+// CreateAll persists all policies. If one of them can not be created, none is.
+func (m *MemoryManager) CreateAll(policies Policies) (err error) {
+	for _, policy := range policies {
+		if err := AssignID(policy); err != nil {
+			return err
+		} else if err := ValidatePolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	conflicts := make([]Policies, len(policies))
+	defer func() {
+		for k, policy := range policies {
+			m.warn(policy, conflicts[k], err)
+		}
+	}()
+
+	m.Lock()
+	defer m.unlock()
+
+	// Policies are added as they are checked, so they are checked against each other, too.
+	var created []string
+	defer func() {
+		if err != nil {
+			for _, id := range created {
+				delete(m.Policies, id)
+			}
+		}
+	}()
+
+	for k, policy := range policies {
+		if _, found := m.Policies[policy.GetID()]; found {
+			return errors.Wrapf(ErrPolicyExists, "Could not create policy %s", policy.GetID())
+		}
+
+		if conflicts[k], err = m.checkConflicts(policy); err != nil {
+			return err
+		}
+
+		m.Policies[policy.GetID()] = policy
+		created = append(created, policy.GetID())
+	}
+
+	revisions := make([]PolicyRevision, len(policies))
+	for k, policy := range policies {
+		if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+			v.SetVersion(1)
+		}
+
+		if revisions[k], err = m.revision(policy.GetID(), policy); err != nil {
+			return err
+		}
+	}
+
+	for k, policy := range policies {
+		m.appendRevision(policy.GetID(), revisions[k])
+	}
+	return nil
+}
+
 // Get retrieves a policy.
 func (m *MemoryManager) Get(id string) (Policy, error) {
-	m.RLock()
-	defer m.RUnlock()
-	p, ok := m.Policies[id]
+	p, ok := m.load().byID[id]
 	if !ok {
-		return nil, errors.New("Not found")
+		return nil, errors.WithStack(ErrNotFound)
 	}
 
 	return p, nil
@@ -101,28 +329,129 @@ func (m *MemoryManager) Get(id string) (Policy, error) {
 // Delete removes a policy.
 func (m *MemoryManager) Delete(id string) error {
 	m.Lock()
-	defer m.Unlock()
+	defer m.unlock()
+
+	if _, found := m.Policies[id]; !found {
+		return nil
+	}
+
 	delete(m.Policies, id)
+	return m.record(id, nil)
+}
+
+// Disable switches the policy off without deleting it.
+func (m *MemoryManager) Disable(id string) error {
+	return m.setActive(id, false)
+}
+
+// Enable switches a disabled policy back on.
+func (m *MemoryManager) Enable(id string) error {
+	return m.setActive(id, true)
+}
+
+// setActive replaces the policy with a toggled copy, because the stored policy may be evaluated concurrently or
+// be held by callers of Get. Only policies of type DefaultPolicy can be disabled.
+func (m *MemoryManager) setActive(id string, active bool) error {
+	m.Lock()
+	defer m.unlock()
+
+	p, ok := m.Policies[id]
+	if !ok {
+		return errors.WithStack(ErrNotFound)
+	} else if PolicyActive(p) == active {
+		return nil
+	}
+
+	dp, ok := p.(*DefaultPolicy)
+	if !ok {
+		return errors.Errorf("Policy %s of type %T can not be disabled", id, p)
+	}
+
+	toggled := *dp
+	toggled.Disabled = !active
+	toggled.Version++
+	if err := m.record(id, &toggled); err != nil {
+		return err
+	}
+
+	m.Policies[id] = &toggled
 	return nil
 }
 
-func (m *MemoryManager) findAllPolicies() (Policies, error) {
-	m.RLock()
-	defer m.RUnlock()
-	ps := make(Policies, len(m.Policies))
-	var count int
-	for _, p := range m.Policies {
-		ps[count] = p
-		count++
+// DeleteAll removes the policies with the given IDs. IDs of missing policies are ignored.
+func (m *MemoryManager) DeleteAll(ids []string) error {
+	m.Lock()
+	defer m.unlock()
+
+	for _, id := range ids {
+		if _, found := m.Policies[id]; !found {
+			continue
+		}
+
+		delete(m.Policies, id)
+		if err := m.record(id, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunTransaction calls fn with a copy of the manager and replaces the manager's policies with those of the copy
+// once fn returns nil. Other writes wait until fn returned.
+func (m *MemoryManager) RunTransaction(fn func(w PolicyWriter) error) error {
+	var conflicts []func()
+	if err := m.transaction(fn, &conflicts); err != nil {
+		return err
+	}
+
+	for _, warn := range conflicts {
+		warn()
+	}
+	return nil
+}
+
+// transaction runs fn on a copy of the manager and swaps in its state. Conflicts found by the copy are collected,
+// so they can be reported after the lock was released.
+func (m *MemoryManager) transaction(fn func(w PolicyWriter) error, conflicts *[]func()) error {
+	m.Lock()
+	defer m.unlock()
+
+	// The history is copied shallowly: revisions appended by the copy do not change the slices seen by m.
+	tx := &MemoryManager{
+		Policies:     make(map[string]Policy, len(m.Policies)),
+		ConflictMode: m.ConflictMode,
+		history:      make(map[string][]PolicyRevision, len(m.history)),
+	}
+	for id, p := range m.Policies {
+		tx.Policies[id] = p
+	}
+	for id, revisions := range m.history {
+		tx.history[id] = revisions
+	}
+
+	if m.OnConflict != nil {
+		tx.OnConflict = func(policy Policy, c Policies) {
+			*conflicts = append(*conflicts, func() { m.OnConflict(policy, c) })
+		}
 	}
-	return ps, nil
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	m.Policies, m.history = tx.Policies, tx.history
+	return nil
+}
+
+func (m *MemoryManager) findAllPolicies() (Policies, error) {
+	return append(Policies{}, m.policies()...), nil
 }
 
 // FindRequestCandidates returns candidates that could match the request object. It either returns
 // a set that exactly matches the request, or a superset of it. If an error occurs, it returns nil and
 // the error.
 func (m *MemoryManager) FindRequestCandidates(r *Request) (Policies, error) {
-	return m.findAllPolicies()
+	return FilterTenant(m.policies(), r.Tenant), nil
 }
 
 // FindPoliciesForSubject returns policies that could match the subject. It either returns
@@ -138,3 +467,13 @@ func (m *MemoryManager) FindPoliciesForSubject(subject string) (Policies, error)
 func (m *MemoryManager) FindPoliciesForResource(resource string) (Policies, error) {
 	return m.findAllPolicies()
 }
+
+// FindPoliciesByLabel returns the policies whose label key is set to value, ordered by ID.
+func (m *MemoryManager) FindPoliciesByLabel(key, value string) (Policies, error) {
+	return FilterLabel(m.policies(), key, value), nil
+}
+
+// Close does nothing, because the MemoryManager holds no connections and runs no background work.
+func (m *MemoryManager) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	. "github.com/ory/ladon"
+)
+
+// FindConflicts returns the stored policies which conflict with p.
+func (m *MemoryManager) FindConflicts(p Policy) (Policies, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.findConflicts(p)
+}
+
+func (m *MemoryManager) findConflicts(p Policy) (Policies, error) {
+	candidates := make(Policies, 0, len(m.Policies))
+	for _, c := range m.Policies {
+		candidates = append(candidates, c)
+	}
+	return FindConflicts(p, candidates)
+}
+
+// checkConflicts applies ConflictMode to policy. It returns the conflicts to warn about or an error if the
+// policy must be rejected. The caller must hold the lock.
+func (m *MemoryManager) checkConflicts(policy Policy) (Policies, error) {
+	if m.ConflictMode == ConflictModeOff {
+		return nil, nil
+	}
+
+	conflicts, err := m.findConflicts(policy)
+	if err != nil {
+		return nil, err
+	} else if len(conflicts) > 0 && m.ConflictMode == ConflictModeReject {
+		return nil, NewErrPolicyConflict(conflicts)
+	}
+	return conflicts, nil
+}
+
+// warn reports conflicts of a successful write to OnConflict. It must be called without holding the lock.
+func (m *MemoryManager) warn(policy Policy, conflicts Policies, err error) {
+	if err == nil && len(conflicts) > 0 && m.OnConflict != nil {
+		m.OnConflict(policy, conflicts)
+	}
+}
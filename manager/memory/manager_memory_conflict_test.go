@@ -0,0 +1,77 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func TestMemoryManagerConflicts(t *testing.T) {
+	allow := &DefaultPolicy{ID: "allow", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: AllowAccess}
+	deny := &DefaultPolicy{ID: "deny", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: DenyAccess}
+
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(allow))
+	require.NoError(t, m.Create(deny))
+
+	conflicts, err := m.FindConflicts(deny)
+	require.NoError(t, err)
+	assert.Equal(t, Policies{allow}, conflicts)
+
+	m = NewMemoryManager()
+	m.ConflictMode = ConflictModeReject
+	require.NoError(t, m.Create(allow))
+
+	err = m.Create(deny)
+	require.Error(t, err)
+	assert.Equal(t, ErrPolicyConflict.Error(), errors.Cause(err).Error())
+	assert.Equal(t, []map[string]interface{}{{"policy": "allow", "effect": AllowAccess}}, errors.Cause(err).(interface {
+		Details() []map[string]interface{}
+	}).Details())
+
+	_, err = m.Get("deny")
+	assert.Error(t, err)
+
+	var warned Policies
+	m = NewMemoryManager()
+	m.ConflictMode = ConflictModeWarn
+	m.OnConflict = func(policy Policy, conflicts Policies) {
+		// The manager must not be locked while reporting conflicts.
+		_, err := m.Get(policy.GetID())
+		require.NoError(t, err)
+		warned = conflicts
+	}
+	require.NoError(t, m.Create(allow))
+	assert.Empty(t, warned)
+
+	require.NoError(t, m.Create(deny))
+	assert.Equal(t, Policies{allow}, warned)
+
+	warned = nil
+	require.NoError(t, m.Update(&DefaultPolicy{ID: "deny", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"delete"}, Effect: DenyAccess}))
+	assert.Empty(t, warned)
+}
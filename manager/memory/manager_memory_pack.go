@@ -0,0 +1,155 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// InstallPack installs the given version of a pack. If another version of the pack is installed, its
+// policies are replaced by the given ones. Either all policies are installed, or none. Installing the
+// version which is already installed is a no-op.
+func (m *MemoryManager) InstallPack(name, version string, policies Policies) error {
+	m.Lock()
+	defer m.unlock()
+
+	installed := m.packs[name]
+	if len(installed) > 0 && installed[len(installed)-1].Version == version {
+		return nil
+	}
+
+	pack := PolicyPack{
+		Name:        name,
+		Version:     version,
+		Policies:    policies,
+		InstalledAt: time.Now().UTC(),
+	}
+
+	if err := m.replacePack(name, pack.Policies); err != nil {
+		return err
+	}
+
+	if m.packs == nil {
+		m.packs = map[string][]PolicyPack{}
+	}
+	m.packs[name] = append(installed, pack)
+	return nil
+}
+
+// RollbackPack reinstalls the version of a pack which was installed before the current one.
+func (m *MemoryManager) RollbackPack(name string) error {
+	m.Lock()
+	defer m.unlock()
+
+	installed := m.packs[name]
+	if len(installed) < 2 {
+		return errors.Errorf("Pack %s has no previous version to roll back to", name)
+	}
+
+	previous := installed[len(installed)-2]
+	if err := m.replacePack(name, previous.Policies); err != nil {
+		return err
+	}
+
+	previous.InstalledAt = time.Now().UTC()
+	installed[len(installed)-2] = previous
+	m.packs[name] = installed[:len(installed)-1]
+	return nil
+}
+
+// GetPack returns the currently installed version of a pack.
+func (m *MemoryManager) GetPack(name string) (*PolicyPack, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	installed := m.packs[name]
+	if len(installed) == 0 {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+
+	pack := installed[len(installed)-1]
+	return &pack, nil
+}
+
+// GetPacks returns the currently installed version of all packs.
+func (m *MemoryManager) GetPacks() ([]PolicyPack, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	packs := make([]PolicyPack, 0, len(m.packs))
+	for _, installed := range m.packs {
+		packs = append(packs, installed[len(installed)-1])
+	}
+
+	sort.Slice(packs, func(i, j int) bool {
+		return packs[i].Name < packs[j].Name
+	})
+	return packs, nil
+}
+
+// replacePack swaps the policies of the currently installed version of a pack with the given ones. It
+// validates everything up front so that the store is never left with a partially installed pack.
+func (m *MemoryManager) replacePack(name string, policies Policies) error {
+	owned := map[string]bool{}
+	if installed := m.packs[name]; len(installed) > 0 {
+		for _, p := range installed[len(installed)-1].Policies {
+			owned[p.GetID()] = true
+		}
+	}
+
+	next := map[string]bool{}
+	revisions := make([]PolicyRevision, len(policies))
+	for i, p := range policies {
+		if err := ValidatePolicy(p); err != nil {
+			return err
+		} else if next[p.GetID()] {
+			return errors.Errorf("Policy %s is included more than once in pack %s", p.GetID(), name)
+		} else if _, found := m.Policies[p.GetID()]; found && !owned[p.GetID()] {
+			return errors.Wrapf(ErrPolicyExists, "Policy %s is not part of pack %s", p.GetID(), name)
+		}
+		next[p.GetID()] = true
+
+		revision, err := m.revision(p.GetID(), p)
+		if err != nil {
+			return err
+		}
+		revisions[i] = revision
+	}
+
+	for id := range owned {
+		if _, found := m.Policies[id]; found && !next[id] {
+			revision, _ := m.revision(id, nil)
+			delete(m.Policies, id)
+			m.appendRevision(id, revision)
+		}
+	}
+
+	for i, p := range policies {
+		m.Policies[p.GetID()] = p
+		m.appendRevision(p.GetID(), revisions[i])
+	}
+	return nil
+}
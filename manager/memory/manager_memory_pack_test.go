@@ -0,0 +1,105 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func TestMemoryManagerPacks(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "standalone", Effect: AllowAccess}))
+
+	v1 := Policies{
+		&DefaultPolicy{ID: "baseline-1", Effect: AllowAccess},
+		&DefaultPolicy{ID: "baseline-2", Effect: DenyAccess},
+	}
+	v2 := Policies{
+		&DefaultPolicy{ID: "baseline-2", Effect: AllowAccess},
+		&DefaultPolicy{ID: "baseline-3", Effect: AllowAccess},
+	}
+
+	assertPolicies := func(t *testing.T, expected ...string) {
+		ps, err := m.GetAll(100, 0)
+		require.NoError(t, err)
+		ids := make([]string, len(ps))
+		for i, p := range ps {
+			ids[i] = p.GetID()
+		}
+		assert.Equal(t, expected, ids)
+	}
+
+	require.NoError(t, m.InstallPack("baseline", "1.0.0", v1))
+	assertPolicies(t, "baseline-1", "baseline-2", "standalone")
+
+	pack, err := m.GetPack("baseline")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", pack.Version)
+
+	require.NoError(t, m.InstallPack("baseline", "1.0.0", v2), "installing the same version is a no-op")
+	assertPolicies(t, "baseline-1", "baseline-2", "standalone")
+
+	require.NoError(t, m.InstallPack("baseline", "2.0.0", v2))
+	assertPolicies(t, "baseline-2", "baseline-3", "standalone")
+	p, err := m.Get("baseline-2")
+	require.NoError(t, err)
+	assert.Equal(t, AllowAccess, p.GetEffect())
+
+	t.Run("case=conflicts leave the store untouched", func(t *testing.T) {
+		err := m.InstallPack("baseline", "3.0.0", Policies{
+			&DefaultPolicy{ID: "baseline-4", Effect: AllowAccess},
+			&DefaultPolicy{ID: "standalone", Effect: AllowAccess},
+		})
+		require.Error(t, err)
+
+		err = m.InstallPack("other", "1.0.0", Policies{
+			&DefaultPolicy{ID: "other-1", Effect: AllowAccess},
+			&DefaultPolicy{ID: "other-1", Effect: AllowAccess},
+		})
+		require.Error(t, err)
+
+		assertPolicies(t, "baseline-2", "baseline-3", "standalone")
+		pack, err := m.GetPack("baseline")
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", pack.Version)
+		_, err = m.GetPack("other")
+		assert.Error(t, err)
+	})
+
+	require.NoError(t, m.RollbackPack("baseline"))
+	assertPolicies(t, "baseline-1", "baseline-2", "standalone")
+	p, err = m.Get("baseline-2")
+	require.NoError(t, err)
+	assert.Equal(t, DenyAccess, p.GetEffect())
+
+	packs, err := m.GetPacks()
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+	assert.Equal(t, "1.0.0", packs[0].Version)
+
+	assert.Error(t, m.RollbackPack("baseline"))
+	assert.Error(t, m.RollbackPack("unknown"))
+}
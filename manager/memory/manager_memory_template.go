@@ -0,0 +1,101 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// CreateTemplate persists the template.
+func (m *MemoryManager) CreateTemplate(t *PolicyTemplate) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, found := m.templates[t.ID]; found {
+		return errors.Wrapf(ErrPolicyExists, "Policy template %s exists already", t.ID)
+	}
+
+	if m.templates == nil {
+		m.templates = map[string]*PolicyTemplate{}
+	}
+	m.templates[t.ID] = t
+	return nil
+}
+
+// UpdateTemplate updates an existing template. Instances are not updated, see RegenerateInstances.
+func (m *MemoryManager) UpdateTemplate(t *PolicyTemplate) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, found := m.templates[t.ID]; !found {
+		return errors.WithStack(ErrNotFound)
+	}
+	m.templates[t.ID] = t
+	return nil
+}
+
+// GetTemplate retrieves a template.
+func (m *MemoryManager) GetTemplate(id string) (*PolicyTemplate, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	t, found := m.templates[id]
+	if !found {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return t, nil
+}
+
+// DeleteTemplate removes a template. Instances are kept.
+func (m *MemoryManager) DeleteTemplate(id string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.templates, id)
+	return nil
+}
+
+// GetTemplates retrieves all templates, ordered by ID.
+func (m *MemoryManager) GetTemplates() ([]*PolicyTemplate, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	templates := make([]*PolicyTemplate, 0, len(m.templates))
+	for _, t := range m.templates {
+		templates = append(templates, t)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].ID < templates[j].ID
+	})
+	return templates, nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func TestMemoryManagerTemplates(t *testing.T) {
+	var _ TemplateManager = new(MemoryManager)
+
+	m := NewMemoryManager()
+	tpl := &PolicyTemplate{ID: "project-editor", Subjects: []string{"{{.Team}}"}, Effect: AllowAccess}
+	require.NoError(t, m.CreateTemplate(tpl))
+	assert.Equal(t, ErrPolicyExists, errors.Cause(m.CreateTemplate(tpl)))
+	assert.Error(t, m.CreateTemplate(&PolicyTemplate{ID: "broken", Subjects: []string{"{{.Team"}}))
+	assert.Equal(t, ErrNotFound, errors.Cause(m.UpdateTemplate(&PolicyTemplate{ID: "unknown"})))
+
+	require.NoError(t, m.CreateTemplate(&PolicyTemplate{ID: "auditor"}))
+	require.NoError(t, m.UpdateTemplate(&PolicyTemplate{ID: "auditor", Description: "Read-only access"}))
+
+	got, err := m.GetTemplate("auditor")
+	require.NoError(t, err)
+	assert.Equal(t, "Read-only access", got.Description)
+
+	templates, err := m.GetTemplates()
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "auditor", templates[0].ID)
+	assert.Equal(t, "project-editor", templates[1].ID)
+
+	require.NoError(t, m.DeleteTemplate("auditor"))
+	_, err = m.GetTemplate("auditor")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func TestMemoryManagerVersioning(t *testing.T) {
+	m := NewMemoryManager()
+
+	p := &DefaultPolicy{ID: "1", Effect: AllowAccess}
+	require.NoError(t, m.Create(p))
+	assert.Equal(t, 1, p.Version)
+
+	p.Description = "first"
+	require.NoError(t, m.Update(p))
+	assert.Equal(t, 2, p.Version)
+
+	stale := &DefaultPolicy{ID: "1", Effect: DenyAccess, Version: 1}
+	assert.Equal(t, ErrVersionConflict, errors.Cause(m.Update(stale)))
+
+	current := &DefaultPolicy{ID: "1", Effect: DenyAccess, Version: 2}
+	require.NoError(t, m.Update(current))
+	assert.Equal(t, 3, current.Version)
+
+	unversioned := &DefaultPolicy{ID: "1", Effect: AllowAccess}
+	require.NoError(t, m.Update(unversioned))
+	assert.Equal(t, 4, unversioned.Version)
+
+	require.NoError(t, m.Delete("1"))
+
+	history, err := m.GetHistory("1")
+	require.NoError(t, err)
+	require.Len(t, history, 5)
+
+	for k, expected := range []struct {
+		version int
+		effect  string
+	}{
+		{version: 1, effect: AllowAccess},
+		{version: 2, effect: AllowAccess},
+		{version: 3, effect: DenyAccess},
+		{version: 4, effect: AllowAccess},
+	} {
+		assert.Equal(t, expected.version, history[k].Version)
+		assert.Equal(t, expected.effect, history[k].Policy.GetEffect())
+	}
+	assert.Equal(t, "first", history[1].Policy.GetDescription())
+	assert.Nil(t, history[4].Policy)
+	assert.Equal(t, 4, history[4].Version)
+
+	_, err = m.GetHistory("2")
+	assert.Error(t, err)
+}
+
+func TestMemoryManagerDisable(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, Effect: AllowAccess}))
+
+	warden := &Ladon{Manager: m}
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1"}
+	require.NoError(t, warden.IsAllowed(r))
+
+	before, err := m.Get("1")
+	require.NoError(t, err)
+	require.NoError(t, DisablePolicy(m, "1"))
+	assert.True(t, PolicyActive(before), "policies handed out before are not modified")
+	assert.Equal(t, ErrRequestDenied, errors.Cause(warden.IsAllowed(r)), "disabled policies do not apply")
+
+	p, err := m.Get("1")
+	require.NoError(t, err, "disabled policies are kept")
+	assert.False(t, PolicyActive(p))
+	assert.Equal(t, 2, p.(*DefaultPolicy).Version)
+
+	require.NoError(t, EnablePolicy(m, "1"))
+	require.NoError(t, warden.IsAllowed(r))
+
+	history, err := m.GetHistory("1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.False(t, PolicyActive(history[1].Policy))
+	assert.True(t, PolicyActive(history[2].Policy))
+
+	assert.Equal(t, ErrNotFound, errors.Cause(m.Disable("2")))
+}
+
+func TestMemoryManagerBulk(t *testing.T) {
+	m := NewMemoryManager()
+	m.ConflictMode = ConflictModeReject
+
+	err := m.CreateAll(Policies{
+		&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: AllowAccess},
+		&DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: DenyAccess},
+	})
+	assert.Equal(t, ErrPolicyConflict.Error(), errors.Cause(err).Error(), "policies of a batch are checked against each other")
+	assert.Empty(t, m.Policies, "failed bulk writes are rolled back")
+
+	require.NoError(t, m.CreateAll(Policies{
+		&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: AllowAccess},
+		&DefaultPolicy{ID: "2", Subjects: []string{"ken"}, Effect: AllowAccess},
+	}))
+	assert.Len(t, m.Policies, 2)
+	assert.Equal(t, ErrPolicyExists, errors.Cause(m.CreateAll(Policies{&DefaultPolicy{ID: "2", Effect: AllowAccess}})))
+
+	require.NoError(t, m.DeleteAll([]string{"1", "2", "3"}))
+	assert.Empty(t, m.Policies)
+
+	history, err := m.GetHistory("1")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestMemoryManagerTransaction(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: AllowAccess, Tenant: "acme"}))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "2", Subjects: []string{"ken"}, Effect: AllowAccess, Tenant: "acme"}))
+
+	replace := func(w PolicyWriter) error {
+		for _, id := range []string{"1", "2"} {
+			if err := w.Delete(id); err != nil {
+				return err
+			}
+		}
+		return w.Create(&DefaultPolicy{ID: "3", Subjects: []string{"max"}, Effect: AllowAccess, Tenant: "acme"})
+	}
+
+	err := m.RunTransaction(func(w PolicyWriter) error {
+		if err := replace(w); err != nil {
+			return err
+		}
+
+		_, err := w.Get("1")
+		assert.Equal(t, ErrNotFound, errors.Cause(err), "the writer sees its own writes")
+		return w.Create(&DefaultPolicy{ID: "3", Effect: AllowAccess})
+	})
+	assert.Equal(t, ErrPolicyExists, errors.Cause(err))
+	assert.Len(t, m.Policies, 2, "failed transactions are discarded")
+	assert.Contains(t, m.Policies, "1")
+
+	history, err := m.GetHistory("1")
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	require.NoError(t, m.RunTransaction(replace))
+	assert.Len(t, m.Policies, 1)
+	assert.Contains(t, m.Policies, "3")
+
+	history, err = m.GetHistory("1")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestMemoryManagerSnapshot(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Effect: AllowAccess}))
+
+	all, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "1", all[0].GetID())
+
+	all[0] = nil
+	p, err := m.Get("1")
+	require.NoError(t, err, "callers can not change the snapshot")
+	assert.NotNil(t, p)
+
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "3", Effect: AllowAccess}))
+	require.NoError(t, m.Delete("1"))
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count, "writes discard the snapshot")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					assert.NoError(t, m.Update(&DefaultPolicy{ID: fmt.Sprintf("w%d", i), Effect: AllowAccess}))
+				} else if _, err := m.FindRequestCandidates(&Request{}); err != nil {
+					assert.NoError(t, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count, err = m.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, count)
+}
+
+func benchmarkMemoryManager(b *testing.B, writeEvery int) {
+	m := NewMemoryManager()
+	for i := 0; i < 1000; i++ {
+		require.NoError(b, m.Create(&DefaultPolicy{ID: fmt.Sprintf("%d", i), Subjects: []string{"peter"}, Effect: AllowAccess}))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			i++
+			if writeEvery > 0 && i%writeEvery == 0 {
+				if err := m.Update(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: AllowAccess}); err != nil {
+					b.Fatal(err)
+				}
+			} else if _, err := m.FindRequestCandidates(&Request{Subject: "peter"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryManagerReads(b *testing.B) {
+	benchmarkMemoryManager(b, 0)
+}
+
+func BenchmarkMemoryManagerMixed(b *testing.B) {
+	benchmarkMemoryManager(b, 1000)
+}
+
+func BenchmarkMemoryManagerWriteHeavy(b *testing.B) {
+	benchmarkMemoryManager(b, 10)
+}
+
+func BenchmarkMemoryManagerGet(b *testing.B) {
+	m := NewMemoryManager()
+	for i := 0; i < 1000; i++ {
+		require.NoError(b, m.Create(&DefaultPolicy{ID: fmt.Sprintf("%d", i), Effect: AllowAccess}))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := m.Get("500"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,456 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package spanner provides a Manager storing policies in Google Cloud Spanner, for deployments which need policies
+// to be globally consistent across regions.
+//
+// Policies are stored in the ladon_policies table. Their subjects, resources and actions are stored in tables
+// interleaved in it, so a policy and its templates are stored together and deleted together. Literal subjects and
+// resources are indexed, so candidate lookups read policies containing the value verbatim and policies flagged
+// with patterns. Create the tables with the statements of Schema.
+package spanner
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+)
+
+// Schema contains the DDL statements creating the tables and indexes used by SpannerManager.
+var Schema = []string{
+	`CREATE TABLE ladon_policies (
+	id STRING(MAX) NOT NULL,
+	policy STRING(MAX) NOT NULL,
+	version INT64 NOT NULL,
+	tenant STRING(MAX) NOT NULL,
+	subject_pattern BOOL NOT NULL,
+	resource_pattern BOOL NOT NULL,
+) PRIMARY KEY (id)`,
+	`CREATE INDEX ladon_policies_by_subject_pattern ON ladon_policies (tenant, subject_pattern)`,
+	`CREATE TABLE ladon_policy_subjects (
+	id STRING(MAX) NOT NULL,
+	subject STRING(MAX) NOT NULL,
+	pattern BOOL NOT NULL,
+) PRIMARY KEY (id, subject), INTERLEAVE IN PARENT ladon_policies ON DELETE CASCADE`,
+	`CREATE INDEX ladon_policy_subjects_by_subject ON ladon_policy_subjects (subject)`,
+	`CREATE TABLE ladon_policy_resources (
+	id STRING(MAX) NOT NULL,
+	resource STRING(MAX) NOT NULL,
+	pattern BOOL NOT NULL,
+) PRIMARY KEY (id, resource), INTERLEAVE IN PARENT ladon_policies ON DELETE CASCADE`,
+	`CREATE INDEX ladon_policy_resources_by_resource ON ladon_policy_resources (resource)`,
+	`CREATE TABLE ladon_policy_actions (
+	id STRING(MAX) NOT NULL,
+	action STRING(MAX) NOT NULL,
+	pattern BOOL NOT NULL,
+) PRIMARY KEY (id, action), INTERLEAVE IN PARENT ladon_policies ON DELETE CASCADE`,
+}
+
+// Tables written by SpannerManager.
+const (
+	TablePolicies  = "ladon_policies"
+	TableSubjects  = "ladon_policy_subjects"
+	TableResources = "ladon_policy_resources"
+	TableActions   = "ladon_policy_actions"
+)
+
+// Statements run by SpannerManager. All of them return the id, policy and version columns.
+const (
+	queryID         = "SELECT id, policy, version FROM ladon_policies WHERE id = @id"
+	queryIDs        = "SELECT id, policy, version FROM ladon_policies WHERE id IN UNNEST(@ids)"
+	queryAll        = "SELECT id, policy, version FROM ladon_policies ORDER BY id LIMIT @limit OFFSET @offset"
+	queryCandidates = "SELECT p.id, p.policy, p.version FROM ladon_policy_subjects@{FORCE_INDEX=ladon_policy_subjects_by_subject} s JOIN ladon_policies p ON p.id = s.id WHERE s.subject = @value AND NOT s.pattern AND p.tenant = @tenant " +
+		"UNION DISTINCT SELECT id, policy, version FROM ladon_policies@{FORCE_INDEX=ladon_policies_by_subject_pattern} WHERE tenant = @tenant AND subject_pattern"
+	querySubject = "SELECT p.id, p.policy, p.version FROM ladon_policy_subjects@{FORCE_INDEX=ladon_policy_subjects_by_subject} s JOIN ladon_policies p ON p.id = s.id WHERE s.subject = @value AND NOT s.pattern " +
+		"UNION DISTINCT SELECT id, policy, version FROM ladon_policies WHERE subject_pattern"
+	queryResource = "SELECT p.id, p.policy, p.version FROM ladon_policy_resources@{FORCE_INDEX=ladon_policy_resources_by_resource} r JOIN ladon_policies p ON p.id = r.id WHERE r.resource = @value AND NOT r.pattern " +
+		"UNION DISTINCT SELECT id, policy, version FROM ladon_policies WHERE resource_pattern"
+	queryPing = "SELECT id, policy, version FROM ladon_policies LIMIT 1"
+)
+
+// Statement is a SQL statement with named parameters, like spanner.Statement.
+type Statement struct {
+	SQL    string
+	Params map[string]interface{}
+}
+
+// Row is a row returned by the statements of SpannerManager.
+type Row struct {
+	ID      string
+	Policy  string
+	Version int64
+}
+
+// MutationOp is the operation of a Mutation.
+type MutationOp int
+
+const (
+	// MutationInsert inserts a row, like spanner.Insert.
+	MutationInsert MutationOp = iota
+
+	// MutationUpdate updates an existing row, like spanner.Update.
+	MutationUpdate
+
+	// MutationDelete removes all rows of Table whose primary key starts with Key, like
+	// spanner.Delete(Table, spanner.Key{Key}.AsPrefix()). Deleting a policy deletes its interleaved rows as well.
+	MutationDelete
+)
+
+// Mutation is a write buffered until a transaction commits.
+type Mutation struct {
+	Op      MutationOp
+	Table   string
+	Columns []string
+	Values  []interface{}
+	Key     string
+}
+
+// TimestampBound chooses the timestamp of read-only queries. Use StrongRead, ExactStaleness or MaxStaleness to
+// construct it.
+type TimestampBound struct {
+	// Staleness is zero for strong reads.
+	Staleness time.Duration
+
+	// Bounded is true if Spanner may pick any timestamp within Staleness, like spanner.MaxStaleness. Otherwise
+	// the read happens exactly Staleness ago, like spanner.ExactStaleness.
+	Bounded bool
+}
+
+// StrongRead returns a bound which reads the latest data, like spanner.StrongRead.
+func StrongRead() TimestampBound {
+	return TimestampBound{}
+}
+
+// ExactStaleness returns a bound which reads the data as it was d ago, like spanner.ExactStaleness.
+func ExactStaleness(d time.Duration) TimestampBound {
+	return TimestampBound{Staleness: d}
+}
+
+// MaxStaleness returns a bound which reads data at most d old, like spanner.MaxStaleness.
+func MaxStaleness(d time.Duration) TimestampBound {
+	return TimestampBound{Staleness: d, Bounded: true}
+}
+
+// Client is the contract SpannerManager requires from Spanner. It maps to a *spanner.Client: Query runs the
+// statement in client.Single().WithTimestampBound(bound), Apply maps to client.Apply and ReadWriteTransaction to
+// client.ReadWriteTransaction, which retries aborted transactions.
+type Client interface {
+	// Query runs stmt in a single-use read-only transaction with the given timestamp bound.
+	Query(ctx context.Context, bound TimestampBound, stmt Statement) ([]Row, error)
+
+	// Apply applies all mutations atomically.
+	Apply(ctx context.Context, ms []*Mutation) error
+
+	// ReadWriteTransaction runs fn in a read-write transaction, which commits the buffered mutations if fn
+	// returns nil.
+	ReadWriteTransaction(ctx context.Context, fn func(ctx context.Context, tx Transaction) error) error
+}
+
+// Transaction is a Spanner read-write transaction.
+type Transaction interface {
+	// Query runs stmt within the transaction.
+	Query(ctx context.Context, stmt Statement) ([]Row, error)
+
+	// BufferWrite buffers mutations, which are applied when the transaction commits.
+	BufferWrite(ms []*Mutation) error
+}
+
+// SpannerManager is a Manager storing policies in Spanner. Use NewSpannerManager to construct it.
+type SpannerManager struct {
+	Client  Client
+	Timeout time.Duration
+
+	// CandidateBound is the timestamp bound of FindRequestCandidates, FindPoliciesForSubject and
+	// FindPoliciesForResource. It defaults to a strong read. Stale reads can be served by the nearest replica
+	// without a round trip to the leader, at the cost of seeing changes to policies late.
+	CandidateBound TimestampBound
+}
+
+// NewSpannerManager initializes a new SpannerManager.
+func NewSpannerManager(client Client) *SpannerManager {
+	return &SpannerManager{
+		Client:         client,
+		Timeout:        time.Second * 5,
+		CandidateBound: StrongRead(),
+	}
+}
+
+func (m *SpannerManager) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), m.Timeout)
+}
+
+// insert returns the mutations inserting p and its subjects, resources and actions.
+func insert(p Policy) ([]*Mutation, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var version int64
+	if v, ok := p.(VersionedPolicy); ok {
+		version = int64(v.GetVersion())
+	}
+
+	id := p.GetID()
+	var ms []*Mutation
+	children := func(table, column string, templates []string) (patterns bool) {
+		seen := map[string]bool{}
+		for _, t := range templates {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+
+			pattern := !IsLiteralTemplate(p, t)
+			patterns = patterns || pattern
+			ms = append(ms, &Mutation{Op: MutationInsert, Table: table, Columns: []string{"id", column, "pattern"}, Values: []interface{}{id, t, pattern}})
+		}
+		return patterns
+	}
+	subjectPattern := children(TableSubjects, "subject", p.GetSubjects())
+	resourcePattern := children(TableResources, "resource", p.GetResources())
+	children(TableActions, "action", p.GetActions())
+
+	return append([]*Mutation{{
+		Op:      MutationInsert,
+		Table:   TablePolicies,
+		Columns: []string{"id", "policy", "version", "tenant", "subject_pattern", "resource_pattern"},
+		Values:  []interface{}{id, string(payload), version, PolicyTenant(p), subjectPattern, resourcePattern},
+	}}, ms...), nil
+}
+
+// replace returns the mutations replacing the stored policy with p.
+func replace(p Policy) ([]*Mutation, error) {
+	ms, err := insert(p)
+	if err != nil {
+		return nil, err
+	}
+
+	ms[0].Op = MutationUpdate
+	id := p.GetID()
+	return append([]*Mutation{
+		ms[0],
+		{Op: MutationDelete, Table: TableSubjects, Key: id},
+		{Op: MutationDelete, Table: TableResources, Key: id},
+		{Op: MutationDelete, Table: TableActions, Key: id},
+	}, ms[1:]...), nil
+}
+
+// prepare assigns an ID and the first version to a policy which is about to be created.
+func prepare(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok && v.GetVersion() == 0 {
+		v.SetVersion(1)
+	}
+	return nil
+}
+
+// Create persists the policy.
+func (m *SpannerManager) Create(policy Policy) error {
+	return m.CreateAll(Policies{policy})
+}
+
+// CreateAll persists all policies in a single transaction. Spanner limits the number of mutations of a
+// transaction, and each policy takes one mutation per subject, resource and action plus one, so very large sets of
+// policies must be split.
+func (m *SpannerManager) CreateAll(policies Policies) error {
+	var ms []*Mutation
+	ids := make([]string, len(policies))
+	for k, p := range policies {
+		if err := prepare(p); err != nil {
+			return err
+		}
+
+		inserts, err := insert(p)
+		if err != nil {
+			return err
+		}
+		ms = append(ms, inserts...)
+		ids[k] = p.GetID()
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	return m.Client.ReadWriteTransaction(ctx, func(ctx context.Context, tx Transaction) error {
+		rows, err := tx.Query(ctx, Statement{SQL: queryIDs, Params: map[string]interface{}{"ids": ids}})
+		if err != nil {
+			return errors.WithStack(err)
+		} else if len(rows) > 0 {
+			return errors.Wrapf(ErrPolicyExists, "Could not create policy %s", rows[0].ID)
+		}
+		return errors.WithStack(tx.BufferWrite(ms))
+	})
+}
+
+// Update updates an existing policy. If the policy implements VersionedPolicy and carries a version other
+// than zero, the update fails with ErrVersionConflict unless the version equals the stored one.
+func (m *SpannerManager) Update(policy Policy) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	ctx, cancel := m.context()
+	defer cancel()
+
+	v, versioned := policy.(VersionedPolicy)
+	var requested int
+	if versioned {
+		requested = v.GetVersion()
+	}
+
+	err := m.Client.ReadWriteTransaction(ctx, func(ctx context.Context, tx Transaction) error {
+		rows, err := tx.Query(ctx, Statement{SQL: queryID, Params: map[string]interface{}{"id": policy.GetID()}})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if versioned {
+			var current int
+			if len(rows) > 0 {
+				current = int(rows[0].Version)
+			}
+
+			if requested != 0 && requested != current {
+				return errors.WithStack(ErrVersionConflict)
+			}
+			v.SetVersion(current + 1)
+		}
+
+		write := replace
+		if len(rows) == 0 {
+			write = insert
+		}
+
+		ms, err := write(policy)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(tx.BufferWrite(ms))
+	})
+
+	// Transactions may be retried, so the version is only left changed if the update went through.
+	if err != nil && versioned {
+		v.SetVersion(requested)
+	}
+	return err
+}
+
+// Get retrieves a policy.
+func (m *SpannerManager) Get(id string) (Policy, error) {
+	ps, err := m.query(StrongRead(), queryID, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, err
+	} else if len(ps) == 0 {
+		return nil, errors.WithStack(ErrNotFound)
+	}
+	return ps[0], nil
+}
+
+// Delete removes a policy.
+func (m *SpannerManager) Delete(id string) error {
+	return m.DeleteAll([]string{id})
+}
+
+// DeleteAll removes the policies with the given IDs atomically. Their subjects, resources and actions are removed
+// by Spanner.
+func (m *SpannerManager) DeleteAll(ids []string) error {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	ms := make([]*Mutation, len(ids))
+	for k, id := range ids {
+		ms[k] = &Mutation{Op: MutationDelete, Table: TablePolicies, Key: id}
+	}
+	return errors.WithStack(m.Client.Apply(ctx, ms))
+}
+
+// GetAll returns all policies, ordered by ID.
+func (m *SpannerManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.query(StrongRead(), queryAll, map[string]interface{}{"limit": limit, "offset": offset})
+}
+
+// IndexesLiterals returns true, because subjects and resources are looked up verbatim.
+func (m *SpannerManager) IndexesLiterals() bool {
+	return true
+}
+
+// FindRequestCandidates returns the policies of the request's tenant whose subjects could match the request's
+// subject. It reads with CandidateBound.
+func (m *SpannerManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.query(m.CandidateBound, queryCandidates, map[string]interface{}{"tenant": r.Tenant, "value": r.Subject})
+}
+
+// FindPoliciesForSubject returns the policies containing the subject verbatim and all policies with at least
+// one subject pattern. It reads with CandidateBound.
+func (m *SpannerManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.query(m.CandidateBound, querySubject, map[string]interface{}{"value": subject})
+}
+
+// FindPoliciesForResource returns the policies containing the resource verbatim and all policies with at least
+// one resource pattern. It reads with CandidateBound.
+func (m *SpannerManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.query(m.CandidateBound, queryResource, map[string]interface{}{"value": resource})
+}
+
+func (m *SpannerManager) query(bound TimestampBound, sql string, params map[string]interface{}) (Policies, error) {
+	ctx, cancel := m.context()
+	defer cancel()
+
+	rows, err := m.Client.Query(ctx, bound, Statement{SQL: sql, Params: params})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ps := make(Policies, len(rows))
+	for k, row := range rows {
+		var p DefaultPolicy
+		if err := json.Unmarshal([]byte(row.Policy), &p); err != nil {
+			return nil, errors.Wrapf(err, "Could not decode policy %s", row.ID)
+		}
+		ps[k] = &p
+	}
+	return ps, nil
+}
+
+// Ping reads a single policy, which fails if Spanner is unreachable. It is limited by Timeout.
+func (m *SpannerManager) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.Client.Query(ctx, StrongRead(), Statement{SQL: queryPing})
+	return errors.WithStack(err)
+}
+
+// Close does nothing. The Client is not closed, because it is owned by the caller.
+func (m *SpannerManager) Close(ctx context.Context) error {
+	return nil
+}
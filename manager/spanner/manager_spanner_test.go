@@ -0,0 +1,322 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+)
+
+// table maps the primary key of rows, whose parts are joined by a zero byte, to their columns.
+type table map[string]map[string]interface{}
+
+// fakeClient is an in-memory database which evaluates the statements of SpannerManager. Transactions work on a
+// copy, which is discarded if fn fails.
+type fakeClient struct {
+	sync.Mutex
+	tables map[string]table
+	bounds []TimestampBound
+	writes int
+}
+
+type fakeTransaction struct {
+	tables map[string]table
+	ms     []*Mutation
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{tables: map[string]table{TablePolicies: {}, TableSubjects: {}, TableResources: {}, TableActions: {}}}
+}
+
+func (c *fakeClient) Query(ctx context.Context, bound TimestampBound, stmt Statement) ([]Row, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.bounds = append(c.bounds, bound)
+	return query(c.tables, stmt)
+}
+
+func (c *fakeClient) Apply(ctx context.Context, ms []*Mutation) error {
+	return c.ReadWriteTransaction(ctx, func(ctx context.Context, tx Transaction) error {
+		return tx.BufferWrite(ms)
+	})
+}
+
+func (c *fakeClient) ReadWriteTransaction(ctx context.Context, fn func(context.Context, Transaction) error) error {
+	c.Lock()
+	defer c.Unlock()
+
+	tx := &fakeTransaction{tables: c.tables}
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	tables := map[string]table{}
+	for name, rows := range c.tables {
+		tables[name] = table{}
+		for key, row := range rows {
+			tables[name][key] = row
+		}
+	}
+
+	for _, m := range tx.ms {
+		if err := apply(tables, m); err != nil {
+			return err
+		}
+	}
+	c.tables = tables
+	c.writes++
+	return nil
+}
+
+func (tx *fakeTransaction) Query(ctx context.Context, stmt Statement) ([]Row, error) {
+	return query(tx.tables, stmt)
+}
+
+func (tx *fakeTransaction) BufferWrite(ms []*Mutation) error {
+	tx.ms = append(tx.ms, ms...)
+	return nil
+}
+
+func apply(tables map[string]table, m *Mutation) error {
+	if m.Op == MutationDelete {
+		names := []string{m.Table}
+		if m.Table == TablePolicies {
+			names = append(names, TableSubjects, TableResources, TableActions)
+		}
+		for _, name := range names {
+			for key := range tables[name] {
+				if key == m.Key || strings.HasPrefix(key, m.Key+"\x00") {
+					delete(tables[name], key)
+				}
+			}
+		}
+		return nil
+	}
+
+	row := map[string]interface{}{}
+	for k, column := range m.Columns {
+		row[column] = m.Values[k]
+	}
+
+	key := row["id"].(string)
+	if m.Table != TablePolicies {
+		key += "\x00" + fmt.Sprint(m.Values[1])
+		if _, ok := tables[TablePolicies][row["id"].(string)]; !ok {
+			return errors.Errorf("NotFound: parent row of %s is missing", key)
+		}
+	}
+
+	_, exists := tables[m.Table][key]
+	if m.Op == MutationInsert && exists {
+		return errors.Errorf("AlreadyExists: row %s of %s", key, m.Table)
+	} else if m.Op == MutationUpdate && !exists {
+		return errors.Errorf("NotFound: row %s of %s", key, m.Table)
+	}
+	tables[m.Table][key] = row
+	return nil
+}
+
+// literal returns the IDs of policies whose child rows in name contain value verbatim.
+func literal(tables map[string]table, name, column string, value interface{}) map[string]bool {
+	ids := map[string]bool{}
+	for _, row := range tables[name] {
+		if row[column] == value && !row["pattern"].(bool) {
+			ids[row["id"].(string)] = true
+		}
+	}
+	return ids
+}
+
+func query(tables map[string]table, stmt Statement) ([]Row, error) {
+	var ids map[string]bool
+	switch stmt.SQL {
+	case queryID:
+		ids = map[string]bool{stmt.Params["id"].(string): true}
+	case queryIDs:
+		ids = map[string]bool{}
+		for _, id := range stmt.Params["ids"].([]string) {
+			ids[id] = true
+		}
+	case queryCandidates, querySubject:
+		ids = literal(tables, TableSubjects, "subject", stmt.Params["value"])
+		for id, row := range tables[TablePolicies] {
+			if row["subject_pattern"].(bool) {
+				ids[id] = true
+			}
+		}
+		if stmt.SQL == queryCandidates {
+			for id := range ids {
+				if row, ok := tables[TablePolicies][id]; !ok || row["tenant"] != stmt.Params["tenant"] {
+					delete(ids, id)
+				}
+			}
+		}
+	case queryResource:
+		ids = literal(tables, TableResources, "resource", stmt.Params["value"])
+		for id, row := range tables[TablePolicies] {
+			if row["resource_pattern"].(bool) {
+				ids[id] = true
+			}
+		}
+	case queryAll, queryPing:
+		ids = map[string]bool{}
+		for id := range tables[TablePolicies] {
+			ids[id] = true
+		}
+	default:
+		return nil, errors.Errorf("InvalidArgument: unexpected statement %s", stmt.SQL)
+	}
+
+	var rows []Row
+	for id := range ids {
+		if row, ok := tables[TablePolicies][id]; ok {
+			rows = append(rows, Row{ID: id, Policy: row["policy"].(string), Version: row["version"].(int64)})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	if stmt.SQL == queryAll {
+		offset, limit := int(stmt.Params["offset"].(int64)), int(stmt.Params["limit"].(int64))
+		if offset > len(rows) {
+			offset = len(rows)
+		}
+		rows = rows[offset:]
+		if limit < len(rows) {
+			rows = rows[:limit]
+		}
+	} else if stmt.SQL == queryPing && len(rows) > 1 {
+		rows = rows[:1]
+	}
+	return rows, nil
+}
+
+func ids(t *testing.T, ps ladon.Policies, err error) []string {
+	require.NoError(t, err)
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.GetID())
+	}
+	sort.Strings(out)
+	return out
+}
+
+var policies = []*ladon.DefaultPolicy{
+	{ID: "1", Subjects: []string{"peter", "max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess},
+	{ID: "2", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: ladon.DenyAccess},
+	{ID: "3", Subjects: []string{"ken"}, Resources: []string{"users:1"}, Actions: []string{"get", "update"}, Effect: ladon.AllowAccess, Tenant: "acme"},
+	{ID: "4", Subjects: []string{"team:*"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess, MatchMode: ladon.MatchModeGlob},
+}
+
+func TestSpannerManager(t *testing.T) {
+	c := newFakeClient()
+	m := NewSpannerManager(c)
+	for _, p := range policies {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(m.Create(&ladon.DefaultPolicy{ID: "1", Effect: ladon.AllowAccess})))
+	_, err := m.Get("5")
+	assert.Equal(t, ladon.ErrNotFound, errors.Cause(err))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter", "max"}, got.GetSubjects())
+
+	assert.Equal(t, true, c.tables[TablePolicies]["2"]["subject_pattern"])
+	assert.Equal(t, int64(1), c.tables[TablePolicies]["2"]["version"])
+	assert.Contains(t, c.tables[TableActions], "3\x00update")
+	assert.Equal(t, true, c.tables[TableSubjects]["4\x00team:*"]["pattern"])
+
+	ps, err := m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"1", "2", "4"}, ids(t, ps, err))
+	ps, err = m.FindPoliciesForResource("users:1")
+	assert.Equal(t, []string{"2", "3", "4"}, ids(t, ps, err))
+	ps, err = m.FindRequestCandidates(&ladon.Request{Subject: "ken", Tenant: "acme"})
+	assert.Equal(t, []string{"3"}, ids(t, ps, err))
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "1", Subjects: []string{"max"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: ladon.AllowAccess}))
+	ps, err = m.FindPoliciesForSubject("peter")
+	assert.Equal(t, []string{"2", "4"}, ids(t, ps, err))
+	assert.NotContains(t, c.tables[TableSubjects], "1\x00peter", "the subjects of the policy are replaced")
+	assert.Equal(t, int64(2), c.tables[TablePolicies]["1"]["version"])
+
+	stale := &ladon.DefaultPolicy{ID: "1", Version: 1, Subjects: []string{"peter"}, Effect: ladon.AllowAccess}
+	assert.Equal(t, ladon.ErrVersionConflict, errors.Cause(m.Update(stale)))
+	assert.Equal(t, 1, stale.Version)
+
+	require.NoError(t, m.Update(&ladon.DefaultPolicy{ID: "5", Subjects: []string{"max"}, Effect: ladon.AllowAccess}))
+	require.NoError(t, m.Delete("5"))
+	require.NoError(t, m.Delete("2"))
+	require.NoError(t, m.Delete("2"))
+	assert.Len(t, c.tables[TableSubjects], 3, "interleaved rows are deleted with the policy")
+	ps, err = m.FindPoliciesForSubject("max")
+	assert.Equal(t, []string{"1", "4"}, ids(t, ps, err))
+
+	all, err := m.GetAll(10, 1)
+	assert.Equal(t, []string{"3", "4"}, ids(t, all, err))
+	require.NoError(t, m.Ping(context.Background()))
+}
+
+func TestSpannerManagerBulk(t *testing.T) {
+	c := newFakeClient()
+	m := NewSpannerManager(c)
+
+	require.NoError(t, ladon.CreateAll(m, ladon.Policies{policies[0], policies[1], policies[2]}))
+	assert.Equal(t, 1, c.writes, "all policies are written in one transaction")
+	assert.Len(t, c.tables[TablePolicies], 3)
+
+	err := ladon.CreateAll(m, ladon.Policies{policies[3], policies[0]})
+	assert.Equal(t, ladon.ErrPolicyExists, errors.Cause(err))
+	assert.Len(t, c.tables[TablePolicies], 3, "no policy is created if one exists")
+
+	require.NoError(t, ladon.DeleteAll(m, []string{"1", "3", "5"}))
+	assert.Equal(t, 2, c.writes)
+	all, err := m.GetAll(10, 0)
+	assert.Equal(t, []string{"2"}, ids(t, all, err))
+	assert.Len(t, c.tables[TableActions], 1)
+}
+
+func TestSpannerManagerStaleReads(t *testing.T) {
+	c := newFakeClient()
+	m := NewSpannerManager(c)
+	m.CandidateBound = MaxStaleness(time.Second * 15)
+	require.NoError(t, m.Create(policies[0]))
+
+	_, err := m.FindRequestCandidates(&ladon.Request{Subject: "max"})
+	require.NoError(t, err)
+	_, err = m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []TimestampBound{{Staleness: time.Second * 15, Bounded: true}, StrongRead()}, c.bounds[len(c.bounds)-2:])
+	assert.Equal(t, TimestampBound{Staleness: time.Second}, ExactStaleness(time.Second))
+}
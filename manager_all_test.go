@@ -22,6 +22,7 @@ package ladon_test
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	. "github.com/ory/ladon"
@@ -32,6 +33,7 @@ var managers = map[string]Manager{}
 
 func TestMain(m *testing.M) {
 	connectMEM()
+	os.Exit(m.Run())
 }
 
 func connectMEM() {
@@ -51,13 +53,5 @@ func TestManagers(t *testing.T) {
 		}
 	})
 
-	t.Run("type=find", func(t *testing.T) {
-		for k, s := range map[string]Manager{
-			"postgres": managers["postgres"],
-			"mysql":    managers["mysql"],
-		} {
-			t.Run(fmt.Sprintf("manager=%s", k), TestHelperFindPoliciesForSubject(k, s))
-			t.Run(fmt.Sprintf("manager=%s", k), TestHelperFindPoliciesForResource(k, s))
-		}
-	})
+	t.Run("type=conformance", TestHelperManager(NewMemoryManager()))
 }
@@ -0,0 +1,333 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+)
+
+// BreakerFallback defines what BreakerManager returns for request candidates while the wrapped manager is
+// unavailable.
+type BreakerFallback string
+
+const (
+	// BreakerFallbackDeny fails the read with ErrManagerUnavailable, so the warden denies the request.
+	BreakerFallbackDeny BreakerFallback = "deny"
+
+	// BreakerFallbackLastKnown returns the candidates the wrapped manager last returned for a request with the
+	// same tenant, subject, action and resource, and fails like BreakerFallbackDeny if there are none or they are
+	// older than LastKnownMaxAge.
+	BreakerFallbackLastKnown BreakerFallback = "last_known"
+)
+
+// BreakerManager wraps a Manager and bounds the time the warden waits for it, so that a slow datastore degrades
+// gracefully instead of stalling every request. Reads which take longer than Timeout fail with
+// ErrManagerUnavailable. Once FailureThreshold reads in a row failed, the breaker opens and reads fail immediately
+// for OpenDuration, after which a single read probes whether the manager recovered. Writes are passed through.
+//
+// The optional interfaces of the wrapped manager are forwarded: Count, Exists and FindPoliciesByLabel are bounded
+// like reads, while ForEach and WatchPolicies run as long as their context and are passed through.
+//
+// The Manager interface can not cancel queries, so a timed out query keeps running in the background.
+type BreakerManager struct {
+	Manager Manager
+
+	// Timeout bounds every read. Zero disables it.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed reads which opens the breaker. Zero disables the
+	// breaker. ErrNotFound is not a failure.
+	FailureThreshold int
+
+	// OpenDuration is the time the breaker stays open before probing the manager again.
+	OpenDuration time.Duration
+
+	// Fallback defines what FindRequestCandidates returns while the manager is unavailable.
+	Fallback BreakerFallback
+
+	// LastKnownMaxAge bounds the age of the last known candidates BreakerFallbackLastKnown serves, so that an
+	// outage can not grant access which was revoked long ago forever. Zero serves them regardless of their age.
+	LastKnownMaxAge time.Duration
+
+	// Clock is used to time the open breaker. It defaults to SystemClock.
+	Clock Clock
+
+	lastKnown *lru.Cache
+	failures  int
+	openUntil time.Time
+	probing   bool
+	sync.Mutex
+}
+
+// NewBreakerManager returns a BreakerManager wrapping m, which fails reads after one second and opens for 30
+// seconds after five failures in a row. If lastKnown is greater than zero, the candidates of up to lastKnown
+// distinct requests are kept and served for up to five minutes while m is unavailable.
+func NewBreakerManager(m Manager, lastKnown int) *BreakerManager {
+	b := &BreakerManager{
+		Manager:          m,
+		Timeout:          time.Second,
+		FailureThreshold: 5,
+		OpenDuration:     time.Second * 30,
+		Fallback:         BreakerFallbackDeny,
+		LastKnownMaxAge:  time.Minute * 5,
+	}
+
+	if lastKnown > 0 {
+		// golang-lru only returns an error if the cache's size is not positive.
+		b.lastKnown, _ = lru.New(lastKnown)
+		b.Fallback = BreakerFallbackLastKnown
+	}
+	return b
+}
+
+// Open returns true if the breaker is open, i.e. reads currently fail without reaching the wrapped manager.
+func (m *BreakerManager) Open() bool {
+	m.Lock()
+	defer m.Unlock()
+	return m.open(m.now())
+}
+
+func (m *BreakerManager) now() time.Time {
+	if m.Clock == nil {
+		return SystemClock.Now()
+	}
+	return m.Clock.Now()
+}
+
+// open returns true if the breaker is open at now. The lock must be held.
+func (m *BreakerManager) open(now time.Time) bool {
+	return m.FailureThreshold > 0 && m.failures >= m.FailureThreshold && now.Before(m.openUntil)
+}
+
+// allow returns true if a read may reach the wrapped manager. Once the breaker's open period ended, only one read
+// at a time is allowed until one succeeds.
+func (m *BreakerManager) allow() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.FailureThreshold <= 0 || m.failures < m.FailureThreshold {
+		return true
+	} else if m.open(m.now()) || m.probing {
+		return false
+	}
+
+	m.probing = true
+	return true
+}
+
+func (m *BreakerManager) record(err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.probing = false
+	if err == nil || errors.Cause(err) == ErrNotFound {
+		m.failures = 0
+		return
+	}
+
+	m.failures++
+	if m.FailureThreshold > 0 && m.failures >= m.FailureThreshold {
+		m.openUntil = m.now().Add(m.OpenDuration)
+	}
+}
+
+// call runs f unless the breaker is open and waits at most Timeout for it. If it times out, f keeps running in
+// the background, so the values f sets must only be used if call returned no error.
+func (m *BreakerManager) call(f func() error) error {
+	if !m.allow() {
+		return errors.WithStack(ErrManagerUnavailable)
+	}
+
+	if m.Timeout <= 0 {
+		err := f()
+		m.record(err)
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+
+	timer := time.NewTimer(m.Timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		m.record(err)
+		return err
+	case <-timer.C:
+		err := errors.Wrapf(ErrManagerUnavailable, "Manager did not answer within %s", m.Timeout)
+		m.record(err)
+		return err
+	}
+}
+
+// read is call for reads returning policies.
+func (m *BreakerManager) read(f func() (Policies, error)) (Policies, error) {
+	var ps Policies
+	if err := m.call(func() (err error) {
+		ps, err = f()
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// Create persists the policy.
+func (m *BreakerManager) Create(policy Policy) error {
+	return m.Manager.Create(policy)
+}
+
+// Update updates an existing policy.
+func (m *BreakerManager) Update(policy Policy) error {
+	return m.Manager.Update(policy)
+}
+
+// Delete removes a policy.
+func (m *BreakerManager) Delete(id string) error {
+	return m.Manager.Delete(id)
+}
+
+// Get retrieves a policy.
+func (m *BreakerManager) Get(id string) (Policy, error) {
+	ps, err := m.read(func() (Policies, error) {
+		p, err := m.Manager.Get(id)
+		return Policies{p}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ps[0], nil
+}
+
+// GetAll retrieves all policies.
+func (m *BreakerManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.read(func() (Policies, error) {
+		return m.Manager.GetAll(limit, offset)
+	})
+}
+
+// FindRequestCandidates returns candidates that could match the request object. While the wrapped manager is
+// unavailable, it returns the last known candidates of the request if Fallback is BreakerFallbackLastKnown.
+func (m *BreakerManager) FindRequestCandidates(r *Request) (Policies, error) {
+	ps, err := m.read(func() (Policies, error) {
+		return m.Manager.FindRequestCandidates(r)
+	})
+
+	if m.Fallback != BreakerFallbackLastKnown || m.lastKnown == nil {
+		return ps, err
+	}
+
+	key := r.Tenant + "\x00" + r.Subject + "\x00" + r.Action + "\x00" + r.Resource
+	if err == nil {
+		m.lastKnown.Add(key, lastKnownCandidates{policies: ps, at: m.now()})
+		return ps, nil
+	} else if cached, ok := m.lastKnown.Get(key); ok {
+		c := cached.(lastKnownCandidates)
+		if m.LastKnownMaxAge <= 0 || m.now().Sub(c.at) <= m.LastKnownMaxAge {
+			return c.policies, nil
+		}
+		m.lastKnown.Remove(key)
+	}
+	return nil, err
+}
+
+// lastKnownCandidates are the candidates the wrapped manager returned for a request at the given time.
+type lastKnownCandidates struct {
+	policies Policies
+	at       time.Time
+}
+
+// FindPoliciesForSubject returns policies that could match the subject.
+func (m *BreakerManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.read(func() (Policies, error) {
+		return m.Manager.FindPoliciesForSubject(subject)
+	})
+}
+
+// FindPoliciesForResource returns policies that could match the resource.
+func (m *BreakerManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.read(func() (Policies, error) {
+		return m.Manager.FindPoliciesForResource(resource)
+	})
+}
+
+// Count returns the number of policies stored in the wrapped manager.
+func (m *BreakerManager) Count() (int64, error) {
+	var count int64
+	if err := m.call(func() (err error) {
+		count, err = Count(m.Manager)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Exists returns true if the wrapped manager stores a policy with the given ID.
+func (m *BreakerManager) Exists(id string) (bool, error) {
+	var exists bool
+	if err := m.call(func() (err error) {
+		exists, err = Exists(m.Manager, id)
+		return err
+	}); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// FindPoliciesByLabel returns the policies whose label key is set to value.
+func (m *BreakerManager) FindPoliciesByLabel(key, value string) (Policies, error) {
+	return m.read(func() (Policies, error) {
+		return FindPoliciesByLabel(m.Manager, key, value)
+	})
+}
+
+// ForEach calls fn for every policy stored in the wrapped manager, regardless of the state of the breaker.
+func (m *BreakerManager) ForEach(ctx context.Context, fn func(Policy) error) error {
+	return ForEach(ctx, m.Manager, fn)
+}
+
+// WatchPolicies watches the wrapped manager, regardless of the state of the breaker.
+func (m *BreakerManager) WatchPolicies(ctx context.Context) (<-chan *PolicyEvent, error) {
+	return WatchPolicies(ctx, m.Manager)
+}
+
+// Ping checks the wrapped manager, regardless of the state of the breaker.
+func (m *BreakerManager) Ping(ctx context.Context) error {
+	return Ping(ctx, m.Manager)
+}
+
+// Close closes the wrapped manager.
+func (m *BreakerManager) Close(ctx context.Context) error {
+	return Close(ctx, m.Manager)
+}
+
+// IndexesLiterals returns true if the wrapped manager looks candidates up verbatim.
+func (m *BreakerManager) IndexesLiterals() bool {
+	return IndexesLiterals(m.Manager)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+// slowManager blocks reads until release is closed.
+type slowManager struct {
+	*MemoryManager
+	release chan struct{}
+}
+
+func (m *slowManager) FindRequestCandidates(r *Request) (Policies, error) {
+	<-m.release
+	return m.MemoryManager.FindRequestCandidates(r)
+}
+
+func TestBreakerManagerTimeout(t *testing.T) {
+	backend := &slowManager{MemoryManager: NewMemoryManager(), release: make(chan struct{})}
+	defer close(backend.release)
+
+	m := NewBreakerManager(backend, 0)
+	m.Timeout = time.Millisecond * 10
+
+	warden := &Ladon{Manager: m}
+	err := warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"})
+	assert.Equal(t, ErrManagerUnavailable, errors.Cause(err))
+}
+
+func TestBreakerManager(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend := &unavailableManager{MemoryManager: NewMemoryManager()}
+	require.NoError(t, backend.MemoryManager.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, Effect: AllowAccess}))
+
+	m := NewBreakerManager(backend.MemoryManager, 10)
+	m.FailureThreshold = 2
+	m.OpenDuration = time.Minute
+	m.Clock = ClockFunc(func() time.Time { return now })
+
+	warden := &Ladon{Manager: m}
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1"}
+	require.NoError(t, warden.IsAllowed(r))
+
+	m.Manager = backend
+	assert.NoError(t, warden.IsAllowed(r), "the last known candidates are served")
+	assert.NoError(t, warden.IsAllowed(r))
+	assert.True(t, m.Open())
+
+	other := &Request{Subject: "ken", Action: "get", Resource: "articles:1"}
+	assert.Equal(t, ErrManagerUnavailable, errors.Cause(warden.IsAllowed(other)), "unknown requests are denied")
+
+	_, err := m.Get("1")
+	assert.Equal(t, ErrManagerUnavailable, errors.Cause(err), "the open breaker fails reads immediately")
+
+	now = now.Add(time.Minute)
+	m.Manager = backend.MemoryManager
+	assert.False(t, m.Open())
+	_, err = m.Get("2")
+	assert.Equal(t, ErrNotFound, errors.Cause(err), "a successful probe closes the breaker")
+	_, err = m.Get("1")
+	assert.NoError(t, err)
+}
+
+func TestBreakerManagerDeny(t *testing.T) {
+	backend := &unavailableManager{MemoryManager: NewMemoryManager()}
+	m := NewBreakerManager(backend, 0)
+	assert.Equal(t, BreakerFallbackDeny, m.Fallback)
+
+	for i := 0; i < 5; i++ {
+		_, err := m.FindRequestCandidates(&Request{Subject: "peter"})
+		assert.Equal(t, errUnavailable, errors.Cause(err))
+	}
+	assert.True(t, m.Open())
+
+	_, err := m.FindRequestCandidates(&Request{Subject: "peter"})
+	assert.Equal(t, ErrManagerUnavailable, errors.Cause(err))
+
+	_, err = m.GetAll(10, 0)
+	assert.Equal(t, ErrManagerUnavailable, errors.Cause(err), "all reads fail while the breaker is open")
+}
+
+func TestBreakerManagerLastKnownMaxAge(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend := &unavailableManager{MemoryManager: NewMemoryManager()}
+	require.NoError(t, backend.MemoryManager.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, Effect: AllowAccess}))
+
+	m := NewBreakerManager(backend.MemoryManager, 10)
+	m.Clock = ClockFunc(func() time.Time { return now })
+	assert.Equal(t, time.Minute*5, m.LastKnownMaxAge)
+
+	warden := &Ladon{Manager: m}
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1"}
+	require.NoError(t, warden.IsAllowed(r))
+
+	m.Manager = backend
+	now = now.Add(time.Minute * 5)
+	assert.NoError(t, warden.IsAllowed(r))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, errUnavailable, errors.Cause(warden.IsAllowed(r)), "stale candidates are not served")
+}
+
+func TestBreakerManagerForwards(t *testing.T) {
+	backend := NewMemoryManager()
+	require.NoError(t, backend.Create(&DefaultPolicy{ID: "1", Effect: AllowAccess, Labels: map[string]string{"team": "a"}}))
+	m := NewBreakerManager(backend, 0)
+
+	var _ CountingManager = m
+	var _ LabelFinder = m
+	var _ StreamingManager = m
+	var _ PolicyWatcher = m
+
+	count, err := m.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, count)
+
+	exists, err := m.Exists("1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	ps, err := m.FindPoliciesByLabel("team", "a")
+	require.NoError(t, err)
+	assert.Len(t, ps, 1)
+
+	var ids []string
+	require.NoError(t, m.ForEach(context.Background(), func(p Policy) error {
+		ids = append(ids, p.GetID())
+		return nil
+	}))
+	assert.Equal(t, []string{"1"}, ids)
+
+	_, err = m.WatchPolicies(context.Background())
+	assert.Equal(t, ErrWatchUnsupported, errors.Cause(err))
+
+	m.Manager = &unavailableManager{MemoryManager: backend}
+	for i := 0; i < 5; i++ {
+		m.FindRequestCandidates(&Request{Subject: "peter"})
+	}
+	_, err = m.Count()
+	assert.Equal(t, ErrManagerUnavailable, errors.Cause(err), "forwarded reads fail while the breaker is open")
+}
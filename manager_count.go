@@ -0,0 +1,64 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// CountingManager is implemented by managers which count policies and check their existence without fetching them.
+type CountingManager interface {
+	// Count returns the number of stored policies.
+	Count() (int64, error)
+
+	// Exists returns true if a policy with the given ID is stored.
+	Exists(id string) (bool, error)
+}
+
+// Count returns the number of policies stored in m. Managers which do not implement CountingManager are paged
+// through.
+func Count(m Manager) (int64, error) {
+	if cm, ok := m.(CountingManager); ok {
+		return cm.Count()
+	}
+
+	var count int64
+	err := exportPages(m, func(ps Policies) error {
+		count += int64(len(ps))
+		return nil
+	})
+	return count, err
+}
+
+// Exists returns true if a policy with the given ID is stored in m. Managers which do not implement CountingManager
+// are asked for the policy.
+func Exists(m Manager, id string) (bool, error) {
+	if cm, ok := m.(CountingManager); ok {
+		return cm.Exists(id)
+	}
+
+	if _, err := m.Get(id); errors.Cause(err) == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestCount(t *testing.T) {
+	for k, m := range map[string]Manager{
+		"native":   NewMemoryManager(),
+		"fallback": NewEventingManager(NewMemoryManager(), new(recordingBus)),
+	} {
+		t.Run(k, func(t *testing.T) {
+			for _, id := range []string{"1", "2", "3"} {
+				require.NoError(t, m.Create(&DefaultPolicy{ID: id, Effect: AllowAccess}))
+			}
+
+			count, err := Count(m)
+			require.NoError(t, err)
+			assert.EqualValues(t, 3, count)
+
+			exists, err := Exists(m, "2")
+			require.NoError(t, err)
+			assert.True(t, exists)
+			exists, err = Exists(m, "4")
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// EncryptionKeyLabel is the label of encrypted envelopes which holds the ID of the key the policy was encrypted
+// with.
+const EncryptionKeyLabel = "ladon.encryption_key"
+
+// EncryptingManager wraps a Manager and encrypts policies with AES-GCM before they are written, for deployments
+// where the datastore is not trusted with plaintext authorization rules. The wrapped manager stores an envelope per
+// policy: a disabled deny policy with the plaintext ID and version, which carries the ciphertext as metadata and the
+// key ID as EncryptionKeyLabel. Envelopes never apply to requests, even if the wrapped manager is used directly.
+//
+// The ID is bound to the ciphertext, so envelopes can not be swapped between policies. Decrypted policies are
+// returned as DefaultPolicy. As the wrapped manager can not search ciphertext, FindRequestCandidates,
+// FindPoliciesForSubject and FindPoliciesForResource return all policies; use a CachedWarden to avoid decrypting all
+// policies for every request.
+type EncryptingManager struct {
+	Manager Manager
+
+	// KeyID is the key policies are encrypted with.
+	KeyID string
+
+	// AllowPlaintext returns policies which were written to the wrapped manager before it was encrypted, instead
+	// of failing. Reencrypt encrypts them.
+	AllowPlaintext bool
+
+	keys map[string]cipher.AEAD
+}
+
+// NewEncryptingManager returns an EncryptingManager which encrypts policies with the key keyID. keys maps key IDs to
+// AES keys of 16, 24 or 32 bytes; keys which were rotated out are kept to decrypt policies until Reencrypt ran.
+func NewEncryptingManager(m Manager, keyID string, keys map[string][]byte) (*EncryptingManager, error) {
+	if _, ok := keys[keyID]; !ok {
+		return nil, errors.Errorf(`Encryption key "%s" is unknown`, keyID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, `Encryption key "%s" is invalid`, id)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		aeads[id] = aead
+	}
+
+	return &EncryptingManager{Manager: m, KeyID: keyID, keys: aeads}, nil
+}
+
+// encrypt returns the envelope of p.
+func (m *EncryptingManager) encrypt(p Policy) (*DefaultPolicy, error) {
+	plaintext, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead := m.keys[m.KeyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	envelope := &DefaultPolicy{
+		ID:       p.GetID(),
+		Effect:   DenyAccess,
+		Meta:     aead.Seal(nonce, nonce, plaintext, []byte(p.GetID())),
+		Disabled: true,
+		Labels:   map[string]string{EncryptionKeyLabel: m.KeyID},
+	}
+	if v, ok := p.(VersionedPolicy); ok {
+		envelope.Version = v.GetVersion()
+	}
+	return envelope, nil
+}
+
+// decrypt returns the policy sealed in envelope.
+func (m *EncryptingManager) decrypt(envelope Policy) (Policy, error) {
+	keyID, ok := PolicyLabels(envelope)[EncryptionKeyLabel]
+	if !ok {
+		if m.AllowPlaintext {
+			return envelope, nil
+		}
+		return nil, errors.Errorf(`Policy "%s" is not encrypted`, envelope.GetID())
+	}
+
+	aead, ok := m.keys[keyID]
+	if !ok {
+		return nil, errors.Errorf(`Policy "%s" is encrypted with the unknown key "%s"`, envelope.GetID(), keyID)
+	}
+
+	sealed := envelope.GetMeta()
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.Errorf(`Policy "%s" can not be decrypted`, envelope.GetID())
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(envelope.GetID()))
+	if err != nil {
+		return nil, errors.Errorf(`Policy "%s" can not be decrypted`, envelope.GetID())
+	}
+
+	var p DefaultPolicy
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, errors.WithStack(err)
+	} else if p.ID != envelope.GetID() {
+		return nil, errors.Errorf(`Policy "%s" can not be decrypted`, envelope.GetID())
+	}
+
+	if v, ok := envelope.(VersionedPolicy); ok {
+		p.Version = v.GetVersion()
+	}
+	return &p, nil
+}
+
+func (m *EncryptingManager) decryptAll(envelopes Policies) (Policies, error) {
+	policies := make(Policies, len(envelopes))
+	for k, envelope := range envelopes {
+		p, err := m.decrypt(envelope)
+		if err != nil {
+			return nil, err
+		}
+		policies[k] = p
+	}
+	return policies, nil
+}
+
+// write validates and encrypts policy, writes it with f and sets the version of policy to the stored version.
+func (m *EncryptingManager) write(policy Policy, f func(Policy) error) error {
+	if err := ValidatePolicy(policy); err != nil {
+		return err
+	}
+
+	envelope, err := m.encrypt(policy)
+	if err != nil {
+		return err
+	} else if err := f(envelope); err != nil {
+		return err
+	}
+
+	if v, ok := policy.(VersionedPolicy); ok {
+		v.SetVersion(envelope.Version)
+	}
+	return nil
+}
+
+// Create encrypts and persists the policy.
+func (m *EncryptingManager) Create(policy Policy) error {
+	if err := AssignID(policy); err != nil {
+		return err
+	}
+	return m.write(policy, m.Manager.Create)
+}
+
+// Update encrypts the policy and updates the existing policy.
+func (m *EncryptingManager) Update(policy Policy) error {
+	return m.write(policy, m.Manager.Update)
+}
+
+// Get retrieves and decrypts a policy.
+func (m *EncryptingManager) Get(id string) (Policy, error) {
+	envelope, err := m.Manager.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.decrypt(envelope)
+}
+
+// Delete removes a policy.
+func (m *EncryptingManager) Delete(id string) error {
+	return m.Manager.Delete(id)
+}
+
+// GetAll retrieves and decrypts all policies.
+func (m *EncryptingManager) GetAll(limit, offset int64) (Policies, error) {
+	envelopes, err := m.Manager.GetAll(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return m.decryptAll(envelopes)
+}
+
+// all returns all decrypted policies.
+func (m *EncryptingManager) all() (Policies, error) {
+	policies := Policies{}
+	err := exportPages(m, func(ps Policies) error {
+		policies = append(policies, ps...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// FindRequestCandidates returns all policies, because the wrapped manager can not search ciphertext.
+func (m *EncryptingManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.all()
+}
+
+// FindPoliciesForSubject returns all policies, because the wrapped manager can not search ciphertext.
+func (m *EncryptingManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.all()
+}
+
+// FindPoliciesForResource returns all policies, because the wrapped manager can not search ciphertext.
+func (m *EncryptingManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.all()
+}
+
+// Reencrypt encrypts all policies which are not encrypted with KeyID, for example after the key was rotated, and
+// returns the number of policies it updated. Afterwards, the previous keys can be removed.
+func (m *EncryptingManager) Reencrypt() (int, error) {
+	var stale Policies
+	err := exportPages(m.Manager, func(envelopes Policies) error {
+		for _, envelope := range envelopes {
+			if PolicyLabels(envelope)[EncryptionKeyLabel] != m.KeyID {
+				stale = append(stale, envelope)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for k, envelope := range stale {
+		p, err := m.decrypt(envelope)
+		if err != nil {
+			return k, err
+		} else if err := m.Update(p); err != nil {
+			return k, err
+		}
+	}
+	return len(stale), nil
+}
+
+// Close closes the wrapped manager.
+func (m *EncryptingManager) Close(ctx context.Context) error {
+	return Close(ctx, m.Manager)
+}
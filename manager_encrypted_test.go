@@ -0,0 +1,125 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestEncryptingManager(t *testing.T) {
+	keys := map[string][]byte{
+		"1": bytes.Repeat([]byte{1}, 32),
+		"2": bytes.Repeat([]byte{2}, 16),
+	}
+
+	_, err := NewEncryptingManager(NewMemoryManager(), "3", keys)
+	assert.Error(t, err)
+	_, err = NewEncryptingManager(NewMemoryManager(), "1", map[string][]byte{"1": []byte("short")})
+	assert.Error(t, err)
+
+	mm := NewMemoryManager()
+	m, err := NewEncryptingManager(mm, "1", keys)
+	require.NoError(t, err)
+
+	p := &DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:secret"},
+		Actions:   []string{"get"},
+		Effect:    AllowAccess,
+		Meta:      []byte(`{"owner": "blog"}`),
+	}
+	require.NoError(t, m.Create(p))
+	assert.Equal(t, 1, p.Version)
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "2", Effect: "maybe"}))
+
+	// The wrapped manager never sees the plaintext, and the envelope does not apply to requests.
+	envelope, err := mm.Get("1")
+	require.NoError(t, err)
+	assert.NotContains(t, string(envelope.GetMeta()), "articles:secret")
+	assert.Empty(t, envelope.GetSubjects())
+	assert.Equal(t, "1", PolicyLabels(envelope)[EncryptionKeyLabel])
+	assert.False(t, PolicyActive(envelope))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles:secret"}, got.GetResources())
+	assert.Equal(t, []byte(`{"owner": "blog"}`), got.GetMeta())
+
+	warden := &Ladon{Manager: m}
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:secret"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:secret"}))
+
+	// Updates keep optimistic concurrency control of the wrapped manager.
+	p.Subjects = []string{"peter", "ken"}
+	require.NoError(t, m.Update(p))
+	assert.Equal(t, 2, p.Version)
+	assert.Error(t, m.Update(&DefaultPolicy{ID: "1", Effect: AllowAccess, Version: 1}))
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:secret"}))
+
+	// Envelopes can not be swapped between policies.
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+	envelope, err = mm.Get("1")
+	require.NoError(t, err)
+	require.NoError(t, mm.Update(&DefaultPolicy{ID: "2", Effect: DenyAccess, Disabled: true, Meta: envelope.GetMeta(), Labels: PolicyLabels(envelope)}))
+	_, err = m.Get("2")
+	assert.Error(t, err)
+	_, err = m.GetAll(10, 0)
+	assert.Error(t, err)
+	require.NoError(t, m.Delete("2"))
+
+	// Plaintext policies written before are only returned if allowed, and encrypted by Reencrypt.
+	require.NoError(t, mm.Create(&DefaultPolicy{ID: "3", Subjects: []string{"ken"}, Effect: AllowAccess}))
+	_, err = m.Get("3")
+	assert.Error(t, err)
+	m.AllowPlaintext = true
+	got, err = m.Get("3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ken"}, got.GetSubjects())
+
+	// After the key was rotated, policies are encrypted with the new key and the old key can be removed.
+	m.KeyID = "2"
+	updated, err := m.Reencrypt()
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	envelopes, err := mm.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, envelopes, 2)
+	for _, envelope := range envelopes {
+		assert.Equal(t, "2", PolicyLabels(envelope)[EncryptionKeyLabel])
+	}
+
+	rotated, err := NewEncryptingManager(mm, "2", map[string][]byte{"2": keys["2"]})
+	require.NoError(t, err)
+	policies, err := rotated.FindRequestCandidates(&Request{Subject: "ken"})
+	require.NoError(t, err)
+	assert.Len(t, policies, 2)
+	updated, err = rotated.Reencrypt()
+	require.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
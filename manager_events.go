@@ -0,0 +1,237 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PolicyEventType is the kind of change a PolicyEvent describes.
+type PolicyEventType string
+
+const (
+	PolicyCreated PolicyEventType = "created"
+	PolicyUpdated PolicyEventType = "updated"
+	PolicyDeleted PolicyEventType = "deleted"
+)
+
+// PolicyEvent describes a change of a policy.
+type PolicyEvent struct {
+	Type PolicyEventType `json:"type"`
+	ID   string          `json:"id"`
+
+	// Policy is the policy after the change, or the deleted policy. It is nil if the deleted policy could not be
+	// retrieved before it was deleted.
+	Policy Policy `json:"policy,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// UnmarshalJSON decodes the event, decoding the policy into a DefaultPolicy.
+func (e *PolicyEvent) UnmarshalJSON(data []byte) error {
+	var event struct {
+		Type   PolicyEventType `json:"type"`
+		ID     string          `json:"id"`
+		Policy *DefaultPolicy  `json:"policy"`
+		Time   time.Time       `json:"time"`
+	}
+
+	if err := json.Unmarshal(data, &event); err != nil {
+		return errors.WithStack(err)
+	}
+
+	*e = PolicyEvent{Type: event.Type, ID: event.ID, Time: event.Time}
+	if event.Policy != nil {
+		e.Policy = event.Policy
+	}
+	return nil
+}
+
+// EventBus publishes policy events, for example to Kafka or NATS.
+type EventBus interface {
+	Publish(ctx context.Context, event *PolicyEvent) error
+}
+
+// EventingManager wraps a Manager and publishes an event to Bus after every successful write.
+type EventingManager struct {
+	Manager
+	Bus EventBus
+
+	// Timeout limits the time spent publishing an event. Zero means no limit.
+	Timeout time.Duration
+
+	// OnError is called if an event can not be published. The write itself is not failed, because it already
+	// succeeded.
+	OnError func(event *PolicyEvent, err error)
+}
+
+// NewEventingManager returns an EventingManager publishing the writes to m on bus.
+func NewEventingManager(m Manager, bus EventBus) *EventingManager {
+	return &EventingManager{Manager: m, Bus: bus}
+}
+
+// Create persists the policy and publishes a PolicyCreated event.
+func (m *EventingManager) Create(policy Policy) error {
+	if err := m.Manager.Create(policy); err != nil {
+		return err
+	}
+	m.publish(PolicyCreated, policy.GetID(), policy)
+	return nil
+}
+
+// Update updates an existing policy and publishes a PolicyUpdated event.
+func (m *EventingManager) Update(policy Policy) error {
+	if err := m.Manager.Update(policy); err != nil {
+		return err
+	}
+	m.publish(PolicyUpdated, policy.GetID(), policy)
+	return nil
+}
+
+// Delete removes a policy and publishes a PolicyDeleted event carrying the deleted policy.
+func (m *EventingManager) Delete(id string) error {
+	deleted, _ := m.Manager.Get(id)
+	if err := m.Manager.Delete(id); err != nil {
+		return err
+	}
+	m.publish(PolicyDeleted, id, deleted)
+	return nil
+}
+
+// Ping checks the health of the wrapped manager. The event bus is not checked, because failing publishes do not
+// fail writes.
+func (m *EventingManager) Ping(ctx context.Context) error {
+	return Ping(ctx, m.Manager)
+}
+
+// Close closes the wrapped manager.
+func (m *EventingManager) Close(ctx context.Context) error {
+	return Close(ctx, m.Manager)
+}
+
+// IndexesLiterals returns true if the wrapped manager looks candidates up verbatim.
+func (m *EventingManager) IndexesLiterals() bool {
+	return IndexesLiterals(m.Manager)
+}
+
+func (m *EventingManager) publish(t PolicyEventType, id string, policy Policy) {
+	event := &PolicyEvent{Type: t, ID: id, Policy: policy, Time: time.Now().UTC()}
+
+	ctx := context.Background()
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	if err := m.Bus.Publish(ctx, event); err != nil && m.OnError != nil {
+		m.OnError(event, err)
+	}
+}
+
+// ApplyPolicyEvent applies an event to m, for example to keep a replica in sync. Creating an existing policy
+// updates it and deleting a missing policy succeeds, so events may be applied more than once.
+func ApplyPolicyEvent(m Manager, event *PolicyEvent) error {
+	switch event.Type {
+	case PolicyCreated, PolicyUpdated:
+		if event.Policy == nil {
+			return errors.Errorf("Event %s of policy %s carries no policy", event.Type, event.ID)
+		}
+
+		policy, err := copyPolicy(event.Policy)
+		if err != nil {
+			return err
+		}
+
+		if _, err := m.Get(event.ID); errors.Cause(err) == ErrNotFound {
+			return m.Create(policy)
+		} else if err != nil {
+			return err
+		}
+		return m.Update(policy)
+	case PolicyDeleted:
+		return m.Delete(event.ID)
+	}
+	return errors.Errorf("Unknown policy event type %s", event.Type)
+}
+
+// KafkaEventBus publishes policy events as JSON to a Kafka topic. Messages are keyed by policy ID, so all events of
+// a policy end up in the same partition and keep their order.
+type KafkaEventBus struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+// NewKafkaEventBus returns a KafkaEventBus producing to topic.
+func NewKafkaEventBus(producer KafkaProducer, topic string) *KafkaEventBus {
+	return &KafkaEventBus{Producer: producer, Topic: topic}
+}
+
+// Publish produces the event.
+func (b *KafkaEventBus) Publish(ctx context.Context, event *PolicyEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := b.Producer.Produce(ctx, b.Topic, []KafkaMessage{{Key: []byte(event.ID), Value: value}}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// NATSConn is the subset of a NATS connection needed by NATSEventBus. *nats.Conn implements it.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSEventBus publishes policy events as JSON to NATS. Events are published to the subject Subject.<type>, for
+// example ladon.policies.created, so subscribers can pick the changes they are interested in with wildcards.
+type NATSEventBus struct {
+	Conn    NATSConn
+	Subject string
+}
+
+// NewNATSEventBus returns a NATSEventBus publishing below subject.
+func NewNATSEventBus(conn NATSConn, subject string) *NATSEventBus {
+	return &NATSEventBus{Conn: conn, Subject: subject}
+}
+
+// Publish publishes the event. NATS publishes asynchronously, so ctx is only checked before publishing.
+func (b *NATSEventBus) Publish(ctx context.Context, event *PolicyEvent) error {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := b.Conn.Publish(b.Subject+"."+string(event.Type), data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type recordingBus struct {
+	events []*PolicyEvent
+	err    error
+}
+
+func (b *recordingBus) Publish(ctx context.Context, event *PolicyEvent) error {
+	b.events = append(b.events, event)
+	return b.err
+}
+
+type recordingNATSConn struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (c *recordingNATSConn) Publish(subject string, data []byte) error {
+	c.subjects = append(c.subjects, subject)
+	c.data = append(c.data, data)
+	return nil
+}
+
+func TestEventingManager(t *testing.T) {
+	bus := new(recordingBus)
+	m := NewEventingManager(NewMemoryManager(), bus)
+
+	policy := &DefaultPolicy{
+		ID:        "allow-peter",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"read"},
+		Effect:    AllowAccess,
+	}
+	require.NoError(t, m.Create(policy))
+	require.Error(t, m.Create(policy), "failed writes publish no events")
+
+	policy.Actions = []string{"read", "update"}
+	require.NoError(t, m.Update(policy))
+	require.NoError(t, m.Delete("allow-peter"))
+
+	require.Len(t, bus.events, 3)
+	assert.Equal(t, PolicyCreated, bus.events[0].Type)
+	assert.Equal(t, PolicyUpdated, bus.events[1].Type)
+	assert.Equal(t, PolicyDeleted, bus.events[2].Type)
+	assert.Equal(t, "allow-peter", bus.events[2].ID)
+	assert.Equal(t, policy, bus.events[2].Policy, "deletions carry the deleted policy")
+
+	var failed *PolicyEvent
+	bus.err = errors.New("bus unavailable")
+	m.OnError = func(event *PolicyEvent, err error) { failed = event }
+	require.NoError(t, m.Create(policy), "the write succeeds even if the event can not be published")
+	require.NotNil(t, failed)
+	assert.Equal(t, PolicyCreated, failed.Type)
+}
+
+func TestApplyPolicyEvent(t *testing.T) {
+	bus := new(recordingBus)
+	origin := NewEventingManager(NewMemoryManager(), bus)
+	replica := NewMemoryManager()
+
+	policy := &DefaultPolicy{
+		ID:        "allow-peter",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"read"},
+		Effect:    AllowAccess,
+	}
+	require.NoError(t, origin.Create(policy))
+	policy.Actions = []string{"update"}
+	require.NoError(t, origin.Update(policy))
+
+	for _, event := range bus.events {
+		raw, err := json.Marshal(event)
+		require.NoError(t, err)
+
+		var decoded PolicyEvent
+		require.NoError(t, json.Unmarshal(raw, &decoded))
+		require.NoError(t, ApplyPolicyEvent(replica, &decoded))
+		require.NoError(t, ApplyPolicyEvent(replica, &decoded), "events may be applied twice")
+	}
+
+	replicated, err := replica.Get("allow-peter")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update"}, replicated.GetActions())
+	assert.Equal(t, 2, policy.Version, "the origin's policy is not modified")
+
+	require.NoError(t, ApplyPolicyEvent(replica, &PolicyEvent{Type: PolicyDeleted, ID: "allow-peter"}))
+	_, err = replica.Get("allow-peter")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+	assert.Error(t, ApplyPolicyEvent(replica, &PolicyEvent{Type: PolicyCreated, ID: "allow-peter"}))
+	assert.Error(t, ApplyPolicyEvent(replica, &PolicyEvent{Type: "renamed", ID: "allow-peter"}))
+}
+
+func TestPolicyEventBuses(t *testing.T) {
+	event := &PolicyEvent{Type: PolicyDeleted, ID: "allow-peter"}
+
+	producer := new(recordingProducer)
+	require.NoError(t, NewKafkaEventBus(producer, "policies").Publish(context.Background(), event))
+	assert.Equal(t, "policies", producer.topic)
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, []byte("allow-peter"), producer.messages[0].Key)
+
+	conn := new(recordingNATSConn)
+	require.NoError(t, NewNATSEventBus(conn, "ladon.policies").Publish(context.Background(), event))
+	assert.Equal(t, []string{"ladon.policies.deleted"}, conn.subjects)
+
+	var decoded PolicyEvent
+	require.NoError(t, json.Unmarshal(conn.data[0], &decoded))
+	assert.Equal(t, *event, decoded)
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// StreamingManager is implemented by managers which iterate over their policies without loading all of them into
+// memory.
+type StreamingManager interface {
+	// ForEach calls fn for every stored policy, ordered by ID, until fn returns an error or ctx is done.
+	ForEach(ctx context.Context, fn func(Policy) error) error
+}
+
+// ForEach calls fn for every policy stored in m until fn returns an error or ctx is done. The error of fn or ctx
+// is returned. Managers which do not implement StreamingManager are paged through with GetAll.
+//
+// Depending on the manager, fn may be called while a read transaction is open, so fn must not write to m.
+func ForEach(ctx context.Context, m Manager, fn func(Policy) error) error {
+	if sm, ok := m.(StreamingManager); ok {
+		return sm.ForEach(ctx, fn)
+	}
+
+	return exportPages(m, func(ps Policies) error {
+		for _, p := range ps {
+			if err := ctx.Err(); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
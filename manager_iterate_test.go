@@ -0,0 +1,63 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestForEach(t *testing.T) {
+	// EventingManager does not implement StreamingManager, so policies are paged through.
+	m := NewEventingManager(NewMemoryManager(), new(recordingBus))
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, m.Create(&DefaultPolicy{ID: id, Effect: AllowAccess}))
+	}
+
+	var ids []string
+	require.NoError(t, ForEach(context.Background(), m, func(p Policy) error {
+		ids = append(ids, p.GetID())
+		return nil
+	}))
+	assert.Len(t, ids, 3)
+
+	stop := errors.New("stop")
+	calls := 0
+	assert.Equal(t, stop, ForEach(context.Background(), m, func(p Policy) error {
+		calls++
+		return stop
+	}))
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(ForEach(ctx, m, func(p Policy) error {
+		t.Fatal("fn must not be called after ctx is done")
+		return nil
+	})))
+}
@@ -24,6 +24,8 @@
 package ladon_test
 
 import (
+	context "context"
+
 	gomock "github.com/golang/mock/gomock"
 
 	ladon "github.com/ory/ladon"
@@ -50,6 +52,16 @@ func (_m *MockManager) EXPECT() *_MockManagerRecorder {
 	return _m.recorder
 }
 
+func (_m *MockManager) Close(_param0 context.Context) error {
+	ret := _m.ctrl.Call(_m, "Close", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockManagerRecorder) Close(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close", arg0)
+}
+
 func (_m *MockManager) Create(_param0 ladon.Policy) error {
 	ret := _m.ctrl.Call(_m, "Create", _param0)
 	ret0, _ := ret[0].(error)
@@ -0,0 +1,321 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ReplicatingManager writes to multiple managers and reads from one of them, for example to keep a Redis cache in
+// front of an SQL database. The first manager is the primary: a write fails if it fails on the primary, while
+// failing writes to the other managers are reported to OnError. Replicas which drifted apart from the primary are
+// found by Check and brought back in line by Repair.
+type ReplicatingManager struct {
+	Managers []Manager
+
+	// Preferred is the index of the manager reads are served from. If a read fails, the other managers are tried
+	// in order. ErrNotFound is not a failure, so it is returned without trying the other managers.
+	Preferred int
+
+	// OnError is called if a write to a replica fails.
+	OnError func(replica int, op string, id string, err error)
+}
+
+// NewReplicatingManager returns a ReplicatingManager writing to primary and replicas and reading from primary.
+func NewReplicatingManager(primary Manager, replicas ...Manager) *ReplicatingManager {
+	return &ReplicatingManager{Managers: append([]Manager{primary}, replicas...)}
+}
+
+// ReplicaDrift lists the policies in which a replica differs from the primary.
+type ReplicaDrift struct {
+	// Replica is the index of the replica in Managers.
+	Replica int `json:"replica"`
+
+	// Missing are the IDs of policies which are stored by the primary, but not by the replica.
+	Missing []string `json:"missing"`
+
+	// Extra are the IDs of policies which are stored by the replica, but not by the primary.
+	Extra []string `json:"extra"`
+
+	// Outdated are the IDs of policies which differ between the primary and the replica.
+	Outdated []string `json:"outdated"`
+}
+
+// Create persists the policy in all managers.
+func (m *ReplicatingManager) Create(policy Policy) error {
+	if err := m.Managers[0].Create(policy); err != nil {
+		return err
+	}
+
+	m.replicate("Create", policy.GetID(), func(r Manager) error {
+		replica, err := copyPolicy(policy)
+		if err != nil {
+			return err
+		}
+		return r.Create(replica)
+	})
+	return nil
+}
+
+// Update updates an existing policy in all managers. Versions are only checked by the primary, because replicas
+// count versions on their own.
+func (m *ReplicatingManager) Update(policy Policy) error {
+	if err := m.Managers[0].Update(policy); err != nil {
+		return err
+	}
+
+	m.replicate("Update", policy.GetID(), func(r Manager) error {
+		replica, err := copyPolicy(policy)
+		if err != nil {
+			return err
+		}
+		return r.Update(replica)
+	})
+	return nil
+}
+
+// Delete removes a policy from all managers.
+func (m *ReplicatingManager) Delete(id string) error {
+	if err := m.Managers[0].Delete(id); err != nil {
+		return err
+	}
+
+	m.replicate("Delete", id, func(r Manager) error {
+		return r.Delete(id)
+	})
+	return nil
+}
+
+func (m *ReplicatingManager) replicate(op, id string, f func(Manager) error) {
+	for k, r := range m.Managers[1:] {
+		if err := f(r); err != nil && m.OnError != nil {
+			m.OnError(k+1, op, id, err)
+		}
+	}
+}
+
+// Get retrieves a policy.
+func (m *ReplicatingManager) Get(id string) (p Policy, err error) {
+	err = m.read(func(r Manager) (err error) {
+		p, err = r.Get(id)
+		return err
+	})
+	return p, err
+}
+
+// GetAll retrieves all policies.
+func (m *ReplicatingManager) GetAll(limit, offset int64) (ps Policies, err error) {
+	err = m.read(func(r Manager) (err error) {
+		ps, err = r.GetAll(limit, offset)
+		return err
+	})
+	return ps, err
+}
+
+// FindRequestCandidates returns candidates that could match the request object.
+func (m *ReplicatingManager) FindRequestCandidates(req *Request) (ps Policies, err error) {
+	err = m.read(func(r Manager) (err error) {
+		ps, err = r.FindRequestCandidates(req)
+		return err
+	})
+	return ps, err
+}
+
+// FindPoliciesForSubject returns policies that could match the subject.
+func (m *ReplicatingManager) FindPoliciesForSubject(subject string) (ps Policies, err error) {
+	err = m.read(func(r Manager) (err error) {
+		ps, err = r.FindPoliciesForSubject(subject)
+		return err
+	})
+	return ps, err
+}
+
+// FindPoliciesForResource returns policies that could match the resource.
+func (m *ReplicatingManager) FindPoliciesForResource(resource string) (ps Policies, err error) {
+	err = m.read(func(r Manager) (err error) {
+		ps, err = r.FindPoliciesForResource(resource)
+		return err
+	})
+	return ps, err
+}
+
+// read calls f with the preferred manager and then with the others until f succeeds or returns ErrNotFound. The
+// error of the preferred manager is returned if all managers fail.
+func (m *ReplicatingManager) read(f func(Manager) error) error {
+	first := f(m.Managers[m.Preferred])
+	if first == nil || errors.Cause(first) == ErrNotFound {
+		return first
+	}
+
+	for k, r := range m.Managers {
+		if k == m.Preferred {
+			continue
+		}
+
+		if err := f(r); err == nil || errors.Cause(err) == ErrNotFound {
+			return err
+		}
+	}
+	return first
+}
+
+// Close closes all managers and returns the first error.
+func (m *ReplicatingManager) Close(ctx context.Context) error {
+	var first error
+	for _, r := range m.Managers {
+		if err := Close(ctx, r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Ping checks the health of all managers, because writes to an unhealthy replica make it drift apart from the
+// primary.
+func (m *ReplicatingManager) Ping(ctx context.Context) error {
+	for k, r := range m.Managers {
+		if err := Ping(ctx, r); err != nil {
+			return errors.Wrapf(err, "Manager %d is unhealthy", k)
+		}
+	}
+	return nil
+}
+
+// Check compares every replica with the primary and returns the replicas which differ from it. Versions are not
+// compared, because replicas count versions on their own.
+func (m *ReplicatingManager) Check() ([]ReplicaDrift, error) {
+	primary, err := fingerprints(m.Managers[0])
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := []ReplicaDrift{}
+	for k, r := range m.Managers[1:] {
+		replica, err := fingerprints(r)
+		if err != nil {
+			return nil, err
+		}
+
+		drift := ReplicaDrift{Replica: k + 1, Missing: []string{}, Extra: []string{}, Outdated: []string{}}
+		for id, fp := range primary {
+			if rfp, ok := replica[id]; !ok {
+				drift.Missing = append(drift.Missing, id)
+			} else if !bytes.Equal(fp, rfp) {
+				drift.Outdated = append(drift.Outdated, id)
+			}
+		}
+		for id := range replica {
+			if _, ok := primary[id]; !ok {
+				drift.Extra = append(drift.Extra, id)
+			}
+		}
+
+		if len(drift.Missing)+len(drift.Extra)+len(drift.Outdated) > 0 {
+			sort.Strings(drift.Missing)
+			sort.Strings(drift.Extra)
+			sort.Strings(drift.Outdated)
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+// Repair brings all replicas in line with the primary and returns the differences it fixed.
+func (m *ReplicatingManager) Repair() ([]ReplicaDrift, error) {
+	drifts, err := m.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, drift := range drifts {
+		r := m.Managers[drift.Replica]
+		for _, id := range append(drift.Missing, drift.Outdated...) {
+			p, err := m.Managers[0].Get(id)
+			if err != nil {
+				return nil, err
+			}
+
+			replica, err := copyPolicy(p)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := r.Get(id); errors.Cause(err) == ErrNotFound {
+				err = r.Create(replica)
+			} else if err == nil {
+				err = r.Update(replica)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "Could not repair policy %s in replica %d", id, drift.Replica)
+			}
+		}
+
+		for _, id := range drift.Extra {
+			if err := r.Delete(id); err != nil {
+				return nil, errors.Wrapf(err, "Could not repair policy %s in replica %d", id, drift.Replica)
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// fingerprints returns the JSON encoding of all policies stored in m by ID, without their versions.
+func fingerprints(m Manager) (map[string][]byte, error) {
+	policies, err := Export(m)
+	if err != nil {
+		return nil, err
+	}
+
+	fps := make(map[string][]byte, len(policies))
+	for _, p := range policies {
+		c, err := copyPolicy(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if fps[p.GetID()], err = json.Marshal(c); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return fps, nil
+}
+
+// copyPolicy returns a copy of p with its version reset. Policies are copied before they are written to another
+// manager, because managers may store them by reference, and versions of one manager must not be checked against
+// another's.
+func copyPolicy(p Policy) (*DefaultPolicy, error) {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c := new(DefaultPolicy)
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.Version = 0
+	return c, nil
+}
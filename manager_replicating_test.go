@@ -0,0 +1,148 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+// unavailableManager fails all calls, except for closing it.
+type unavailableManager struct {
+	*MemoryManager
+}
+
+var errUnavailable = errors.New("store unavailable")
+
+func (m *unavailableManager) Create(policy Policy) error { return errUnavailable }
+func (m *unavailableManager) Update(policy Policy) error { return errUnavailable }
+func (m *unavailableManager) Delete(id string) error     { return errUnavailable }
+func (m *unavailableManager) Get(id string) (Policy, error) {
+	return nil, errUnavailable
+}
+func (m *unavailableManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return nil, errUnavailable
+}
+
+func TestReplicatingManager(t *testing.T) {
+	primary, replica := NewMemoryManager(), NewMemoryManager()
+	m := NewReplicatingManager(primary, replica)
+
+	policy := &DefaultPolicy{
+		ID:        "allow-peter",
+		Subjects:  []string{"peter"},
+		Resources: []string{"articles:<.*>"},
+		Actions:   []string{"read"},
+		Effect:    AllowAccess,
+	}
+	require.NoError(t, m.Create(policy))
+	policy.Actions = []string{"read", "update"}
+	require.NoError(t, m.Update(policy))
+
+	replicated, err := replica.Get("allow-peter")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read", "update"}, replicated.GetActions())
+	assert.False(t, replicated == policy, "replicas store a copy")
+
+	drifts, err := m.Check()
+	require.NoError(t, err)
+	assert.Empty(t, drifts, "versions are not compared")
+
+	require.NoError(t, m.Delete("allow-peter"))
+	_, err = replica.Get("allow-peter")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+}
+
+func TestReplicatingManagerFailures(t *testing.T) {
+	primary := NewMemoryManager()
+	replica := &unavailableManager{MemoryManager: NewMemoryManager()}
+
+	var failed []string
+	m := NewReplicatingManager(primary, replica)
+	m.OnError = func(r int, op string, id string, err error) {
+		assert.Equal(t, 1, r)
+		failed = append(failed, op+" "+id)
+	}
+
+	policy := &DefaultPolicy{ID: "allow-peter", Subjects: []string{"peter"}, Effect: AllowAccess}
+	require.NoError(t, m.Create(policy), "failing replicas do not fail writes")
+	assert.Equal(t, []string{"Create allow-peter"}, failed)
+
+	m = NewReplicatingManager(replica, primary)
+	assert.Equal(t, errUnavailable, errors.Cause(m.Create(policy)), "a failing primary fails writes")
+
+	m.Preferred = 0
+	p, err := m.Get("allow-peter")
+	require.NoError(t, err, "reads fall back to the other managers")
+	assert.Equal(t, "allow-peter", p.GetID())
+
+	ps, err := m.FindRequestCandidates(&Request{Subject: "peter"})
+	require.NoError(t, err)
+	assert.Len(t, ps, 1)
+
+	m = NewReplicatingManager(primary, NewMemoryManager())
+	m.Preferred = 1
+	_, err = m.Get("allow-peter")
+	assert.Equal(t, ErrNotFound, errors.Cause(err), "ErrNotFound is not a failure")
+}
+
+func TestReplicatingManagerRepair(t *testing.T) {
+	primary, replica := NewMemoryManager(), NewMemoryManager()
+	m := NewReplicatingManager(primary, replica)
+
+	for _, p := range []*DefaultPolicy{
+		{ID: "missing", Subjects: []string{"peter"}, Effect: AllowAccess},
+		{ID: "outdated", Subjects: []string{"peter"}, Effect: AllowAccess},
+		{ID: "in-sync", Subjects: []string{"peter"}, Effect: AllowAccess},
+	} {
+		require.NoError(t, primary.Create(p))
+	}
+	require.NoError(t, replica.Create(&DefaultPolicy{ID: "outdated", Subjects: []string{"ken"}, Effect: AllowAccess}))
+	require.NoError(t, replica.Create(&DefaultPolicy{ID: "in-sync", Subjects: []string{"peter"}, Effect: AllowAccess}))
+	require.NoError(t, replica.Create(&DefaultPolicy{ID: "extra", Subjects: []string{"peter"}, Effect: AllowAccess}))
+
+	drifts, err := m.Check()
+	require.NoError(t, err)
+	assert.Equal(t, []ReplicaDrift{{
+		Replica:  1,
+		Missing:  []string{"missing"},
+		Extra:    []string{"extra"},
+		Outdated: []string{"outdated"},
+	}}, drifts)
+
+	repaired, err := m.Repair()
+	require.NoError(t, err)
+	assert.Equal(t, drifts, repaired)
+
+	drifts, err = m.Check()
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	p, err := replica.Get("outdated")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"peter"}, p.GetSubjects())
+}
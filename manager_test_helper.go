@@ -373,10 +373,10 @@ func testEq(a, b []string) error {
 func TestHelperGetErrors(s Manager) func(t *testing.T) {
 	return func(t *testing.T) {
 		_, err := s.Get(uuid.New())
-		assert.Error(t, err)
+		assert.Equal(t, ErrNotFound, errors.Cause(err))
 
 		_, err = s.Get("asdf")
-		assert.Error(t, err)
+		assert.Equal(t, ErrNotFound, errors.Cause(err))
 	}
 }
 
@@ -387,6 +387,7 @@ func TestHelperCreateGetDelete(s Manager) func(t *testing.T) {
 				_, err := s.Get(c.GetID())
 				require.Error(t, err)
 				require.NoError(t, s.Create(c))
+				require.Equal(t, ErrPolicyExists, errors.Cause(s.Create(c)))
 			})
 
 			t.Run(fmt.Sprintf("case=%d/id=%s/type=query", i, c.GetID()), func(t *testing.T) {
@@ -468,3 +469,19 @@ func TestHelperCreateGetDelete(s Manager) func(t *testing.T) {
 		}
 	}
 }
+
+// TestHelperManager runs the manager conformance suite against s, which must be empty. Use it to test custom
+// managers, for example against a database started with dockertest:
+//
+//	func TestMyManager(t *testing.T) {
+//		t.Run("conformance", ladon.TestHelperManager(NewMyManager(db)))
+//	}
+//
+// FindRequestCandidates and friends may return a superset of the matching policies, which is why managers which
+// filter exactly should additionally run TestHelperFindPoliciesForSubject and TestHelperFindPoliciesForResource.
+func TestHelperManager(s Manager) func(t *testing.T) {
+	return func(t *testing.T) {
+		t.Run("type=get errors", TestHelperGetErrors(s))
+		t.Run("type=CRUD", TestHelperCreateGetDelete(s))
+	}
+}
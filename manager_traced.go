@@ -0,0 +1,134 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+)
+
+// TracedManager wraps a Manager and records a span for every call. Spans are children of the span in Context,
+// which defaults to context.Background().
+type TracedManager struct {
+	Manager Manager
+	Tracer  Tracer
+	Context context.Context
+}
+
+func (m *TracedManager) start(method string) Span {
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	_, span := m.Tracer.Start(ctx, "ladon.Manager."+method)
+	return span
+}
+
+// Create persists the policy.
+func (m *TracedManager) Create(policy Policy) (err error) {
+	span := m.start("Create")
+	span.SetAttribute("ladon.policy", policy.GetID())
+	defer func() { endSpan(span, err) }()
+	return m.Manager.Create(policy)
+}
+
+// Update updates an existing policy.
+func (m *TracedManager) Update(policy Policy) (err error) {
+	span := m.start("Update")
+	span.SetAttribute("ladon.policy", policy.GetID())
+	defer func() { endSpan(span, err) }()
+	return m.Manager.Update(policy)
+}
+
+// Get retrieves a policy.
+func (m *TracedManager) Get(id string) (p Policy, err error) {
+	span := m.start("Get")
+	span.SetAttribute("ladon.policy", id)
+	defer func() { endSpan(span, err) }()
+	return m.Manager.Get(id)
+}
+
+// Delete removes a policy.
+func (m *TracedManager) Delete(id string) (err error) {
+	span := m.start("Delete")
+	span.SetAttribute("ladon.policy", id)
+	defer func() { endSpan(span, err) }()
+	return m.Manager.Delete(id)
+}
+
+// GetAll retrieves all policies.
+func (m *TracedManager) GetAll(limit, offset int64) (ps Policies, err error) {
+	span := m.start("GetAll")
+	defer func() {
+		span.SetAttribute("ladon.policies", len(ps))
+		endSpan(span, err)
+	}()
+	return m.Manager.GetAll(limit, offset)
+}
+
+// FindRequestCandidates returns candidates that could match the request object.
+func (m *TracedManager) FindRequestCandidates(r *Request) (ps Policies, err error) {
+	span := m.start("FindRequestCandidates")
+	defer func() {
+		span.SetAttribute("ladon.policies", len(ps))
+		endSpan(span, err)
+	}()
+	return m.Manager.FindRequestCandidates(r)
+}
+
+// FindPoliciesForSubject returns policies that could match the subject.
+func (m *TracedManager) FindPoliciesForSubject(subject string) (ps Policies, err error) {
+	span := m.start("FindPoliciesForSubject")
+	defer func() {
+		span.SetAttribute("ladon.policies", len(ps))
+		endSpan(span, err)
+	}()
+	return m.Manager.FindPoliciesForSubject(subject)
+}
+
+// FindPoliciesForResource returns policies that could match the resource.
+func (m *TracedManager) FindPoliciesForResource(resource string) (ps Policies, err error) {
+	span := m.start("FindPoliciesForResource")
+	defer func() {
+		span.SetAttribute("ladon.policies", len(ps))
+		endSpan(span, err)
+	}()
+	return m.Manager.FindPoliciesForResource(resource)
+}
+
+// Ping checks the health of the wrapped manager.
+func (m *TracedManager) Ping(ctx context.Context) (err error) {
+	span := m.start("Ping")
+	defer func() { endSpan(span, err) }()
+	return Ping(ctx, m.Manager)
+}
+
+// Close closes the wrapped manager.
+func (m *TracedManager) Close(ctx context.Context) (err error) {
+	span := m.start("Close")
+	defer func() { endSpan(span, err) }()
+	return Close(ctx, m.Manager)
+}
+
+// IndexesLiterals returns true if the wrapped manager looks candidates up verbatim.
+func (m *TracedManager) IndexesLiterals() bool {
+	return IndexesLiterals(m.Manager)
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// PolicyWatcher is implemented by managers which report changes of their policies, including changes made by
+// other processes, so that long-running services can keep warm caches without polling.
+type PolicyWatcher interface {
+	// WatchPolicies returns a channel receiving an event for every policy created, updated or deleted after the
+	// call returned. The channel is closed when ctx is done, the manager is closed or the watch fails; callers
+	// should then reload all policies and watch again. Events are not buffered, so the watch waits for the
+	// receiver.
+	WatchPolicies(ctx context.Context) (<-chan *PolicyEvent, error)
+}
+
+// WatchPolicies watches m for changes, see PolicyWatcher. It returns ErrWatchUnsupported if m does not implement
+// PolicyWatcher.
+//
+// To never miss a change, load the policies after WatchPolicies returned.
+func WatchPolicies(ctx context.Context, m Manager) (<-chan *PolicyEvent, error) {
+	if w, ok := m.(PolicyWatcher); ok {
+		return w.WatchPolicies(ctx)
+	}
+	return nil, errors.WithStack(ErrWatchUnsupported)
+}
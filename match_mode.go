@@ -0,0 +1,160 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MatchMode defines how the subjects, resources and actions of a policy are matched against a request.
+type MatchMode string
+
+const (
+	// MatchModeRegex matches templates containing regular expressions enclosed in the policy's delimiters. It
+	// is the default for policies which do not declare a mode.
+	MatchModeRegex MatchMode = "regex"
+
+	// MatchModeExact matches templates verbatim.
+	MatchModeExact MatchMode = "exact"
+
+	// MatchModeGlob matches templates where * matches any sequence of characters and ? matches a single one.
+	MatchModeGlob MatchMode = "glob"
+
+	// MatchModeHierarchical matches a resource template itself and everything below it, where levels are separated
+	// by colons: "resources:articles" matches "resources:articles" and "resources:articles:1", but not
+	// "resources:articles-archive". A template ending in ":*" matches everything below it, but not itself.
+	// Subjects and actions are matched exactly. Use a HierarchicalMatcher to separate levels by another delimiter.
+	MatchModeHierarchical MatchMode = "hierarchical"
+)
+
+// MatchModePolicy is implemented by policies which declare their own match mode, so that policies written for
+// different matching strategies can coexist in one store.
+type MatchModePolicy interface {
+	// GetMatchMode returns the policies match mode. An empty mode is the same as MatchModeRegex.
+	GetMatchMode() MatchMode
+}
+
+// PolicyMatchMode returns the match mode declared by p, or MatchModeRegex if it declares none.
+func PolicyMatchMode(p Policy) MatchMode {
+	if mp, ok := p.(MatchModePolicy); ok && mp.GetMatchMode() != "" {
+		return mp.GetMatchMode()
+	}
+	return MatchModeRegex
+}
+
+// ValidateMatchMode returns an error if the match mode of the policy is not known. Managers call this before
+// writing a policy.
+func ValidateMatchMode(p Policy) error {
+	switch PolicyMatchMode(p) {
+	case MatchModeRegex, MatchModeExact, MatchModeGlob, MatchModeHierarchical:
+		return nil
+	}
+	return errors.Errorf(`Policy "%s" has unknown match mode "%s"`, p.GetID(), PolicyMatchMode(p))
+}
+
+// IsLiteralTemplate returns true if template, as used by p, matches nothing but itself. Templates containing
+// SubjectPlaceholder are never literal, because they match a different value per subject.
+func IsLiteralTemplate(p Policy, template string) bool {
+	if strings.Contains(template, SubjectPlaceholder) {
+		return false
+	}
+
+	switch PolicyMatchMode(p) {
+	case MatchModeExact:
+		return true
+	case MatchModeRegex:
+		return strings.IndexByte(template, p.GetStartDelimiter()) < 0
+	case MatchModeGlob:
+		return !strings.ContainsAny(template, "*?")
+	}
+	return false
+}
+
+// matchesMode matches a needle with the templates of a policy which does not use MatchModeRegex. If fold is true,
+// templates and needle are compared case-insensitively.
+func matchesMode(mode MatchMode, haystack []string, needle string, fold bool) (bool, error) {
+	var match func(template, needle string) bool
+	switch mode {
+	case MatchModeExact:
+		match = func(template, needle string) bool { return template == needle }
+	case MatchModeGlob:
+		match = matchGlob
+	case MatchModeHierarchical:
+		match = matchHierarchical
+	default:
+		return false, errors.Errorf(`Unknown match mode "%s"`, mode)
+	}
+
+	if fold {
+		needle = strings.ToLower(needle)
+	}
+
+	for _, h := range haystack {
+		if fold {
+			h = strings.ToLower(h)
+		}
+		if match(h, needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchGlob(pattern, s string) bool {
+	// star and next remember the position of the last * and the input it was matched against, so that we can
+	// backtrack by letting the star consume one more character.
+	p, i, star, next := 0, 0, -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case star >= 0:
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func matchHierarchical(template, s string) bool {
+	return matchPath(template, s, ":")
+}
+
+// matchPath returns true if s is template or below it, where levels are separated by delimiter.
+func matchPath(template, s, delimiter string) bool {
+	if strings.HasSuffix(template, delimiter+"*") {
+		parent := template[:len(template)-1]
+		return len(s) > len(parent) && strings.HasPrefix(s, parent)
+	}
+	return s == template || strings.HasPrefix(s, template+delimiter)
+}
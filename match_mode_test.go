@@ -0,0 +1,109 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestMatchMode(t *testing.T) {
+	for k, c := range []struct {
+		mode     MatchMode
+		template string
+		needle   string
+		expect   bool
+	}{
+		{mode: "", template: "articles:<[0-9]+>", needle: "articles:1", expect: true},
+		{mode: MatchModeRegex, template: "articles:<[0-9]+>", needle: "articles:a", expect: false},
+		{mode: MatchModeExact, template: "articles:<[0-9]+>", needle: "articles:1", expect: false},
+		{mode: MatchModeExact, template: "articles:<[0-9]+>", needle: "articles:<[0-9]+>", expect: true},
+		{mode: MatchModeGlob, template: "articles:*", needle: "articles:1", expect: true},
+		{mode: MatchModeGlob, template: "articles:*", needle: "articles:", expect: true},
+		{mode: MatchModeGlob, template: "articles:?", needle: "articles:12", expect: false},
+		{mode: MatchModeGlob, template: "*:1:*", needle: "articles:1:comments", expect: true},
+		{mode: MatchModeGlob, template: "*:1:*", needle: "articles:2:comments", expect: false},
+		{mode: MatchModeGlob, template: "a*b*c", needle: "abcbc", expect: true},
+		{mode: MatchModeHierarchical, template: "articles", needle: "articles", expect: true},
+		{mode: MatchModeHierarchical, template: "articles", needle: "articles:1:comments", expect: true},
+		{mode: MatchModeHierarchical, template: "articles", needle: "articles-archive", expect: false},
+		{mode: MatchModeHierarchical, template: "articles:1", needle: "articles", expect: false},
+		{mode: MatchModeHierarchical, template: "articles:*", needle: "articles:1:comments", expect: true},
+		{mode: MatchModeHierarchical, template: "articles:*", needle: "articles", expect: false},
+		{mode: MatchModeHierarchical, template: "articles:*", needle: "articles:", expect: false},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			p := &DefaultPolicy{MatchMode: c.mode}
+			matched, err := DefaultMatcher.Matches(p, []string{c.template}, c.needle)
+			require.NoError(t, err)
+			assert.Equal(t, c.expect, matched)
+		})
+	}
+
+	_, err := DefaultMatcher.Matches(&DefaultPolicy{MatchMode: "fuzzy"}, []string{"a"}, "a")
+	assert.Error(t, err)
+}
+
+func TestMatchModeWarden(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "1", Subjects: []string{"<alice|bob>"}, Actions: []string{"read"}, Resources: []string{"articles:<.+>"}, Effect: AllowAccess},
+		{ID: "2", Subjects: []string{"carol"}, Actions: []string{"*"}, Resources: []string{"articles:*"}, Effect: AllowAccess, MatchMode: MatchModeGlob},
+		{ID: "3", Subjects: []string{"dave"}, Actions: []string{"read"}, Resources: []string{"articles"}, Effect: AllowAccess, MatchMode: MatchModeHierarchical},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "4", Effect: AllowAccess, MatchMode: "fuzzy"}))
+
+	w := &Ladon{Manager: m}
+	for k, c := range []struct {
+		r      *Request
+		expect bool
+	}{
+		{r: &Request{Subject: "alice", Action: "read", Resource: "articles:1"}, expect: true},
+		{r: &Request{Subject: "carol", Action: "delete", Resource: "articles:1"}, expect: true},
+		{r: &Request{Subject: "<alice|bob>", Action: "read", Resource: "articles:1"}, expect: false},
+		{r: &Request{Subject: "dave", Action: "read", Resource: "articles:1:comments"}, expect: true},
+		{r: &Request{Subject: "dave", Action: "write", Resource: "articles:1"}, expect: false},
+		{r: &Request{Subject: "dave:x", Action: "read", Resource: "articles:1"}, expect: false},
+		{r: &Request{Subject: "dave", Action: "read:secrets", Resource: "articles:1"}, expect: false},
+	} {
+		assert.Equal(t, c.expect, w.IsAllowed(c.r) == nil, "case %d", k)
+	}
+}
+
+func TestMatchModeJSON(t *testing.T) {
+	out, err := json.Marshal(&DefaultPolicy{ID: "1"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "match_mode")
+
+	var p DefaultPolicy
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"1","match_mode":"glob"}`), &p))
+	assert.Equal(t, MatchModeGlob, p.GetMatchMode())
+}
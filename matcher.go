@@ -24,4 +24,12 @@ type matcher interface {
 	Matches(p Policy, haystack []string, needle string) (matches bool, error error)
 }
 
+// FieldMatcher is implemented by matchers which match the subjects, actions and resources of a policy differently.
+// Ladon calls MatchesField instead of Matches if its Matcher implements it.
+type FieldMatcher interface {
+	// MatchesField returns true if needle, the given field of a request, matches one of the templates in
+	// haystack.
+	MatchesField(p Policy, field RequestField, haystack []string, needle string) (bool, error)
+}
+
 var DefaultMatcher = NewRegexpMatcher(512)
@@ -0,0 +1,72 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+// HierarchicalMatcher matches the templates of policies as hierarchical paths, so a Ladon instance can express
+// hierarchies such as "org:team:project" without regular expressions: a policy on "org:team" applies to
+// "org:team" and everything below it, a policy on "org:team:*" only to everything below it.
+//
+// The resources of policies declaring MatchModeHierarchical are matched as paths, their subjects and actions
+// exactly. Policies declaring any other mode, or none, are delegated to Matcher.
+type HierarchicalMatcher struct {
+	// Delimiter separates the levels of a path. It defaults to ":".
+	Delimiter string
+
+	// Matcher matches policies which do not declare MatchModeHierarchical. It defaults to DefaultMatcher.
+	Matcher matcher
+}
+
+// NewHierarchicalMatcher returns a HierarchicalMatcher separating levels by delimiter.
+func NewHierarchicalMatcher(delimiter string) *HierarchicalMatcher {
+	return &HierarchicalMatcher{Delimiter: delimiter}
+}
+
+// Matches matches needle as a resource, see MatchesField.
+func (m *HierarchicalMatcher) Matches(p Policy, haystack []string, needle string) (bool, error) {
+	return m.MatchesField(p, RequestResource, haystack, needle)
+}
+
+// MatchesField returns true if needle is one of the templates in haystack. If it is a resource and p declares
+// MatchModeHierarchical, it also returns true if needle is below one of them.
+func (m *HierarchicalMatcher) MatchesField(p Policy, field RequestField, haystack []string, needle string) (bool, error) {
+	if PolicyMatchMode(p) != MatchModeHierarchical {
+		var delegate matcher = DefaultMatcher
+		if m.Matcher != nil {
+			delegate = m.Matcher
+		}
+
+		if fm, ok := delegate.(FieldMatcher); ok {
+			return fm.MatchesField(p, field, haystack, needle)
+		}
+		return delegate.Matches(p, haystack, needle)
+	}
+
+	delimiter := m.Delimiter
+	if delimiter == "" {
+		delimiter = ":"
+	}
+
+	for _, h := range haystack {
+		if h == needle || (field == RequestResource && matchPath(h, needle, delimiter)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
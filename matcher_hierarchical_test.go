@@ -0,0 +1,64 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestHierarchicalMatcher(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "1", Subjects: []string{"users/peter"}, Actions: []string{"read"}, Resources: []string{"org/team"}, Effect: AllowAccess, MatchMode: MatchModeHierarchical},
+		{ID: "2", Subjects: []string{"users/peter"}, Actions: []string{"read"}, Resources: []string{"org/team/secrets/*"}, Effect: DenyAccess, MatchMode: MatchModeHierarchical},
+		{ID: "3", Subjects: []string{"<.*>"}, Actions: []string{"list"}, Resources: []string{"org/<[a-z]+>"}, Effect: AllowAccess, MatchMode: MatchModeRegex},
+		{ID: "4", Subjects: []string{"max"}, Actions: []string{"get"}, Resources: []string{"docs"}, Effect: AllowAccess},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	warden := &Ladon{Manager: m, Matcher: NewHierarchicalMatcher("/")}
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "users/peter", Action: "read", Resource: "org/team"}, allowed: true},
+		{r: &Request{Subject: "users/peter", Action: "read", Resource: "org/team/project"}, allowed: true},
+		{r: &Request{Subject: "users/peter", Action: "read", Resource: "org/teams"}, allowed: false},
+		{r: &Request{Subject: "users/peter", Action: "read", Resource: "org"}, allowed: false},
+		{r: &Request{Subject: "users/peter", Action: "read", Resource: "org/team/secrets"}, allowed: true},
+		{r: &Request{Subject: "users/peter", Action: "read", Resource: "org/team/secrets/keys"}, allowed: false},
+		{r: &Request{Subject: "users/peter", Action: "read:all", Resource: "org/team"}, allowed: false},
+		{r: &Request{Subject: "users/peter", Action: "read/all", Resource: "org/team"}, allowed: false},
+		{r: &Request{Subject: "users/peter/x", Action: "read", Resource: "org/team"}, allowed: false},
+		{r: &Request{Subject: "max", Action: "list", Resource: "org/team"}, allowed: true},
+		{r: &Request{Subject: "max", Action: "list", Resource: "org/team/project"}, allowed: false},
+		{r: &Request{Subject: "max", Action: "get", Resource: "docs"}, allowed: true},
+		{r: &Request{Subject: "max", Action: "get", Resource: "docs/1"}, allowed: false},
+	} {
+		assert.Equal(t, c.allowed, warden.IsAllowed(c.r) == nil, "case %d", k)
+	}
+}
@@ -22,6 +22,7 @@ package ladon
 
 import (
 	"strings"
+	"time"
 
 	"github.com/dlclark/regexp2"
 	"github.com/hashicorp/golang-lru"
@@ -42,10 +43,41 @@ func NewRegexpMatcher(size int) *RegexpMatcher {
 	}
 }
 
+// NewCaseInsensitiveMatcher returns a RegexpMatcher which matches subjects, resources and actions regardless of
+// their case, for identifiers coming from systems with inconsistent casing. It can not be used with managers
+// implementing LiteralIndexer.
+func NewCaseInsensitiveMatcher(size int) *RegexpMatcher {
+	m := NewRegexpMatcher(size)
+	m.IgnoreCase = true
+	return m
+}
+
+// foldsCase returns true if m matches regardless of case.
+func foldsCase(m matcher) bool {
+	switch m := m.(type) {
+	case *RegexpMatcher:
+		return m.IgnoreCase
+	case *HierarchicalMatcher:
+		if m.Matcher == nil {
+			return foldsCase(DefaultMatcher)
+		}
+		return foldsCase(m.Matcher)
+	}
+	return false
+}
+
 type RegexpMatcher struct {
 	*lru.Cache
 
 	C map[string]*regexp2.Regexp
+
+	// IgnoreCase matches templates case-insensitively, in all match modes. Regular expressions are compiled with
+	// regexp2.IgnoreCase.
+	IgnoreCase bool
+
+	// MatchTimeout aborts the evaluation of a regular expression against a single value, failing the request. It
+	// defaults to 250 milliseconds.
+	MatchTimeout time.Duration
 }
 
 func (m *RegexpMatcher) get(pattern string) *regexp2.Regexp {
@@ -63,23 +95,47 @@ func (m *RegexpMatcher) set(pattern string, reg *regexp2.Regexp) {
 }
 
 // Matches a needle with an array of regular expressions and returns true if a match was found.
+//
+// Templates without delimiters are compared with == before any regular expression is looked up, so policies made
+// of exact strings never touch the expression cache.
+// MatchesField matches like Matches, except that the subjects and actions of policies declaring
+// MatchModeHierarchical are matched exactly, so that only resources are matched as paths.
+func (m *RegexpMatcher) MatchesField(p Policy, field RequestField, haystack []string, needle string) (bool, error) {
+	if field != RequestResource && PolicyMatchMode(p) == MatchModeHierarchical {
+		return matchesMode(MatchModeExact, haystack, needle, m.IgnoreCase)
+	}
+	return m.Matches(p, haystack, needle)
+}
+
 func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (bool, error) {
-	var reg *regexp2.Regexp
-	var err error
+	if mode := PolicyMatchMode(p); mode != MatchModeRegex {
+		return matchesMode(mode, haystack, needle, m.IgnoreCase)
+	}
+
+	start := p.GetStartDelimiter()
+	patterns := false
 	for _, h := range haystack {
+		if strings.IndexByte(h, start) >= 0 {
+			patterns = true
+		} else if h == needle || (m.IgnoreCase && strings.EqualFold(h, needle)) {
+			return true, nil
+		}
+	}
 
-		// This means that the current haystack item does not contain a regular expression
-		if strings.Count(h, string(p.GetStartDelimiter())) == 0 {
-			// If we have a simple string match, we've got a match!
-			if h == needle {
-				return true, nil
-			}
+	if !patterns {
+		return false, nil
+	}
 
-			// Not string match, but also no regexp, continue with next haystack item
+	var reg *regexp2.Regexp
+	var err error
+	for _, h := range haystack {
+		// Templates without a regular expression were compared above.
+		if strings.IndexByte(h, start) < 0 {
 			continue
 		}
 
-		if reg = m.get(h); reg != nil {
+		key := regexpCacheKey(p, h, m.IgnoreCase)
+		if reg = m.get(key); reg != nil {
 			if matched, err := reg.MatchString(needle); err != nil {
 				// according to regexp2 documentation: https://github.com/dlclark/regexp2#usage
 				// The only error that the *Match* methods should return is a Timeout if you set the
@@ -91,12 +147,21 @@ func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (boo
 			continue
 		}
 
-		reg, err = compiler.CompileRegex(h, p.GetStartDelimiter(), p.GetEndDelimiter())
+		options := regexp2.RegexOptions(regexp2.RE2)
+		if m.IgnoreCase {
+			options |= regexp2.IgnoreCase
+		}
+
+		reg, err = compiler.CompileRegexOptions(h, p.GetStartDelimiter(), p.GetEndDelimiter(), options)
 		if err != nil {
 			return false, errors.WithStack(err)
 		}
 
-		m.set(h, reg)
+		if m.MatchTimeout > 0 {
+			reg.MatchTimeout = m.MatchTimeout
+		}
+
+		m.set(key, reg)
 		if matched, err := reg.MatchString(needle); err != nil {
 			// according to regexp2 documentation: https://github.com/dlclark/regexp2#usage
 			// The only error that the *Match* methods should return is a Timeout if you set the
@@ -108,3 +173,18 @@ func (m *RegexpMatcher) Matches(p Policy, haystack []string, needle string) (boo
 	}
 	return false, nil
 }
+
+// regexpCacheKey returns the key of template in the cache of compiled expressions. Templates of policies with
+// other than the default delimiters, and templates compiled to ignore case, are prefixed with their delimiters and
+// options, because the same template compiles to different expressions.
+func regexpCacheKey(p Policy, template string, fold bool) string {
+	start, end := p.GetStartDelimiter(), p.GetEndDelimiter()
+	if start == DefaultStartDelimiter && end == DefaultEndDelimiter && !fold {
+		return template
+	}
+
+	if fold {
+		return string([]byte{start, end, 'i', 0}) + template
+	}
+	return string([]byte{start, end, 0}) + template
+}
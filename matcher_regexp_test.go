@@ -0,0 +1,155 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkg/errors"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestRegexpMatcherExactFastPath(t *testing.T) {
+	m := NewRegexpMatcher(16)
+	p := &DefaultPolicy{}
+
+	matched, err := m.Matches(p, []string{"articles:<[0-9]+>", "articles:latest"}, "articles:latest")
+	require.NoError(t, err)
+	assert.True(t, matched)
+	assert.Equal(t, 0, m.Cache.Len(), "exact templates are compared before regular expressions are compiled")
+
+	matched, err = m.Matches(p, []string{"articles:<[0-9]+>", "articles:latest"}, "articles:1")
+	require.NoError(t, err)
+	assert.True(t, matched)
+	assert.Equal(t, 1, m.Cache.Len())
+
+	matched, err = m.Matches(p, []string{"articles:latest", "articles:archive"}, "articles:1")
+	require.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestRegexpMatcherTimeout(t *testing.T) {
+	m := NewRegexpMatcher(16)
+	m.MatchTimeout = time.Millisecond
+
+	// Policies created before RegexLimits were enforced may still contain catastrophic expressions.
+	_, err := m.Matches(&DefaultPolicy{}, []string{"<(a+)+b>"}, strings.Repeat("a", 64))
+	assert.Error(t, err)
+}
+
+func BenchmarkRegexpMatcher(b *testing.B) {
+	p := &DefaultPolicy{}
+	haystack := make([]string, 0, 100)
+	for i := 0; i < 99; i++ {
+		haystack = append(haystack, fmt.Sprintf("articles:%d", i))
+	}
+
+	for name, template := range map[string]string{"exact": "articles:latest", "regex": "articles:<latest|newest>"} {
+		b.Run("template="+name, func(b *testing.B) {
+			m := NewRegexpMatcher(512)
+			haystack := append(haystack, template)
+			for n := 0; n < b.N; n++ {
+				if matched, _ := m.Matches(p, haystack, "articles:latest"); !matched {
+					b.Fatal("expected a match")
+				}
+			}
+		})
+	}
+}
+
+func TestCaseInsensitiveMatcher(t *testing.T) {
+	m := NewCaseInsensitiveMatcher(16)
+	for k, c := range []struct {
+		mode     MatchMode
+		template string
+		needle   string
+		expect   bool
+	}{
+		{mode: MatchModeRegex, template: "users:Peter", needle: "USERS:peter", expect: true},
+		{mode: MatchModeRegex, template: "articles:<[a-z]+>", needle: "Articles:ABC", expect: true},
+		{mode: MatchModeRegex, template: "articles:<[a-z]+>", needle: "articles:123", expect: false},
+		{mode: MatchModeExact, template: "users:Peter", needle: "users:PETER", expect: true},
+		{mode: MatchModeGlob, template: "Users:*", needle: "users:peter", expect: true},
+		{mode: MatchModeHierarchical, template: "Org:Team", needle: "org:team:project", expect: true},
+		{mode: MatchModeHierarchical, template: "Org:Team", needle: "org:teams", expect: false},
+	} {
+		matched, err := m.Matches(&DefaultPolicy{MatchMode: c.mode}, []string{c.template}, c.needle)
+		require.NoError(t, err)
+		assert.Equal(t, c.expect, matched, "case %d", k)
+	}
+
+	matched, err := DefaultMatcher.Matches(&DefaultPolicy{}, []string{"users:Peter"}, "users:peter")
+	require.NoError(t, err)
+	assert.False(t, matched, "matching is case-sensitive by default")
+}
+
+func TestCaseInsensitiveMatcherCache(t *testing.T) {
+	m := NewRegexpMatcher(16)
+	p := &DefaultPolicy{}
+
+	matched, err := m.Matches(p, []string{"users:<[a-z]+>"}, "users:PETER")
+	require.NoError(t, err)
+	assert.False(t, matched)
+
+	m.IgnoreCase = true
+	matched, err = m.Matches(p, []string{"users:<[a-z]+>"}, "users:PETER")
+	require.NoError(t, err)
+	assert.True(t, matched, "changing IgnoreCase must not serve the expression compiled before")
+}
+
+// indexingManager looks candidates up verbatim, like the bbolt manager.
+type indexingManager struct {
+	*MemoryManager
+}
+
+func (m *indexingManager) IndexesLiterals() bool {
+	return true
+}
+
+func TestCaseInsensitiveMatcherIndex(t *testing.T) {
+	m := &indexingManager{MemoryManager: NewMemoryManager()}
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Resources: []string{"articles"}, Actions: []string{"get"}, Effect: AllowAccess}))
+
+	for k, manager := range []Manager{m, &EventingManager{Manager: m}, NewBreakerManager(m, 0)} {
+		warden := &Ladon{Manager: manager, Matcher: NewCaseInsensitiveMatcher(16)}
+		err := warden.IsAllowed(&Request{Subject: "peter", Resource: "articles", Action: "get"})
+		assert.Equal(t, ErrCaseInsensitiveIndex, errors.Cause(err), "case %d", k)
+
+		_, err = warden.Capabilities(&Request{Subject: "peter", Resource: "articles"})
+		assert.Equal(t, ErrCaseInsensitiveIndex, errors.Cause(err), "case %d", k)
+
+		_, err = warden.Audience("articles", "get")
+		assert.Equal(t, ErrCaseInsensitiveIndex, errors.Cause(err), "case %d", k)
+
+		warden.Matcher = NewRegexpMatcher(16)
+		assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Resource: "articles", Action: "get"}), "case %d", k)
+	}
+
+	warden := &Ladon{Manager: m.MemoryManager, Matcher: NewCaseInsensitiveMatcher(16)}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "PETER", Resource: "articles", Action: "get"}))
+}
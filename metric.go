@@ -20,6 +20,8 @@
 
 package ladon
 
+import "time"
+
 // Metric is used to expose metrics about authz
 type Metric interface {
 	// RequestDeniedBy is called when we get explicit deny by policy
@@ -31,3 +33,22 @@ type Metric interface {
 	// RequestProcessingError is called when unexpected error occured
 	RequestProcessingError(Request, Policy, error)
 }
+
+// LatencyMetric is an optional extension of Metric. If the Metric of a Ladon instance implements it, candidate
+// counts and latencies are reported as well.
+type LatencyMetric interface {
+	// RequestCandidates is called with the number of policies the manager returned for a request.
+	RequestCandidates(Request, int)
+	// MatchDuration is called with the time it took to match a request value against a policy.
+	MatchDuration(time.Duration)
+	// ManagerQueryDuration is called with the time a manager call took.
+	ManagerQueryDuration(method string, d time.Duration)
+}
+
+// CandidateQuotaMetric is an optional extension of Metric. If the Metric of a Ladon instance implements it, it is
+// notified when the manager returns more candidates for a request than Ladon.CandidateQuota allows.
+type CandidateQuotaMetric interface {
+	// CandidateQuotaExceeded is called with the number of candidates and the regular expression subject templates
+	// of the candidates, the most frequent first. These usually are the wildcard policies responsible.
+	CandidateQuotaExceeded(r Request, candidates int, patterns []string)
+}
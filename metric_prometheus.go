@@ -0,0 +1,246 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the histogram buckets (in seconds) used by PrometheusMetric for latencies.
+var DefaultLatencyBuckets = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+
+// DefaultCandidateBuckets are the histogram buckets used by PrometheusMetric for candidate counts.
+var DefaultCandidateBuckets = []float64{0, 1, 5, 10, 50, 100, 500, 1000, 5000}
+
+// PrometheusMetric is a Metric and LatencyMetric which exposes decision counts, candidate counts, regular
+// expression match durations and manager latencies in the Prometheus text exposition format. Mount it as
+// an http.Handler on the path scraped by Prometheus.
+type PrometheusMetric struct {
+	// Namespace prefixes all metric names. Defaults to "ladon".
+	Namespace string
+
+	decisions  map[string]uint64
+	quota      map[string]uint64
+	candidates *histogram
+	matches    *histogram
+	queries    map[string]*histogram
+	sync.Mutex
+}
+
+// NewPrometheusMetric returns a PrometheusMetric using the "ladon" namespace.
+func NewPrometheusMetric() *PrometheusMetric {
+	return &PrometheusMetric{
+		Namespace:  "ladon",
+		decisions:  map[string]uint64{},
+		quota:      map[string]uint64{},
+		candidates: newHistogram(DefaultCandidateBuckets),
+		matches:    newHistogram(DefaultLatencyBuckets),
+		queries:    map[string]*histogram{},
+	}
+}
+
+func (m *PrometheusMetric) decision(outcome string) {
+	m.Lock()
+	defer m.Unlock()
+	m.decisions[outcome]++
+}
+
+// RequestDeniedBy counts a request which was explicitly denied by a policy.
+func (m *PrometheusMetric) RequestDeniedBy(r Request, p Policy) {
+	m.decision("denied")
+}
+
+// RequestAllowedBy counts a request which was allowed.
+func (m *PrometheusMetric) RequestAllowedBy(r Request, p Policies) {
+	m.decision("allowed")
+}
+
+// RequestNoMatch counts a request which was not matched by any policy.
+func (m *PrometheusMetric) RequestNoMatch(r Request) {
+	m.decision("no_match")
+}
+
+// RequestProcessingError counts a request which could not be processed.
+func (m *PrometheusMetric) RequestProcessingError(r Request, p Policy, err error) {
+	m.decision("error")
+}
+
+// RequestCandidates observes the number of policies returned by the manager.
+func (m *PrometheusMetric) RequestCandidates(r Request, count int) {
+	m.Lock()
+	defer m.Unlock()
+	m.candidates.observe(float64(count))
+}
+
+// CandidateQuotaExceeded counts requests exceeding the candidate quota by the most frequent subject pattern.
+func (m *PrometheusMetric) CandidateQuotaExceeded(r Request, candidates int, patterns []string) {
+	var pattern string
+	if len(patterns) > 0 {
+		pattern = patterns[0]
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.quota == nil {
+		m.quota = map[string]uint64{}
+	}
+	m.quota[pattern]++
+}
+
+// MatchDuration observes the time it took to match a request value against a policy.
+func (m *PrometheusMetric) MatchDuration(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.matches.observe(d.Seconds())
+}
+
+// ManagerQueryDuration observes the time a manager call took.
+func (m *PrometheusMetric) ManagerQueryDuration(method string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	h, ok := m.queries[method]
+	if !ok {
+		h = newHistogram(DefaultLatencyBuckets)
+		m.queries[method] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (m *PrometheusMetric) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format to w.
+func (m *PrometheusMetric) WriteTo(w io.Writer) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	ns := m.Namespace
+	if ns == "" {
+		ns = "ladon"
+	}
+
+	cw := &countingWriter{w: w}
+	fmt.Fprintf(cw, "# HELP %s_decisions_total Number of access requests by outcome.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_decisions_total counter\n", ns)
+	for _, outcome := range sortedKeys(m.decisions) {
+		fmt.Fprintf(cw, "%s_decisions_total{outcome=%q} %d\n", ns, outcome, m.decisions[outcome])
+	}
+
+	fmt.Fprintf(cw, "# HELP %s_candidate_quota_exceeded_total Number of requests exceeding the candidate quota by subject pattern.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_candidate_quota_exceeded_total counter\n", ns)
+	for _, pattern := range sortedKeys(m.quota) {
+		fmt.Fprintf(cw, "%s_candidate_quota_exceeded_total{pattern=%q} %d\n", ns, pattern, m.quota[pattern])
+	}
+
+	fmt.Fprintf(cw, "# HELP %s_request_candidates Number of policies returned by the manager per request.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_request_candidates histogram\n", ns)
+	m.candidates.write(cw, ns+"_request_candidates", "")
+
+	fmt.Fprintf(cw, "# HELP %s_match_duration_seconds Time spent matching request values against policies.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_match_duration_seconds histogram\n", ns)
+	m.matches.write(cw, ns+"_match_duration_seconds", "")
+
+	fmt.Fprintf(cw, "# HELP %s_manager_query_duration_seconds Latency of manager calls.\n", ns)
+	fmt.Fprintf(cw, "# TYPE %s_manager_query_duration_seconds histogram\n", ns)
+	methods := make([]string, 0, len(m.queries))
+	for method := range m.queries {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		m.queries[method].write(cw, ns+"_manager_query_duration_seconds", fmt.Sprintf("method=%q", method))
+	}
+
+	return cw.n, cw.err
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+}
+
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestPrometheusMetric(t *testing.T) {
+	metric := NewPrometheusMetric()
+	warden := &Ladon{Manager: NewMemoryManager(), Metric: metric}
+	require.NoError(t, warden.Manager.Create(&DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Resources: []string{"<.*>"},
+		Actions:   []string{"get"},
+		Effect:    AllowAccess,
+	}))
+
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:2"}))
+	metric.RequestDeniedBy(Request{}, nil)
+
+	rec := httptest.NewRecorder()
+	metric.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, expected := range []string{
+		`ladon_decisions_total{outcome="allowed"} 2`,
+		`ladon_decisions_total{outcome="denied"} 1`,
+		`ladon_request_candidates_bucket{le="1"} 2`,
+		`ladon_request_candidates_bucket{le="0"} 0`,
+		`ladon_request_candidates_sum 2`,
+		`ladon_match_duration_seconds_count 6`,
+		`ladon_manager_query_duration_seconds_bucket{method="FindRequestCandidates",le="+Inf"} 2`,
+		`ladon_manager_query_duration_seconds_count{method="FindRequestCandidates"} 2`,
+	} {
+		assert.True(t, strings.Contains(body, expected), "%s not found in:\n%s", expected, body)
+	}
+}
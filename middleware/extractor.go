@@ -0,0 +1,161 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+type contextKey int
+
+const requestKey contextKey = 0
+
+// NewContext returns a copy of ctx carrying the access request. The middleware passes it to the next handler.
+func NewContext(ctx context.Context, r *ladon.Request) context.Context {
+	return context.WithValue(ctx, requestKey, r)
+}
+
+// FromContext returns the access request authorized by the middleware.
+func FromContext(ctx context.Context) (*ladon.Request, bool) {
+	r, ok := ctx.Value(requestKey).(*ladon.Request)
+	return r, ok
+}
+
+// SubjectFromContext extracts the subject from a string stored in the request's context under key, for example
+// by an authentication middleware.
+func SubjectFromContext(key interface{}) Extractor {
+	return func(r *http.Request) (string, error) {
+		if subject, ok := r.Context().Value(key).(string); ok && subject != "" {
+			return subject, nil
+		}
+		return "", errors.New("Request context carries no subject")
+	}
+}
+
+// TokenVerifier verifies a bearer token, for example a JWT, and returns its claims. It must check the token's
+// signature and expiry.
+type TokenVerifier func(ctx context.Context, token string) (map[string]interface{}, error)
+
+// SubjectFromJWT extracts the subject from a claim, usually "sub", of the bearer token in the Authorization header.
+func SubjectFromJWT(verify TokenVerifier, claim string) Extractor {
+	return func(r *http.Request) (string, error) {
+		auth := r.Header.Get("Authorization")
+		if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+			return "", errors.New("Request carries no bearer token")
+		}
+
+		claims, err := verify(r.Context(), strings.TrimSpace(auth[7:]))
+		if err != nil {
+			return "", err
+		}
+
+		if subject, ok := claims[claim].(string); ok && subject != "" {
+			return subject, nil
+		}
+		return "", errors.Errorf("Token carries no claim %s", claim)
+	}
+}
+
+// ResourceFromTemplate builds the resource from a template whose {name} placeholders are replaced by the path
+// values of the route, see http.Request.PathValue. For example, the template "articles:{id}" yields
+// "articles:1234" for the route "/articles/{id}".
+func ResourceFromTemplate(template string) Extractor {
+	return func(r *http.Request) (string, error) {
+		var out strings.Builder
+		rest := template
+		for {
+			start := strings.IndexByte(rest, '{')
+			if start < 0 {
+				break
+			}
+
+			end := strings.IndexByte(rest[start:], '}')
+			if end < 0 {
+				return "", errors.Errorf("Resource template %s has an unterminated placeholder", template)
+			}
+
+			name := rest[start+1 : start+end]
+			value := r.PathValue(name)
+			if value == "" {
+				return "", errors.Errorf("Route has no path value %s", name)
+			}
+
+			out.WriteString(rest[:start])
+			out.WriteString(value)
+			rest = rest[start+end+1:]
+		}
+
+		out.WriteString(rest)
+		return out.String(), nil
+	}
+}
+
+// ActionFromMethod maps the HTTP method to an action, for example {"GET": "read"}. Methods which are not mapped
+// are returned in lower case, which is also the behavior for a nil map.
+func ActionFromMethod(actions map[string]string) Extractor {
+	return func(r *http.Request) (string, error) {
+		if action, ok := actions[r.Method]; ok {
+			return action, nil
+		}
+		return strings.ToLower(r.Method), nil
+	}
+}
+
+// Static always returns value, for example a fixed resource of a handler.
+func Static(value string) Extractor {
+	return func(r *http.Request) (string, error) {
+		return value, nil
+	}
+}
+
+// ContextFromRemoteAddress stores the client's IP address under key, for example for the CIDRCondition.
+func ContextFromRemoteAddress(e *ladon.RemoteAddressExtractor, key string) ContextExtractor {
+	return func(r *http.Request) (ladon.Context, error) {
+		ip, err := e.Extract(r)
+		if err != nil {
+			return nil, err
+		}
+		return ladon.Context{key: ip}, nil
+	}
+}
+
+// Contexts merges the contexts of several extractors. Later extractors overwrite values of earlier ones.
+func Contexts(extractors ...ContextExtractor) ContextExtractor {
+	return func(r *http.Request) (ladon.Context, error) {
+		out := ladon.Context{}
+		for _, extract := range extractors {
+			c, err := extract(r)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range c {
+				out[k] = v
+			}
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package middleware authorizes HTTP requests with a ladon Warden.
+//
+//	m := middleware.New(warden, middleware.SubjectFromContext(userKey), middleware.ResourceFromTemplate("articles:{id}"))
+//	mux.Handle("GET /articles/{id}", m.Handler(articles))
+//
+// The middleware builds a ladon Request from configurable extractors and calls the next handler only if the
+// warden allows the request. Otherwise it responds with a JSON error and the status code of the error, which is
+// 403 Forbidden for denied requests.
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+// Extractor extracts a part of the access request, for example the subject, from a HTTP request.
+type Extractor func(r *http.Request) (string, error)
+
+// ContextExtractor extracts the context of the access request from a HTTP request.
+type ContextExtractor func(r *http.Request) (ladon.Context, error)
+
+// Middleware authorizes HTTP requests. Use New to construct it.
+type Middleware struct {
+	// Warden decides whether requests are allowed.
+	Warden ladon.Warden
+
+	// Subject, Resource and Action extract the respective part of the access request. Action defaults to
+	// ActionFromMethod(nil).
+	Subject  Extractor
+	Resource Extractor
+	Action   Extractor
+
+	// Tenant optionally extracts the tenant of the access request.
+	Tenant Extractor
+
+	// Context optionally extracts the context of the access request. Multiple extractors can be combined with
+	// Contexts.
+	Context ContextExtractor
+
+	// ErrorWriter writes the response if a request is not authorized. Defaults to WriteError.
+	ErrorWriter func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// New returns a Middleware extracting the subject and resource with the given extractors and the action from the
+// HTTP method.
+func New(warden ladon.Warden, subject, resource Extractor) *Middleware {
+	return &Middleware{Warden: warden, Subject: subject, Resource: resource, Action: ActionFromMethod(nil)}
+}
+
+// Handler returns a handler which calls next only if the warden allows the request.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, err := m.Request(r)
+		if err == nil {
+			err = m.Warden.IsAllowed(request)
+		}
+
+		if err != nil {
+			if m.ErrorWriter != nil {
+				m.ErrorWriter(w, r, err)
+			} else {
+				WriteError(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), request)))
+	})
+}
+
+// Request builds the access request for r. Errors of the subject extractor are returned as ErrUnauthorized,
+// errors of the other extractors as ErrBadRequest.
+func (m *Middleware) Request(r *http.Request) (*ladon.Request, error) {
+	action := m.Action
+	if action == nil {
+		action = ActionFromMethod(nil)
+	}
+
+	request := &ladon.Request{Context: ladon.Context{}}
+	var err error
+	if request.Subject, err = m.Subject(r); err != nil {
+		return nil, wrap(ErrUnauthorized, err)
+	} else if request.Resource, err = m.Resource(r); err != nil {
+		return nil, wrap(ErrBadRequest, err)
+	} else if request.Action, err = action(r); err != nil {
+		return nil, wrap(ErrBadRequest, err)
+	}
+
+	if m.Tenant != nil {
+		if request.Tenant, err = m.Tenant(r); err != nil {
+			return nil, wrap(ErrBadRequest, err)
+		}
+	}
+
+	if m.Context != nil {
+		if request.Context, err = m.Context(r); err != nil {
+			return nil, wrap(ErrBadRequest, err)
+		}
+	}
+
+	return request, nil
+}
+
+// Error is the JSON body written by WriteError.
+type Error struct {
+	ID      string                   `json:"id,omitempty"`
+	Code    int                      `json:"code"`
+	Status  string                   `json:"status"`
+	Message string                   `json:"message"`
+	Reason  string                   `json:"reason,omitempty"`
+	Details []map[string]interface{} `json:"details,omitempty"`
+}
+
+// Errors returned by Middleware.Request if the access request can not be built.
+var (
+	ErrUnauthorized = &Error{ID: "unauthorized", Code: http.StatusUnauthorized, Status: http.StatusText(http.StatusUnauthorized), Reason: "The subject of the request could not be determined."}
+	ErrBadRequest   = &Error{ID: "bad_request", Code: http.StatusBadRequest, Status: http.StatusText(http.StatusBadRequest), Reason: "The access request could not be built."}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the status code of this error.
+func (e *Error) StatusCode() int {
+	return e.Code
+}
+
+func wrap(kind *Error, err error) error {
+	return errors.WithStack(&Error{ID: kind.ID, Code: kind.Code, Status: kind.Status, Message: err.Error(), Reason: kind.Reason})
+}
+
+// NewError converts err to an Error. The ID, status code, reason and details are taken from ladon's errors, other
+// errors are internal server errors.
+func NewError(err error) *Error {
+	cause := errors.Cause(err)
+	if e, ok := cause.(*Error); ok {
+		return e
+	}
+
+	e := &Error{Code: http.StatusInternalServerError, Message: err.Error()}
+	if c, ok := cause.(interface{ ID() string }); ok {
+		e.ID = c.ID()
+	}
+	if c, ok := cause.(interface{ StatusCode() int }); ok {
+		e.Code = c.StatusCode()
+	}
+	if c, ok := cause.(interface{ Reason() string }); ok {
+		e.Reason = c.Reason()
+	}
+	if c, ok := cause.(interface {
+		Details() []map[string]interface{}
+	}); ok && len(c.Details()) > 0 {
+		e.Details = c.Details()
+	}
+
+	e.Status = http.StatusText(e.Code)
+	return e
+}
+
+// WriteError writes err as JSON with its status code, see NewError.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	write(w, NewError(err))
+}
+
+// WriteDenialError writes err like WriteError, but adds the reason of denials, the ID of the deciding policy and the
+// key of the failed condition as details, so clients know why access was denied. Set it as ErrorWriter only if
+// clients may learn the IDs of policies and the keys of conditions.
+func WriteDenialError(w http.ResponseWriter, r *http.Request, err error) {
+	e := NewError(err)
+	if denial := ladon.AsDenialError(err); denial != nil {
+		detail := map[string]interface{}{"reason": string(denial.Reason)}
+		if denial.PolicyID != "" {
+			detail["policy"] = denial.PolicyID
+		}
+		if denial.ConditionKey != "" {
+			detail["condition"] = denial.ConditionKey
+		}
+		e.Details = append(e.Details, detail)
+	}
+	write(w, e)
+}
+
+func write(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(e.Code)
+	json.NewEncoder(w).Encode(e)
+}
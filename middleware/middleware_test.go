@@ -0,0 +1,163 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := memory.NewMemoryManager()
+	require.NoError(t, m.Create(&ladon.DefaultPolicy{
+		ID:         "1",
+		Subjects:   []string{"peter"},
+		Resources:  []string{"articles:<[0-9]+>"},
+		Actions:    []string{"read"},
+		Effect:     ladon.AllowAccess,
+		Conditions: ladon.Conditions{"ip": &ladon.CIDRCondition{CIDR: "192.0.2.0/24"}},
+	}))
+
+	remote, err := ladon.NewRemoteAddressExtractor()
+	require.NoError(t, err)
+
+	verify := func(ctx context.Context, token string) (map[string]interface{}, error) {
+		if token != "valid" {
+			return nil, errors.New("Token is invalid")
+		}
+		return map[string]interface{}{"sub": "peter"}, nil
+	}
+
+	mw := New(&ladon.Ladon{Manager: m}, SubjectFromJWT(verify, "sub"), ResourceFromTemplate("articles:{id}"))
+	mw.Action = ActionFromMethod(map[string]string{http.MethodGet: "read"})
+	mw.Context = ContextFromRemoteAddress(remote, "ip")
+
+	mux := http.NewServeMux()
+	mux.Handle("/articles/{id}", mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, ok := FromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(request.Resource))
+	})))
+
+	for k, tc := range []struct {
+		method, path, token, remote string
+		code                        int
+	}{
+		{method: "GET", path: "/articles/1", token: "valid", remote: "192.0.2.1:1234", code: http.StatusOK},
+		{method: "DELETE", path: "/articles/1", token: "valid", remote: "192.0.2.1:1234", code: http.StatusForbidden},
+		{method: "GET", path: "/articles/1", token: "valid", remote: "198.51.100.1:1234", code: http.StatusForbidden},
+		{method: "GET", path: "/articles/1", token: "invalid", remote: "192.0.2.1:1234", code: http.StatusUnauthorized},
+		{method: "GET", path: "/articles/1", remote: "192.0.2.1:1234", code: http.StatusUnauthorized},
+		{method: "GET", path: "/articles/1", token: "valid", remote: "unknown", code: http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		r.RemoteAddr = tc.remote
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		require.Equal(t, tc.code, w.Code, "case %d", k)
+
+		if tc.code == http.StatusOK {
+			assert.Equal(t, "articles:1", w.Body.String())
+			continue
+		}
+
+		var e Error
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &e), "case %d", k)
+		assert.Equal(t, tc.code, e.Code)
+		assert.Equal(t, http.StatusText(tc.code), e.Status)
+		assert.NotEmpty(t, e.Message)
+		assert.NotEmpty(t, e.ID)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Empty(t, e.Details)
+	}
+
+	// WriteDenialError tells clients why access was denied.
+	mw.ErrorWriter = WriteDenialError
+	for k, tc := range []struct {
+		method, remote string
+		detail         map[string]interface{}
+	}{
+		{method: "DELETE", remote: "192.0.2.1:1234", detail: map[string]interface{}{"reason": "no_match"}},
+		{method: "GET", remote: "198.51.100.1:1234", detail: map[string]interface{}{"reason": "condition", "policy": "1", "condition": "ip"}},
+	} {
+		r := httptest.NewRequest(tc.method, "/articles/1", nil)
+		r.RemoteAddr = tc.remote
+		r.Header.Set("Authorization", "Bearer valid")
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		require.Equal(t, http.StatusForbidden, w.Code, "case %d", k)
+
+		var e Error
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &e), "case %d", k)
+		assert.Equal(t, "request_denied", e.ID, "case %d", k)
+		assert.Equal(t, []map[string]interface{}{tc.detail}, e.Details, "case %d", k)
+	}
+}
+
+func TestExtractors(t *testing.T) {
+	type key struct{}
+
+	r := httptest.NewRequest("POST", "/teams/a/members/b", nil)
+	r.SetPathValue("team", "a")
+	r.SetPathValue("member", "b")
+
+	_, err := SubjectFromContext(key{})(r)
+	assert.Error(t, err)
+
+	subject, err := SubjectFromContext(key{})(r.WithContext(context.WithValue(r.Context(), key{}, "peter")))
+	require.NoError(t, err)
+	assert.Equal(t, "peter", subject)
+
+	resource, err := ResourceFromTemplate("teams:{team}:members:{member}")(r)
+	require.NoError(t, err)
+	assert.Equal(t, "teams:a:members:b", resource)
+
+	_, err = ResourceFromTemplate("teams:{missing}")(r)
+	assert.Error(t, err)
+	_, err = ResourceFromTemplate("teams:{team")(r)
+	assert.Error(t, err)
+
+	action, err := ActionFromMethod(nil)(r)
+	require.NoError(t, err)
+	assert.Equal(t, "post", action)
+
+	c, err := Contexts(
+		func(r *http.Request) (ladon.Context, error) { return ladon.Context{"a": 1, "b": 1}, nil },
+		func(r *http.Request) (ladon.Context, error) { return ladon.Context{"b": 2}, nil },
+	)(r)
+	require.NoError(t, err)
+	assert.Equal(t, ladon.Context{"a": 1, "b": 2}, c)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SubjectPlaceholder is replaced by the request's subject in the resources of a policy before they are matched,
+// so "users:{subject}:files:<.*>" grants every subject access to its own files.
+const SubjectPlaceholder = "{subject}"
+
+// SubstituteSubject returns templates with SubjectPlaceholder replaced by subject. Inside the regular expressions
+// of a policy using MatchModeRegex, the subject is quoted, so it always matches verbatim. Templates containing the
+// placeholder are left out if subject contains characters which p would interpret as a pattern, such as the
+// delimiters of p or glob wildcards, so a subject can never widen the resources it is granted.
+func SubstituteSubject(p Policy, templates []string, subject string) []string {
+	var substituted []string
+	for k, t := range templates {
+		if !strings.Contains(t, SubjectPlaceholder) {
+			if substituted != nil {
+				substituted = append(substituted, t)
+			}
+			continue
+		}
+
+		if substituted == nil {
+			substituted = append(make([]string, 0, len(templates)), templates[:k]...)
+		}
+
+		if s, ok := substituteSubject(p, t, subject); ok {
+			substituted = append(substituted, s)
+		}
+	}
+
+	if substituted == nil {
+		return templates
+	}
+	return substituted
+}
+
+func substituteSubject(p Policy, template, subject string) (string, bool) {
+	switch PolicyMatchMode(p) {
+	case MatchModeGlob:
+		if strings.ContainsAny(subject, "*?") {
+			return "", false
+		}
+	case MatchModeRegex:
+		start, end := p.GetStartDelimiter(), p.GetEndDelimiter()
+		if strings.IndexByte(subject, start) >= 0 || strings.IndexByte(subject, end) >= 0 {
+			return "", false
+		}
+
+		var out strings.Builder
+		depth := 0
+		for i := 0; i < len(template); i++ {
+			if strings.HasPrefix(template[i:], SubjectPlaceholder) {
+				if depth > 0 {
+					out.WriteString(regexp.QuoteMeta(subject))
+				} else {
+					out.WriteString(subject)
+				}
+				i += len(SubjectPlaceholder) - 1
+				continue
+			}
+
+			switch template[i] {
+			case start:
+				depth++
+			case end:
+				depth--
+			}
+			out.WriteByte(template[i])
+		}
+		return out.String(), true
+	}
+
+	return strings.Replace(template, SubjectPlaceholder, subject, -1), true
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestSubstituteSubject(t *testing.T) {
+	regex := &DefaultPolicy{}
+	glob := &DefaultPolicy{MatchMode: MatchModeGlob}
+	exact := &DefaultPolicy{MatchMode: MatchModeExact}
+
+	for k, c := range []struct {
+		policy    Policy
+		templates []string
+		subject   string
+		expected  []string
+	}{
+		{policy: regex, templates: []string{"articles:<.*>"}, subject: "peter", expected: []string{"articles:<.*>"}},
+		{policy: regex, templates: []string{"users:{subject}:files:<.*>", "public"}, subject: "peter", expected: []string{"users:peter:files:<.*>", "public"}},
+		{policy: regex, templates: []string{"users:<{subject}|admin>"}, subject: "a.b", expected: []string{`users:<a\.b|admin>`}},
+		{policy: regex, templates: []string{"public", "users:{subject}"}, subject: "<.*>", expected: []string{"public"}},
+		{policy: regex, templates: []string{"users:{subject}"}, subject: "peter>", expected: []string{}},
+		{policy: glob, templates: []string{"users:{subject}:*"}, subject: "peter", expected: []string{"users:peter:*"}},
+		{policy: glob, templates: []string{"users:{subject}:*"}, subject: "*", expected: []string{}},
+		{policy: exact, templates: []string{"users:{subject}:{subject}"}, subject: "*<.*>", expected: []string{"users:*<.*>:*<.*>"}},
+	} {
+		assert.Equal(t, c.expected, SubstituteSubject(c.policy, c.templates, c.subject), "case %d", k)
+	}
+
+	assert.False(t, IsLiteralTemplate(exact, "users:{subject}"))
+}
+
+func TestSubjectPlaceholder(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:        "own-files",
+		Subjects:  []string{"<.*>"},
+		Resources: []string{"users:{subject}:files:<.*>"},
+		Actions:   []string{"get"},
+		Effect:    AllowAccess,
+	}))
+
+	warden := &Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "users:peter:files:1"}))
+	assert.Equal(t, ErrRequestDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "users:ken:files:1"})))
+	assert.Equal(t, ErrRequestDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "<.*>", Action: "get", Resource: "users:ken:files:1"})))
+}
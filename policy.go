@@ -67,27 +67,57 @@ type Policy interface {
 
 // DefaultPolicy is the default implementation of the policy interface.
 type DefaultPolicy struct {
-	ID          string     `json:"id" gorethink:"id"`
-	Description string     `json:"description" gorethink:"description"`
-	Subjects    []string   `json:"subjects" gorethink:"subjects"`
-	Effect      string     `json:"effect" gorethink:"effect"`
-	Resources   []string   `json:"resources" gorethink:"resources"`
-	Actions     []string   `json:"actions" gorethink:"actions"`
-	Conditions  Conditions `json:"conditions" gorethink:"conditions"`
-	Meta        []byte     `json:"meta" gorethink:"meta"`
+	ID          string            `json:"id" yaml:"id" gorethink:"id"`
+	Description string            `json:"description" yaml:"description,omitempty" gorethink:"description"`
+	Subjects    []string          `json:"subjects" yaml:"subjects" gorethink:"subjects"`
+	Effect      Effect            `json:"effect" yaml:"effect" gorethink:"effect"`
+	Resources   []string          `json:"resources" yaml:"resources" gorethink:"resources"`
+	Actions     []string          `json:"actions" yaml:"actions" gorethink:"actions"`
+	Conditions  Conditions        `json:"conditions" yaml:"conditions,omitempty" gorethink:"conditions"`
+	Meta        []byte            `json:"meta" yaml:"-" gorethink:"meta"`
+	Version     int               `json:"version" yaml:"version,omitempty" gorethink:"version"`
+	MatchMode   MatchMode         `json:"match_mode,omitempty" yaml:"match_mode,omitempty" gorethink:"match_mode"`
+	Tenant      string            `json:"tenant,omitempty" yaml:"tenant,omitempty" gorethink:"tenant"`
+	Priority    int               `json:"priority,omitempty" yaml:"priority,omitempty" gorethink:"priority"`
+	Template    *TemplateRef      `json:"template,omitempty" yaml:"template,omitempty" gorethink:"template"`
+	Disabled    bool              `json:"disabled,omitempty" yaml:"disabled,omitempty" gorethink:"disabled"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" gorethink:"labels"`
+	Signature   *Signature        `json:"signature,omitempty" yaml:"signature,omitempty" gorethink:"signature"`
+
+	ExcludedSubjects  []string `json:"excluded_subjects,omitempty" yaml:"excluded_subjects,omitempty" gorethink:"excluded_subjects"`
+	ExcludedResources []string `json:"excluded_resources,omitempty" yaml:"excluded_resources,omitempty" gorethink:"excluded_resources"`
+	ExcludedActions   []string `json:"excluded_actions,omitempty" yaml:"excluded_actions,omitempty" gorethink:"excluded_actions"`
+
+	StartDelimiter string `json:"start_delimiter,omitempty" yaml:"start_delimiter,omitempty" gorethink:"start_delimiter"`
+	EndDelimiter   string `json:"end_delimiter,omitempty" yaml:"end_delimiter,omitempty" gorethink:"end_delimiter"`
 }
 
 // UnmarshalJSON overwrite own policy with values of the given in policy in JSON format
 func (p *DefaultPolicy) UnmarshalJSON(data []byte) error {
 	var pol = struct {
-		ID          string     `json:"id" gorethink:"id"`
-		Description string     `json:"description" gorethink:"description"`
-		Subjects    []string   `json:"subjects" gorethink:"subjects"`
-		Effect      string     `json:"effect" gorethink:"effect"`
-		Resources   []string   `json:"resources" gorethink:"resources"`
-		Actions     []string   `json:"actions" gorethink:"actions"`
-		Conditions  Conditions `json:"conditions" gorethink:"conditions"`
-		Meta        []byte     `json:"meta" gorethink:"meta"`
+		ID          string            `json:"id" gorethink:"id"`
+		Description string            `json:"description" gorethink:"description"`
+		Subjects    []string          `json:"subjects" gorethink:"subjects"`
+		Effect      Effect            `json:"effect" gorethink:"effect"`
+		Resources   []string          `json:"resources" gorethink:"resources"`
+		Actions     []string          `json:"actions" gorethink:"actions"`
+		Conditions  Conditions        `json:"conditions" gorethink:"conditions"`
+		Meta        []byte            `json:"meta" gorethink:"meta"`
+		Version     int               `json:"version" gorethink:"version"`
+		MatchMode   MatchMode         `json:"match_mode,omitempty" gorethink:"match_mode"`
+		Tenant      string            `json:"tenant,omitempty" gorethink:"tenant"`
+		Priority    int               `json:"priority,omitempty" gorethink:"priority"`
+		Template    *TemplateRef      `json:"template,omitempty" gorethink:"template"`
+		Disabled    bool              `json:"disabled,omitempty" gorethink:"disabled"`
+		Labels      map[string]string `json:"labels,omitempty" gorethink:"labels"`
+		Signature   *Signature        `json:"signature,omitempty" gorethink:"signature"`
+
+		ExcludedSubjects  []string `json:"excluded_subjects,omitempty" gorethink:"excluded_subjects"`
+		ExcludedResources []string `json:"excluded_resources,omitempty" gorethink:"excluded_resources"`
+		ExcludedActions   []string `json:"excluded_actions,omitempty" gorethink:"excluded_actions"`
+
+		StartDelimiter string `json:"start_delimiter,omitempty" gorethink:"start_delimiter"`
+		EndDelimiter   string `json:"end_delimiter,omitempty" gorethink:"end_delimiter"`
 	}{
 		Conditions: Conditions{},
 	}
@@ -105,6 +135,21 @@ func (p *DefaultPolicy) UnmarshalJSON(data []byte) error {
 		Actions:     pol.Actions,
 		Conditions:  pol.Conditions,
 		Meta:        pol.Meta,
+		Version:     pol.Version,
+		MatchMode:   pol.MatchMode,
+		Tenant:      pol.Tenant,
+		Priority:    pol.Priority,
+		Template:    pol.Template,
+		Disabled:    pol.Disabled,
+		Labels:      pol.Labels,
+		Signature:   pol.Signature,
+
+		ExcludedSubjects:  pol.ExcludedSubjects,
+		ExcludedResources: pol.ExcludedResources,
+		ExcludedActions:   pol.ExcludedActions,
+
+		StartDelimiter: pol.StartDelimiter,
+		EndDelimiter:   pol.EndDelimiter,
 	}
 	return nil
 }
@@ -123,6 +168,11 @@ func (p *DefaultPolicy) GetID() string {
 	return p.ID
 }
 
+// SetID sets the policies id.
+func (p *DefaultPolicy) SetID(id string) {
+	p.ID = id
+}
+
 // GetDescription returns the policies description.
 func (p *DefaultPolicy) GetDescription() string {
 	return p.Description
@@ -135,12 +185,12 @@ func (p *DefaultPolicy) GetSubjects() []string {
 
 // AllowAccess returns true if the policy effect is allow, otherwise false.
 func (p *DefaultPolicy) AllowAccess() bool {
-	return p.Effect == AllowAccess
+	return p.Effect == EffectAllow
 }
 
 // GetEffect returns the policies effect which might be 'allow' or 'deny'.
 func (p *DefaultPolicy) GetEffect() string {
-	return p.Effect
+	return string(p.Effect)
 }
 
 // GetResources returns the policies resources.
@@ -163,12 +213,80 @@ func (p *DefaultPolicy) GetMeta() []byte {
 	return p.Meta
 }
 
-// GetEndDelimiter returns the delimiter which identifies the end of a regular expression.
+// GetVersion returns the policies version.
+func (p *DefaultPolicy) GetVersion() int {
+	return p.Version
+}
+
+// SetVersion sets the policies version.
+func (p *DefaultPolicy) SetVersion(version int) {
+	p.Version = version
+}
+
+// GetEndDelimiter returns the delimiter which identifies the end of a regular expression, DefaultEndDelimiter
+// unless EndDelimiter is set.
 func (p *DefaultPolicy) GetEndDelimiter() byte {
-	return '>'
+	if p.EndDelimiter == "" {
+		return DefaultEndDelimiter
+	}
+	return p.EndDelimiter[0]
 }
 
-// GetStartDelimiter returns the delimiter which identifies the beginning of a regular expression.
+// GetStartDelimiter returns the delimiter which identifies the beginning of a regular expression,
+// DefaultStartDelimiter unless StartDelimiter is set.
 func (p *DefaultPolicy) GetStartDelimiter() byte {
-	return '<'
+	if p.StartDelimiter == "" {
+		return DefaultStartDelimiter
+	}
+	return p.StartDelimiter[0]
+}
+
+// GetMatchMode returns the policies match mode.
+func (p *DefaultPolicy) GetMatchMode() MatchMode {
+	return p.MatchMode
+}
+
+// GetTenant returns the tenant the policy belongs to.
+func (p *DefaultPolicy) GetTenant() string {
+	return p.Tenant
+}
+
+// GetPriority returns the policies priority.
+func (p *DefaultPolicy) GetPriority() int {
+	return p.Priority
+}
+
+// GetTemplate returns the template the policy was instantiated from, or nil.
+func (p *DefaultPolicy) GetTemplate() *TemplateRef {
+	return p.Template
+}
+
+// IsActive returns false if the policy is disabled.
+func (p *DefaultPolicy) IsActive() bool {
+	return !p.Disabled
+}
+
+// GetLabels returns the policies labels.
+func (p *DefaultPolicy) GetLabels() map[string]string {
+	return p.Labels
+}
+
+// GetSignature returns the policies signature, or nil if it is not signed.
+func (p *DefaultPolicy) GetSignature() *Signature {
+	return p.Signature
+}
+
+// GetExcludedSubjects returns the subjects the policy does not apply to.
+func (p *DefaultPolicy) GetExcludedSubjects() []string {
+	return p.ExcludedSubjects
+}
+
+// GetExcludedResources returns the resources the policy does not apply to.
+func (p *DefaultPolicy) GetExcludedResources() []string {
+	return p.ExcludedResources
+}
+
+// GetExcludedActions returns the actions the policy does not apply to.
+func (p *DefaultPolicy) GetExcludedActions() []string {
+	return p.ExcludedActions
 }
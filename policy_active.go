@@ -0,0 +1,87 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ActivatablePolicy is implemented by policies which can be disabled. Disabled policies are kept by managers, but
+// never apply to requests.
+type ActivatablePolicy interface {
+	// IsActive returns false if the policy is disabled.
+	IsActive() bool
+}
+
+// PolicyActive returns false if p is disabled. Policies which do not implement ActivatablePolicy are always active.
+func PolicyActive(p Policy) bool {
+	if ap, ok := p.(ActivatablePolicy); ok {
+		return ap.IsActive()
+	}
+	return true
+}
+
+// ActivationManager is implemented by managers which disable and enable stored policies in place.
+type ActivationManager interface {
+	// Disable switches the policy off without deleting it.
+	Disable(id string) error
+
+	// Enable switches a disabled policy back on.
+	Enable(id string) error
+}
+
+// DisablePolicy switches the policy off without deleting it. Managers which do not implement ActivationManager are
+// updated with a disabled copy of the stored policy, which is stored as a DefaultPolicy.
+func DisablePolicy(m Manager, id string) error {
+	if am, ok := m.(ActivationManager); ok {
+		return am.Disable(id)
+	}
+	return setPolicyActive(m, id, false)
+}
+
+// EnablePolicy switches a disabled policy back on. Managers which do not implement ActivationManager are updated
+// with an enabled copy of the stored policy, which is stored as a DefaultPolicy.
+func EnablePolicy(m Manager, id string) error {
+	if am, ok := m.(ActivationManager); ok {
+		return am.Enable(id)
+	}
+	return setPolicyActive(m, id, true)
+}
+
+func setPolicyActive(m Manager, id string, active bool) error {
+	p, err := m.Get(id)
+	if err != nil {
+		return err
+	} else if PolicyActive(p) == active {
+		return nil
+	}
+
+	c, err := copyPolicy(p)
+	if err != nil {
+		return err
+	}
+
+	c.Disabled = !active
+	if err := m.Update(c); err != nil {
+		return errors.Wrapf(err, "Could not update policy %s", id)
+	}
+	return nil
+}
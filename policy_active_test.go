@@ -0,0 +1,70 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestDisablePolicy(t *testing.T) {
+	bus := new(recordingBus)
+	m := NewEventingManager(NewMemoryManager(), bus)
+
+	allow := &DefaultPolicy{ID: "allow", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, Effect: AllowAccess}
+	deny := &DefaultPolicy{ID: "deny", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"articles:1"}, Effect: DenyAccess}
+	require.NoError(t, m.Create(allow))
+	require.NoError(t, m.Create(deny))
+
+	conflicts, err := FindConflicts(allow, Policies{deny})
+	require.NoError(t, err)
+	assert.Len(t, conflicts, 1)
+
+	require.NoError(t, DisablePolicy(m, "deny"), "managers without ActivationManager are updated")
+	require.Len(t, bus.events, 3)
+	assert.Equal(t, PolicyUpdated, bus.events[2].Type)
+	assert.True(t, PolicyActive(deny), "the stored policy is not modified in place")
+
+	disabled, err := m.Get("deny")
+	require.NoError(t, err)
+	assert.False(t, PolicyActive(disabled))
+
+	conflicts, err = FindConflicts(allow, Policies{disabled})
+	require.NoError(t, err)
+	assert.Empty(t, conflicts, "disabled policies do not conflict")
+
+	warden := &Ladon{Manager: m}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1"}))
+
+	require.NoError(t, DisablePolicy(m, "allow"))
+	grants, err := warden.Audience("articles:1", "get")
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+
+	require.NoError(t, EnablePolicy(m, "allow"))
+	require.NoError(t, EnablePolicy(m, "allow"), "enabling an active policy does nothing")
+	assert.Len(t, bus.events, 5)
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import "fmt"
+
+// PolicyBuilder constructs a DefaultPolicy step by step. Mistakes, such as an unknown effect or a condition of an
+// unregistered type, are recorded when the step is taken and reported by Build, which validates the policy like a
+// manager would:
+//
+//	policy, err := ladon.NewPolicyBuilder().
+//		Allow().
+//		Subjects("peter").
+//		Actions("get", "update").
+//		Resources("articles:<.*>").
+//		WithCondition("owner", &ladon.EqualsSubjectCondition{}).
+//		Build()
+type PolicyBuilder struct {
+	policy *DefaultPolicy
+	issues []FsckIssue
+}
+
+// NewPolicyBuilder returns a PolicyBuilder for a policy without ID and effect.
+func NewPolicyBuilder() *PolicyBuilder {
+	return &PolicyBuilder{policy: new(DefaultPolicy)}
+}
+
+func (b *PolicyBuilder) fail(check, format string, args ...interface{}) *PolicyBuilder {
+	b.issues = append(b.issues, FsckIssue{PolicyID: b.policy.ID, Check: check, Message: fmt.Sprintf(format, args...)})
+	return b
+}
+
+// ID sets the policy's ID. Without an ID, Build generates one with PolicyIDGenerator.
+func (b *PolicyBuilder) ID(id string) *PolicyBuilder {
+	if id == "" {
+		return b.fail(FsckCheckID, "Policy ID must not be empty")
+	}
+	b.policy.ID = id
+	return b
+}
+
+// Description sets the policy's description.
+func (b *PolicyBuilder) Description(description string) *PolicyBuilder {
+	b.policy.Description = description
+	return b
+}
+
+// Allow makes the policy grant access.
+func (b *PolicyBuilder) Allow() *PolicyBuilder {
+	return b.Effect(EffectAllow)
+}
+
+// Deny makes the policy deny access.
+func (b *PolicyBuilder) Deny() *PolicyBuilder {
+	return b.Effect(EffectDeny)
+}
+
+// Effect sets the policy's effect, which must be known, see IsKnownEffect. The effect can only be set once.
+func (b *PolicyBuilder) Effect(effect Effect) *PolicyBuilder {
+	if !IsKnownEffect(string(effect)) {
+		return b.fail(FsckCheckEffect, `Effect "%s" is unknown`, effect)
+	} else if b.policy.Effect != "" && b.policy.Effect != effect {
+		return b.fail(FsckCheckEffect, `Effect is set to both "%s" and "%s"`, b.policy.Effect, effect)
+	}
+	b.policy.Effect = effect
+	return b
+}
+
+// Subjects adds subject templates.
+func (b *PolicyBuilder) Subjects(subjects ...string) *PolicyBuilder {
+	b.policy.Subjects = append(b.policy.Subjects, subjects...)
+	return b
+}
+
+// Resources adds resource templates.
+func (b *PolicyBuilder) Resources(resources ...string) *PolicyBuilder {
+	b.policy.Resources = append(b.policy.Resources, resources...)
+	return b
+}
+
+// Actions adds action templates.
+func (b *PolicyBuilder) Actions(actions ...string) *PolicyBuilder {
+	b.policy.Actions = append(b.policy.Actions, actions...)
+	return b
+}
+
+// ExcludeSubjects adds templates of subjects the policy does not apply to.
+func (b *PolicyBuilder) ExcludeSubjects(subjects ...string) *PolicyBuilder {
+	b.policy.ExcludedSubjects = append(b.policy.ExcludedSubjects, subjects...)
+	return b
+}
+
+// ExcludeResources adds templates of resources the policy does not apply to.
+func (b *PolicyBuilder) ExcludeResources(resources ...string) *PolicyBuilder {
+	b.policy.ExcludedResources = append(b.policy.ExcludedResources, resources...)
+	return b
+}
+
+// ExcludeActions adds templates of actions the policy does not apply to.
+func (b *PolicyBuilder) ExcludeActions(actions ...string) *PolicyBuilder {
+	b.policy.ExcludedActions = append(b.policy.ExcludedActions, actions...)
+	return b
+}
+
+// WithCondition adds a condition under key. The condition's type must be registered in ConditionFactories and
+// every key can only be used once.
+func (b *PolicyBuilder) WithCondition(key string, c Condition) *PolicyBuilder {
+	if c == nil {
+		return b.fail(FsckCheckCondition, "Condition %s is nil", key)
+	} else if _, ok := ConditionFactories[c.GetName()]; !ok {
+		return b.fail(FsckCheckCondition, "Condition %s has unregistered type %s", key, c.GetName())
+	} else if _, ok := b.policy.Conditions[key]; ok {
+		return b.fail(FsckCheckCondition, "Condition %s is added more than once", key)
+	}
+
+	if b.policy.Conditions == nil {
+		b.policy.Conditions = Conditions{}
+	}
+	b.policy.Conditions.AddCondition(key, c)
+	return b
+}
+
+// MatchMode sets how the policy's templates are matched.
+func (b *PolicyBuilder) MatchMode(mode MatchMode) *PolicyBuilder {
+	b.policy.MatchMode = mode
+	if err := ValidateMatchMode(b.policy); err != nil {
+		b.policy.MatchMode = ""
+		return b.fail(FsckCheckMatchMode, "%s", err)
+	}
+	return b
+}
+
+// Delimiters sets the characters enclosing regular expressions in the policy's templates, for example '{' and '}'
+// for resources which contain angle brackets.
+func (b *PolicyBuilder) Delimiters(start, end byte) *PolicyBuilder {
+	if start == end {
+		return b.fail(FsckCheckDelimiter, "Start and end delimiter must differ")
+	}
+	b.policy.StartDelimiter, b.policy.EndDelimiter = string([]byte{start}), string([]byte{end})
+	return b
+}
+
+// Tenant restricts the policy to requests of tenant.
+func (b *PolicyBuilder) Tenant(tenant string) *PolicyBuilder {
+	b.policy.Tenant = tenant
+	return b
+}
+
+// Priority sets the policy's priority, see FirstApplicableStrategy.
+func (b *PolicyBuilder) Priority(priority int) *PolicyBuilder {
+	b.policy.Priority = priority
+	return b
+}
+
+// Label sets the label key to value.
+func (b *PolicyBuilder) Label(key, value string) *PolicyBuilder {
+	if b.policy.Labels == nil {
+		b.policy.Labels = map[string]string{}
+	}
+	b.policy.Labels[key] = value
+	return b
+}
+
+// Disabled creates the policy switched off.
+func (b *PolicyBuilder) Disabled() *PolicyBuilder {
+	b.policy.Disabled = true
+	return b
+}
+
+// Meta sets the policy's meta data.
+func (b *PolicyBuilder) Meta(meta []byte) *PolicyBuilder {
+	b.policy.Meta = meta
+	return b
+}
+
+// Build returns the policy or an ErrInvalidPolicy listing all mistakes made while building it and all problems
+// ValidatePolicy finds. A policy without ID is assigned one by PolicyIDGenerator.
+func (b *PolicyBuilder) Build() (*DefaultPolicy, error) {
+	// Maps are copied, so that the builder can be reused without changing policies it built before.
+	p := *b.policy
+	if b.policy.Labels != nil {
+		p.Labels = make(map[string]string, len(b.policy.Labels))
+		for k, v := range b.policy.Labels {
+			p.Labels[k] = v
+		}
+	}
+	if b.policy.Conditions != nil {
+		p.Conditions = make(Conditions, len(b.policy.Conditions))
+		for k, c := range b.policy.Conditions {
+			p.Conditions[k] = c
+		}
+	}
+
+	if len(b.issues) > 0 {
+		return nil, NewErrInvalidPolicy(&p, b.issues)
+	}
+
+	if err := AssignID(&p); err != nil {
+		return nil, err
+	} else if err := ValidatePolicy(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// MustBuild is like Build but panics if the policy is invalid. It simplifies declaring policies in variables.
+func (b *PolicyBuilder) MustBuild() *DefaultPolicy {
+	p, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
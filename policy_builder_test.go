@@ -0,0 +1,92 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestPolicyBuilder(t *testing.T) {
+	b := NewPolicyBuilder().
+		ID("1").
+		Allow().
+		Subjects("peter").
+		Actions("get", "update").
+		Resources("articles:<.*>").
+		ExcludeResources("articles:drafts").
+		WithCondition("owner", &EqualsSubjectCondition{}).
+		Label("team", "blog")
+
+	p, err := b.Build()
+	require.NoError(t, err)
+	assert.Equal(t, &DefaultPolicy{
+		ID:                "1",
+		Effect:            EffectAllow,
+		Subjects:          []string{"peter"},
+		Actions:           []string{"get", "update"},
+		Resources:         []string{"articles:<.*>"},
+		ExcludedResources: []string{"articles:drafts"},
+		Conditions:        Conditions{"owner": &EqualsSubjectCondition{}},
+		Labels:            map[string]string{"team": "blog"},
+	}, p)
+
+	b.Label("env", "prod")
+	assert.Len(t, p.Labels, 1, "built policies do not change with the builder")
+
+	warden := &Ladon{Manager: NewMemoryManager()}
+	require.NoError(t, warden.Manager.Create(p))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: Context{"owner": "peter"}}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:drafts", Context: Context{"owner": "peter"}}))
+}
+
+func TestPolicyBuilderMistakes(t *testing.T) {
+	for k, c := range []struct {
+		b        *PolicyBuilder
+		contains string
+	}{
+		{b: NewPolicyBuilder().ID("1").Effect("alow"), contains: `Effect "alow" is unknown`},
+		{b: NewPolicyBuilder().ID("1").Allow().Deny(), contains: `Effect is set to both "allow" and "deny"`},
+		{b: NewPolicyBuilder().ID("1").Allow().WithCondition("ip", nil), contains: "Condition ip is nil"},
+		{b: NewPolicyBuilder().ID("1").Allow().WithCondition("a", &BooleanCondition{}).WithCondition("a", &BooleanCondition{}), contains: "Condition a is added more than once"},
+		{b: NewPolicyBuilder().ID("1").Allow().MatchMode("fuzzy"), contains: `unknown match mode "fuzzy"`},
+		{b: NewPolicyBuilder().ID("1").Allow().Subjects("<[>"), contains: "does not compile"},
+		{b: NewPolicyBuilder().ID("1"), contains: `unknown effect ""`},
+		{b: NewPolicyBuilder().ID("1").Allow().Delimiters('|', '|'), contains: "Start and end delimiter must differ"},
+		{b: NewPolicyBuilder().Allow(), contains: "Policy has no ID"},
+	} {
+		_, err := c.b.Build()
+		require.Error(t, err, "%d", k)
+		assert.Equal(t, "invalid_policy", errors.Cause(err).(interface{ ID() string }).ID(), "%d", k)
+		assert.Contains(t, err.Error(), c.contains, "%d", k)
+	}
+
+	assert.Panics(t, func() { NewPolicyBuilder().MustBuild() })
+
+	p := NewPolicyBuilder().ID("1").Allow().Delimiters('{', '}').Resources("<html>:{[0-9]+}").MustBuild()
+	assert.Equal(t, byte('{'), p.GetStartDelimiter())
+	assert.Equal(t, byte('}'), p.GetEndDelimiter())
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+// ConflictMode controls how managers handle policies which conflict with existing ones. Two policies conflict
+// if one allows and the other denies access and their subjects, resources and actions overlap.
+type ConflictMode int
+
+const (
+	// ConflictModeOff disables conflict detection.
+	ConflictModeOff ConflictMode = iota
+
+	// ConflictModeWarn stores conflicting policies but reports the conflicts.
+	ConflictModeWarn
+
+	// ConflictModeReject refuses to store conflicting policies with ErrPolicyConflict.
+	ConflictModeReject
+)
+
+// ConflictDetector is implemented by managers which can check a policy for conflicts with stored policies.
+type ConflictDetector interface {
+	// FindConflicts returns the stored policies which conflict with p.
+	FindConflicts(p Policy) (Policies, error)
+}
+
+// FindConflicts returns the policies of candidates which conflict with p. Policies with the same ID as p,
+// policies of other tenants and disabled policies are ignored. Overlaps of regular expressions are approximated:
+// two templates overlap if they are equal or one matches the other literally, so conflicts between unrelated
+// regular expressions may go unnoticed.
+func FindConflicts(p Policy, candidates Policies) (Policies, error) {
+	if !PolicyActive(p) {
+		return nil, nil
+	}
+
+	var conflicts Policies
+	for _, c := range candidates {
+		if c.GetID() == p.GetID() || PolicyTenant(c) != PolicyTenant(p) || !PolicyActive(c) || !oppositeEffects(p, c) {
+			continue
+		}
+
+		overlaps := true
+		for _, fields := range [][2][]string{
+			{p.GetSubjects(), c.GetSubjects()},
+			{p.GetResources(), c.GetResources()},
+			{p.GetActions(), c.GetActions()},
+		} {
+			overlap, err := patternsOverlap(p, c, fields[0], fields[1])
+			if err != nil {
+				return nil, err
+			} else if !overlap {
+				overlaps = false
+				break
+			}
+		}
+
+		if overlaps {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts, nil
+}
+
+func oppositeEffects(p, q Policy) bool {
+	a, b := Effect(p.GetEffect()), Effect(q.GetEffect())
+	return (a == EffectAllow && b == EffectDeny) || (a == EffectDeny && b == EffectAllow)
+}
+
+func patternsOverlap(p, q Policy, a, b []string) (bool, error) {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true, nil
+			}
+
+			if matches, err := DefaultMatcher.Matches(p, []string{x}, y); err != nil {
+				return false, err
+			} else if matches {
+				return true, nil
+			}
+
+			if matches, err := DefaultMatcher.Matches(q, []string{y}, x); err != nil {
+				return false, err
+			} else if matches {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
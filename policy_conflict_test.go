@@ -0,0 +1,59 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindConflicts(t *testing.T) {
+	allow := &DefaultPolicy{
+		ID:        "allow",
+		Subjects:  []string{"<.*>"},
+		Resources: []string{"articles:<[0-9]+>"},
+		Actions:   []string{"get", "update"},
+		Effect:    EffectAllow,
+	}
+
+	for k, c := range []struct {
+		policy   *DefaultPolicy
+		conflict bool
+	}{
+		{policy: &DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"update"}, Effect: EffectDeny}, conflict: true},
+		{policy: &DefaultPolicy{ID: "2", Subjects: []string{"peter"}, Resources: []string{"articles:<.*>"}, Actions: []string{"<.*>"}, Effect: EffectDeny}, conflict: true},
+		{policy: &DefaultPolicy{ID: "3", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"delete"}, Effect: EffectDeny}, conflict: false},
+		{policy: &DefaultPolicy{ID: "4", Subjects: []string{"peter"}, Resources: []string{"users:1"}, Actions: []string{"get"}, Effect: EffectDeny}, conflict: false},
+		{policy: &DefaultPolicy{ID: "5", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: EffectAllow}, conflict: false},
+		{policy: &DefaultPolicy{ID: "6", Subjects: []string{}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: EffectDeny}, conflict: false},
+		{policy: &DefaultPolicy{ID: "allow", Subjects: []string{"peter"}, Resources: []string{"articles:1"}, Actions: []string{"get"}, Effect: EffectDeny}, conflict: false},
+	} {
+		conflicts, err := FindConflicts(c.policy, Policies{allow})
+		require.NoError(t, err)
+		if c.conflict {
+			assert.Equal(t, Policies{allow}, conflicts, "%d", k)
+		} else {
+			assert.Empty(t, conflicts, "%d", k)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+// ExclusionPolicy is implemented by policies which exclude subjects, resources or actions, so that a policy can
+// apply to "all resources except X" without negative lookahead expressions, which regular expressions compatible
+// with RE2 do not support. Excluded templates are matched like the policies other templates, in its match mode. A
+// request matching an excluded template is not matched by the policy, even if it matches one of its templates.
+type ExclusionPolicy interface {
+	// GetExcludedSubjects returns the subjects the policy does not apply to.
+	GetExcludedSubjects() []string
+
+	// GetExcludedResources returns the resources the policy does not apply to.
+	GetExcludedResources() []string
+
+	// GetExcludedActions returns the actions the policy does not apply to.
+	GetExcludedActions() []string
+}
+
+// PolicyExclusions returns the excluded subjects, resources and actions of p, or nil if it does not implement
+// ExclusionPolicy.
+func PolicyExclusions(p Policy) (subjects, resources, actions []string) {
+	if ep, ok := p.(ExclusionPolicy); ok {
+		return ep.GetExcludedSubjects(), ep.GetExcludedResources(), ep.GetExcludedActions()
+	}
+	return nil, nil, nil
+}
+
+// HasExclusions returns true if p excludes any subject, resource or action.
+func HasExclusions(p Policy) bool {
+	subjects, resources, actions := PolicyExclusions(p)
+	return len(subjects)+len(resources)+len(actions) > 0
+}
+
+// matchesExcluding returns true if needle matches one of the templates in haystack, but none of the excluded ones.
+func (l *Ladon) matchesExcluding(p Policy, field RequestField, haystack, excluded []string, needle string) (bool, error) {
+	if matched, err := l.matches(p, field, haystack, needle); err != nil || !matched {
+		return false, err
+	} else if len(excluded) == 0 {
+		return true, nil
+	}
+
+	if matched, err := l.matches(p, field, excluded, needle); err != nil {
+		return false, err
+	} else if matched {
+		return false, nil
+	}
+	return true, nil
+}
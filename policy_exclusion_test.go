@@ -0,0 +1,82 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestPolicyExclusions(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:                "1",
+		Subjects:          []string{"<.*>"},
+		ExcludedSubjects:  []string{"guests:<.*>"},
+		Actions:           []string{"<.*>"},
+		ExcludedActions:   []string{"delete"},
+		Resources:         []string{"articles:<.*>"},
+		ExcludedResources: []string{"articles:drafts:<.*>", "articles:{subject}"},
+		Effect:            AllowAccess,
+	}))
+
+	warden := &Ladon{Manager: m}
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Subject: "guests:max", Action: "update", Resource: "articles:1"}, allowed: false},
+		{r: &Request{Subject: "peter", Action: "delete", Resource: "articles:1"}, allowed: false},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:drafts:1"}, allowed: false},
+		{r: &Request{Subject: "peter", Action: "update", Resource: "articles:peter"}, allowed: false},
+		{r: &Request{Subject: "max", Action: "update", Resource: "articles:peter"}, allowed: true},
+	} {
+		assert.Equal(t, c.allowed, warden.IsAllowed(c.r) == nil, "case %d", k)
+	}
+
+	grants, err := warden.Audience("articles:1", "delete")
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+
+	p, err := m.Get("1")
+	require.NoError(t, err)
+	encoded, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	var decoded DefaultPolicy
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, []string{"delete"}, decoded.ExcludedActions)
+	assert.True(t, HasExclusions(&decoded))
+
+	subjects, resources, actions := PolicyExclusions(&decoded)
+	assert.Equal(t, []string{"guests:<.*>"}, subjects)
+	assert.Len(t, resources, 2)
+	assert.Equal(t, []string{"delete"}, actions)
+
+	err = ValidatePolicy(&DefaultPolicy{ID: "2", Effect: AllowAccess, ExcludedResources: []string{"articles:<[>"}})
+	assert.Error(t, err, "excluded templates are validated")
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IDGenerator generates unique policy IDs.
+type IDGenerator func() (string, error)
+
+// PolicyIDGenerator is used by managers to assign an ID to policies which are created without one. It is nil by
+// default, in which case policies keep their empty ID. Set it to NewUUIDv7 or NewULID to enable ID generation.
+var PolicyIDGenerator IDGenerator
+
+// IdentifiablePolicy is implemented by policies whose ID can be assigned by a manager.
+type IdentifiablePolicy interface {
+	Policy
+
+	// SetID sets the policies id.
+	SetID(id string)
+}
+
+// AssignID generates an ID for p using PolicyIDGenerator if p has none. Policies which do not implement
+// IdentifiablePolicy are left untouched.
+func AssignID(p Policy) error {
+	if PolicyIDGenerator == nil || p.GetID() != "" {
+		return nil
+	}
+
+	ip, ok := p.(IdentifiablePolicy)
+	if !ok {
+		return nil
+	}
+
+	id, err := PolicyIDGenerator()
+	if err != nil {
+		return err
+	}
+
+	ip.SetID(id)
+	return nil
+}
+
+// timeOrderedBytes returns 16 random bytes whose first 48 bits are the current unix time in milliseconds.
+func timeOrderedBytes() ([16]byte, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return b, errors.WithStack(err)
+	}
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ms[2:])
+	return b, nil
+}
+
+// NewUUIDv7 returns a random, time-ordered UUID (version 7) in its canonical string form.
+func NewUUIDv7() (string, error) {
+	b, err := timeOrderedBytes()
+	if err != nil {
+		return "", err
+	}
+
+	b[6] = 0x70 | (b[6] & 0x0f)
+	b[8] = 0x80 | (b[8] & 0x3f)
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:]), nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a random, lexicographically sortable ULID.
+func NewULID() (string, error) {
+	b, err := timeOrderedBytes()
+	if err != nil {
+		return "", err
+	}
+
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	// A ULID encodes 128 bits in 26 characters of 5 bits each, starting with the least significant bits.
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
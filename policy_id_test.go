@@ -0,0 +1,80 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestNewUUIDv7(t *testing.T) {
+	previous := ""
+	for i := 0; i < 100; i++ {
+		id, err := NewUUIDv7()
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+		assert.NotEqual(t, previous, id)
+		previous = id
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	previous := ""
+	for i := 0; i < 100; i++ {
+		id, err := NewULID()
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`), id)
+		assert.NotEqual(t, previous, id)
+		previous = id
+	}
+}
+
+func TestAssignID(t *testing.T) {
+	defer func(g IDGenerator) { PolicyIDGenerator = g }(PolicyIDGenerator)
+
+	PolicyIDGenerator = nil
+	p := &DefaultPolicy{Effect: AllowAccess}
+	require.NoError(t, AssignID(p))
+	assert.Empty(t, p.ID)
+
+	PolicyIDGenerator = NewUUIDv7
+	require.NoError(t, AssignID(p))
+	assert.NotEmpty(t, p.ID)
+
+	id := p.ID
+	require.NoError(t, AssignID(p))
+	assert.Equal(t, id, p.ID)
+
+	m := NewMemoryManager()
+	created := &DefaultPolicy{Effect: AllowAccess}
+	require.NoError(t, m.Create(created))
+	require.NotEmpty(t, created.ID)
+
+	got, err := m.Get(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.GetID())
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+// LabeledPolicy is implemented by policies which carry labels, for example the owning team, a ticket ID or the
+// environment. Labels are not evaluated by the warden.
+type LabeledPolicy interface {
+	// GetLabels returns the policies labels.
+	GetLabels() map[string]string
+}
+
+// PolicyLabels returns the labels of p, or nil if it does not implement LabeledPolicy.
+func PolicyLabels(p Policy) map[string]string {
+	if lp, ok := p.(LabeledPolicy); ok {
+		return lp.GetLabels()
+	}
+	return nil
+}
+
+// LabelFinder is implemented by managers which find policies by label without scanning all policies.
+type LabelFinder interface {
+	// FindPoliciesByLabel returns the policies whose label key is set to value.
+	FindPoliciesByLabel(key, value string) (Policies, error)
+}
+
+// FindPoliciesByLabel returns the policies stored in m whose label key is set to value. Managers which do not
+// implement LabelFinder are scanned page by page.
+func FindPoliciesByLabel(m Manager, key, value string) (Policies, error) {
+	if lf, ok := m.(LabelFinder); ok {
+		return lf.FindPoliciesByLabel(key, value)
+	}
+
+	policies := Policies{}
+	err := exportPages(m, func(ps Policies) error {
+		policies = append(policies, FilterLabel(ps, key, value)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// FilterLabel returns the policies whose label key is set to value.
+func FilterLabel(policies Policies, key, value string) Policies {
+	filtered := make(Policies, 0, len(policies))
+	for _, p := range policies {
+		if v, ok := PolicyLabels(p)[key]; ok && v == value {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestFindPoliciesByLabel(t *testing.T) {
+	policies := Policies{
+		&DefaultPolicy{ID: "1", Effect: AllowAccess, Labels: map[string]string{"team": "blog", "env": "prod"}},
+		&DefaultPolicy{ID: "2", Effect: AllowAccess, Labels: map[string]string{"team": "shop"}},
+		&DefaultPolicy{ID: "3", Effect: AllowAccess},
+	}
+
+	mm := NewMemoryManager()
+	for _, m := range []Manager{mm, NewEventingManager(mm, new(recordingBus))} {
+		for _, p := range policies {
+			require.NoError(t, mm.Create(p))
+		}
+
+		ps, err := FindPoliciesByLabel(m, "team", "blog")
+		require.NoError(t, err)
+		require.Len(t, ps, 1)
+		assert.Equal(t, "1", ps[0].GetID())
+
+		ps, err = FindPoliciesByLabel(m, "env", "")
+		require.NoError(t, err)
+		assert.Empty(t, ps)
+
+		require.NoError(t, DeleteAll(mm, []string{"1", "2", "3"}))
+	}
+
+	raw, err := json.Marshal(policies[0])
+	require.NoError(t, err)
+
+	var decoded DefaultPolicy
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.Equal(t, map[string]string{"team": "blog", "env": "prod"}, PolicyLabels(&decoded))
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "time"
+
+// PolicyPack is a named and versioned bundle of policies which is installed, upgraded and rolled back as a whole.
+type PolicyPack struct {
+	// Name identifies the pack, for example "baseline".
+	Name string `json:"name"`
+
+	// Version is the version of the pack, for example "1.2.0".
+	Version string `json:"version"`
+
+	// Policies are the policies shipped with this version of the pack.
+	Policies Policies `json:"-"`
+
+	// InstalledAt is the time this version of the pack was installed.
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// PackManager is implemented by managers which are able to install policy packs atomically.
+type PackManager interface {
+	// InstallPack installs the given version of a pack. If another version of the pack is installed, its
+	// policies are replaced by the given ones. Either all policies are installed, or none. Installing the
+	// version which is already installed is a no-op.
+	InstallPack(name, version string, policies Policies) error
+
+	// RollbackPack reinstalls the version of a pack which was installed before the current one.
+	RollbackPack(name string) error
+
+	// GetPack returns the currently installed version of a pack.
+	GetPack(name string) (*PolicyPack, error)
+
+	// GetPacks returns the currently installed version of all packs.
+	GetPacks() ([]PolicyPack, error)
+}
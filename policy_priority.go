@@ -0,0 +1,54 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"sort"
+)
+
+// PrioritizedPolicy is implemented by policies which have a priority. Policies with a higher priority are
+// evaluated first by strategies which depend on the order of policies, such as FirstApplicableStrategy.
+type PrioritizedPolicy interface {
+	// GetPriority returns the policies priority.
+	GetPriority() int
+}
+
+// PolicyPriority returns the priority of p, or zero if it does not implement PrioritizedPolicy.
+func PolicyPriority(p Policy) int {
+	if pp, ok := p.(PrioritizedPolicy); ok {
+		return pp.GetPriority()
+	}
+	return 0
+}
+
+// SortByPriority returns a copy of policies sorted by priority, highest first. Policies with the same priority are
+// sorted by ID, so the order does not depend on the manager.
+func SortByPriority(policies Policies) Policies {
+	sorted := make(Policies, len(policies))
+	copy(sorted, policies)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if pi, pj := PolicyPriority(sorted[i]), PolicyPriority(sorted[j]); pi != pj {
+			return pi > pj
+		}
+		return sorted[i].GetID() < sorted[j].GetID()
+	})
+	return sorted
+}
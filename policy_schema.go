@@ -0,0 +1,288 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PolicySchema is the JSON Schema (draft 2020-12) of policy documents as encoded by DefaultPolicy, including the
+// options of all built-in conditions. Conditions of other types are accepted with any options.
+//
+//go:embed policy_schema.json
+var PolicySchema []byte
+
+var policySchema map[string]interface{}
+
+func init() {
+	if err := json.Unmarshal(PolicySchema, &policySchema); err != nil {
+		panic(err)
+	}
+}
+
+// DecodePolicy decodes a JSON policy document after checking it against PolicySchema, so that malformed policies
+// are rejected before they reach a manager. Violations are reported by an ErrInvalidPolicy whose details contain
+// the JSON Pointer of every offending value, for example "/conditions/ip/options/cidr". Decoded policies are
+// validated like managers do, see ValidatePolicy.
+func DecodePolicy(raw []byte) (Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, NewErrInvalidPolicy(new(DefaultPolicy), []FsckIssue{{Check: FsckCheckJSON, Message: fmt.Sprintf("Document can not be decoded: %s", err)}})
+	} else if dec.More() {
+		return nil, NewErrInvalidPolicy(new(DefaultPolicy), []FsckIssue{{Check: FsckCheckJSON, Message: "Document contains more than one value"}})
+	}
+
+	p := new(DefaultPolicy)
+	if obj, ok := doc.(map[string]interface{}); ok {
+		p.ID, _ = obj["id"].(string)
+	}
+
+	v := &schemaValidator{root: policySchema}
+	v.validate(policySchema, doc, "")
+	v.checkConditionTypes(doc)
+	if len(v.issues) > 0 {
+		sort.SliceStable(v.issues, func(i, j int) bool { return v.issues[i].Path < v.issues[j].Path })
+		for k := range v.issues {
+			v.issues[k].PolicyID = p.ID
+		}
+		return nil, NewErrInvalidPolicy(p, v.issues)
+	}
+
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, NewErrInvalidPolicy(p, []FsckIssue{{PolicyID: p.ID, Check: FsckCheckJSON, Message: fmt.Sprintf("Document can not be decoded: %s", err)}})
+	} else if err := ValidatePolicy(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// schemaValidator checks a decoded JSON document against the keywords of JSON Schema used by PolicySchema:
+// $ref to $defs, type, enum, const, properties, required, additionalProperties, items, allOf, if and then,
+// minLength, maxLength, minimum, maximum and the date-time format. Other keywords are ignored.
+type schemaValidator struct {
+	root   map[string]interface{}
+	issues []FsckIssue
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "/"
+	}
+	v.issues = append(v.issues, FsckIssue{Check: FsckCheckSchema, Path: path, Message: path + " " + fmt.Sprintf(format, args...)})
+}
+
+// matches returns true if value is valid against schema, without recording issues.
+func (v *schemaValidator) matches(schema map[string]interface{}, value interface{}) bool {
+	probe := &schemaValidator{root: v.root}
+	probe.validate(schema, value, "")
+	return len(probe.issues) == 0
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, _ := v.root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+		if def == nil {
+			panic(fmt.Sprintf("schema reference %s can not be resolved", ref))
+		}
+		v.validate(def, value, path)
+	}
+
+	if t, ok := schema["type"]; ok && !hasSchemaType(t, value) {
+		v.fail(path, "must be of type %s", formatSchemaType(t))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || schemaEqual(e, value)
+		}
+		if !found {
+			v.fail(path, "must be one of %s", formatSchemaValues(enum))
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !schemaEqual(c, value) {
+		v.fail(path, "must be %s", formatSchemaValues([]interface{}{c}))
+	}
+
+	switch val := value.(type) {
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(len([]rune(val))) < min {
+			v.fail(path, "must not be shorter than %v characters", min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && float64(len([]rune(val))) > max {
+			v.fail(path, "must not be longer than %v characters", max)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, val); err != nil {
+				v.fail(path, "must be a date-time as defined by RFC 3339")
+			}
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if min, ok := schema["minimum"].(float64); ok && f < min {
+			v.fail(path, "must be at least %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && f > max {
+			v.fail(path, "must be at most %v", max)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for k, item := range val {
+				v.validate(items, item, fmt.Sprintf("%s/%d", path, k))
+			}
+		}
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			v.validate(s.(map[string]interface{}), value, path)
+		}
+	}
+
+	if cond, ok := schema["if"].(map[string]interface{}); ok && v.matches(cond, value) {
+		if then, ok := schema["then"].(map[string]interface{}); ok {
+			v.validate(then, value, path)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) {
+	required, _ := schema["required"].([]interface{})
+	for _, r := range required {
+		if _, ok := obj[r.(string)]; !ok {
+			v.fail(path+"/"+escapePointer(r.(string)), "is required")
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, key := range keys {
+		child := path + "/" + escapePointer(key)
+		if s, ok := properties[key].(map[string]interface{}); ok {
+			v.validate(s, obj[key], child)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(child, "is not allowed")
+			}
+		case map[string]interface{}:
+			v.validate(additional, obj[key], child)
+		}
+	}
+}
+
+// checkConditionTypes reports conditions whose type is not registered in ConditionFactories. The schema can not
+// list them, because conditions can be added at runtime.
+func (v *schemaValidator) checkConditionTypes(doc interface{}) {
+	obj, _ := doc.(map[string]interface{})
+	conditions, _ := obj["conditions"].(map[string]interface{})
+	for key, c := range conditions {
+		name, _ := c.(map[string]interface{})["type"].(string)
+		if _, ok := ConditionFactories[name]; name != "" && !ok {
+			v.fail("/conditions/"+escapePointer(key)+"/type", "names the unregistered condition type %s", name)
+		}
+	}
+}
+
+func hasSchemaType(t interface{}, value interface{}) bool {
+	if types, ok := t.([]interface{}); ok {
+		for _, t := range types {
+			if hasSchemaType(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch val := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "integer" {
+			f, ok := new(big.Float).SetString(val.String())
+			return ok && f.IsInt()
+		}
+		return t == "number"
+	case []interface{}:
+		return t == "array"
+	case map[string]interface{}:
+		return t == "object"
+	}
+	return false
+}
+
+func formatSchemaType(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		names := make([]string, len(types))
+		for k, t := range types {
+			names[k] = fmt.Sprint(t)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func formatSchemaValues(values []interface{}) string {
+	out := make([]string, len(values))
+	for k, value := range values {
+		raw, _ := json.Marshal(value)
+		out[k] = string(raw)
+	}
+	return strings.Join(out, ", ")
+}
+
+// schemaEqual compares a value of the schema, where numbers are float64, with a value of the document.
+func schemaEqual(a, b interface{}) bool {
+	if n, ok := b.(json.Number); ok {
+		f, err := n.Float64()
+		return err == nil && a == f
+	}
+	return a == b
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
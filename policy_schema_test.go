@@ -0,0 +1,92 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+)
+
+func TestDecodePolicy(t *testing.T) {
+	conditions := Conditions{}
+	for name, factory := range ConditionFactories {
+		conditions[name] = factory()
+	}
+	conditions["any"] = &AnyOfCondition{Conditions: []Condition{&CIDRCondition{CIDR: "10.0.0.0/8"}}}
+
+	for k, policy := range []*DefaultPolicy{
+		{ID: "1", Effect: AllowAccess},
+		{
+			ID: "2", Description: "description", Subjects: []string{"peter"}, Effect: DenyAccess, Resources: []string{"articles:<[0-9]+>"},
+			Actions: []string{"get"}, Conditions: conditions, Meta: []byte(`{"key":"value"}`), Version: 3, MatchMode: MatchModeGlob,
+			Tenant: "acme", Priority: 10, Template: &TemplateRef{ID: "t", Parameters: map[string]string{"a": "b"}}, Disabled: true,
+			Labels: map[string]string{"team": "blog"}, ExcludedActions: []string{"delete"}, StartDelimiter: "{", EndDelimiter: "}",
+		},
+	} {
+		raw, err := json.Marshal(policy)
+		require.NoError(t, err)
+
+		decoded, err := DecodePolicy(raw)
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, policy.GetID(), decoded.GetID())
+		assert.Len(t, decoded.GetConditions(), len(policy.Conditions))
+	}
+}
+
+func TestDecodePolicyErrors(t *testing.T) {
+	for k, c := range []struct {
+		raw   string
+		paths []string
+	}{
+		{raw: `{"id": "1", "effect": "allow", "subject": ["peter"]}`, paths: []string{"/subject"}},
+		{raw: `{"effect": "allow", "subjects": "peter"}`, paths: []string{"/id", "/subjects"}},
+		{raw: `{"id": "1", "effect": "allow", "match_mode": "fuzzy", "priority": 1.5}`, paths: []string{"/match_mode", "/priority"}},
+		{raw: `{"id": "1", "effect": "allow", "conditions": {"ip": {"type": "CIDRCondition", "options": {"cidr": 10}}}}`, paths: []string{"/conditions/ip/options/cidr"}},
+		{raw: `{"id": "1", "effect": "allow", "conditions": {"a/b": {"type": "UnknownCondition"}}}`, paths: []string{"/conditions/a~1b/type"}},
+		{raw: `{"id": "1", "effect": "allow", "conditions": {"geo": {"type": "GeoCondition", "options": {"lat": 100}}}}`, paths: []string{"/conditions/geo/options/lat"}},
+		{raw: `{"id": "1", "effect": "allow", "conditions": {"date": {"type": "DateCondition", "options": {"after": "tomorrow"}}}}`, paths: []string{"/conditions/date/options/after"}},
+		{raw: `{"id": "1", "effect": "allow", "conditions": {"any": {"type": "AnyOfCondition", "options": {"conditions": [{"type": "BooleanCondition", "options": {"value": "yes"}}]}}}}`, paths: []string{"/conditions/any/options/conditions/0/options/value"}},
+		{raw: `{"id": "1", "effect": "allow", "start_delimiter": "{{"}`, paths: []string{"/start_delimiter"}},
+		{raw: `["not", "a", "policy"]`, paths: []string{"/"}},
+	} {
+		_, err := DecodePolicy([]byte(c.raw))
+		require.Error(t, err, "%d", k)
+
+		var paths []string
+		for _, detail := range errors.Cause(err).(interface {
+			Details() []map[string]interface{}
+		}).Details() {
+			assert.Equal(t, FsckCheckSchema, detail["check"], "%d", k)
+			paths = append(paths, detail["path"].(string))
+		}
+		assert.Equal(t, c.paths, paths, "%d: %s", k, err)
+	}
+
+	_, err := DecodePolicy([]byte(`{"id": "1"`))
+	assert.Error(t, err)
+	_, err = DecodePolicy([]byte(`{"id": "1", "effect": "alow"}`))
+	assert.Contains(t, err.Error(), `unknown effect "alow"`, "policies are validated after decoding")
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Signature is an Ed25519 signature over the canonical form of a policy, see SignaturePayload.
+type Signature struct {
+	// KeyID identifies the public key which verifies the signature, so keys can be rotated.
+	KeyID string `json:"key_id" yaml:"key_id" gorethink:"key_id"`
+
+	// Value is the standard base64 encoded signature.
+	Value string `json:"value" yaml:"value" gorethink:"value"`
+}
+
+// SignedPolicy is implemented by policies which carry a signature.
+type SignedPolicy interface {
+	// GetSignature returns the policies signature, or nil if it is not signed.
+	GetSignature() *Signature
+}
+
+// PolicySignature returns the signature of p, or nil if it is not signed or does not implement SignedPolicy.
+func PolicySignature(p Policy) *Signature {
+	if sp, ok := p.(SignedPolicy); ok {
+		return sp.GetSignature()
+	}
+	return nil
+}
+
+// signaturePayload is the canonical form of a policy. Every field is set explicitly and empty lists are never
+// null, so a policy has the same payload regardless of the manager it was stored in.
+type signaturePayload struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description"`
+	Subjects    []string          `json:"subjects"`
+	Effect      string            `json:"effect"`
+	Resources   []string          `json:"resources"`
+	Actions     []string          `json:"actions"`
+	Conditions  Conditions        `json:"conditions"`
+	Meta        []byte            `json:"meta"`
+	MatchMode   MatchMode         `json:"match_mode"`
+	Tenant      string            `json:"tenant"`
+	Priority    int               `json:"priority"`
+	Template    *TemplateRef      `json:"template"`
+	Disabled    bool              `json:"disabled"`
+	Labels      map[string]string `json:"labels"`
+
+	ExcludedSubjects  []string `json:"excluded_subjects"`
+	ExcludedResources []string `json:"excluded_resources"`
+	ExcludedActions   []string `json:"excluded_actions"`
+
+	StartDelimiter string `json:"start_delimiter"`
+	EndDelimiter   string `json:"end_delimiter"`
+}
+
+// SignaturePayload returns the canonical JSON encoding of p which is signed. It covers every field which affects
+// decisions, but neither the version, which managers increment on every write, nor the signature itself.
+func SignaturePayload(p Policy) ([]byte, error) {
+	nonNil := func(values []string) []string {
+		if values == nil {
+			return []string{}
+		}
+		return values
+	}
+
+	excludedSubjects, excludedResources, excludedActions := PolicyExclusions(p)
+	payload := signaturePayload{
+		ID:          p.GetID(),
+		Description: p.GetDescription(),
+		Subjects:    nonNil(p.GetSubjects()),
+		Effect:      p.GetEffect(),
+		Resources:   nonNil(p.GetResources()),
+		Actions:     nonNil(p.GetActions()),
+		Conditions:  p.GetConditions(),
+		Meta:        p.GetMeta(),
+		MatchMode:   PolicyMatchMode(p),
+		Tenant:      PolicyTenant(p),
+		Priority:    PolicyPriority(p),
+		Template:    PolicyTemplateRef(p),
+		Disabled:    !PolicyActive(p),
+		Labels:      PolicyLabels(p),
+
+		ExcludedSubjects:  nonNil(excludedSubjects),
+		ExcludedResources: nonNil(excludedResources),
+		ExcludedActions:   nonNil(excludedActions),
+
+		StartDelimiter: string(p.GetStartDelimiter()),
+		EndDelimiter:   string(p.GetEndDelimiter()),
+	}
+
+	if payload.Conditions == nil {
+		payload.Conditions = Conditions{}
+	}
+	if payload.Labels == nil {
+		payload.Labels = map[string]string{}
+	}
+	if len(payload.Meta) == 0 {
+		payload.Meta = nil
+	}
+
+	out, err := json.Marshal(&payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+// Signer signs policies with an Ed25519 private key.
+type Signer struct {
+	// KeyID is stored with every signature and identifies the public key in the verifier's key ring.
+	KeyID string
+
+	// Key is the private key.
+	Key ed25519.PrivateKey
+}
+
+// Sign signs p and stores the signature in it. Policies must not be modified afterwards, except for their version.
+func (s *Signer) Sign(p *DefaultPolicy) error {
+	if len(s.Key) != ed25519.PrivateKeySize {
+		return errors.Errorf("Private key %q must be %d bytes long, got %d", s.KeyID, ed25519.PrivateKeySize, len(s.Key))
+	}
+
+	payload, err := SignaturePayload(p)
+	if err != nil {
+		return err
+	}
+
+	p.Signature = &Signature{
+		KeyID: s.KeyID,
+		Value: base64.StdEncoding.EncodeToString(ed25519.Sign(s.Key, payload)),
+	}
+	return nil
+}
+
+// Verifier verifies the signatures of policies against a key ring of Ed25519 public keys. A nil Verifier accepts
+// every policy.
+type Verifier struct {
+	// Keys maps key IDs to public keys. Keys which were rotated out can be kept until all policies they signed
+	// are signed again.
+	Keys map[string]ed25519.PublicKey
+
+	// AllowUnsigned accepts policies without a signature, which helps to sign existing policies one by one.
+	// Policies which are signed are verified nevertheless.
+	AllowUnsigned bool
+}
+
+// Verify returns ErrPolicySignature if p is not signed, signed by an unknown or malformed key or if its signature
+// does not match, for example because p was modified in the datastore.
+func (v *Verifier) Verify(p Policy) error {
+	if v == nil {
+		return nil
+	}
+
+	signature := PolicySignature(p)
+	if signature == nil {
+		if v.AllowUnsigned {
+			return nil
+		}
+		return NewErrPolicySignature(p, "", "is not signed")
+	}
+
+	key, ok := v.Keys[signature.KeyID]
+	if !ok {
+		return NewErrPolicySignature(p, signature.KeyID, "is signed by an unknown key")
+	} else if len(key) != ed25519.PublicKeySize {
+		return NewErrPolicySignature(p, signature.KeyID, "is signed by a key which is malformed in the key ring")
+	}
+
+	value, err := base64.StdEncoding.DecodeString(signature.Value)
+	if err != nil {
+		return NewErrPolicySignature(p, signature.KeyID, "has a malformed signature")
+	}
+
+	payload, err := SignaturePayload(p)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, payload, value) {
+		return NewErrPolicySignature(p, signature.KeyID, "does not match its signature")
+	}
+	return nil
+}
+
+// VerifyAll verifies every policy and returns the first error.
+func (v *Verifier) VerifyAll(policies Policies) error {
+	for _, p := range policies {
+		if err := v.Verify(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyingManager wraps a Manager and verifies the signature of every policy which is written or read, so
+// policies which were modified in a shared datastore are rejected instead of being enforced.
+type VerifyingManager struct {
+	Manager  Manager
+	Verifier *Verifier
+}
+
+// NewVerifyingManager returns a VerifyingManager verifying the policies of m with v.
+func NewVerifyingManager(m Manager, v *Verifier) *VerifyingManager {
+	return &VerifyingManager{Manager: m, Verifier: v}
+}
+
+// Create verifies and persists the policy.
+func (m *VerifyingManager) Create(policy Policy) error {
+	if err := m.Verifier.Verify(policy); err != nil {
+		return err
+	}
+	return m.Manager.Create(policy)
+}
+
+// Update verifies the policy and updates the existing policy.
+func (m *VerifyingManager) Update(policy Policy) error {
+	if err := m.Verifier.Verify(policy); err != nil {
+		return err
+	}
+	return m.Manager.Update(policy)
+}
+
+// Get retrieves and verifies a policy.
+func (m *VerifyingManager) Get(id string) (Policy, error) {
+	p, err := m.Manager.Get(id)
+	if err != nil {
+		return nil, err
+	} else if err := m.Verifier.Verify(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Delete removes a policy.
+func (m *VerifyingManager) Delete(id string) error {
+	return m.Manager.Delete(id)
+}
+
+// GetAll retrieves and verifies all policies.
+func (m *VerifyingManager) GetAll(limit, offset int64) (Policies, error) {
+	return m.verified(m.Manager.GetAll(limit, offset))
+}
+
+// FindRequestCandidates returns the verified candidates of the wrapped manager.
+func (m *VerifyingManager) FindRequestCandidates(r *Request) (Policies, error) {
+	return m.verified(m.Manager.FindRequestCandidates(r))
+}
+
+// FindPoliciesForSubject returns the verified policies the wrapped manager finds for the subject.
+func (m *VerifyingManager) FindPoliciesForSubject(subject string) (Policies, error) {
+	return m.verified(m.Manager.FindPoliciesForSubject(subject))
+}
+
+// FindPoliciesForResource returns the verified policies the wrapped manager finds for the resource.
+func (m *VerifyingManager) FindPoliciesForResource(resource string) (Policies, error) {
+	return m.verified(m.Manager.FindPoliciesForResource(resource))
+}
+
+// Close closes the wrapped manager.
+func (m *VerifyingManager) Close(ctx context.Context) error {
+	return Close(ctx, m.Manager)
+}
+
+// IndexesLiterals returns true if the wrapped manager looks candidates up verbatim.
+func (m *VerifyingManager) IndexesLiterals() bool {
+	return IndexesLiterals(m.Manager)
+}
+
+func (m *VerifyingManager) verified(policies Policies, err error) (Policies, error) {
+	if err != nil {
+		return nil, err
+	} else if err := m.Verifier.VerifyAll(policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
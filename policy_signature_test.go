@@ -0,0 +1,175 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/compact"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func signaturePolicy(t *testing.T, signer *Signer) *DefaultPolicy {
+	p := &DefaultPolicy{
+		ID:         "1",
+		Subjects:   []string{"peter"},
+		Resources:  []string{"articles:<[0-9]+>"},
+		Actions:    []string{"get"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{"owner": &EqualsSubjectCondition{}},
+		Labels:     map[string]string{"team": "blog"},
+	}
+	require.NoError(t, signer.Sign(p))
+	return p
+}
+
+func TestPolicySignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	rotated, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	signer := &Signer{KeyID: "2024", Key: private}
+	verifier := &Verifier{Keys: map[string]ed25519.PublicKey{"2023": rotated, "2024": public}}
+
+	p := signaturePolicy(t, signer)
+	require.NotNil(t, PolicySignature(p))
+	assert.Equal(t, "2024", PolicySignature(p).KeyID)
+	require.NoError(t, verifier.Verify(p))
+
+	// Managers increment the version, which is not signed.
+	p.Version = 3
+	require.NoError(t, verifier.Verify(p))
+
+	// Signatures survive encoding and the compact manager.
+	raw, err := json.Marshal(p)
+	require.NoError(t, err)
+	var decoded DefaultPolicy
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	require.NoError(t, verifier.Verify(&decoded))
+
+	raw, err = yaml.Marshal(p)
+	require.NoError(t, err)
+	decoded = DefaultPolicy{}
+	require.NoError(t, yaml.Unmarshal(raw, &decoded))
+	require.NoError(t, verifier.Verify(&decoded))
+
+	cm, err := NewCompactManager(Policies{p})
+	require.NoError(t, err)
+	compacted, err := cm.Get("1")
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(compacted))
+
+	for k, tc := range []struct {
+		modify func(p *DefaultPolicy)
+		key    string
+		err    string
+	}{
+		{modify: func(p *DefaultPolicy) { p.Effect = DenyAccess }, key: "2024", err: `Policy "1" does not match its signature`},
+		{modify: func(p *DefaultPolicy) { p.Subjects = append(p.Subjects, "<.*>") }, key: "2024", err: "does not match"},
+		{modify: func(p *DefaultPolicy) { p.Disabled = true }, key: "2024", err: "does not match"},
+		{modify: func(p *DefaultPolicy) { p.Conditions = Conditions{} }, key: "2024", err: "does not match"},
+		{modify: func(p *DefaultPolicy) { p.Signature.KeyID = "2023" }, key: "2023", err: "does not match"},
+		{modify: func(p *DefaultPolicy) { p.Signature.KeyID = "2022" }, key: "2022", err: "is signed by an unknown key"},
+		{modify: func(p *DefaultPolicy) { p.Signature.Value = "?" }, key: "2024", err: "has a malformed signature"},
+		{modify: func(p *DefaultPolicy) { p.Signature = nil }, err: `Policy "1" is not signed`},
+	} {
+		tampered := signaturePolicy(t, signer)
+		tc.modify(tampered)
+
+		err := verifier.Verify(tampered)
+		require.Error(t, err, "%d", k)
+		assert.Contains(t, err.Error(), tc.err, "%d", k)
+
+		details := errors.Cause(err).(interface {
+			Details() []map[string]interface{}
+		}).Details()
+		require.Len(t, details, 1, "%d", k)
+		assert.Equal(t, "1", details[0]["policy"], "%d", k)
+		if tc.key != "" {
+			assert.Equal(t, tc.key, details[0]["key"], "%d", k)
+		}
+	}
+
+	assert.Error(t, verifier.Verify(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+
+	// Keys of the wrong length are rejected instead of panicking.
+	malformed := &Verifier{Keys: map[string]ed25519.PublicKey{"2024": public[:16]}}
+	err = malformed.Verify(signaturePolicy(t, signer))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "malformed")
+	assert.Equal(t, "policy_signature", errors.Cause(err).(interface{ ID() string }).ID())
+	assert.Error(t, (&Signer{KeyID: "2024", Key: private[:16]}).Sign(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+
+	assert.NoError(t, (&Verifier{AllowUnsigned: true}).Verify(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+	assert.NoError(t, (*Verifier)(nil).Verify(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+}
+
+func TestVerifyingManager(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	signer := &Signer{KeyID: "1", Key: private}
+	verifier := &Verifier{Keys: map[string]ed25519.PublicKey{"1": public}}
+	mm := NewMemoryManager()
+	m := NewVerifyingManager(mm, verifier)
+	warden := &Ladon{Manager: mm, Verifier: verifier}
+
+	p := signaturePolicy(t, signer)
+	require.NoError(t, m.Create(p))
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "2", Effect: AllowAccess}))
+
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: Context{"owner": "peter"}}
+	require.NoError(t, warden.IsAllowed(r))
+
+	got, err := m.Get("1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", got.GetID())
+
+	// The policy is modified in the datastore, bypassing the verifying manager.
+	p.Subjects = []string{"<.*>"}
+	_, err = m.Get("1")
+	assert.Error(t, err)
+	_, err = m.GetAll(10, 0)
+	assert.Error(t, err)
+	_, err = m.FindRequestCandidates(r)
+	assert.Error(t, err)
+
+	err = warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:1", Context: Context{"owner": "ken"}})
+	require.Error(t, err)
+	assert.Equal(t, "policy_signature", errors.Cause(err).(interface{ ID() string }).ID())
+	_, err = warden.Capabilities(&Request{Subject: "ken", Resource: "articles:1", Context: Context{"owner": "ken"}})
+	assert.Error(t, err)
+	_, err = warden.Audience("articles:1", "get")
+	assert.Error(t, err)
+
+	require.NoError(t, signer.Sign(p))
+	require.NoError(t, m.Update(p))
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:1", Context: Context{"owner": "ken"}}))
+	require.NoError(t, m.Delete("1"))
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+// SourcedPolicy is implemented by policies loaded from a versioned source, for example a commit of a Git repository.
+// Audit records list the sources of the policies which decided a request, so every decision can be traced to the
+// reviewed change which introduced the policies.
+type SourcedPolicy interface {
+	Policy
+
+	// GetSource returns the revision of the source the policy was loaded from, for example a commit SHA.
+	GetSource() string
+}
+
+// PolicySource returns the source of p, or "" if it does not implement SourcedPolicy.
+func PolicySource(p Policy) string {
+	if sp, ok := p.(SourcedPolicy); ok {
+		return sp.GetSource()
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// PolicyTemplate is a parameterized policy, from which concrete policies are instantiated, for example one per
+// tenant or project. Subjects, resources, actions, the description and the tenant are text/template templates
+// which are executed with the parameters, for example "projects:{{.ProjectID}}:<.*>".
+type PolicyTemplate struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Subjects    []string   `json:"subjects"`
+	Effect      Effect     `json:"effect"`
+	Resources   []string   `json:"resources"`
+	Actions     []string   `json:"actions"`
+	Conditions  Conditions `json:"conditions"`
+	MatchMode   MatchMode  `json:"match_mode,omitempty"`
+	Tenant      string     `json:"tenant,omitempty"`
+	Priority    int        `json:"priority,omitempty"`
+
+	// Parameters are the names of the parameters every instantiation must supply.
+	Parameters []string `json:"parameters"`
+}
+
+// TemplateRef records which template a policy was instantiated from, and with which parameters.
+type TemplateRef struct {
+	ID         string            `json:"id" yaml:"id"`
+	Parameters map[string]string `json:"parameters" yaml:"parameters"`
+}
+
+// TemplatedPolicy is implemented by policies which record the template they were instantiated from.
+type TemplatedPolicy interface {
+	// GetTemplate returns the template the policy was instantiated from, or nil.
+	GetTemplate() *TemplateRef
+}
+
+// PolicyTemplateRef returns the template p was instantiated from, or nil if p was not instantiated from a template
+// or does not implement TemplatedPolicy.
+func PolicyTemplateRef(p Policy) *TemplateRef {
+	if tp, ok := p.(TemplatedPolicy); ok {
+		return tp.GetTemplate()
+	}
+	return nil
+}
+
+// TemplateManager is implemented by managers which are able to store policy templates.
+type TemplateManager interface {
+	// CreateTemplate persists the template.
+	CreateTemplate(t *PolicyTemplate) error
+
+	// UpdateTemplate updates an existing template. Instances are not updated, see RegenerateInstances.
+	UpdateTemplate(t *PolicyTemplate) error
+
+	// GetTemplate retrieves a template.
+	GetTemplate(id string) (*PolicyTemplate, error)
+
+	// DeleteTemplate removes a template. Instances are kept.
+	DeleteTemplate(id string) error
+
+	// GetTemplates retrieves all templates, ordered by ID.
+	GetTemplates() ([]*PolicyTemplate, error)
+}
+
+// UnmarshalJSON decodes the template including its conditions.
+func (t *PolicyTemplate) UnmarshalJSON(data []byte) error {
+	type plain PolicyTemplate
+	pt := plain{Conditions: Conditions{}}
+	if err := json.Unmarshal(data, &pt); err != nil {
+		return errors.WithStack(err)
+	}
+
+	*t = PolicyTemplate(pt)
+	return nil
+}
+
+// Validate returns an error if the template has no ID or one of its templates can not be parsed.
+func (t *PolicyTemplate) Validate() error {
+	if t.ID == "" {
+		return errors.New("Policy template has no ID")
+	}
+
+	_, err := t.execute(nil)
+	return err
+}
+
+// Instantiate returns the policy with the given ID resulting from executing the template with parameters. It fails
+// if a declared parameter is missing, the template refers to an undeclared parameter or the resulting policy is
+// invalid.
+func (t *PolicyTemplate) Instantiate(id string, parameters map[string]string) (*DefaultPolicy, error) {
+	var missing []string
+	for _, name := range t.Parameters {
+		if _, ok := parameters[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, errors.Errorf(`Policy template %s requires parameters %s`, t.ID, strings.Join(missing, ", "))
+	}
+
+	p, err := t.execute(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	// Conditions are copied, so instances never share state with the template or each other.
+	encoded, err := json.Marshal(t.Conditions)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if err := json.Unmarshal(encoded, &p.Conditions); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	refParameters := make(map[string]string, len(parameters))
+	for k, v := range parameters {
+		refParameters[k] = v
+	}
+
+	p.ID = id
+	p.Effect = t.Effect
+	p.MatchMode = t.MatchMode
+	p.Priority = t.Priority
+	p.Template = &TemplateRef{ID: t.ID, Parameters: refParameters}
+
+	if err := ValidatePolicy(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// execute executes all templates with parameters. If parameters is nil, the templates are only parsed.
+func (t *PolicyTemplate) execute(parameters map[string]string) (*DefaultPolicy, error) {
+	p := &DefaultPolicy{Conditions: Conditions{}}
+
+	var err error
+	if p.Description, err = t.executeOne("description", t.Description, parameters); err != nil {
+		return nil, err
+	} else if p.Tenant, err = t.executeOne("tenant", t.Tenant, parameters); err != nil {
+		return nil, err
+	} else if p.Subjects, err = t.executeAll("subjects", t.Subjects, parameters); err != nil {
+		return nil, err
+	} else if p.Resources, err = t.executeAll("resources", t.Resources, parameters); err != nil {
+		return nil, err
+	} else if p.Actions, err = t.executeAll("actions", t.Actions, parameters); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (t *PolicyTemplate) executeAll(field string, texts []string, parameters map[string]string) ([]string, error) {
+	out := make([]string, len(texts))
+	for k, text := range texts {
+		var err error
+		if out[k], err = t.executeOne(field, text, parameters); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (t *PolicyTemplate) executeOne(field, text string, parameters map[string]string) (string, error) {
+	parsed, err := template.New(field).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "Could not parse %s of policy template %s", field, t.ID)
+	} else if parameters == nil {
+		return "", nil
+	}
+
+	var out bytes.Buffer
+	if err := parsed.Execute(&out, parameters); err != nil {
+		return "", errors.Wrapf(err, "Could not execute %s of policy template %s", field, t.ID)
+	}
+	return out.String(), nil
+}
+
+// InstantiateTemplate instantiates t with parameters and creates the resulting policy in m.
+func InstantiateTemplate(m Manager, t *PolicyTemplate, id string, parameters map[string]string) (Policy, error) {
+	p, err := t.Instantiate(id, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Create(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FindInstances returns all policies stored in m which were instantiated from the template with the given ID.
+func FindInstances(m Manager, templateID string) (Policies, error) {
+	var instances Policies
+	err := exportPages(m, func(ps Policies) error {
+		for _, p := range ps {
+			if ref := PolicyTemplateRef(p); ref != nil && ref.ID == templateID {
+				instances = append(instances, p)
+			}
+		}
+		return nil
+	})
+	return instances, err
+}
+
+// RegenerateInstances instantiates t again for every policy in m which was instantiated from it, using the recorded
+// parameters, and updates the policies. All instances are instantiated before the first one is updated, so a
+// template which can not be instantiated leaves the store untouched. It returns the updated policies.
+func RegenerateInstances(m Manager, t *PolicyTemplate) (Policies, error) {
+	instances, err := FindInstances(m, t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	regenerated := make(Policies, len(instances))
+	for k, instance := range instances {
+		p, err := t.Instantiate(instance.GetID(), PolicyTemplateRef(instance).Parameters)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not regenerate policy %s", instance.GetID())
+		}
+
+		if vc, ok := instance.(VersionedPolicy); ok {
+			p.SetVersion(vc.GetVersion())
+		}
+		regenerated[k] = p
+	}
+
+	for _, p := range regenerated {
+		if err := m.Update(p); err != nil {
+			return nil, err
+		}
+	}
+	return regenerated, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestPolicyTemplate(t *testing.T) {
+	tpl := &PolicyTemplate{
+		ID:          "project-editor",
+		Description: "Editors of project {{.ProjectID}}",
+		Subjects:    []string{"{{.Team}}"},
+		Resources:   []string{"projects:{{.ProjectID}}:<.*>"},
+		Actions:     []string{"get", "update"},
+		Effect:      AllowAccess,
+		Tenant:      "{{.Tenant}}",
+		Conditions:  Conditions{"ip": &CIDRCondition{CIDR: "10.0.0.0/8"}},
+		Parameters:  []string{"ProjectID", "Team", "Tenant"},
+	}
+	require.NoError(t, tpl.Validate())
+
+	p, err := tpl.Instantiate("project-editor-1", map[string]string{"ProjectID": "1", "Team": "team:a", "Tenant": "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, "Editors of project 1", p.Description)
+	assert.Equal(t, []string{"team:a"}, p.Subjects)
+	assert.Equal(t, []string{"projects:1:<.*>"}, p.Resources)
+	assert.Equal(t, "acme", p.Tenant)
+	assert.Equal(t, &TemplateRef{ID: "project-editor", Parameters: map[string]string{"ProjectID": "1", "Team": "team:a", "Tenant": "acme"}}, PolicyTemplateRef(p))
+
+	// Conditions are copied.
+	assert.Equal(t, tpl.Conditions, p.Conditions)
+	p.Conditions["ip"].(*CIDRCondition).CIDR = "0.0.0.0/0"
+	assert.Equal(t, "10.0.0.0/8", tpl.Conditions["ip"].(*CIDRCondition).CIDR)
+
+	_, err = tpl.Instantiate("project-editor-2", map[string]string{"ProjectID": "2"})
+	assert.EqualError(t, err, "Policy template project-editor requires parameters Team, Tenant")
+
+	_, err = (&PolicyTemplate{ID: "typo", Subjects: []string{"{{.Tem}}"}, Effect: AllowAccess}).Instantiate("x", map[string]string{"Team": "a"})
+	assert.Error(t, err)
+	assert.Error(t, (&PolicyTemplate{ID: "broken", Subjects: []string{"{{.Team"}}).Validate())
+	assert.Error(t, (&PolicyTemplate{}).Validate())
+
+	// The template reference survives encoding.
+	encoded, err := json.Marshal(p)
+	require.NoError(t, err)
+	var decoded DefaultPolicy
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, p.Template, decoded.Template)
+
+	encoded, err = json.Marshal(tpl)
+	require.NoError(t, err)
+	var decodedTemplate PolicyTemplate
+	require.NoError(t, json.Unmarshal(encoded, &decodedTemplate))
+	assert.Equal(t, tpl, &decodedTemplate)
+}
+
+func TestRegenerateInstances(t *testing.T) {
+	m := NewMemoryManager()
+	tpl := &PolicyTemplate{ID: "reader", Subjects: []string{"{{.Team}}"}, Resources: []string{"projects:{{.Project}}"}, Actions: []string{"get"}, Effect: AllowAccess}
+
+	for id, project := range map[string]string{"reader-1": "1", "reader-2": "2"} {
+		_, err := InstantiateTemplate(m, tpl, id, map[string]string{"Team": "team:" + project, "Project": project})
+		require.NoError(t, err)
+	}
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "standalone", Subjects: []string{"peter"}, Effect: AllowAccess}))
+
+	instances, err := FindInstances(m, "reader")
+	require.NoError(t, err)
+	assert.Len(t, instances, 2)
+
+	tpl.Actions = []string{"get", "list"}
+	updated, err := RegenerateInstances(m, tpl)
+	require.NoError(t, err)
+	assert.Len(t, updated, 2)
+
+	p, err := m.Get("reader-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"get", "list"}, p.GetActions())
+	assert.Equal(t, []string{"projects:2"}, p.GetResources())
+
+	// A template which can not be instantiated with the recorded parameters leaves all instances untouched.
+	tpl.Parameters = []string{"Owner"}
+	_, err = RegenerateInstances(m, tpl)
+	assert.Error(t, err)
+
+	_, err = InstantiateTemplate(m, tpl, "reader-1", map[string]string{"Owner": "x", "Team": "a", "Project": "1"})
+	assert.Equal(t, ErrPolicyExists, errors.Cause(err))
+}
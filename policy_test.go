@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
 )
 
 var policyConditions = Conditions{
@@ -44,6 +45,7 @@ var policyCases = []*DefaultPolicy{
 		Resources:   []string{"articles:<[0-9]+>"},
 		Actions:     []string{"create", "update"},
 		Conditions:  policyConditions,
+		Version:     3,
 	},
 	{
 		Effect:     DenyAccess,
@@ -101,13 +103,53 @@ func TestGetters(t *testing.T) {
 		assert.Equal(t, c.Resources, c.GetResources())
 		assert.Equal(t, c.Subjects, c.GetSubjects())
 		assert.Equal(t, len(c.Conditions), len(c.GetConditions()))
-		assert.Equal(t, c.Effect, c.GetEffect())
+		assert.Equal(t, string(c.Effect), c.GetEffect())
 		assert.Equal(t, c.Actions, c.GetActions())
+		assert.Equal(t, c.Version, c.GetVersion())
 		assert.Equal(t, byte('<'), c.GetStartDelimiter())
 		assert.Equal(t, byte('>'), c.GetEndDelimiter())
 	}
 }
 
+func TestPolicyDelimiters(t *testing.T) {
+	curly := &DefaultPolicy{ID: "curly", Subjects: []string{"peter"}, Actions: []string{"get"}, Resources: []string{"<html>:{[0-9]+}"},
+		Effect: AllowAccess, StartDelimiter: "{", EndDelimiter: "}"}
+	angle := &DefaultPolicy{ID: "angle", Subjects: []string{"ken"}, Actions: []string{"get"}, Resources: []string{"{[0-9]+}:<[0-9]+>"},
+		Effect: AllowAccess}
+	assert.Equal(t, byte('{'), curly.GetStartDelimiter())
+	assert.Equal(t, byte('}'), curly.GetEndDelimiter())
+	require.NoError(t, ValidatePolicy(curly))
+
+	raw, err := json.Marshal(curly)
+	require.NoError(t, err)
+	var decoded DefaultPolicy
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.Equal(t, "{", decoded.StartDelimiter)
+	assert.Equal(t, "}", decoded.EndDelimiter)
+
+	warden := &Ladon{Manager: NewMemoryManager()}
+	require.NoError(t, warden.Manager.Create(curly))
+	require.NoError(t, warden.Manager.Create(angle))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "<html>:42"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "<html>:abc"}))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "{[0-9]+}:42"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "1:42"}))
+
+	// The same template compiles to different expressions under different delimiters.
+	same := &DefaultPolicy{ID: "same", Subjects: []string{"max"}, Actions: []string{"get"}, Resources: []string{"{a}<b>"}, Effect: AllowAccess,
+		StartDelimiter: "{", EndDelimiter: "}"}
+	other := &DefaultPolicy{ID: "other", Subjects: []string{"max"}, Actions: []string{"put"}, Resources: []string{"{a}<b>"}, Effect: AllowAccess}
+	require.NoError(t, warden.Manager.Create(same))
+	require.NoError(t, warden.Manager.Create(other))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "max", Action: "get", Resource: "a<b>"}))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "max", Action: "put", Resource: "{a}b"}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "max", Action: "put", Resource: "a<b>"}))
+
+	assert.Error(t, ValidatePolicy(&DefaultPolicy{ID: "1", Effect: AllowAccess, StartDelimiter: "{{", EndDelimiter: "}}"}))
+	assert.Error(t, ValidatePolicy(&DefaultPolicy{ID: "1", Effect: AllowAccess, StartDelimiter: ">"}))
+	assert.Error(t, ValidatePolicy(&DefaultPolicy{ID: "1", Effect: AllowAccess, Resources: []string{"<html>:{[0-9]+"}, StartDelimiter: "{", EndDelimiter: "}"}))
+}
+
 func RequireError(t *testing.T, expectError bool, err error, args ...interface{}) {
 	if err != nil && !expectError {
 		t.Logf("Unexpected error: %s\n", err.Error())
@@ -0,0 +1,94 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"fmt"
+
+	"github.com/ory/ladon/compiler"
+)
+
+// RegexLimits bounds the complexity of the regular expressions in templates of policies using MatchModeRegex.
+// ValidatePolicy rejects templates exceeding them, so that no policy can introduce expressions which stall the
+// evaluation of requests. Expressions which still take too long are aborted by the matcher's timeout.
+var RegexLimits = compiler.Limits{MaxLength: 4096, MaxGroups: 32, MaxRepeat: 1000}
+
+// ValidatePolicy returns an error if p would fail when requests are evaluated: it must have an ID, a known effect
+// and match mode, two distinct delimiters which are balanced in all templates, templates which compile within
+// RegexLimits and conditions registered in ConditionFactories. All problems are reported at once, the error's
+// details list one entry per problem. Managers call this before writing a policy.
+func ValidatePolicy(p Policy) error {
+	if issues := validatePolicy(p); len(issues) > 0 {
+		return NewErrInvalidPolicy(p, issues)
+	}
+	return nil
+}
+
+func validatePolicy(p Policy) []FsckIssue {
+	var issues []FsckIssue
+	add := func(check, format string, args ...interface{}) {
+		issues = append(issues, FsckIssue{PolicyID: p.GetID(), Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.GetID() == "" {
+		add(FsckCheckID, "Policy has no ID")
+	}
+
+	if err := ValidateMatchMode(p); err != nil {
+		add(FsckCheckMatchMode, "%s", err)
+	}
+
+	if dp, ok := p.(*DefaultPolicy); ok && (len(dp.StartDelimiter) > 1 || len(dp.EndDelimiter) > 1) {
+		add(FsckCheckDelimiter, "Delimiters %q and %q must be single ASCII characters", dp.StartDelimiter, dp.EndDelimiter)
+	} else if p.GetStartDelimiter() == p.GetEndDelimiter() {
+		add(FsckCheckDelimiter, "Start and end delimiter must differ")
+	}
+
+	// Templates of policies using other match modes are never compiled.
+	excludedSubjects, excludedResources, excludedActions := PolicyExclusions(p)
+	for _, field := range [][]string{p.GetSubjects(), p.GetResources(), p.GetActions(), excludedSubjects, excludedResources, excludedActions} {
+		for _, template := range field {
+			if PolicyMatchMode(p) != MatchModeRegex {
+				continue
+			} else if err := compiler.ValidateDelimiters(template, p.GetStartDelimiter(), p.GetEndDelimiter()); err != nil {
+				add(FsckCheckDelimiter, "Template %s has unbalanced delimiters", template)
+			} else if _, err := compiler.CompileRegex(template, p.GetStartDelimiter(), p.GetEndDelimiter()); err != nil {
+				add(FsckCheckRegex, "Template %s does not compile: %s", template, err)
+			} else if err := compiler.ValidateLimits(template, p.GetStartDelimiter(), p.GetEndDelimiter(), RegexLimits); err != nil {
+				add(FsckCheckRegex, "Template %s is too complex: %s", template, err)
+			}
+		}
+	}
+
+	if err := ValidateEffect(p); err != nil {
+		add(FsckCheckEffect, "%s", err)
+	}
+
+	for key, c := range p.GetConditions() {
+		if c == nil {
+			add(FsckCheckCondition, "Condition %s is nil", key)
+		} else if _, ok := ConditionFactories[c.GetName()]; !ok {
+			add(FsckCheckCondition, "Condition %s has unregistered type %s", key, c.GetName())
+		}
+	}
+
+	return issues
+}
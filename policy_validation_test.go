@@ -0,0 +1,69 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	assert.NoError(t, ValidatePolicy(&DefaultPolicy{ID: "1", Subjects: []string{"<.*>"}, Resources: []string{"articles:<[0-9]+>"}, Effect: AllowAccess}))
+	assert.NoError(t, ValidatePolicy(&DefaultPolicy{ID: "1", Subjects: []string{"<[>"}, Effect: AllowAccess, MatchMode: MatchModeExact}))
+
+	err := ValidatePolicy(&DefaultPolicy{
+		Subjects:   []string{"<.*"},
+		Resources:  []string{"<[>"},
+		Effect:     "maybe",
+		Conditions: Conditions{"foo": nil},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Policy has no ID")
+
+	var checks []string
+	for _, detail := range errors.Cause(err).(interface {
+		Details() []map[string]interface{}
+	}).Details() {
+		checks = append(checks, detail["check"].(string))
+	}
+	assert.Equal(t, []string{FsckCheckID, FsckCheckDelimiter, FsckCheckRegex, FsckCheckEffect, FsckCheckCondition}, checks)
+
+	m := NewMemoryManager()
+	assert.Error(t, m.Create(&DefaultPolicy{ID: "1", Resources: []string{"<[>"}, Effect: AllowAccess}))
+	assert.Error(t, m.Create(&DefaultPolicy{Effect: AllowAccess}))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Effect: AllowAccess}))
+	assert.Error(t, m.Update(&DefaultPolicy{ID: "1", Subjects: []string{"<.*"}, Effect: AllowAccess}))
+}
+
+func TestValidatePolicyRegexLimits(t *testing.T) {
+	err := ValidatePolicy(&DefaultPolicy{ID: "1", Resources: []string{"articles:<(a+)+>"}, Effect: AllowAccess})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too complex")
+
+	assert.Error(t, NewMemoryManager().Create(&DefaultPolicy{ID: "1", Subjects: []string{"<[a-z]{1,100000}>"}, Effect: AllowAccess}))
+	assert.NoError(t, ValidatePolicy(&DefaultPolicy{ID: "1", Resources: []string{"<[a-z]+(:[a-z]+)*>"}, Effect: AllowAccess}))
+}
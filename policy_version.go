@@ -0,0 +1,53 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import "time"
+
+// VersionedPolicy is implemented by policies which support optimistic concurrency control. Managers
+// increment the version on every update and reject updates of policies whose version is outdated.
+type VersionedPolicy interface {
+	Policy
+
+	// GetVersion returns the policies version.
+	GetVersion() int
+
+	// SetVersion sets the policies version.
+	SetVersion(version int)
+}
+
+// PolicyRevision is a snapshot of a policy as it was stored at a given version.
+type PolicyRevision struct {
+	// Version is the version of the policy at the time of the snapshot.
+	Version int `json:"version"`
+
+	// Policy is the policy as it was stored at that version. It is nil if the revision records a deletion.
+	Policy Policy `json:"policy"`
+
+	// ChangedAt is the time the revision was written.
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// HistoryManager is implemented by managers which keep track of previous versions of a policy.
+type HistoryManager interface {
+	// GetHistory returns all revisions of a policy, oldest first.
+	GetHistory(id string) ([]PolicyRevision, error)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlPolicy carries the metadata of a DefaultPolicy as a string, which is more readable than the list of bytes
+// YAML encodes byte slices as. Metadata which is not valid UTF-8 is encoded as !!binary.
+type yamlPolicy struct {
+	yamlPolicyFields `yaml:",inline"`
+	Meta             string `yaml:"meta,omitempty"`
+}
+
+// yamlPolicyFields has the fields, but not the methods of DefaultPolicy.
+type yamlPolicyFields DefaultPolicy
+
+// MarshalYAML marshals the policy to YAML. The field names are the same as in JSON.
+func (p *DefaultPolicy) MarshalYAML() (interface{}, error) {
+	return &yamlPolicy{yamlPolicyFields: yamlPolicyFields(*p), Meta: string(p.Meta)}, nil
+}
+
+// UnmarshalYAML overwrites the policy with the values of the given policy in YAML format.
+func (p *DefaultPolicy) UnmarshalYAML(value *yaml.Node) error {
+	var pol yamlPolicy
+	if err := value.Decode(&pol); err != nil {
+		return errors.WithStack(err)
+	}
+
+	*p = DefaultPolicy(pol.yamlPolicyFields)
+	if pol.Meta != "" {
+		p.Meta = []byte(pol.Meta)
+	}
+	return nil
+}
+
+type yamlCondition struct {
+	Type    string      `yaml:"type"`
+	Options interface{} `yaml:"options,omitempty"`
+}
+
+// MarshalYAML marshals a list of conditions to YAML, using the same type and options as MarshalJSON. The options
+// carry the field names of the condition's JSON representation, so conditions need no YAML tags.
+func (cs Conditions) MarshalYAML() (interface{}, error) {
+	out := make(map[string]yamlCondition, len(cs))
+	for k, c := range cs {
+		jc, err := marshalCondition(c)
+		if err != nil {
+			return nil, err
+		}
+
+		yc := yamlCondition{Type: jc.Type}
+		if err := json.Unmarshal(jc.Options, &yc.Options); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		out[k] = yc
+	}
+
+	return out, nil
+}
+
+// UnmarshalYAML unmarshals a list of conditions from YAML. Conditions are created with ConditionFactories and
+// decoded from their options like UnmarshalJSON does.
+func (cs *Conditions) UnmarshalYAML(value *yaml.Node) error {
+	var ycs map[string]yamlCondition
+	if err := value.Decode(&ycs); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if *cs == nil {
+		*cs = make(Conditions, len(ycs))
+	}
+
+	for k, yc := range ycs {
+		jc := jsonCondition{Type: yc.Type}
+		if yc.Options != nil {
+			raw, err := json.Marshal(yc.Options)
+			if err != nil {
+				return errors.Wrapf(err, "Could not decode options of condition %s", k)
+			}
+			jc.Options = raw
+		}
+
+		c, err := unmarshalCondition(jc)
+		if err != nil {
+			return errors.Wrapf(err, "Could not decode condition %s", k)
+		}
+		(*cs)[k] = c
+	}
+
+	return nil
+}
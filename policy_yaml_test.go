@@ -0,0 +1,93 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/ory/ladon"
+)
+
+func TestPolicyYAML(t *testing.T) {
+	policy := &DefaultPolicy{
+		ID:          "1",
+		Description: "description",
+		Subjects:    []string{"user"},
+		Effect:      AllowAccess,
+		Resources:   []string{"articles:<[0-9]+>"},
+		Actions:     []string{"create", "update"},
+		Conditions: Conditions{
+			"owner": &EqualsSubjectCondition{},
+			"ip":    &CIDRCondition{CIDR: "10.0.0.0/8"},
+			"after": &DateCondition{After: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+			"not":   &NotCondition{Condition: &BooleanCondition{BooleanValue: true}},
+		},
+		Meta:              []byte(`{"key":"value"}`),
+		Version:           3,
+		MatchMode:         MatchModeRegex,
+		Labels:            map[string]string{"team": "blog"},
+		Template:          &TemplateRef{ID: "owner", Parameters: map[string]string{"subject": "user"}},
+		ExcludedResources: []string{"articles:1"},
+	}
+
+	out, err := yaml.Marshal(policy)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "match_mode: regex")
+	assert.Contains(t, string(out), "excluded_resources:")
+	assert.Contains(t, string(out), `meta: '{"key":"value"}'`)
+	assert.Contains(t, string(out), "cidr: 10.0.0.0/8", "options use the names of the JSON representation")
+
+	var decoded DefaultPolicy
+	require.NoError(t, yaml.Unmarshal(out, &decoded))
+	assert.Equal(t, policy, &decoded)
+
+	policy.Meta = []byte{0xff, 0x00}
+	out, err = yaml.Marshal(policy)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(out, &decoded))
+	assert.Equal(t, policy.Meta, decoded.Meta, "binary metadata is preserved")
+}
+
+func TestPolicyYAMLConditions(t *testing.T) {
+	var p DefaultPolicy
+	require.NoError(t, yaml.Unmarshal([]byte(`
+id: "1"
+effect: allow
+conditions:
+  owner:
+    type: EqualsSubjectCondition
+  any:
+    type: AnyOfCondition
+    options:
+      conditions:
+        - type: StringEqualCondition
+          options: {equals: blog}
+`), &p))
+	assert.Equal(t, &EqualsSubjectCondition{}, p.Conditions["owner"])
+	assert.Equal(t, &AnyOfCondition{Conditions: []Condition{&StringEqualCondition{Equals: "blog"}}}, p.Conditions["any"])
+
+	assert.Error(t, yaml.Unmarshal([]byte("conditions: {foo: {type: UnknownCondition}}"), &p))
+	assert.Error(t, yaml.Unmarshal([]byte("conditions: {ip: {type: CIDRCondition, options: {cidr: [1]}}}"), &p))
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Redacted replaces sensitive context values.
+const Redacted = "[REDACTED]"
+
+// Redactor hides sensitive request context values. Ladon applies it to the requests passed to audit loggers and
+// metrics and to errors returned by effect handlers, so secrets and PII do not leak into logs.
+type Redactor struct {
+	// Keys lists the context keys which are sensitive. Keys may contain regular expressions enclosed by <>,
+	// for example "<(?i).*token.*>".
+	Keys []string
+}
+
+// NewRedactor returns a Redactor treating the given context keys as sensitive.
+func NewRedactor(keys ...string) *Redactor {
+	return &Redactor{Keys: keys}
+}
+
+// IsSensitive returns true if key matches one of the sensitive keys.
+func (r *Redactor) IsSensitive(key string) bool {
+	if r == nil || len(r.Keys) == 0 {
+		return false
+	}
+
+	// DefaultPolicy provides the default regular expression delimiters.
+	matches, err := DefaultMatcher.Matches(new(DefaultPolicy), r.Keys, key)
+
+	// If the patterns can not be evaluated, it is safer to assume the key is sensitive.
+	return err != nil || matches
+}
+
+// Context returns a copy of c with all sensitive values replaced by Redacted.
+func (r *Redactor) Context(c Context) Context {
+	if r == nil || len(r.Keys) == 0 || c == nil {
+		return c
+	}
+
+	out := make(Context, len(c))
+	for k, v := range c {
+		if r.IsSensitive(k) {
+			v = Redacted
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Request returns a copy of req with a redacted context. If nothing is sensitive, req itself is returned.
+func (r *Redactor) Request(req *Request) *Request {
+	if r == nil || len(r.Keys) == 0 || req == nil || len(req.Context) == 0 {
+		return req
+	}
+
+	redacted := *req
+	redacted.Context = r.Context(req.Context)
+	return &redacted
+}
+
+// Error returns err with the sensitive context values of req removed from its message. The returned error's
+// cause is err, so errors.Cause keeps working.
+func (r *Redactor) Error(req *Request, err error) error {
+	if r == nil || len(r.Keys) == 0 || err == nil || req == nil {
+		return err
+	}
+
+	msg := err.Error()
+	for k, v := range req.Context {
+		if s := fmt.Sprint(v); s != "" && r.IsSensitive(k) {
+			msg = strings.Replace(msg, s, Redacted, -1)
+		}
+	}
+
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, cause: err}
+}
+
+type redactedError struct {
+	msg   string
+	cause error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Cause returns the original error.
+func (e *redactedError) Cause() error {
+	return e.cause
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type contextAuditLogger struct {
+	contexts []Context
+}
+
+func (a *contextAuditLogger) LogRejectedAccessRequest(r *Request, p Policies, d Policies) {
+	a.contexts = append(a.contexts, r.Context)
+}
+
+func (a *contextAuditLogger) LogGrantedAccessRequest(r *Request, p Policies, d Policies) {
+	a.contexts = append(a.contexts, r.Context)
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor("password", "<(?i).*token.*>")
+
+	assert.True(t, r.IsSensitive("password"))
+	assert.True(t, r.IsSensitive("AccessToken"))
+	assert.False(t, r.IsSensitive("owner"))
+	assert.False(t, (*Redactor)(nil).IsSensitive("password"))
+
+	c := Context{"password": "secret", "access_token": "abc", "owner": "peter"}
+	assert.Equal(t, Context{"password": Redacted, "access_token": Redacted, "owner": "peter"}, r.Context(c))
+	assert.Equal(t, "secret", c["password"])
+
+	req := &Request{Subject: "peter", Context: c}
+	assert.Equal(t, Context{"password": Redacted, "access_token": Redacted, "owner": "peter"}, r.Request(req).Context)
+	assert.True(t, req == NewRedactor().Request(req))
+
+	original := errors.New("token abc is invalid for peter")
+	err := r.Error(req, original)
+	assert.Equal(t, "token [REDACTED] is invalid for peter", err.Error())
+	assert.Equal(t, original, errors.Cause(err))
+}
+
+func TestLadonRedactor(t *testing.T) {
+	EffectHandlers["require-password"] = func(r *Request, p Policy) error {
+		return errors.Errorf("password %v is wrong", r.Context["password"])
+	}
+	defer delete(EffectHandlers, "require-password")
+
+	logger := new(contextAuditLogger)
+	warden := &Ladon{
+		Manager:     NewMemoryManager(),
+		AuditLogger: logger,
+		Redactor:    NewRedactor("password"),
+	}
+	require.NoError(t, warden.Manager.Create(&DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Resources: []string{"<.*>"},
+		Actions:   []string{"<.*>"},
+		Effect:    "require-password",
+	}))
+
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: Context{"password": "hunter2"}}
+	err := warden.IsAllowed(r)
+	require.Error(t, err)
+	assert.Equal(t, "password [REDACTED] is wrong", err.Error())
+	assert.Equal(t, "hunter2", r.Context["password"])
+
+	require.Len(t, logger.contexts, 1)
+	assert.Equal(t, Context{"password": Redacted}, logger.contexts[0])
+}
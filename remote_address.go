@@ -0,0 +1,161 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ForwardingHeader is a header proxies use to pass on the address of the client.
+type ForwardingHeader string
+
+const (
+	// XForwardedForHeader is the de-facto standard header appended to by most proxies, for example nginx and AWS
+	// Elastic Load Balancing.
+	XForwardedForHeader ForwardingHeader = "X-Forwarded-For"
+
+	// ForwardedHeader is the header standardized by RFC 7239.
+	ForwardedHeader ForwardingHeader = "Forwarded"
+)
+
+// RemoteAddressExtractor extracts the IP address of the client which issued a HTTP request, for example to populate
+// the context consumed by CIDRCondition. The forwarding header is only honored if it was set by a trusted proxy,
+// because otherwise any client could spoof its address.
+type RemoteAddressExtractor struct {
+	// TrustedProxies are the networks of proxies whose forwarding headers are trusted.
+	TrustedProxies []*net.IPNet
+
+	// Header is the forwarding header the trusted proxies set. It defaults to XForwardedForHeader. The other header
+	// is never read, because proxies usually pass it on from the client unchanged.
+	Header ForwardingHeader
+}
+
+// NewRemoteAddressExtractor returns a RemoteAddressExtractor trusting proxies in the given CIDRs. Single IP addresses
+// are accepted as well.
+func NewRemoteAddressExtractor(trustedProxies ...string) (*RemoteAddressExtractor, error) {
+	e := new(RemoteAddressExtractor)
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.Errorf("Trusted proxy %s is neither an IP address nor a CIDR", proxy)
+			} else if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		e.TrustedProxies = append(e.TrustedProxies, network)
+	}
+	return e, nil
+}
+
+// Extract returns the normalized IP address of the client which issued the request. The forwarding chain is walked
+// from the closest hop backwards, skipping trusted proxies, and the first untrusted address is returned.
+func (e *RemoteAddressExtractor) Extract(r *http.Request) (string, error) {
+	peer, ok := NormalizeIP(r.RemoteAddr)
+	if !ok {
+		return "", errors.Errorf("Remote address %s is not a valid IP address", r.RemoteAddr)
+	}
+
+	hops := forwardedFor(r.Header, e.Header)
+	for i := len(hops) - 1; i >= 0 && e.trusted(peer); i-- {
+		hop, ok := NormalizeIP(hops[i])
+		if !ok {
+			// Obfuscated identifiers and "unknown" can not be followed, the last valid hop is the best we can do.
+			break
+		}
+		peer = hop
+	}
+
+	return peer, nil
+}
+
+func (e *RemoteAddressExtractor) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, network := range e.TrustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the addresses of the forwarding chain in the given header, leftmost (the original client)
+// first.
+func forwardedFor(header http.Header, name ForwardingHeader) []string {
+	var hops []string
+	if name == ForwardedHeader {
+		for _, value := range header[http.CanonicalHeaderKey(string(ForwardedHeader))] {
+			for _, element := range strings.Split(value, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+					if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+						hops = append(hops, strings.Trim(kv[1], `"`))
+					}
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, value := range header[http.CanonicalHeaderKey(string(XForwardedForHeader))] {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// NormalizeIP parses addresses as found in RemoteAddr and forwarding headers, for example "192.0.2.1:8080",
+// "[2001:db8::1]:443" or "fe80::1%eth0", and returns the bare IP address. IPv4-mapped IPv6 addresses are returned
+// in their IPv4 form so that they match IPv4 CIDRs.
+func NormalizeIP(address string) (string, bool) {
+	address = strings.TrimSpace(address)
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil || port == "" {
+			address = host
+		}
+	}
+
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if i := strings.LastIndex(address, "%"); i > 0 {
+		address = address[:i]
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", false
+	} else if v4 := ip.To4(); v4 != nil {
+		return v4.String(), true
+	}
+	return ip.String(), true
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeIP(t *testing.T) {
+	for _, c := range []struct {
+		in  string
+		out string
+		ok  bool
+	}{
+		{in: "192.0.2.1", out: "192.0.2.1", ok: true},
+		{in: "192.0.2.1:8080", out: "192.0.2.1", ok: true},
+		{in: " 192.0.2.1 ", out: "192.0.2.1", ok: true},
+		{in: "2001:db8::1", out: "2001:db8::1", ok: true},
+		{in: "2001:DB8:0:0:0:0:0:1", out: "2001:db8::1", ok: true},
+		{in: "[2001:db8::1]", out: "2001:db8::1", ok: true},
+		{in: "[2001:db8::1]:443", out: "2001:db8::1", ok: true},
+		{in: "fe80::1%eth0", out: "fe80::1", ok: true},
+		{in: "[fe80::1%eth0]:80", out: "fe80::1", ok: true},
+		{in: "::ffff:192.0.2.1", out: "192.0.2.1", ok: true},
+		{in: "unknown", ok: false},
+		{in: "_hidden", ok: false},
+		{in: "", ok: false},
+	} {
+		out, ok := NormalizeIP(c.in)
+		assert.Equal(t, c.ok, ok, c.in)
+		assert.Equal(t, c.out, out, c.in)
+	}
+}
+
+func TestRemoteAddressExtractor(t *testing.T) {
+	_, err := NewRemoteAddressExtractor("not-an-ip")
+	require.Error(t, err)
+
+	e, err := NewRemoteAddressExtractor("10.0.0.0/8", "2001:db8:ffff::1")
+	require.NoError(t, err)
+	require.Len(t, e.TrustedProxies, 2)
+
+	for k, c := range []struct {
+		remote string
+		use    ForwardingHeader
+		header http.Header
+		expect string
+	}{
+		{remote: "192.0.2.1:1234", expect: "192.0.2.1"},
+		{remote: "[2001:db8::5]:1234", expect: "2001:db8::5"},
+		{
+			remote: "192.0.2.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			expect: "192.0.2.1",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			expect: "198.51.100.1",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9, 198.51.100.1, 10.0.0.2"}},
+			expect: "198.51.100.1",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9", "10.0.0.3, 10.0.0.2"}},
+			expect: "203.0.113.9",
+		},
+		{
+			remote: "[2001:db8:ffff::1]:443",
+			use:    ForwardedHeader,
+			header: http.Header{"Forwarded": {`for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`}},
+			expect: "2001:db8:cafe::17",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			use:    ForwardedHeader,
+			header: http.Header{
+				"Forwarded":       {"for=192.0.2.60;proto=http;by=203.0.113.43"},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			expect: "192.0.2.60",
+		},
+		{
+			// The proxy appended to X-Forwarded-For and passed on the Forwarded header of the client.
+			remote: "10.0.0.1:1234",
+			header: http.Header{
+				"Forwarded":       {"for=192.0.2.60"},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			expect: "198.51.100.1",
+		},
+		{
+			// The header which is not configured is never read, even if the configured one is missing.
+			remote: "10.0.0.1:1234",
+			header: http.Header{"Forwarded": {"for=192.0.2.60"}},
+			expect: "10.0.0.1",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			use:    ForwardedHeader,
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			expect: "10.0.0.1",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			use:    ForwardedHeader,
+			header: http.Header{"Forwarded": {"for=unknown, for=10.0.0.2"}},
+			expect: "10.0.0.2",
+		},
+		{
+			remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"::ffff:198.51.100.1"}},
+			expect: "198.51.100.1",
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			e.Header = c.use
+			ip, err := e.Extract(&http.Request{RemoteAddr: c.remote, Header: c.header})
+			require.NoError(t, err)
+			assert.Equal(t, c.expect, ip)
+			assert.True(t, (&CIDRCondition{CIDR: "::/0"}).Fulfills(ip, nil) || (&CIDRCondition{CIDR: "0.0.0.0/0"}).Fulfills(ip, nil))
+		})
+	}
+
+	_, err = e.Extract(&http.Request{RemoteAddr: "@"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// RequestField selects the fields of a request which a normalizer rewrites. Fields can be combined with |.
+type RequestField int
+
+const (
+	// RequestSubject selects the subject of a request.
+	RequestSubject RequestField = 1 << iota
+
+	// RequestAction selects the action of a request.
+	RequestAction
+
+	// RequestResource selects the resource of a request.
+	RequestResource
+
+	// RequestAllFields selects the subject, action and resource of a request.
+	RequestAllFields = RequestSubject | RequestAction | RequestResource
+)
+
+// RequestNormalizer rewrites the fields of a request before it is matched against policies, so that requests of
+// services which encode the same subject, action or resource differently are decided alike.
+type RequestNormalizer interface {
+	// Normalize rewrites the fields of r in place.
+	Normalize(r *Request) error
+}
+
+// RequestNormalizerFunc adapts a function to the RequestNormalizer interface.
+type RequestNormalizerFunc func(r *Request) error
+
+// Normalize calls f.
+func (f RequestNormalizerFunc) Normalize(r *Request) error {
+	return f(r)
+}
+
+// RequestNormalizers is a list of normalizers which run in order. Normalizers which decode, like
+// NormalizeURLDecode, should come first, so the decoded values are normalized by the others.
+type RequestNormalizers []RequestNormalizer
+
+// Normalize runs all normalizers and returns a normalized copy of r. The context of r is not copied, as it is not
+// normalized.
+func (ns RequestNormalizers) Normalize(r *Request) (*Request, error) {
+	if len(ns) == 0 {
+		return r, nil
+	}
+
+	normalized := *r
+	for _, n := range ns {
+		if err := n.Normalize(&normalized); err != nil {
+			return nil, err
+		}
+	}
+	return &normalized, nil
+}
+
+// normalizeFields returns a normalizer applying f to the selected fields.
+func normalizeFields(fields RequestField, f func(string) (string, error)) RequestNormalizer {
+	return RequestNormalizerFunc(func(r *Request) (err error) {
+		for _, field := range []struct {
+			field RequestField
+			value *string
+		}{
+			{RequestSubject, &r.Subject},
+			{RequestAction, &r.Action},
+			{RequestResource, &r.Resource},
+		} {
+			if fields&field.field == 0 {
+				continue
+			} else if *field.value, err = f(*field.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NormalizeLowercase returns a normalizer which converts the selected fields to lower case. Policies must be
+// written in lower case as well.
+func NormalizeLowercase(fields RequestField) RequestNormalizer {
+	return normalizeFields(fields, func(value string) (string, error) {
+		return strings.ToLower(value), nil
+	})
+}
+
+// NormalizeTrimSpace returns a normalizer which removes leading and trailing white space from the selected fields.
+func NormalizeTrimSpace(fields RequestField) RequestNormalizer {
+	return normalizeFields(fields, func(value string) (string, error) {
+		return strings.TrimSpace(value), nil
+	})
+}
+
+// NormalizeNFC returns a normalizer which converts the selected fields to Unicode normalization form C, so that
+// for example "é" matches regardless of whether it was sent as one code point or as "e" and a combining accent.
+func NormalizeNFC(fields RequestField) RequestNormalizer {
+	return normalizeFields(fields, func(value string) (string, error) {
+		return norm.NFC.String(value), nil
+	})
+}
+
+// NormalizeURLDecode returns a normalizer which decodes percent-encoded characters of the selected fields, usually
+// RequestResource. Requests with malformed escapes fail. Values are decoded once, so "%2541" becomes "%41".
+func NormalizeURLDecode(fields RequestField) RequestNormalizer {
+	return normalizeFields(fields, func(value string) (string, error) {
+		decoded, err := url.PathUnescape(value)
+		if err != nil {
+			return "", errors.Wrapf(err, `Could not decode "%s"`, value)
+		}
+		return decoded, nil
+	})
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestRequestNormalizers(t *testing.T) {
+	for k, tc := range []struct {
+		normalizers RequestNormalizers
+		in, out     Request
+		err         bool
+	}{
+		{
+			in:  Request{Subject: " Peter ", Action: "GET", Resource: "a%20b"},
+			out: Request{Subject: " Peter ", Action: "GET", Resource: "a%20b"},
+		},
+		{
+			normalizers: RequestNormalizers{NormalizeTrimSpace(RequestAllFields), NormalizeLowercase(RequestSubject | RequestAction)},
+			in:          Request{Subject: " Peter ", Action: "GET\n", Resource: " Articles:1 "},
+			out:         Request{Subject: "peter", Action: "get", Resource: "Articles:1"},
+		},
+		{
+			normalizers: RequestNormalizers{NormalizeNFC(RequestAllFields)},
+			in:          Request{Subject: "rené", Resource: "café"},
+			out:         Request{Subject: "rené", Resource: "café"},
+		},
+		{
+			normalizers: RequestNormalizers{NormalizeURLDecode(RequestResource), NormalizeNFC(RequestResource)},
+			in:          Request{Subject: "a%20b", Resource: "files:caf%65%CC%81%2541"},
+			out:         Request{Subject: "a%20b", Resource: "files:café%41"},
+		},
+		{
+			normalizers: RequestNormalizers{NormalizeURLDecode(RequestResource)},
+			in:          Request{Resource: "files:%zz"},
+			err:         true,
+		},
+		{
+			normalizers: RequestNormalizers{RequestNormalizerFunc(func(r *Request) error {
+				r.Subject = "users:" + r.Subject
+				return nil
+			})},
+			in:  Request{Subject: "peter"},
+			out: Request{Subject: "users:peter"},
+		},
+	} {
+		in := tc.in
+		out, err := tc.normalizers.Normalize(&in)
+		if tc.err {
+			assert.Error(t, err, "%d", k)
+			continue
+		}
+
+		require.NoError(t, err, "%d", k)
+		assert.Equal(t, tc.out, *out, "%d", k)
+		assert.Equal(t, tc.in, in, "%d", k)
+	}
+}
+
+func TestLadonNormalizers(t *testing.T) {
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:        "1",
+		Subjects:  []string{"peter"},
+		Resources: []string{"files:<.*>"},
+		Actions:   []string{"get"},
+		Effect:    AllowAccess,
+	}))
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:        "2",
+		Subjects:  []string{"peter"},
+		Resources: []string{"files:café/secret"},
+		Actions:   []string{"get"},
+		Effect:    DenyAccess,
+	}))
+
+	r := &Request{Subject: " Peter", Action: "GET", Resource: "files:cafe%CC%81/secret"}
+	warden := &Ladon{Manager: m}
+	assert.Error(t, warden.IsAllowed(r))
+
+	warden.Normalizers = RequestNormalizers{
+		NormalizeURLDecode(RequestResource),
+		NormalizeNFC(RequestResource),
+		NormalizeTrimSpace(RequestSubject),
+		NormalizeLowercase(RequestSubject | RequestAction),
+	}
+	err := warden.IsAllowed(r)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "forcefully denied")
+	assert.Equal(t, " Peter", r.Subject)
+
+	require.NoError(t, warden.IsAllowed(&Request{Subject: "PETER", Action: "Get", Resource: "files:caf%C3%A9/public"}))
+	require.NoError(t, warden.DoPoliciesAllow(&Request{Subject: "PETER", Action: "Get", Resource: "files:a%20b"}, Policies{&DefaultPolicy{
+		Subjects:  []string{"peter"},
+		Resources: []string{"files:a b"},
+		Actions:   []string{"get"},
+		Effect:    AllowAccess,
+	}}))
+	assert.Error(t, warden.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "files:%zz"}))
+
+	capabilities, err := warden.Capabilities(&Request{Subject: "Peter ", Resource: "files:caf%C3%A9/public"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"get"}, capabilities)
+}
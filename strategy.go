@@ -0,0 +1,196 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Decision is the outcome of a Strategy.
+type Decision struct {
+	// Allowed is true if access is granted.
+	Allowed bool
+
+	// Deciders are the policies which led to the decision. If access is denied and Deciders is not empty, the
+	// last decider is the policy which denied access. Denials without deciders are treated as if no policy matched,
+	// which makes Ladon apply its DefaultEffect.
+	Deciders Policies
+
+	// Err is returned to the caller if access is denied. If nil, ErrRequestForcefullyDenied or ErrRequestDenied
+	// is returned.
+	Err error
+}
+
+// Strategy combines the policies applicable to a request into a decision. Ladon passes only candidates whose
+// subjects, resources and actions match the request and whose conditions are fulfilled, in the order returned by
+// the manager.
+type Strategy interface {
+	// Decide returns the decision for r. An error means that the request could not be processed.
+	Decide(r *Request, candidates Policies) (*Decision, error)
+}
+
+// DenyOverridesStrategy grants access if at least one policy allows it and none denies it. Policies with a custom
+// effect are passed to their handler in EffectHandlers, which denies access by returning an error. Policies with
+// unknown effects deny access.
+type DenyOverridesStrategy struct{}
+
+// Decide returns the decision for r.
+func (s *DenyOverridesStrategy) Decide(r *Request, candidates Policies) (*Decision, error) {
+	d := &Decision{Deciders: Policies{}}
+	for _, p := range candidates {
+		// Does the policy have a custom effect? If yes, its handler decides whether the request is denied.
+		// Policies with an unknown effect are treated like deny policies below.
+		if effect := Effect(p.GetEffect()); effect != EffectAllow && effect != EffectDeny {
+			if handler, ok := EffectHandlers[effect]; ok {
+				if err := handler(r, p); err != nil {
+					d.Allowed = false
+					d.Deciders = append(d.Deciders, p)
+					d.Err = err
+					return d, nil
+				}
+				continue
+			}
+		}
+
+		// Is the policy's effect `deny`? If yes, this overrides all allow policies -> access denied.
+		if !p.AllowAccess() {
+			d.Allowed = false
+			d.Deciders = append(d.Deciders, p)
+			d.Err = errors.WithStack(ErrRequestForcefullyDenied)
+			return d, nil
+		}
+
+		d.Allowed = true
+		d.Deciders = append(d.Deciders, p)
+	}
+
+	return d, nil
+}
+
+// FirstApplicableStrategy evaluates policies in the order of their priority, highest first, and the first policy
+// which allows or denies access decides, like the rules of a firewall. Policies with a custom effect are passed to
+// their handler in EffectHandlers; if it returns an error, the policy denies access, otherwise evaluation
+// continues. Policies with unknown effects deny access.
+type FirstApplicableStrategy struct{}
+
+// Decide returns the decision for r.
+func (s *FirstApplicableStrategy) Decide(r *Request, candidates Policies) (*Decision, error) {
+	for _, p := range SortByPriority(candidates) {
+		if effect := Effect(p.GetEffect()); effect != EffectAllow && effect != EffectDeny {
+			if handler, ok := EffectHandlers[effect]; ok {
+				if err := handler(r, p); err != nil {
+					return &Decision{Deciders: Policies{p}, Err: err}, nil
+				}
+				continue
+			}
+		}
+
+		if !p.AllowAccess() {
+			return &Decision{Deciders: Policies{p}, Err: errors.WithStack(ErrRequestForcefullyDenied)}, nil
+		}
+		return &Decision{Allowed: true, Deciders: Policies{p}}, nil
+	}
+
+	return &Decision{Deciders: Policies{}}, nil
+}
+
+// PermitOverridesStrategy grants access if at least one policy allows it, even if others deny it. Policies with a
+// custom effect are passed to their handler in EffectHandlers, which denies access by returning an error. Policies
+// with unknown effects deny access.
+type PermitOverridesStrategy struct{}
+
+// Decide returns the decision for r.
+func (s *PermitOverridesStrategy) Decide(r *Request, candidates Policies) (*Decision, error) {
+	allowed := &Decision{Allowed: true, Deciders: Policies{}}
+	var denied *Decision
+	for _, p := range candidates {
+		if effect := Effect(p.GetEffect()); effect != EffectAllow && effect != EffectDeny {
+			if handler, ok := EffectHandlers[effect]; ok {
+				if err := handler(r, p); err != nil && denied == nil {
+					denied = &Decision{Deciders: Policies{p}, Err: err}
+				}
+				continue
+			}
+		}
+
+		if p.AllowAccess() {
+			allowed.Deciders = append(allowed.Deciders, p)
+		} else if denied == nil {
+			denied = &Decision{Deciders: Policies{p}, Err: errors.WithStack(ErrRequestForcefullyDenied)}
+		}
+	}
+
+	if len(allowed.Deciders) > 0 {
+		return allowed, nil
+	} else if denied != nil {
+		return denied, nil
+	}
+	return &Decision{Deciders: Policies{}}, nil
+}
+
+// OnlyOneApplicableStrategy lets the only applicable policy decide. If more than one policy applies, the decision
+// is indeterminate and access is denied with ErrMultipleApplicable. Policies with a custom effect are passed to
+// their handler in EffectHandlers, which denies access by returning an error. Policies with unknown effects deny
+// access.
+type OnlyOneApplicableStrategy struct{}
+
+// Decide returns the decision for r.
+func (s *OnlyOneApplicableStrategy) Decide(r *Request, candidates Policies) (*Decision, error) {
+	switch len(candidates) {
+	case 0:
+		return &Decision{Deciders: Policies{}}, nil
+	case 1:
+		return new(FirstApplicableStrategy).Decide(r, candidates)
+	}
+
+	deciders := make(Policies, len(candidates))
+	copy(deciders, candidates)
+	return &Decision{Deciders: deciders, Err: errors.WithStack(ErrMultipleApplicable)}, nil
+}
+
+// Names of the built-in strategies in Strategies.
+const (
+	StrategyDenyOverrides     = "deny-overrides"
+	StrategyPermitOverrides   = "permit-overrides"
+	StrategyFirstApplicable   = "first-applicable"
+	StrategyOnlyOneApplicable = "only-one-applicable"
+)
+
+// Strategies maps names to combining algorithms, so the strategy can be chosen by configuration. Custom strategies
+// can be registered as well.
+var Strategies = map[string]func() Strategy{
+	StrategyDenyOverrides:     func() Strategy { return new(DenyOverridesStrategy) },
+	StrategyPermitOverrides:   func() Strategy { return new(PermitOverridesStrategy) },
+	StrategyFirstApplicable:   func() Strategy { return new(FirstApplicableStrategy) },
+	StrategyOnlyOneApplicable: func() Strategy { return new(OnlyOneApplicableStrategy) },
+}
+
+// NewStrategy returns the strategy registered in Strategies under name.
+func NewStrategy(name string) (Strategy, error) {
+	factory, ok := Strategies[name]
+	if !ok {
+		return nil, errors.Errorf("Strategy %s is not registered", name)
+	}
+	return factory(), nil
+}
+
+// DefaultStrategy is used by Ladon if no Strategy is set.
+var DefaultStrategy Strategy = &DenyOverridesStrategy{}
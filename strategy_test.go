@@ -0,0 +1,145 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+// allowOverridesStrategy grants access if any applicable policy allows it.
+type allowOverridesStrategy struct {
+	candidates Policies
+}
+
+func (s *allowOverridesStrategy) Decide(r *Request, candidates Policies) (*Decision, error) {
+	s.candidates = candidates
+	for _, p := range candidates {
+		if p.AllowAccess() {
+			return &Decision{Allowed: true, Deciders: Policies{p}}, nil
+		}
+	}
+
+	if len(candidates) > 0 {
+		return &Decision{Deciders: Policies{candidates[0]}}, nil
+	}
+	return &Decision{}, nil
+}
+
+func TestLadonStrategy(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "allow", Subjects: []string{"peter"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: AllowAccess},
+		{ID: "deny", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: DenyAccess},
+		{ID: "other", Subjects: []string{"max"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: AllowAccess},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	r := &Request{Subject: "peter", Action: "get", Resource: "articles:1"}
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause((&Ladon{Manager: m}).IsAllowed(r)))
+
+	s := new(allowOverridesStrategy)
+	warden := &Ladon{Manager: m, Strategy: s}
+	require.NoError(t, warden.IsAllowed(r))
+
+	var ids []string
+	for _, p := range s.candidates {
+		ids = append(ids, p.GetID())
+	}
+	assert.ElementsMatch(t, []string{"allow", "deny"}, ids)
+
+	err := warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "articles:1"})
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(err))
+
+	err = warden.IsAllowed(&Request{Subject: "ken", Action: "delete", Resource: "articles:1"})
+	assert.Equal(t, ErrRequestDenied, errors.Cause(err))
+}
+
+func TestFirstApplicableStrategy(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "block-ken", Priority: 100, Subjects: []string{"ken"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: DenyAccess},
+		{ID: "allow-admin", Priority: 50, Subjects: []string{"<ken|peter>"}, Resources: []string{"admin:<.*>"}, Actions: []string{"<.*>"}, Effect: AllowAccess},
+		{ID: "deny-admin", Priority: 10, Subjects: []string{"<.*>"}, Resources: []string{"admin:<.*>"}, Actions: []string{"<.*>"}, Effect: DenyAccess},
+		{ID: "allow-all", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: AllowAccess},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	warden := &Ladon{Manager: m, Strategy: new(FirstApplicableStrategy)}
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "peter", Action: "delete", Resource: "admin:1"}))
+	assert.NoError(t, warden.IsAllowed(&Request{Subject: "max", Action: "get", Resource: "articles:1"}))
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "max", Action: "get", Resource: "admin:1"})))
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "admin:1"})))
+
+	// Under deny overrides, the priority is irrelevant.
+	warden.Strategy = nil
+	assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(warden.IsAllowed(&Request{Subject: "peter", Action: "delete", Resource: "admin:1"})))
+}
+
+func TestCombiningStrategies(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "allow-articles", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: AllowAccess},
+		{ID: "deny-peter", Subjects: []string{"peter"}, Resources: []string{"<.*>"}, Actions: []string{"get"}, Effect: DenyAccess},
+		{ID: "allow-admin", Subjects: []string{"<.*>"}, Resources: []string{"admin:<.*>"}, Actions: []string{"get"}, Effect: AllowAccess},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	for _, tc := range []struct {
+		strategy string
+		request  *Request
+		expected error
+	}{
+		{strategy: StrategyDenyOverrides, request: &Request{Subject: "peter", Action: "get", Resource: "articles:1"}, expected: ErrRequestForcefullyDenied},
+		{strategy: StrategyDenyOverrides, request: &Request{Subject: "max", Action: "get", Resource: "articles:1"}},
+		{strategy: StrategyPermitOverrides, request: &Request{Subject: "peter", Action: "get", Resource: "articles:1"}},
+		{strategy: StrategyPermitOverrides, request: &Request{Subject: "peter", Action: "get", Resource: "users:1"}, expected: ErrRequestForcefullyDenied},
+		{strategy: StrategyPermitOverrides, request: &Request{Subject: "max", Action: "delete", Resource: "articles:1"}, expected: ErrRequestDenied},
+		{strategy: StrategyOnlyOneApplicable, request: &Request{Subject: "peter", Action: "get", Resource: "articles:1"}, expected: ErrMultipleApplicable},
+		{strategy: StrategyOnlyOneApplicable, request: &Request{Subject: "peter", Action: "get", Resource: "users:1"}, expected: ErrRequestForcefullyDenied},
+		{strategy: StrategyOnlyOneApplicable, request: &Request{Subject: "max", Action: "get", Resource: "admin:1"}},
+		{strategy: StrategyOnlyOneApplicable, request: &Request{Subject: "max", Action: "get", Resource: "users:1"}, expected: ErrRequestDenied},
+	} {
+		t.Run(tc.strategy, func(t *testing.T) {
+			s, err := NewStrategy(tc.strategy)
+			require.NoError(t, err)
+
+			err = (&Ladon{Manager: m, Strategy: s}).IsAllowed(tc.request)
+			if tc.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tc.expected, errors.Cause(err))
+			}
+		})
+	}
+
+	_, err := NewStrategy("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+// TenantPolicy is implemented by policies which belong to a tenant. Policies only apply to requests of their own
+// tenant; policies without a tenant only apply to requests without a tenant.
+type TenantPolicy interface {
+	// GetTenant returns the tenant the policy belongs to.
+	GetTenant() string
+}
+
+// PolicyTenant returns the tenant of p, or an empty string if it does not implement TenantPolicy.
+func PolicyTenant(p Policy) string {
+	if tp, ok := p.(TenantPolicy); ok {
+		return tp.GetTenant()
+	}
+	return ""
+}
+
+// FilterTenant returns the policies which belong to tenant. Managers use it to scope request candidates.
+func FilterTenant(policies Policies, tenant string) Policies {
+	filtered := make(Policies, 0, len(policies))
+	for _, p := range policies {
+		if PolicyTenant(p) == tenant {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestTenant(t *testing.T) {
+	m := NewMemoryManager()
+	for _, p := range []*DefaultPolicy{
+		{ID: "acme", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"get"}, Effect: AllowAccess, Tenant: "acme"},
+		{ID: "globex", Subjects: []string{"<.*>"}, Resources: []string{"articles:<.*>"}, Actions: []string{"delete"}, Effect: AllowAccess, Tenant: "globex"},
+		{ID: "global", Subjects: []string{"root"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: AllowAccess},
+		{ID: "globex-deny", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: DenyAccess, Tenant: "globex"},
+	} {
+		require.NoError(t, m.Create(p))
+	}
+
+	candidates, err := m.FindRequestCandidates(&Request{Tenant: "acme"})
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, "acme", candidates[0].GetID())
+
+	w := &Ladon{Manager: m}
+	for k, c := range []struct {
+		r       *Request
+		allowed bool
+	}{
+		{r: &Request{Tenant: "acme", Subject: "peter", Action: "get", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Tenant: "acme", Subject: "peter", Action: "delete", Resource: "articles:1"}, allowed: false},
+		{r: &Request{Tenant: "globex", Subject: "peter", Action: "delete", Resource: "articles:1"}, allowed: false},
+		{r: &Request{Subject: "peter", Action: "get", Resource: "articles:1"}, allowed: false},
+		{r: &Request{Subject: "root", Action: "get", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Tenant: "acme", Subject: "root", Action: "get", Resource: "articles:1"}, allowed: true},
+		{r: &Request{Tenant: "acme", Subject: "root", Action: "delete", Resource: "articles:1"}, allowed: false},
+	} {
+		assert.Equal(t, c.allowed, w.IsAllowed(c.r) == nil, "case %d", k)
+	}
+
+	// Policies passed directly are scoped as well.
+	assert.Error(t, w.DoPoliciesAllow(&Request{Tenant: "acme", Subject: "peter", Action: "delete", Resource: "articles:1"}, Policies{m.Policies["globex"]}))
+
+	var p DefaultPolicy
+	require.NoError(t, json.Unmarshal([]byte(`{"id": "1", "tenant": "acme"}`), &p))
+	assert.Equal(t, "acme", p.GetTenant())
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// PolicyWriter reads and writes policies within a transaction.
+type PolicyWriter interface {
+	// Get retrieves a policy, including the writes of the transaction.
+	Get(id string) (Policy, error)
+
+	// Create persists the policy.
+	Create(policy Policy) error
+
+	// Update updates an existing policy.
+	Update(policy Policy) error
+
+	// Delete removes a policy.
+	Delete(id string) error
+}
+
+// TransactionalManager is implemented by managers which apply groups of writes atomically.
+type TransactionalManager interface {
+	// RunTransaction calls fn with a writer whose writes are applied atomically once fn returns nil, and discarded
+	// if fn returns an error. fn must use the writer only, not the manager itself.
+	RunTransaction(fn func(w PolicyWriter) error) error
+}
+
+// RunTransaction applies the writes fn makes to the writer atomically, for example to replace all policies of a
+// tenant. Managers which do not implement TransactionalManager apply the writes one by one; if a write or fn fails,
+// the writes applied before are reverted, but other clients may observe them in the meantime.
+func RunTransaction(m Manager, fn func(w PolicyWriter) error) error {
+	if tm, ok := m.(TransactionalManager); ok {
+		return tm.RunTransaction(fn)
+	}
+
+	w := &undoWriter{m: m}
+	if err := fn(w); err != nil {
+		if rerr := w.rollback(); rerr != nil {
+			return errors.Wrapf(err, "Could not revert the transaction: %s", rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// undoWriter writes to a manager directly and records how to revert every write.
+type undoWriter struct {
+	m    Manager
+	undo []func() error
+}
+
+func (w *undoWriter) Get(id string) (Policy, error) {
+	return w.m.Get(id)
+}
+
+func (w *undoWriter) Create(policy Policy) error {
+	if err := w.m.Create(policy); err != nil {
+		return err
+	}
+
+	id := policy.GetID()
+	w.undo = append(w.undo, func() error { return w.m.Delete(id) })
+	return nil
+}
+
+func (w *undoWriter) Update(policy Policy) error {
+	previous, err := w.snapshot(policy.GetID())
+	if err != nil {
+		return err
+	}
+
+	if err := w.m.Update(policy); err != nil {
+		return err
+	}
+
+	w.undo = append(w.undo, func() error { return w.m.Update(previous) })
+	return nil
+}
+
+func (w *undoWriter) Delete(id string) error {
+	previous, err := w.snapshot(id)
+	if errors.Cause(err) == ErrNotFound {
+		return w.m.Delete(id)
+	} else if err != nil {
+		return err
+	}
+
+	if err := w.m.Delete(id); err != nil {
+		return err
+	}
+
+	w.undo = append(w.undo, func() error { return w.m.Create(previous) })
+	return nil
+}
+
+// snapshot returns a copy of the stored policy, because managers may store policies by reference.
+func (w *undoWriter) snapshot(id string) (Policy, error) {
+	p, err := w.m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return copyPolicy(p)
+}
+
+// rollback reverts all writes, latest first.
+func (w *undoWriter) rollback() error {
+	for k := len(w.undo) - 1; k >= 0; k-- {
+		if err := w.undo[k](); err != nil {
+			return err
+		}
+	}
+	return nil
+}
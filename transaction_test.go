@@ -0,0 +1,69 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+func TestRunTransaction(t *testing.T) {
+	// EventingManager does not implement TransactionalManager, so the writes are reverted on failure.
+	m := NewEventingManager(NewMemoryManager(), new(recordingBus))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "1", Subjects: []string{"peter"}, Effect: AllowAccess}))
+	require.NoError(t, m.Create(&DefaultPolicy{ID: "2", Subjects: []string{"ken"}, Effect: AllowAccess}))
+
+	err := RunTransaction(m, func(w PolicyWriter) error {
+		if err := w.Delete("1"); err != nil {
+			return err
+		} else if err := w.Update(&DefaultPolicy{ID: "2", Subjects: []string{"max"}, Effect: AllowAccess}); err != nil {
+			return err
+		} else if err := w.Create(&DefaultPolicy{ID: "3", Effect: AllowAccess}); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+
+	ps, err := m.GetAll(10, 0)
+	require.NoError(t, err)
+	require.Len(t, ps, 2)
+	assert.Equal(t, []string{"peter"}, ps[0].GetSubjects())
+	assert.Equal(t, []string{"ken"}, ps[1].GetSubjects())
+
+	require.NoError(t, RunTransaction(m, func(w PolicyWriter) error {
+		return w.Delete("1")
+	}))
+	_, err = m.Get("1")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+	mm := NewMemoryManager()
+	require.NoError(t, RunTransaction(mm, func(w PolicyWriter) error {
+		return w.Create(&DefaultPolicy{ID: "1", Effect: AllowAccess})
+	}))
+	assert.Len(t, mm.Policies, 1)
+}
@@ -20,6 +20,10 @@
 
 package ladon
 
+import (
+	"time"
+)
+
 // Request is the warden's request object.
 type Request struct {
 	// Resource is the resource that access is requested to.
@@ -33,6 +37,12 @@ type Request struct {
 
 	// Context is the request's environmental context.
 	Context Context `json:"context"`
+
+	// Tenant is the tenant the request is made in. Only policies of the same tenant apply to it.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Time is the time the request is made at. If it is not set, Ladon sets it using its Clock.
+	Time time.Time `json:"time,omitzero"`
 }
 
 // Warden is responsible for deciding if subject s can perform action a on resource r with context c.
@@ -0,0 +1,212 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CachedWarden wraps a Warden and caches its decisions for repeated, identical access requests. Requests are
+// identical if their subject, action, resource, context and tenant are.
+//
+// Only grants and denials are cached, errors of the Manager or of conditions never are. Decisions are kept for
+// TTL, so conditions depending on the time of the request, such as DateCondition, may see stale results for
+// that long. Writes through the manager returned by InvalidatingManager drop all cached decisions, other
+// writes, for example by other nodes, can be propagated by calling Invalidate.
+type CachedWarden struct {
+	Warden Warden
+
+	// TTL is the time a decision is cached for.
+	TTL time.Duration
+
+	// MaxEntries limits the number of cached decisions. The least recently used decision is evicted first.
+	// Zero means no limit.
+	MaxEntries int
+
+	// Clock is used to expire decisions. It defaults to SystemClock.
+	Clock Clock
+
+	entries    map[string]*list.Element
+	lru        *list.List
+	generation uint64
+	sync.Mutex
+}
+
+type cachedDecision struct {
+	key     string
+	err     error
+	expires time.Time
+}
+
+// NewCachedWarden returns a CachedWarden wrapping w.
+func NewCachedWarden(w Warden, ttl time.Duration, maxEntries int) *CachedWarden {
+	return &CachedWarden{
+		Warden:     w,
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+	}
+}
+
+// IsAllowed returns nil if subject s can perform action a on resource r with context c or an error otherwise.
+// If the decision for an identical request is cached and has not expired, it is returned without evaluating the
+// request.
+func (w *CachedWarden) IsAllowed(r *Request) error {
+	key, err := requestKey(r)
+	if err != nil {
+		// The context can not be hashed, so we can not tell whether requests are identical.
+		return w.Warden.IsAllowed(r)
+	}
+
+	w.Lock()
+	w.init()
+	if e, ok := w.entries[key]; ok {
+		d := e.Value.(*cachedDecision)
+		if w.clock().Now().Before(d.expires) {
+			w.lru.MoveToFront(e)
+			w.Unlock()
+			return d.err
+		}
+		w.remove(e)
+	}
+	generation := w.generation
+	w.Unlock()
+
+	err = w.Warden.IsAllowed(r)
+	if !isDecision(err) {
+		return err
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	// The policies changed while the request was evaluated, so the decision may be outdated already.
+	if generation != w.generation {
+		return err
+	}
+
+	if e, ok := w.entries[key]; ok {
+		w.remove(e)
+	}
+	w.entries[key] = w.lru.PushFront(&cachedDecision{key: key, err: err, expires: w.clock().Now().Add(w.TTL)})
+	if w.MaxEntries > 0 && w.lru.Len() > w.MaxEntries {
+		w.remove(w.lru.Back())
+	}
+	return err
+}
+
+// Len returns the number of cached decisions, including expired ones which were not evicted yet.
+func (w *CachedWarden) Len() int {
+	w.Lock()
+	defer w.Unlock()
+	w.init()
+	return w.lru.Len()
+}
+
+// Invalidate drops all cached decisions. Decisions of requests which are being evaluated are not cached.
+func (w *CachedWarden) Invalidate() {
+	w.Lock()
+	defer w.Unlock()
+	w.generation++
+	w.entries = map[string]*list.Element{}
+	w.lru = list.New()
+}
+
+// InvalidatingManager returns a Manager wrapping m which calls Invalidate after every successful write.
+func (w *CachedWarden) InvalidatingManager(m Manager) Manager {
+	return &invalidatingManager{Manager: m, invalidate: w.Invalidate}
+}
+
+func (w *CachedWarden) clock() Clock {
+	if w.Clock == nil {
+		return SystemClock
+	}
+	return w.Clock
+}
+
+// init initializes the cache. The lock must be held.
+func (w *CachedWarden) init() {
+	if w.entries == nil {
+		w.entries = map[string]*list.Element{}
+		w.lru = list.New()
+	}
+}
+
+// remove evicts a cached decision. The lock must be held.
+func (w *CachedWarden) remove(e *list.Element) {
+	delete(w.entries, e.Value.(*cachedDecision).key)
+	w.lru.Remove(e)
+}
+
+// isDecision returns true if err is nil or denies the request.
+func isDecision(err error) bool {
+	switch errors.Cause(err) {
+	case nil, ErrRequestDenied, ErrRequestForcefullyDenied, ErrMultipleApplicable:
+		return true
+	}
+	return false
+}
+
+type invalidatingManager struct {
+	Manager
+	invalidate func()
+}
+
+// Create persists the policy.
+func (m *invalidatingManager) Create(policy Policy) error {
+	if err := m.Manager.Create(policy); err != nil {
+		return err
+	}
+	m.invalidate()
+	return nil
+}
+
+// Update updates an existing policy.
+func (m *invalidatingManager) Update(policy Policy) error {
+	if err := m.Manager.Update(policy); err != nil {
+		return err
+	}
+	m.invalidate()
+	return nil
+}
+
+// Delete removes a policy.
+func (m *invalidatingManager) Delete(id string) error {
+	if err := m.Manager.Delete(id); err != nil {
+		return err
+	}
+	m.invalidate()
+	return nil
+}
+
+// Close closes the wrapped manager.
+func (m *invalidatingManager) Close(ctx context.Context) error {
+	return Close(ctx, m.Manager)
+}
+
+// IndexesLiterals returns true if the wrapped manager looks candidates up verbatim.
+func (m *invalidatingManager) IndexesLiterals() bool {
+	return IndexesLiterals(m.Manager)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingWarden struct {
+	calls int
+	err   error
+}
+
+func (w *countingWarden) IsAllowed(r *Request) error {
+	w.calls++
+	if w.err != nil {
+		return w.err
+	}
+	if r.Subject == "peter" {
+		return nil
+	}
+	return errors.WithStack(ErrRequestForcefullyDenied)
+}
+
+func TestCachedWarden(t *testing.T) {
+	inner := new(countingWarden)
+	w := NewCachedWarden(inner, time.Hour, 2)
+
+	peter := &Request{Subject: "peter", Action: "get", Resource: "article", Context: Context{"a": "b", "c": "d"}}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, w.IsAllowed(peter))
+		assert.NoError(t, w.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "article", Context: Context{"c": "d", "a": "b"}}))
+		assert.Equal(t, ErrRequestForcefullyDenied, errors.Cause(w.IsAllowed(&Request{Subject: "ken", Action: "get", Resource: "article"})))
+	}
+	assert.Equal(t, 2, inner.calls)
+
+	// A third request evicts the least recently used decision, which is peter's.
+	require.NoError(t, w.IsAllowed(&Request{Subject: "peter", Action: "delete", Resource: "article"}))
+	assert.Equal(t, 2, w.Len())
+	require.NoError(t, w.IsAllowed(peter))
+	assert.Equal(t, 4, inner.calls)
+
+	// Other errors are never cached.
+	inner.err = errors.New("connection refused")
+	other := &Request{Subject: "max", Action: "get", Resource: "article"}
+	assert.Error(t, w.IsAllowed(other))
+	assert.Error(t, w.IsAllowed(other))
+	assert.Equal(t, 6, inner.calls)
+	inner.err = nil
+
+	// Expired decisions are evaluated again.
+	now := time.Now()
+	w.Clock = ClockFunc(func() time.Time { return now })
+	w.Invalidate()
+	require.NoError(t, w.IsAllowed(peter))
+	now = now.Add(time.Minute * 59)
+	require.NoError(t, w.IsAllowed(peter))
+	assert.Equal(t, 7, inner.calls)
+	now = now.Add(time.Minute)
+	require.NoError(t, w.IsAllowed(peter))
+	assert.Equal(t, 8, inner.calls)
+}
+
+func TestCachedWardenInvalidation(t *testing.T) {
+	inner := new(countingWarden)
+	w := NewCachedWarden(inner, time.Hour, 0)
+	m := w.InvalidatingManager(&countingManager{})
+
+	r := &Request{Subject: "peter", Action: "get", Resource: "article"}
+	require.NoError(t, w.IsAllowed(r))
+	require.NoError(t, w.IsAllowed(r))
+	assert.Equal(t, 1, inner.calls)
+
+	for _, write := range []func() error{
+		func() error { return m.Create(&DefaultPolicy{ID: "1"}) },
+		func() error { return m.Update(&DefaultPolicy{ID: "1"}) },
+		func() error { return m.Delete("1") },
+	} {
+		require.NoError(t, write())
+		assert.Equal(t, 0, w.Len())
+		require.NoError(t, w.IsAllowed(r))
+	}
+	assert.Equal(t, 4, inner.calls)
+
+	// Decisions of requests evaluated during an invalidation are not cached.
+	inner.err = nil
+	racing := &racingWarden{cache: w}
+	w.Warden = racing
+	require.NoError(t, w.IsAllowed(&Request{Subject: "ken"}))
+	assert.Equal(t, 0, w.Len())
+}
+
+type racingWarden struct {
+	cache *CachedWarden
+}
+
+func (w *racingWarden) IsAllowed(r *Request) error {
+	w.cache.Invalidate()
+	return nil
+}
+
+// countingManager accepts all writes.
+type countingManager struct {
+	Manager
+}
+
+func (m *countingManager) Create(policy Policy) error { return nil }
+func (m *countingManager) Update(policy Policy) error { return nil }
+func (m *countingManager) Delete(id string) error     { return nil }
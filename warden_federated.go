@@ -0,0 +1,101 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"github.com/pkg/errors"
+)
+
+// FederationStrategy defines how a FederatedWarden combines the verdicts of its wardens. A warden allows a
+// request if it returns nil, is not applicable if it returns ErrRequestDenied (no policy matched) and denies
+// the request with any other error.
+type FederationStrategy int
+
+const (
+	// FederationDenyOverrides denies the request if any warden denies it and allows it if at least one allows.
+	FederationDenyOverrides FederationStrategy = iota
+
+	// FederationAllowOverrides allows the request if any warden allows it, otherwise the first denial is returned.
+	FederationAllowOverrides
+
+	// FederationFirstApplicable returns the verdict of the first warden which is applicable.
+	FederationFirstApplicable
+
+	// FederationUnanimous allows the request only if every warden allows it.
+	FederationUnanimous
+)
+
+// FederatedWarden consults multiple wardens, for example one backed by an organization-wide policy store and one
+// backed by a team's own store, and combines their verdicts according to Strategy. Wrap a Manager in a Ladon to
+// use it as a warden.
+type FederatedWarden struct {
+	Wardens  []Warden
+	Strategy FederationStrategy
+}
+
+// NewFederatedWarden returns a FederatedWarden combining wardens using strategy.
+func NewFederatedWarden(strategy FederationStrategy, wardens ...Warden) *FederatedWarden {
+	return &FederatedWarden{Wardens: wardens, Strategy: strategy}
+}
+
+// IsAllowed returns nil if the wardens' combined verdict allows the request or an error otherwise.
+func (f *FederatedWarden) IsAllowed(r *Request) error {
+	var allowed bool
+	var denied error
+
+	for _, w := range f.Wardens {
+		err := w.IsAllowed(r)
+		applicable := errors.Cause(err) != ErrRequestDenied
+
+		switch f.Strategy {
+		case FederationDenyOverrides:
+			if err == nil {
+				allowed = true
+			} else if applicable {
+				return err
+			}
+		case FederationAllowOverrides:
+			if err == nil {
+				return nil
+			} else if applicable && denied == nil {
+				denied = err
+			}
+		case FederationFirstApplicable:
+			if applicable {
+				return err
+			}
+		case FederationUnanimous:
+			if err != nil {
+				return err
+			}
+			allowed = true
+		default:
+			return errors.Errorf("Unknown federation strategy %d", f.Strategy)
+		}
+	}
+
+	if denied != nil {
+		return denied
+	} else if !allowed {
+		return errors.WithStack(ErrRequestDenied)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/ory/ladon"
+)
+
+type staticWarden struct {
+	err   error
+	calls int
+}
+
+func (w *staticWarden) IsAllowed(r *Request) error {
+	w.calls++
+	return w.err
+}
+
+func TestFederatedWarden(t *testing.T) {
+	allow := func() *staticWarden { return &staticWarden{} }
+	deny := func() *staticWarden { return &staticWarden{err: errors.WithStack(ErrRequestForcefullyDenied)} }
+	none := func() *staticWarden { return &staticWarden{err: errors.WithStack(ErrRequestDenied)} }
+
+	for k, c := range []struct {
+		strategy FederationStrategy
+		wardens  []*staticWarden
+		expected error
+	}{
+		{strategy: FederationDenyOverrides, wardens: []*staticWarden{allow(), none()}, expected: nil},
+		{strategy: FederationDenyOverrides, wardens: []*staticWarden{allow(), deny()}, expected: ErrRequestForcefullyDenied},
+		{strategy: FederationDenyOverrides, wardens: []*staticWarden{none(), none()}, expected: ErrRequestDenied},
+		{strategy: FederationAllowOverrides, wardens: []*staticWarden{deny(), allow()}, expected: nil},
+		{strategy: FederationAllowOverrides, wardens: []*staticWarden{none(), deny()}, expected: ErrRequestForcefullyDenied},
+		{strategy: FederationAllowOverrides, wardens: []*staticWarden{none()}, expected: ErrRequestDenied},
+		{strategy: FederationFirstApplicable, wardens: []*staticWarden{none(), allow(), deny()}, expected: nil},
+		{strategy: FederationFirstApplicable, wardens: []*staticWarden{none(), deny(), allow()}, expected: ErrRequestForcefullyDenied},
+		{strategy: FederationUnanimous, wardens: []*staticWarden{allow(), allow()}, expected: nil},
+		{strategy: FederationUnanimous, wardens: []*staticWarden{allow(), none()}, expected: ErrRequestDenied},
+		{strategy: FederationUnanimous, wardens: []*staticWarden{}, expected: ErrRequestDenied},
+	} {
+		var wardens []Warden
+		for _, w := range c.wardens {
+			wardens = append(wardens, w)
+		}
+
+		err := NewFederatedWarden(c.strategy, wardens...).IsAllowed(new(Request))
+		assert.Equal(t, c.expected, errors.Cause(err), "%d", k)
+	}
+
+	// The deny overrides strategy stops at the first denial.
+	last := allow()
+	assert.Error(t, NewFederatedWarden(FederationDenyOverrides, deny(), last).IsAllowed(new(Request)))
+	assert.Equal(t, 0, last.calls)
+
+	assert.Error(t, NewFederatedWarden(FederationStrategy(42), allow()).IsAllowed(new(Request)))
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// SingleflightWarden wraps a Warden and makes concurrent, identical access requests share one evaluation
+// (and thus one Manager query). Requests are identical if their subject, action, resource and context are.
+type SingleflightWarden struct {
+	Warden Warden
+
+	calls map[string]*singleflightCall
+	sync.Mutex
+}
+
+type singleflightCall struct {
+	wg  sync.WaitGroup
+	err error
+
+	// panic is the value the wrapped warden panicked with, if it did.
+	panic interface{}
+}
+
+// NewSingleflightWarden returns a SingleflightWarden wrapping w.
+func NewSingleflightWarden(w Warden) *SingleflightWarden {
+	return &SingleflightWarden{
+		Warden: w,
+		calls:  map[string]*singleflightCall{},
+	}
+}
+
+// IsAllowed returns nil if subject s can perform action a on resource r with context c or an error otherwise.
+// If an identical request is already being evaluated, it waits for and returns that result instead. If the wrapped
+// warden panics, all callers waiting for the result panic with the same value.
+func (w *SingleflightWarden) IsAllowed(r *Request) error {
+	key, err := requestKey(r)
+	if err != nil {
+		// The context can not be hashed, so we can not tell whether requests are identical.
+		return w.Warden.IsAllowed(r)
+	}
+
+	w.Lock()
+	if w.calls == nil {
+		w.calls = map[string]*singleflightCall{}
+	}
+
+	c, ok := w.calls[key]
+	if ok {
+		w.Unlock()
+		c.wg.Wait()
+	} else {
+		c = new(singleflightCall)
+		c.wg.Add(1)
+		w.calls[key] = c
+		w.Unlock()
+
+		w.call(key, c, r)
+	}
+
+	if c.panic != nil {
+		panic(c.panic)
+	}
+	return c.err
+}
+
+// call evaluates r and releases the callers waiting for c, even if the wrapped warden panics.
+func (w *SingleflightWarden) call(key string, c *singleflightCall, r *Request) {
+	defer func() {
+		c.panic = recover()
+
+		w.Lock()
+		delete(w.calls, key)
+		w.Unlock()
+		c.wg.Done()
+	}()
+
+	c.err = w.Warden.IsAllowed(r)
+}
+
+// requestKey returns a hash identifying the subject, action, resource and context of a request.
+func requestKey(r *Request) (string, error) {
+	// encoding/json sorts map keys, so equal contexts always result in the same output.
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type blockingWarden struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (w *blockingWarden) IsAllowed(r *Request) error {
+	atomic.AddInt32(&w.calls, 1)
+	<-w.release
+	if r.Subject == "peter" {
+		return nil
+	}
+	return ErrRequestDenied
+}
+
+func TestSingleflightWarden(t *testing.T) {
+	inner := &blockingWarden{release: make(chan struct{})}
+	w := NewSingleflightWarden(inner)
+
+	requests := []*Request{
+		{Subject: "peter", Action: "get", Resource: "article", Context: Context{"a": "b", "c": "d"}},
+		{Subject: "peter", Action: "get", Resource: "article", Context: Context{"c": "d", "a": "b"}},
+		{Subject: "ken", Action: "get", Resource: "article"},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 30)
+	started := make(chan struct{}, len(errs))
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			started <- struct{}{}
+			errs[i] = w.IsAllowed(requests[i%len(requests)])
+		}(i)
+	}
+
+	for range errs {
+		<-started
+	}
+
+	// Wait until all goroutines joined a flight before releasing the inner warden.
+	for {
+		w.Lock()
+		joined := len(w.calls)
+		w.Unlock()
+		if joined == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(inner.release)
+	wg.Wait()
+
+	assert.True(t, atomic.LoadInt32(&inner.calls) >= 2)
+	assert.True(t, atomic.LoadInt32(&inner.calls) < int32(len(errs)))
+	for i, err := range errs {
+		if requests[i%len(requests)].Subject == "peter" {
+			assert.NoError(t, err)
+		} else {
+			assert.Equal(t, ErrRequestDenied, err)
+		}
+	}
+
+	assert.Empty(t, w.calls)
+}
+
+type panickingWarden struct {
+	release chan struct{}
+}
+
+func (w *panickingWarden) IsAllowed(r *Request) error {
+	<-w.release
+	panic("condition failed")
+}
+
+func TestSingleflightWardenPanic(t *testing.T) {
+	inner := &panickingWarden{release: make(chan struct{})}
+	w := NewSingleflightWarden(inner)
+
+	panics := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() { panics <- recover() }()
+			_ = w.IsAllowed(&Request{Subject: "peter"})
+		}()
+	}
+
+	// Wait until the second caller waits for the first one.
+	for {
+		w.Lock()
+		joined := len(w.calls)
+		w.Unlock()
+		if joined == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(inner.release)
+
+	assert.Equal(t, "condition failed", <-panics)
+	assert.Equal(t, "condition failed", <-panics)
+	assert.Empty(t, w.calls)
+}
+
+func TestRequestKey(t *testing.T) {
+	a, err := requestKey(&Request{Subject: "peter", Context: Context{"a": 1, "b": "2"}})
+	assert.NoError(t, err)
+	b, err := requestKey(&Request{Subject: "peter", Context: Context{"b": "2", "a": 1}})
+	assert.NoError(t, err)
+	c, err := requestKey(&Request{Subject: "peter", Context: Context{"b": "2", "a": 2}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+
+	_, err = requestKey(&Request{Context: Context{"fn": func() {}}})
+	assert.Error(t, err)
+}
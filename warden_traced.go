@@ -0,0 +1,74 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon
+
+import (
+	"context"
+)
+
+// TracedWarden wraps Ladon and records a span for every access request, the manager query, the policy
+// evaluation and each evaluated condition.
+type TracedWarden struct {
+	Ladon  *Ladon
+	Tracer Tracer
+}
+
+// NewTracedWarden returns a TracedWarden wrapping l.
+func NewTracedWarden(l *Ladon, t Tracer) *TracedWarden {
+	return &TracedWarden{Ladon: l, Tracer: t}
+}
+
+// IsAllowed returns nil if subject s has permission p on resource r with context c or an error otherwise.
+func (w *TracedWarden) IsAllowed(r *Request) error {
+	return w.IsAllowedContext(context.Background(), r)
+}
+
+// IsAllowedContext is like IsAllowed but starts the spans as children of the span in ctx.
+func (w *TracedWarden) IsAllowedContext(ctx context.Context, r *Request) (err error) {
+	ctx, span := w.Tracer.Start(ctx, "ladon.IsAllowed")
+	span.SetAttribute("ladon.subject", r.Subject)
+	span.SetAttribute("ladon.action", r.Action)
+	span.SetAttribute("ladon.resource", r.Resource)
+	defer func() { endSpan(span, err) }()
+
+	l := w.ladon(ctx)
+	l.Manager = &TracedManager{Manager: w.Ladon.Manager, Tracer: w.Tracer, Context: ctx}
+	return l.IsAllowed(r)
+}
+
+// DoPoliciesAllow returns nil if subject s has permission p on resource r with context c for a given policy
+// list or an error otherwise.
+func (w *TracedWarden) DoPoliciesAllow(r *Request, policies []Policy) error {
+	return w.DoPoliciesAllowContext(context.Background(), r, policies)
+}
+
+// DoPoliciesAllowContext is like DoPoliciesAllow but starts the spans as children of the span in ctx.
+func (w *TracedWarden) DoPoliciesAllowContext(ctx context.Context, r *Request, policies []Policy) error {
+	return w.ladon(ctx).DoPoliciesAllow(r, policies)
+}
+
+// ladon returns a copy of the wrapped Ladon which traces policy and condition evaluation.
+func (w *TracedWarden) ladon(ctx context.Context) *Ladon {
+	l := *w.Ladon
+	l.tracer = w.Tracer
+	l.traceContext = ctx
+	return &l
+}
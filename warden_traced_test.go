@@ -0,0 +1,112 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package ladon_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/ladon"
+	. "github.com/ory/ladon/manager/memory"
+)
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *recordedSpan) RecordError(err error)                      { s.err = err }
+func (s *recordedSpan) End()                                       { s.ended = true }
+
+type recordingTracer struct {
+	spans []*recordedSpan
+	sync.Mutex
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.Lock()
+	defer t.Unlock()
+
+	s := &recordedSpan{name: name, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		s.parent = parent.name
+	}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) find(name string) *recordedSpan {
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTracedWarden(t *testing.T) {
+	tracer := new(recordingTracer)
+	m := NewMemoryManager()
+	require.NoError(t, m.Create(&DefaultPolicy{
+		ID:         "1",
+		Subjects:   []string{"peter"},
+		Resources:  []string{"articles:1"},
+		Actions:    []string{"get"},
+		Effect:     AllowAccess,
+		Conditions: Conditions{"owner": &EqualsSubjectCondition{}},
+	}))
+
+	w := NewTracedWarden(&Ladon{Manager: m}, tracer)
+	require.NoError(t, w.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: Context{"owner": "peter"}}))
+
+	for name, parent := range map[string]string{
+		"ladon.IsAllowed":                        "",
+		"ladon.Manager.FindRequestCandidates":    "ladon.IsAllowed",
+		"ladon.DoPoliciesAllow":                  "ladon.IsAllowed",
+		"ladon.Condition.EqualsSubjectCondition": "ladon.DoPoliciesAllow",
+	} {
+		s := tracer.find(name)
+		require.NotNil(t, s, name)
+		assert.Equal(t, parent, s.parent, name)
+		assert.True(t, s.ended, name)
+		assert.NoError(t, s.err, name)
+	}
+
+	assert.Equal(t, "peter", tracer.find("ladon.IsAllowed").attrs["ladon.subject"])
+	assert.Equal(t, 1, tracer.find("ladon.Manager.FindRequestCandidates").attrs["ladon.policies"])
+	assert.Equal(t, true, tracer.find("ladon.Condition.EqualsSubjectCondition").attrs["ladon.condition.passed"])
+
+	tracer.spans = nil
+	require.Error(t, w.IsAllowed(&Request{Subject: "peter", Action: "get", Resource: "articles:1", Context: Context{"owner": "max"}}))
+	assert.Error(t, tracer.find("ladon.IsAllowed").err)
+	assert.Error(t, tracer.find("ladon.DoPoliciesAllow").err)
+	assert.Equal(t, false, tracer.find("ladon.Condition.EqualsSubjectCondition").attrs["ladon.condition.passed"])
+}
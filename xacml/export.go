@@ -0,0 +1,207 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package xacml
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/compiler"
+)
+
+// Export converts ladon policies to a XACML 3.0 <PolicySet> combining one <Policy> per ladon policy with the
+// deny-overrides algorithm. Policies which can not be represented are skipped and reported as issues.
+func Export(policies ladon.Policies) ([]byte, []Issue, error) {
+	set := PolicySet{
+		Namespace:                Namespace,
+		PolicySetID:              "ladon",
+		Version:                  "1.0",
+		PolicyCombiningAlgorithm: AlgorithmPolicyDenyOverrides,
+	}
+
+	var issues []Issue
+	for _, p := range policies {
+		policy, err := exportPolicy(p)
+		if err != nil {
+			issues = append(issues, Issue{PolicyID: p.GetID(), Message: err.Error()})
+			continue
+		}
+		set.Policies = append(set.Policies, *policy)
+	}
+
+	out, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	return append([]byte(xml.Header), out...), issues, nil
+}
+
+func exportPolicy(p ladon.Policy) (*Policy, error) {
+	rule := Rule{RuleID: p.GetID()}
+	switch p.GetEffect() {
+	case ladon.AllowAccess:
+		rule.Effect = "Permit"
+	case ladon.DenyAccess:
+		rule.Effect = "Deny"
+	default:
+		return nil, errors.Errorf("unknown effect %s", p.GetEffect())
+	}
+
+	if ladon.HasExclusions(p) {
+		return nil, errors.New("exclusions can not be represented")
+	}
+
+	for _, field := range []struct {
+		category string
+		patterns []string
+	}{
+		{category: CategorySubject, patterns: p.GetSubjects()},
+		{category: CategoryResource, patterns: p.GetResources()},
+		{category: CategoryAction, patterns: p.GetActions()},
+	} {
+		anyOf, err := exportPatterns(p, field.category, field.patterns)
+		if err != nil {
+			return nil, err
+		} else if anyOf != nil {
+			rule.Target.AnyOf = append(rule.Target.AnyOf, *anyOf)
+		}
+	}
+
+	apply, err := exportConditions(p.GetConditions())
+	if err != nil {
+		return nil, err
+	} else if apply != nil {
+		rule.Condition = &Condition{Apply: apply}
+	}
+
+	return &Policy{
+		PolicyID:               p.GetID(),
+		Version:                "1.0",
+		RuleCombiningAlgorithm: AlgorithmDenyOverrides,
+		Description:            p.GetDescription(),
+		Rules:                  []Rule{rule},
+	}, nil
+}
+
+func exportPatterns(p ladon.Policy, category string, patterns []string) (*AnyOf, error) {
+	if len(patterns) == 0 {
+		return nil, errors.Errorf("the policy can never match because it has no patterns in category %s", category)
+	}
+
+	anyOf := new(AnyOf)
+	for _, pattern := range patterns {
+		if pattern == "<.*>" {
+			// Matches everything, which is what an absent target does in XACML.
+			return nil, nil
+		}
+
+		match := Match{
+			MatchID:             FunctionStringEqual,
+			AttributeValue:      AttributeValue{DataType: DataTypeString, Value: pattern},
+			AttributeDesignator: designator(category, categoryAttributes[category]),
+		}
+
+		if strings.IndexByte(pattern, p.GetStartDelimiter()) >= 0 {
+			reg, err := compiler.CompileRegex(pattern, p.GetStartDelimiter(), p.GetEndDelimiter())
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			match.MatchID = FunctionStringRegexpMatch
+			match.AttributeValue.Value = reg.String()
+		}
+
+		anyOf.AllOf = append(anyOf.AllOf, AllOf{Match: []Match{match}})
+	}
+
+	return anyOf, nil
+}
+
+func exportConditions(conditions ladon.Conditions) (*Apply, error) {
+	keys := make([]string, 0, len(conditions))
+	for key := range conditions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var applies []Apply
+	for _, key := range keys {
+		attribute := oneAndOnly(designator(CategoryEnvironment, key))
+		switch c := conditions[key].(type) {
+		case *ladon.StringEqualCondition:
+			applies = append(applies, Apply{
+				FunctionID:      FunctionStringEqual,
+				Apply:           []Apply{attribute},
+				AttributeValues: []AttributeValue{{DataType: DataTypeString, Value: c.Equals}},
+			})
+		case *ladon.StringMatchCondition:
+			applies = append(applies, Apply{
+				FunctionID:      FunctionStringRegexpMatch,
+				Apply:           []Apply{attribute},
+				AttributeValues: []AttributeValue{{DataType: DataTypeString, Value: c.Matches}},
+			})
+		case *ladon.BooleanCondition:
+			attribute.FunctionID = "urn:oasis:names:tc:xacml:1.0:function:boolean-one-and-only"
+			attribute.AttributeDesignators[0].DataType = DataTypeBoolean
+
+			value := "false"
+			if c.BooleanValue {
+				value = "true"
+			}
+			applies = append(applies, Apply{
+				FunctionID:      FunctionBooleanEqual,
+				Apply:           []Apply{attribute},
+				AttributeValues: []AttributeValue{{DataType: DataTypeBoolean, Value: value}},
+			})
+		case *ladon.EqualsSubjectCondition:
+			applies = append(applies, Apply{
+				FunctionID: FunctionStringEqual,
+				Apply:      []Apply{attribute, oneAndOnly(designator(CategorySubject, AttributeSubjectID))},
+			})
+		default:
+			return nil, errors.Errorf("condition %s of type %s can not be represented", key, conditions[key].GetName())
+		}
+	}
+
+	switch len(applies) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &applies[0], nil
+	}
+	return &Apply{FunctionID: FunctionAnd, Apply: applies}, nil
+}
+
+func designator(category, id string) AttributeDesignator {
+	return AttributeDesignator{Category: category, AttributeID: id, DataType: DataTypeString}
+}
+
+func oneAndOnly(d AttributeDesignator) Apply {
+	return Apply{
+		FunctionID:           "urn:oasis:names:tc:xacml:1.0:function:string-one-and-only",
+		AttributeDesignators: []AttributeDesignator{d},
+	}
+}
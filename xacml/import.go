@@ -0,0 +1,284 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package xacml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/ladon"
+)
+
+var categoryAttributes = map[string]string{
+	CategorySubject:  AttributeSubjectID,
+	CategoryResource: AttributeResourceID,
+	CategoryAction:   AttributeActionID,
+}
+
+// Import converts a XACML 3.0 document, either a <Policy> or a <PolicySet>, to ladon policies. Each rule
+// results in one policy with the id "<PolicyId>:<RuleId>". Rules which can not be represented are skipped and
+// reported as issues.
+func Import(document []byte) (ladon.Policies, []Issue, error) {
+	root, err := rootElement(document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var im importer
+	switch root {
+	case "PolicySet":
+		var set PolicySet
+		if err := xml.Unmarshal(document, &set); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		im.policySet(set, nil)
+	case "Policy":
+		var policy Policy
+		if err := xml.Unmarshal(document, &policy); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		im.policy(policy, nil)
+	default:
+		return nil, nil, errors.Errorf("Expected a Policy or PolicySet element but got %s", root)
+	}
+
+	return im.policies, im.issues, nil
+}
+
+func rootElement(document []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+type importer struct {
+	policies ladon.Policies
+	issues   []Issue
+}
+
+func (im *importer) report(policyID, ruleID, format string, args ...interface{}) {
+	im.issues = append(im.issues, Issue{
+		PolicyID: policyID,
+		RuleID:   ruleID,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (im *importer) policySet(set PolicySet, targets []AnyOf) {
+	if set.PolicyCombiningAlgorithm != AlgorithmPolicyDenyOverrides {
+		im.report(set.PolicySetID, "", "policy combining algorithm %s is evaluated as deny-overrides", set.PolicyCombiningAlgorithm)
+	}
+
+	targets = append(append([]AnyOf{}, targets...), set.Target.AnyOf...)
+	for _, child := range set.PolicySets {
+		im.policySet(child, targets)
+	}
+	for _, policy := range set.Policies {
+		im.policy(policy, targets)
+	}
+}
+
+func (im *importer) policy(policy Policy, targets []AnyOf) {
+	if policy.RuleCombiningAlgorithm != AlgorithmDenyOverrides {
+		im.report(policy.PolicyID, "", "rule combining algorithm %s is evaluated as deny-overrides", policy.RuleCombiningAlgorithm)
+	}
+
+	if policy.Obligations != nil || policy.Advice != nil {
+		im.report(policy.PolicyID, "", "obligations and advice can not be represented and were skipped")
+	}
+
+	targets = append(append([]AnyOf{}, targets...), policy.Target.AnyOf...)
+	for _, rule := range policy.Rules {
+		p, err := convertRule(policy, rule, targets)
+		if err != nil {
+			im.report(policy.PolicyID, rule.RuleID, "%s", err)
+			continue
+		}
+		im.policies = append(im.policies, p)
+	}
+}
+
+func convertRule(policy Policy, rule Rule, targets []AnyOf) (*ladon.DefaultPolicy, error) {
+	p := &ladon.DefaultPolicy{
+		ID:          policy.PolicyID + ":" + rule.RuleID,
+		Description: strings.TrimSpace(rule.Description),
+		Conditions:  ladon.Conditions{},
+	}
+
+	if p.Description == "" {
+		p.Description = strings.TrimSpace(policy.Description)
+	}
+
+	switch rule.Effect {
+	case "Permit":
+		p.Effect = ladon.AllowAccess
+	case "Deny":
+		p.Effect = ladon.DenyAccess
+	default:
+		return nil, errors.Errorf("unknown effect %s", rule.Effect)
+	}
+
+	if rule.Obligations != nil || rule.Advice != nil {
+		return nil, errors.New("obligations and advice can not be represented")
+	}
+
+	patterns := map[string][]string{}
+	for _, anyOf := range append(append([]AnyOf{}, targets...), rule.Target.AnyOf...) {
+		category, values, err := convertAnyOf(anyOf)
+		if err != nil {
+			return nil, err
+		} else if _, ok := patterns[category]; ok {
+			return nil, errors.Errorf("more than one constraint on category %s can not be represented", category)
+		}
+		patterns[category] = values
+	}
+
+	p.Subjects = orMatchAll(patterns[CategorySubject])
+	p.Resources = orMatchAll(patterns[CategoryResource])
+	p.Actions = orMatchAll(patterns[CategoryAction])
+
+	if rule.Condition != nil && rule.Condition.Apply != nil {
+		if err := convertApply(*rule.Condition.Apply, p.Conditions); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func orMatchAll(patterns []string) []string {
+	if patterns == nil {
+		return []string{"<.*>"}
+	}
+	return patterns
+}
+
+func convertAnyOf(anyOf AnyOf) (string, []string, error) {
+	var category string
+	var values []string
+	for _, allOf := range anyOf.AllOf {
+		if len(allOf.Match) != 1 {
+			return "", nil, errors.New("AllOf elements with more than one Match can not be represented")
+		}
+
+		match := allOf.Match[0]
+		c := match.AttributeDesignator.Category
+		if id, ok := categoryAttributes[c]; !ok || id != match.AttributeDesignator.AttributeID {
+			return "", nil, errors.Errorf("target attribute %s of category %s can not be represented", match.AttributeDesignator.AttributeID, c)
+		} else if category != "" && category != c {
+			return "", nil, errors.New("AnyOf elements spanning more than one category can not be represented")
+		}
+		category = c
+
+		value, err := convertMatch(match)
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, value)
+	}
+
+	return category, values, nil
+}
+
+func convertMatch(match Match) (string, error) {
+	value := match.AttributeValue.Value
+	if strings.ContainsAny(value, "<>") {
+		return "", errors.Errorf("value %s contains regular expression delimiters", value)
+	}
+
+	switch match.MatchID {
+	case FunctionStringEqual:
+		return value, nil
+	case FunctionStringRegexpMatch:
+		// XACML regular expressions match anywhere in the value while ladon anchors them.
+		return "<.*(?:" + value + ").*>", nil
+	}
+	return "", errors.Errorf("match function %s can not be represented", match.MatchID)
+}
+
+func convertApply(apply Apply, conditions ladon.Conditions) error {
+	if apply.FunctionID == FunctionAnd {
+		if len(apply.AttributeValues) > 0 || len(apply.AttributeDesignators) > 0 {
+			return errors.New("only functions may be passed to and")
+		}
+
+		for _, child := range apply.Apply {
+			if err := convertApply(child, conditions); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var designators []AttributeDesignator
+	for _, child := range apply.Apply {
+		if !strings.HasSuffix(child.FunctionID, "-one-and-only") || len(child.AttributeDesignators) != 1 || len(child.Apply) > 0 {
+			return errors.Errorf("nested function %s can not be represented", child.FunctionID)
+		}
+		designators = append(designators, child.AttributeDesignators[0])
+	}
+	designators = append(designators, apply.AttributeDesignators...)
+
+	var key string
+	var condition ladon.Condition
+	switch {
+	case apply.FunctionID == FunctionStringEqual && len(designators) == 2 && len(apply.AttributeValues) == 0:
+		// Comparing an attribute with the subject is what EqualsSubjectCondition does.
+		for i, d := range designators {
+			if d.Category == CategorySubject && d.AttributeID == AttributeSubjectID {
+				key, condition = designators[1-i].AttributeID, &ladon.EqualsSubjectCondition{}
+			}
+		}
+	case len(designators) != 1 || len(apply.AttributeValues) != 1:
+	case apply.FunctionID == FunctionStringEqual:
+		key, condition = designators[0].AttributeID, &ladon.StringEqualCondition{Equals: apply.AttributeValues[0].Value}
+	case apply.FunctionID == FunctionStringRegexpMatch:
+		key, condition = designators[0].AttributeID, &ladon.StringMatchCondition{Matches: apply.AttributeValues[0].Value}
+	case apply.FunctionID == FunctionBooleanEqual:
+		switch strings.TrimSpace(apply.AttributeValues[0].Value) {
+		case "true", "1":
+			key, condition = designators[0].AttributeID, &ladon.BooleanCondition{BooleanValue: true}
+		case "false", "0":
+			key, condition = designators[0].AttributeID, &ladon.BooleanCondition{BooleanValue: false}
+		}
+	}
+
+	if condition == nil {
+		return errors.Errorf("condition function %s can not be represented", apply.FunctionID)
+	} else if _, ok := conditions[key]; ok {
+		return errors.Errorf("more than one condition on attribute %s can not be represented", key)
+	}
+
+	conditions.AddCondition(key, condition)
+	return nil
+}
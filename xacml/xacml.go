@@ -0,0 +1,178 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+// Package xacml converts XACML 3.0 policy documents to ladon policies and back.
+//
+// Every XACML rule becomes one ladon policy. Targets are translated to subjects, resources and actions, and
+// conditions are translated to ladon conditions where an equivalent exists. Constructs which can not be
+// represented are reported as issues and the affected rule is skipped, because dropping a part of it would
+// silently change what it grants or denies.
+package xacml
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Namespace is the XML namespace of XACML 3.0 documents.
+const Namespace = "urn:oasis:names:tc:xacml:3.0:core:schema:wd-17"
+
+// Attribute categories and identifiers understood by this package.
+const (
+	CategorySubject     = "urn:oasis:names:tc:xacml:1.0:subject-category:access-subject"
+	CategoryResource    = "urn:oasis:names:tc:xacml:3.0:attribute-category:resource"
+	CategoryAction      = "urn:oasis:names:tc:xacml:3.0:attribute-category:action"
+	CategoryEnvironment = "urn:oasis:names:tc:xacml:3.0:attribute-category:environment"
+
+	AttributeSubjectID  = "urn:oasis:names:tc:xacml:1.0:subject:subject-id"
+	AttributeResourceID = "urn:oasis:names:tc:xacml:1.0:resource:resource-id"
+	AttributeActionID   = "urn:oasis:names:tc:xacml:1.0:action:action-id"
+)
+
+// Functions understood by this package.
+const (
+	FunctionStringEqual       = "urn:oasis:names:tc:xacml:1.0:function:string-equal"
+	FunctionStringRegexpMatch = "urn:oasis:names:tc:xacml:1.0:function:string-regexp-match"
+	FunctionBooleanEqual      = "urn:oasis:names:tc:xacml:1.0:function:boolean-equal"
+	FunctionAnd               = "urn:oasis:names:tc:xacml:1.0:function:and"
+)
+
+// Data types understood by this package.
+const (
+	DataTypeString  = "http://www.w3.org/2001/XMLSchema#string"
+	DataTypeBoolean = "http://www.w3.org/2001/XMLSchema#boolean"
+)
+
+// AlgorithmDenyOverrides is the combining algorithm matching ladon's evaluation semantics.
+const AlgorithmDenyOverrides = "urn:oasis:names:tc:xacml:3.0:rule-combining-algorithm:deny-overrides"
+
+// AlgorithmPolicyDenyOverrides is the policy combining algorithm matching ladon's evaluation semantics.
+const AlgorithmPolicyDenyOverrides = "urn:oasis:names:tc:xacml:3.0:policy-combining-algorithm:deny-overrides"
+
+// Issue describes a construct which could not be converted.
+type Issue struct {
+	// PolicyID is the id of the XACML policy or ladon policy the issue was found in.
+	PolicyID string `json:"policy_id"`
+
+	// RuleID is the id of the XACML rule the issue was found in, if any.
+	RuleID string `json:"rule_id,omitempty"`
+
+	// Message describes the issue.
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.RuleID == "" {
+		return fmt.Sprintf("policy %s: %s", i.PolicyID, i.Message)
+	}
+	return fmt.Sprintf("policy %s, rule %s: %s", i.PolicyID, i.RuleID, i.Message)
+}
+
+// PolicySet is a XACML policy set.
+type PolicySet struct {
+	XMLName                  xml.Name    `xml:"PolicySet"`
+	Namespace                string      `xml:"xmlns,attr,omitempty"`
+	PolicySetID              string      `xml:"PolicySetId,attr"`
+	Version                  string      `xml:"Version,attr,omitempty"`
+	PolicyCombiningAlgorithm string      `xml:"PolicyCombiningAlgId,attr"`
+	Description              string      `xml:"Description,omitempty"`
+	Target                   Target      `xml:"Target"`
+	PolicySets               []PolicySet `xml:"PolicySet"`
+	Policies                 []Policy    `xml:"Policy"`
+}
+
+// Policy is a XACML policy.
+type Policy struct {
+	XMLName                xml.Name     `xml:"Policy"`
+	Namespace              string       `xml:"xmlns,attr,omitempty"`
+	PolicyID               string       `xml:"PolicyId,attr"`
+	Version                string       `xml:"Version,attr,omitempty"`
+	RuleCombiningAlgorithm string       `xml:"RuleCombiningAlgId,attr"`
+	Description            string       `xml:"Description,omitempty"`
+	Target                 Target       `xml:"Target"`
+	Rules                  []Rule       `xml:"Rule"`
+	Obligations            *expressions `xml:"ObligationExpressions"`
+	Advice                 *expressions `xml:"AdviceExpressions"`
+}
+
+// Rule is a XACML rule.
+type Rule struct {
+	RuleID      string       `xml:"RuleId,attr"`
+	Effect      string       `xml:"Effect,attr"`
+	Description string       `xml:"Description,omitempty"`
+	Target      Target       `xml:"Target"`
+	Condition   *Condition   `xml:"Condition"`
+	Obligations *expressions `xml:"ObligationExpressions"`
+	Advice      *expressions `xml:"AdviceExpressions"`
+}
+
+// Target is a XACML target. All AnyOf elements must match.
+type Target struct {
+	AnyOf []AnyOf `xml:"AnyOf"`
+}
+
+// AnyOf matches if at least one AllOf element matches.
+type AnyOf struct {
+	AllOf []AllOf `xml:"AllOf"`
+}
+
+// AllOf matches if all Match elements match.
+type AllOf struct {
+	Match []Match `xml:"Match"`
+}
+
+// Match compares an attribute value with an attribute of the request.
+type Match struct {
+	MatchID             string              `xml:"MatchId,attr"`
+	AttributeValue      AttributeValue      `xml:"AttributeValue"`
+	AttributeDesignator AttributeDesignator `xml:"AttributeDesignator"`
+}
+
+// AttributeValue is a literal value.
+type AttributeValue struct {
+	DataType string `xml:"DataType,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// AttributeDesignator references an attribute of the request.
+type AttributeDesignator struct {
+	Category      string `xml:"Category,attr"`
+	AttributeID   string `xml:"AttributeId,attr"`
+	DataType      string `xml:"DataType,attr"`
+	MustBePresent bool   `xml:"MustBePresent,attr"`
+}
+
+// Condition is the condition of a XACML rule.
+type Condition struct {
+	Apply *Apply `xml:"Apply"`
+}
+
+// Apply applies a function to its arguments.
+type Apply struct {
+	FunctionID           string                `xml:"FunctionId,attr"`
+	Apply                []Apply               `xml:"Apply"`
+	AttributeValues      []AttributeValue      `xml:"AttributeValue"`
+	AttributeDesignators []AttributeDesignator `xml:"AttributeDesignator"`
+}
+
+// expressions holds obligation and advice expressions, which have no equivalent in ladon.
+type expressions struct {
+	Inner string `xml:",innerxml"`
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright © 2016-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * @author		Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @copyright 	2015-2018 Aeneas Rekkas <aeneas+oss@aeneas.io>
+ * @license 	Apache-2.0
+ */
+
+package xacml
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+)
+
+const document = `<?xml version="1.0" encoding="UTF-8"?>
+<PolicySet xmlns="urn:oasis:names:tc:xacml:3.0:core:schema:wd-17" PolicySetId="articles" Version="1.0"
+    PolicyCombiningAlgId="urn:oasis:names:tc:xacml:3.0:policy-combining-algorithm:deny-overrides">
+  <Target/>
+  <Policy PolicyId="editors" Version="1.0"
+      RuleCombiningAlgId="urn:oasis:names:tc:xacml:3.0:rule-combining-algorithm:deny-overrides">
+    <Description>Editors may manage their own articles</Description>
+    <Target>
+      <AnyOf>
+        <AllOf>
+          <Match MatchId="urn:oasis:names:tc:xacml:1.0:function:string-regexp-match">
+            <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">^articles:[0-9]+$</AttributeValue>
+            <AttributeDesignator Category="urn:oasis:names:tc:xacml:3.0:attribute-category:resource"
+                AttributeId="urn:oasis:names:tc:xacml:1.0:resource:resource-id"
+                DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="false"/>
+          </Match>
+        </AllOf>
+      </AnyOf>
+    </Target>
+    <Rule RuleId="update" Effect="Permit">
+      <Target>
+        <AnyOf>
+          <AllOf>
+            <Match MatchId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+              <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">peter</AttributeValue>
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:1.0:subject-category:access-subject"
+                  AttributeId="urn:oasis:names:tc:xacml:1.0:subject:subject-id"
+                  DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="false"/>
+            </Match>
+          </AllOf>
+          <AllOf>
+            <Match MatchId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+              <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">ken</AttributeValue>
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:1.0:subject-category:access-subject"
+                  AttributeId="urn:oasis:names:tc:xacml:1.0:subject:subject-id"
+                  DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="false"/>
+            </Match>
+          </AllOf>
+        </AnyOf>
+        <AnyOf>
+          <AllOf>
+            <Match MatchId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+              <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">update</AttributeValue>
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:3.0:attribute-category:action"
+                  AttributeId="urn:oasis:names:tc:xacml:1.0:action:action-id"
+                  DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="false"/>
+            </Match>
+          </AllOf>
+        </AnyOf>
+      </Target>
+      <Condition>
+        <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:and">
+          <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+            <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:string-one-and-only">
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:3.0:attribute-category:resource"
+                  AttributeId="owner" DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="true"/>
+            </Apply>
+            <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:string-one-and-only">
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:1.0:subject-category:access-subject"
+                  AttributeId="urn:oasis:names:tc:xacml:1.0:subject:subject-id"
+                  DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="true"/>
+            </Apply>
+          </Apply>
+          <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:boolean-equal">
+            <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:boolean-one-and-only">
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:3.0:attribute-category:environment"
+                  AttributeId="mfa" DataType="http://www.w3.org/2001/XMLSchema#boolean" MustBePresent="true"/>
+            </Apply>
+            <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#boolean">true</AttributeValue>
+          </Apply>
+        </Apply>
+      </Condition>
+    </Rule>
+    <Rule RuleId="archived" Effect="Deny">
+      <Condition>
+        <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+          <Apply FunctionId="urn:oasis:names:tc:xacml:1.0:function:string-one-and-only">
+            <AttributeDesignator Category="urn:oasis:names:tc:xacml:3.0:attribute-category:resource"
+                AttributeId="state" DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="true"/>
+          </Apply>
+          <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">archived</AttributeValue>
+        </Apply>
+      </Condition>
+    </Rule>
+    <Rule RuleId="weekdays" Effect="Permit">
+      <Condition>
+        <Apply FunctionId="urn:oasis:names:tc:xacml:2.0:function:time-in-range"/>
+      </Condition>
+    </Rule>
+  </Policy>
+  <Policy PolicyId="first" Version="1.0"
+      RuleCombiningAlgId="urn:oasis:names:tc:xacml:1.0:rule-combining-algorithm:first-applicable">
+    <Rule RuleId="mixed" Effect="Permit">
+      <Target>
+        <AnyOf>
+          <AllOf>
+            <Match MatchId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+              <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">peter</AttributeValue>
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:1.0:subject-category:access-subject"
+                  AttributeId="urn:oasis:names:tc:xacml:1.0:subject:subject-id"
+                  DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="false"/>
+            </Match>
+            <Match MatchId="urn:oasis:names:tc:xacml:1.0:function:string-equal">
+              <AttributeValue DataType="http://www.w3.org/2001/XMLSchema#string">read</AttributeValue>
+              <AttributeDesignator Category="urn:oasis:names:tc:xacml:3.0:attribute-category:action"
+                  AttributeId="urn:oasis:names:tc:xacml:1.0:action:action-id"
+                  DataType="http://www.w3.org/2001/XMLSchema#string" MustBePresent="false"/>
+            </Match>
+          </AllOf>
+        </AnyOf>
+      </Target>
+    </Rule>
+  </Policy>
+</PolicySet>`
+
+func TestImport(t *testing.T) {
+	policies, issues, err := Import([]byte(document))
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+
+	assert.Equal(t, &ladon.DefaultPolicy{
+		ID:          "editors:update",
+		Description: "Editors may manage their own articles",
+		Subjects:    []string{"peter", "ken"},
+		Resources:   []string{"<.*(?:^articles:[0-9]+$).*>"},
+		Actions:     []string{"update"},
+		Effect:      ladon.AllowAccess,
+		Conditions: ladon.Conditions{
+			"owner": &ladon.EqualsSubjectCondition{},
+			"mfa":   &ladon.BooleanCondition{BooleanValue: true},
+		},
+	}, policies[0])
+	assert.Equal(t, &ladon.DefaultPolicy{
+		ID:          "editors:archived",
+		Description: "Editors may manage their own articles",
+		Subjects:    []string{"<.*>"},
+		Resources:   []string{"<.*(?:^articles:[0-9]+$).*>"},
+		Actions:     []string{"<.*>"},
+		Effect:      ladon.DenyAccess,
+		Conditions: ladon.Conditions{
+			"state": &ladon.StringEqualCondition{Equals: "archived"},
+		},
+	}, policies[1])
+
+	require.Len(t, issues, 3)
+	assert.Equal(t, "editors", issues[0].PolicyID)
+	assert.Equal(t, "weekdays", issues[0].RuleID)
+	assert.Contains(t, issues[0].Message, "time-in-range")
+	assert.Equal(t, "first", issues[1].PolicyID)
+	assert.Contains(t, issues[1].Message, "first-applicable")
+	assert.Equal(t, "mixed", issues[2].RuleID)
+
+	warden := &ladon.Ladon{Manager: memory.NewMemoryManager()}
+	for _, p := range policies {
+		require.NoError(t, warden.Manager.Create(p))
+	}
+
+	for k, c := range []struct {
+		r       *ladon.Request
+		allowed bool
+	}{
+		{r: &ladon.Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: ladon.Context{"owner": "peter", "mfa": true}}, allowed: true},
+		{r: &ladon.Request{Subject: "ken", Action: "update", Resource: "articles:1", Context: ladon.Context{"owner": "peter", "mfa": true}}},
+		{r: &ladon.Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: ladon.Context{"owner": "peter", "mfa": false}}},
+		{r: &ladon.Request{Subject: "peter", Action: "update", Resource: "articles:1", Context: ladon.Context{"owner": "peter", "mfa": true, "state": "archived"}}},
+		{r: &ladon.Request{Subject: "peter", Action: "update", Resource: "articles:abc", Context: ladon.Context{"owner": "peter", "mfa": true}}},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.allowed, warden.IsAllowed(c.r) == nil)
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	_, _, err := Import([]byte(`<Request/>`))
+	assert.Error(t, err)
+
+	_, _, err = Import([]byte(`not xml`))
+	assert.Error(t, err)
+}
+
+func TestExport(t *testing.T) {
+	policies := ladon.Policies{
+		&ladon.DefaultPolicy{
+			ID:          "1",
+			Description: "Peter may update articles he owns",
+			Subjects:    []string{"peter"},
+			Resources:   []string{"articles:<[0-9]+>"},
+			Actions:     []string{"update", "get"},
+			Effect:      ladon.AllowAccess,
+			Conditions: ladon.Conditions{
+				"owner": &ladon.EqualsSubjectCondition{},
+				"state": &ladon.StringEqualCondition{Equals: "draft"},
+			},
+		},
+		&ladon.DefaultPolicy{
+			ID:        "2",
+			Subjects:  []string{"<.*>"},
+			Resources: []string{"<.*>"},
+			Actions:   []string{"delete"},
+			Effect:    ladon.DenyAccess,
+			Conditions: ladon.Conditions{
+				"mfa": &ladon.BooleanCondition{BooleanValue: false},
+			},
+		},
+		&ladon.DefaultPolicy{
+			ID:        "3",
+			Subjects:  []string{"peter"},
+			Resources: []string{"<.*>"},
+			Actions:   []string{"<.*>"},
+			Effect:    ladon.AllowAccess,
+			Conditions: ladon.Conditions{
+				"ip": &ladon.CIDRCondition{CIDR: "127.0.0.1/32"},
+			},
+		},
+		&ladon.DefaultPolicy{ID: "4", Effect: ladon.AllowAccess},
+	}
+
+	out, issues, err := Export(policies)
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	assert.Equal(t, "3", issues[0].PolicyID)
+	assert.Equal(t, "4", issues[1].PolicyID)
+
+	imported, issues, err := Import(out)
+	require.NoError(t, err)
+	require.Empty(t, issues)
+	require.Len(t, imported, 2)
+
+	assert.Equal(t, "1:1", imported[0].GetID())
+	assert.Equal(t, []string{"peter"}, imported[0].GetSubjects())
+	assert.Equal(t, []string{"<.*(?:^articles:([0-9]+)$).*>"}, imported[0].GetResources())
+	assert.Equal(t, []string{"update", "get"}, imported[0].GetActions())
+	assert.Equal(t, ladon.Conditions{
+		"owner": &ladon.EqualsSubjectCondition{},
+		"state": &ladon.StringEqualCondition{Equals: "draft"},
+	}, imported[0].GetConditions())
+
+	assert.Equal(t, "2:2", imported[1].GetID())
+	assert.Equal(t, ladon.DenyAccess, imported[1].GetEffect())
+	assert.Equal(t, []string{"<.*>"}, imported[1].GetSubjects())
+	assert.Equal(t, ladon.Conditions{
+		"mfa": &ladon.BooleanCondition{BooleanValue: false},
+	}, imported[1].GetConditions())
+}